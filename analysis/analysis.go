@@ -0,0 +1,152 @@
+// Package analysis runs syntax-level analyzers over the modules of the corpus
+// and stores their results in the database.
+//
+// Each analyzer has a results table named "analysis_" followed by the
+// analyzer's name. Its columns are module_path, version, and the analyzer's
+// Columns. The analysis_runs table records which module versions each
+// analyzer has processed, so that a Runner can skip them. If an analyzer's
+// Columns change, its table is replaced and every module is analyzed again.
+//
+// Nothing finer than a module version is cached: a module's files are parsed
+// each time it is analyzed. Caching facts about individual files, so that
+// files shared by several versions of a module are analyzed once, would need
+// analyzers whose results depend on a single file, and a [Pass] sees the
+// whole module.
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// An Analyzer examines the syntax of a module's Go files.
+type Analyzer struct {
+	// Name identifies the analyzer. It must be a lower-case identifier.
+	Name string
+	// Doc describes the analyzer.
+	Doc string
+	// Version should be incremented when the analyzer changes, so that
+	// modules are analyzed again.
+	Version int
+	// Columns are the column definitions of the analyzer's results,
+	// like "file TEXT NOT NULL". If their names change, the results
+	// table is replaced.
+	Columns []string
+	// Indexes are lists of columns to index, like "name" or "package, name".
+	Indexes []string
+	// Run analyzes a module. It calls pass.Report for each result.
+	Run func(pass *Pass) error
+}
+
+// Table returns the name of a's results table.
+func (a *Analyzer) Table() string {
+	return "analysis_" + a.Name
+}
+
+// columnNames returns the names of a's columns.
+func (a *Analyzer) columnNames() []string {
+	var names []string
+	for _, c := range a.Columns {
+		name, _, _ := strings.Cut(strings.TrimSpace(c), " ")
+		names = append(names, name)
+	}
+	return names
+}
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func (a *Analyzer) validate() error {
+	if !validName.MatchString(a.Name) {
+		return fmt.Errorf("analysis: bad analyzer name %q", a.Name)
+	}
+	if a.Run == nil || len(a.Columns) == 0 {
+		return fmt.Errorf("analysis: analyzer %s needs Run and Columns", a.Name)
+	}
+	cols := a.columnNames()
+	for _, c := range cols {
+		if !validName.MatchString(c) {
+			return fmt.Errorf("analysis: analyzer %s: bad column name %q", a.Name, c)
+		}
+	}
+	for _, ix := range a.Indexes {
+		for c := range strings.SplitSeq(ix, ",") {
+			if c := strings.TrimSpace(c); !slices.Contains(cols, c) {
+				return fmt.Errorf("analysis: analyzer %s: index on unknown column %q", a.Name, c)
+			}
+		}
+	}
+	return nil
+}
+
+// A Pass holds the inputs to one run of an analyzer on a module.
+type Pass struct {
+	Analyzer *Analyzer
+	Path     string // module path
+	Version  string
+	Fset     *token.FileSet
+	Files    []*File
+	// ModuleFS holds all the files of the module, not just the Go files
+	// of the corpus. It is nil unless the runner has a ZipDir containing
+	// the module.
+	ModuleFS fs.FS
+
+	rows [][]any
+}
+
+// A File is a parsed Go file of a module.
+type File struct {
+	Name string // relative to the module root, with forward slashes
+	AST  *ast.File
+}
+
+// Report records a result, with one value for each of the analyzer's Columns.
+func (p *Pass) Report(vals ...any) {
+	if n := len(p.Analyzer.Columns); len(vals) != n {
+		panic(fmt.Sprintf("analysis: %s: Report got %d values, want %d", p.Analyzer.Name, len(vals), n))
+	}
+	p.rows = append(p.rows, append([]any{p.Path, p.Version}, vals...))
+}
+
+var (
+	mu       sync.Mutex
+	registry = map[string]*Analyzer{}
+)
+
+// Register makes an analyzer available by name.
+// It panics if the analyzer is invalid or the name is already registered.
+func Register(a *Analyzer) {
+	if err := a.validate(); err != nil {
+		panic(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if registry[a.Name] != nil {
+		panic("analysis: duplicate analyzer " + a.Name)
+	}
+	registry[a.Name] = a
+}
+
+// Lookup returns the registered analyzer with the given name, or nil.
+func Lookup(name string) *Analyzer {
+	mu.Lock()
+	defer mu.Unlock()
+	return registry[name]
+}
+
+// Analyzers returns the registered analyzers, sorted by name.
+func Analyzers() []*Analyzer {
+	mu.Lock()
+	defer mu.Unlock()
+	as := make([]*Analyzer, 0, len(registry))
+	for _, a := range registry {
+		as = append(as, a)
+	}
+	slices.SortFunc(as, func(a, b *Analyzer) int { return strings.Compare(a.Name, b.Name) })
+	return as
+}
@@ -0,0 +1,195 @@
+package analysis
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/internal/database"
+	"golang.org/x/mod/module"
+	_ "modernc.org/sqlite"
+)
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	corpus := t.TempDir()
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.0.0", map[string]string{
+		"go.mod":        "module example.com/a\n",
+		"a.go":          "package a\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n",
+		"sub/b.go":      "package sub\nimport \"strings\"\n",
+		"bad.go":        "package",
+		"README.md":     "not go",
+		"sub/c_test.go": "package sub\nimport \"testing\"\n",
+	})
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	failing := &Analyzer{
+		Name:    "failing",
+		Columns: []string{"x TEXT"},
+		Run:     func(*Pass) error { return errors.New("bad") },
+	}
+	r := &Runner{DB: db, CorpusDir: corpus, Analyzers: []*Analyzer{Imports, failing}, Concurrency: 2}
+	mods := []module.Version{
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/missing", Version: "v1.0.0"},
+	}
+	s, err := r.Run(ctx, slices.Values(mods))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Modules != 1 || s.Results != 4 || s.Failures != 2 {
+		t.Errorf("got %d modules, %d results, %d failures; want 1, 4, 2", s.Modules, s.Results, s.Failures)
+	}
+
+	type row struct{ File, ImportPath string }
+	seq, errf := database.ScanRowsAs[row](ctx, db, "SELECT file, import_path FROM analysis_imports ORDER BY import_path")
+	var got []row
+	for r := range seq {
+		got = append(got, *r)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	want := []row{{"a.go", "fmt"}, {"a.go", "os"}, {"sub/b.go", "strings"}, {"sub/c_test.go", "testing"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A second run skips the work already done.
+	r.Analyzers = []*Analyzer{Imports}
+	s, err = r.Run(ctx, slices.Values(mods[:1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Modules != 0 || s.Skipped != 1 {
+		t.Errorf("second run: got %d modules, %d skipped; want 0, 1", s.Modules, s.Skipped)
+	}
+
+	// Forcing replaces the results.
+	r.Force = true
+	s, err = r.Run(ctx, slices.Values(mods[:1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM analysis_imports").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if s.Modules != 1 || n != 4 {
+		t.Errorf("forced run: got %d modules, %d rows; want 1, 4", s.Modules, n)
+	}
+
+	// RunModule skips analyzers that have run, and reports failures.
+	r.Force = false
+	r.Analyzers = []*Analyzer{Imports, failing}
+	n, err = r.RunModule(ctx, mods[0])
+	if err == nil || !strings.Contains(err.Error(), "failing: bad") || n != 0 {
+		t.Errorf("RunModule: got %d, %v; want 0 and a failure", n, err)
+	}
+	if _, err := r.RunModule(ctx, mods[1]); err == nil {
+		t.Error("RunModule of missing module: got nil error")
+	}
+
+	// Results can be computed without the database, encoded,
+	// and written elsewhere.
+	results, err := (&Runner{CorpusDir: corpus, Analyzers: r.Analyzers}).AnalyzeModule(mods[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = DecodeResults(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM analysis_imports"); err != nil {
+		t.Fatal(err)
+	}
+	n, err = r.WriteResults(ctx, results)
+	if err == nil || !strings.Contains(err.Error(), "failing: bad") || n != 4 {
+		t.Errorf("WriteResults: got %d, %v; want 4 and a failure", n, err)
+	}
+	r.Analyzers = []*Analyzer{failing}
+	if _, err := r.WriteResults(ctx, results); err == nil {
+		t.Error("WriteResults with unknown analyzer: got nil error")
+	}
+}
+
+func TestChangedColumns(t *testing.T) {
+	ctx := context.Background()
+	corpus := t.TempDir()
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.0.0", map[string]string{"a.go": "package a\n"})
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mv := module.Version{Path: "example.com/a", Version: "v1.0.0"}
+
+	a := &Analyzer{
+		Name:    "files",
+		Columns: []string{"file TEXT"},
+		Run: func(p *Pass) error {
+			for _, f := range p.Files {
+				p.Report(f.Name)
+			}
+			return nil
+		},
+	}
+	r := &Runner{DB: db, CorpusDir: corpus, Analyzers: []*Analyzer{a}}
+	if _, err := r.RunModule(ctx, mv); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new version of the analyzer with another column replaces the table.
+	a = &Analyzer{
+		Name:    "files",
+		Version: 1,
+		Columns: []string{"file TEXT", "package TEXT"},
+		Run: func(p *Pass) error {
+			for _, f := range p.Files {
+				p.Report(f.Name, f.AST.Name.Name)
+			}
+			return nil
+		},
+	}
+	r.Analyzers = []*Analyzer{a}
+	n, err := r.RunModule(ctx, mv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pkg string
+	if err := db.QueryRow("SELECT package FROM analysis_files").Scan(&pkg); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || pkg != "a" {
+		t.Errorf("got %d rows with package %q, want 1 with package a", n, pkg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	run := func(*Pass) error { return nil }
+	for _, a := range []*Analyzer{
+		{Name: "Bad", Columns: []string{"x TEXT"}, Run: run},
+		{Name: "ok", Columns: []string{"x TEXT"}},
+		{Name: "ok", Run: run},
+		{Name: "ok", Columns: []string{"x; DROP TABLE y"}, Run: run},
+		{Name: "ok", Columns: []string{"x TEXT"}, Indexes: []string{"x, y"}, Run: run},
+	} {
+		if err := a.validate(); err == nil {
+			t.Errorf("%+v: got nil, want error", a)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// Package analysistest helps test analyzers and the code they call.
+package analysistest
+
+import (
+	"go/parser"
+	"go/token"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/analysis"
+)
+
+// Parse parses files, which maps file names relative to the module root to
+// their contents, as a [analysis.Runner] does. It returns the files in name
+// order.
+func Parse(t testing.TB, files map[string]string) (*token.FileSet, []*analysis.File) {
+	t.Helper()
+	fset := token.NewFileSet()
+	var fs []*analysis.File
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		f, err := parser.ParseFile(fset, name, files[name], parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs = append(fs, &analysis.File{Name: name, AST: f})
+	}
+	return fset, fs
+}
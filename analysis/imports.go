@@ -0,0 +1,29 @@
+package analysis
+
+import (
+	"strconv"
+)
+
+// Imports records the import paths of each file.
+var Imports = &Analyzer{
+	Name:    "imports",
+	Doc:     "record the imports of each Go file",
+	Version: 1,
+	Columns: []string{"file TEXT NOT NULL", "import_path TEXT NOT NULL"},
+	Run: func(pass *Pass) error {
+		for _, f := range pass.Files {
+			for _, spec := range f.AST.Imports {
+				path, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					continue
+				}
+				pass.Report(f.Name, path)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	Register(Imports)
+}
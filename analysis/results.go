@@ -0,0 +1,127 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"golang.org/x/mod/module"
+)
+
+// A Result is the outcome of running one analyzer on one module, in a form
+// that can be sent to another machine and written there with
+// [Runner.WriteResults].
+type Result struct {
+	Analyzer        string
+	AnalyzerVersion int
+	Path            string
+	Version         string
+	Rows            [][]any `json:",omitempty"` // the values passed to Report
+	Error           string  `json:",omitempty"`
+}
+
+// AnalyzeModule runs the runner's analyzers on mv and returns their results,
+// without using the database. Analyzer failures are recorded in the results;
+// the error is for failures that affect all analyzers, like a missing zip.
+func (r *Runner) AnalyzeModule(mv module.Version) (_ []*Result, err error) {
+	defer errs.Wrap(&err, "analysis.Runner.AnalyzeModule(%s)", mv)
+	for _, a := range r.Analyzers {
+		if err := a.validate(); err != nil {
+			return nil, err
+		}
+	}
+	res, err := r.analyze(mv, nil)
+	if err != nil || res == nil {
+		return nil, err
+	}
+	var results []*Result
+	for _, p := range res.passes {
+		rs := &Result{Analyzer: p.Analyzer.Name, AnalyzerVersion: p.Analyzer.Version, Path: p.Path, Version: p.Version}
+		for _, row := range p.rows {
+			rs.Rows = append(rs.Rows, row[2:])
+		}
+		results = append(results, rs)
+	}
+	for _, a := range r.Analyzers {
+		if err := res.errs[a.Name]; err != nil {
+			results = append(results, &Result{Analyzer: a.Name, AnalyzerVersion: a.Version,
+				Path: mv.Path, Version: mv.Version, Error: err.Error()})
+		}
+	}
+	return results, nil
+}
+
+// WriteResults writes results returned by [Runner.AnalyzeModule], as
+// [Runner.RunModule] would. Each result's analyzer must be one of the
+// runner's analyzers, at the same version. It returns the number of rows
+// written, and an error describing the failed analyzers, if any.
+func (r *Runner) WriteResults(ctx context.Context, results []*Result) (_ int, err error) {
+	defer errs.Wrap(&err, "analysis.Runner.WriteResults")
+	if err := r.createTables(ctx); err != nil {
+		return 0, err
+	}
+	var (
+		passes []*Pass
+		aerrs  []error
+	)
+	for _, rs := range results {
+		i := slices.IndexFunc(r.Analyzers, func(a *Analyzer) bool { return a.Name == rs.Analyzer })
+		if i < 0 {
+			return 0, fmt.Errorf("unknown analyzer %q", rs.Analyzer)
+		}
+		a := r.Analyzers[i]
+		if rs.AnalyzerVersion != a.Version {
+			return 0, fmt.Errorf("analyzer %s: result is from version %d, want %d", a.Name, rs.AnalyzerVersion, a.Version)
+		}
+		if rs.Error != "" {
+			aerrs = append(aerrs, fmt.Errorf("%s: %s", a.Name, rs.Error))
+			continue
+		}
+		p := &Pass{Analyzer: a, Path: rs.Path, Version: rs.Version}
+		for _, row := range rs.Rows {
+			if len(row) != len(a.Columns) {
+				return 0, fmt.Errorf("analyzer %s: row has %d values, want %d", a.Name, len(row), len(a.Columns))
+			}
+			p.Report(row...)
+		}
+		passes = append(passes, p)
+	}
+	n, err := r.write(ctx, passes)
+	if err != nil {
+		return n, err
+	}
+	return n, errors.Join(aerrs...)
+}
+
+// DecodeResults decodes JSON-encoded results. Unlike [json.Unmarshal],
+// it decodes integer values as int64, so they are stored as integers.
+func DecodeResults(data []byte) ([]*Result, error) {
+	var results []*Result
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&results); err != nil {
+		return nil, err
+	}
+	for _, rs := range results {
+		for _, row := range rs.Rows {
+			for i, v := range row {
+				n, ok := v.(json.Number)
+				if !ok {
+					continue
+				}
+				if x, err := n.Int64(); err == nil {
+					row[i] = x
+				} else if f, err := n.Float64(); err == nil {
+					row[i] = f
+				} else {
+					return nil, err
+				}
+			}
+		}
+	}
+	return results, nil
+}
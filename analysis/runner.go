@@ -0,0 +1,351 @@
+package analysis
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/pool"
+	"github.com/jba/go-ecosystem/modfs"
+	"golang.org/x/mod/module"
+)
+
+// A Runner runs analyzers over modules in the corpus.
+type Runner struct {
+	DB          *sql.DB
+	CorpusDir   string // module zips, laid out as described in [modfs.ZipPath]
+	ZipDir      string // if set, untrimmed module zips, laid out the same way; see [Pass.ModuleFS]
+	Analyzers   []*Analyzer
+	Concurrency int  // modules parsed at once; zero means 1
+	Force       bool // analyze modules even if they have been analyzed by the same analyzer version
+}
+
+// A Summary describes the work of [Runner.Run].
+type Summary struct {
+	Modules  int // modules analyzed
+	Skipped  int // modules already analyzed, or not in the corpus
+	Results  int // rows written
+	Failures int // modules for which an analyzer failed; see Errors
+	Errors   errs.Collector
+}
+
+// Run analyzes each module in mods with the runner's analyzers.
+// Each module's files are parsed once and shared among the analyzers.
+// Failures of individual modules are recorded in the summary; Run
+// returns an error only if it cannot continue.
+func (r *Runner) Run(ctx context.Context, mods iter.Seq[module.Version]) (_ *Summary, err error) {
+	defer errs.Wrap(&err, "analysis.Runner.Run")
+	for _, a := range r.Analyzers {
+		if err := a.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.createTables(ctx); err != nil {
+		return nil, err
+	}
+	done, err := r.analyzed(ctx, module.Version{})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Summary{}
+	var mu sync.Mutex // guards s and writes to the database
+	// Module failures are recorded in s, so only a failed write stops the pool.
+	p := &pool.Pool[module.Version]{Concurrency: r.Concurrency}
+	err = p.Run(ctx, mods, func(ctx context.Context, mv module.Version) error {
+		res, err := r.analyze(mv, done)
+		mu.Lock()
+		defer mu.Unlock()
+		key := mv.Path + "@" + mv.Version
+		if err != nil {
+			s.Failures++
+			s.Errors.Add(key, err)
+			return nil
+		}
+		if res == nil {
+			s.Skipped++
+			return nil
+		}
+		s.Modules++
+		for name, err := range res.errs {
+			s.Failures++
+			s.Errors.Add(key+" "+name, err)
+		}
+		n, err := r.write(ctx, res.passes)
+		if err != nil {
+			return err
+		}
+		s.Results += n
+		return nil
+	})
+	return s, err
+}
+
+// RunModule analyzes a single module with the runner's analyzers, like Run.
+// Unlike Run, it reads only the module's own analysis records, so it is
+// suitable for processing modules one at a time, and it returns an error
+// if any analyzer fails. It returns the number of rows written.
+func (r *Runner) RunModule(ctx context.Context, mv module.Version) (_ int, err error) {
+	defer errs.Wrap(&err, "analysis.Runner.RunModule(%s)", mv)
+	for _, a := range r.Analyzers {
+		if err := a.validate(); err != nil {
+			return 0, err
+		}
+	}
+	if err := r.createTables(ctx); err != nil {
+		return 0, err
+	}
+	done, err := r.analyzed(ctx, mv)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.analyze(mv, done)
+	if err != nil || res == nil {
+		return 0, err
+	}
+	n, err := r.write(ctx, res.passes)
+	if err != nil {
+		return n, err
+	}
+	var aerrs []error
+	for _, name := range slices.Sorted(maps.Keys(res.errs)) {
+		aerrs = append(aerrs, fmt.Errorf("%s: %w", name, res.errs[name]))
+	}
+	return n, errors.Join(aerrs...)
+}
+
+// A moduleResult is the result of analyzing one module.
+type moduleResult struct {
+	passes []*Pass
+	errs   map[string]error // by analyzer name
+}
+
+// analyze runs the analyzers that are not recorded in done as having
+// analyzed mv at their current version. It returns nil if there are none.
+func (r *Runner) analyze(mv module.Version, done map[runKey]int) (*moduleResult, error) {
+	var as []*Analyzer
+	for _, a := range r.Analyzers {
+		if v, ok := done[runKey{a.Name, mv.Path, mv.Version}]; r.Force || !ok || v != a.Version {
+			as = append(as, a)
+		}
+	}
+	if len(as) == 0 {
+		return nil, nil
+	}
+	fset, files, err := r.parse(mv)
+	if err != nil {
+		return nil, err
+	}
+	mfs, err := r.openModule(mv)
+	if err != nil {
+		return nil, err
+	}
+	if mfs != nil {
+		defer mfs.Close()
+	}
+	res := &moduleResult{errs: map[string]error{}}
+	for _, a := range as {
+		p := &Pass{Analyzer: a, Path: mv.Path, Version: mv.Version, Fset: fset, Files: files}
+		if mfs != nil {
+			p.ModuleFS = mfs
+		}
+		if err := run(a, p); err != nil {
+			res.errs[a.Name] = err
+			continue
+		}
+		res.passes = append(res.passes, p)
+	}
+	return res, nil
+}
+
+// run runs a, converting a panic into an error.
+func run(a *Analyzer, p *Pass) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("analyzer %s panicked: %v", a.Name, x)
+		}
+	}()
+	return a.Run(p)
+}
+
+// parse parses the Go files of mv. Files that fail to parse are skipped.
+func (r *Runner) parse(mv module.Version) (*token.FileSet, []*File, error) {
+	zipFile, err := modfs.ZipPath(r.CorpusDir, mv.Path, mv.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	mfs, err := modfs.Open(zipFile, mv.Path, mv.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer mfs.Close()
+	fset := token.NewFileSet()
+	var files []*File
+	err = fs.WalkDir(mfs, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != ".go" {
+			return nil
+		}
+		src, err := fs.ReadFile(mfs, name)
+		if err != nil {
+			return err
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			slog.Debug("analysis: skipping file", "module", mv, "file", name, "err", err)
+			return nil
+		}
+		files = append(files, &File{Name: name, AST: f})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return fset, files, nil
+}
+
+// openModule opens the untrimmed zip of mv in the runner's ZipDir.
+// It returns nil if there is no ZipDir or the zip is not in it.
+func (r *Runner) openModule(mv module.Version) (*modfs.FS, error) {
+	if r.ZipDir == "" {
+		return nil, nil
+	}
+	zipFile, err := modfs.ZipPath(r.ZipDir, mv.Path, mv.Version)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(zipFile); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return modfs.Open(zipFile, mv.Path, mv.Version)
+}
+
+const runsTable = `
+	CREATE TABLE IF NOT EXISTS analysis_runs (
+		analyzer    TEXT NOT NULL,
+		module_path TEXT NOT NULL,
+		version     TEXT NOT NULL,
+		analyzer_version INTEGER NOT NULL,
+		PRIMARY KEY (analyzer, module_path, version)
+	)`
+
+// createTables creates the runs table and the results tables of the
+// runner's analyzers, if they don't exist.
+func (r *Runner) createTables(ctx context.Context) error {
+	if _, err := r.DB.ExecContext(ctx, runsTable); err != nil {
+		return err
+	}
+	for _, a := range r.Analyzers {
+		if err := r.replaceChangedTable(ctx, a); err != nil {
+			return err
+		}
+		q := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (module_path TEXT NOT NULL, version TEXT NOT NULL, %s)",
+			a.Table(), strings.Join(a.Columns, ", "))
+		if _, err := r.DB.ExecContext(ctx, q); err != nil {
+			return err
+		}
+		q = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_module ON %[1]s (module_path, version)", a.Table())
+		if _, err := r.DB.ExecContext(ctx, q); err != nil {
+			return err
+		}
+		for i, ix := range a.Indexes {
+			q := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_%[2]d ON %[1]s (%[3]s)", a.Table(), i, ix)
+			if _, err := r.DB.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replaceChangedTable drops a's results table if its columns are not a's
+// Columns, and deletes a's runs so that every module is analyzed again.
+// Only the names of the columns are compared, since SQLite doesn't enforce
+// their types.
+func (r *Runner) replaceChangedTable(ctx context.Context, a *Analyzer) error {
+	cols, err := database.TableColumns(ctx, r.DB, a.Table())
+	if err != nil || len(cols) == 0 {
+		return err
+	}
+	var names []string
+	for _, c := range cols {
+		names = append(names, c.Name)
+	}
+	if slices.Equal(names, append([]string{"module_path", "version"}, a.columnNames()...)) {
+		return nil
+	}
+	slog.InfoContext(ctx, "analysis: replacing table with changed columns", "table", a.Table())
+	return database.TransactionContext(ctx, r.DB, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DROP TABLE "+a.Table()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM analysis_runs WHERE analyzer = ?", a.Name)
+		return err
+	})
+}
+
+type runKey struct {
+	analyzer, path, version string
+}
+
+// analyzed returns the analyzer versions that have been run on each module version.
+// If mv is not zero, it returns only those for mv.
+func (r *Runner) analyzed(ctx context.Context, mv module.Version) (map[runKey]int, error) {
+	m := map[runKey]int{}
+	query, args := database.Select("analysis_runs", "analyzer", "module_path", "version", "analyzer_version").
+		WhereIf(mv.Path != "", "module_path = ? AND version = ?", mv.Path, mv.Version).SQL()
+	seq, errf := database.ScanRows(ctx, r.DB, query, args...)
+	for rows := range seq {
+		var k runKey
+		var v int
+		if err := rows.Scan(&k.analyzer, &k.path, &k.version, &v); err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, errf()
+}
+
+// write replaces the results of each pass's analyzer for its module,
+// and records the runs.
+func (r *Runner) write(ctx context.Context, passes []*Pass) (int, error) {
+	n := 0
+	err := database.TransactionContext(ctx, r.DB, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		n = 0
+		for _, p := range passes {
+			a := p.Analyzer
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+a.Table()+" WHERE module_path = ? AND version = ?", p.Path, p.Version); err != nil {
+				return err
+			}
+			cols := append([]string{"module_path", "version"}, a.columnNames()...)
+			m, err := database.BulkInsert(ctx, tx, a.Table(), cols, slices.Values(p.rows), 500)
+			if err != nil {
+				return err
+			}
+			n += int(m)
+			_, err = database.Upsert(ctx, tx, "analysis_runs", []string{"analyzer", "module_path", "version"},
+				[]string{"analyzer", "module_path", "version", "analyzer_version"}, a.Name, p.Path, p.Version, a.Version)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
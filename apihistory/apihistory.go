@@ -0,0 +1,217 @@
+// Package apihistory records the API changes between versions of modules,
+// as reported by [apidiff], and answers questions about compatibility
+// over a module's history.
+package apihistory
+
+import (
+	"context"
+	"database/sql"
+	"go/types"
+	"iter"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/workspace"
+	"golang.org/x/exp/apidiff"
+	"golang.org/x/mod/semver"
+)
+
+// A Diff summarizes the API changes from one version of a module to another.
+// Diffs are stored in the api_diffs table, and their changes in api_changes.
+type Diff struct {
+	ModulePath   string
+	OldVersion   string
+	NewVersion   string
+	Release      string // see [ReleaseKind]
+	Added        int
+	Removed      int
+	Changed      int
+	Incompatible int // number of incompatible changes
+}
+
+// Compatible reports whether the new version is backwards compatible
+// with the old one.
+func (d *Diff) Compatible() bool { return d.Incompatible == 0 }
+
+// A Change is a single API change.
+type Change struct {
+	ModulePath string
+	OldVersion string
+	NewVersion string
+	Symbol     string // like "example.com/m/pkg.T.M", or "package example.com/m/pkg"
+	Kind       string // added, removed or changed
+	Compatible bool
+	Message    string
+}
+
+// ReleaseKind returns the part of the version that changed from old to new:
+// "major", "minor" or "patch", or "prerelease" if new is a prerelease.
+func ReleaseKind(old, new string) string {
+	switch {
+	case semver.Prerelease(new) != "":
+		return "prerelease"
+	case semver.Major(old) != semver.Major(new):
+		return "major"
+	case semver.MajorMinor(old) != semver.MajorMinor(new):
+		return "minor"
+	default:
+		return "patch"
+	}
+}
+
+// FromReport converts an apidiff report on modulePath from oldVersion to
+// newVersion into a Diff and its Changes.
+func FromReport(modulePath, oldVersion, newVersion string, r apidiff.Report) (*Diff, []*Change) {
+	d := &Diff{
+		ModulePath: modulePath,
+		OldVersion: oldVersion,
+		NewVersion: newVersion,
+		Release:    ReleaseKind(oldVersion, newVersion),
+	}
+	var cs []*Change
+	for _, rc := range r.Changes {
+		c := &Change{
+			ModulePath: modulePath,
+			OldVersion: oldVersion,
+			NewVersion: newVersion,
+			Compatible: rc.Compatible,
+			Message:    rc.Message,
+			Kind:       "changed",
+		}
+		symbol, what, ok := strings.Cut(rc.Message, ": ")
+		if ok {
+			c.Symbol = symbol
+			if what == "added" || what == "removed" {
+				c.Kind = what
+			}
+		}
+		switch c.Kind {
+		case "added":
+			d.Added++
+		case "removed":
+			d.Removed++
+		default:
+			d.Changed++
+		}
+		if !c.Compatible {
+			d.Incompatible++
+		}
+		cs = append(cs, c)
+	}
+	slices.SortFunc(cs, func(a, b *Change) int { return strings.Compare(a.Message, b.Message) })
+	return d, cs
+}
+
+// Compute compares the APIs of two versions of the module modulePath,
+// loading each from the corpus in a workspace created with opts.
+// Internal packages and commands are not part of the API.
+func Compute(ctx context.Context, opts workspace.Options, modulePath, oldVersion, newVersion string) (_ *Diff, _ []*Change, err error) {
+	defer errs.Wrap(&err, "apihistory.Compute(%s, %s, %s)", modulePath, oldVersion, newVersion)
+	oldMod, err := loadAPI(ctx, opts, modulePath, oldVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	newMod, err := loadAPI(ctx, opts, modulePath, newVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, cs := FromReport(modulePath, oldVersion, newVersion, apidiff.ModuleChanges(oldMod, newMod))
+	return d, cs, nil
+}
+
+func loadAPI(ctx context.Context, opts workspace.Options, modulePath, version string) (*apidiff.Module, error) {
+	w, err := workspace.Create(opts, modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Remove()
+	checked, _, err := w.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &apidiff.Module{Path: modulePath}
+	for _, c := range checked {
+		if isAPI(c.Types) {
+			m.Packages = append(m.Packages, c.Types)
+		}
+	}
+	return m, nil
+}
+
+func isAPI(p *types.Package) bool {
+	if p.Name() == "main" {
+		return false
+	}
+	for _, elem := range strings.Split(p.Path(), "/") {
+		if elem == "internal" {
+			return false
+		}
+	}
+	return path.Base(p.Path()) != "testdata"
+}
+
+var (
+	diffCols   = []string{"module_path", "old_version", "new_version", "release", "added", "removed", "changed", "incompatible"}
+	changeCols = []string{"module_path", "old_version", "new_version", "symbol", "kind", "compatible", "message"}
+)
+
+// Record replaces the stored diff between the versions of d, and its changes.
+func Record(ctx context.Context, db *sql.DB, d *Diff, changes []*Change) error {
+	return database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		_, err := database.Upsert(ctx, tx, "api_diffs", diffCols[:3], diffCols,
+			d.ModulePath, d.OldVersion, d.NewVersion, d.Release, d.Added, d.Removed, d.Changed, d.Incompatible)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM api_changes WHERE module_path = ? AND old_version = ? AND new_version = ?",
+			d.ModulePath, d.OldVersion, d.NewVersion)
+		if err != nil {
+			return err
+		}
+		rows := func(yield func([]any) bool) {
+			for _, c := range changes {
+				if !yield([]any{d.ModulePath, d.OldVersion, d.NewVersion, c.Symbol, c.Kind, c.Compatible, c.Message}) {
+					return
+				}
+			}
+		}
+		_, err = database.BulkInsert(ctx, tx, "api_changes", changeCols, rows, 500)
+		return err
+	})
+}
+
+var selectDiffs = "SELECT " + strings.Join(diffCols, ", ") + " FROM api_diffs"
+
+// BrokenPatches returns the diffs of patch releases that are not backwards
+// compatible, ordered by module path.
+func BrokenPatches(ctx context.Context, db *sql.DB) (iter.Seq[*Diff], func() error) {
+	return database.ScanRowsAs[Diff](ctx, db,
+		selectDiffs+" WHERE release = 'patch' AND incompatible > 0 ORDER BY module_path, new_version")
+}
+
+// History returns the stored diffs of the module modulePath, in order of their
+// new versions.
+func History(ctx context.Context, db *sql.DB, modulePath string) ([]*Diff, error) {
+	seq, errf := database.ScanRowsAs[Diff](ctx, db, selectDiffs+" WHERE module_path = ?", modulePath)
+	ds := slices.Collect(seq)
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(ds, func(a, b *Diff) int {
+		if c := semver.Compare(a.NewVersion, b.NewVersion); c != 0 {
+			return c
+		}
+		return semver.Compare(a.OldVersion, b.OldVersion)
+	})
+	return ds, nil
+}
+
+// Changes returns the changes between two versions of a module, ordered by message.
+func Changes(ctx context.Context, db *sql.DB, modulePath, oldVersion, newVersion string) (iter.Seq[*Change], func() error) {
+	return database.ScanRowsAs[Change](ctx, db,
+		"SELECT "+strings.Join(changeCols, ", ")+" FROM api_changes WHERE module_path = ? AND old_version = ? AND new_version = ? ORDER BY message",
+		modulePath, oldVersion, newVersion)
+}
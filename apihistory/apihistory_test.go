@@ -0,0 +1,147 @@
+package apihistory
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/workspace"
+	"golang.org/x/exp/apidiff"
+	_ "modernc.org/sqlite"
+)
+
+func TestReleaseKind(t *testing.T) {
+	for _, test := range []struct {
+		old, new, want string
+	}{
+		{"v1.0.0", "v1.0.1", "patch"},
+		{"v1.0.0", "v1.1.0", "minor"},
+		{"v1.9.0", "v2.0.0", "major"},
+		{"v1.0.0", "v1.1.0-rc.1", "prerelease"},
+	} {
+		if got := ReleaseKind(test.old, test.new); got != test.want {
+			t.Errorf("ReleaseKind(%s, %s) = %s, want %s", test.old, test.new, got, test.want)
+		}
+	}
+}
+
+func TestFromReport(t *testing.T) {
+	r := apidiff.Report{Changes: []apidiff.Change{
+		{Message: "m.F: removed", Compatible: false},
+		{Message: "m.G: changed from func() to func(int)", Compatible: false},
+		{Message: "m.H: added", Compatible: true},
+		{Message: "package m/sub: added", Compatible: true},
+	}}
+	d, cs := FromReport("m", "v1.0.0", "v1.0.1", r)
+	want := &Diff{ModulePath: "m", OldVersion: "v1.0.0", NewVersion: "v1.0.1", Release: "patch",
+		Added: 2, Removed: 1, Changed: 1, Incompatible: 2}
+	if *d != *want {
+		t.Errorf("got %+v, want %+v", d, want)
+	}
+	var got []string
+	for _, c := range cs {
+		got = append(got, c.Kind+" "+c.Symbol)
+	}
+	wantChanges := []string{"removed m.F", "changed m.G", "added m.H", "added package m/sub"}
+	if !slices.Equal(got, wantChanges) {
+		t.Errorf("got %q, want %q", got, wantChanges)
+	}
+}
+
+func TestDB(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	removeF := apidiff.Report{Changes: []apidiff.Change{{Message: "m.F: removed"}}}
+	addG := apidiff.Report{Changes: []apidiff.Change{{Message: "m.G: added", Compatible: true}}}
+	for _, test := range []struct {
+		old, new string
+		r        apidiff.Report
+	}{
+		{"v1.9.0", "v1.10.0", addG},
+		{"v1.10.0", "v1.10.1", removeF},
+		{"v1.2.0", "v1.2.1", addG},
+		{"v1.2.1", "v1.9.0", addG},
+	} {
+		d, cs := FromReport("m", test.old, test.new, test.r)
+		if err := Record(ctx, db, d, cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Recording again replaces.
+	d, cs := FromReport("m", "v1.10.0", "v1.10.1", removeF)
+	if err := Record(ctx, db, d, cs); err != nil {
+		t.Fatal(err)
+	}
+
+	hist, err := History(ctx, db, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range hist {
+		got = append(got, d.NewVersion)
+	}
+	if want := []string{"v1.2.1", "v1.9.0", "v1.10.0", "v1.10.1"}; !slices.Equal(got, want) {
+		t.Errorf("History: got %v, want %v", got, want)
+	}
+
+	seq, errf := BrokenPatches(ctx, db)
+	broken := slices.Collect(seq)
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 1 || broken[0].NewVersion != "v1.10.1" || broken[0].Compatible() {
+		t.Errorf("BrokenPatches: got %v", broken)
+	}
+
+	cseq, errf := Changes(ctx, db, "m", "v1.10.0", "v1.10.1")
+	changes := slices.Collect(cseq)
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Symbol != "m.F" || changes[0].Compatible {
+		t.Errorf("Changes: got %v", changes)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	corpus := t.TempDir()
+	for v, src := range map[string]string{
+		"v1.0.0": "package m\n\nfunc F() {}\n\nfunc G() {}\n",
+		"v1.0.1": "package m\n\nfunc F(int) {}\n\nfunc H() {}\n",
+	} {
+		corpustest.WriteZip(t, corpus, "example.com/m", v, map[string]string{
+			"go.mod":          "module example.com/m\n",
+			"m.go":            src,
+			"internal/i/i.go": "package i\n\nfunc " + map[string]string{"v1.0.0": "X", "v1.0.1": "Y"}[v] + "() {}\n",
+		})
+	}
+	d, cs, err := Compute(context.Background(), workspace.Options{CorpusDir: corpus}, "example.com/m", "v1.0.0", "v1.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Added != 1 || d.Removed != 1 || d.Changed != 1 || d.Incompatible != 2 {
+		t.Errorf("got %+v", d)
+		for _, c := range cs {
+			t.Log(c.Message)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package artifacts finds files in module zips that are not source code:
+// executables, shared libraries, object files, archives, WebAssembly
+// modules and large opaque blobs.
+//
+// Such files are a supply-chain risk, since they can't be reviewed like
+// source, and they explain much of the size of the ecosystem's zips.
+// The scan works on untrimmed zips, like those from the proxy; the corpus
+// holds only Go files.
+package artifacts
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"io"
+	"iter"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/entropy"
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// Kinds of artifacts.
+const (
+	Executable = "executable"
+	Library    = "library" // shared or static library
+	Object     = "object"  // relocatable object file
+	Archive    = "archive" // compressed or archive file
+	Wasm       = "wasm"
+	Blob       = "blob" // large file of high-entropy data
+)
+
+// An Artifact is a non-source file in a module zip, as stored in the
+// artifacts table.
+type Artifact struct {
+	ModulePath string
+	Version    string
+	File       string // relative to the module root
+	Kind       string
+	Format     string // like "elf", "pe", "macho", "zip" or "gzip"
+	Size       int64
+}
+
+// A Scan summarizes the scan of a module version, as stored in the
+// artifact_scans table.
+type Scan struct {
+	ModulePath   string
+	Version      string
+	Files        int
+	Size         int64 // uncompressed bytes of all files
+	ArtifactSize int64 // uncompressed bytes of artifacts
+	Scanned      string
+}
+
+const (
+	// headerLen is the number of bytes read to identify a file's format.
+	headerLen = 4096
+	// minBlobSize is the minimum size of a blob.
+	minBlobSize = 1 << 20
+	// blobSample is the number of bytes whose entropy is measured.
+	blobSample = 64 << 10
+	// minBlobEntropy is the minimum entropy of a blob, in bits per byte.
+	// Compressed and encrypted data is near 8.
+	minBlobEntropy = 7.5
+)
+
+// ScanZip returns the artifacts in the zip of path@version, and a summary.
+func ScanZip(zr *zip.Reader, path, version string) (_ *Scan, _ []*Artifact, err error) {
+	defer errs.Wrap(&err, "artifacts.ScanZip(%s@%s)", path, version)
+	s := &Scan{ModulePath: path, Version: version, Scanned: time.Now().UTC().Format(time.RFC3339)}
+	var as []*Artifact
+	prefix := path + "@" + version + "/"
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		s.Files++
+		size := int64(f.UncompressedSize64)
+		s.Size += size
+		kind, format, err := identify(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		if kind == "" {
+			continue
+		}
+		s.ArtifactSize += size
+		as = append(as, &Artifact{
+			ModulePath: path,
+			Version:    version,
+			File:       strings.TrimPrefix(f.Name, prefix),
+			Kind:       kind,
+			Format:     format,
+			Size:       size,
+		})
+	}
+	return s, as, nil
+}
+
+// identify returns the kind and format of f, or empty strings
+// if f is not an artifact.
+func identify(f *zip.File) (kind, format string, err error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer rc.Close()
+	n := headerLen
+	if f.UncompressedSize64 >= minBlobSize {
+		n = blobSample
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, int64(n)))
+	if err != nil {
+		return "", "", err
+	}
+	if kind, format := Identify(f.Name, data); kind != "" {
+		return kind, format, nil
+	}
+	if f.UncompressedSize64 >= minBlobSize && entropy.Shannon(data) >= minBlobEntropy {
+		return Blob, "", nil
+	}
+	return "", "", nil
+}
+
+// Identify returns the kind and format of a file with the given name
+// whose contents begin with header, or empty strings if it is not
+// recognized as an artifact.
+func Identify(name string, header []byte) (kind, format string) {
+	h := header
+	switch {
+	case bytes.HasPrefix(h, []byte("\x7fELF")):
+		return elfKind(name, h), "elf"
+	case bytes.HasPrefix(h, []byte("MZ")) && isPE(h):
+		// IMAGE_FILE_DLL in the COFF characteristics.
+		off := binary.LittleEndian.Uint32(h[0x3c:])
+		if int(off)+24 <= len(h) && binary.LittleEndian.Uint16(h[off+22:])&0x2000 != 0 {
+			return Library, "pe"
+		}
+		return Executable, "pe"
+	case isMachO(h):
+		return machoKind(h), "macho"
+	case bytes.HasPrefix(h, []byte("!<arch>\n")):
+		return Library, "ar"
+	case bytes.HasPrefix(h, []byte("\x00asm")):
+		return Wasm, "wasm"
+	case bytes.HasPrefix(h, []byte("\xca\xfe\xba\xbe")) && len(h) >= 8 && binary.BigEndian.Uint32(h[4:]) < 45:
+		// Mach-O universal binaries share this magic with Java class files,
+		// whose version numbers are 45 and up.
+		return Executable, "macho"
+	}
+	// Archives are common in testdata and examples, so they are only
+	// reported when their contents are detected, not by name.
+	switch {
+	case bytes.HasPrefix(h, []byte("PK\x03\x04")):
+		return Archive, "zip"
+	case bytes.HasPrefix(h, []byte("\x1f\x8b")):
+		return Archive, "gzip"
+	case bytes.HasPrefix(h, []byte("BZh")) && path.Ext(name) == ".bz2":
+		return Archive, "bzip2"
+	case bytes.HasPrefix(h, []byte("\xfd7zXZ\x00")):
+		return Archive, "xz"
+	case bytes.HasPrefix(h, []byte("7z\xbc\xaf\x27\x1c")):
+		return Archive, "7z"
+	}
+	return "", ""
+}
+
+func elfKind(name string, h []byte) string {
+	if len(h) < 18 {
+		return Executable
+	}
+	var typ uint16
+	if h[5] == 2 { // big-endian
+		typ = binary.BigEndian.Uint16(h[16:])
+	} else {
+		typ = binary.LittleEndian.Uint16(h[16:])
+	}
+	switch typ {
+	case 1: // ET_REL
+		return Object
+	case 3: // ET_DYN: a shared library or a position-independent executable
+		if strings.Contains(path.Base(name), ".so") {
+			return Library
+		}
+	}
+	return Executable
+}
+
+func isPE(h []byte) bool {
+	if len(h) < 0x40 {
+		return false
+	}
+	off := binary.LittleEndian.Uint32(h[0x3c:])
+	return int(off)+4 <= len(h) && bytes.Equal(h[off:off+4], []byte("PE\x00\x00"))
+}
+
+var machoMagics = [][]byte{
+	[]byte("\xfe\xed\xfa\xce"), []byte("\xce\xfa\xed\xfe"),
+	[]byte("\xfe\xed\xfa\xcf"), []byte("\xcf\xfa\xed\xfe"),
+}
+
+func isMachO(h []byte) bool {
+	for _, m := range machoMagics {
+		if bytes.HasPrefix(h, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func machoKind(h []byte) string {
+	if len(h) < 16 {
+		return Executable
+	}
+	var typ uint32
+	if h[0] == 0xfe {
+		typ = binary.BigEndian.Uint32(h[12:])
+	} else {
+		typ = binary.LittleEndian.Uint32(h[12:])
+	}
+	switch typ {
+	case 1: // MH_OBJECT
+		return Object
+	case 6, 8: // MH_DYLIB, MH_BUNDLE
+		return Library
+	}
+	return Executable
+}
+
+var (
+	scanCols     = []string{"module_path", "version", "files", "size", "artifact_size", "scanned"}
+	artifactCols = []string{"module_path", "version", "file", "kind", "format", "size"}
+)
+
+// Record replaces the stored scan of s's module version and its artifacts.
+func Record(ctx context.Context, db *sql.DB, s *Scan, as []*Artifact) error {
+	return database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		_, err := database.Upsert(ctx, tx, "artifact_scans", scanCols[:2], scanCols,
+			s.ModulePath, s.Version, s.Files, s.Size, s.ArtifactSize, s.Scanned)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM artifacts WHERE module_path = ? AND version = ?", s.ModulePath, s.Version)
+		if err != nil {
+			return err
+		}
+		rows := func(yield func([]any) bool) {
+			for _, a := range as {
+				if !yield([]any{s.ModulePath, s.Version, a.File, a.Kind, a.Format, a.Size}) {
+					return
+				}
+			}
+		}
+		_, err = database.BulkInsert(ctx, tx, "artifacts", artifactCols, rows, 500)
+		return err
+	})
+}
+
+// Scanned reports whether path@version has been scanned.
+func Scanned(ctx context.Context, db *sql.DB, path, version string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM artifact_scans WHERE module_path = ? AND version = ?",
+		path, version).Scan(&n)
+	return n > 0, err
+}
+
+// List returns the stored artifacts, ordered by module and file.
+// If kind is not empty, only artifacts of that kind are returned.
+func List(ctx context.Context, db *sql.DB, kind string) (iter.Seq[*Artifact], func() error) {
+	query, args := database.Select("artifacts", artifactCols...).
+		WhereIf(kind != "", "kind = ?", kind).
+		OrderBy("module_path", "version", "file").SQL()
+	return database.ScanRowsAs[Artifact](ctx, db, query, args...)
+}
+
+// Bloat returns the scans of the module versions with the most bytes of
+// artifacts, largest first. If limit is positive, at most limit scans
+// are returned.
+func Bloat(ctx context.Context, db *sql.DB, limit int) (iter.Seq[*Scan], func() error) {
+	query, args := database.Select("artifact_scans", scanCols...).
+		Where("artifact_size > 0").
+		OrderBy("artifact_size DESC", "module_path").
+		Limit(limit).SQL()
+	return database.ScanRowsAs[Scan](ctx, db, query, args...)
+}
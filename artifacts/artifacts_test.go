@@ -0,0 +1,132 @@
+package artifacts
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	_ "modernc.org/sqlite"
+)
+
+// elfHeader returns the start of a little-endian ELF file of the given type.
+func elfHeader(typ uint16) []byte {
+	h := make([]byte, 64)
+	copy(h, "\x7fELF\x02\x01")
+	binary.LittleEndian.PutUint16(h[16:], typ)
+	return h
+}
+
+func peHeader(dll bool) []byte {
+	h := make([]byte, 0x100)
+	copy(h, "MZ")
+	binary.LittleEndian.PutUint32(h[0x3c:], 0x80)
+	copy(h[0x80:], "PE\x00\x00")
+	if dll {
+		binary.LittleEndian.PutUint16(h[0x80+22:], 0x2000)
+	}
+	return h
+}
+
+func machoHeader(typ uint32) []byte {
+	h := make([]byte, 32)
+	copy(h, "\xcf\xfa\xed\xfe")
+	binary.LittleEndian.PutUint32(h[12:], typ)
+	return h
+}
+
+func TestIdentify(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		header     []byte
+		kind, form string
+	}{
+		{"bin/tool", elfHeader(2), Executable, "elf"},
+		{"lib/libfoo.so.1", elfHeader(3), Library, "elf"},
+		{"bin/pie", elfHeader(3), Executable, "elf"},
+		{"x.o", elfHeader(1), Object, "elf"},
+		{"tool.exe", peHeader(false), Executable, "pe"},
+		{"foo.dll", peHeader(true), Library, "pe"},
+		{"tool", machoHeader(2), Executable, "macho"},
+		{"libfoo.dylib", machoHeader(6), Library, "macho"},
+		{"libfoo.a", []byte("!<arch>\nfoo"), Library, "ar"},
+		{"m.wasm", []byte("\x00asm\x01\x00\x00\x00"), Wasm, "wasm"},
+		{"data.zip", []byte("PK\x03\x04rest"), Archive, "zip"},
+		{"Foo.class", []byte("\xca\xfe\xba\xbe\x00\x00\x00\x34"), "", ""},
+		{"README.md", []byte("MZ is not a PE file"), "", ""},
+		{"main.go", []byte("package main\n"), "", ""},
+	} {
+		kind, form := Identify(test.name, test.header)
+		if kind != test.kind || form != test.form {
+			t.Errorf("%s: got %q, %q; want %q, %q", test.name, kind, form, test.kind, test.form)
+		}
+	}
+}
+
+func TestScanZip(t *testing.T) {
+	ctx := context.Background()
+	const path, version = "example.com/m", "v1.0.0"
+	random := make([]byte, minBlobSize)
+	rand.Read(random)
+	zr := corpustest.ZipReader(t, path, version, map[string]string{
+		"go.mod":        "module example.com/m\n",
+		"m.go":          "package m\n",
+		"bin/tool":      string(elfHeader(2)),
+		"assets/random": string(random),
+		"assets/zeros":  string(make([]byte, minBlobSize)),
+	})
+	s, as, err := ScanZip(zr, path, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(64 + minBlobSize); s.Files != 5 || s.ArtifactSize != want {
+		t.Errorf("got %d files, %d artifact bytes; want 5, %d", s.Files, s.ArtifactSize, want)
+	}
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := Record(ctx, db, s, as); err != nil {
+		t.Fatal(err)
+	}
+	seq, errf := List(ctx, db, "")
+	var got []string
+	for a := range seq {
+		got = append(got, fmt.Sprintf("%s %s %s", a.File, a.Kind, a.Format))
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"assets/random blob ", "bin/tool executable elf"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	bloat, errf := Bloat(ctx, db, 10)
+	n := 0
+	for s := range bloat {
+		n++
+		if s.ModulePath != path {
+			t.Errorf("Bloat: got %s", s.ModulePath)
+		}
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Bloat: got %d scans, want 1", n)
+	}
+}
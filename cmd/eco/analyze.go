@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/modfs"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	top.Command("analyze", &analyzeCmd{}, "run syntax analyzers over the corpus")
+}
+
+type analyzeCmd struct {
+	Analyzers string `cli:"flag=a, comma-separated analyzers to run (default all)"`
+	Prefix    string `cli:"flag=prefix, only modules whose paths begin with this prefix"`
+	Force     bool   `cli:"flag=force, analyze modules that have already been analyzed"`
+	List      bool   `cli:"flag=list, list the analyzers and exit"`
+}
+
+func (c *analyzeCmd) Run(ctx context.Context) error {
+	if c.List {
+		for _, a := range analysis.Analyzers() {
+			fmt.Printf("%-15s %s\n", a.Name, a.Doc)
+		}
+		return nil
+	}
+	as := analysis.Analyzers()
+	if c.Analyzers != "" {
+		as = nil
+		for name := range strings.SplitSeq(c.Analyzers, ",") {
+			a := analysis.Lookup(strings.TrimSpace(name))
+			if a == nil {
+				return fmt.Errorf("unknown analyzer %q", name)
+			}
+			as = append(as, a)
+		}
+	}
+	db := openDB()
+	defer db.Close()
+	r := &analysis.Runner{
+		DB:          db,
+		CorpusDir:   cfg().CorpusDir,
+		ZipDir:      cfg().ZipDir,
+		Analyzers:   as,
+		Concurrency: cfg().Concurrency,
+		Force:       c.Force,
+	}
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+	s, err := r.Run(ctx, corpusModules(ctx, mods))
+	if s != nil {
+		slog.InfoContext(ctx, "analyzed", "modules", s.Modules, "skipped", s.Skipped,
+			"results", s.Results, "failures", s.Failures)
+		if s.Failures > 0 {
+			slog.WarnContext(ctx, "analysis failures", "summary", s.Errors.Summary())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return errf()
+}
+
+// corpusModules returns the latest versions of mods that are in the corpus.
+func corpusModules(ctx context.Context, mods iter.Seq[*ecodb.Module]) iter.Seq[module.Version] {
+	return func(yield func(module.Version) bool) {
+		for m := range mods {
+			if stopping(ctx) {
+				return
+			}
+			if m.LatestVersion == "" {
+				continue
+			}
+			zf, err := modfs.ZipPath(cfg().CorpusDir, m.Path, m.LatestVersion)
+			if err != nil {
+				continue
+			}
+			if _, err := os.Stat(zf); err != nil {
+				continue
+			}
+			if !yield(module.Version{Path: m.Path, Version: m.LatestVersion}) {
+				return
+			}
+		}
+	}
+}
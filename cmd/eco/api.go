@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jba/go-ecosystem/apihistory"
+	"github.com/jba/go-ecosystem/workspace"
+)
+
+func init() {
+	api := top.Command("api", &apiCmd{}, "API compatibility history")
+	api.Command("diff", &apiDiffCmd{}, "compare two versions of a module in the corpus and record the result")
+	api.Command("history", &apiHistoryCmd{}, "show the recorded API diffs of a module")
+	api.Command("broken", &apiBrokenCmd{}, "list patch releases that broke compatibility")
+}
+
+type apiCmd struct{}
+
+type apiDiffCmd struct {
+	Module string `cli:"name=MODULE, module path"`
+	Old    string `cli:"name=OLD, old version"`
+	New    string `cli:"name=NEW, new version"`
+}
+
+func (c *apiDiffCmd) Run(ctx context.Context) error {
+	opts := workspace.Options{CorpusDir: cfg().CorpusDir, Deps: true}
+	d, changes, err := apihistory.Compute(ctx, opts, c.Module, c.Old, c.New)
+	if err != nil {
+		return err
+	}
+	db := openDB()
+	defer db.Close()
+	if err := apihistory.Record(ctx, db, d, changes); err != nil {
+		return err
+	}
+	for _, ch := range changes {
+		compat := "compatible"
+		if !ch.Compatible {
+			compat = "INCOMPATIBLE"
+		}
+		fmt.Printf("%-12s %s\n", compat, ch.Message)
+	}
+	return nil
+}
+
+type apiHistoryCmd struct {
+	Module string `cli:"name=MODULE, module path"`
+}
+
+func (c *apiHistoryCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	ds, err := apihistory.History(ctx, db, c.Module)
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		printDiff(d)
+	}
+	return nil
+}
+
+type apiBrokenCmd struct{}
+
+func (c *apiBrokenCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	seq, errf := apihistory.BrokenPatches(ctx, db)
+	for d := range seq {
+		printDiff(d)
+	}
+	return errf()
+}
+
+func printDiff(d *apihistory.Diff) {
+	fmt.Printf("%s %s -> %s (%s): +%d -%d ~%d, %d incompatible\n",
+		d.ModulePath, d.OldVersion, d.NewVersion, d.Release, d.Added, d.Removed, d.Changed, d.Incompatible)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jba/go-ecosystem/artifacts"
+	"github.com/jba/go-ecosystem/modfs"
+	"github.com/jba/go-ecosystem/proxy"
+)
+
+func init() {
+	a := top.Command("artifacts", &artifactsCmd{}, "binaries, libraries and other non-source files in module zips")
+	a.Command("scan", &artifactsScanCmd{}, "scan untrimmed module zips for non-source files")
+	a.Command("list", &artifactsListCmd{}, "list the non-source files found")
+	a.Command("bloat", &artifactsBloatCmd{}, "list the module versions with the most bytes of non-source files")
+}
+
+type artifactsCmd struct{}
+
+type artifactsScanCmd struct {
+	Force   bool     `cli:"flag=force, scan module versions that have already been scanned"`
+	Modules []string `cli:"name=MODULE@VERSION, modules to download from the proxy and scan; default all zips in the zip directory"`
+}
+
+func (c *artifactsScanCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	var nScanned, nFound int
+	scan := func(zr *zip.Reader, path, version string) error {
+		s, as, err := artifacts.ScanZip(zr, path, version)
+		if err != nil {
+			return err
+		}
+		if err := artifacts.Record(ctx, db, s, as); err != nil {
+			return err
+		}
+		nScanned++
+		nFound += len(as)
+		return nil
+	}
+	if len(c.Modules) > 0 {
+		for _, arg := range c.Modules {
+			path, version, ok := strings.Cut(arg, "@")
+			if !ok {
+				return fmt.Errorf("%q: want MODULE@VERSION", arg)
+			}
+			zr, err := proxy.Zip(ctx, path, version)
+			if err != nil {
+				return err
+			}
+			if err := scan(zr, path, version); err != nil {
+				return err
+			}
+		}
+	} else {
+		dir := cfg().ZipDir
+		if dir == "" {
+			return errors.New("no modules given and no zip directory configured")
+		}
+		for mv, file := range modfs.ZipFiles(dir) {
+			if stopping(ctx) {
+				break
+			}
+			if !c.Force {
+				done, err := artifacts.Scanned(ctx, db, mv.Path, mv.Version)
+				if err != nil {
+					return err
+				}
+				if done {
+					continue
+				}
+			}
+			zr, err := zip.OpenReader(file)
+			if err != nil {
+				return err
+			}
+			err = scan(&zr.Reader, mv.Path, mv.Version)
+			zr.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	slog.InfoContext(ctx, "scanned zips", "modules", nScanned, "artifacts", nFound)
+	return nil
+}
+
+type artifactsListCmd struct {
+	Kind string `cli:"flag=kind, only artifacts of this kind: executable, library, object, archive, wasm or blob"`
+}
+
+func (c *artifactsListCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	as, errf := artifacts.List(ctx, db, c.Kind)
+	for a := range as {
+		fmt.Printf("%s@%s %s %s %s %d\n", a.ModulePath, a.Version, a.File, a.Kind, a.Format, a.Size)
+	}
+	return errf()
+}
+
+type artifactsBloatCmd struct {
+	Limit int `cli:"flag=n, list at most this many module versions"`
+}
+
+func (c *artifactsBloatCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	ss, errf := artifacts.Bloat(ctx, db, c.Limit)
+	for s := range ss {
+		fmt.Printf("%s@%s %d of %d bytes (%.0f%%)\n", s.ModulePath, s.Version, s.ArtifactSize, s.Size,
+			100*float64(s.ArtifactSize)/float64(max(s.Size, 1)))
+	}
+	return errf()
+}
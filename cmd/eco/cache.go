@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/config"
+	"github.com/jba/go-ecosystem/internal/diskcache"
+	"github.com/jba/go-ecosystem/proxy"
+	"github.com/jba/go-ecosystem/proxy/cache"
+)
+
+func init() {
+	grp := top.Command("cache", &cacheCmd{}, "manage the cache directories")
+	grp.Command("stats", &cacheStatsCmd{}, "show the size of each cache directory")
+	grp.Command("gc", &cacheGCCmd{}, "remove least recently used files to meet the cache quota")
+	grp.Command("inspect", &cacheInspectCmd{}, "describe the proxy cache by kind of request")
+	grp.Command("prune", &cachePruneCmd{}, "remove expired and least recently used proxy responses")
+}
+
+// newProxyCache returns the proxy cache described by c.
+func newProxyCache(c *config.Config) (*cache.Cache, error) {
+	var opts cache.Options
+	if c.CacheSize != "" {
+		n, err := diskcache.ParseSize(c.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		opts.MaxSize = n
+	}
+	return cache.New(c.CacheDir, opts), nil
+}
+
+// proxyCache returns the cache used by the proxy client.
+func proxyCache() (*cache.Cache, error) {
+	if pc := proxy.Default().Cache(); pc != nil {
+		return pc, nil
+	}
+	return nil, errors.New("no proxy cache: use -cache or set CacheDir in the configuration")
+}
+
+type cacheCmd struct{}
+
+type cacheStatsCmd struct{}
+
+func (c *cacheStatsCmd) Run(ctx context.Context) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tFILES\tSIZE\tOLDEST\tPATH")
+	var total int64
+	for _, d := range cfg().CacheDirs() {
+		s, err := d.Stat()
+		if err != nil {
+			return err
+		}
+		total += s.Bytes
+		oldest := "-"
+		if !s.Oldest.IsZero() {
+			oldest = s.Oldest.Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", s.Name, s.Files, diskcache.FormatSize(s.Bytes), oldest, s.Path)
+	}
+	quota := "none"
+	if q := cfg().CacheQuota; q != "" {
+		quota = q
+	}
+	fmt.Fprintf(tw, "total\t\t%s\t\tquota: %s\n", diskcache.FormatSize(total), quota)
+	return tw.Flush()
+}
+
+type cacheGCCmd struct {
+	DryRun bool   `cli:"flag=n, report what would be removed without removing it"`
+	Quota  string `cli:"flag=quota, size to reduce the caches to (default the configured quota)"`
+}
+
+func (c *cacheGCCmd) Run(ctx context.Context) error {
+	q := c.Quota
+	if q == "" {
+		q = cfg().CacheQuota
+	}
+	if q == "" {
+		return errors.New("no quota: use -quota or set CacheQuota in the configuration")
+	}
+	quota, err := diskcache.ParseSize(q)
+	if err != nil {
+		return err
+	}
+	res, err := diskcache.GC(cfg().CacheDirs(), quota, c.DryRun)
+	verb := "removed"
+	if c.DryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("%s %d files, %s; %s left\n", verb, res.Files, diskcache.FormatSize(res.Bytes), diskcache.FormatSize(res.Left))
+	return err
+}
+
+// gcCaches enforces the configured cache quota, if any.
+func gcCaches(ctx context.Context) error {
+	if cfg().CacheQuota == "" {
+		return nil
+	}
+	quota, err := diskcache.ParseSize(cfg().CacheQuota)
+	if err != nil {
+		return err
+	}
+	res, err := diskcache.GC(cfg().CacheDirs(), quota, false)
+	if res.Files > 0 {
+		slog.InfoContext(ctx, "cache gc", "files", res.Files, "freed", diskcache.FormatSize(res.Bytes))
+	}
+	if res.Left > quota {
+		slog.WarnContext(ctx, "caches are over quota", "size", diskcache.FormatSize(res.Left), "quota", cfg().CacheQuota)
+	}
+	return err
+}
+
+type cacheInspectCmd struct {
+	Long bool `cli:"flag=l, list each entry, most recently used first"`
+}
+
+func (c *cacheInspectCmd) Run(ctx context.Context) error {
+	pc, err := proxyCache()
+	if err != nil {
+		return err
+	}
+	es, err := pc.Entries()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if c.Long {
+		fmt.Fprintln(tw, "KIND\tSTATUS\tSIZE\tSTORED\tUSED\tEXPIRED\tURL")
+		for _, e := range es {
+			key := e.Key
+			if key == "" {
+				key = e.Name
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%t\t%s\n", e.Kind, e.Status, diskcache.FormatSize(e.Size),
+				e.Stored.Format(time.DateTime), e.Used.Format(time.DateTime), pc.Expired(e, now), key)
+		}
+		return tw.Flush()
+	}
+
+	type kindStats struct {
+		entries, expired, negative int
+		bytes                      int64
+	}
+	stats := map[cache.Kind]*kindStats{}
+	for _, k := range cache.Kinds {
+		stats[k] = &kindStats{}
+	}
+	var total kindStats
+	for _, e := range es {
+		for _, s := range []*kindStats{stats[e.Kind], &total} {
+			s.entries++
+			s.bytes += e.Size
+			if pc.Expired(e, now) {
+				s.expired++
+			}
+			if e.Status != http.StatusOK {
+				s.negative++
+			}
+		}
+	}
+	fmt.Fprintln(tw, "KIND\tENTRIES\tSIZE\tEXPIRED\tNOT FOUND\tTTL")
+	for _, k := range cache.Kinds {
+		s := stats[k]
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d\t%s\n", k, s.entries, diskcache.FormatSize(s.bytes), s.expired, s.negative, pc.TTL(k, http.StatusOK))
+	}
+	maxSize := "none"
+	if s := cfg().CacheSize; s != "" {
+		maxSize = s
+	}
+	fmt.Fprintf(tw, "total\t%d\t%s\t%d\t%d\tmax size: %s\n", total.entries, diskcache.FormatSize(total.bytes), total.expired, total.negative, maxSize)
+	return tw.Flush()
+}
+
+type cachePruneCmd struct {
+	DryRun bool   `cli:"flag=n, report what would be removed without removing it"`
+	Size   string `cli:"flag=size, size to reduce the proxy cache to (default the configured size)"`
+}
+
+func (c *cachePruneCmd) Run(ctx context.Context) error {
+	pc, err := proxyCache()
+	if err != nil {
+		return err
+	}
+	var maxSize int64
+	if c.Size != "" {
+		maxSize, err = diskcache.ParseSize(c.Size)
+		if err != nil {
+			return err
+		}
+	}
+	res, err := pc.Prune(maxSize, c.DryRun)
+	verb := "removed"
+	if c.DryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("%s %d expired and %d evicted entries, %s; %s left\n", verb, res.Expired, res.Evicted,
+		diskcache.FormatSize(res.Bytes), diskcache.FormatSize(res.Left))
+	return err
+}
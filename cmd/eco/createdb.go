@@ -2,8 +2,9 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"log/slog"
+
+	"github.com/jba/go-ecosystem/ecodb"
 )
 
 func init() {
@@ -13,20 +14,18 @@ func init() {
 type createDBCmd struct{}
 
 func (c *createDBCmd) Run(ctx context.Context) error {
-	// Read db.sql
-	sqlBytes, err := os.ReadFile("db.sql")
-	if err != nil {
-		return fmt.Errorf("reading db.sql: %w", err)
-	}
-
-	// Create and open database
 	db := openDB()
 	defer db.Close()
 
-	// Execute SQL to create tables
-	if _, err := db.Exec(string(sqlBytes)); err != nil {
-		return fmt.Errorf("executing db.sql: %w", err)
+	// Create the tables by applying all migrations.
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		return err
 	}
-
+	n, err := m.Up(ctx)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "applied migrations", "count", n)
 	return nil
 }
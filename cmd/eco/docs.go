@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jba/go-ecosystem/docs"
+)
+
+func init() {
+	d := top.Command("docs", &docsCmd{}, "package documentation; run 'eco analyze -a docs' first")
+	d.Command("show", &docsShowCmd{}, "summarize the API of a package")
+	d.Command("search", &docsSearchCmd{}, "search the synopses of packages and exported identifiers")
+}
+
+type docsCmd struct{}
+
+type docsShowCmd struct {
+	Package string `cli:"name=PACKAGE, import path"`
+}
+
+func (c *docsShowCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	seq, errf := docs.InPackage(ctx, db, c.Package)
+	for d := range seq {
+		printDoc(d, d.Kind != docs.Package)
+	}
+	return errf()
+}
+
+type docsSearchCmd struct {
+	Limit int    `cli:"flag=n, maximum number of results"`
+	Query string `cli:"name=QUERY, words to search for"`
+}
+
+func (c *docsSearchCmd) Run(ctx context.Context) error {
+	if c.Limit == 0 {
+		c.Limit = 50
+	}
+	db := openDB()
+	defer db.Close()
+	seq, errf := docs.Search(ctx, db, c.Query, c.Limit)
+	for d := range seq {
+		printDoc(d, false)
+	}
+	return errf()
+}
+
+func printDoc(d *docs.Doc, indent bool) {
+	var b strings.Builder
+	if indent {
+		b.WriteString("    ")
+	}
+	if d.Kind == docs.Package {
+		fmt.Fprintf(&b, "package %s@%s", d.Package, d.Version)
+	} else {
+		fmt.Fprintf(&b, "%-6s ", d.Kind)
+		if !indent {
+			b.WriteString(d.Package + ".")
+		}
+		if d.Receiver != "" {
+			b.WriteString(d.Receiver + ".")
+		}
+		b.WriteString(d.Name)
+	}
+	if d.Synopsis != "" {
+		b.WriteString(": " + d.Synopsis)
+	}
+	if d.Deprecated {
+		b.WriteString(" (deprecated)")
+	}
+	fmt.Println(b.String())
+}
@@ -3,18 +3,118 @@ package main
 import (
 	"context"
 	"database/sql"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 
 	"github.com/jba/cli"
 	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/index"
+	"github.com/jba/go-ecosystem/internal/config"
+	"github.com/jba/go-ecosystem/proxy"
+	"github.com/jba/go-ecosystem/sumdb"
 	_ "modernc.org/sqlite"
 )
 
-var top = cli.Top(nil)
+var top = cli.Top(&cli.Command{Struct: &topCmd{}})
+
+// topCmd holds flags that apply to all commands.
+// They override the configuration file and environment; see package config.
+type topCmd struct {
+	Config      string `cli:"flag=config, configuration file"`
+	Dir         string `cli:"flag=dir, data directory (default $GOECODIR)"`
+	ProxyURL    string `cli:"flag=proxy, module proxy URL, or a list of them like GOPROXY"`
+	IndexURL    string `cli:"flag=index, module index URL, or a mirror's, like GOINDEX"`
+	ProxyQPS    int    `cli:"flag=qps, maximum proxy requests per second"`
+	CacheDir    string `cli:"flag=cache, directory for caching proxy responses"`
+	CacheSize   string `cli:"flag=cache-size, maximum size of the proxy cache, like 5G"`
+	CacheQuota  string `cli:"flag=cache-quota, maximum total size of the cache directories, like 50G"`
+	Concurrency int    `cli:"flag=j, maximum concurrent operations"`
+	Verbose     bool   `cli:"flag=v, log debug messages, including every HTTP request"`
+	LogJSON     bool   `cli:"flag=log-json, log in JSON"`
+	Metrics     string `cli:"flag=metrics, serve /metrics and /progress on this address while the command runs"`
+}
+
+// Before sets up logging, and loads the configuration and applies it.
+func (c *topCmd) Before(ctx context.Context) error {
+	slog.SetDefault(slog.New(c.logHandler(os.Stderr)))
+	cfg, err := config.Load(c.Config)
+	if err != nil {
+		return err
+	}
+	cfg.Override(&config.Config{
+		Dir:         c.Dir,
+		ProxyURL:    c.ProxyURL,
+		IndexURL:    c.IndexURL,
+		ProxyQPS:    c.ProxyQPS,
+		CacheDir:    c.CacheDir,
+		CacheSize:   c.CacheSize,
+		CacheQuota:  c.CacheQuota,
+		Concurrency: c.Concurrency,
+	})
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	config.Set(cfg)
+	proxy.SetURL(cfg.ProxyURL)
+	proxy.SetNoProxy(cfg.NoProxy)
+	proxy.SetConcurrency(cfg.Concurrency)
+	sumdb.SetNoSumDB(cfg.NoSumDB)
+	index.SetURL(cfg.IndexURL)
+	if cfg.CacheDir != "" {
+		pc, err := newProxyCache(cfg)
+		if err != nil {
+			return err
+		}
+		proxy.SetCache(pc)
+	}
+	if cfg.ProxyQPS > 0 {
+		proxy.SetMaxQPS(cfg.ProxyQPS)
+	}
+	if cfg.ProxyTries > 0 {
+		proxy.SetRetry(proxy.RetryPolicy{MaxAttempts: cfg.ProxyTries})
+	}
+	if cfg.Dir != "" {
+		sumdb.SetCacheDir(filepath.Join(cfg.Dir, "sumdb"))
+	}
+	if c.Metrics != "" {
+		serveStatus(ctx, c.Metrics)
+	}
+	return nil
+}
+
+func (c *topCmd) logHandler(w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if c.Verbose {
+		opts.Level = slog.LevelDebug
+	}
+	if c.LogJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
 
 func main() {
-	os.Exit(top.Main(context.Background()))
+	ctx, cancel := withShutdown(context.Background())
+	code := top.Main(ctx)
+	cancel()
+	if pc := proxy.Default().Cache(); pc != nil {
+		if err := pc.Flush(); err != nil {
+			slog.Warn("writing proxy cache index", "err", err)
+		}
+	}
+	os.Exit(code)
+}
+
+// cfg returns the configuration loaded by topCmd.Before.
+func cfg() *config.Config {
+	c, err := config.Current()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return c
 }
 
 func openDB() *sql.DB {
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jba/go-ecosystem/embeds"
+)
+
+func init() {
+	e := top.Command("embeds", &embedsCmd{}, "go:embed usage; run 'eco analyze -a embeds' first, with a zip directory for sizes")
+	e.Command("summary", &embedsSummaryCmd{}, "summarize embedding across the ecosystem")
+	e.Command("largest", &embedsLargestCmd{}, "list the modules that embed the most bytes")
+}
+
+type embedsCmd struct{}
+
+type embedsSummaryCmd struct {
+	Limit int `cli:"flag=n, number of common patterns to list"`
+}
+
+func (c *embedsSummaryCmd) Run(ctx context.Context) error {
+	if c.Limit == 0 {
+		c.Limit = 20
+	}
+	db := openDB()
+	defer db.Close()
+	t, err := embeds.Total(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d modules have %d directives\n", t.Embedding, t.Modules, t.Directives)
+	fmt.Printf("%d measured directives embed %d files, %d bytes\n", t.Measured, t.Files, t.Bytes)
+	pcs, err := embeds.Patterns(ctx, db, c.Limit)
+	if err != nil {
+		return err
+	}
+	fmt.Println("common patterns:")
+	for _, pc := range pcs {
+		fmt.Printf("%8d %s\n", pc.Modules, pc.Pattern)
+	}
+	return nil
+}
+
+type embedsLargestCmd struct {
+	Limit int `cli:"flag=n, maximum number of modules to list"`
+}
+
+func (c *embedsLargestCmd) Run(ctx context.Context) error {
+	if c.Limit == 0 {
+		c.Limit = 50
+	}
+	db := openDB()
+	defer db.Close()
+	us, err := embeds.Largest(ctx, db, c.Limit)
+	if err != nil {
+		return err
+	}
+	for _, u := range us {
+		fmt.Printf("%12d %s@%s: %d files in %d directives\n", u.Bytes, u.ModulePath, u.Version, u.Files, u.Directives)
+	}
+	return nil
+}
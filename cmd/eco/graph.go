@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jba/go-ecosystem/depgraph"
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	g := top.Command("graph", &graphCmd{}, "the module dependency graph")
+	g.Command("load", &graphLoadCmd{}, "load the requirements of modules' latest versions from the proxy")
+	g.Command("rank", &graphRankCmd{}, "compute PageRank, in-degree and betweenness of modules")
+	g.Command("top", &graphTopCmd{}, "list the most central modules")
+}
+
+type graphCmd struct{}
+
+type graphLoadCmd struct {
+	Prefix string `cli:"flag=prefix, only modules whose paths begin with this prefix"`
+}
+
+func (c *graphLoadCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	l := &depgraph.Loader{DB: db}
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+	errc := &errs.Collector{Limit: 100}
+	n := 0
+	for m := range mods {
+		if stopping(ctx) {
+			break
+		}
+		if m.LatestVersion == "" {
+			continue
+		}
+		if _, err := l.Requirements(ctx, module.Version{Path: m.Path, Version: m.LatestVersion}); err != nil {
+			if err := errc.Add(m.Path, err); err != nil {
+				return err
+			}
+			continue
+		}
+		n++
+	}
+	if errc.Len() > 0 {
+		slog.WarnContext(ctx, "graph load: "+errc.Summary())
+	}
+	slog.InfoContext(ctx, "loaded requirements", "modules", n)
+	return errf()
+}
+
+type graphRankCmd struct {
+	Samples int    `cli:"flag=samples, estimate betweenness from this many modules; 0 means exact"`
+	Seed    uint64 `cli:"flag=seed, random seed for sampling"`
+}
+
+func (c *graphRankCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	n, err := depgraph.Compute(ctx, db, depgraph.ComputeOptions{Samples: c.Samples, Seed: c.Seed})
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "ranked modules", "count", n)
+	return nil
+}
+
+type graphTopCmd struct {
+	By    string `cli:"flag=by, order: page_rank, in_degree or betweenness"`
+	Limit int    `cli:"flag=n, maximum number of modules to list"`
+}
+
+func (c *graphTopCmd) Run(ctx context.Context) error {
+	if c.By == "" {
+		c.By = depgraph.ByPageRank
+	}
+	if c.Limit == 0 {
+		c.Limit = 50
+	}
+	db := openDB()
+	defer db.Close()
+	seq, errf := depgraph.Top(ctx, db, c.By, c.Limit)
+	for s := range seq {
+		fmt.Printf("%-60s %6d %.3g %.4g\n", s.ModulePath, s.InDegree, s.PageRank, s.Betweenness)
+	}
+	return errf()
+}
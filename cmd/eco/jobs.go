@@ -0,0 +1,337 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/modfs"
+	"github.com/jba/go-ecosystem/schedule"
+	"github.com/jba/go-ecosystem/tasks"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	j := top.Command("jobs", &jobsCmd{}, "a persistent queue of work for long-running pipelines")
+	j.Command("enqueue", &jobsEnqueueCmd{}, "add jobs for modules that need work; KIND is download or analyze")
+	j.Command("work", &jobsWorkCmd{}, "run jobs until none are ready; safe to interrupt and restart")
+	j.Command("status", &jobsStatusCmd{}, "count jobs by kind and state")
+	j.Command("list", &jobsListCmd{}, "list jobs of a kind in a state, with their errors")
+	j.Command("retry", &jobsRetryCmd{}, "make failed jobs pending again")
+	j.Command("purge", &jobsPurgeCmd{}, "delete jobs")
+}
+
+type jobsCmd struct{}
+
+// Kinds of jobs. The key of each job is "path@version".
+const (
+	downloadJob = "download" // save the module's trimmed zip in the corpus
+	analyzeJob  = "analyze"  // run all analyzers over the module
+)
+
+func checkJobKind(kind string) error {
+	if kind != downloadJob && kind != analyzeJob {
+		return fmt.Errorf("unknown job kind %q; want %s or %s", kind, downloadJob, analyzeJob)
+	}
+	return nil
+}
+
+type jobsEnqueueCmd struct {
+	Prefix   string `cli:"flag=prefix, only modules whose paths begin with this prefix"`
+	Priority int    `cli:"flag=priority, priority of the jobs; higher runs first"`
+	Schedule bool   `cli:"flag=schedule, instead of -priority, prioritize jobs by the popularity of their modules"`
+	Kind     string `cli:"name=KIND, kind of job"`
+}
+
+func (c *jobsEnqueueCmd) Run(ctx context.Context) error {
+	if err := checkJobKind(c.Kind); err != nil {
+		return err
+	}
+	db := openDB()
+	defer db.Close()
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+	var mvs iter.Seq[module.Version]
+	switch c.Kind {
+	case downloadJob:
+		mvs = missingModules(ctx, mods)
+	case analyzeJob:
+		mvs = corpusModules(ctx, mods)
+	}
+	q := &tasks.Queue{DB: db}
+	var n int
+	if c.Schedule {
+		// The work of these jobs has never been done, so only popularity matters.
+		scorer, err := schedule.NewScorer(ctx, db, schedule.Options{})
+		if err != nil {
+			return err
+		}
+		byPriority := map[int][]string{}
+		for mv := range mvs {
+			p := scorer.Priority(mv.Path, time.Time{})
+			byPriority[p] = append(byPriority[p], mv.String())
+		}
+		for p, keys := range byPriority {
+			m, err := q.Enqueue(ctx, c.Kind, p, slices.Values(keys))
+			if err != nil {
+				return err
+			}
+			n += m
+		}
+	} else {
+		keys := func(yield func(string) bool) {
+			for mv := range mvs {
+				if !yield(mv.String()) {
+					return
+				}
+			}
+		}
+		var err error
+		n, err = q.Enqueue(ctx, c.Kind, c.Priority, keys)
+		if err != nil {
+			return err
+		}
+	}
+	if err := errf(); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "enqueued jobs", "kind", c.Kind, "jobs", n)
+	return nil
+}
+
+// missingModules returns the latest versions of mods that are not in the corpus.
+func missingModules(ctx context.Context, mods iter.Seq[*ecodb.Module]) iter.Seq[module.Version] {
+	return func(yield func(module.Version) bool) {
+		for m := range mods {
+			if stopping(ctx) {
+				return
+			}
+			if m.LatestVersion == "" {
+				continue
+			}
+			zf, err := modfs.ZipPath(cfg().CorpusDir, m.Path, m.LatestVersion)
+			if err != nil {
+				continue
+			}
+			if _, err := os.Stat(zf); err == nil {
+				continue
+			}
+			if !yield(module.Version{Path: m.Path, Version: m.LatestVersion}) {
+				return
+			}
+		}
+	}
+}
+
+type jobsWorkCmd struct {
+	Worker   string        `cli:"flag=worker, name of this worker (default host:pid)"`
+	Lease    time.Duration `cli:"flag=lease, how long a job is leased before another worker may claim it (default 5m)"`
+	Attempts int           `cli:"flag=attempts, attempts before a job fails (default 3)"`
+	Kind     string        `cli:"name=KIND, kind of job"`
+}
+
+func (c *jobsWorkCmd) Run(ctx context.Context) error {
+	if err := checkJobKind(c.Kind); err != nil {
+		return err
+	}
+	db := openDB()
+	defer db.Close()
+	if c.Worker == "" {
+		host, _ := os.Hostname()
+		c.Worker = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	work := localJob(db, c.Kind)
+	q := &tasks.Queue{DB: db, MaxAttempts: c.Attempts}
+	s, err := q.Work(ctx, c.Kind, tasks.WorkOptions{
+		Worker:      c.Worker,
+		Concurrency: cfg().Concurrency,
+		Lease:       c.Lease,
+		Stop:        stopRequested(ctx),
+	}, func(ctx context.Context, j *tasks.Job) error {
+		mv, err := jobModule(j)
+		if err != nil {
+			return err
+		}
+		return work(ctx, mv)
+	})
+	if s != nil {
+		slog.InfoContext(ctx, "worked", "kind", c.Kind, "done", s.Done, "retried", s.Retried, "failed", s.Failed)
+		if s.Errors.Len() > 0 {
+			slog.WarnContext(ctx, "job failures", "summary", s.Errors.Summary())
+		}
+	}
+	return err
+}
+
+// jobModule returns the module version that is the key of j.
+func jobModule(j *tasks.Job) (module.Version, error) {
+	path, version, ok := strings.Cut(j.Key, "@")
+	if !ok {
+		return module.Version{}, fmt.Errorf("bad job key %q", j.Key)
+	}
+	return module.Version{Path: path, Version: version}, nil
+}
+
+// localJob returns a function that does all the work of a job of the given kind.
+func localJob(db *sql.DB, kind string) func(context.Context, module.Version) error {
+	switch kind {
+	case downloadJob:
+		return func(ctx context.Context, mv module.Version) error {
+			return saveZip(ctx, mv.Path, mv.Version, cfg().ZipDir, cfg().CorpusDir)
+		}
+	case analyzeJob:
+		r := analysisRunner(db)
+		return func(ctx context.Context, mv module.Version) error {
+			_, err := r.RunModule(ctx, mv)
+			return err
+		}
+	}
+	panic("bad job kind " + kind)
+}
+
+// remoteJob returns a function that does the work of a job of the given
+// kind on a remote worker, without a database. The coordinator passes its
+// result to the function returned by [storeJobResult].
+func remoteJob(kind string) func(context.Context, module.Version) ([]byte, error) {
+	switch kind {
+	case downloadJob:
+		return func(ctx context.Context, mv module.Version) ([]byte, error) {
+			data, _, err := trimmedZip(ctx, mv.Path, mv.Version, cfg().ZipDir)
+			return data, err
+		}
+	case analyzeJob:
+		r := analysisRunner(nil)
+		return func(ctx context.Context, mv module.Version) ([]byte, error) {
+			// Analysis needs the module in the worker's own corpus.
+			if err := saveZip(ctx, mv.Path, mv.Version, cfg().ZipDir, cfg().CorpusDir); err != nil {
+				return nil, err
+			}
+			results, err := r.AnalyzeModule(mv)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(results)
+		}
+	}
+	panic("bad job kind " + kind)
+}
+
+// storeJobResult returns a function that stores the result of a job of the
+// given kind computed by a remote worker.
+func storeJobResult(db *sql.DB, kind string) tasks.ResultFunc {
+	switch kind {
+	case downloadJob:
+		return func(ctx context.Context, j *tasks.Job, result []byte) error {
+			mv, err := jobModule(j)
+			if err != nil {
+				return err
+			}
+			if _, err := zip.NewReader(bytes.NewReader(result), int64(len(result))); err != nil {
+				return fmt.Errorf("%s: bad zip from worker: %w", mv, err)
+			}
+			return writeCorpusZip(cfg().CorpusDir, mv.Path, mv.Version, result)
+		}
+	case analyzeJob:
+		r := analysisRunner(db)
+		return func(ctx context.Context, j *tasks.Job, result []byte) error {
+			results, err := analysis.DecodeResults(result)
+			if err != nil {
+				return err
+			}
+			_, err = r.WriteResults(ctx, results)
+			return err
+		}
+	}
+	panic("bad job kind " + kind)
+}
+
+func analysisRunner(db *sql.DB) *analysis.Runner {
+	return &analysis.Runner{
+		DB:        db,
+		CorpusDir: cfg().CorpusDir,
+		ZipDir:    cfg().ZipDir,
+		Analyzers: analysis.Analyzers(),
+	}
+}
+
+type jobsStatusCmd struct{}
+
+func (c *jobsStatusCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	counts, err := (&tasks.Queue{DB: db}).Counts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range counts {
+		fmt.Printf("%-10s %-8s %d\n", c.Kind, c.State, c.N)
+	}
+	return nil
+}
+
+type jobsListCmd struct {
+	State string `cli:"flag=state, state of the jobs (default failed)"`
+	Limit int    `cli:"flag=n, list at most this many jobs"`
+	Kind  string `cli:"name=KIND, kind of job"`
+}
+
+func (c *jobsListCmd) Run(ctx context.Context) error {
+	if c.State == "" {
+		c.State = string(tasks.Failed)
+	}
+	db := openDB()
+	defer db.Close()
+	jobs, errf := (&tasks.Queue{DB: db}).Jobs(ctx, c.Kind, tasks.State(c.State), c.Limit)
+	for j := range jobs {
+		fmt.Printf("%s attempts=%d updated=%s", j.Key, j.Attempts, j.Updated)
+		if j.Worker != "" {
+			fmt.Printf(" worker=%s", j.Worker)
+		}
+		if j.Error != "" {
+			fmt.Printf(": %s", j.Error)
+		}
+		fmt.Println()
+	}
+	return errf()
+}
+
+type jobsRetryCmd struct {
+	Kind string `cli:"name=KIND, kind of job"`
+}
+
+func (c *jobsRetryCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	n, err := (&tasks.Queue{DB: db}).Retry(ctx, c.Kind)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "retrying jobs", "kind", c.Kind, "jobs", n)
+	return nil
+}
+
+type jobsPurgeCmd struct {
+	State string `cli:"flag=state, only jobs in this state (default all)"`
+	Kind  string `cli:"name=KIND, kind of job"`
+}
+
+func (c *jobsPurgeCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	n, err := (&tasks.Queue{DB: db}).Purge(ctx, c.Kind, tasks.State(c.State))
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "purged jobs", "kind", c.Kind, "jobs", n)
+	return nil
+}
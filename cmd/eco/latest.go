@@ -5,16 +5,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"net/http"
-	"slices"
+	"log/slog"
 
 	"github.com/jba/go-ecosystem/internal/errs"
-	"github.com/jba/go-ecosystem/internal/httputil"
 	"github.com/jba/go-ecosystem/proxy"
 	"github.com/jba/go-ecosystem/versions"
 	"golang.org/x/mod/modfile"
-	"golang.org/x/mod/semver"
 )
 
 // latestModuleVersion uses the proxy to get information about the latest
@@ -29,7 +25,8 @@ import (
 // v0.0.0-20181107005212-dafb9c8d8707 that @latest does not return.) That is not
 // a failure, but a valid state in which there is no version information for a
 // module, even though particular pseudo-versions of the module might exist. In
-// this case, LatestModuleVersions returns ("", errs.NotFound).
+// this case, latestModuleVersion returns an error of kind errs.NoVersions,
+// and the caller can fall back to the versions found by package untagged.
 func latestModuleVersion(ctx context.Context, modulePath string) (_ string, err error) {
 	defer errs.Wrap(&err, "latestModuleVersion(%s)", modulePath)
 	// Get the raw latest version.
@@ -37,30 +34,42 @@ func latestModuleVersion(ctx context.Context, modulePath string) (_ string, err
 	if err != nil {
 		return "", err
 	}
+	allVersions = canonicalVersions(modulePath, allVersions)
 	// Only call latest if there no versions in the list.
 	// This saves a latest call, but in theory (I think) the highest
 	// version in the list is retracted and then the latest endpoint
 	// may come into play. Ignore those cases.
 	if len(allVersions) == 0 {
 		latest, err := proxy.Latest(ctx, modulePath)
-		if httputil.ErrorStatus(err) == http.StatusNotFound {
+		if errors.Is(err, errs.NotFound) {
 			// No information version information from the proxy.
 			// There may be pseudo-versions out there, but we can't learn about them.
-			return "", errNoVersions
+			return "", errNoVersions()
 		}
 		if err != nil {
 			return "", err
 		}
-		allVersions = []string{latest}
+		allVersions = canonicalVersions(modulePath, []string{latest})
+		if len(allVersions) == 0 {
+			return "", errNoVersions()
+		}
 	}
 
-	seen := map[string]bool{}
-	hasGoMod := func(version string) (bool, error) {
-		if seen[version] {
-			log.Printf("!!! %s saw version %s twice for mod endpoint", modulePath, version)
+	// Remember go.mod files, so we fetch each at most once.
+	modData := map[string][]byte{}
+	getMod := func(ctx context.Context, version string) ([]byte, error) {
+		if data, ok := modData[version]; ok {
+			return data, nil
+		}
+		data, err := proxy.Mod(ctx, modulePath, version)
+		if err != nil {
+			return nil, err
 		}
-		seen[version] = true
-		goModBytes, err := proxy.Mod(ctx, modulePath, version)
+		modData[version] = data
+		return data, nil
+	}
+	hasGoMod := func(ctx context.Context, version string) (bool, error) {
+		goModBytes, err := getMod(ctx, version)
 		if err != nil {
 			return false, err
 		}
@@ -70,40 +79,46 @@ func latestModuleVersion(ctx context.Context, modulePath string) (_ string, err
 		// but it's much cheaper than downloading the zip.
 		return bytes.IndexByte(goModBytes, '\n') != len(goModBytes)-1, nil
 	}
-	rawLatest, err := versions.Latest(allVersions, hasGoMod)
+	rawLatest, err := versions.LatestContext(ctx, allVersions, hasGoMod)
 	if err != nil {
 		return "", err
 	}
 	// Get the go.mod file at the raw latest version.
-	modBytes, err := proxy.Mod(ctx, modulePath, rawLatest)
+	modBytes, err := getMod(ctx, rawLatest)
 	if err != nil {
 		return "", err
 	}
 	modFile, err := modfile.ParseLax(fmt.Sprintf("%s@%s/go.mod", modulePath, rawLatest), modBytes, nil)
 	if err != nil {
-		log.Printf("latestModuleVersion: using raw latest because bad go.mod file: %v", err)
+		slog.WarnContext(ctx, "using raw latest because of bad go.mod file", "module", modulePath, "version", rawLatest, "err", err)
 		return rawLatest, nil
 		// return "", err
 	}
 
 	// Get the cooked latest version by disallowing retracted versions.
-	unretractedVersions := slices.DeleteFunc(slices.Clone(allVersions),
-		func(v string) bool { return isRetracted(modFile, v) })
+	unretractedVersions := versions.RetractionsFromModFile(modFile).FilterOut(allVersions)
 	if len(allVersions) == len(unretractedVersions) {
 		return rawLatest, nil
 	}
 	// This can return the empty string if all versions are retracted.
-	return versions.Latest(unretractedVersions, hasGoMod)
+	return versions.LatestContext(ctx, unretractedVersions, hasGoMod)
 }
 
-var errNoVersions = errors.New("no versions from proxy")
+func errNoVersions() error {
+	return fmt.Errorf("%w from proxy", errs.NoVersions)
+}
 
-// isRetracted reports whether the go.mod file retracts the version.
-func isRetracted(mf *modfile.File, resolvedVersion string) bool {
-	for _, r := range mf.Retract {
-		if semver.Compare(resolvedVersion, r.Low) >= 0 && semver.Compare(resolvedVersion, r.High) <= 0 {
-			return true
+// canonicalVersions returns the canonical forms of the versions of modulePath
+// in vs. It drops and logs versions that the go command would reject.
+func canonicalVersions(modulePath string, vs []string) []string {
+	var cvs []string
+	for _, v := range vs {
+		cv, err := versions.Canonical(modulePath, v)
+		if err != nil {
+			slog.Warn("ignoring bad version from proxy", "err", err)
+			continue
 		}
+		cvs = append(cvs, cv)
 	}
-	return false
+	return cvs
 }
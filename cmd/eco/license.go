@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/licenses"
+	"github.com/jba/go-ecosystem/modfs"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	lic := top.Command("license", &licenseCmd{}, "license policy and SBOMs for corpus modules")
+	lic.Command("check", &licenseCheckCmd{}, "evaluate a module and its dependencies against the license policy")
+	lic.Command("sbom", &licenseSBOMCmd{}, "write an SBOM for a module and its dependencies")
+}
+
+type licenseCmd struct{}
+
+type licenseCheckCmd struct {
+	Module string `cli:"name=MODULE, module path, optionally with @version; default the latest version in the corpus"`
+}
+
+func (c *licenseCheckCmd) Run(ctx context.Context) error {
+	r, err := checkLicenses(ctx, c.Module)
+	if err != nil {
+		return err
+	}
+	for _, m := range append([]*licenses.ModuleLicenses{r.Main}, r.Deps...) {
+		fmt.Printf("%-10s %s %s\n", m.Verdict, m.Version, strings.Join(m.Licenses, ","))
+	}
+	for _, m := range r.Missing {
+		fmt.Printf("%-10s %s (not in corpus)\n", licenses.Unresolved, m)
+	}
+	if r.Verdict() == licenses.Denied {
+		return fmt.Errorf("%s: denied by license policy", r.Main.Version)
+	}
+	fmt.Println(r.Verdict())
+	return nil
+}
+
+type licenseSBOMCmd struct {
+	Format string `cli:"flag=format, SBOM format: spdx or cyclonedx (default spdx)"`
+	Module string `cli:"name=MODULE, module path, optionally with @version; default the latest version in the corpus"`
+}
+
+func (c *licenseSBOMCmd) Run(ctx context.Context) error {
+	gen := licenses.SPDX
+	switch c.Format {
+	case "", "spdx":
+	case "cyclonedx":
+		gen = licenses.CycloneDX
+	default:
+		return fmt.Errorf("unknown SBOM format %q", c.Format)
+	}
+	r, err := checkLicenses(ctx, c.Module)
+	if err != nil {
+		return err
+	}
+	data, err := gen(r, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+// checkLicenses evaluates the module described by arg, of the form path[@version],
+// against the configured license policy.
+func checkLicenses(ctx context.Context, arg string) (*licenses.Report, error) {
+	path, version, _ := strings.Cut(arg, "@")
+	if version == "" {
+		vs, err := modfs.Versions(cfg().CorpusDir, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(vs) == 0 {
+			return nil, fmt.Errorf("%s is not in the corpus", path)
+		}
+		version = vs[len(vs)-1]
+	}
+	p := licenses.ParsePolicy(cfg().AllowedLicenses, cfg().DeniedLicenses)
+	return licenses.Check(ctx, cfg().CorpusDir, module.Version{Path: path, Version: version}, p)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jba/go-ecosystem/internal/database"
+)
+
+func init() {
+	top.Command("merge", &mergeCmd{}, "merge the modules of other eco databases into this one")
+}
+
+type mergeCmd struct {
+	Shards []string `cli:"name=DB, min=1, database files to merge"`
+}
+
+func (c *mergeCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	// Module IDs are assigned anew. A module in a shard replaces the
+	// one in this database, since it is likely more recent.
+	// The packages table refers to module IDs, so it can't be merged.
+	return database.Merge(ctx, db, c.Shards, []database.MergeTable{
+		{Name: "modules", Omit: []string{"id"}, OnConflict: database.Replace},
+	})
+}
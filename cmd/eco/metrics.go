@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/jba/go-ecosystem/index"
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/metrics"
+	"github.com/jba/go-ecosystem/internal/progress"
+	"github.com/jba/go-ecosystem/proxy"
+	"github.com/jba/go-ecosystem/tasks"
+	"github.com/jba/go-ecosystem/vulndb"
+)
+
+// handleStatus adds handlers for /metrics and /progress to mux.
+// The job queue metrics are served only if db is not nil.
+func handleStatus(mux *http.ServeMux, db *sql.DB) {
+	mux.Handle("/progress", progress.Handler())
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := writeMetrics(r.Context(), w, db); err != nil {
+			slog.ErrorContext(r.Context(), "writing metrics", "err", err)
+		}
+	})
+}
+
+// serveStatus serves /metrics and /progress on addr in the background,
+// for the -metrics flag.
+func serveStatus(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	handleStatus(mux, nil)
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		slog.ErrorContext(ctx, "metrics server", "addr", addr, "err", err)
+	}()
+}
+
+// writeMetrics writes the progress of live stages, request counts and rate
+// limiter waits for the services eco calls, database activity, and if db is
+// not nil, the number of jobs by kind and state.
+func writeMetrics(ctx context.Context, w io.Writer, db *sql.DB) error {
+	if err := progress.WriteMetrics(w); err != nil {
+		return err
+	}
+	mw := metrics.NewWriter(w)
+
+	var reqs, waits []metrics.Sample
+	for _, c := range []struct {
+		name  string
+		stats httputil.LimitStats
+	}{
+		{"proxy", proxy.Stats()},
+		{"index", index.Stats()},
+		{"vulndb", vulndb.Stats()},
+	} {
+		labels := []string{"service", c.name}
+		reqs = append(reqs, metrics.Sample{Labels: labels, Value: float64(c.stats.Requests)})
+		waits = append(waits, metrics.Sample{Labels: labels, Value: c.stats.Wait.Seconds()})
+	}
+	mw.Write("http_requests_total", metrics.Counter, "Requests sent to a service.", reqs...)
+	mw.Write("http_rate_limit_wait_seconds_total", metrics.Counter, "Time spent waiting for a service's rate limit.", waits...)
+
+	var q database.QueryStats
+	for _, s := range database.Stats() {
+		q.Count += s.Count
+		q.Rows += s.Rows
+		q.Total += s.Total
+		q.Failures += s.Failures
+	}
+	mw.Value("db_queries_total", metrics.Counter, "Database queries.", float64(q.Count))
+	mw.Value("db_query_rows_total", metrics.Counter, "Rows returned or affected by database queries.", float64(q.Rows))
+	mw.Value("db_query_seconds_total", metrics.Counter, "Time spent in database queries.", q.Total.Seconds())
+	mw.Value("db_query_failures_total", metrics.Counter, "Database queries that failed.", float64(q.Failures))
+	ws := database.Writes()
+	mw.Value("db_write_batches_total", metrics.Counter, "Batches committed by background database writers.", float64(ws.Batches))
+	mw.Value("db_written_values_total", metrics.Counter, "Values written by background database writers.", float64(ws.Values))
+
+	if db != nil {
+		counts, err := (&tasks.Queue{DB: db}).Counts(ctx)
+		if err != nil {
+			return err
+		}
+		var jobs []metrics.Sample
+		for _, c := range counts {
+			jobs = append(jobs, metrics.Sample{Labels: []string{"kind", c.Kind, "state", string(c.State)}, Value: float64(c.N)})
+		}
+		mw.Write("jobs", metrics.Gauge, "Jobs in the queue.", jobs...)
+	}
+	return mw.Err()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/database"
+)
+
+func init() {
+	migrate := top.Command("migrate", &migrateCmd{}, "manage the database schema")
+	migrate.Command("up", &migrateUpCmd{}, "apply all pending migrations")
+	migrate.Command("down", &migrateDownCmd{}, "revert the most recent migrations")
+	migrate.Command("status", &migrateStatusCmd{}, "list migrations and whether they are applied")
+}
+
+type migrateCmd struct{}
+
+type migrateUpCmd struct {
+	DryRun bool `cli:"flag=n, print the SQL instead of executing it"`
+}
+
+func (c *migrateUpCmd) Run(ctx context.Context) error {
+	return withMigrator(c.DryRun, func(m *database.Migrator) error {
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if !c.DryRun {
+			slog.InfoContext(ctx, "applied migrations", "count", n)
+		}
+		return nil
+	})
+}
+
+type migrateDownCmd struct {
+	DryRun bool `cli:"flag=n, print the SQL instead of executing it"`
+	Count  int  `cli:"flag=count, number of migrations to revert (default 1)"`
+}
+
+func (c *migrateDownCmd) Run(ctx context.Context) error {
+	return withMigrator(c.DryRun, func(m *database.Migrator) error {
+		return m.Down(ctx, max(c.Count, 1))
+	})
+}
+
+type migrateStatusCmd struct{}
+
+func (c *migrateStatusCmd) Run(ctx context.Context) error {
+	return withMigrator(false, func(m *database.Migrator) error {
+		ss, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range ss {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + s.AppliedAt
+			}
+			fmt.Printf("%03d %-30s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	})
+}
+
+// withMigrator calls f with a migrator for the database.
+// If dryRun is true, the migrator prints SQL to stdout instead of running it.
+func withMigrator(dryRun bool, f func(*database.Migrator) error) error {
+	db := openDB()
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		m.DryRun = os.Stdout
+	}
+	return f(m)
+}
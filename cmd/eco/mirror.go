@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jba/go-ecosystem/depgraph"
+	"github.com/jba/go-ecosystem/mirror"
+	"github.com/jba/go-ecosystem/proxy"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	m := top.Command("mirror", &mirrorCmd{}, "static module mirrors for use with GOPROXY=file://DIR")
+	m.Command("build", &mirrorBuildCmd{}, "add modules to a mirror directory")
+	m.Command("verify", &mirrorVerifyCmd{}, "check a mirror directory against its manifest")
+}
+
+type mirrorCmd struct{}
+
+type mirrorBuildCmd struct {
+	Deps    bool     `cli:"flag=deps, also add the modules' dependencies"`
+	Dir     string   `cli:"name=DIR, mirror directory"`
+	Modules []string `cli:"name=MODULE@QUERY, min=1, modules to add; the query defaults to latest"`
+}
+
+func (c *mirrorBuildCmd) Run(ctx context.Context) error {
+	var mods []module.Version
+	for _, arg := range c.Modules {
+		path, query := proxy.SplitQuery(arg)
+		info, err := proxy.Resolve(ctx, path, query)
+		if err != nil {
+			return err
+		}
+		mods = append(mods, module.Version{Path: path, Version: info.Version})
+	}
+	b := &mirror.Builder{Dir: c.Dir, Deps: c.Deps}
+	if c.Deps {
+		db := openDB()
+		defer db.Close()
+		b.Loader = &depgraph.Loader{DB: db}
+	}
+	s, err := b.Build(ctx, mods)
+	if s != nil {
+		slog.InfoContext(ctx, "mirror build", "dir", c.Dir, "versions", s.Versions, "zips", s.Zips, "fetched", s.Fetched)
+	}
+	return err
+}
+
+type mirrorVerifyCmd struct {
+	SumDB bool   `cli:"flag=sumdb, also check hashes against the checksum database"`
+	Dir   string `cli:"name=DIR, mirror directory"`
+}
+
+func (c *mirrorVerifyCmd) Run(ctx context.Context) error {
+	problems, err := mirror.Verify(ctx, c.Dir, c.SumDB)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems in mirror %s", len(problems), c.Dir)
+	}
+	fmt.Printf("%s: ok\n", c.Dir)
+	return nil
+}
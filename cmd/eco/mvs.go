@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jba/go-ecosystem/depgraph"
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/mvs"
+	"github.com/jba/go-ecosystem/vulndb"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	m := top.Command("mvs", &mvsCmd{}, "dependency versions selected by minimal version selection across the ecosystem")
+	m.Command("run", &mvsRunCmd{}, "compute the build list of every module's latest version")
+	m.Command("versions", &mvsVersionsCmd{}, "compare the declared and selected versions of a module")
+	m.Command("vulns", &mvsVulnsCmd{}, "list vulnerable versions by the number of builds that select them; run 'eco vuln sync' first")
+}
+
+type mvsCmd struct{}
+
+type mvsRunCmd struct {
+	Prefix string `cli:"flag=prefix, only roots whose paths begin with this prefix"`
+}
+
+func (c *mvsRunCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+	roots := func(yield func(module.Version) bool) {
+		for m := range mods {
+			if stopping(ctx) {
+				return
+			}
+			if m.LatestVersion != "" && !yield(module.Version{Path: m.Path, Version: m.LatestVersion}) {
+				return
+			}
+		}
+	}
+	s, err := mvs.Run(ctx, db, &depgraph.Loader{DB: db}, roots)
+	if s != nil {
+		slog.InfoContext(ctx, "computed build lists", "roots", s.Roots, "upgrades", s.Upgrades)
+		if s.Errors.Len() > 0 {
+			slog.WarnContext(ctx, "mvs: "+s.Errors.Summary())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return errf()
+}
+
+type mvsVersionsCmd struct {
+	Module string `cli:"name=MODULE, module path"`
+}
+
+func (c *mvsVersionsCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	us, err := mvs.Versions(ctx, db, c.Module)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-30s %8s %8s\n", "version", "declared", "selected")
+	for _, u := range us {
+		fmt.Printf("%-30s %8d %8d\n", u.Version, u.Declared, u.Selected)
+	}
+	return nil
+}
+
+type mvsVulnsCmd struct {
+	Limit int `cli:"flag=n, maximum number of versions to list"`
+}
+
+func (c *mvsVulnsCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	m, err := vulndb.NewMatcher(ctx, db)
+	if err != nil {
+		return err
+	}
+	vs, err := mvs.Vulnerable(ctx, db, m)
+	if err != nil {
+		return err
+	}
+	if c.Limit > 0 && len(vs) > c.Limit {
+		vs = vs[:c.Limit]
+	}
+	for _, v := range vs {
+		fmt.Printf("%s@%s selected by %d, declared by %d: %s\n", v.Path, v.Version, v.Selected, v.Declared, strings.Join(v.IDs, " "))
+	}
+	return nil
+}
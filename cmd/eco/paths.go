@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/pool"
+	"github.com/jba/go-ecosystem/modpath"
+)
+
+func init() {
+	p := top.Command("paths", &pathsCmd{}, "renamed and moved modules, and suspicious vanity paths")
+	p.Command("check", &pathsCheckCmd{}, "compare module paths with their go.mod files and origin repositories")
+	p.Command("flagged", &pathsFlaggedCmd{}, "list modules with path findings")
+	p.Command("aliases", &pathsAliasesCmd{}, "list the other paths of a module")
+}
+
+type pathsCmd struct{}
+
+type pathsCheckCmd struct {
+	Prefix string `cli:"flag=prefix, only modules whose paths begin with this prefix"`
+	Force  bool   `cli:"flag=force, check modules whose latest versions have already been checked"`
+}
+
+func (c *pathsCheckCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+
+	// Collect the modules first, so the database isn't read while it's written.
+	checked := map[string]string{} // module path to checked version
+	rs, errf := database.ScanRowsAs[modpath.Result](ctx, db, "SELECT module_path, version FROM module_paths")
+	for r := range rs {
+		checked[r.ModulePath] = r.Version
+	}
+	if err := errf(); err != nil {
+		return err
+	}
+	var todo []*ecodb.Module
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+	for m := range mods {
+		if m.LatestVersion != "" && (c.Force || checked[m.Path] != m.LatestVersion) {
+			todo = append(todo, m)
+		}
+	}
+	if err := errf(); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "checking module paths", "modules", len(todo))
+
+	var (
+		mu                 sync.Mutex // guards the counts and database writes
+		nChecked, nFlagged int
+	)
+	p := &pool.Pool[*ecodb.Module]{
+		Concurrency: cfg().Concurrency,
+		Policy:      pool.Collect,
+		MaxErrors:   1000,
+		Key:         func(m *ecodb.Module) string { return m.Path },
+	}
+	err := p.Run(ctx, untilStopped(ctx, slices.Values(todo)), func(ctx context.Context, m *ecodb.Module) error {
+		r, err := modpath.Check(ctx, m.Path, m.LatestVersion)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := modpath.Record(ctx, db, r); err != nil {
+			return pool.Fatal(err)
+		}
+		nChecked++
+		if r.Finding != "" {
+			nFlagged++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	errc := p.Errors()
+	slog.InfoContext(ctx, "checked module paths", "checked", nChecked, "flagged", nFlagged, "errors", errc.Len())
+	if errc.Len() > 0 {
+		slog.WarnContext(ctx, "paths check: "+errc.Summary())
+	}
+	return nil
+}
+
+type pathsFlaggedCmd struct{}
+
+func (c *pathsFlaggedCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	rs, errf := modpath.Flagged(ctx, db)
+	for r := range rs {
+		fmt.Printf("%s %s: %s\n", r.ModulePath, r.Finding, r.Detail)
+	}
+	return errf()
+}
+
+type pathsAliasesCmd struct {
+	Module string `cli:"name=MODULE, canonical module path"`
+}
+
+func (c *pathsAliasesCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	rs, errf := modpath.Aliases(ctx, db, c.Module)
+	for r := range rs {
+		fmt.Printf("%s %s\n", r.ModulePath, r.Finding)
+	}
+	return errf()
+}
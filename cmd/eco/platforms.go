@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jba/go-ecosystem/platforms"
+)
+
+func init() {
+	p := top.Command("platforms", &platformsCmd{}, "operating systems and architectures supported by modules; run 'eco analyze -a platforms' first")
+	p.Command("gaps", &platformsGapsCmd{}, "list modules with packages that don't support an operating system, most imported first")
+	p.Command("show", &platformsShowCmd{}, "show the operating systems supported by a module's packages")
+}
+
+type platformsCmd struct{}
+
+type platformsGapsCmd struct {
+	GOOS  string `cli:"flag=goos, operating system"`
+	Limit int    `cli:"flag=n, maximum number of modules to list"`
+}
+
+func (c *platformsGapsCmd) Run(ctx context.Context) error {
+	if c.GOOS == "" {
+		c.GOOS = "windows"
+	}
+	if c.Limit == 0 {
+		c.Limit = 50
+	}
+	db := openDB()
+	defer db.Close()
+	gaps, err := platforms.Gaps(ctx, db, c.GOOS, c.Limit)
+	if err != nil {
+		return err
+	}
+	for _, g := range gaps {
+		fmt.Printf("%6d %s@%s: %d packages\n", g.Importers, g.ModulePath, g.Version, g.Packages)
+	}
+	return nil
+}
+
+type platformsShowCmd struct {
+	Module string `cli:"name=MODULE, module path"`
+}
+
+func (c *platformsShowCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	version, supported, total, err := platforms.Matrix(ctx, db, c.Module)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return fmt.Errorf("no results for the latest version of %s", c.Module)
+	}
+	fmt.Printf("%s@%s: %d packages\n", c.Module, version, total)
+	var goos []string
+	for _, p := range platforms.All {
+		if !slices.Contains(goos, p.GOOS) {
+			goos = append(goos, p.GOOS)
+		}
+	}
+	for _, g := range goos {
+		fmt.Printf("%-10s %d\n", g, supported[g])
+	}
+	return nil
+}
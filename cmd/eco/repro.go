@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/pool"
+	"github.com/jba/go-ecosystem/repro"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	r := top.Command("repro", &reproCmd{}, "compare proxy zips with zips rebuilt from the modules' repositories")
+	r.Command("check", &reproCheckCmd{}, "rebuild module zips from their repositories and record whether they match")
+	r.Command("mismatches", &reproMismatchesCmd{}, "list module versions whose proxy zips don't match their repositories")
+}
+
+type reproCmd struct{}
+
+type reproCheckCmd struct {
+	Prefix  string   `cli:"flag=prefix, only modules whose paths begin with this prefix"`
+	Limit   int      `cli:"flag=n, check at most this many modules; zero means no limit"`
+	Force   bool     `cli:"flag=force, check versions that have already been checked"`
+	WorkDir string   `cli:"flag=work, directory for clones (default the system temporary directory)"`
+	Modules []string `cli:"name=MODULE@VERSION, module versions to check; default the latest versions of modules in the database"`
+}
+
+func (c *reproCheckCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+
+	var mvs iter.Seq[module.Version]
+	var errf func() error
+	if len(c.Modules) > 0 {
+		var list []module.Version
+		for _, arg := range c.Modules {
+			path, version, ok := strings.Cut(arg, "@")
+			if !ok {
+				return fmt.Errorf("%q: want MODULE@VERSION", arg)
+			}
+			list = append(list, module.Version{Path: path, Version: version})
+		}
+		mvs = slices.Values(list)
+		errf = func() error { return nil }
+	} else {
+		var mods iter.Seq[*ecodb.Module]
+		mods, errf = ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+		mvs = func(yield func(module.Version) bool) {
+			n := 0
+			for m := range mods {
+				if m.LatestVersion == "" {
+					continue
+				}
+				if !c.Force {
+					done, err := repro.Checked(ctx, db, m.Path, m.LatestVersion)
+					if err != nil {
+						slog.ErrorContext(ctx, "repro", "module", m.Path, "err", err)
+						return
+					}
+					if done {
+						continue
+					}
+				}
+				if c.Limit > 0 && n >= c.Limit {
+					return
+				}
+				n++
+				if !yield(module.Version{Path: m.Path, Version: m.LatestVersion}) {
+					return
+				}
+			}
+		}
+	}
+
+	var (
+		mu                    sync.Mutex // guards the counts, output and database writes
+		nChecked, nMismatched int
+	)
+	p := &pool.Pool[module.Version]{Concurrency: cfg().Concurrency, Policy: pool.Collect, MaxErrors: 100}
+	err := p.Run(ctx, untilStopped(ctx, mvs), func(ctx context.Context, mv module.Version) error {
+		r, err := repro.Check(ctx, c.WorkDir, mv.Path, mv.Version)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := repro.Record(ctx, db, r); err != nil {
+			return pool.Fatal(err)
+		}
+		nChecked++
+		if r.Error == "" && !r.Reproducible {
+			nMismatched++
+			fmt.Printf("%s: mismatch: %s\n", mv, r.Diff)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := errf(); err != nil {
+		return err
+	}
+	errc := p.Errors()
+	slog.InfoContext(ctx, "repro check done", "checked", nChecked, "mismatched", nMismatched, "errors", errc.Len())
+	if errc.Len() > 0 {
+		slog.WarnContext(ctx, "repro check: "+errc.Summary())
+	}
+	return nil
+}
+
+type reproMismatchesCmd struct{}
+
+func (c *reproMismatchesCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	rs, errf := repro.Mismatches(ctx, db)
+	for r := range rs {
+		fmt.Printf("%s@%s %s@%s %s\n", r.ModulePath, r.Version, r.RepoURL, r.CommitHash, r.Diff)
+	}
+	return errf()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jba/go-ecosystem/supplychain"
+)
+
+func init() {
+	r := top.Command("review", &reviewCmd{}, "modules to review for signs of malicious code")
+	r.Command("build", &reviewBuildCmd{}, "rank modules; run 'eco analyze -a imports,suspicious_calls,blobs' first")
+	r.Command("list", &reviewListCmd{}, "list the review queue, most suspicious first")
+}
+
+type reviewCmd struct{}
+
+type reviewBuildCmd struct {
+	Popular int           `cli:"flag=popular, number of most-imported paths to check for typo-squatting (default 1000)"`
+	Recent  time.Duration `cli:"flag=recent, weight typo-squatting more for modules published within this long (default 90 days)"`
+}
+
+func (c *reviewBuildCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	n, err := supplychain.BuildQueue(ctx, db, supplychain.QueueOptions{Popular: c.Popular, Recent: c.Recent})
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "built review queue", "modules", n)
+	return nil
+}
+
+type reviewListCmd struct {
+	Limit int `cli:"flag=n, list at most this many modules"`
+}
+
+func (c *reviewListCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	items, errf := supplychain.Queue(ctx, db, c.Limit)
+	for it := range items {
+		fmt.Printf("%5.1f %s@%s: %s\n", it.Score, it.ModulePath, it.Version, it.Reasons)
+	}
+	return errf()
+}
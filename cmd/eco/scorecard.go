@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/pool"
+	"github.com/jba/go-ecosystem/scorecard"
+)
+
+func init() {
+	sc := top.Command("scorecard", &scorecardCmd{}, "OpenSSF Scorecard results for module repositories")
+	sc.Command("fetch", &scorecardFetchCmd{}, "download Scorecard results for the repositories of modules")
+	sc.Command("show", &scorecardShowCmd{}, "display the Scorecard result for a module")
+}
+
+type scorecardCmd struct{}
+
+type scorecardFetchCmd struct {
+	Prefix string        `cli:"flag=prefix, only modules whose paths begin with this prefix"`
+	MaxAge time.Duration `cli:"flag=max-age, refetch results older than this; zero means fetch only new repositories"`
+}
+
+func (c *scorecardFetchCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+
+	// Collect the repositories, skipping those with fresh enough results.
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+	repos := map[string]bool{}
+	for mod := range mods {
+		if repo, ok := scorecard.RepoFor(mod.Path); ok {
+			repos[repo] = true
+		}
+	}
+	if err := errf(); err != nil {
+		return err
+	}
+	for repo := range repos {
+		r, err := scorecard.Load(ctx, db, repo)
+		if err != nil {
+			return err
+		}
+		if r != nil && (c.MaxAge == 0 || r.Fetched >= time.Now().Add(-c.MaxAge).UTC().Format(time.RFC3339)) {
+			delete(repos, repo)
+		}
+	}
+	slog.InfoContext(ctx, "fetching scorecards", "repos", len(repos))
+
+	var (
+		mu                sync.Mutex // guards the counts and database writes
+		nStored, nMissing int
+	)
+	p := &pool.Pool[string]{Concurrency: cfg().Concurrency, Policy: pool.Collect, MaxErrors: 100}
+	err := p.Run(ctx, untilStopped(ctx, slices.Values(slices.Sorted(maps.Keys(repos)))), func(ctx context.Context, repo string) error {
+		r, err := scorecard.Fetch(ctx, repo)
+		mu.Lock()
+		defer mu.Unlock()
+		// Most repositories have never been scored.
+		if errors.Is(err, errs.NotFound) {
+			nMissing++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := scorecard.Store(ctx, db, r); err != nil {
+			return pool.Fatal(err)
+		}
+		nStored++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	errc := p.Errors()
+	slog.InfoContext(ctx, "fetched scorecards", "stored", nStored, "unscored", nMissing, "errors", errc.Len())
+	if errc.Len() > 0 {
+		return errors.New(errc.Summary())
+	}
+	return nil
+}
+
+type scorecardShowCmd struct {
+	Module string `cli:"name=MODULE, module path"`
+}
+
+func (c *scorecardShowCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	r, err := scorecard.ForModule(ctx, db, c.Module)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("no Scorecard result for %s; run 'eco scorecard fetch'", c.Module)
+	}
+	fmt.Printf("%s %.1f (commit %s, %s)\n", r.Repo, r.Score, r.CommitSHA, r.Date)
+	for _, ch := range r.Checks {
+		score := "?"
+		if ch.Score >= 0 {
+			score = fmt.Sprint(ch.Score)
+		}
+		fmt.Printf("  %-22s %2s  %s\n", ch.Name, score, ch.Reason)
+	}
+	return nil
+}
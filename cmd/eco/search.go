@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jba/go-ecosystem/descriptions"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/modfs"
+)
+
+func init() {
+	top.Command("describe", &describeCmd{}, "extract READMEs and synopses from untrimmed module zips for search")
+	top.Command("search", &searchCmd{}, "search module paths and descriptions")
+}
+
+type describeCmd struct {
+	Force   bool     `cli:"flag=force, extract descriptions of module versions that have already been described"`
+	Modules []string `cli:"name=MODULE@VERSION, modules to download from the proxy and describe; default all zips in the zip directory"`
+}
+
+func (c *describeCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	n := 0
+	describe := func(mfs *modfs.FS) error {
+		d, err := descriptions.Extract(mfs, mfs.Path, mfs.Version)
+		if err != nil {
+			return err
+		}
+		if err := descriptions.Store(ctx, db, d); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}
+	if len(c.Modules) > 0 {
+		for _, arg := range c.Modules {
+			path, version, ok := strings.Cut(arg, "@")
+			if !ok {
+				return fmt.Errorf("%q: want MODULE@VERSION", arg)
+			}
+			mfs, err := modfs.FromProxy(ctx, path, version)
+			if err != nil {
+				return err
+			}
+			if err := describe(mfs); err != nil {
+				return err
+			}
+		}
+	} else {
+		dir := cfg().ZipDir
+		if dir == "" {
+			return errors.New("no modules given and no zip directory configured")
+		}
+		errc := &errs.Collector{Limit: 100}
+		for mv, file := range modfs.ZipFiles(dir) {
+			if stopping(ctx) {
+				break
+			}
+			if !c.Force {
+				done, err := descriptions.Extracted(ctx, db, mv.Path, mv.Version)
+				if err != nil {
+					return err
+				}
+				if done {
+					continue
+				}
+			}
+			mfs, err := modfs.Open(file, mv.Path, mv.Version)
+			if err == nil {
+				err = describe(mfs)
+				mfs.Close()
+			}
+			if err != nil {
+				if err := errc.Add(mv.String(), err); err != nil {
+					return err
+				}
+			}
+		}
+		if errc.Len() > 0 {
+			slog.WarnContext(ctx, "describe: "+errc.Summary())
+		}
+	}
+	slog.InfoContext(ctx, "described modules", "count", n)
+	return nil
+}
+
+type searchCmd struct {
+	Limit int    `cli:"flag=n, maximum number of results"`
+	Query string `cli:"name=QUERY, words to search for"`
+}
+
+func (c *searchCmd) Run(ctx context.Context) error {
+	if c.Limit == 0 {
+		c.Limit = 20
+	}
+	db := openDB()
+	defer db.Close()
+	hits, err := descriptions.Search(ctx, db, c.Query, c.Limit)
+	if err != nil {
+		return err
+	}
+	for _, h := range hits {
+		fmt.Printf("%s\t%s\n", h.ModulePath, h.Synopsis)
+	}
+	return nil
+}
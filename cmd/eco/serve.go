@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/tasks"
+)
+
+func init() {
+	top.Command("serve", &serveCmd{}, "coordinate remote workers (see 'eco worker'), and serve /metrics and /progress")
+}
+
+type serveCmd struct {
+	Addr  string `cli:"flag=addr, address to listen on (default localhost:8080)"`
+	Token string `cli:"flag=token, token that workers must present (default $ECO_WORKER_TOKEN)"`
+}
+
+func (c *serveCmd) Run(ctx context.Context) error {
+	if c.Addr == "" {
+		c.Addr = "localhost:8080"
+	}
+	if c.Token == "" {
+		c.Token = os.Getenv("ECO_WORKER_TOKEN")
+	}
+	// Requests are handled concurrently. Writes go through one connection,
+	// so they wait their turn instead of failing when the database is busy,
+	// and reads for /metrics don't hold them up.
+	h, err := ecodb.OpenHandle(cfg().Concurrency)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	mux := http.NewServeMux()
+	results := map[string]tasks.ResultFunc{}
+	for _, kind := range []string{downloadJob, analyzeJob} {
+		results[kind] = storeJobResult(h.Write, kind)
+	}
+	mux.Handle("/jobs/", http.StripPrefix("/jobs", tasks.Handler(&tasks.Queue{DB: h.Write}, c.Token, results)))
+	handleStatus(mux, h.Read)
+
+	srv := &http.Server{Addr: c.Addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	slog.InfoContext(ctx, "serving", "addr", c.Addr)
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	case <-stopRequested(ctx):
+	}
+	// Let in-flight requests, like a worker delivering a result, finish.
+	sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"iter"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// withShutdown arranges a two-stage shutdown on SIGINT or SIGTERM.
+// The first signal asks commands to stop after their current unit of work;
+// see [stopRequested]. The second cancels the returned context.
+// Call the returned function to release resources.
+func withShutdown(ctx context.Context) (context.Context, func()) {
+	sigc := make(chan os.Signal, 2)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := shutdownOn(ctx, sigc)
+	return ctx, func() {
+		signal.Stop(sigc)
+		cancel()
+	}
+}
+
+type stopKey struct{}
+
+// shutdownOn implements withShutdown for signals received on sigc.
+func shutdownOn(ctx context.Context, sigc <-chan os.Signal) (context.Context, context.CancelFunc) {
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, stopKey{}, stop))
+	go func() {
+		select {
+		case sig := <-sigc:
+			slog.Warn("finishing current work; signal again to stop immediately", "signal", sig)
+			close(stop)
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case sig := <-sigc:
+			slog.Warn("stopping", "signal", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// stopRequested returns a channel that is closed when the command
+// should stop after its current unit of work, leaving the database and
+// checkpoints in a consistent state. It never closes if there is
+// no shutdown handling in ctx.
+func stopRequested(ctx context.Context) <-chan struct{} {
+	c, _ := ctx.Value(stopKey{}).(chan struct{})
+	return c // a nil channel never closes
+}
+
+// stopping reports whether a stop has been requested.
+func stopping(ctx context.Context) bool {
+	select {
+	case <-stopRequested(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
+// untilStopped returns the elements of seq until a stop is requested.
+// Use it to stop a [pool.Pool] from starting new items.
+func untilStopped[T any](ctx context.Context, seq iter.Seq[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for x := range seq {
+			if stopping(ctx) || !yield(x) {
+				return
+			}
+		}
+	}
+}
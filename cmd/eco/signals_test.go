@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestShutdownOn(t *testing.T) {
+	sigc := make(chan os.Signal)
+	ctx, cancel := shutdownOn(context.Background(), sigc)
+	defer cancel()
+	if stopping(ctx) {
+		t.Fatal("stopping before any signal")
+	}
+	sigc <- os.Interrupt
+	select {
+	case <-stopRequested(ctx):
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop not requested after first signal")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("context canceled after first signal")
+	}
+	sigc <- os.Interrupt
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not canceled after second signal")
+	}
+
+	if stopping(context.Background()) {
+		t.Error("stopping without shutdown handling")
+	}
+}
+
+func TestUntilStopped(t *testing.T) {
+	stop := make(chan struct{})
+	ctx := context.WithValue(context.Background(), stopKey{}, stop)
+	var got []int
+	for x := range untilStopped(ctx, slices.Values([]int{1, 2, 3, 4})) {
+		got = append(got, x)
+		if x == 2 {
+			close(stop)
+		}
+	}
+	if want := []int{1, 2}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
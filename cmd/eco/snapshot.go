@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/snapshot"
+)
+
+func init() {
+	s := top.Command("snapshot", &snapshotCmd{}, "archive and restore the database, corpus manifest and config")
+	s.Command("create", &snapshotCreateCmd{}, "write a snapshot of the current environment")
+	s.Command("restore", &snapshotRestoreCmd{}, "replace the database with the one in a snapshot")
+	s.Command("verify", &snapshotVerifyCmd{}, "check a snapshot's integrity, and optionally the corpus against it")
+}
+
+type snapshotCmd struct{}
+
+type snapshotCreateCmd struct {
+	File string `cli:"name=FILE, snapshot file to write"`
+}
+
+func (c *snapshotCreateCmd) Run(ctx context.Context) (err error) {
+	db := openDB()
+	defer db.Close()
+	f, err := os.Create(c.File)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(c.File)
+		}
+	}()
+	m, err := snapshot.Create(ctx, f, snapshot.CreateOptions{
+		DB:        db,
+		CorpusDir: cfg().CorpusDir,
+		Config:    cfg(),
+		TempDir:   cfg().Dir,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: %d corpus modules, %d-byte database\n", c.File, m.Modules, m.Files[snapshot.DBFile].Size)
+	return nil
+}
+
+type snapshotRestoreCmd struct {
+	Force bool   `cli:"flag=force, overwrite an existing database"`
+	File  string `cli:"name=FILE, snapshot file"`
+}
+
+func (c *snapshotRestoreCmd) Run(ctx context.Context) error {
+	s, err := openSnapshot(c.File)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	dbFile, err := ecodb.Path()
+	if err != nil {
+		return err
+	}
+	if err := s.Restore(dbFile, c.Force); err != nil {
+		return err
+	}
+	fmt.Printf("restored %s from snapshot of %s\n", dbFile, s.Manifest.Created.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+type snapshotVerifyCmd struct {
+	Corpus bool   `cli:"flag=corpus, also compare the corpus with the snapshot's manifest"`
+	File   string `cli:"name=FILE, snapshot file"`
+}
+
+func (c *snapshotVerifyCmd) Run(ctx context.Context) error {
+	s, err := openSnapshot(c.File)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	fmt.Printf("%s: ok, format %d, created %s, %d corpus modules\n",
+		c.File, s.Manifest.Format, s.Manifest.Created.Format("2006-01-02 15:04:05"), s.Manifest.Modules)
+	if !c.Corpus {
+		return nil
+	}
+	problems, err := s.VerifyCorpus(ctx, cfg().CorpusDir)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("corpus differs from snapshot in %d modules", len(problems))
+	}
+	return nil
+}
+
+func openSnapshot(file string) (*snapshot.Snapshot, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return snapshot.Open(f, cfg().Dir)
+}
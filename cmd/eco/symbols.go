@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jba/go-ecosystem/symbols"
+)
+
+func init() {
+	top.Command("symbols", &symbolsCmd{}, "find definitions of an exported identifier; run 'eco analyze -a symbols' first")
+}
+
+type symbolsCmd struct {
+	Name string `cli:"name=NAME, identifier, or qualified name like io.Reader or bytes.Buffer.Len"`
+}
+
+func (c *symbolsCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	seq, errf := symbols.Lookup(ctx, db, c.Name)
+	if strings.Contains(c.Name, ".") {
+		seq, errf = symbols.Definitions(ctx, db, c.Name)
+	}
+	for s := range seq {
+		fmt.Printf("%-6s %s\t%s@%s\n", s.Kind, s.ID(), s.ModulePath, s.Version)
+	}
+	return errf()
+}
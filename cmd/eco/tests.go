@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jba/go-ecosystem/testmetrics"
+)
+
+func init() {
+	top.Command("tests", &testsCmd{}, "report how well tested modules are, by popularity; run 'eco analyze -a tests,imports' first")
+}
+
+type testsCmd struct{}
+
+func (c *testsCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	tiers, err := testmetrics.ByTier(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-10s %8s %7s %7s %7s %10s\n", "importers", "modules", "tested", "fuzzed", "bench", "test/code")
+	for _, t := range tiers {
+		if t.Modules == 0 {
+			continue
+		}
+		ratio := 0.0
+		if t.Lines > 0 {
+			ratio = float64(t.TestLines) / float64(t.Lines)
+		}
+		fmt.Printf("%-10s %8d %6.1f%% %6.1f%% %6.1f%% %10.2f\n", fmt.Sprintf(">=%d", t.MinImporters), t.Modules,
+			percent(t.Tested, t.Modules), percent(t.Fuzzed, t.Modules), percent(t.Benchmarked, t.Modules), ratio)
+	}
+	return nil
+}
+
+func percent(n, total int) float64 {
+	return 100 * float64(n) / float64(total)
+}
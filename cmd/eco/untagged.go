@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jba/go-ecosystem/untagged"
+)
+
+func init() {
+	top.Command("untagged", &untaggedCmd{}, "find pseudo-versions of modules the proxy lists no versions for, and mark those modules alive")
+}
+
+type untaggedCmd struct {
+	Since string `cli:"flag=since, also read the index from this timestamp, like 2019-04-10T19:08:52.997264Z"`
+}
+
+func (c *untaggedCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	cr := &untagged.Crawler{DB: db, Since: c.Since}
+	s, err := cr.Crawl(ctx)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "untagged modules", "modules", s.Modules, "new versions", s.Versions, "alive", s.Alive)
+	return nil
+}
@@ -3,21 +3,31 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
 	"log"
-	"net/http"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/jba/go-ecosystem/ecodb"
 	"github.com/jba/go-ecosystem/index"
 	"github.com/jba/go-ecosystem/internal/database"
-	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/jiter"
+	"github.com/jba/go-ecosystem/internal/pool"
 	"github.com/jba/go-ecosystem/internal/progress"
+	"github.com/jba/go-ecosystem/notify"
 	"github.com/jba/go-ecosystem/proxy"
-	"golang.org/x/sync/errgroup"
+	"github.com/jba/go-ecosystem/schedule"
+	"github.com/jba/go-ecosystem/untagged"
+	"github.com/jba/go-ecosystem/versions"
+	"golang.org/x/mod/module"
 	_ "modernc.org/sqlite"
 )
 
@@ -26,22 +36,39 @@ func init() {
 }
 
 type updateCmd struct {
-	Duration time.Duration
-	Module   string `cli:"flag=mod"`
+	Duration  time.Duration
+	Module    string        `cli:"flag=mod"`
+	SlowQuery time.Duration `cli:"flag=slow-query, log database queries slower than this"`
+	Stale     time.Duration `cli:"flag=stale, also refresh modules whose proxy information is older than this"`
+	Budget    int           `cli:"flag=budget, refresh at most this many modules from the proxy, most important first"`
+
+	stages *progress.Stages
+	counts map[string]any // for the update-done event
 }
 
 func (c *updateCmd) Run(ctx context.Context) error {
 	if c.Module != "" {
 		m := &ecodb.Module{Path: c.Module}
-		if err := populateModuleFromProxy(ctx, m); err != nil {
+		if err := populateModuleFromProxy(ctx, nil, m); err != nil {
 			log.Fatal(err)
 		}
 		fmt.Printf("%+v\n", m)
 		return nil
 	}
 
+	// Long runs fill the caches, so make room first.
+	if err := gcCaches(ctx); err != nil {
+		return err
+	}
+
 	db := openDB()
 	defer db.Close()
+	database.SlowQueryThreshold = c.SlowQuery
+	defer func() {
+		var buf strings.Builder
+		database.WriteStats(&buf, 10)
+		slog.InfoContext(ctx, "database time by query\n"+buf.String())
+	}()
 
 	// Read all modules into memory.
 	start := time.Now()
@@ -49,25 +76,34 @@ func (c *updateCmd) Run(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	log.Printf("read %d modules from DB in %.1fs", len(mods), time.Since(start).Seconds())
+	slog.InfoContext(ctx, "read modules from DB", "count", len(mods), "duration", time.Since(start).Round(time.Millisecond))
 
+	c.stages = progress.NewStages(2, 10*time.Second, reportProgressWithProxy)
+	defer c.stages.Stop()
+	c.counts = map[string]any{"inserted": 0, "updated": 0, "refreshed": 0, "errors": 0}
 	if err := c.updateFromIndex(ctx, db, mods); err != nil {
 		return err
 	}
-	if err := c.updateModuleFromProxy(ctx, db, mods); err != nil {
-		return err
+	if !stopping(ctx) {
+		if err := c.updateModuleFromProxy(ctx, db, mods); err != nil {
+			return err
+		}
 	}
+	c.counts["duration"] = time.Since(start).Round(time.Second).String()
+	c.counts["stopped"] = stopping(ctx)
+	sendEvent(ctx, &notify.Event{
+		Kind: notify.UpdateDone,
+		Text: fmt.Sprintf("eco update: %d new modules, %d updated, %d refreshed from the proxy",
+			c.counts["inserted"], c.counts["updated"], c.counts["refreshed"]),
+		Data: c.counts,
+	})
 	return nil
 }
 
 func allModules(ctx context.Context, db *sql.DB) (map[string]*ecodb.Module, error) {
-	iter, errf := database.ScanRows(ctx, db, "SELECT * FROM modules")
+	iter, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{})
 	mods := map[string]*ecodb.Module{}
-	for r := range iter {
-		m, err := ecodb.ScanModule(r)
-		if err != nil {
-			return nil, err
-		}
+	for m := range iter {
 		mods[m.Path] = m
 	}
 	if err := errf(); err != nil {
@@ -78,154 +114,354 @@ func allModules(ctx context.Context, db *sql.DB) (map[string]*ecodb.Module, erro
 
 func (c *updateCmd) updateFromIndex(ctx context.Context, db *sql.DB, mods map[string]*ecodb.Module) error {
 	// Get the indexSince value from params table.
-	var since string
-	err := db.QueryRowContext(ctx, "SELECT value FROM params WHERE name = 'indexSince'").Scan(&since)
-	if err != nil && err != sql.ErrNoRows {
+	since, err := ecodb.Param(ctx, db, "indexSince")
+	if err != nil {
 		return fmt.Errorf("querying indexSince: %w", err)
 	}
 
 	// Read the index.
-	log.Printf("reading index from %s", since)
+	slog.InfoContext(ctx, "reading index", "since", since)
 
-	// Collect unique paths and track the latest timestamp
+	// Collect unique paths since the last checkpoint.
 	seen := map[string]bool{}
+	watched := map[module.Version]bool{} // new versions of modules watched by webhooks
+	var pseudos []untagged.Version       // versions of modules the proxy lists no versions for
 	var latestTimestamp string
+	nBad, nPaths, nInserts, nUpdates := 0, 0, 0, 0
 	deadline := time.Now().Add(c.Duration)
 
-	entries, errf := index.Entries(ctx, since)
+	// At each checkpoint, write what we've collected and advance indexSince,
+	// so a crash loses little work.
+	cp := index.CheckpointFunc(func(ctx context.Context, timestamp string) error {
+		ins, upd, err := writeIndexModules(ctx, db, mods, seen)
+		if err != nil {
+			return err
+		}
+		if _, err := untagged.Record(ctx, db, pseudos); err != nil {
+			return err
+		}
+		if err := ecodb.SetParam(ctx, db, "indexSince", timestamp); err != nil {
+			return fmt.Errorf("updating indexSince: %w", err)
+		}
+		slog.DebugContext(ctx, "index checkpoint", "to", timestamp, "paths", len(seen), "inserts", ins, "updates", upd)
+		nPaths += len(seen)
+		nInserts += ins
+		nUpdates += upd
+		clear(seen)
+		pseudos = nil
+		return nil
+	})
+
+	p := c.stages.NewStage("index", -1)
+	// Restart at the last timestamp if reading fails. We may see some entries
+	// twice, but that doesn't matter because we only collect paths.
+	entries, errf := jiter.Retry(ctx, since,
+		func(since string) (iter.Seq[*index.Entry], func() error) { return index.Entries(ctx, since, cp) },
+		func(e *index.Entry) string { return e.Timestamp },
+		jiter.RetryPolicy{})
 	for e := range entries {
-		if time.Now().After(deadline) {
+		if time.Now().After(deadline) || stopping(ctx) {
 			break
 		}
-		seen[e.Path] = true
+		p.Did(1)
 		latestTimestamp = e.Timestamp
+		if _, err := versions.Canonical(e.Path, e.Version); err != nil {
+			// Don't store bogus entries.
+			slog.WarnContext(ctx, "ignoring bad index entry", "err", err)
+			nBad++
+			continue
+		}
+		seen[e.Path] = true
+		if m := mods[e.Path]; m != nil && (m.Untagged || m.ErrorKind == errs.NoVersions.Error()) {
+			pseudos = append(pseudos, untagged.Version{ModulePath: e.Path, Version: e.Version, Source: untagged.Index, Time: e.Timestamp})
+		}
+		if notifier().Watched(e.Path) {
+			watched[module.Version{Path: e.Path, Version: e.Version}] = true
+		}
 	}
 	if err := errf(); err != nil {
 		return fmt.Errorf("reading index: %w", err)
 	}
-	log.Printf("saw %d unique paths in index in %s", len(seen), c.Duration)
+	slog.InfoContext(ctx, "read index", "to", latestTimestamp, "paths", nPaths, "bad", nBad, "inserts", nInserts, "updates", nUpdates)
+	c.counts["inserted"] = nInserts
+	c.counts["updated"] = nUpdates
+	newVersions := slices.Collect(maps.Keys(watched))
+	module.Sort(newVersions)
+	for _, e := range newVersions {
+		sendEvent(ctx, &notify.Event{
+			Kind:    notify.NewVersion,
+			Text:    fmt.Sprintf("new version: %s@%s", e.Path, e.Version),
+			Module:  e.Path,
+			Version: e.Version,
+		})
+	}
+	return nil
+}
 
-	// Write the new modules.
-	nInserts := 0
-	nUpdates := 0
-	start := time.Now()
-	err = database.Transaction(db, func(tx *sql.Tx) error {
-		insert, err := tx.PrepareContext(ctx, ecodb.ModuleInsertStmt)
-		if err != nil {
-			return err
+// writeIndexModules writes the modules whose paths are in seen to db:
+// new modules are inserted, and those already in db are cleared so they are
+// refreshed. It adds the new modules to mods, and returns the number of
+// modules inserted and updated.
+func writeIndexModules(ctx context.Context, db *sql.DB, mods map[string]*ecodb.Module, seen map[string]bool) (nInserts, nUpdates int, err error) {
+	var updates, newMods []*ecodb.Module
+	var maxID int64
+	for p := range seen {
+		mod, inDB := mods[p]
+		// If the mod is in the DB, this will effectively clear out all other columns.
+		if inDB {
+			// This path is in the DB, but since we saw it again in the index, redo everything.
+			updates = append(updates, &ecodb.Module{ID: mod.ID, Path: mod.Path})
+		} else {
+			newMods = append(newMods, &ecodb.Module{Path: p})
 		}
-		defer insert.Close()
+	}
+	for _, m := range mods {
+		maxID = max(maxID, m.ID)
+	}
+	// The transaction may be retried, so it must not change anything but the database.
+	err = database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
 		update, err := tx.PrepareContext(ctx, ecodb.ModuleUpdateStmt)
 		if err != nil {
 			return err
 		}
 		defer update.Close()
+		for _, mod := range updates {
+			if _, err := update.ExecContext(ctx, mod.UpdateArgs()...); err != nil {
+				return err
+			}
+		}
 
-		for p := range seen {
-			mod, inDB := mods[p]
-			// If the mod is in the DB, this will effectively clear out all other columns.
-			if inDB {
-				// This path is in the DB, but since we saw it again in the index, redo everything.
-				mod = &ecodb.Module{ID: mod.ID, Path: mod.Path}
-				nUpdates++
-				if _, err := update.ExecContext(ctx, mod.UpdateArgs()...); err != nil {
-					return err
-				}
-			} else {
-				mod = &ecodb.Module{Path: p}
-				mods[p] = mod
-				nInserts++
-				res, err := insert.ExecContext(ctx, mod.InsertArgs()...)
-				if err != nil {
-					return err
-				}
-				mod.ID, err = res.LastInsertId()
-				if err != nil {
-					return err
+		rows := func(yield func([]any) bool) {
+			for _, m := range newMods {
+				if !yield(m.InsertArgs()) {
+					return
 				}
 			}
 		}
+		n, err := database.BulkInsert(ctx, tx, "modules", ecodb.ModuleInsertCols, rows, 500)
+		if err != nil {
+			return err
+		}
+		nInserts = int(n)
 		return nil
 	})
 	if err != nil {
-		return err
+		return 0, 0, err
+	}
+	for _, m := range newMods {
+		mods[m.Path] = m
 	}
-	log.Printf("%d inserts and %d updates in %.1fs", nInserts, nUpdates, time.Since(start).Seconds())
 
-	// Write the latest timestamp to params table.
-	if latestTimestamp != "" {
-		_, err = db.ExecContext(ctx,
-			"INSERT INTO params (name, value) VALUES ('indexSince', ?) ON CONFLICT(name) DO UPDATE SET value = ?",
-			latestTimestamp, latestTimestamp)
-		if err != nil {
-			return fmt.Errorf("updating indexSince: %w", err)
+	// Get the IDs of the new rows.
+	iter, errf := database.ScanRows(ctx, db, "SELECT id, path FROM modules WHERE id > ?", maxID)
+	for r := range iter {
+		var id int64
+		var path string
+		if err := r.Scan(&id, &path); err != nil {
+			return 0, 0, err
+		}
+		if m, ok := mods[path]; ok {
+			m.ID = id
 		}
 	}
-	log.Printf("read index to %s", latestTimestamp)
-	return nil
+	if err := errf(); err != nil {
+		return 0, 0, err
+	}
+	return nInserts, len(updates), nil
 }
 
 func (c *updateCmd) updateModuleFromProxy(ctx context.Context, db *sql.DB, mods map[string]*ecodb.Module) error {
 	// Collect the modules that need information from the proxy.
 	// We collect first so we can report accurate progress.
+	now := time.Now()
 	var toUpdate []*ecodb.Module
 	for _, m := range mods {
-		if m.Error == "" && (m.LatestVersion == "" || m.InfoTime == "") {
+		if m.Error != "" {
+			continue
+		}
+		if m.LatestVersion == "" || m.InfoTime == "" {
+			toUpdate = append(toUpdate, m)
+		} else if c.Stale > 0 && now.Sub(schedule.ParseTime(m.Refreshed)) > c.Stale {
 			toUpdate = append(toUpdate, m)
 		}
 	}
-	log.Printf("%d modules to update", len(toUpdate))
-	p := progress.Start(len(toUpdate), 10*time.Second, reportProgressWithProxy)
-
-	proxy.SetMaxQPS(300)
-
-	g, gctx := errgroup.WithContext(ctx)
-	g.SetLimit(10)
+	// Spend the proxy budget on the most popular and stalest modules first.
+	scorer, err := schedule.NewScorer(ctx, db, schedule.Options{Now: now})
+	if err != nil {
+		return err
+	}
+	schedule.Sort(scorer, toUpdate, func(m *ecodb.Module) (string, time.Time) {
+		return m.Path, schedule.ParseTime(m.Refreshed)
+	})
+	if c.Budget > 0 && len(toUpdate) > c.Budget {
+		toUpdate = toUpdate[:c.Budget]
+	}
+	for _, m := range toUpdate {
+		if m.LatestVersion != "" && m.InfoTime != "" {
+			// A stale module: fetch its latest version again.
+			m.LatestVersion = ""
+		}
+	}
+	slog.InfoContext(ctx, "modules to update", "count", len(toUpdate))
 
-	// sqlite can only do one write at a time
-	var mu sync.Mutex
+	// If a previous run was interrupted, include its work in the progress report.
+	cpStore := &paramCheckpointStore{db: db, name: "checkpoint:proxy refresh"}
+	cp, err := cpStore.Load()
+	if err != nil {
+		return err
+	}
+	if cp.Complete() {
+		cp = progress.Checkpoint{}
+	}
+	p := c.stages.NewStage("proxy refresh", cp.Done+len(toUpdate))
+	p.Resume(cp)
+	p.Persist(ctx, cpStore, time.Minute)
 
-	var proxyDur, dbDur atomic.Int64
+	if cfg().ProxyQPS == 0 {
+		proxy.SetMaxQPS(300)
+	}
 
-	for _, mod := range toUpdate {
-		g.Go(func() error {
-			start := time.Now()
-			if err := populateModuleFromProxy(gctx, mod); err != nil {
+	// sqlite can only do one write at a time, so write from a single goroutine.
+	stmts := database.NewStmtCache(db, 4)
+	defer stmts.Close()
+	w := database.NewWriter(ctx, db, 100, 5*time.Second, func(ctx context.Context, tx *sql.Tx, mods []*ecodb.Module) error {
+		for _, mod := range mods {
+			_, err := database.Upsert(ctx, stmts.InTx(tx), "modules", []string{"path"}, ecodb.ModuleInsertCols, mod.InsertArgs()...)
+			if err != nil {
 				return err
 			}
-			proxyDur.Add(time.Since(start).Nanoseconds())
-			start = time.Now()
-			mu.Lock()
-			if _, err := db.ExecContext(gctx, ecodb.ModuleUpdateStmt, mod.UpdateArgs()...); err != nil {
+		}
+		return nil
+	})
+	defer w.Close()
+
+	var proxyDur, dbDur time.Duration
+	nRefreshed := 0
+
+	errc := &errs.Collector{Limit: 1000}
+	// Failures are recorded per module, so Run fails only if ctx is done.
+	latest := &pool.Pool[*ecodb.Module]{Concurrency: cfg().Concurrency}
+	// Work a chunk at a time: find the latest versions of the modules in the
+	// chunk, then get their info in a batch. The results are processed in
+	// this goroutine, which is the only writer.
+	// If a stop is requested, finish the chunk in progress, then save what we have.
+chunks:
+	for chunk := range slices.Chunk(toUpdate, 10*cfg().Concurrency) {
+		start := time.Now()
+		var mu sync.Mutex
+		failed := map[*ecodb.Module]error{}
+		if err = latest.Run(ctx, slices.Values(chunk), func(ctx context.Context, mod *ecodb.Module) error {
+			if err := populateLatestVersion(ctx, db, mod); err != nil {
+				mu.Lock()
+				failed[mod] = err
 				mu.Unlock()
-				return err
 			}
-			mu.Unlock()
-			dbDur.Add(time.Since(start).Nanoseconds())
-			p.Did(1)
 			return nil
+		}); err != nil {
+			break
+		}
+		var (
+			withVersion []*ecodb.Module
+			mvs         []module.Version
+		)
+		for _, mod := range chunk {
+			if failed[mod] == nil && mod.LatestVersion != "" {
+				withVersion = append(withVersion, mod)
+				mvs = append(mvs, module.Version{Path: mod.Path, Version: mod.LatestVersion})
+			}
+		}
+		for i, r := range proxy.InfoBatch(ctx, mvs) {
+			if r.Err != nil {
+				failed[withVersion[i]] = r.Err
+			} else {
+				withVersion[i].InfoTime = r.Info.Time
+			}
+		}
+		proxyDur += time.Since(start)
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		for _, mod := range chunk {
+			p.Did(1)
+			if merr := failed[mod]; merr != nil {
+				// Don't let a few bad modules stop the others.
+				if err = errc.Add(mod.Path, merr); err != nil {
+					break chunks
+				}
+				continue
+			}
+			mod.Refreshed = time.Now().UTC().Format(time.RFC3339)
+			start := time.Now()
+			if err = w.Write(ctx, mod); err != nil {
+				break chunks
+			}
+			dbDur += time.Since(start)
+			nRefreshed++
+		}
+		if stopping(ctx) {
+			break
+		}
+	}
+	if errc.Len() > 0 {
+		slog.WarnContext(ctx, "proxy refresh: "+errc.Summary())
+	}
+	c.counts["refreshed"] = nRefreshed
+	c.counts["errors"] = errc.Len()
+	if err == nil {
+		// Record the errors, except temporary ones, which may not happen next time.
+		err = errc.Save(func(path string, merr error) error {
+			slog.WarnContext(ctx, "proxy refresh", "module", path, "err", merr)
+			if errors.Is(merr, errs.Temporary) {
+				return nil
+			}
+			mod := mods[path]
+			mod.SetError(merr)
+			mod.Refreshed = time.Now().UTC().Format(time.RFC3339)
+			return w.Write(ctx, mod)
 		})
 	}
-	if err := g.Wait(); err != nil {
+	start := time.Now()
+	err = errors.Join(err, w.Close())
+	dbDur += time.Since(start)
+	c.stages.Stop() // saves the checkpoint
+	if err != nil {
 		return err
 	}
-	log.Printf("proxy: %.1fs, db: %.1fs", time.Duration(proxyDur.Load()).Seconds(),
-		time.Duration(dbDur.Load()).Seconds())
+	slog.InfoContext(ctx, "proxy refresh done", "proxy", proxyDur.Round(time.Millisecond), "db", dbDur.Round(time.Millisecond))
 	return nil
 }
 
-func populateModuleFromProxy(ctx context.Context, mod *ecodb.Module) error {
-	if mod.LatestVersion == "" {
-		latestVersion, err := latestModuleVersion(ctx, mod.Path)
-		if err != nil {
-			if errors.Is(err, errNoVersions) || isNotFound(err) {
-				mod.Error = err.Error()
-			} else {
-				return err
-			}
-		} else {
-			mod.LatestVersion = latestVersion
-		}
+// paramCheckpointStore is a progress.CheckpointStore that keeps
+// its checkpoint in the params table.
+type paramCheckpointStore struct {
+	db   *sql.DB
+	name string
+}
+
+func (s *paramCheckpointStore) Load() (progress.Checkpoint, error) {
+	var cp progress.Checkpoint
+	value, err := ecodb.Param(context.Background(), s.db, s.name)
+	if err != nil || value == "" {
+		return cp, err
+	}
+	err = json.Unmarshal([]byte(value), &cp)
+	return cp, err
+}
+
+func (s *paramCheckpointStore) Save(cp progress.Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return ecodb.SetParam(context.Background(), s.db, s.name, string(data))
+}
+
+// populateModuleFromProxy sets the latest version of mod and its time.
+// See [populateLatestVersion] for how it finds the latest version.
+func populateModuleFromProxy(ctx context.Context, db *sql.DB, mod *ecodb.Module) error {
+	if err := populateLatestVersion(ctx, db, mod); err != nil {
+		return err
 	}
 	if mod.LatestVersion != "" {
 		info, err := proxy.Info(ctx, mod.Path, mod.LatestVersion)
@@ -234,23 +470,51 @@ func populateModuleFromProxy(ctx context.Context, mod *ecodb.Module) error {
 		}
 		mod.InfoTime = info.Time
 	}
+	mod.Refreshed = time.Now().UTC().Format(time.RFC3339)
 	return nil
 }
 
-func isNotFound(err error) bool {
-	s := httputil.ErrorStatus(err)
-	return s == http.StatusNotFound || s == http.StatusGone
+// populateLatestVersion sets the latest version of mod, if it isn't set.
+// If the proxy lists no versions of the module, the latest version is the
+// latest one recorded by package untagged in db, if db isn't nil.
+// If the module has no versions at all, or the proxy doesn't know it,
+// populateLatestVersion records the error in mod and returns nil.
+func populateLatestVersion(ctx context.Context, db *sql.DB, mod *ecodb.Module) error {
+	if mod.LatestVersion != "" {
+		return nil
+	}
+	latestVersion, err := latestModuleVersion(ctx, mod.Path)
+	isUntagged := false
+	if errors.Is(err, errs.NoVersions) && db != nil {
+		known, kerr := untagged.Latest(ctx, db, mod.Path)
+		if kerr != nil {
+			return kerr
+		}
+		if known != "" {
+			latestVersion, err, isUntagged = known, nil, true
+		}
+	}
+	mod.Untagged = isUntagged
+	if err != nil {
+		if errors.Is(err, errs.NoVersions) || errors.Is(err, errs.NotFound) || errors.Is(err, errs.Gone) {
+			mod.SetError(err)
+			return nil
+		}
+		return err
+	}
+	mod.LatestVersion = latestVersion
+	return nil
 }
 
 func reportProgressWithProxy(i progress.Info) {
-	var qs string
+	var args []any
 	if q := proxy.QPS(); q > 0 {
-		qs = fmt.Sprintf(", proxy QPS = %.1f", q)
+		args = append(args, "proxyQPS", fmt.Sprintf("%.1f", q))
 	}
-	log.Printf("%s%s", i, qs)
+	slog.Info(i.String(), args...)
 }
 
 func (c *updateCmd) updateLatestVersions(ctx context.Context, db *sql.DB) error {
-	log.Printf("ulv")
+	slog.DebugContext(ctx, "ulv")
 	return nil
 }
@@ -3,10 +3,15 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 )
 
 // RunCommand runs the command with the given arguments in a new process.
@@ -17,32 +22,115 @@ func RunCommand(ctx context.Context, com string, args ...string) (out []byte, er
 }
 
 func RunCommandInDir(ctx context.Context, dir, com string, args ...string) (out []byte, err error) {
+	return RunCommandWith(ctx, RunOptions{Dir: dir}, com, args...)
+}
+
+// RunOptions configures [RunCommandWith].
+type RunOptions struct {
+	Dir     string        // working directory; if empty, the current directory
+	Env     []string      // "key=value" pairs added to the environment
+	Timeout time.Duration // if positive, the command is killed after this long
+
+	// If non-nil, the command's standard output and standard error are
+	// also written to these as the command runs.
+	Stdout, Stderr io.Writer
+}
+
+// maxFailureOutput is the maximum amount of output included in an error.
+const maxFailureOutput = 4 << 10
+
+// RunCommandWith is like [RunCommand], with options.
+// If the command fails, the error includes the end of its
+// combined standard output and standard error.
+func RunCommandWith(ctx context.Context, opts RunOptions, com string, args ...string) (out []byte, err error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
 	cmd := exec.CommandContext(ctx, com, args...)
-	if dir != "" {
-		cmd.Dir = dir
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
 	}
-	out, err = cmd.Output()
-	if err != nil {
+	// Don't wait forever for subprocesses that keep the output pipes open.
+	cmd.WaitDelay = time.Second
+
+	var stdout bytes.Buffer
+	combined := &lockedBuffer{}
+	cmd.Stdout = multiWriter(&stdout, combined, opts.Stdout)
+	cmd.Stderr = multiWriter(combined, opts.Stderr)
+	if err := cmd.Run(); err != nil {
 		cs := com + " " + strings.Join(args, " ")
-		return nil, fmt.Errorf("'%s' returned %s", cs, includeStderr(err))
+		if opts.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", opts.Timeout, err)
+		}
+		return nil, fmt.Errorf("'%s' returned %v: %s", cs, err, combined.tail(maxFailureOutput))
 	}
-	return out, nil
+	return stdout.Bytes(), nil
 }
 
-// includeStderr includes the stderr with an *exec.ExitError.
-// If err is not an *exec.ExitError, it returns err.Error().
-func includeStderr(err error) string {
-	var eerr *exec.ExitError
-	if errors.As(err, &eerr) {
-		return fmt.Sprintf("%v: %s", eerr, bytes.TrimSpace(eerr.Stderr))
+func multiWriter(ws ...io.Writer) io.Writer {
+	var nonNil []io.Writer
+	for _, w := range ws {
+		if w != nil {
+			nonNil = append(nonNil, w)
+		}
 	}
-	return err.Error()
+	return io.MultiWriter(nonNil...)
 }
 
+// A lockedBuffer is a bytes.Buffer that can be written concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// tail returns the last n bytes of b, trimmed of space.
+func (b *lockedBuffer) tail(n int) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := b.buf.Bytes()
+	if len(data) > n {
+		data = append([]byte("..."), data[len(data)-n:]...)
+	}
+	return bytes.TrimSpace(data)
+}
+
+// GoEnv returns the value of the go command's environment variable envvar,
+// or the empty string if it is unknown.
 func GoEnv(envvar string) (string, error) {
-	out, err := RunCommand(context.Background(), "go", "env", envvar)
+	env, err := goEnv()
 	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(string(out)), nil
+	return env[envvar], nil
 }
+
+// goEnv reads all the go command's environment variables once.
+var goEnv = sync.OnceValues(func() (map[string]string, error) {
+	out, err := RunCommand(context.Background(), "go", "env", "-json")
+	if err != nil {
+		return nil, err
+	}
+	var env map[string]string
+	if err := json.Unmarshal(out, &env); err != nil {
+		return nil, fmt.Errorf("go env -json: %w", err)
+	}
+	return env, nil
+})
+
+// GoModCache returns the value of GOMODCACHE.
+func GoModCache() (string, error) { return GoEnv("GOMODCACHE") }
+
+// GoPath returns the value of GOPATH.
+func GoPath() (string, error) { return GoEnv("GOPATH") }
+
+// GoToolchain returns the value of GOTOOLCHAIN.
+func GoToolchain() (string, error) { return GoEnv("GOTOOLCHAIN") }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommandWith(t *testing.T) {
+	ctx := context.Background()
+	var stdout bytes.Buffer
+	out, err := RunCommandWith(ctx, RunOptions{Env: []string{"GOFLAGS=-mod=mod"}, Stdout: &stdout}, "go", "env", "GOFLAGS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "-mod=mod" {
+		t.Errorf("got %q, want -mod=mod", got)
+	}
+	if !bytes.Equal(stdout.Bytes(), out) {
+		t.Errorf("streamed %q, returned %q", stdout.Bytes(), out)
+	}
+
+	_, err = RunCommandWith(ctx, RunOptions{}, "go", "nosuchcommand")
+	if err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("got %v, want error with output", err)
+	}
+
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+	start := time.Now()
+	_, err = RunCommandWith(ctx, RunOptions{Timeout: 100 * time.Millisecond}, "sleep", "10")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got %v, want timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %s", d)
+	}
+}
+
+func TestGoEnv(t *testing.T) {
+	out, err := RunCommand(context.Background(), "go", "env", "GOMODCACHE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := GoModCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSpace(string(out)); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if v, err := GoEnv("NOT_A_GO_VARIABLE"); err != nil || v != "" {
+		t.Errorf("got %q, %v; want empty", v, err)
+	}
+}
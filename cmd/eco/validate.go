@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jba/go-ecosystem/validate"
+)
+
+func init() {
+	top.Command("validate", &validateCmd{}, "cross-check the database, corpus, proxy cache and proxy, and print a repair plan")
+}
+
+type validateCmd struct {
+	Sample int  `cli:"flag=sample, number of modules to compare with the proxy (default 100; negative to skip the proxy)"`
+	Fix    bool `cli:"flag=fix, apply the repair plan"`
+}
+
+func (c *validateCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	sample := c.Sample
+	if sample == 0 {
+		sample = 100
+	}
+	v := &validate.Checker{
+		DB:        db,
+		CorpusDir: cfg().CorpusDir,
+		CacheDir:  cfg().CacheDir,
+		Sample:    sample,
+		Latest:    latestModuleVersion,
+		// Do the work of a download job. Enqueuing one wouldn't do,
+		// because the module's earlier job may be done.
+		Download: localJob(db, downloadJob),
+	}
+	plan, err := v.Check(ctx)
+	if err != nil {
+		return err
+	}
+	if len(plan.Problems) > 0 {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "LAYER\tSUBJECT\tISSUE\tREPAIR")
+		for _, p := range plan.Problems {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Layer, p.Subject, p.Issue, p.Repair)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d problems; compared %d modules with the proxy", len(plan.Problems), plan.Sampled)
+	if plan.Unchecked > 0 {
+		fmt.Printf(" (%d unchecked because of proxy errors)", plan.Unchecked)
+	}
+	fmt.Println()
+	if !c.Fix || len(plan.Problems) == 0 {
+		return nil
+	}
+	n, err := plan.Apply(ctx)
+	fmt.Printf("repaired %d of %d problems\n", n, len(plan.Problems))
+	return err
+}
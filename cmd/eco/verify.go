@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jba/go-ecosystem/modfs"
+	"github.com/jba/go-ecosystem/proxy"
+	"github.com/jba/go-ecosystem/sumdb"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	top.Command("verify", &verifyCmd{}, "check module zips and go.mod files against the checksum database")
+}
+
+type verifyCmd struct {
+	Modules []string `cli:"name=MODULE@VERSION, modules to download from the proxy and verify; default all zips in the zip directory"`
+}
+
+func (c *verifyCmd) Run(ctx context.Context) error {
+	var nOK, nBad int
+	report := func(mv module.Version, err error) error {
+		switch {
+		case err == nil:
+			nOK++
+		case errors.Is(err, sumdb.ErrMismatch):
+			nBad++
+			fmt.Printf("%s: %v\n", mv, err)
+		default:
+			return err
+		}
+		return nil
+	}
+	if len(c.Modules) > 0 {
+		for _, arg := range c.Modules {
+			path, version, ok := strings.Cut(arg, "@")
+			if !ok {
+				return fmt.Errorf("%q: want MODULE@VERSION", arg)
+			}
+			if err := report(module.Version{Path: path, Version: version}, verifyFromProxy(ctx, path, version)); err != nil {
+				return err
+			}
+		}
+	} else {
+		dir := cfg().ZipDir
+		if dir == "" {
+			return errors.New("no modules given and no zip directory configured")
+		}
+		for mv, file := range modfs.ZipFiles(dir) {
+			if stopping(ctx) {
+				break
+			}
+			zr, err := zip.OpenReader(file)
+			if err != nil {
+				return err
+			}
+			err = sumdb.VerifyZip(ctx, mv.Path, mv.Version, &zr.Reader)
+			zr.Close()
+			if err := report(mv, err); err != nil {
+				return err
+			}
+		}
+	}
+	slog.InfoContext(ctx, "verified", "ok", nOK, "mismatched", nBad)
+	if nBad > 0 {
+		return fmt.Errorf("%d modules do not match the checksum database", nBad)
+	}
+	return nil
+}
+
+func verifyFromProxy(ctx context.Context, path, version string) error {
+	if _, err := proxy.VerifyMod(ctx, path, version); err != nil {
+		return err
+	}
+	_, err := proxy.VerifyZip(ctx, path, version)
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/notify"
+	"github.com/jba/go-ecosystem/vulndb"
+)
+
+func init() {
+	vuln := top.Command("vuln", &vulnCmd{}, "vulnerabilities from the Go vulnerability database")
+	vuln.Command("sync", &vulnSyncCmd{}, "download new and changed advisories")
+	vuln.Command("check", &vulnCheckCmd{}, "list modules whose latest versions have advisories")
+}
+
+type vulnCmd struct{}
+
+type vulnSyncCmd struct{}
+
+func (c *vulnSyncCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	s, err := vulndb.Sync(ctx, db)
+	if s != nil {
+		slog.InfoContext(ctx, "synced vulndb", "modified", s.Modified, "fetched", s.Fetched, "unchanged", s.Unchanged)
+		if len(s.IDs) > 0 && notifier().Wants(notify.VulnAffects) {
+			err = errors.Join(err, notifyVulns(ctx, db, s.IDs))
+		}
+	}
+	return err
+}
+
+// maxEventModules is the maximum number of module paths in an event.
+const maxEventModules = 20
+
+// notifyVulns sends a VulnAffects event for each of the advisories with the
+// given IDs that affects the latest version of a module.
+func notifyVulns(ctx context.Context, db *sql.DB, ids []string) error {
+	m, err := vulndb.NewMatcher(ctx, db)
+	if err != nil {
+		return err
+	}
+	affected := map[string][]string{} // from ID to module paths
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{})
+	for mod := range mods {
+		if mod.LatestVersion == "" {
+			continue
+		}
+		for _, id := range m.Match(mod.Path, mod.LatestVersion) {
+			if slices.Contains(ids, id) {
+				affected[id] = append(affected[id], mod.Path)
+			}
+		}
+	}
+	if err := errf(); err != nil {
+		return err
+	}
+	for _, id := range slices.Sorted(maps.Keys(affected)) {
+		paths := affected[id]
+		slices.Sort(paths)
+		sendEvent(ctx, &notify.Event{
+			Kind:  notify.VulnAffects,
+			Text:  fmt.Sprintf("%s affects the latest versions of %d modules", id, len(paths)),
+			Vuln:  id,
+			Count: len(paths),
+			Data:  map[string]any{"modules": paths[:min(len(paths), maxEventModules)]},
+		})
+	}
+	return nil
+}
+
+type vulnCheckCmd struct {
+	Prefix string `cli:"flag=prefix, only modules whose paths begin with this prefix"`
+}
+
+func (c *vulnCheckCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	m, err := vulndb.NewMatcher(ctx, db)
+	if err != nil {
+		return err
+	}
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+	for mod := range mods {
+		if mod.LatestVersion == "" {
+			continue
+		}
+		if ids := m.Match(mod.Path, mod.LatestVersion); len(ids) > 0 {
+			fmt.Printf("%s@%s %s\n", mod.Path, mod.LatestVersion, strings.Join(ids, " "))
+		}
+	}
+	return errf()
+}
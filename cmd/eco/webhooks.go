@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"sync"
+
+	"github.com/jba/go-ecosystem/notify"
+)
+
+func init() {
+	w := top.Command("webhooks", &webhooksCmd{}, "webhook notifications of events (see ECO_WEBHOOKS)")
+	w.Command("test", &webhooksTestCmd{}, "send a test update-done event to the webhooks")
+}
+
+type webhooksCmd struct{}
+
+type webhooksTestCmd struct{}
+
+func (c *webhooksTestCmd) Run(ctx context.Context) error {
+	n := notifier()
+	if n == nil {
+		return errors.New("no webhooks configured")
+	}
+	return n.Notify(ctx, &notify.Event{Kind: notify.UpdateDone, Text: "test event from eco"})
+}
+
+// notifier returns the notifier for the configured webhooks,
+// or nil if there are none.
+var notifier = sync.OnceValue(func() *notify.Notifier {
+	file := cfg().Webhooks
+	if file == "" {
+		return nil
+	}
+	n, err := notify.Load(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return n
+})
+
+// sendEvent sends e to the configured webhooks. Failures are logged,
+// so they don't stop the work that produced the event.
+func sendEvent(ctx context.Context, e *notify.Event) {
+	if err := notifier().Notify(ctx, e); err != nil {
+		slog.WarnContext(ctx, "webhook failed", "err", err)
+	}
+}
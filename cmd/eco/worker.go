@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/tasks"
+)
+
+func init() {
+	top.Command("worker", &workerCmd{}, "run jobs leased from a coordinator running 'eco serve'; KIND is download or analyze")
+}
+
+type workerCmd struct {
+	Coordinator string        `cli:"flag=coordinator, URL of the coordinator"`
+	Token       string        `cli:"flag=token, token to present to the coordinator (default $ECO_WORKER_TOKEN)"`
+	Worker      string        `cli:"flag=worker, name of this worker (default host:pid)"`
+	Lease       time.Duration `cli:"flag=lease, how long a job is leased before another worker may claim it (default 5m)"`
+	Wait        time.Duration `cli:"flag=wait, when no jobs are ready, wait this long and ask again; zero means exit"`
+	Kind        string        `cli:"name=KIND, kind of job"`
+}
+
+func (c *workerCmd) Run(ctx context.Context) error {
+	if err := checkJobKind(c.Kind); err != nil {
+		return err
+	}
+	if c.Coordinator == "" {
+		return errors.New("missing -coordinator")
+	}
+	if c.Token == "" {
+		c.Token = os.Getenv("ECO_WORKER_TOKEN")
+	}
+	if c.Worker == "" {
+		host, _ := os.Hostname()
+		c.Worker = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	client := &tasks.Client{URL: strings.TrimSuffix(c.Coordinator, "/") + "/jobs", Token: c.Token}
+	work := remoteJob(c.Kind)
+	for {
+		s, err := client.Work(ctx, c.Kind, tasks.WorkOptions{
+			Worker:      c.Worker,
+			Concurrency: cfg().Concurrency,
+			Lease:       c.Lease,
+			Stop:        stopRequested(ctx),
+		}, func(ctx context.Context, j *tasks.Job) ([]byte, error) {
+			mv, err := jobModule(j)
+			if err != nil {
+				return nil, err
+			}
+			return work(ctx, mv)
+		})
+		if s != nil {
+			slog.InfoContext(ctx, "worked", "kind", c.Kind, "done", s.Done, "retried", s.Retried, "failed", s.Failed)
+			if s.Errors.Len() > 0 {
+				slog.WarnContext(ctx, "job failures", "summary", s.Errors.Summary())
+			}
+		}
+		if err != nil || c.Wait <= 0 || stopping(ctx) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-stopRequested(ctx):
+			return nil
+		case <-time.After(c.Wait):
+		}
+	}
+}
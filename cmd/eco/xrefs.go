@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/pool"
+	"github.com/jba/go-ecosystem/workspace"
+	"github.com/jba/go-ecosystem/xrefs"
+	"golang.org/x/mod/module"
+)
+
+func init() {
+	x := top.Command("xrefs", &xrefsCmd{}, "cross-references between modules")
+	x.Command("index", &xrefsIndexCmd{}, "record the symbols used by corpus modules")
+	x.Command("users", &xrefsUsersCmd{}, "list the modules that use a symbol")
+	x.Command("popular", &xrefsPopularCmd{}, "list the symbols of a package by the number of modules that use them")
+}
+
+type xrefsCmd struct{}
+
+type xrefsIndexCmd struct {
+	Prefix string `cli:"flag=prefix, only modules whose paths begin with this prefix"`
+}
+
+func (c *xrefsIndexCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	opts := workspace.Options{CorpusDir: cfg().CorpusDir, Deps: true}
+	mods, errf := ecodb.ListModules(ctx, db, ecodb.ModuleFilter{Prefix: c.Prefix})
+	var (
+		mu sync.Mutex // guards n and database writes
+		n  int
+	)
+	p := &pool.Pool[module.Version]{Concurrency: cfg().Concurrency, Policy: pool.Collect}
+	err := p.Run(ctx, corpusModules(ctx, mods), func(ctx context.Context, mv module.Version) error {
+		counts, pkgErrs, err := xrefs.Module(ctx, opts, mv.Path, mv.Version)
+		if err != nil {
+			return err
+		}
+		for _, err := range pkgErrs {
+			slog.DebugContext(ctx, "type-checking failed", "module", mv.String(), "err", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := xrefs.Write(ctx, db, mv.Path, mv.Version, counts); err != nil {
+			return pool.Fatal(err)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	failures := p.Errors()
+	slog.InfoContext(ctx, "indexed cross-references", "modules", n, "failures", failures.Len())
+	if failures.Len() > 0 {
+		slog.WarnContext(ctx, "xrefs failures", "summary", failures.Summary())
+	}
+	return errf()
+}
+
+type xrefsUsersCmd struct {
+	Package string `cli:"name=PACKAGE, import path"`
+	Symbol  string `cli:"name=SYMBOL, name, or Type.Method for methods and fields"`
+}
+
+func (c *xrefsUsersCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	ref := xrefs.Ref{Package: c.Package, Name: c.Symbol}
+	if recv, name, ok := strings.Cut(c.Symbol, "."); ok {
+		ref.Receiver, ref.Name = recv, name
+	}
+	seq, errf := xrefs.Users(ctx, db, ref)
+	for u := range seq {
+		fmt.Printf("%6d %s@%s\n", u.Count, u.ModulePath, u.Version)
+	}
+	return errf()
+}
+
+type xrefsPopularCmd struct {
+	Package string `cli:"name=PACKAGE, import path"`
+}
+
+func (c *xrefsPopularCmd) Run(ctx context.Context) error {
+	db := openDB()
+	defer db.Close()
+	seq, errf := xrefs.Popular(ctx, db, c.Package)
+	for p := range seq {
+		name := p.Name
+		if p.Receiver != "" {
+			name = p.Receiver + "." + name
+		}
+		fmt.Printf("%6d modules %8d uses  %s\n", p.Modules, p.Count, name)
+	}
+	return errf()
+}
@@ -4,33 +4,72 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/modfs"
 	"github.com/jba/go-ecosystem/proxy"
-	"golang.org/x/mod/module"
 )
 
 func saveZip(ctx context.Context, mpath, version, cacheDir, destDir string) (err error) {
 	defer errs.Wrap(&err, "saveZip(%s, %s)", mpath, version)
 
-	zipFilePath, err := moduleFilePath(destDir, mpath, version)
+	zipFilePath, err := modfs.ZipPath(destDir, mpath, version)
 	if err != nil {
 		return err
 	}
 
 	// If output file already exists, do nothing.
 	if _, err := os.Stat(zipFilePath); err == nil {
-		log.Printf("%s@%s: already exists at %s", mpath, version, zipFilePath)
+		slog.InfoContext(ctx, "zip already exists", "module", mpath, "version", version, "file", zipFilePath)
 		return nil
 	}
 
+	data, prov, err := trimmedZip(ctx, mpath, version, cacheDir)
+	if err != nil {
+		return err
+	}
+	if err := writeCorpusZip(destDir, mpath, version, data); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "saved zip", "module", mpath, "version", version, "from", prov, "file", zipFilePath)
+	return nil
+}
+
+// trimmedZip returns the contents of the zip for the given module,
+// trimmed as described in [trimZip], and where it came from.
+// See [getZip] for where it looks.
+func trimmedZip(ctx context.Context, mpath, version, cacheDir string) (_ []byte, provenance string, err error) {
+	zf, prov, err := getZip(ctx, mpath, version, cacheDir)
+	if err != nil {
+		return nil, "", err
+	}
+	defer zf.Close()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := trimZip(zw, &zf.Reader); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), prov, nil
+}
+
+// writeCorpusZip writes data as the zip for the given module in destDir,
+// removing the module's other zips.
+func writeCorpusZip(destDir, mpath, version string, data []byte) error {
+	zipFilePath, err := modfs.ZipPath(destDir, mpath, version)
+	if err != nil {
+		return err
+	}
 	// Remove any other files in the output directory (other versions).
 	outDir := filepath.Dir(zipFilePath)
 	if entries, err := os.ReadDir(outDir); err == nil {
@@ -40,102 +79,125 @@ func saveZip(ctx context.Context, mpath, version, cacheDir, destDir string) (err
 			}
 		}
 	}
-
-	zr, prov, err := getZip(ctx, mpath, version, cacheDir)
-	if err != nil {
-		return err
-	}
-
 	if err := os.MkdirAll(outDir, 0o755); err != nil {
 		return err
 	}
-	f, err := os.Create(zipFilePath)
+	// Write to a temporary file and rename it, so that an interrupted
+	// download doesn't leave a partial zip that looks complete.
+	f, err := os.CreateTemp(outDir, filepath.Base(zipFilePath)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer errs.Cleanup(&err, f.Close)
-	zw := zip.NewWriter(f)
-	if err := trimZip(zw, zr); err != nil {
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
 		return err
 	}
-	if err := zw.Close(); err != nil {
+	if err := f.Close(); err != nil {
 		return err
 	}
-	log.Printf("%s@%s: from %s to %s", mpath, version, prov, zipFilePath)
-	return nil
+	return os.Rename(f.Name(), zipFilePath)
 }
 
-// getZip obtains the zip file for the given module.
+// getZip opens the zip file for the given module.
 // It will check the local module cache first.
 // If it doesn't find it there, it will check cacheDir if it is not empty.
-// Lastly, it will download it from the proxy, and write it to a non-empty cacheDir.
-func getZip(ctx context.Context, mpath, version string, cacheDir string) (_ *zip.Reader, provenance string, err error) {
-	modCache, err := GoEnv("GOMODCACHE")
+// Lastly, it will download it from the proxy to a non-empty cacheDir,
+// or else to a temporary file that is removed when the zip is closed.
+func getZip(ctx context.Context, mpath, version string, cacheDir string) (_ *zipFile, provenance string, err error) {
+	modCache, err := GoModCache()
 	if err != nil {
 		return nil, "", err
 	}
 	modCacheZipDir := filepath.Join(modCache, "cache", "download")
-	if zr, err := openModuleZip(modCacheZipDir, mpath, version); err == nil {
-		return zr, modCacheZipDir, nil
+	if zf, err := openModuleZip(modCacheZipDir, mpath, version); err == nil {
+		return zf, modCacheZipDir, nil
 	}
+	var file string
 	if cacheDir != "" {
 		if info, err := os.Stat(cacheDir); err != nil || !info.IsDir() {
 			return nil, "", fmt.Errorf("%s does not exist or is not a directory", cacheDir)
 		}
-		if zr, err := openModuleZip(cacheDir, mpath, version); err == nil {
-			return zr, cacheDir, nil
+		if zf, err := openModuleZip(cacheDir, mpath, version); err == nil {
+			return zf, cacheDir, nil
+		}
+		file, err = modfs.ZipPath(cacheDir, mpath, version)
+		if err != nil {
+			return nil, "", err
 		}
 	}
-	data, err := proxy.ZipData(ctx, mpath, version)
+	tmp, err := downloadZip(ctx, mpath, version, file)
 	if err != nil {
 		return nil, "", err
 	}
-	if cacheDir != "" {
-		mpath, err := moduleFilePath(cacheDir, mpath, version)
-		if err != nil {
-			return nil, "", err
-		}
-		if err := os.MkdirAll(filepath.Dir(mpath), 0o755); err != nil {
-			return nil, "", err
-		}
-		if err := os.WriteFile(mpath, data, 0o644); err != nil {
-			return nil, "", err
-		}
+	if file == "" {
+		file = tmp
 	}
-	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	rc, err := zip.OpenReader(file)
 	if err != nil {
+		os.Remove(tmp)
 		return nil, "", err
 	}
-	return zr, "proxy", nil
+	return &zipFile{rc, tmp}, "proxy", nil
 }
 
-func openModuleZip(dir string, mpath, version string) (*zip.Reader, error) {
-	mpath, err := moduleFilePath(dir, mpath, version)
-	if err != nil {
-		return nil, err
+// downloadZip streams the zip for the given module from the proxy to file,
+// or if file is empty, to a temporary file whose name it returns.
+func downloadZip(ctx context.Context, mpath, version, file string) (tmp string, err error) {
+	dir := os.TempDir()
+	if file != "" {
+		dir = filepath.Dir(file)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
 	}
-	f, err := os.Open(mpath)
+	f, err := os.CreateTemp(dir, "zip-*.tmp")
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	_, err = proxy.ZipTo(ctx, mpath, version, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	defer f.Close()
-	data, err := io.ReadAll(f)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if file == "" {
+		return f.Name(), nil
+	}
+	return "", os.Rename(f.Name(), file)
+}
+
+// A zipFile is an open zip file. If tmp is not empty, it is the name of the
+// file, which is removed when the zipFile is closed.
+type zipFile struct {
+	*zip.ReadCloser
+	tmp string
+}
+
+func (z *zipFile) Close() error {
+	err := z.ReadCloser.Close()
+	if z.tmp != "" {
+		err = errors.Join(err, os.Remove(z.tmp))
 	}
-	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	return err
 }
 
-func moduleFilePath(dir string, mpath, version string) (string, error) {
-	epath, err := module.EscapePath(mpath)
+func openModuleZip(dir string, mpath, version string) (*zipFile, error) {
+	mpath, err := modfs.ZipPath(dir, mpath, version)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	eversion, err := module.EscapeVersion(version)
+	rc, err := zip.OpenReader(mpath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return filepath.Join(dir, epath, "@v", eversion+".zip"), nil
+	return &zipFile{ReadCloser: rc}, nil
 }
 
 // trimZip copies into zw only the Go source files
@@ -165,8 +227,14 @@ func copyZipFile(zw *zip.Writer, f *zip.File) error {
 		return err
 	}
 	defer src.Close()
-	_, err = io.Copy(dst, src)
-	return err
+	r := errs.NewReader(src)
+	if _, err := io.Copy(dst, r); err != nil {
+		if r.Err() != nil {
+			return fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		return fmt.Errorf("writing %s: %w", f.Name, err)
+	}
+	return nil
 }
 
 // isSourceName reports whether name is a pathname that refers
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"slices"
 	"testing"
+
+	"github.com/jba/go-ecosystem/modfs"
 )
 
 func TestSaveZip(t *testing.T) {
@@ -18,7 +20,7 @@ func TestSaveZip(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	zipPath, err := moduleFilePath(destDir, mpath, version)
+	zipPath, err := modfs.ZipPath(destDir, mpath, version)
 	if err != nil {
 		t.Fatal(err)
 	}
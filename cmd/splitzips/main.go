@@ -9,6 +9,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/jba/go-ecosystem/internal/errs"
 )
 
 func main() {
@@ -123,6 +125,12 @@ func copyToZip(w *zip.Writer, file *zip.File) error {
 	}
 	defer src.Close()
 
-	_, err = io.Copy(dst, src)
-	return err
+	r := errs.NewReader(src)
+	if _, err := io.Copy(dst, r); err != nil {
+		if r.Err() != nil {
+			return fmt.Errorf("reading %s: %w", file.Name, err)
+		}
+		return fmt.Errorf("writing %s: %w", file.Name, err)
+	}
+	return nil
 }
@@ -0,0 +1,149 @@
+package depgraph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"golang.org/x/mod/module"
+	_ "modernc.org/sqlite"
+)
+
+func testGraph() *Graph {
+	g := &Graph{}
+	for _, e := range [][2]string{{"a", "c"}, {"b", "c"}, {"c", "d"}, {"a", "d"}, {"a", "c"}, {"d", "d"}} {
+		g.AddEdge(e[0], e[1])
+	}
+	return g
+}
+
+func TestScores(t *testing.T) {
+	g := testGraph()
+	if want := []string{"a", "c", "b", "d"}; !slices.Equal(g.Nodes, want) {
+		t.Fatalf("nodes: got %v, want %v", g.Nodes, want)
+	}
+	if got, want := g.InDegree(), []int{0, 2, 0, 2}; !slices.Equal(got, want) {
+		t.Errorf("InDegree: got %v, want %v", got, want)
+	}
+	// Only b->c->d passes through another node; a reaches d directly.
+	if got, want := g.Betweenness(0, nil), []float64{0, 1, 0, 0}; !slices.Equal(got, want) {
+		t.Errorf("Betweenness: got %v, want %v", got, want)
+	}
+	if got := g.Betweenness(4, rand.New(rand.NewPCG(1, 1))); !slices.Equal(got, []float64{0, 1, 0, 0}) {
+		t.Errorf("Betweenness with all samples: got %v", got)
+	}
+	pr := g.PageRank(0.85, 1e-12, 100)
+	sum := 0.0
+	for _, r := range pr {
+		sum += r
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("PageRank sums to %g", sum)
+	}
+	if !(pr[3] > pr[1] && pr[1] > pr[0] && pr[0] == pr[2]) {
+		t.Errorf("PageRank: got %v, want d > c > a = b", pr)
+	}
+}
+
+func TestBetweennessSplit(t *testing.T) {
+	// Two shortest paths from s to t share the credit.
+	g := &Graph{}
+	for _, e := range [][2]string{{"s", "x"}, {"s", "y"}, {"x", "t"}, {"y", "t"}} {
+		g.AddEdge(e[0], e[1])
+	}
+	if got, want := g.Betweenness(0, nil), []float64{0, 0.5, 0.5, 0}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLoaderAndCompute(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	gomods := map[string]string{
+		"a@v1.0.0": "module a\nrequire (\n\tc v1.0.0\n\td v1.1.0 // indirect\n)\n",
+		"b@v1.0.0": "module b\nrequire c v1.0.0\n",
+		"c@v1.0.0": "module c\nrequire d v1.0.0\n",
+		"d@v1.1.0": "module d\n",
+		"e@v1.0.0": "bad go.mod",
+	}
+	fetches := 0
+	l := &Loader{DB: db, Fetch: func(_ context.Context, path, version string) ([]byte, error) {
+		fetches++
+		s, ok := gomods[path+"@"+version]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return []byte(s), nil
+	}}
+	for mv := range gomods {
+		path, version, _ := strings.Cut(mv, "@")
+		if _, err := db.ExecContext(ctx, "INSERT INTO modules (path, error, latest_version, info_time) VALUES (?, '', ?, '')", path, version); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Requirements(ctx, module.Version{Path: path, Version: version}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A new loader reads from the database.
+	l2 := &Loader{DB: db, Fetch: l.Fetch}
+	rs, err := l2.Requirements(ctx, module.Version{Path: "a", Version: "v1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Requirement{{"c", "v1.0.0", false}, {"d", "v1.1.0", true}}; !slices.Equal(rs, want) {
+		t.Errorf("got %v, want %v", rs, want)
+	}
+	if _, err := l2.Requirements(ctx, module.Version{Path: "e", Version: "v1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != len(gomods) {
+		t.Errorf("got %d fetches, want %d", fetches, len(gomods))
+	}
+
+	n, err := Compute(ctx, db, ComputeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("scored %d modules, want 4", n)
+	}
+	seq, errf := Top(ctx, db, ByInDegree, 2)
+	var got []string
+	for s := range seq {
+		got = append(got, fmt.Sprintf("%s %d %g", s.ModulePath, s.InDegree, s.Betweenness))
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c 2 1", "d 2 0"}; !slices.Equal(got, want) {
+		t.Errorf("Top: got %q, want %q", got, want)
+	}
+	if _, errf := Top(ctx, db, "bad", 0); errf() == nil {
+		t.Error("Top with a bad order succeeded")
+	}
+}
@@ -0,0 +1,282 @@
+package depgraph
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// A Graph is a directed graph of modules, with an edge from each module to
+// the modules it requires.
+type Graph struct {
+	Nodes []string  // module paths
+	Out   [][]int32 // Out[i] holds the indexes of the modules that Nodes[i] requires
+
+	index map[string]int32
+}
+
+// Node returns the index of the module with the given path, adding it
+// if necessary.
+func (g *Graph) Node(path string) int32 {
+	if i, ok := g.index[path]; ok {
+		return i
+	}
+	if g.index == nil {
+		g.index = map[string]int32{}
+	}
+	i := int32(len(g.Nodes))
+	g.index[path] = i
+	g.Nodes = append(g.Nodes, path)
+	g.Out = append(g.Out, nil)
+	return i
+}
+
+// AddEdge adds an edge from one module to another. Self-edges and
+// duplicate edges are ignored.
+func (g *Graph) AddEdge(from, to string) {
+	f, t := g.Node(from), g.Node(to)
+	if f == t {
+		return
+	}
+	for _, o := range g.Out[f] {
+		if o == t {
+			return
+		}
+	}
+	g.Out[f] = append(g.Out[f], t)
+}
+
+// LoadGraph returns the graph formed by the stored requirements of the latest
+// versions of the modules in the modules table. Requirements of modules'
+// other versions are ignored.
+func LoadGraph(ctx context.Context, db *sql.DB) (_ *Graph, err error) {
+	defer errs.Wrap(&err, "depgraph.LoadGraph")
+	g := &Graph{}
+	type row struct{ ModulePath, ReqPath string }
+	seq, errf := database.ScanRowsAs[row](ctx, db, `
+		SELECT r.module_path, r.req_path FROM requirements r
+		JOIN modules m ON m.path = r.module_path AND m.latest_version = r.version
+		ORDER BY r.module_path, r.req_path`)
+	for r := range seq {
+		g.AddEdge(r.ModulePath, r.ReqPath)
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// InDegree returns the number of modules that require each module.
+func (g *Graph) InDegree() []int {
+	deg := make([]int, len(g.Nodes))
+	for _, out := range g.Out {
+		for _, t := range out {
+			deg[t]++
+		}
+	}
+	return deg
+}
+
+// PageRank returns the PageRank of each module, with the given damping
+// factor, iterating until the scores change by less than tol in total, or
+// maxIter times. Modules with no requirements distribute their rank evenly
+// over all modules. The scores sum to 1.
+func (g *Graph) PageRank(damping, tol float64, maxIter int) []float64 {
+	n := len(g.Nodes)
+	if n == 0 {
+		return nil
+	}
+	rank := make([]float64, n)
+	next := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for range maxIter {
+		dangling := 0.0
+		for i, out := range g.Out {
+			if len(out) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, out := range g.Out {
+			if len(out) == 0 {
+				continue
+			}
+			share := damping * rank[i] / float64(len(out))
+			for _, t := range out {
+				next[t] += share
+			}
+		}
+		diff := 0.0
+		for i := range rank {
+			diff += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if diff < tol {
+			break
+		}
+	}
+	return rank
+}
+
+// Betweenness returns the betweenness centrality of each module: the number
+// of shortest paths between other modules that pass through it, with each
+// path weighted by the inverse of the number of shortest paths between its
+// endpoints.
+//
+// The exact computation takes time proportional to the number of modules
+// times the number of edges. If samples is positive and less than the number
+// of modules, only shortest paths from that many randomly chosen modules are
+// counted, and the results are scaled to estimate the exact values.
+func (g *Graph) Betweenness(samples int, r *rand.Rand) []float64 {
+	n := len(g.Nodes)
+	bc := make([]float64, n)
+	sources := make([]int32, n)
+	for i := range sources {
+		sources[i] = int32(i)
+	}
+	scale := 1.0
+	if samples > 0 && samples < n {
+		r.Shuffle(n, func(i, j int) { sources[i], sources[j] = sources[j], sources[i] })
+		sources = sources[:samples]
+		scale = float64(n) / float64(samples)
+	}
+	// Brandes' algorithm, for unweighted graphs.
+	var (
+		dist  = make([]int32, n)
+		sigma = make([]float64, n)
+		delta = make([]float64, n)
+		order = make([]int32, 0, n) // nodes in order of discovery
+	)
+	for i := range dist {
+		dist[i] = -1
+	}
+	for _, s := range sources {
+		order = order[:0]
+		dist[s], sigma[s] = 0, 1
+		order = append(order, s)
+		for q := 0; q < len(order); q++ {
+			v := order[q]
+			for _, w := range g.Out[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					order = append(order, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+				}
+			}
+		}
+		// Accumulate dependencies from the farthest nodes back.
+		for q := len(order) - 1; q >= 0; q-- {
+			v := order[q]
+			for _, w := range g.Out[v] {
+				if dist[w] == dist[v]+1 {
+					delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+				}
+			}
+			if v != s {
+				bc[v] += delta[v] * scale
+			}
+		}
+		for _, v := range order {
+			dist[v], sigma[v], delta[v] = -1, 0, 0
+		}
+	}
+	return bc
+}
+
+// A Score is the centrality of a module.
+type Score struct {
+	ModulePath  string
+	InDegree    int
+	PageRank    float64
+	Betweenness float64
+	Computed    string
+}
+
+// ComputeOptions configure [Compute].
+type ComputeOptions struct {
+	// Samples is the number of modules to sample for betweenness;
+	// see [Graph.Betweenness]. Zero means an exact computation.
+	Samples int
+	// Seed seeds the sampling.
+	Seed uint64
+}
+
+// Compute computes the scores of the modules in the graph returned by
+// [LoadGraph] and replaces the contents of the centrality table with them.
+// It returns the number of modules scored.
+func Compute(ctx context.Context, db *sql.DB, opts ComputeOptions) (_ int, err error) {
+	defer errs.Wrap(&err, "depgraph.Compute")
+	g, err := LoadGraph(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	deg := g.InDegree()
+	pr := g.PageRank(0.85, 1e-10, 100)
+	bc := g.Betweenness(opts.Samples, rand.New(rand.NewPCG(opts.Seed, opts.Seed)))
+	computed := time.Now().UTC().Format(time.RFC3339)
+	err = database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM centrality"); err != nil {
+			return err
+		}
+		rows := func(yield func([]any) bool) {
+			for i, p := range g.Nodes {
+				if !yield([]any{p, deg[i], pr[i], bc[i], computed}) {
+					return
+				}
+			}
+		}
+		_, err := database.BulkInsert(ctx, tx, "centrality", scoreCols, rows, 500)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(g.Nodes), nil
+}
+
+var scoreCols = []string{"module_path", "in_degree", "page_rank", "betweenness", "computed"}
+
+// Orders for [Top].
+const (
+	ByPageRank    = "page_rank"
+	ByInDegree    = "in_degree"
+	ByBetweenness = "betweenness"
+)
+
+// Top returns the stored scores in decreasing order of the column named by
+// by, one of ByPageRank, ByInDegree and ByBetweenness. If limit is positive,
+// at most limit scores are returned.
+func Top(ctx context.Context, db *sql.DB, by string, limit int) (iter.Seq[*Score], func() error) {
+	switch by {
+	case ByPageRank, ByInDegree, ByBetweenness:
+	default:
+		return func(func(*Score) bool) {}, func() error { return fmt.Errorf("depgraph: unknown order %q", by) }
+	}
+	query, args := database.Select("centrality", scoreCols...).OrderBy(by+" DESC", "module_path").Limit(limit).SQL()
+	return database.ScanRowsAs[Score](ctx, db, query, args...)
+}
+
+// ForModule returns the stored score of a module, or nil if it has none.
+func ForModule(ctx context.Context, db *sql.DB, modulePath string) (*Score, error) {
+	query, args := database.Select("centrality", scoreCols...).Where("module_path = ?", modulePath).SQL()
+	seq, errf := database.ScanRowsAs[Score](ctx, db, query, args...)
+	var s *Score
+	for r := range seq {
+		s = r
+	}
+	return s, errf()
+}
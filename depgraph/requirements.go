@@ -0,0 +1,146 @@
+// Package depgraph holds the module dependency graph, formed by the
+// requirements of go.mod files, and computes scores of modules' importance
+// in it.
+package depgraph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/proxy"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// A Requirement is a require directive of a go.mod file.
+type Requirement struct {
+	Path     string
+	Version  string
+	Indirect bool
+}
+
+// A Loader returns the requirements of module versions, reading go.mod
+// files from the database, or fetching them and storing their requirements
+// if they are not there. It is not safe for concurrent use.
+type Loader struct {
+	DB *sql.DB
+	// Fetch returns the go.mod file of a module version. If nil, [proxy.Mod]
+	// is used.
+	Fetch func(ctx context.Context, path, version string) ([]byte, error)
+
+	cache map[module.Version][]Requirement
+}
+
+// Requirements returns the requirements of mv. A go.mod file that cannot
+// be fetched or parsed, other than for a temporary reason, has no
+// requirements; the error is recorded in the go_mods table.
+func (l *Loader) Requirements(ctx context.Context, mv module.Version) (_ []Requirement, err error) {
+	defer errs.Wrap(&err, "depgraph.Requirements(%s)", mv)
+	if rs, ok := l.cache[mv]; ok {
+		return rs, nil
+	}
+	rs, ok, err := stored(ctx, l.DB, mv)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		fetch := l.Fetch
+		if fetch == nil {
+			fetch = proxy.Mod
+		}
+		var msg string
+		data, err := fetch(ctx, mv.Path, mv.Version)
+		if err == nil {
+			rs, err = Parse(mv, data)
+		}
+		if err != nil {
+			if errors.Is(err, errs.Temporary) || ctx.Err() != nil {
+				return nil, err
+			}
+			msg = err.Error()
+		}
+		if err := Store(ctx, l.DB, mv, rs, msg); err != nil {
+			return nil, err
+		}
+	}
+	if l.cache == nil {
+		l.cache = map[module.Version][]Requirement{}
+	}
+	l.cache[mv] = rs
+	return rs, nil
+}
+
+// Parse returns the requirements of the go.mod file of mv.
+func Parse(mv module.Version, data []byte) ([]Requirement, error) {
+	mf, err := modfile.ParseLax(mv.Path+"@"+mv.Version+"/go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	var rs []Requirement
+	for _, r := range mf.Require {
+		rs = append(rs, Requirement{Path: r.Mod.Path, Version: r.Mod.Version, Indirect: r.Indirect})
+	}
+	return rs, nil
+}
+
+// stored returns the stored requirements of mv, and reports whether
+// they have been loaded.
+func stored(ctx context.Context, db *sql.DB, mv module.Version) ([]Requirement, bool, error) {
+	if ok, err := Loaded(ctx, db, mv); err != nil || !ok {
+		return nil, false, err
+	}
+	type row struct {
+		ReqPath, ReqVersion string
+		Indirect            bool
+	}
+	seq, errf := database.ScanRowsAs[row](ctx, db, `
+		SELECT req_path, req_version, indirect FROM requirements
+		WHERE module_path = ? AND version = ?
+		ORDER BY req_path`, mv.Path, mv.Version)
+	var rs []Requirement
+	for r := range seq {
+		rs = append(rs, Requirement{Path: r.ReqPath, Version: r.ReqVersion, Indirect: r.Indirect})
+	}
+	if err := errf(); err != nil {
+		return nil, false, err
+	}
+	return rs, true, nil
+}
+
+// Store replaces the stored requirements of mv. If msg is not empty,
+// it describes why the go.mod file couldn't be read.
+func Store(ctx context.Context, db *sql.DB, mv module.Version, rs []Requirement, msg string) error {
+	return database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		_, err := database.Upsert(ctx, tx, "go_mods", []string{"module_path", "version"},
+			[]string{"module_path", "version", "error", "loaded"},
+			mv.Path, mv.Version, msg, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM requirements WHERE module_path = ? AND version = ?", mv.Path, mv.Version)
+		if err != nil {
+			return err
+		}
+		rows := func(yield func([]any) bool) {
+			for _, r := range rs {
+				if !yield([]any{mv.Path, mv.Version, r.Path, r.Version, r.Indirect}) {
+					return
+				}
+			}
+		}
+		_, err = database.BulkInsert(ctx, tx, "requirements",
+			[]string{"module_path", "version", "req_path", "req_version", "indirect"}, rows, 500)
+		return err
+	})
+}
+
+// Loaded reports whether the requirements of mv have been stored.
+func Loaded(ctx context.Context, db *sql.DB, mv module.Version) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM go_mods WHERE module_path = ? AND version = ?", mv.Path, mv.Version).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,247 @@
+// Package descriptions extracts the README and synopsis of modules and
+// indexes them for full-text search.
+//
+// Descriptions come from untrimmed module zips, since the corpus holds only
+// Go files. The README is normalized to plain text, and the synopsis is the
+// first sentence of the root package's doc comment.
+package descriptions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// A Description is the README and synopsis of a module version,
+// as stored in the module_descriptions table.
+type Description struct {
+	ModulePath string
+	Version    string
+	ReadmeFile string // relative to the module root; empty if there is no README
+	Readme     string // normalized text
+	Synopsis   string
+	Extracted  string
+}
+
+// MaxReadme is the maximum number of bytes of normalized README text kept.
+const MaxReadme = 32 << 10
+
+// readmeExts are the extensions of README files, in order of preference.
+var readmeExts = []string{".md", ".markdown", ".rst", ".txt", ".org", ""}
+
+// Extract returns the description of the module in fsys, which holds
+// the module's files, as from [modfs.FS].
+func Extract(fsys fs.FS, modulePath, version string) (_ *Description, err error) {
+	defer errs.Wrap(&err, "descriptions.Extract(%s@%s)", modulePath, version)
+	d := &Description{
+		ModulePath: modulePath,
+		Version:    version,
+		Extracted:  time.Now().UTC().Format(time.RFC3339),
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	best := len(readmeExts)
+	var goFiles []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			goFiles = append(goFiles, name)
+		}
+		ext := path.Ext(name)
+		if !strings.EqualFold(strings.TrimSuffix(name, ext), "readme") {
+			continue
+		}
+		if i := slices.Index(readmeExts, strings.ToLower(ext)); i >= 0 && i < best {
+			best = i
+			d.ReadmeFile = name
+		}
+	}
+	if d.ReadmeFile != "" {
+		data, err := fs.ReadFile(fsys, d.ReadmeFile)
+		if err != nil {
+			return nil, err
+		}
+		d.Readme = Normalize(string(data), path.Ext(d.ReadmeFile))
+	}
+	d.Synopsis, err = synopsis(fsys, goFiles)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// synopsis returns the synopsis of the package formed by files, using
+// the first doc comment found. Files that fail to parse are skipped.
+func synopsis(fsys fs.FS, files []string) (string, error) {
+	slices.Sort(files)
+	fset := token.NewFileSet()
+	for _, name := range files {
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return "", err
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil || f.Doc == nil {
+			continue
+		}
+		return new(doc.Package).Synopsis(f.Doc.Text()), nil
+	}
+	return "", nil
+}
+
+var (
+	fencedCode  = regexp.MustCompile("(?ms)^ {0,3}```.*?^ {0,3}```|^ {0,3}~~~.*?^ {0,3}~~~")
+	htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTag     = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	image       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	link        = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	refLink     = regexp.MustCompile(`\[([^\]]*)\]\[[^\]]*\]`)
+	refDef      = regexp.MustCompile(`(?m)^ {0,3}\[[^\]]+\]:\s*\S+.*$`)
+	markup      = regexp.MustCompile("(?m)^ {0,3}(#{1,6}|>|[-*+]|=+|-+)[ \t]*|[*`]{1,3}")
+	space       = regexp.MustCompile(`\s+`)
+)
+
+// Normalize converts README text to plain text on a single line, for
+// indexing. For Markdown files (ext ".md" or ".markdown"), it removes code
+// blocks, HTML, link targets and formatting. The result is truncated to
+// [MaxReadme] bytes.
+func Normalize(text, ext string) string {
+	switch strings.ToLower(ext) {
+	case ".md", ".markdown":
+		text = fencedCode.ReplaceAllString(text, " ")
+		text = htmlComment.ReplaceAllString(text, " ")
+		text = htmlTag.ReplaceAllString(text, " ")
+		text = image.ReplaceAllString(text, "$1")
+		text = link.ReplaceAllString(text, "$1")
+		text = refLink.ReplaceAllString(text, "$1")
+		text = refDef.ReplaceAllString(text, " ")
+		text = markup.ReplaceAllString(text, "")
+	}
+	text = strings.TrimSpace(space.ReplaceAllString(text, " "))
+	if len(text) > MaxReadme {
+		text = text[:MaxReadme]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	return text
+}
+
+var descCols = []string{"module_path", "version", "readme_file", "readme", "synopsis", "extracted"}
+
+// Store replaces the stored description of d's module, and its entry in
+// the search index.
+func Store(ctx context.Context, db *sql.DB, d *Description) error {
+	return database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		_, err := database.Upsert(ctx, tx, "module_descriptions", descCols[:1], descCols,
+			d.ModulePath, d.Version, d.ReadmeFile, d.Readme, d.Synopsis, d.Extracted)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM module_search WHERE module_path = ?", d.ModulePath); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO module_search (module_path, synopsis, readme) VALUES (?, ?, ?)",
+			d.ModulePath, d.Synopsis, d.Readme)
+		return err
+	})
+}
+
+// Load returns the stored description of the module, or an error wrapping
+// [errs.NotFound] if there is none.
+func Load(ctx context.Context, db *sql.DB, modulePath string) (*Description, error) {
+	query, args := database.Select("module_descriptions", descCols...).Where("module_path = ?", modulePath).SQL()
+	seq, errf := database.ScanRowsAs[Description](ctx, db, query, args...)
+	var d *Description
+	for r := range seq {
+		d = r
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, errs.Errorf(errs.NotFound, "no description for %s", modulePath)
+	}
+	return d, nil
+}
+
+// Extracted reports whether the description of path@version has been stored.
+func Extracted(ctx context.Context, db *sql.DB, path, version string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM module_descriptions WHERE module_path = ? AND version = ?",
+		path, version).Scan(&n)
+	return n > 0, err
+}
+
+// A Hit is a result of [Search].
+type Hit struct {
+	ModulePath string
+	Synopsis   string
+}
+
+// Search returns the modules whose paths, synopses or READMEs contain all
+// the words of query, best matches first, followed by modules without
+// descriptions whose paths contain query. If limit is positive, at most
+// limit hits are returned.
+func Search(ctx context.Context, db *sql.DB, query string, limit int) (_ []*Hit, err error) {
+	defer errs.Wrap(&err, "descriptions.Search(%q)", query)
+	var terms []string
+	for w := range strings.FieldsSeq(query) {
+		// Quote each word so that FTS syntax in the query is taken literally.
+		terms = append(terms, `"`+strings.ReplaceAll(w, `"`, `""`)+`"`)
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	q := `
+		SELECT module_path, synopsis FROM module_search
+		WHERE module_search MATCH ?
+		ORDER BY bm25(module_search, 10.0, 5.0, 1.0), module_path`
+	if limit > 0 {
+		q += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	seq, errf := database.ScanRowsAs[Hit](ctx, db, q, strings.Join(terms, " "))
+	hits := slices.Collect(seq)
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(hits) >= limit {
+		return hits, nil
+	}
+	// Paths of modules that haven't been described.
+	rest := 0
+	if limit > 0 {
+		rest = limit - len(hits)
+	}
+	pq, args := database.Select("modules", "path").
+		Where("instr(path, ?) > 0", query).
+		Where("path NOT IN (SELECT module_path FROM module_descriptions)").
+		OrderBy("length(path)", "path").
+		Limit(rest).SQL()
+	paths, errf := database.ScanRowsOf[string](ctx, db, pq, args...)
+	for p := range paths {
+		hits = append(hits, &Hit{ModulePath: p})
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
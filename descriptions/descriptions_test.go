@@ -0,0 +1,113 @@
+package descriptions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/errs"
+	_ "modernc.org/sqlite"
+)
+
+func TestNormalize(t *testing.T) {
+	md := "# Title\n\n[![Build](https://ci/badge.svg)](https://ci) A **fast** `yaml` parser.\n\n" +
+		"```go\nx := 1\n```\n\n<!-- hidden -->\n<p align=\"center\">See [the docs][docs].</p>\n\n[docs]: https://example.com\n\n- one\n- two_three\n"
+	for _, test := range []struct {
+		text, ext, want string
+	}{
+		{md, ".md", "Title Build A fast yaml parser. See the docs. one two_three"},
+		{"Plain\n\n  text\there", ".txt", "Plain text here"},
+		{"# Not a heading", ".rst", "# Not a heading"},
+	} {
+		if got := Normalize(test.text, test.ext); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.ext, got, test.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	fsys := fstest.MapFS{
+		"README.txt":  {Data: []byte("text readme")},
+		"readme.md":   {Data: []byte("# Markdown readme")},
+		"a.go":        {Data: []byte("package a\n")},
+		"b.go":        {Data: []byte("// Package a parses YAML. It is fast.\npackage a\n")},
+		"a_test.go":   {Data: []byte("// Package a_test is not it.\npackage a_test\n")},
+		"sub/READ.md": {Data: []byte("no")},
+	}
+	d, err := Extract(fsys, "example.com/a", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ReadmeFile != "readme.md" || d.Readme != "Markdown readme" || d.Synopsis != "Package a parses YAML." {
+		t.Errorf("got %+v", d)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"example.com/yaml", "example.com/parsers", "example.com/yamlish", "example.com/other"} {
+		if _, err := db.ExecContext(ctx, "INSERT INTO modules (path, error, latest_version, info_time) VALUES (?, '', 'v1.0.0', '')", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range []*Description{
+		{ModulePath: "example.com/yaml", Version: "v1.0.0", Synopsis: "Package yaml reads YAML.", Readme: "Old readme"},
+		{ModulePath: "example.com/yaml", Version: "v1.1.0", Synopsis: "Package yaml parses YAML documents."},
+		{ModulePath: "example.com/parsers", Version: "v1.0.0", Readme: "Parsing of JSON and YAML, quickly."},
+	} {
+		if err := Store(ctx, db, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := Load(ctx, db, "example.com/yaml")
+	if err != nil || d.Version != "v1.1.0" {
+		t.Errorf("Load: got %+v, %v", d, err)
+	}
+	if _, err := Load(ctx, db, "example.com/other"); !errors.Is(err, errs.NotFound) {
+		t.Errorf("Load of undescribed module: got %v, want NotFound", err)
+	}
+
+	for _, test := range []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		// Stemming matches "parses" and "parsing"; the path match ranks first.
+		// example.com/yamlish has no description, but its path matches.
+		{"yaml", 0, []string{"example.com/yaml", "example.com/parsers", "example.com/yamlish"}},
+		{"yaml", 1, []string{"example.com/yaml"}},
+		{"parse yaml", 0, []string{"example.com/yaml", "example.com/parsers"}},
+		{"json", 0, []string{"example.com/parsers"}},
+		{"old", 0, nil},
+		{`"bad AND`, 0, nil},
+	} {
+		hits, err := Search(ctx, db, test.query, test.limit)
+		if err != nil {
+			t.Fatalf("%q: %v", test.query, err)
+		}
+		var got []string
+		for _, h := range hits {
+			got = append(got, h.ModulePath)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%q, %d: got %q, want %q", test.query, test.limit, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package docs extracts the documentation of packages and their exported
+// identifiers.
+//
+// The "docs" analyzer (see package analysis) reads doc comments with
+// go/doc and stores the synopsis of each package and exported identifier,
+// so that documentation can be searched and summarized without the source.
+package docs
+
+import (
+	"context"
+	"database/sql"
+	"go/ast"
+	"go/doc"
+	"go/token"
+	"iter"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/symbols"
+)
+
+// Package is the kind of a package's own documentation. The other kinds
+// are those of package symbols.
+const Package = "package"
+
+// A Doc is the documentation of a package or an exported identifier.
+type Doc struct {
+	ModulePath string
+	Version    string
+	Package    string // import path
+	Name       string // empty for the package itself
+	Kind       string // Package, or one of the kinds of package symbols
+	Receiver   string // for methods, the receiver's base type name
+	Synopsis   string // first sentence of the doc comment
+	Deprecated bool   // whether the doc comment has a "Deprecated:" paragraph
+}
+
+// Analyzer extracts the documentation of a module.
+var Analyzer = &analysis.Analyzer{
+	Name:    "docs",
+	Doc:     "record the synopses of packages and exported identifiers",
+	Version: 1,
+	Columns: []string{
+		"package TEXT NOT NULL",
+		"name TEXT NOT NULL",
+		"kind TEXT NOT NULL",
+		"receiver TEXT NOT NULL",
+		"synopsis TEXT NOT NULL",
+		"deprecated INTEGER NOT NULL",
+	},
+	Indexes: []string{"package", "name"},
+	Run: func(pass *analysis.Pass) error {
+		for _, d := range Extract(pass.Fset, pass.Path, pass.Files) {
+			pass.Report(d.Package, d.Name, d.Kind, d.Receiver, d.Synopsis, d.Deprecated)
+		}
+		return nil
+	},
+}
+
+func init() {
+	analysis.Register(Analyzer)
+}
+
+// Extract returns the documentation of the packages in the files of the
+// module with the given path, skipping the same files as [symbols.Extract].
+// If a directory has files from more than one package, only the package
+// with the most files is used. The files' syntax trees are not modified.
+// (Without AllDecls, go/doc removes unexported declarations from them even
+// with PreserveAST, so this package filters them itself.)
+// The ModulePath and Version fields of the results are not set.
+func Extract(fset *token.FileSet, modulePath string, files []*analysis.File) []*Doc {
+	byDir := map[string][]*ast.File{}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, "_test.go") || f.AST.Name.Name == "main" || skipDir(f.Name) {
+			continue
+		}
+		byDir[path.Dir(f.Name)] = append(byDir[path.Dir(f.Name)], f.AST)
+	}
+	var docs []*Doc
+	for _, dir := range slices.Sorted(maps.Keys(byDir)) {
+		pkg := modulePath
+		if dir != "." {
+			pkg += "/" + dir
+		}
+		p, err := doc.NewFromFiles(fset, majority(byDir[dir]), pkg, doc.AllDecls|doc.PreserveAST)
+		if err != nil {
+			continue
+		}
+		docs = append(docs, extractPackage(p, pkg)...)
+	}
+	return docs
+}
+
+func extractPackage(p *doc.Package, pkg string) []*Doc {
+	var docs []*Doc
+	add := func(name, kind, recv, text string) {
+		docs = append(docs, &Doc{
+			Package:    pkg,
+			Name:       name,
+			Kind:       kind,
+			Receiver:   recv,
+			Synopsis:   p.Synopsis(text),
+			Deprecated: deprecated(text),
+		})
+	}
+	add("", Package, "", p.Doc)
+	values := func(vs []*doc.Value, kind string) {
+		for _, v := range vs {
+			for _, n := range v.Names {
+				if token.IsExported(n) {
+					add(n, kind, "", v.Doc)
+				}
+			}
+		}
+	}
+	funcs := func(fs []*doc.Func) {
+		for _, f := range fs {
+			if !token.IsExported(f.Name) {
+				continue
+			}
+			if f.Recv == "" {
+				add(f.Name, symbols.Func, "", f.Doc)
+			} else {
+				add(f.Name, symbols.Method, strings.TrimPrefix(f.Recv, "*"), f.Doc)
+			}
+		}
+	}
+	values(p.Consts, symbols.Const)
+	values(p.Vars, symbols.Var)
+	funcs(p.Funcs)
+	for _, t := range p.Types {
+		// An unexported type may have exported constructors and values.
+		if token.IsExported(t.Name) {
+			add(t.Name, symbols.Type, "", t.Doc)
+		}
+		values(t.Consts, symbols.Const)
+		values(t.Vars, symbols.Var)
+		funcs(t.Funcs)
+		if token.IsExported(t.Name) {
+			funcs(t.Methods)
+		}
+	}
+	return docs
+}
+
+// deprecated reports whether the doc comment text has a paragraph beginning
+// with "Deprecated: ".
+func deprecated(text string) bool {
+	for para := range strings.SplitSeq(text, "\n\n") {
+		if strings.HasPrefix(strings.TrimSpace(para), "Deprecated: ") {
+			return true
+		}
+	}
+	return false
+}
+
+// majority returns the files of the package name used by the most files.
+func majority(files []*ast.File) []*ast.File {
+	counts := map[string]int{}
+	best := ""
+	for _, f := range files {
+		n := f.Name.Name
+		counts[n]++
+		if counts[n] > counts[best] || (counts[n] == counts[best] && n < best) {
+			best = n
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(files), func(f *ast.File) bool { return f.Name.Name != best })
+}
+
+func skipDir(name string) bool {
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem == "testdata" || elem == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
+const selectDocs = "SELECT module_path, version, package, name, kind, receiver, synopsis, deprecated FROM analysis_docs"
+
+// InPackage returns the documentation of the package with the given import
+// path and its exported identifiers: the package first, then types with
+// their methods, then the other identifiers, each ordered by name.
+func InPackage(ctx context.Context, db *sql.DB, pkg string) (iter.Seq[*Doc], func() error) {
+	return database.ScanRowsAs[Doc](ctx, db, selectDocs+`
+		WHERE package = ?
+		ORDER BY kind != 'package', kind NOT IN ('type', 'method'), coalesce(nullif(receiver, ''), name), receiver != '', name`, pkg)
+}
+
+// Search returns the documentation whose synopses contain all the words of
+// query, ignoring case, ordered by package and name. If limit is positive,
+// at most limit results are returned.
+func Search(ctx context.Context, db *sql.DB, query string, limit int) (iter.Seq[*Doc], func() error) {
+	q := database.Select(Analyzer.Table(), "module_path", "version", "package", "name", "kind", "receiver", "synopsis", "deprecated")
+	for w := range strings.FieldsSeq(query) {
+		q.Where("instr(lower(synopsis), ?) > 0", strings.ToLower(w))
+	}
+	query, args := q.OrderBy("package", "receiver", "name").Limit(limit).SQL()
+	return database.ScanRowsAs[Doc](ctx, db, query, args...)
+}
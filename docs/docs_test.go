@@ -0,0 +1,147 @@
+package docs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go/ast"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/analysis/analysistest"
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"golang.org/x/mod/module"
+	_ "modernc.org/sqlite"
+)
+
+var testFiles = map[string]string{
+	"a.go": `// Package a does things. More detail.
+package a
+
+// T is a type.
+type T struct{}
+
+// NewT returns a T.
+func NewT() *T { return nil }
+
+// Len returns the length.
+//
+// Deprecated: Use Size.
+func (*T) Len() int { return 0 }
+
+func (t *T) unexported() {}
+
+// Limits.
+const (
+	Max = 10
+	min = 1
+)
+
+// F is a function.
+func F() {}
+
+func g() {}
+
+type u int
+
+// NewU returns a u.
+func NewU() u { return 0 }
+
+// Exported is a method of an unexported type.
+func (u) Exported() {}
+`,
+	"ignored.go":    "//go:build ignore\n\n// Package main is a generator.\npackage main\n",
+	"sub/b.go":      "package sub\n\n// V is a variable.\nvar V int\n",
+	"sub/b_test.go": "package sub\n\n// TestV tests.\nfunc TestV() {}\n",
+	"cmd/c/main.go": "// Command c does things.\npackage main\n",
+	"testdata/d.go": "package d\n\nfunc D() {}\n",
+	"other/x.go":    "package x\n\nfunc X() {}\n",
+	"other/doc.go":  "// Package x is other.\npackage x\n",
+	"other/gen.go":  "//go:build ignore\n\npackage y\n\nfunc Y() {}\n",
+}
+
+func TestExtract(t *testing.T) {
+	fset, files := analysistest.Parse(t, testFiles)
+	var got []string
+	for _, d := range Extract(fset, "example.com/a", files) {
+		got = append(got, fmt.Sprintf("%s %s %s.%s %q %t", d.Package, d.Kind, d.Receiver, d.Name, d.Synopsis, d.Deprecated))
+	}
+	want := []string{
+		`example.com/a package . "Package a does things." false`,
+		`example.com/a const .Max "Limits." false`,
+		`example.com/a func .F "F is a function." false`,
+		`example.com/a type .T "T is a type." false`,
+		`example.com/a func .NewT "NewT returns a T." false`,
+		`example.com/a method T.Len "Len returns the length." true`,
+		`example.com/a func .NewU "NewU returns a u." false`,
+		`example.com/a/other package . "Package x is other." false`,
+		`example.com/a/other func .X "" false`,
+		`example.com/a/sub package . "" false`,
+		`example.com/a/sub var .V "V is a variable." false`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+	// The syntax trees are unchanged.
+	for _, f := range files {
+		if f.Name == "a.go" {
+			n := 0
+			ast.Inspect(f.AST, func(n2 ast.Node) bool {
+				if fd, ok := n2.(*ast.FuncDecl); ok && !fd.Name.IsExported() {
+					n++
+				}
+				return true
+			})
+			if n != 2 {
+				t.Errorf("a.go has %d unexported funcs after Extract, want 2", n)
+			}
+		}
+	}
+}
+
+func TestQueries(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	corpus := t.TempDir()
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.0.0", testFiles)
+	r := &analysis.Runner{DB: db, CorpusDir: corpus, Analyzers: []*analysis.Analyzer{Analyzer}}
+	if _, err := r.Run(ctx, slices.Values([]module.Version{{Path: "example.com/a", Version: "v1.0.0"}})); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(seq func(func(*Doc) bool), errf func() error) []string {
+		t.Helper()
+		var ids []string
+		for d := range seq {
+			ids = append(ids, d.Receiver+"."+d.Name)
+		}
+		if err := errf(); err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+	got := ids(InPackage(ctx, db, "example.com/a"))
+	want := []string{".", ".T", "T.Len", ".F", ".Max", ".NewT", ".NewU"}
+	if !slices.Equal(got, want) {
+		t.Errorf("InPackage: got %q, want %q", got, want)
+	}
+	got = ids(Search(ctx, db, "RETURNS a", 0))
+	want = []string{".NewT", ".NewU"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Search: got %q, want %q", got, want)
+	}
+}
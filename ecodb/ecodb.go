@@ -1,28 +1,98 @@
 package ecodb
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"os"
+	"iter"
 	"path/filepath"
 	"strings"
+
+	"github.com/jba/go-ecosystem/internal/config"
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
 )
 
+// Debug enables extra checks when opening the database.
+// They are also enabled by the DBDebug configuration setting.
+var Debug = false
+
+// Open opens the database in the directory given by the current configuration.
+// See [config.Current].
 func Open() (*sql.DB, error) {
-	dir := os.Getenv("GOECODIR")
-	if dir == "" {
-		return nil, errors.New("ecodb.Open: GOECODIR environment variable not set")
+	cfg, err := config.Current()
+	if err != nil {
+		return nil, err
+	}
+	dbPath, err := dbPath(cfg)
+	if err != nil {
+		return nil, err
 	}
-
-	dbPath := filepath.Join(dir, "db.sqlite")
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("opening database %s: %w", dbPath, err)
 	}
+	if Debug || cfg.DBDebug {
+		if err := verifySchema(context.Background(), db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 	return db, nil
 }
 
+// verifySchema checks that the tables of db match the Go types
+// used to read them.
+func verifySchema(ctx context.Context, db *sql.DB) error {
+	return database.VerifyColumns[Module](ctx, db, "modules")
+}
+
+// OpenHandle opens the database with separate read and write access.
+// See [database.Handle].
+func OpenHandle(maxReaders int) (*database.Handle, error) {
+	cfg, err := config.Current()
+	if err != nil {
+		return nil, err
+	}
+	dbPath, err := dbPath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	h, err := database.OpenHandle(dbPath, maxReaders)
+	if err != nil {
+		return nil, fmt.Errorf("opening database %s: %w", dbPath, err)
+	}
+	if Debug || cfg.DBDebug {
+		if err := verifySchema(context.Background(), h.Read); err != nil {
+			h.Close()
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Path returns the path of the database file in the directory given by the
+// current configuration.
+func Path() (string, error) {
+	cfg, err := config.Current()
+	if err != nil {
+		return "", err
+	}
+	return dbPath(cfg)
+}
+
+func dbPath(cfg *config.Config) (string, error) {
+	if cfg.Storage != "sqlite" {
+		return "", fmt.Errorf("ecodb: unsupported storage backend %q", cfg.Storage)
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		return "", errors.New("ecodb: data directory not set (set GOECODIR)")
+	}
+	return filepath.Join(dir, "db.sqlite"), nil
+}
+
 // A Module is information about a Go module
 // known to the proxy.
 //
@@ -32,34 +102,42 @@ type Module struct {
 	ID            int64
 	Path          string
 	Error         string
+	ErrorKind     string // from errs.KindOf(Error), if Error != ""
 	LatestVersion string
 	InfoTime      string // from proxy info
+	Refreshed     string // when the proxy information was fetched, in RFC 3339 format
+	Untagged      bool   // the proxy lists no versions; LatestVersion is a known pseudo-version
 }
 
-var moduleCols = []string{"id", "path", "error", "latest_version", "info_time"}
+var moduleCols = []string{"id", "path", "error", "error_kind", "latest_version", "info_time", "refreshed", "untagged"}
 
 var moduleSelectStmt = "SELECT " + cols(moduleCols) + " FROM modules"
 
-func ScanModule(rows *sql.Rows) (*Module, error) {
-	var m Module
-	// order must match moduleColumns
-	if err := rows.Scan(&m.ID, &m.Path, &m.Error, &m.LatestVersion, &m.InfoTime); err != nil {
-		return nil, err
-	}
-	return &m, nil
-}
+// ModuleInsertCols are the columns set by ModuleInsertStmt, in the order of
+// [Module.InsertArgs].
+var ModuleInsertCols = moduleCols[1:]
 
-var ModuleInsertStmt = "INSERT INTO modules " + cols(moduleCols[1:]) + " VALUES " + qmarks(len(moduleCols)-1)
+var ModuleInsertStmt = "INSERT INTO modules " + cols(ModuleInsertCols) + " VALUES " + qmarks(len(ModuleInsertCols))
 
 var ModuleUpdateStmt = "UPDATE modules SET " + cols(moduleCols[2:]) + " = " + qmarks(len(moduleCols)-2) +
 	" WHERE path = ?"
 
 func (m *Module) InsertArgs() []any {
-	return []any{m.Path, m.Error, m.LatestVersion, m.InfoTime}
+	return []any{m.Path, m.Error, m.ErrorKind, m.LatestVersion, m.InfoTime, m.Refreshed, m.Untagged}
 }
 
 func (m *Module) UpdateArgs() []any {
-	return []any{m.Error, m.LatestVersion, m.InfoTime, m.Path}
+	return []any{m.Error, m.ErrorKind, m.LatestVersion, m.InfoTime, m.Refreshed, m.Untagged, m.Path}
+}
+
+// SetError sets m.Error to the message of err, and m.ErrorKind to the name of
+// its kind, or the empty string if it has none.
+func (m *Module) SetError(err error) {
+	m.Error = err.Error()
+	m.ErrorKind = ""
+	if k := errs.KindOf(err); k != nil {
+		m.ErrorKind = k.Error()
+	}
 }
 
 func cols(cols []string) string {
@@ -69,3 +147,41 @@ func cols(cols []string) string {
 func qmarks(n int) string {
 	return "(" + strings.Repeat("?, ", n-1) + "?)"
 }
+
+// ModuleFilter selects modules for [ListModules].
+// The zero value selects all modules.
+type ModuleFilter struct {
+	Prefix    string // only modules whose paths begin with Prefix
+	After     string // only modules whose paths sort after After, for pagination
+	Errors    bool   // only modules with an error
+	NeedsInfo bool   // only modules without an error that are missing proxy information
+	Limit     int    // at most this many modules, if positive
+}
+
+// ListModules returns the modules selected by f, in path order.
+func ListModules(ctx context.Context, db *sql.DB, f ModuleFilter) (iter.Seq[*Module], func() error) {
+	end := prefixEnd(f.Prefix)
+	q := database.Select("modules", moduleCols...).
+		WhereIf(f.Prefix != "", "path >= ?", f.Prefix).
+		WhereIf(end != "", "path < ?", end).
+		WhereIf(f.After != "", "path > ?", f.After).
+		WhereIf(f.Errors, "error != ''").
+		WhereIf(f.NeedsInfo, "error = '' AND (latest_version = '' OR info_time = '')").
+		OrderBy("path").
+		Limit(f.Limit)
+	query, args := q.SQL()
+	return database.ScanRowsAs[Module](ctx, db, query, args...)
+}
+
+// prefixEnd returns the smallest string that is greater than every string
+// with the given prefix, or the empty string if there is none.
+func prefixEnd(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
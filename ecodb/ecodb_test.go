@@ -0,0 +1,64 @@
+package ecodb
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestListModules(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySchema(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	for _, mod := range []*Module{
+		{Path: "a.com/x"},
+		{Path: "a.com/y", LatestVersion: "v1.0.0", InfoTime: "t"},
+		{Path: "a.comz"},
+		{Path: "b.com/z", Error: "not found", ErrorKind: "not found"},
+	} {
+		if _, err := db.Exec(ModuleInsertStmt, mod.InsertArgs()...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		filter ModuleFilter
+		want   []string
+	}{
+		{ModuleFilter{}, []string{"a.com/x", "a.com/y", "a.comz", "b.com/z"}},
+		{ModuleFilter{Prefix: "a.com/"}, []string{"a.com/x", "a.com/y"}},
+		{ModuleFilter{After: "a.com/y", Limit: 1}, []string{"a.comz"}},
+		{ModuleFilter{Errors: true}, []string{"b.com/z"}},
+		{ModuleFilter{NeedsInfo: true}, []string{"a.com/x", "a.comz"}},
+		{ModuleFilter{Prefix: "a", NeedsInfo: true, Limit: 1}, []string{"a.com/x"}},
+	} {
+		var got []string
+		mods, errf := ListModules(ctx, db, test.filter)
+		for m := range mods {
+			got = append(got, m.Path)
+		}
+		if err := errf(); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%+v: got %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
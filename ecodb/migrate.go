@@ -0,0 +1,23 @@
+package ecodb
+
+import (
+	"database/sql"
+	"embed"
+
+	"github.com/jba/go-ecosystem/internal/database"
+)
+
+// The tables use IF NOT EXISTS in the first migration, so that it can be applied
+// to databases created before there were migrations.
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// Migrator returns a migrator for the schema of db.
+func Migrator(db *sql.DB) (*database.Migrator, error) {
+	migs, err := database.MigrationsFromFS(migrationFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &database.Migrator{DB: db, Migrations: migs}, nil
+}
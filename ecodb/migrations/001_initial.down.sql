@@ -0,0 +1,3 @@
+DROP TABLE params;
+DROP TABLE packages;
+DROP TABLE modules;
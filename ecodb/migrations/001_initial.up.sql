@@ -1,6 +1,6 @@
 -- avoid nulls to simplify interoperation with Go
 
-CREATE TABLE modules (
+CREATE TABLE IF NOT EXISTS modules (
     id             INTEGER PRIMARY KEY,
     path           TEXT NOT NULL UNIQUE,
     error          TEXT NOT NULL,
@@ -10,14 +10,14 @@ CREATE TABLE modules (
 
 -- TODO: make modules strict
 
-CREATE TABLE packages (
+CREATE TABLE IF NOT EXISTS packages (
     module_id INTEGER NOT NULL,
     relative_path TEXT NOT NULL,
     PRIMARY KEY (module_id, relative_path),
     FOREIGN KEY (module_id) REFERENCES modules(id)
 );
 
-CREATE TABLE params (
+CREATE TABLE IF NOT EXISTS params (
     name  TEXT PRIMARY KEY,
     value TEXT NOT NULL
 ) STRICT;
@@ -0,0 +1,7 @@
+-- error_kind classifies error; see Module.SetError.
+
+ALTER TABLE modules ADD COLUMN error_kind TEXT NOT NULL DEFAULT '';
+
+UPDATE modules SET error_kind = 'no versions' WHERE error LIKE '%no versions from proxy%';
+UPDATE modules SET error_kind = 'not found' WHERE error_kind = '' AND error LIKE '%HTTP 404:%';
+UPDATE modules SET error_kind = 'gone' WHERE error_kind = '' AND error LIKE '%HTTP 410:%';
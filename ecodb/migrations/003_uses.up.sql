@@ -0,0 +1,14 @@
+-- uses records how often each module version refers to the exported
+-- symbols of packages outside the module. See package xrefs.
+
+CREATE TABLE uses (
+    module_path TEXT NOT NULL,
+    version     TEXT NOT NULL,
+    package     TEXT NOT NULL,
+    receiver    TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    count       INTEGER NOT NULL,
+    PRIMARY KEY (module_path, version, package, receiver, name)
+);
+
+CREATE INDEX uses_symbol ON uses (package, name, receiver);
@@ -0,0 +1,2 @@
+DROP TABLE api_changes;
+DROP TABLE api_diffs;
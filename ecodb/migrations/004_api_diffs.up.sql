@@ -0,0 +1,26 @@
+-- api_diffs summarizes the API changes between two versions of a module.
+-- See package apihistory.
+
+CREATE TABLE api_diffs (
+    module_path  TEXT NOT NULL,
+    old_version  TEXT NOT NULL,
+    new_version  TEXT NOT NULL,
+    release      TEXT NOT NULL, -- major, minor, patch or prerelease
+    added        INTEGER NOT NULL,
+    removed      INTEGER NOT NULL,
+    changed      INTEGER NOT NULL,
+    incompatible INTEGER NOT NULL,
+    PRIMARY KEY (module_path, old_version, new_version)
+);
+
+CREATE TABLE api_changes (
+    module_path TEXT NOT NULL,
+    old_version TEXT NOT NULL,
+    new_version TEXT NOT NULL,
+    symbol      TEXT NOT NULL,
+    kind        TEXT NOT NULL, -- added, removed or changed
+    compatible  INTEGER NOT NULL,
+    message     TEXT NOT NULL
+);
+
+CREATE INDEX api_changes_diff ON api_changes (module_path, old_version, new_version);
@@ -0,0 +1,2 @@
+DROP TABLE vuln_affected;
+DROP TABLE vuln_advisories;
@@ -0,0 +1,23 @@
+-- Advisories from the Go vulnerability database. See package vulndb.
+
+CREATE TABLE vuln_advisories (
+    id        TEXT PRIMARY KEY,
+    modified  TEXT NOT NULL,
+    published TEXT NOT NULL,
+    withdrawn TEXT NOT NULL,
+    aliases   TEXT NOT NULL, -- space-separated
+    summary   TEXT NOT NULL
+);
+
+-- vuln_affected holds the version intervals [introduced, fixed) of modules
+-- affected by an advisory. An empty fixed version means there is no fix.
+CREATE TABLE vuln_affected (
+    id          TEXT NOT NULL,
+    module_path TEXT NOT NULL,
+    introduced  TEXT NOT NULL,
+    fixed       TEXT NOT NULL,
+    FOREIGN KEY (id) REFERENCES vuln_advisories(id)
+);
+
+CREATE INDEX vuln_affected_module ON vuln_affected (module_path);
+CREATE INDEX vuln_affected_id ON vuln_affected (id);
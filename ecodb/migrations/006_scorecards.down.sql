@@ -0,0 +1,2 @@
+DROP TABLE scorecard_checks;
+DROP TABLE scorecards;
@@ -0,0 +1,17 @@
+-- OpenSSF Scorecard results for repositories. See package scorecard.
+
+CREATE TABLE scorecards (
+    repo       TEXT PRIMARY KEY, -- like github.com/owner/name
+    date       TEXT NOT NULL,    -- date of the scorecard run
+    commit_sha TEXT NOT NULL,    -- commit that was scored
+    score      REAL NOT NULL,    -- aggregate score, 0 to 10
+    fetched    TEXT NOT NULL     -- time the result was downloaded
+);
+
+CREATE TABLE scorecard_checks (
+    repo   TEXT NOT NULL,
+    name   TEXT NOT NULL,
+    score  INTEGER NOT NULL, -- 0 to 10, or -1 if inconclusive
+    reason TEXT NOT NULL,
+    PRIMARY KEY (repo, name)
+);
@@ -0,0 +1 @@
+DROP TABLE repro_checks;
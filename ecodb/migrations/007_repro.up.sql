@@ -0,0 +1,17 @@
+-- repro_checks records whether module zips served by the proxy match
+-- zips rebuilt from the modules' repositories. See package repro.
+
+CREATE TABLE repro_checks (
+    module_path  TEXT NOT NULL,
+    version      TEXT NOT NULL,
+    repo_url     TEXT NOT NULL,
+    subdir       TEXT NOT NULL,
+    commit_hash  TEXT NOT NULL,
+    proxy_hash   TEXT NOT NULL, -- go.sum hash of the proxy's zip
+    vcs_hash     TEXT NOT NULL, -- go.sum hash of the rebuilt zip; empty if it couldn't be built
+    reproducible INTEGER NOT NULL,
+    diff         TEXT NOT NULL, -- space-separated names of files that differ
+    error        TEXT NOT NULL, -- why the check couldn't be completed
+    checked      TEXT NOT NULL,
+    PRIMARY KEY (module_path, version)
+);
@@ -0,0 +1 @@
+DROP TABLE module_paths;
@@ -0,0 +1,15 @@
+-- module_paths relates module paths to the paths their go.mod files declare
+-- and the repositories they come from. See package modpath.
+
+CREATE TABLE module_paths (
+    module_path    TEXT PRIMARY KEY,
+    version        TEXT NOT NULL, -- version that was checked
+    declared_path  TEXT NOT NULL, -- module directive of go.mod
+    repo           TEXT NOT NULL, -- origin repository, like github.com/owner/name
+    canonical_path TEXT NOT NULL, -- path the module is known by; may equal module_path
+    finding        TEXT NOT NULL, -- empty if nothing is wrong
+    detail         TEXT NOT NULL,
+    checked        TEXT NOT NULL
+);
+
+CREATE INDEX module_paths_canonical ON module_paths (canonical_path);
@@ -0,0 +1,12 @@
+-- review_queue ranks modules for manual review for signs of malicious
+-- code. It is rebuilt from scratch. See package supplychain.
+
+CREATE TABLE review_queue (
+    module_path TEXT PRIMARY KEY,
+    version     TEXT NOT NULL,
+    score       REAL NOT NULL,
+    reasons     TEXT NOT NULL, -- semicolon-separated
+    computed    TEXT NOT NULL
+);
+
+CREATE INDEX review_queue_score ON review_queue (score);
@@ -0,0 +1,24 @@
+-- Non-source files found in untrimmed module zips. See package artifacts.
+
+-- artifact_scans records each scanned module version and its size.
+CREATE TABLE artifact_scans (
+    module_path    TEXT NOT NULL,
+    version        TEXT NOT NULL,
+    files          INTEGER NOT NULL,
+    size           INTEGER NOT NULL, -- uncompressed bytes of all files
+    artifact_size  INTEGER NOT NULL, -- uncompressed bytes of artifacts
+    scanned        TEXT NOT NULL,
+    PRIMARY KEY (module_path, version)
+);
+
+CREATE TABLE artifacts (
+    module_path TEXT NOT NULL,
+    version     TEXT NOT NULL,
+    file        TEXT NOT NULL, -- relative to the module root
+    kind        TEXT NOT NULL, -- executable, library, object, archive, wasm, blob
+    format      TEXT NOT NULL, -- like elf, pe, macho or zip
+    size        INTEGER NOT NULL
+);
+
+CREATE INDEX artifacts_module ON artifacts (module_path, version);
+CREATE INDEX artifacts_kind ON artifacts (kind);
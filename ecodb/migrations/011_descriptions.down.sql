@@ -0,0 +1,2 @@
+DROP TABLE module_search;
+DROP TABLE module_descriptions;
@@ -0,0 +1,17 @@
+-- module_descriptions holds the README and synopsis of each module,
+-- extracted from untrimmed zips. See package descriptions.
+
+CREATE TABLE module_descriptions (
+    module_path TEXT NOT NULL PRIMARY KEY,
+    version     TEXT NOT NULL, -- the version the description was extracted from
+    readme_file TEXT NOT NULL, -- relative to the module root; empty if there is no README
+    readme      TEXT NOT NULL, -- normalized text
+    synopsis    TEXT NOT NULL, -- first sentence of the root package's doc comment
+    extracted   TEXT NOT NULL
+);
+
+-- module_search is the full-text index of module paths and descriptions.
+CREATE VIRTUAL TABLE module_search USING fts5(
+    module_path, synopsis, readme,
+    tokenize = 'porter unicode61'
+);
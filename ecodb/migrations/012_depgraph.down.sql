@@ -0,0 +1,3 @@
+DROP TABLE centrality;
+DROP TABLE requirements;
+DROP TABLE go_mods;
@@ -0,0 +1,33 @@
+-- The module dependency graph and scores computed over it. See package depgraph.
+
+-- go_mods records the module versions whose go.mod requirements are in
+-- the requirements table, so that a version with no requirements can be
+-- told from one that hasn't been loaded.
+CREATE TABLE go_mods (
+    module_path TEXT NOT NULL,
+    version     TEXT NOT NULL,
+    error       TEXT NOT NULL, -- why the go.mod file couldn't be read or parsed
+    loaded      TEXT NOT NULL,
+    PRIMARY KEY (module_path, version)
+);
+
+CREATE TABLE requirements (
+    module_path TEXT NOT NULL,
+    version     TEXT NOT NULL,
+    req_path    TEXT NOT NULL,
+    req_version TEXT NOT NULL,
+    indirect    INTEGER NOT NULL,
+    PRIMARY KEY (module_path, version, req_path)
+);
+
+CREATE INDEX requirements_req ON requirements (req_path, req_version);
+
+-- centrality holds scores of modules in the graph of their latest versions'
+-- requirements.
+CREATE TABLE centrality (
+    module_path TEXT NOT NULL PRIMARY KEY,
+    in_degree   INTEGER NOT NULL, -- modules that require this one
+    page_rank   REAL NOT NULL,
+    betweenness REAL NOT NULL,
+    computed    TEXT NOT NULL
+);
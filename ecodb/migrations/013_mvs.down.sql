@@ -0,0 +1,3 @@
+DROP TABLE upgrades;
+DROP TABLE declared_versions;
+DROP TABLE selected_versions;
@@ -0,0 +1,30 @@
+-- Versions selected by minimal version selection from the latest version
+-- of every module, compared with the versions modules require. See package mvs.
+
+-- selected_versions counts the roots whose build lists select each version.
+CREATE TABLE selected_versions (
+    path    TEXT NOT NULL,
+    version TEXT NOT NULL,
+    roots   INTEGER NOT NULL,
+    PRIMARY KEY (path, version)
+);
+
+-- declared_versions counts the roots whose go.mod files require each version.
+CREATE TABLE declared_versions (
+    path    TEXT NOT NULL,
+    version TEXT NOT NULL,
+    roots   INTEGER NOT NULL,
+    PRIMARY KEY (path, version)
+);
+
+-- upgrades lists the requirements of roots that MVS raises to a higher version.
+CREATE TABLE upgrades (
+    root_path    TEXT NOT NULL,
+    root_version TEXT NOT NULL,
+    path         TEXT NOT NULL,
+    declared     TEXT NOT NULL,
+    selected     TEXT NOT NULL,
+    PRIMARY KEY (root_path, root_version, path)
+);
+
+CREATE INDEX upgrades_path ON upgrades (path);
@@ -0,0 +1,20 @@
+-- jobs is a persistent queue of work for pipeline commands. Each job is
+-- identified by its kind and key, typically "path@version". See package tasks.
+
+CREATE TABLE jobs (
+    id            INTEGER PRIMARY KEY,
+    kind          TEXT NOT NULL,
+    key           TEXT NOT NULL,
+    priority      INTEGER NOT NULL DEFAULT 0, -- higher runs first
+    state         TEXT NOT NULL,              -- pending, running, done or failed
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    worker        TEXT NOT NULL DEFAULT '',   -- holder of the lease, while running
+    lease_expires TEXT NOT NULL DEFAULT '',
+    not_before    TEXT NOT NULL DEFAULT '',   -- earliest time to retry a pending job
+    error         TEXT NOT NULL DEFAULT '',   -- of the last attempt
+    created       TEXT NOT NULL,
+    updated       TEXT NOT NULL,
+    UNIQUE (kind, key)
+);
+
+CREATE INDEX jobs_claim ON jobs (kind, state, priority);
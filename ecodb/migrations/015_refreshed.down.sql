@@ -0,0 +1 @@
+ALTER TABLE modules DROP COLUMN refreshed;
@@ -0,0 +1,4 @@
+-- refreshed is when the module's information was last fetched from the proxy,
+-- so that stale modules can be refreshed; see package schedule.
+
+ALTER TABLE modules ADD COLUMN refreshed TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE modules DROP COLUMN untagged;
+DROP TABLE versions;
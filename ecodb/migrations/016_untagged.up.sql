@@ -0,0 +1,13 @@
+-- versions records versions of modules that the proxy doesn't list, like the
+-- pseudo-versions of modules with no tagged versions. See package untagged.
+CREATE TABLE versions (
+    module_path TEXT NOT NULL,
+    version     TEXT NOT NULL,
+    source      TEXT NOT NULL, -- index or go.mod
+    time        TEXT NOT NULL, -- of the index entry or pseudo-version, if known
+    PRIMARY KEY (module_path, version)
+);
+
+-- untagged is 1 for a module with no tagged versions whose latest version
+-- is the latest of its known pseudo-versions.
+ALTER TABLE modules ADD COLUMN untagged INTEGER NOT NULL DEFAULT 0;
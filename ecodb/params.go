@@ -0,0 +1,28 @@
+package ecodb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jba/go-ecosystem/internal/database"
+)
+
+// Param returns the value of the named row of the params table,
+// or the empty string if there is none.
+func Param(ctx context.Context, db *sql.DB, name string) (string, error) {
+	var value string
+	err := db.QueryRowContext(ctx, "SELECT value FROM params WHERE name = ?", name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetParam sets the value of the named row of the params table.
+func SetParam(ctx context.Context, db *sql.DB, name, value string) error {
+	return database.RetryBusy(ctx, func() error {
+		_, err := database.Upsert(ctx, db, "params", []string{"name"}, []string{"name", "value"}, name, value)
+		return err
+	})
+}
@@ -0,0 +1,326 @@
+// Package embeds measures the use of //go:embed directives.
+//
+// The "embeds" analyzer (see package analysis) records each directive with
+// its patterns. If the untrimmed module zip is available (see
+// [analysis.Pass.ModuleFS]), it also resolves the patterns as the go command
+// does and records the number and total size of the embedded files;
+// otherwise those columns are NULL.
+package embeds
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/internal/database"
+)
+
+// Analyzer records the //go:embed directives of each module.
+var Analyzer = &analysis.Analyzer{
+	Name:    "embeds",
+	Doc:     "record go:embed directives and the size of the files they embed",
+	Version: 1,
+	Columns: []string{
+		"file TEXT NOT NULL",
+		"line INTEGER NOT NULL",
+		"patterns TEXT NOT NULL", // space-separated, as written
+		"files INTEGER",          // number of embedded files; NULL if unknown
+		"bytes INTEGER",          // total size of embedded files; NULL if unknown
+	},
+	Run: run,
+}
+
+func init() {
+	analysis.Register(Analyzer)
+}
+
+func run(pass *analysis.Pass) error {
+	for _, f := range pass.Files {
+		if strings.HasSuffix(f.Name, "_test.go") {
+			continue
+		}
+		for _, cg := range f.AST.Comments {
+			for _, c := range cg.List {
+				arg, ok := strings.CutPrefix(c.Text, "//go:embed")
+				if !ok || (arg != "" && !unicode.IsSpace(rune(arg[0]))) {
+					continue
+				}
+				line := pass.Fset.Position(c.Pos()).Line
+				patterns, err := ParsePatterns(arg)
+				if err != nil {
+					// The go command would reject the file; record the directive anyway.
+					pass.Report(f.Name, line, strings.TrimSpace(arg), nil, nil)
+					continue
+				}
+				var nFiles, nBytes any
+				if pass.ModuleFS != nil {
+					files, err := Resolve(pass.ModuleFS, path.Dir(f.Name), patterns)
+					if err == nil {
+						n, size, err := sizes(pass.ModuleFS, files)
+						if err != nil {
+							return err
+						}
+						nFiles, nBytes = n, size
+					}
+				}
+				pass.Report(f.Name, line, strings.Join(patterns, " "), nFiles, nBytes)
+			}
+		}
+	}
+	return nil
+}
+
+func sizes(fsys fs.FS, files []string) (n int, size int64, err error) {
+	for _, name := range files {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			return 0, 0, err
+		}
+		size += info.Size()
+	}
+	return len(files), size, nil
+}
+
+// ParsePatterns splits the argument of a //go:embed directive into patterns.
+// Patterns are separated by spaces, and may be quoted as Go string literals.
+func ParsePatterns(arg string) ([]string, error) {
+	var patterns []string
+	for {
+		arg = strings.TrimLeftFunc(arg, unicode.IsSpace)
+		if arg == "" {
+			return patterns, nil
+		}
+		var p string
+		switch arg[0] {
+		case '"', '`':
+			i := strings.IndexByte(arg[1:], arg[0])
+			if arg[0] == '"' {
+				// Find the closing quote, skipping escaped ones.
+				i = -1
+				for j := 1; j < len(arg); j++ {
+					if arg[j] == '\\' {
+						j++
+					} else if arg[j] == '"' {
+						i = j - 1
+						break
+					}
+				}
+			}
+			if i < 0 {
+				return nil, fmt.Errorf("unterminated quoted pattern in %q", arg)
+			}
+			q, err := strconv.Unquote(arg[:i+2])
+			if err != nil {
+				return nil, err
+			}
+			p, arg = q, arg[i+2:]
+			if arg != "" && !unicode.IsSpace(rune(arg[0])) {
+				return nil, fmt.Errorf("missing space after quoted pattern %q", p)
+			}
+		default:
+			i := strings.IndexFunc(arg, unicode.IsSpace)
+			if i < 0 {
+				i = len(arg)
+			}
+			p, arg = arg[:i], arg[i:]
+		}
+		patterns = append(patterns, p)
+	}
+}
+
+// Resolve returns the files of fsys matched by the embed patterns of a
+// package in dir, sorted and without duplicates, following the rules of the
+// go command: a pattern naming a directory embeds the files in it
+// recursively, except those beginning with '.' or '_' unless the pattern
+// has the prefix "all:", and except those in nested modules.
+// It returns an error if a pattern is invalid or matches nothing.
+func Resolve(fsys fs.FS, dir string, patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	matched := 0
+	add := func(name string) {
+		matched++
+		if !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+	for _, pattern := range patterns {
+		glob, all := strings.CutPrefix(pattern, "all:")
+		if _, err := path.Match(glob, ""); err != nil || !validPattern(glob) {
+			return nil, fmt.Errorf("invalid pattern %q", pattern)
+		}
+		matches, err := fs.Glob(fsys, path.Join(dir, glob))
+		if err != nil {
+			return nil, err
+		}
+		matched = 0
+		for _, m := range matches {
+			info, err := fs.Stat(fsys, m)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if info.Mode().IsRegular() {
+					add(m)
+				}
+				continue
+			}
+			err = fs.WalkDir(fsys, m, func(name string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if name == m {
+					return nil
+				}
+				base := d.Name()
+				if !all && (strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+					if d.IsDir() {
+						return fs.SkipDir
+					}
+					return nil
+				}
+				if d.IsDir() {
+					if _, err := fs.Stat(fsys, path.Join(name, "go.mod")); err == nil {
+						return fs.SkipDir
+					}
+					return nil
+				}
+				if d.Type().IsRegular() {
+					add(name)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if matched == 0 {
+			return nil, fmt.Errorf("pattern %q: no matching files found", pattern)
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// validPattern reports whether the glob is a relative path that stays
+// within the package directory.
+func validPattern(glob string) bool {
+	if glob == "" || strings.HasPrefix(glob, "/") || strings.HasSuffix(glob, "/") {
+		return false
+	}
+	for elem := range strings.SplitSeq(glob, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// A Usage summarizes the embedded files of a module version.
+type Usage struct {
+	ModulePath string
+	Version    string
+	Directives int
+	Files      int
+	Bytes      int64
+}
+
+// Largest returns the latest versions of modules with the most embedded
+// bytes. Directives whose sizes are unknown count toward Directives only.
+// If limit is positive, at most limit modules are returned.
+func Largest(ctx context.Context, db *sql.DB, limit int) ([]*Usage, error) {
+	query := `
+		SELECT a.module_path, a.version, COUNT(*) AS directives,
+			COALESCE(SUM(a.files), 0) AS files, COALESCE(SUM(a.bytes), 0) AS bytes
+		FROM ` + Analyzer.Table() + ` a
+		JOIN modules m ON m.path = a.module_path AND m.latest_version = a.version
+		GROUP BY a.module_path, a.version
+		ORDER BY bytes DESC, a.module_path`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	seq, errf := database.ScanRowsAs[Usage](ctx, db, query)
+	us := slices.Collect(seq)
+	return us, errf()
+}
+
+// Totals summarizes embedding across the latest versions of all analyzed modules.
+type Totals struct {
+	Modules    int   // modules analyzed
+	Embedding  int   // modules with at least one directive
+	Measured   int   // directives whose files were counted
+	Directives int   // all directives
+	Files      int   // embedded files
+	Bytes      int64 // embedded bytes
+}
+
+// Total returns the ecosystem-wide totals.
+func Total(ctx context.Context, db *sql.DB) (*Totals, error) {
+	var t Totals
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT r.module_path) FROM analysis_runs r
+		JOIN modules m ON m.path = r.module_path AND m.latest_version = r.version
+		WHERE r.analyzer = ?`, Analyzer.Name).Scan(&t.Modules)
+	if err != nil {
+		return nil, err
+	}
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT a.module_path), COUNT(a.files), COUNT(*),
+			COALESCE(SUM(a.files), 0), COALESCE(SUM(a.bytes), 0)
+		FROM `+Analyzer.Table()+` a
+		JOIN modules m ON m.path = a.module_path AND m.latest_version = a.version`).
+		Scan(&t.Embedding, &t.Measured, &t.Directives, &t.Files, &t.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// A PatternCount is the number of modules that use a pattern.
+type PatternCount struct {
+	Pattern string
+	Modules int
+}
+
+// Patterns returns the most common patterns among the latest versions of
+// modules. If limit is positive, at most limit patterns are returned.
+func Patterns(ctx context.Context, db *sql.DB, limit int) ([]*PatternCount, error) {
+	type row struct{ ModulePath, Patterns string }
+	seq, errf := database.ScanRowsAs[row](ctx, db, `
+		SELECT a.module_path, a.patterns FROM `+Analyzer.Table()+` a
+		JOIN modules m ON m.path = a.module_path AND m.latest_version = a.version`)
+	mods := map[string]map[string]bool{}
+	for r := range seq {
+		for _, p := range strings.Fields(r.Patterns) {
+			if mods[p] == nil {
+				mods[p] = map[string]bool{}
+			}
+			mods[p][r.ModulePath] = true
+		}
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	var pcs []*PatternCount
+	for p, ms := range mods {
+		pcs = append(pcs, &PatternCount{p, len(ms)})
+	}
+	slices.SortFunc(pcs, func(a, b *PatternCount) int {
+		if a.Modules != b.Modules {
+			return b.Modules - a.Modules
+		}
+		return strings.Compare(a.Pattern, b.Pattern)
+	})
+	if limit > 0 && len(pcs) > limit {
+		pcs = pcs[:limit]
+	}
+	return pcs, nil
+}
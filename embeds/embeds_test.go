@@ -0,0 +1,157 @@
+package embeds
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"golang.org/x/mod/module"
+	_ "modernc.org/sqlite"
+)
+
+func TestParsePatterns(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []string
+	}{
+		{" a.txt  b/*.html", []string{"a.txt", "b/*.html"}},
+		{` "with space.txt" all:static`, []string{"with space.txt", "all:static"}},
+		{" `raw`", []string{"raw"}},
+		{` "a\"b"`, []string{`a"b`}},
+		{` "open`, nil},
+		{` "a"b`, nil},
+	} {
+		got, err := ParsePatterns(test.in)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%q: got %q, want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %q, %v; want %q", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	fsys := fstest.MapFS{
+		"p/a.txt":             {Data: []byte("a")},
+		"p/static/index.html": {},
+		"p/static/.hidden":    {},
+		"p/static/_x/y.css":   {},
+		"p/static/mod/go.mod": {},
+		"p/static/mod/z.txt":  {},
+		"p/.env":              {},
+	}
+	for _, test := range []struct {
+		patterns []string
+		want     []string // nil means error
+	}{
+		{[]string{"a.txt"}, []string{"p/a.txt"}},
+		{[]string{"static"}, []string{"p/static/index.html"}},
+		{[]string{"all:static"}, []string{"p/static/.hidden", "p/static/_x/y.css", "p/static/index.html"}},
+		{[]string{"*.txt", "a.txt"}, []string{"p/a.txt"}},
+		{[]string{".env"}, []string{"p/.env"}},
+		{[]string{"missing"}, nil},
+		{[]string{"../x"}, nil},
+		{[]string{"[bad"}, nil},
+	} {
+		got, err := Resolve(fsys, "p", test.patterns)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%q: got %q, want error", test.patterns, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %q, %v; want %q", test.patterns, got, err, test.want)
+		}
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	ctx := context.Background()
+	src := map[string]string{
+		"go.mod": "module example.com/a\n",
+		"a.go": `package a
+
+import "embed"
+
+//go:embed static *.txt
+var content embed.FS
+
+//go:embed "version.txt"
+var version string
+`,
+		"a_test.go": "package a\n\n//go:embed testdata\nvar td embed.FS\n",
+	}
+	corpus, zips := t.TempDir(), t.TempDir()
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.0.0", src)
+	corpustest.WriteZip(t, corpus, "example.com/b", "v1.0.0", src)
+	src["static/index.html"] = "<html></html>"
+	src["version.txt"] = "1.0"
+	// Only a has an untrimmed zip. version.txt is embedded twice.
+	corpustest.WriteZip(t, zips, "example.com/a", "v1.0.0", src)
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"example.com/a", "example.com/b"} {
+		if _, err := db.ExecContext(ctx, "INSERT INTO modules (path, error, latest_version, info_time) VALUES (?, '', 'v1.0.0', '')", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := &analysis.Runner{DB: db, CorpusDir: corpus, ZipDir: zips, Analyzers: []*analysis.Analyzer{Analyzer}}
+	mods := []module.Version{{Path: "example.com/a", Version: "v1.0.0"}, {Path: "example.com/b", Version: "v1.0.0"}}
+	if _, err := r.Run(ctx, slices.Values(mods)); err != nil {
+		t.Fatal(err)
+	}
+
+	us, err := Largest(ctx, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Usage
+	for _, u := range us {
+		got = append(got, *u)
+	}
+	want := []Usage{
+		{"example.com/a", "v1.0.0", 2, 3, 19},
+		{"example.com/b", "v1.0.0", 2, 0, 0},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Largest: got %+v, want %+v", got, want)
+	}
+
+	tot, err := Total(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantTot := (Totals{Modules: 2, Embedding: 2, Measured: 2, Directives: 4, Files: 3, Bytes: 19}); *tot != wantTot {
+		t.Errorf("Total: got %+v, want %+v", *tot, wantTot)
+	}
+
+	pcs, err := Patterns(ctx, db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcs) != 2 || *pcs[0] != (PatternCount{"*.txt", 2}) || *pcs[1] != (PatternCount{"static", 2}) {
+		t.Errorf("Patterns: got %v", pcs)
+	}
+}
@@ -1,8 +1,13 @@
-// Package index supports queries on the Go module index (index.golang.org).
+// Package index supports queries on the Go module index (index.golang.org),
+// or on a mirror of it.
+//
+// The package-level functions use the client returned by [Default].
+// Point it at a mirror with [SetURL] before making any requests.
 package index
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -12,22 +17,128 @@ import (
 
 	"github.com/jba/go-ecosystem/internal/httputil"
 	"github.com/jba/go-ecosystem/internal/jiter"
+	"github.com/jba/go-ecosystem/internal/logging"
+)
+
+const (
+	defaultURL = "https://index.golang.org"
+	// The index has no published rate limit, but we should be polite.
+	defaultMaxQPS = 10
 )
 
+func newLimitedClient(hc *http.Client, maxQPS int) *httputil.LimitedClient {
+	c := httputil.NewLimitedClient(hc, maxQPS, 1)
+	c.AddHooks(httputil.Hooks{
+		BeforeRequest: func(req *http.Request) error {
+			ctx := req.Context()
+			logging.FromContext(ctx).DebugContext(ctx, "index request", "url", req.URL.Redacted())
+			return nil
+		},
+	})
+	return c
+}
+
+// A Client makes requests to a module index. Each Client has its own rate
+// limit and request statistics.
+//
+// The package-level functions use a default client; see [Default].
+type Client struct {
+	url string
+	lc  *httputil.LimitedClient
+}
+
+// An Option configures a [Client].
+type Option func(*options)
+
+type options struct {
+	url    string
+	client *http.Client
+	maxQPS int
+}
+
+// WithURL sets the base URL of the index, like the value of GOINDEX.
+// Requests go to its /index path, so a mirror of the index must serve
+// the same protocol there. The default is https://index.golang.org.
+func WithURL(u string) Option {
+	return func(o *options) { o.url = u }
+}
+
+// WithHTTPClient sends requests with c. The default is [httputil.DefaultClient].
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) { o.client = c }
+}
+
+// WithMaxQPS sets the maximum rate of requests. The default is 10.
+func WithMaxQPS(qps int) Option {
+	return func(o *options) { o.maxQPS = qps }
+}
+
+// New returns a Client configured by opts.
+func New(opts ...Option) *Client {
+	o := &options{maxQPS: defaultMaxQPS}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Client{
+		url: indexURL(o.url),
+		lc:  newLimitedClient(o.client, o.maxQPS),
+	}
+}
+
+// indexURL returns the URL of the index endpoint of the base URL u,
+// or of the default index if u is empty.
+func indexURL(u string) string {
+	return strings.TrimSuffix(cmp.Or(strings.TrimSpace(u), defaultURL), "/") + "/index"
+}
+
+var defaultClient = New()
+
+// Default returns the client used by the package-level functions.
+// It is configured by [SetURL].
+func Default() *Client {
+	return defaultClient
+}
+
+// SetURL sets the base URL of the default client, or restores the default
+// if u is empty. See [WithURL].
+func SetURL(u string) {
+	defaultClient.url = indexURL(u)
+}
+
+// URL returns the URL that c reads the index from.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Stats returns cumulative statistics of requests of the default client.
+func Stats() httputil.LimitStats {
+	return defaultClient.Stats()
+}
+
+// Stats returns cumulative statistics of requests to the index.
+func (c *Client) Stats() httputil.LimitStats {
+	return c.lc.Stats()
+}
+
 type Entry struct {
 	Path      string
 	Version   string
 	Timestamp string
 }
 
-// Read reads entries from index.golang.org.
+// Read calls [Client.Read] on the default client.
+func Read(ctx context.Context, since string, limit int) ([]*Entry, error) {
+	return defaultClient.Read(ctx, since, limit)
+}
+
+// Read reads entries from the index.
 //
 // since should either be the empty string or a value returned in the
 // Timestamp field of a previously read Entry.
 //
 // The limit is passed on to the index unless it is zero.
-func Read(ctx context.Context, since string, limit int) ([]*Entry, error) {
-	url := "https://index.golang.org/index"
+func (c *Client) Read(ctx context.Context, since string, limit int) ([]*Entry, error) {
+	url := c.url
 	var params []string
 	if since != "" {
 		params = append(params, "since="+since)
@@ -42,7 +153,7 @@ func Read(ctx context.Context, since string, limit int) ([]*Entry, error) {
 	if err != nil {
 		return nil, err
 	}
-	body, err := httputil.DoReadBody(req)
+	body, err := c.lc.DoReadBody(req)
 	if err != nil {
 		return nil, err
 	}
@@ -60,16 +171,55 @@ func Read(ctx context.Context, since string, limit int) ([]*Entry, error) {
 	return entries, nil
 }
 
+// A Checkpointer saves progress through the index, so that reading can
+// resume where it left off after a crash.
+type Checkpointer interface {
+	// Checkpoint is called with the timestamp of the last entry consumed
+	// from an iterator returned by [Client.Entries]: after each batch of entries
+	// read from the index, and when the iteration ends. Passing the timestamp
+	// to Entries resumes reading there, though entries with that exact
+	// timestamp may be seen again.
+	// If Checkpoint returns an error, the iteration stops with that error.
+	Checkpoint(ctx context.Context, timestamp string) error
+}
+
+// A CheckpointFunc is a function that is a [Checkpointer].
+type CheckpointFunc func(ctx context.Context, timestamp string) error
+
+func (f CheckpointFunc) Checkpoint(ctx context.Context, timestamp string) error {
+	return f(ctx, timestamp)
+}
+
+// Entries calls [Client.Entries] on the default client.
+func Entries(ctx context.Context, since string, cp Checkpointer) (iter.Seq[*Entry], func() error) {
+	return defaultClient.Entries(ctx, since, cp)
+}
+
 // Entries returns an iterator over index entries since the given time, which should be the
 // empty string or a value from an [Entry].
 // It never returns the same entry twice, even if they have the same timestamp.
-func Entries(ctx context.Context, since string) (iter.Seq[*Entry], func() error) {
+// If cp is not nil, it is called periodically with the progress of the iteration.
+func (c *Client) Entries(ctx context.Context, since string, cp Checkpointer) (iter.Seq[*Entry], func() error) {
 	var es jiter.ErrorState
 	return func(yield func(*Entry) bool) {
 		defer es.Done()
+		var last, saved string // timestamps of the last entry consumed and the last checkpoint
+		checkpoint := func() error {
+			if cp == nil || last == saved {
+				return nil
+			}
+			saved = last
+			return cp.Checkpoint(ctx, last)
+		}
+		// Save the progress however the iteration ends.
+		defer func() {
+			if err := checkpoint(); err != nil {
+				es.Set(err)
+			}
+		}()
 		prevs := map[Entry]bool{} // previously seen entries at since.
 		for {
-			entries, err := Read(ctx, since, 0)
+			entries, err := c.Read(ctx, since, 0)
 			if err != nil {
 				es.Set(err)
 				return
@@ -82,11 +232,16 @@ func Entries(ctx context.Context, since string) (iter.Seq[*Entry], func() error)
 				if !yield(e) {
 					return
 				}
+				last = e.Timestamp
 				n++
 			}
 			if n == 0 {
 				return
 			}
+			if err := checkpoint(); err != nil {
+				es.Set(err)
+				return
+			}
 			since = entries[len(entries)-1].Timestamp
 			// Remember entries we've returned at this timestamp so we don't repeat them.
 			clear(prevs)
@@ -0,0 +1,104 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// newTestServer returns the URL of a server for entries, which must be
+// sorted by timestamp. Like the index, it returns entries at or after since,
+// but only three at a time unless there is a limit.
+func newTestServer(t *testing.T, entries []Entry) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index" {
+			http.NotFound(w, r)
+			return
+		}
+		limit := 3
+		if s := r.URL.Query().Get("limit"); s != "" {
+			limit, _ = strconv.Atoi(s)
+		}
+		since := r.URL.Query().Get("since")
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if limit == 0 {
+				break
+			}
+			if e.Timestamp >= since {
+				enc.Encode(e)
+				limit--
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+var testEntries = []Entry{
+	{"a.com/m", "v1.0.0", "2024-01-01T00:00:00Z"},
+	{"b.com/m", "v1.0.0", "2024-01-02T00:00:00Z"},
+	{"c.com/m", "v1.0.0", "2024-01-02T00:00:00Z"},
+	{"d.com/m", "v1.0.0", "2024-01-03T00:00:00Z"},
+	{"e.com/m", "v1.0.0", "2024-01-04T00:00:00Z"},
+}
+
+func TestIndexURL(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", "https://index.golang.org/index"},
+		{"https://mirror.example.com/", "https://mirror.example.com/index"},
+		{"http://localhost:8080/goindex", "http://localhost:8080/goindex/index"},
+	} {
+		if got := New(WithURL(test.in)).URL(); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	ctx := context.Background()
+	c := New(WithURL(newTestServer(t, testEntries)), WithMaxQPS(1000))
+	got, err := c.Read(ctx, "2024-01-02T00:00:00Z", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, e := range got {
+		paths = append(paths, e.Path)
+	}
+	if want := []string{"b.com/m", "c.com/m", "d.com/m"}; !slices.Equal(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	ctx := context.Background()
+	c := New(WithURL(newTestServer(t, testEntries)), WithMaxQPS(1000))
+	var checkpoints []string
+	cp := CheckpointFunc(func(_ context.Context, ts string) error {
+		checkpoints = append(checkpoints, ts)
+		return nil
+	})
+	seq, errf := c.Entries(ctx, "", cp)
+	var got []Entry
+	for e := range seq {
+		got = append(got, *e)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, testEntries) {
+		t.Errorf("got %v, want %v", got, testEntries)
+	}
+	// One checkpoint per page of new entries.
+	want := []string{"2024-01-02T00:00:00Z", "2024-01-03T00:00:00Z", "2024-01-04T00:00:00Z"}
+	if !slices.Equal(checkpoints, want) {
+		t.Errorf("checkpoints: got %v, want %v", checkpoints, want)
+	}
+}
@@ -0,0 +1,241 @@
+// Package config resolves the settings shared by the eco commands and the
+// libraries they use.
+//
+// Settings come from, in increasing order of precedence: defaults,
+// a JSON configuration file, environment variables, and command-line flags.
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/jba/go-ecosystem/internal/diskcache"
+)
+
+// A Config holds settings. The comment on each field names the
+// environment variable that sets it. In the configuration file,
+// fields are named as in Go.
+type Config struct {
+	Dir         string // GOECODIR: directory for the database and other data
+	ProxyURL    string // ECO_PROXY_URL: module proxy URL, or a list of them in the syntax of GOPROXY
+	NoProxy     string // GONOPROXY, or else GOPRIVATE: module path patterns not to fetch from a proxy
+	NoSumDB     string // GONOSUMDB, or else GOPRIVATE: module path patterns not to check against the checksum database
+	IndexURL    string // GOINDEX: base URL of the module index, or of a mirror of it
+	ProxyQPS    int    // ECO_PROXY_QPS: maximum proxy requests per second; zero means the command's default
+	ProxyTries  int    // ECO_PROXY_TRIES: maximum attempts of each proxy request; zero means the default
+	CacheDir    string // ECO_CACHE_DIR: directory for cached proxy responses; empty means no caching
+	CacheSize   string // ECO_CACHE_SIZE: maximum size of CacheDir, like "5G"; empty means no limit
+	ZipDir      string // ECO_ZIP_DIR: directory for downloaded module zips
+	CorpusDir   string // ECO_CORPUS_DIR: directory for the corpus of trimmed module zips
+	CacheQuota  string // ECO_CACHE_QUOTA: maximum total size of the above directories, like "50G"; empty means no limit
+	Concurrency int    // ECO_CONCURRENCY: maximum concurrent operations per stage
+	Storage     string // ECO_STORAGE: storage backend; only "sqlite" is supported
+	DBDebug     bool   // ECODB_DEBUG: extra checks when opening the database
+
+	AllowedLicenses string // ECO_ALLOWED_LICENSES: comma-separated SPDX IDs; if set, only these licenses are allowed
+	DeniedLicenses  string // ECO_DENIED_LICENSES: comma-separated SPDX IDs of licenses that are not allowed
+
+	Webhooks string // ECO_WEBHOOKS: JSON file of webhooks to notify of events; see package notify
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		ProxyURL:    "https://proxy.golang.org/cached-only",
+		IndexURL:    "https://index.golang.org",
+		Concurrency: 10,
+		Storage:     "sqlite",
+	}
+}
+
+// FileName is the name of the configuration file in the data directory.
+const FileName = "config.json"
+
+// Load returns the configuration from the defaults, the file, and the environment.
+// If file is empty, the file named by the ECO_CONFIG environment variable is
+// used, or else $GOECODIR/config.json if it exists.
+func Load(file string) (*Config, error) {
+	c := Default()
+	mustExist := true
+	if file == "" {
+		file = os.Getenv("ECO_CONFIG")
+	}
+	if file == "" {
+		if dir := os.Getenv("GOECODIR"); dir != "" {
+			file = filepath.Join(dir, FileName)
+			mustExist = false
+		}
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil && (mustExist || !errors.Is(err, fs.ErrNotExist)) {
+			return nil, err
+		}
+		if err == nil {
+			var fc Config
+			if err := json.Unmarshal(data, &fc); err != nil {
+				return nil, fmt.Errorf("config file %s: %w", file, err)
+			}
+			c.Override(&fc)
+		}
+	}
+	ec, err := fromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	c.Override(ec)
+	return c, nil
+}
+
+// fromEnv returns the configuration set by environment variables.
+func fromEnv(getenv func(string) string) (*Config, error) {
+	c := &Config{
+		Dir:        getenv("GOECODIR"),
+		ProxyURL:   getenv("ECO_PROXY_URL"),
+		NoProxy:    cmp.Or(getenv("GONOPROXY"), getenv("GOPRIVATE")),
+		NoSumDB:    cmp.Or(getenv("GONOSUMDB"), getenv("GOPRIVATE")),
+		IndexURL:   getenv("GOINDEX"),
+		CacheDir:   getenv("ECO_CACHE_DIR"),
+		CacheSize:  getenv("ECO_CACHE_SIZE"),
+		ZipDir:     getenv("ECO_ZIP_DIR"),
+		CorpusDir:  getenv("ECO_CORPUS_DIR"),
+		CacheQuota: getenv("ECO_CACHE_QUOTA"),
+		Storage:    getenv("ECO_STORAGE"),
+		DBDebug:    getenv("ECODB_DEBUG") != "",
+
+		AllowedLicenses: getenv("ECO_ALLOWED_LICENSES"),
+		DeniedLicenses:  getenv("ECO_DENIED_LICENSES"),
+
+		Webhooks: getenv("ECO_WEBHOOKS"),
+	}
+	for _, v := range []struct {
+		name string
+		p    *int
+	}{
+		{"ECO_PROXY_QPS", &c.ProxyQPS},
+		{"ECO_PROXY_TRIES", &c.ProxyTries},
+		{"ECO_CONCURRENCY", &c.Concurrency},
+	} {
+		if s := getenv(v.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", v.name, err)
+			}
+			*v.p = n
+		}
+	}
+	return c, nil
+}
+
+// Override sets the fields of c to the non-zero fields of o.
+func (c *Config) Override(o *Config) {
+	set(&c.Dir, o.Dir)
+	set(&c.ProxyURL, o.ProxyURL)
+	set(&c.NoProxy, o.NoProxy)
+	set(&c.NoSumDB, o.NoSumDB)
+	set(&c.IndexURL, o.IndexURL)
+	set(&c.ProxyQPS, o.ProxyQPS)
+	set(&c.ProxyTries, o.ProxyTries)
+	set(&c.CacheDir, o.CacheDir)
+	set(&c.CacheSize, o.CacheSize)
+	set(&c.ZipDir, o.ZipDir)
+	set(&c.CorpusDir, o.CorpusDir)
+	set(&c.CacheQuota, o.CacheQuota)
+	set(&c.Concurrency, o.Concurrency)
+	set(&c.Storage, o.Storage)
+	set(&c.DBDebug, o.DBDebug)
+	set(&c.AllowedLicenses, o.AllowedLicenses)
+	set(&c.DeniedLicenses, o.DeniedLicenses)
+	set(&c.Webhooks, o.Webhooks)
+}
+
+func set[T comparable](p *T, v T) {
+	var zero T
+	if v != zero {
+		*p = v
+	}
+}
+
+// CacheDirs returns the non-empty cache directories, which are subject to
+// CacheQuota.
+func (c *Config) CacheDirs() []diskcache.Dir {
+	var dirs []diskcache.Dir
+	for _, d := range []diskcache.Dir{
+		{Name: "proxy", Path: c.CacheDir},
+		{Name: "zips", Path: c.ZipDir},
+		{Name: "corpus", Path: c.CorpusDir},
+	} {
+		if d.Path != "" {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// Validate reports an error if c's settings are unusable.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.ProxyURL == "" {
+		errs = append(errs, errors.New("missing proxy URL"))
+	}
+	if c.IndexURL == "" {
+		errs = append(errs, errors.New("missing index URL"))
+	}
+	if c.ProxyQPS < 0 {
+		errs = append(errs, fmt.Errorf("negative proxy QPS %d", c.ProxyQPS))
+	}
+	if c.ProxyTries < 0 {
+		errs = append(errs, fmt.Errorf("negative proxy tries %d", c.ProxyTries))
+	}
+	if c.Concurrency <= 0 {
+		errs = append(errs, fmt.Errorf("concurrency %d is not positive", c.Concurrency))
+	}
+	if c.CacheSize != "" {
+		if _, err := diskcache.ParseSize(c.CacheSize); err != nil {
+			errs = append(errs, fmt.Errorf("cache size: %w", err))
+		}
+	}
+	if c.CacheQuota != "" {
+		if _, err := diskcache.ParseSize(c.CacheQuota); err != nil {
+			errs = append(errs, fmt.Errorf("cache quota: %w", err))
+		}
+	}
+	if c.Storage != "sqlite" {
+		errs = append(errs, fmt.Errorf("unknown storage backend %q", c.Storage))
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	mu      sync.Mutex
+	current *Config
+)
+
+// Set makes c the configuration returned by [Current].
+func Set(c *Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = c
+}
+
+// Current returns the configuration passed to [Set], or if Set
+// has not been called, the result of Load("").
+func Current() (*Config, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		c, err := Load("")
+		if err != nil {
+			return nil, err
+		}
+		current = c
+	}
+	return current, nil
+}
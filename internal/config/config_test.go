@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"ProxyQPS": 5, "Concurrency": 3, "CacheDir": "/file"}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ECO_CONFIG", "")
+	t.Setenv("GOECODIR", dir)
+	t.Setenv("ECO_CONCURRENCY", "7")
+	t.Setenv("ECO_DENIED_LICENSES", "AGPL-3.0")
+	t.Setenv("GOPRIVATE", "corp.example.com")
+	t.Setenv("GONOPROXY", "")
+	t.Setenv("GONOSUMDB", "*.example.com")
+	t.Setenv("GOINDEX", "https://index.example.com")
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// Flags override everything.
+	c.Override(&Config{CacheDir: "/flag"})
+	want := Config{
+		Dir:         dir,
+		ProxyURL:    Default().ProxyURL,
+		NoProxy:     "corp.example.com", // GOPRIVATE
+		NoSumDB:     "*.example.com",
+		IndexURL:    "https://index.example.com",
+		ProxyQPS:    5, // file
+		CacheDir:    "/flag",
+		Concurrency: 7, // environment beats file
+		Storage:     "sqlite",
+
+		DeniedLicenses: "AGPL-3.0",
+	}
+	if *c != want {
+		t.Errorf("got  %+v\nwant %+v", *c, want)
+	}
+
+	t.Setenv("ECO_PROXY_QPS", "x")
+	if _, err := Load(""); err == nil {
+		t.Error("want error for bad ECO_PROXY_QPS")
+	}
+	t.Setenv("ECO_PROXY_QPS", "")
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("want error for missing explicit file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.Storage = "postgres"
+	c.Concurrency = 0
+	if err := c.Validate(); err == nil {
+		t.Error("want error")
+	}
+}
@@ -0,0 +1,61 @@
+// Package corpustest helps test code that reads the corpus of module zips.
+package corpustest
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jba/go-ecosystem/modfs"
+)
+
+// WriteZip writes a zip of path@version with the given files, keyed by their
+// paths relative to the module root, into the corpus at dir, at the place
+// given by [modfs.ZipPath].
+func WriteZip(t testing.TB, dir, path, version string, files map[string]string) {
+	t.Helper()
+	zipFile, err := modfs.ZipPath(dir, path, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(zipFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(zipFile, Zip(t, path, version, files), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Zip returns the contents of a zip of path@version with the given files,
+// keyed by their paths relative to the module root.
+func Zip(t testing.TB, path, version string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := zw.Create(path + "@" + version + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ZipReader returns a reader for the zip returned by [Zip].
+func ZipReader(t testing.TB, path, version string, files map[string]string) *zip.Reader {
+	t.Helper()
+	data := Zip(t, path, version, files)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
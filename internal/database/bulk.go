@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// maxVariables is the largest number of parameters SQLite allows in a
+// statement (SQLITE_MAX_VARIABLE_NUMBER, as of SQLite 3.32).
+const maxVariables = 32766
+
+// BulkInsert inserts rows into table, batchSize rows per INSERT statement.
+// Each row must have one value for each of cols.
+// Batches are made smaller if necessary to stay under SQLite's limit on
+// the number of variables in a statement.
+// BulkInsert returns the number of rows inserted.
+func BulkInsert(ctx context.Context, tx *sql.Tx, table string, cols []string, rows iter.Seq[[]any], batchSize int) (n int64, err error) {
+	defer errs.Wrap(&err, "BulkInsert(%s)", table)
+
+	if len(cols) == 0 {
+		return 0, fmt.Errorf("no columns")
+	}
+	batchSize = min(max(batchSize, 1), maxVariables/len(cols))
+	b := &bulkInserter{
+		tx:     tx,
+		prefix: fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, strings.Join(cols, ", ")),
+		row:    "(" + strings.Repeat("?, ", len(cols)-1) + "?)",
+		ncols:  len(cols),
+	}
+	args := make([]any, 0, batchSize*len(cols))
+	for row := range rows {
+		if len(row) != len(cols) {
+			return n, fmt.Errorf("row has %d values, want %d", len(row), len(cols))
+		}
+		args = append(args, row...)
+		if len(args) == cap(args) {
+			if err := b.insert(ctx, args); err != nil {
+				return n, err
+			}
+			n += int64(batchSize)
+			args = args[:0]
+		}
+	}
+	if len(args) > 0 {
+		if err := b.insert(ctx, args); err != nil {
+			return n, err
+		}
+		n += int64(len(args) / len(cols))
+	}
+	return n, nil
+}
+
+type bulkInserter struct {
+	tx     *sql.Tx
+	prefix string // INSERT INTO ... VALUES
+	row    string // placeholders for one row
+	ncols  int
+}
+
+// insert inserts the rows whose values are in args with a single statement.
+// If SQLite rejects the statement because it has too many variables,
+// insert splits the rows in half and tries again.
+func (b *bulkInserter) insert(ctx context.Context, args []any) error {
+	nrows := len(args) / b.ncols
+	var sb strings.Builder
+	sb.WriteString(b.prefix)
+	for i := range nrows {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(b.row)
+	}
+	// Record all batches together.
+	_, err := exec(ctx, b.tx, b.prefix+b.row+", ...", sb.String(), args...)
+	if err != nil && nrows > 1 && strings.Contains(err.Error(), "too many SQL variables") {
+		mid := nrows / 2 * b.ncols
+		if err := b.insert(ctx, args[:mid]); err != nil {
+			return err
+		}
+		return b.insert(ctx, args[mid:])
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"iter"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BusyTimeout is how long the retrying functions in this package keep trying
+// when the database is busy, if the context has no earlier deadline.
+var BusyTimeout = 30 * time.Second
+
+// SQLite result codes.
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// IsBusy reports whether err means the database was busy or locked by
+// another connection, so the operation may succeed if retried.
+func IsBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	// The modernc.org/sqlite driver's errors have a Code method.
+	var c interface{ Code() int }
+	if errors.As(err, &c) {
+		code := c.Code() & 0xff // primary code of an extended result code
+		return code == sqliteBusy || code == sqliteLocked
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "SQLITE_BUSY") ||
+		strings.Contains(msg, "SQLITE_LOCKED") ||
+		strings.Contains(msg, "database is locked") ||
+		strings.Contains(msg, "database table is locked")
+}
+
+// RetryBusy calls f until it returns an error for which [IsBusy] is false,
+// backing off between attempts. It gives up when ctx is done or after
+// [BusyTimeout], returning the last error.
+// Since f may be called more than once, it should have no side effects
+// other than on the database.
+func RetryBusy(ctx context.Context, f func() error) error {
+	return retry(ctx, IsBusy, f)
+}
+
+// retry calls f until it returns an error for which retryable is false,
+// as described in [RetryBusy].
+func retry(ctx context.Context, retryable func(error) bool, f func() error) error {
+	ctx, cancel := context.WithTimeout(ctx, BusyTimeout)
+	defer cancel()
+	backoff := 10 * time.Millisecond
+	for {
+		err := f()
+		if err == nil || !retryable(err) {
+			return err
+		}
+		// Sleep for a random duration in [backoff/2, backoff).
+		d := backoff/2 + rand.N(backoff/2)
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff = min(2*backoff, time.Second)
+	}
+}
+
+// ExecRetry is like db.ExecContext, but retries with [RetryBusy].
+func ExecRetry(ctx context.Context, db Execer, query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := RetryBusy(ctx, func() error {
+		var err error
+		res, err = exec(ctx, db, query, query, args...)
+		return err
+	})
+	return res, err
+}
+
+// ScanRowsOfRetry is like [ScanRowsOf], but it returns the results in a
+// slice, and runs the query again with [RetryBusy] if the database is busy.
+func ScanRowsOfRetry[T any](ctx context.Context, db Querier, query string, params ...any) ([]T, error) {
+	return collectRetry(ctx, func() (iter.Seq[T], func() error) {
+		return ScanRowsOf[T](ctx, db, query, params...)
+	})
+}
+
+// ScanRowsAsRetry is like [ScanRowsAs], but it returns the results in a
+// slice, and runs the query again with [RetryBusy] if the database is busy.
+func ScanRowsAsRetry[T any](ctx context.Context, db Querier, query string, params ...any) ([]*T, error) {
+	return collectRetry(ctx, func() (iter.Seq[*T], func() error) {
+		return ScanRowsAs[T](ctx, db, query, params...)
+	})
+}
+
+// collectRetry collects the results of scan, calling it again with
+// [RetryBusy] if it fails because the database is busy.
+func collectRetry[T any](ctx context.Context, scan func() (iter.Seq[T], func() error)) ([]T, error) {
+	var xs []T
+	err := RetryBusy(ctx, func() error {
+		seq, errf := scan()
+		xs = slices.Collect(seq)
+		return errf()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return xs, nil
+}
+
+// isSerializationFailure reports whether err is a PostgreSQL serialization
+// failure (SQLSTATE 40001), meaning the transaction may succeed if retried.
+func isSerializationFailure(err error) bool {
+	var s interface{ SQLState() string }
+	if errors.As(err, &s) {
+		return s.SQLState() == "40001"
+	}
+	return strings.Contains(err.Error(), "could not serialize access")
+}
@@ -3,30 +3,53 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"iter"
+	"time"
 
+	"github.com/jba/go-ecosystem/internal/errs"
 	"github.com/jba/go-ecosystem/internal/jiter"
+	"modernc.org/sqlite"
 )
 
-func ScanRows(ctx context.Context, db *sql.DB, query string, params ...any) (iter.Seq[*sql.Rows], func() error) {
+// A Querier is a *sql.DB, *sql.Tx or *sql.Conn.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func ScanRows(ctx context.Context, db Querier, query string, params ...any) (iter.Seq[*sql.Rows], func() error) {
 	var es jiter.ErrorState
 	return func(yield func(*sql.Rows) bool) {
+		var (
+			n   int64
+			dur time.Duration // time spent in the database, not in yield
+			err error
+		)
+		defer func() { record(ctx, query, dur, n, err) }()
+
+		start := time.Now()
 		rows, err := db.QueryContext(ctx, query, params...)
 		if err != nil {
+			dur = time.Since(start)
 			es.Set(err)
 			return
 		}
 		defer rows.Close()
 		for rows.Next() {
+			dur += time.Since(start)
+			n++
 			if !yield(rows) {
 				return
 			}
+			start = time.Now()
 		}
-		es.Set(rows.Err())
+		dur += time.Since(start)
+		err = rows.Err()
+		es.Set(err)
 	}, es.Func()
 }
 
-func ScanRowsOf[T any](ctx context.Context, db *sql.DB, query string, params ...any) (iter.Seq[T], func() error) {
+func ScanRowsOf[T any](ctx context.Context, db Querier, query string, params ...any) (iter.Seq[T], func() error) {
 	var es jiter.ErrorState
 	return func(yield func(T) bool) {
 		iter, errf := ScanRows(ctx, db, query, params...)
@@ -44,14 +67,72 @@ func ScanRowsOf[T any](ctx context.Context, db *sql.DB, query string, params ...
 	}, es.Func()
 }
 
+// Transaction calls f in a transaction, committing if f returns nil
+// and rolling back otherwise.
 func Transaction(db *sql.DB, f func(*sql.Tx) error) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
+	return TransactionContext(context.Background(), db, nil, f)
+}
+
+// TxOptions holds options for [TransactionContext].
+type TxOptions struct {
+	sql.TxOptions // isolation level and read-only flag
+
+	// If Retry is true, the entire transaction, including the call to f, is
+	// retried if it fails because the database is busy or because of a
+	// serialization failure. See [RetryBusy].
+	Retry bool
+}
+
+// TransactionContext is like [Transaction], but begins the transaction with
+// ctx and opts, which may be nil. If ctx is canceled before the transaction
+// is committed, it is rolled back.
+func TransactionContext(ctx context.Context, db *sql.DB, opts *TxOptions, f func(*sql.Tx) error) error {
+	if opts == nil {
+		opts = &TxOptions{}
 	}
-	defer tx.Rollback()
-	if err := f(tx); err != nil {
-		return err
+	run := func() (err error) {
+		begin := db.BeginTx
+		if opts.ReadOnly && isSQLite(db) {
+			// The SQLite driver ignores ReadOnly, so make the connection
+			// read-only for the duration of the transaction.
+			var conn *sql.Conn
+			conn, err = db.Conn(ctx)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			if _, err := conn.ExecContext(ctx, "PRAGMA query_only = 1"); err != nil {
+				return err
+			}
+			defer errs.Cleanup(&err, func() error {
+				_, err := conn.ExecContext(context.WithoutCancel(ctx), "PRAGMA query_only = 0")
+				if err != nil {
+					// Discard the connection rather than return it to
+					// the pool read-only.
+					conn.Raw(func(any) error { return driver.ErrBadConn })
+				}
+				return err
+			})
+			begin = conn.BeginTx
+		}
+		tx, err := begin(ctx, &opts.TxOptions)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := f(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if opts.Retry {
+		return retry(ctx, func(err error) bool { return IsBusy(err) || isSerializationFailure(err) }, run)
 	}
-	return tx.Commit()
+	return run()
+}
+
+// isSQLite reports whether db uses the modernc.org/sqlite driver.
+func isSQLite(db *sql.DB) bool {
+	_, ok := db.Driver().(*sqlite.Driver)
+	return ok
 }
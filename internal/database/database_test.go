@@ -0,0 +1,834 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestBulkInsert(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		nrows, batchSize int
+	}{
+		{0, 10},
+		{1, 10},
+		{25, 10},
+		{30, 10},
+		{100, 0},
+		{20000, 20000}, // more variables than SQLite allows
+	} {
+		t.Run(fmt.Sprintf("%d-%d", test.nrows, test.batchSize), func(t *testing.T) {
+			db := openTestDB(t)
+			rows := func(yield func([]any) bool) {
+				for i := range test.nrows {
+					if !yield([]any{fmt.Sprint(i), i}) {
+						return
+					}
+				}
+			}
+			var n int64
+			err := Transaction(db, func(tx *sql.Tx) error {
+				var err error
+				n, err = BulkInsert(ctx, tx, "t", []string{"name", "n"}, iter.Seq[[]any](rows), test.batchSize)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(test.nrows) {
+				t.Errorf("BulkInsert returned %d, want %d", n, test.nrows)
+			}
+			var count, sum int
+			if err := db.QueryRow("SELECT COUNT(*), COALESCE(SUM(n), 0) FROM t").Scan(&count, &sum); err != nil {
+				t.Fatal(err)
+			}
+			if count != test.nrows || sum != test.nrows*(test.nrows-1)/2 {
+				t.Errorf("got count %d, sum %d", count, sum)
+			}
+		})
+	}
+}
+
+func TestBulkInsertBadRow(t *testing.T) {
+	db := openTestDB(t)
+	err := Transaction(db, func(tx *sql.Tx) error {
+		rows := func(yield func([]any) bool) { yield([]any{"x"}) }
+		_, err := BulkInsert(context.Background(), tx, "t", []string{"name", "n"}, rows, 10)
+		return err
+	})
+	if err == nil {
+		t.Error("got nil, want error")
+	}
+}
+
+func TestScanRowsAs(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Exec("INSERT INTO t (name, n) VALUES ('a', 1), ('b', 2)"); err != nil {
+		t.Fatal(err)
+	}
+	type row struct {
+		ID    int64
+		Name  string
+		Count int `db:"n"`
+		Other string
+	}
+	ctx := context.Background()
+	var got []row
+	rows, errf := ScanRowsAs[row](ctx, db, "SELECT * FROM t ORDER BY id")
+	for r := range rows {
+		got = append(got, *r)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	want := []row{{1, "a", 1, ""}, {2, "b", 2, ""}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A column without a field is an error.
+	type short struct{ Name string }
+	rows2, errf := ScanRowsAs[short](ctx, db, "SELECT * FROM t")
+	for range rows2 {
+	}
+	if errf() == nil {
+		t.Error("got nil, want error for unmatched column")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for _, test := range []struct{ in, want string }{
+		{"ID", "id"},
+		{"Path", "path"},
+		{"LatestVersion", "latest_version"},
+		{"InfoTime", "info_time"},
+		{"HTTPServer", "http_server"},
+		{"ModuleID", "module_id"},
+	} {
+		if got := snakeCase(test.in); got != test.want {
+			t.Errorf("snakeCase(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	if _, err := db.Exec("CREATE UNIQUE INDEX t_name ON t (name)"); err != nil {
+		t.Fatal(err)
+	}
+	cols := []string{"name", "n"}
+	for _, args := range [][]any{{"a", 1}, {"b", 2}, {"a", 3}} {
+		if _, err := Upsert(ctx, db, "t", []string{"name"}, cols, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	rows, errf := ScanRowsAs[struct {
+		Name string
+		N    int
+	}](ctx, db, "SELECT name, n FROM t ORDER BY name")
+	for r := range rows {
+		got = append(got, fmt.Sprintf("%s=%d", r.Name, r.N))
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a=3", "b=2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := Upsert(ctx, db, "t", []string{"name"}, cols, "c"); err == nil {
+		t.Error("got nil, want error for wrong number of args")
+	}
+}
+
+func TestUpsertStmt(t *testing.T) {
+	for _, test := range []struct {
+		keys, cols []string
+		want       string
+	}{
+		{
+			[]string{"name"}, []string{"name", "value"},
+			"INSERT INTO t (name, value) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value",
+		},
+		{
+			[]string{"a", "b"}, []string{"a", "b"},
+			"INSERT INTO t (a, b) VALUES (?, ?) ON CONFLICT (a, b) DO NOTHING",
+		},
+	} {
+		if got := UpsertStmt("t", test.keys, test.cols); got != test.want {
+			t.Errorf("got\n%s\nwant\n%s", got, test.want)
+		}
+	}
+}
+
+func TestRetryBusy(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *sql.DB {
+		db, err := sql.Open("sqlite", filepath.Join(dir, "db.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	db1 := open()
+	db2 := open()
+	if _, err := db1.Exec("CREATE TABLE t (x INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold a write lock with db1.
+	tx, err := db1.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	_, err = db2.ExecContext(ctx, "INSERT INTO t VALUES (2)")
+	if !IsBusy(err) {
+		t.Fatalf("got %v, want busy error", err)
+	}
+
+	// Release the lock while ExecRetry is retrying.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tx.Commit()
+	}()
+	if _, err := ExecRetry(ctx, db2, "INSERT INTO t VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db1.QueryRow("SELECT COUNT(*) FROM t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d rows, want 2", n)
+	}
+
+	// The same for a query.
+	tx, err = db1.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO t VALUES (3)"); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tx.Commit()
+	}()
+	got, err := ScanRowsOfRetry[int](ctx, db2, "UPDATE t SET x = x + 10 WHERE x = 2 RETURNING x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{12}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNamed(t *testing.T) {
+	type params struct {
+		Path          string
+		LatestVersion string
+		Limit         int `db:"lim"`
+	}
+	p := params{"m", "v1", 5}
+	for _, test := range []struct {
+		query     string
+		arg       any
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			"SELECT * FROM t WHERE path = :path AND v = :latest_version LIMIT :lim",
+			p,
+			"SELECT * FROM t WHERE path = ? AND v = ? LIMIT ?",
+			[]any{"m", "v1", 5},
+		},
+		{
+			"SELECT :a, ':a', \":a\", x::text, :a -- :a\n/* :a */",
+			map[string]any{"a": 1},
+			"SELECT ?, ':a', \":a\", x::text, ? -- :a\n/* :a */",
+			[]any{1, 1},
+		},
+		{"SELECT 'it''s' WHERE x = :path", &p, "SELECT 'it''s' WHERE x = ?", []any{"m"}},
+	} {
+		gotQuery, gotArgs, err := Named(test.query, test.arg)
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		if gotQuery != test.wantQuery || !slices.Equal(gotArgs, test.wantArgs) {
+			t.Errorf("%q:\ngot  %q, %v\nwant %q, %v", test.query, gotQuery, gotArgs, test.wantQuery, test.wantArgs)
+		}
+	}
+
+	for _, test := range []struct {
+		query string
+		arg   any
+	}{
+		{"SELECT :missing", p},
+		{"SELECT :a", 3},
+		{"SELECT ':a", map[string]any{"a": 1}},
+	} {
+		if _, _, err := Named(test.query, test.arg); err == nil {
+			t.Errorf("%q, %v: got nil, want error", test.query, test.arg)
+		}
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	fsys := fstest.MapFS{
+		"m/001_a.up.sql":   {Data: []byte("CREATE TABLE a (x INTEGER)")},
+		"m/001_a.down.sql": {Data: []byte("DROP TABLE a")},
+		"m/002_b.up.sql":   {Data: []byte("CREATE TABLE b (x INTEGER)")},
+		"m/README":         {Data: []byte("ignored")},
+	}
+	migs, err := MigrationsFromFS(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migs = append(migs, Migration{
+		Version: 3,
+		Name:    "go",
+		Up: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO a VALUES (1)")
+			return err
+		},
+	})
+
+	status := func(m *Migrator) string {
+		t.Helper()
+		ss, err := m.Status(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		for _, s := range ss {
+			fmt.Fprintf(&b, "%d%s:%t ", s.Version, s.Name, s.Applied)
+		}
+		return b.String()
+	}
+
+	// A dry run doesn't change anything.
+	var buf bytes.Buffer
+	m := &Migrator{DB: db, Migrations: migs, DryRun: &buf}
+	n, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("dry run: got %d, want 3", n)
+	}
+	if !strings.Contains(buf.String(), "CREATE TABLE b") {
+		t.Errorf("dry run output missing SQL:\n%s", buf.String())
+	}
+	m.DryRun = nil
+	if got, want := status(m), "1a:false 2b:false 3go:false "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := status(m), "1a:true 2b:true 3go:true "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Applying again does nothing.
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Errorf("got %d, %v; want 0, nil", n, err)
+	}
+	// Migration 3 has no down.
+	if err := m.Down(ctx, 1); err == nil {
+		t.Error("got nil, want error")
+	}
+
+	m.Migrations = migs[:2]
+	if err := m.Down(ctx, 1); err == nil {
+		t.Error("got nil, want error for migration 2 with no down")
+	}
+	m.Migrations = migs[:1]
+	// Migration 1 is the last known, so it's reverted.
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := status(m), "1a:false 2b:true 3go:true "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStmtCache(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	c := NewStmtCache(db, 2)
+	defer c.Close()
+
+	queries := []string{
+		"INSERT INTO t (name, n) VALUES (?, 1)",
+		"INSERT INTO t (name, n) VALUES (?, 2)",
+		"INSERT INTO t (name, n) VALUES (?, 3)",
+	}
+	for i, q := range append(queries, queries...) {
+		if _, err := c.ExecContext(ctx, q, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := c.Len(), min(i+1, 2); got != want {
+			t.Errorf("after %d: Len = %d, want %d", i, got, want)
+		}
+	}
+
+	err := Transaction(db, func(tx *sql.Tx) error {
+		for _, q := range queries {
+			if _, err := Upsert(ctx, c.InTx(tx), "t", []string{"id"}, []string{"name", "n"}, "tx", 0); err != nil {
+				return err
+			}
+			if _, err := c.InTx(tx).ExecContext(ctx, q, "tx"); err != nil {
+				return err
+			}
+		}
+		return errors.New("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatalf("got %v, want rollback", err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("got %d rows, want 6 (the transaction should have rolled back)", n)
+	}
+}
+
+func TestTransactionContext(t *testing.T) {
+	db := openTestDB(t)
+
+	// A read-only transaction can't write.
+	err := TransactionContext(context.Background(), db, &TxOptions{TxOptions: sql.TxOptions{ReadOnly: true}},
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO t (name, n) VALUES ('a', 1)")
+			return err
+		})
+	if err == nil {
+		t.Error("read-only: got nil, want error")
+	}
+	if !isSQLite(db) {
+		t.Error("isSQLite: got false, want true")
+	}
+	// The connection is writable again afterwards.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE TABLE u (x)"); err != nil {
+		t.Errorf("after read-only: %v", err)
+	}
+	db.SetMaxOpenConns(0)
+
+	// Cancellation rolls back.
+	ctx, cancel := context.WithCancel(context.Background())
+	err = TransactionContext(ctx, db, nil, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO t (name, n) VALUES ('a', 1)"); err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	})
+	if err == nil {
+		t.Error("canceled: got nil, want error")
+	}
+
+	// Busy errors are retried.
+	calls := 0
+	err = TransactionContext(context.Background(), db, &TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		calls++
+		if calls < 3 {
+			return errors.New("database is locked (5) (SQLITE_BUSY)")
+		}
+		_, err := tx.Exec("INSERT INTO t (name, n) VALUES ('b', 2)")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+	var names []string
+	rows, errf := ScanRowsOf[string](context.Background(), db, "SELECT name FROM t")
+	for n := range rows {
+		names = append(names, n)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b"}; !slices.Equal(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	count := func() int {
+		t.Helper()
+		// The Writer may be committing.
+		ns, err := ScanRowsOfRetry[int](ctx, db, "SELECT COUNT(*) FROM t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ns[0]
+	}
+
+	var batchSizes []int // accessed only by the Writer's goroutine until Close
+	w := NewWriter(ctx, db, 3, 0, func(ctx context.Context, tx *sql.Tx, names []string) error {
+		batchSizes = append(batchSizes, len(names))
+		for _, name := range names {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO t (name) VALUES (?)", name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for i := range 4 {
+		if err := w.Write(ctx, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(); got != 4 {
+		t.Errorf("after Flush: got %d rows, want 4", got)
+	}
+	if err := w.Write(ctx, "last"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(); got != 5 {
+		t.Errorf("after Close: got %d rows, want 5", got)
+	}
+	if want := []int{3, 1, 1}; !slices.Equal(batchSizes, want) {
+		t.Errorf("batch sizes: got %v, want %v", batchSizes, want)
+	}
+	if err := w.Write(ctx, "x"); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Write after Close: got %v, want ErrWriterClosed", err)
+	}
+
+	// Errors are reported.
+	errBad := errors.New("bad")
+	w = NewWriter(ctx, db, 1, 0, func(context.Context, *sql.Tx, []string) error { return errBad })
+	w.Write(ctx, "a")
+	if err := w.Close(); !errors.Is(err, errBad) {
+		t.Errorf("got %v, want %v", err, errBad)
+	}
+
+	// A partial batch is written after the maximum delay.
+	w = NewWriter(ctx, db, 100, 10*time.Millisecond, func(ctx context.Context, tx *sql.Tx, names []string) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO t (name) VALUES ('delayed')")
+		return err
+	})
+	defer w.Close()
+	w.Write(ctx, "a")
+	for range 100 {
+		if count() == 6 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("partial batch was not written")
+}
+
+func TestQuery(t *testing.T) {
+	for _, test := range []struct {
+		q        *Query
+		want     string
+		wantArgs []any
+	}{
+		{Select("t"), "SELECT * FROM t", nil},
+		{
+			Select("t", "a", "b").Where("a = ?", 1).Where("b > ? OR b < ?", 2, 3).OrderBy("a", "b DESC").Limit(10),
+			"SELECT a, b FROM t WHERE (a = ?) AND (b > ? OR b < ?) ORDER BY a, b DESC LIMIT ?",
+			[]any{1, 2, 3, 10},
+		},
+		{
+			Select("t").WhereIf(false, "a = ?", 1).WhereIf(true, "b = ?", 2).Offset(5),
+			"SELECT * FROM t WHERE b = ? LIMIT ? OFFSET ?",
+			[]any{2, -1, 5},
+		},
+	} {
+		got, gotArgs := test.q.SQL()
+		if got != test.want || !slices.Equal(gotArgs, test.wantArgs) {
+			t.Errorf("got  %q, %v\nwant %q, %v", got, gotArgs, test.want, test.wantArgs)
+		}
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	db := openTestDB(t)
+	errBad := errors.New("bad")
+	insert := func(tx *sql.Tx, name string) error {
+		_, err := tx.Exec("INSERT INTO t (name) VALUES (?)", name)
+		return err
+	}
+	err := Transaction(db, func(tx *sql.Tx) error {
+		if err := insert(tx, "a"); err != nil {
+			return err
+		}
+		err := Savepoint(tx, "s1", func(tx *sql.Tx) error {
+			if err := insert(tx, "b"); err != nil {
+				return err
+			}
+			// Nested savepoint succeeds, but the outer one fails.
+			if err := Savepoint(tx, "s2", func(tx *sql.Tx) error { return insert(tx, "c") }); err != nil {
+				return err
+			}
+			return errBad
+		})
+		if !errors.Is(err, errBad) {
+			t.Errorf("got %v, want %v", err, errBad)
+		}
+		if err := Savepoint(tx, "s3", func(tx *sql.Tx) error { return insert(tx, "d") }); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	rows, errf := ScanRowsOf[string](context.Background(), db, "SELECT name FROM t ORDER BY name")
+	for n := range rows {
+		names = append(names, n)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "d"}; !slices.Equal(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	if err := Transaction(db, func(tx *sql.Tx) error {
+		return Savepoint(tx, "bad name", func(*sql.Tx) error { return nil })
+	}); err == nil {
+		t.Error("got nil, want error for bad name")
+	}
+}
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	ResetStats()
+	for _, name := range []string{"a", "b"} {
+		if _, err := Upsert(ctx, db, "t", []string{"id"}, []string{"name"}, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, errf := ScanRowsOf[string](ctx, db, "SELECT name FROM t")
+	for range rows {
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]QueryStats{}
+	for _, s := range Stats() {
+		got[s.Query] = s
+	}
+	if s := got[UpsertStmt("t", []string{"id"}, []string{"name"})]; s.Count != 2 || s.Rows != 2 {
+		t.Errorf("upsert: got %+v, want 2 executions and 2 rows", s)
+	}
+	if s := got["SELECT name FROM t"]; s.Count != 1 || s.Rows != 2 || s.Total <= 0 {
+		t.Errorf("select: got %+v, want 1 execution and 2 rows", s)
+	}
+	var buf bytes.Buffer
+	if err := WriteStats(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("WriteStats wrote %d lines, want 2:\n%s", n, buf.String())
+	}
+}
+
+func TestHandle(t *testing.T) {
+	ctx := context.Background()
+	// The name is escaped in the driver's URI.
+	dir := filepath.Join(t.TempDir(), "a?b#c%d")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	h, err := OpenHandle(filepath.Join(dir, "db.sqlite"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if _, err := h.Write.Exec("CREATE TABLE t (x INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	var mode string
+	if err := h.Read.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal mode: got %q, want wal", mode)
+	}
+	if _, err := h.Read.Exec("INSERT INTO t VALUES (1)"); err == nil {
+		t.Error("write to Read: got nil, want error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "db.sqlite")); err != nil {
+		t.Error(err)
+	}
+
+	// A reader doesn't block the writer, and sees a consistent snapshot.
+	err = TransactionContext(ctx, h.Read, nil, func(rtx *sql.Tx) error {
+		count := func() (n int) {
+			if err := rtx.QueryRow("SELECT COUNT(*) FROM t").Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			return n
+		}
+		before := count()
+		if _, err := h.Write.Exec("INSERT INTO t VALUES (1)"); err != nil {
+			return err
+		}
+		if after := count(); after != before {
+			t.Errorf("reader saw count change from %d to %d", before, after)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyColumns(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	cols, err := TableColumns(ctx, db, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Column{
+		{Name: "id", Type: "INTEGER", PrimaryKey: 1},
+		{Name: "name", Type: "TEXT"},
+		{Name: "n", Type: "INTEGER"},
+	}
+	if !slices.Equal(cols, want) {
+		t.Errorf("got %+v, want %+v", cols, want)
+	}
+
+	type good struct {
+		ID   int64
+		Name string
+		N    int
+	}
+	if err := VerifyColumns[good](ctx, db, "t"); err != nil {
+		t.Error(err)
+	}
+	type bad struct {
+		ID    int64
+		Name  string
+		Extra string
+	}
+	err = VerifyColumns[bad](ctx, db, "t")
+	if err == nil || !strings.Contains(err.Error(), `column "n" has no field`) || !strings.Contains(err.Error(), `"extra" has no column`) {
+		t.Errorf("got %v, want errors about n and extra", err)
+	}
+	if err := VerifyColumns[bad](ctx, db, "missing"); err != nil {
+		t.Errorf("missing table: %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	create := func(name string, names ...string) *sql.DB {
+		db, err := sql.Open("sqlite", filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT UNIQUE, n INTEGER)"); err != nil {
+			t.Fatal(err)
+		}
+		for i, name := range names {
+			if _, err := db.Exec("INSERT INTO t (name, n) VALUES (?, ?)", name, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return db
+	}
+	dst := create("dst.db", "a", "b")
+	create("s1.db", "b", "c")
+	create("s2.db", "d")
+
+	contents := func() []string {
+		var got []string
+		rows, errf := ScanRowsAs[struct {
+			Name string
+			N    int
+		}](ctx, dst, "SELECT name, n FROM t ORDER BY name")
+		for r := range rows {
+			got = append(got, fmt.Sprintf("%s%d", r.Name, r.N))
+		}
+		if err := errf(); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	srcs := []string{filepath.Join(dir, "s1.db"), filepath.Join(dir, "s2.db")}
+	err := Merge(ctx, dst, srcs, []MergeTable{{Name: "t", Omit: []string{"id"}, OnConflict: Abort}})
+	if err == nil {
+		t.Fatal("Abort: got nil, want error")
+	}
+	if got, want := contents(), []string{"a0", "b1"}; !slices.Equal(got, want) {
+		t.Errorf("after failed merge: got %v, want %v", got, want)
+	}
+
+	err = Merge(ctx, dst, srcs, []MergeTable{{Name: "t", Omit: []string{"id"}, OnConflict: Ignore}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := contents(), []string{"a0", "b1", "c1", "d0"}; !slices.Equal(got, want) {
+		t.Errorf("Ignore: got %v, want %v", got, want)
+	}
+
+	err = Merge(ctx, dst, srcs[:1], []MergeTable{{Name: "t", Omit: []string{"id"}, OnConflict: Replace}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := contents(), []string{"a0", "b0", "c1", "d0"}; !slices.Equal(got, want) {
+		t.Errorf("Replace: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+// A Handle provides separate access for reading and writing an SQLite
+// database, so that long-running reads don't contend with writes.
+//
+// Write has a single connection, so writes are serialized by database/sql
+// instead of failing with SQLITE_BUSY. Its transactions begin with
+// BEGIN IMMEDIATE, so they take the write lock at the start.
+//
+// Read has a pool of read-only connections. The database is put in WAL mode,
+// so readers see a consistent snapshot and are not blocked by the writer.
+type Handle struct {
+	Write *sql.DB
+	Read  *sql.DB
+}
+
+// busyTimeout is how long an SQLite connection waits for a lock.
+const busyTimeout = 10 * time.Second
+
+// OpenHandle opens the SQLite database in the named file, with at most
+// maxReaders read connections.
+func OpenHandle(filename string, maxReaders int) (*Handle, error) {
+	wdsn, err := sqliteDSN(filename, url.Values{
+		"_pragma": {"journal_mode(WAL)", "synchronous(NORMAL)", "foreign_keys(1)"},
+		"_txlock": {"immediate"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rdsn, err := sqliteDSN(filename, url.Values{
+		"_pragma": {"query_only(1)"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	w, err := sql.Open("sqlite", wdsn)
+	if err != nil {
+		return nil, err
+	}
+	w.SetMaxOpenConns(1)
+	// Apply the pragmas now, so WAL mode is set before any reader connects.
+	if err := w.Ping(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	r, err := sql.Open("sqlite", rdsn)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	r.SetMaxOpenConns(max(maxReaders, 1))
+	return &Handle{Write: w, Read: r}, nil
+}
+
+// sqliteDSN returns a data source name for the modernc.org/sqlite driver
+// with the given parameters, and a busy timeout. It is a file: URI, so
+// that characters like '?' and '#' in the path are escaped.
+func sqliteDSN(filename string, params url.Values) (string, error) {
+	// A relative path would be taken for the URI's authority.
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: params.Encode()}
+	return u.String(), nil
+}
+
+// Close closes both databases.
+func (h *Handle) Close() error {
+	return errors.Join(h.Write.Close(), h.Read.Close())
+}
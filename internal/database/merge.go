@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// A ConflictPolicy says what to do when a merged row conflicts with an
+// existing one.
+type ConflictPolicy int
+
+const (
+	Abort   ConflictPolicy = iota // fail the merge
+	Ignore                        // keep the existing row
+	Replace                       // replace the existing row
+)
+
+func (p ConflictPolicy) sql() string {
+	switch p {
+	case Ignore:
+		return "OR IGNORE"
+	case Replace:
+		return "OR REPLACE"
+	default:
+		return "OR ABORT"
+	}
+}
+
+// A MergeTable describes how to merge a table.
+type MergeTable struct {
+	Name string
+	// Omit lists columns that are not copied, such as an INTEGER PRIMARY KEY
+	// that should be assigned anew in the destination.
+	Omit       []string
+	OnConflict ConflictPolicy
+}
+
+// Merge copies the rows of tables from each of the SQLite databases in
+// srcPaths into dst, which must also be SQLite. Each source is attached to
+// dst and merged in a single transaction, so a failure leaves dst with the
+// sources before it fully merged and the rest not merged at all.
+//
+// Merge does not translate foreign keys, so tables that refer to omitted
+// columns of other tables cannot be merged correctly.
+func Merge(ctx context.Context, dst *sql.DB, srcPaths []string, tables []MergeTable) error {
+	// ATTACH applies to a connection, so use the same one throughout.
+	conn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, src := range srcPaths {
+		if err := mergeOne(ctx, conn, src, tables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const mergeSchema = "merge_src"
+
+func mergeOne(ctx context.Context, conn *sql.Conn, src string, tables []MergeTable) (err error) {
+	defer errs.Wrap(&err, "merging %s", src)
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS "+mergeSchema, src); err != nil {
+		return err
+	}
+	defer errs.Cleanup(&err, func() error {
+		_, err := conn.ExecContext(context.WithoutCancel(ctx), "DETACH DATABASE "+mergeSchema)
+		return err
+	})
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, t := range tables {
+		cols, err := mergeColumns(ctx, tx, t)
+		if err != nil {
+			return err
+		}
+		list := strings.Join(cols, ", ")
+		query := fmt.Sprintf("INSERT %s INTO main.%s (%s) SELECT %s FROM %s.%s",
+			t.OnConflict.sql(), t.Name, list, list, mergeSchema, t.Name)
+		if _, err := exec(ctx, tx, query, query); err != nil {
+			return fmt.Errorf("table %s: %w", t.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// mergeColumns returns the columns of t to copy: those in both the source and
+// destination, minus the omitted ones.
+func mergeColumns(ctx context.Context, tx *sql.Tx, t MergeTable) ([]string, error) {
+	dstCols, err := TableColumns(ctx, tx, t.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(dstCols) == 0 {
+		return nil, fmt.Errorf("no table %s in destination", t.Name)
+	}
+	var srcCols []Column
+	rows, errf := ScanRows(ctx, tx, fmt.Sprintf("SELECT name FROM %s.pragma_table_info(?)", mergeSchema), t.Name)
+	for r := range rows {
+		var c Column
+		if err := r.Scan(&c.Name); err != nil {
+			return nil, err
+		}
+		srcCols = append(srcCols, c)
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	if len(srcCols) == 0 {
+		return nil, fmt.Errorf("no table %s in source", t.Name)
+	}
+	var cols []string
+	for _, c := range dstCols {
+		inSrc := slices.ContainsFunc(srcCols, func(s Column) bool { return strings.EqualFold(s.Name, c.Name) })
+		if inSrc && !slices.Contains(t.Omit, c.Name) {
+			cols = append(cols, c.Name)
+		}
+	}
+	return cols, nil
+}
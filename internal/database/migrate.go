@@ -0,0 +1,261 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// A Migration is a change to a database schema.
+// Its forward and reverse changes are given either as SQL or as Go functions.
+type Migration struct {
+	Version int    // migrations are applied in order of increasing version
+	Name    string // description of the migration
+	UpSQL   string
+	DownSQL string
+	Up      func(context.Context, *sql.Tx) error // used if UpSQL is empty
+	Down    func(context.Context, *sql.Tx) error // used if DownSQL is empty
+}
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// MigrationsFromFS reads SQL migrations from the files in dir of fsys.
+// Files must be named VERSION_NAME.up.sql or VERSION_NAME.down.sql,
+// like "002_add_versions.up.sql". A down migration is optional.
+func MigrationsFromFS(fsys fs.FS, dir string) (_ []Migration, err error) {
+	defer errs.Wrap(&err, "MigrationsFromFS(%s)", dir)
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := migrationFileRegexp.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("version %d has two names, %q and %q", version, mig.Name, m[2])
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if m[3] == "up" {
+			mig.UpSQL = string(data)
+		} else {
+			mig.DownSQL = string(data)
+		}
+	}
+	var migs []Migration
+	for _, m := range byVersion {
+		if m.UpSQL == "" {
+			return nil, fmt.Errorf("version %d (%s) has no up migration", m.Version, m.Name)
+		}
+		migs = append(migs, *m)
+	}
+	slices.SortFunc(migs, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migs, nil
+}
+
+// A Migrator applies migrations to a database, recording which
+// have been applied in a table.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+
+	// Table is the name of the table of applied migrations.
+	// If empty, "schema_migrations" is used.
+	Table string
+
+	// If DryRun is non-nil, the SQL of migrations is written to it
+	// instead of being executed.
+	DryRun io.Writer
+}
+
+// A MigrationStatus describes whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt string // time in RFC 3339 format, if applied
+}
+
+func (m *Migrator) table() string {
+	return cmp.Or(m.Table, "schema_migrations")
+}
+
+// Status returns the status of each of m's migrations, in version order.
+// It also reports applied migrations that are not among m.Migrations.
+func (m *Migrator) Status(ctx context.Context) (_ []MigrationStatus, err error) {
+	defer errs.Wrap(&err, "Migrator.Status")
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ss []MigrationStatus
+	for _, mig := range m.sorted() {
+		at, ok := applied[mig.Version]
+		ss = append(ss, MigrationStatus{Migration: mig, Applied: ok, AppliedAt: at.at})
+		delete(applied, mig.Version)
+	}
+	for v, a := range applied {
+		ss = append(ss, MigrationStatus{Migration: Migration{Version: v, Name: a.name}, Applied: true, AppliedAt: a.at})
+	}
+	slices.SortFunc(ss, func(a, b MigrationStatus) int { return cmp.Compare(a.Version, b.Version) })
+	return ss, nil
+}
+
+// Up applies all migrations that have not been applied, in version order.
+// Each migration runs in its own transaction.
+// Up returns the number of migrations applied (or, for a dry run, that
+// would have been applied).
+func (m *Migrator) Up(ctx context.Context) (n int, err error) {
+	defer errs.Wrap(&err, "Migrator.Up")
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, mig := range m.sorted() {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		err := m.run(ctx, mig, "up", mig.UpSQL, mig.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx,
+				fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?)", m.table()),
+				mig.Version, mig.Name, time.Now().UTC().Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Down reverts the last n applied migrations, in reverse version order.
+// It is an error if one of them has no down migration.
+func (m *Migrator) Down(ctx context.Context, n int) (err error) {
+	defer errs.Wrap(&err, "Migrator.Down(%d)", n)
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	migs := m.sorted()
+	slices.Reverse(migs)
+	for _, mig := range migs {
+		if n <= 0 {
+			break
+		}
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.DownSQL == "" && mig.Down == nil {
+			return fmt.Errorf("migration %d (%s) cannot be reverted", mig.Version, mig.Name)
+		}
+		err := m.run(ctx, mig, "down", mig.DownSQL, mig.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = ?", m.table()), mig.Version)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		n--
+	}
+	return nil
+}
+
+// run runs one direction of a migration in a transaction, then calls record
+// in the same transaction.
+func (m *Migrator) run(ctx context.Context, mig Migration, dir, query string, f func(context.Context, *sql.Tx) error, record func(*sql.Tx) error) (err error) {
+	defer errs.Wrap(&err, "migration %d (%s) %s", mig.Version, mig.Name, dir)
+
+	if m.DryRun != nil {
+		w := errs.NewWriter(m.DryRun)
+		fmt.Fprintf(w, "-- %d %s (%s)\n", mig.Version, mig.Name, dir)
+		if query != "" {
+			fmt.Fprintf(w, "%s\n", query)
+		} else {
+			fmt.Fprintf(w, "-- Go function\n")
+		}
+		return w.Err()
+	}
+	return Transaction(m.DB, func(tx *sql.Tx) error {
+		if query != "" {
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		} else if f != nil {
+			if err := f(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return record(tx)
+	})
+}
+
+type appliedMigration struct {
+	name string
+	at   string
+}
+
+// applied returns the migrations recorded as applied, creating the
+// table that records them if necessary. On a dry run, the table is not
+// created.
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	applied := map[int]appliedMigration{}
+	if m.DryRun != nil {
+		var n int
+		err := m.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", m.table()).Scan(&n)
+		if err != nil || n == 0 {
+			return applied, err
+		}
+	} else {
+		_, err := m.DB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)`, m.table()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	rows, errf := ScanRowsAs[struct {
+		Version   int
+		Name      string
+		AppliedAt string
+	}](ctx, m.DB, "SELECT version, name, applied_at FROM "+m.table())
+	for r := range rows {
+		applied[r.Version] = appliedMigration{r.Name, r.AppliedAt}
+	}
+	return applied, errf()
+}
+
+// sorted returns m's migrations in version order.
+func (m *Migrator) sorted() []Migration {
+	migs := slices.Clone(m.Migrations)
+	slices.SortFunc(migs, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migs
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Named converts a query with named parameters to one with positional
+// parameters, returning the new query and its arguments.
+//
+// A named parameter is a colon followed by an identifier, like ":path".
+// Parameters in string literals, quoted identifiers and comments are ignored,
+// as is a double colon (a PostgreSQL cast).
+//
+// The values of the parameters come from arg, which must be a map[string]any
+// or a struct (or pointer to struct). Struct fields are named as described
+// in [ScanRowsAs]. A parameter may appear more than once.
+func Named(query string, arg any) (string, []any, error) {
+	lookup, err := namedLookup(arg)
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		b    strings.Builder
+		args []any
+	)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// Copy a quoted string or identifier. A doubled quote is an escaped
+			// quote, and is handled by copying both halves as separate strings.
+			j := strings.IndexByte(query[i+1:], c)
+			if j < 0 {
+				return "", nil, fmt.Errorf("unterminated %c in query", c)
+			}
+			b.WriteString(query[i : i+j+2])
+			i += j + 2
+		case strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i:], "*/")
+			if j < 0 {
+				return "", nil, fmt.Errorf("unterminated comment in query")
+			}
+			b.WriteString(query[i : i+j+2])
+			i += j + 2
+		case strings.HasPrefix(query[i:], "::"):
+			b.WriteString("::")
+			i += 2
+		case c == ':' && i+1 < len(query) && isIdentStart(query[i+1]):
+			j := i + 2
+			for j < len(query) && isIdentChar(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			v, ok := lookup(name)
+			if !ok {
+				return "", nil, fmt.Errorf("no value for parameter %q", name)
+			}
+			args = append(args, v)
+			b.WriteByte('?')
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), args, nil
+}
+
+// namedLookup returns a function that looks up parameter values in arg.
+func namedLookup(arg any) (func(string) (any, bool), error) {
+	if m, ok := arg.(map[string]any); ok {
+		return func(name string) (any, bool) {
+			v, ok := m[name]
+			return v, ok
+		}, nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("named parameters: want map[string]any or struct, got %T", arg)
+	}
+	fields, err := columnFields(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	return func(name string) (any, bool) {
+		fi, ok := fields[strings.ToLower(name)]
+		if !ok {
+			return nil, false
+		}
+		return v.FieldByIndex(fi).Interface(), true
+	}, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || '0' <= c && c <= '9'
+}
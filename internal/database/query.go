@@ -0,0 +1,113 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Query builds a SELECT statement.
+// Its methods modify and return the Query, so calls can be chained:
+//
+//	q, args := Select("modules").Where("path > ?", p).OrderBy("path").Limit(10).SQL()
+type Query struct {
+	table   string
+	cols    []string
+	where   []string
+	args    []any
+	orderBy []string
+	limit   int
+	offset  int
+}
+
+// Select returns a Query for the given columns of table.
+// With no columns, all are selected.
+func Select(table string, cols ...string) *Query {
+	return &Query{table: table, cols: cols}
+}
+
+// Where adds a condition, which may contain "?" placeholders for args.
+// Multiple conditions are combined with AND.
+func (q *Query) Where(cond string, args ...any) *Query {
+	if n := strings.Count(cond, "?"); n != len(args) {
+		panic(fmt.Sprintf("Query.Where(%q): %d placeholders, %d args", cond, n, len(args)))
+	}
+	q.where = append(q.where, cond)
+	q.args = append(q.args, args...)
+	return q
+}
+
+// WhereIf adds a condition only if b is true. See [Query.Where].
+func (q *Query) WhereIf(b bool, cond string, args ...any) *Query {
+	if b {
+		return q.Where(cond, args...)
+	}
+	return q
+}
+
+// OrderBy adds terms, like "path" or "info_time DESC", to the ORDER BY clause.
+func (q *Query) OrderBy(terms ...string) *Query {
+	q.orderBy = append(q.orderBy, terms...)
+	return q
+}
+
+// Limit limits the number of rows returned to n.
+// A value of zero or less means no limit.
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// Offset skips the first n rows.
+func (q *Query) Offset(n int) *Query {
+	q.offset = n
+	return q
+}
+
+// SQL returns the query and its arguments.
+func (q *Query) SQL() (string, []any) {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	if len(q.cols) == 0 {
+		b.WriteString("*")
+	} else {
+		b.WriteString(strings.Join(q.cols, ", "))
+	}
+	b.WriteString(" FROM ")
+	b.WriteString(q.table)
+	if len(q.where) > 0 {
+		b.WriteString(" WHERE ")
+		for i, w := range q.where {
+			if i > 0 {
+				b.WriteString(" AND ")
+			}
+			if len(q.where) > 1 {
+				fmt.Fprintf(&b, "(%s)", w)
+			} else {
+				b.WriteString(w)
+			}
+		}
+	}
+	if len(q.orderBy) > 0 {
+		b.WriteString(" ORDER BY ")
+		b.WriteString(strings.Join(q.orderBy, ", "))
+	}
+	args := q.args
+	if q.limit > 0 || q.offset > 0 {
+		// SQLite requires LIMIT with OFFSET; -1 means no limit.
+		b.WriteString(" LIMIT ?")
+		args = append(args[:len(args):len(args)], limitArg(q.limit))
+	}
+	if q.offset > 0 {
+		b.WriteString(" OFFSET ?")
+		args = append(args, q.offset)
+	}
+	return b.String(), args
+}
+
+// limitArg returns the argument for a LIMIT of n.
+func limitArg(n int) int {
+	if n > 0 {
+		return n
+	}
+	return -1
+}
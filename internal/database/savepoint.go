@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Savepoint calls f with tx inside a savepoint named name.
+// If f returns an error, the changes made by f are rolled back, but the rest
+// of the transaction is unaffected; the caller can handle the error and
+// continue with the transaction.
+// Savepoints may be nested, but names should be unique among nested savepoints.
+func Savepoint(tx *sql.Tx, name string, f func(*sql.Tx) error) (err error) {
+	if !isIdent(name) {
+		return fmt.Errorf("Savepoint: invalid name %q", name)
+	}
+	if _, err := tx.Exec("SAVEPOINT " + name); err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		if _, rerr := tx.Exec("ROLLBACK TO SAVEPOINT " + name); rerr != nil {
+			return fmt.Errorf("%w; rolling back to savepoint: %v", err, rerr)
+		}
+		// ROLLBACK TO leaves the savepoint on the stack.
+		if _, rerr := tx.Exec("RELEASE SAVEPOINT " + name); rerr != nil {
+			return fmt.Errorf("%w; releasing savepoint: %v", err, rerr)
+		}
+		return err
+	}
+	_, err = tx.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
+
+// isIdent reports whether s is a valid SQL identifier that need not be quoted.
+func isIdent(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
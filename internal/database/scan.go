@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jba/go-ecosystem/internal/jiter"
+)
+
+// ScanRowsAs runs query and returns an iterator over its results, each
+// scanned into a new T, which must be a struct type.
+//
+// Columns are matched to exported fields by name. A field's column name is
+// given by its `db` struct tag, or else is the field name converted to
+// snake case, so that a field named LatestVersion holds the column
+// latest_version. Fields with the tag `db:"-"` are ignored. Every column in
+// the result must have a field; fields without a column are left as zero.
+func ScanRowsAs[T any](ctx context.Context, db Querier, query string, params ...any) (iter.Seq[*T], func() error) {
+	var es jiter.ErrorState
+	return func(yield func(*T) bool) {
+		var indexes [][]int
+		var dests []any
+		rows, errf := ScanRows(ctx, db, query, params...)
+		for r := range rows {
+			if indexes == nil {
+				var err error
+				indexes, err = fieldIndexes(reflect.TypeFor[T](), r)
+				if err != nil {
+					es.Set(err)
+					return
+				}
+				dests = make([]any, len(indexes))
+			}
+			var x T
+			v := reflect.ValueOf(&x).Elem()
+			for i, fi := range indexes {
+				dests[i] = v.FieldByIndex(fi).Addr().Interface()
+			}
+			if err := r.Scan(dests...); err != nil {
+				es.Set(err)
+				return
+			}
+			if !yield(&x) {
+				return
+			}
+		}
+		es.Set(errf())
+	}, es.Func()
+}
+
+// fieldIndexes returns the index of the field of t for each of the columns
+// of rows.
+func fieldIndexes(t reflect.Type, rows *sql.Rows) ([][]int, error) {
+	fields, err := columnFields(t)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([][]int, len(cols))
+	for i, c := range cols {
+		fi, ok := fields[strings.ToLower(c)]
+		if !ok {
+			return nil, fmt.Errorf("%s has no field for column %q", t, c)
+		}
+		indexes[i] = fi
+	}
+	return indexes, nil
+}
+
+var columnFieldsCache sync.Map // from reflect.Type to map[string][]int
+
+// columnFields returns a map from lower-case column names to the
+// indexes of the fields of the struct type t.
+func columnFields(t reflect.Type) (map[string][]int, error) {
+	if m, ok := columnFieldsCache.Load(t); ok {
+		return m.(map[string][]int), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct type", t)
+	}
+	m := map[string][]int{}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name := f.Tag.Get("db")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		m[strings.ToLower(name)] = f.Index
+	}
+	columnFieldsCache.Store(t, m)
+	return m, nil
+}
+
+// snakeCase converts a Go identifier to snake case.
+// For example, "LatestVersion" becomes "latest_version" and "ID" becomes "id".
+func snakeCase(s string) string {
+	rs := []rune(s)
+	var b strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			// Start a new word at a lower-to-upper transition, or before the
+			// last upper-case letter of an acronym that begins a word ("HTTPServer").
+			if i > 0 && (unicode.IsLower(rs[i-1]) ||
+				(i+1 < len(rs) && unicode.IsUpper(rs[i-1]) && unicode.IsLower(rs[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// A Column describes a column of an SQLite table.
+type Column struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	PrimaryKey int // 1-based position in the primary key, or 0
+}
+
+// TableColumns returns the columns of an SQLite table, in order.
+// It returns an empty slice if the table doesn't exist.
+func TableColumns(ctx context.Context, db Querier, table string) (_ []Column, err error) {
+	defer errs.Wrap(&err, "TableColumns(%s)", table)
+
+	var cols []Column
+	rows, errf := ScanRows(ctx, db, "SELECT name, type, \"notnull\", pk FROM pragma_table_info(?)", table)
+	for r := range rows {
+		var c Column
+		if err := r.Scan(&c.Name, &c.Type, &c.NotNull, &c.PrimaryKey); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, errf()
+}
+
+// VerifyColumns checks that the columns of table match the fields of the
+// struct type T, as described in [ScanRowsAs]: every column must have a field,
+// and every field must have a column. A table that doesn't exist
+// is not an error.
+func VerifyColumns[T any](ctx context.Context, db Querier, table string) error {
+	cols, err := TableColumns(ctx, db, table)
+	if err != nil || len(cols) == 0 {
+		return err
+	}
+	t := reflect.TypeFor[T]()
+	fields, err := columnFields(t)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	have := map[string]bool{}
+	for _, c := range cols {
+		name := strings.ToLower(c.Name)
+		have[name] = true
+		if _, ok := fields[name]; !ok {
+			problems = append(problems, fmt.Sprintf("column %q has no field", c.Name))
+		}
+	}
+	for name := range fields {
+		if !have[name] {
+			problems = append(problems, fmt.Sprintf("field for %q has no column", name))
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("table %s does not match %s: %s", table, t, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/logging"
+)
+
+// SlowQueryThreshold is the duration beyond which a query run by a function in
+// this package is logged. If zero, no queries are logged.
+var SlowQueryThreshold time.Duration
+
+// QueryStats holds aggregate statistics about a query.
+type QueryStats struct {
+	Query    string        // the SQL, or a description for generated statements
+	Count    int64         // number of executions
+	Rows     int64         // rows returned or affected
+	Total    time.Duration // total time spent in the database
+	Max      time.Duration // longest single execution
+	Failures int64         // executions that returned an error
+}
+
+var (
+	statsMu sync.Mutex
+	stats   = map[string]*QueryStats{}
+)
+
+// Stats returns statistics for each query run by functions in this package,
+// sorted by decreasing total time.
+//
+// The time for a query that returns rows does not include the time that the
+// caller spends processing them.
+func Stats() []QueryStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	var ss []QueryStats
+	for _, s := range stats {
+		ss = append(ss, *s)
+	}
+	slices.SortFunc(ss, func(a, b QueryStats) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), cmp.Compare(a.Query, b.Query))
+	})
+	return ss
+}
+
+// ResetStats discards all query statistics.
+func ResetStats() {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	clear(stats)
+}
+
+// WriteStats writes a table of the n queries with the highest total time to w.
+// If n is not positive, all queries are written.
+func WriteStats(w io.Writer, n int) error {
+	ss := Stats()
+	if n > 0 && len(ss) > n {
+		ss = ss[:n]
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "total\tcount\tmean\tmax\trows\tfailed\tquery")
+	for _, s := range ss {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%d\t%s\n",
+			s.Total.Round(time.Millisecond), s.Count, (s.Total / time.Duration(s.Count)).Round(time.Microsecond),
+			s.Max.Round(time.Microsecond), s.Rows, s.Failures, truncate(s.Query, 80))
+	}
+	return tw.Flush()
+}
+
+// record adds one execution of query to the statistics, and logs it if
+// it was slow.
+func record(ctx context.Context, query string, d time.Duration, rows int64, err error) {
+	statsMu.Lock()
+	s := stats[query]
+	if s == nil {
+		s = &QueryStats{Query: query}
+		stats[query] = s
+	}
+	s.Count++
+	s.Rows += rows
+	s.Total += d
+	s.Max = max(s.Max, d)
+	if err != nil {
+		s.Failures++
+	}
+	statsMu.Unlock()
+
+	if SlowQueryThreshold > 0 && d >= SlowQueryThreshold {
+		logging.FromContext(ctx).WarnContext(ctx, "slow query",
+			"duration", d.Round(time.Millisecond), "rows", rows, "query", truncate(query, 200))
+	}
+}
+
+// exec executes query on db and records it under the name key.
+func exec(ctx context.Context, db Execer, key, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.ExecContext(ctx, query, args...)
+	var n int64
+	if err == nil {
+		// Ignore errors; not all drivers support RowsAffected.
+		n, _ = res.RowsAffected()
+	}
+	record(ctx, key, time.Since(start), n, err)
+	return res, err
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// A Preparer is a *sql.DB, *sql.Tx or *sql.Conn.
+type Preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// A StmtCache is a least-recently-used cache of prepared statements, keyed
+// by their SQL text. It is safe for concurrent use.
+//
+// A StmtCache is an [Execer], so it can be passed to functions like [Upsert].
+// Use [StmtCache.InTx] to execute the cached statements in a transaction
+// without preparing them again.
+type StmtCache struct {
+	p    Preparer
+	size int
+
+	mu sync.Mutex
+	ll *list.List               // of *cachedStmt, most recently used first
+	m  map[string]*list.Element // from query
+}
+
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int  // number of executions in progress
+	evicted bool // close when refs is zero
+}
+
+// NewStmtCache returns a cache of at most size statements prepared with p.
+func NewStmtCache(p Preparer, size int) *StmtCache {
+	return &StmtCache{p: p, size: max(size, 1), ll: list.New(), m: map[string]*list.Element{}}
+}
+
+// ExecContext executes query with args, using a cached statement.
+func (c *StmtCache) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	cs, err := c.get(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(cs)
+	return cs.stmt.ExecContext(ctx, args...)
+}
+
+// InTx returns an Execer that executes statements from c in tx.
+// The cache's Preparer must be the *sql.DB that began tx.
+// Statements not in the cache are prepared outside the transaction, so the
+// DB must allow more than one open connection.
+func (c *StmtCache) InTx(tx *sql.Tx) Execer {
+	return txStmtCache{c, tx}
+}
+
+type txStmtCache struct {
+	c  *StmtCache
+	tx *sql.Tx
+}
+
+func (t txStmtCache) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	cs, err := t.c.get(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer t.c.release(cs)
+	// The transaction's statement is closed when the transaction ends.
+	return t.tx.StmtContext(ctx, cs.stmt).ExecContext(ctx, args...)
+}
+
+// Close closes all the statements in the cache.
+// Statements being executed are closed when they finish.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		errs = append(errs, c.evict(e))
+	}
+	return errors.Join(errs...)
+}
+
+// Len returns the number of statements in the cache.
+func (c *StmtCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// get returns the cached statement for query, preparing it if necessary.
+// The caller must call release when done with it.
+func (c *StmtCache) get(ctx context.Context, query string) (*cachedStmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.m[query]; ok {
+		c.ll.MoveToFront(e)
+		cs := e.Value.(*cachedStmt)
+		cs.refs++
+		return cs, nil
+	}
+	stmt, err := c.p.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	cs := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.m[query] = c.ll.PushFront(cs)
+	if c.ll.Len() > c.size {
+		// An error closing a statement only means it has already been closed,
+		// or its connection has gone bad.
+		_ = c.evict(c.ll.Back())
+	}
+	return cs, nil
+}
+
+// release ends an execution of cs.
+func (c *StmtCache) release(cs *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs.refs--
+	if cs.evicted && cs.refs == 0 {
+		cs.stmt.Close()
+	}
+}
+
+// evict removes e from the cache and closes its statement, unless it is
+// in use. Called with c.mu held.
+func (c *StmtCache) evict(e *list.Element) error {
+	cs := e.Value.(*cachedStmt)
+	c.ll.Remove(e)
+	delete(c.m, cs.query)
+	cs.evicted = true
+	if cs.refs == 0 {
+		return cs.stmt.Close()
+	}
+	return nil
+}
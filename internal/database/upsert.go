@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// An Execer is a *sql.DB, *sql.Tx or *sql.Conn.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Upsert inserts a row into table with args as the values of cols, or, if
+// a row with the same values for keyCols already exists, updates the other
+// columns of that row. The keyCols must be among cols and must have a
+// uniqueness constraint.
+func Upsert(ctx context.Context, db Execer, table string, keyCols, cols []string, args ...any) (sql.Result, error) {
+	if len(args) != len(cols) {
+		return nil, fmt.Errorf("Upsert(%s): %d args for %d columns", table, len(args), len(cols))
+	}
+	q := UpsertStmt(table, keyCols, cols)
+	return exec(ctx, db, q, q, args...)
+}
+
+// UpsertStmt returns the statement executed by [Upsert].
+// The syntax is supported by both SQLite and PostgreSQL.
+func UpsertStmt(table string, keyCols, cols []string) string {
+	var sets []string
+	for _, c := range cols {
+		if !slices.Contains(keyCols, c) {
+			sets = append(sets, fmt.Sprintf("%s = excluded.%[1]s", c))
+		}
+	}
+	action := "DO NOTHING"
+	if len(sets) > 0 {
+		action = "DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) %s",
+		table, strings.Join(cols, ", "),
+		strings.Repeat("?, ", len(cols)-1)+"?",
+		strings.Join(keyCols, ", "), action)
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrWriterClosed is returned by [Writer.Write] and [Writer.Flush] after
+// [Writer.Close] has been called.
+var ErrWriterClosed = errors.New("database.Writer is closed")
+
+// Counts of the batches and values written by all Writers.
+var writerBatches, writerValues atomic.Int64
+
+// WriterStats are cumulative statistics of all [Writer]s.
+type WriterStats struct {
+	Batches int64 // batches committed
+	Values  int64 // values in those batches
+}
+
+// Writes returns the statistics of all [Writer]s.
+func Writes() WriterStats {
+	return WriterStats{Batches: writerBatches.Load(), Values: writerValues.Load()}
+}
+
+// A Writer writes values to a database on a background goroutine, so that
+// the goroutines producing the values don't wait for each write.
+//
+// Values are collected into batches, and each batch is written by a call to
+// a user-provided function in its own transaction. A batch is written when it
+// is full, when it is older than the maximum delay, or on a call to
+// [Writer.Flush] or [Writer.Close].
+//
+// Writes block when the Writer has a full batch waiting to be written,
+// so producers cannot get too far ahead of the database.
+//
+// After a write fails, the Writer discards all subsequent values, and its
+// methods return the error.
+type Writer[T any] struct {
+	db        *sql.DB
+	batchSize int
+	maxDelay  time.Duration
+	write     func(context.Context, *sql.Tx, []T) error
+
+	c    chan writerMsg[T]
+	done chan struct{} // closed when the background goroutine exits
+
+	mu     sync.RWMutex
+	closed bool // guarded by mu
+
+	// The background goroutine must not acquire mu, because a sender may be
+	// holding it while blocked on the channel.
+	errMu sync.Mutex
+	err   error // guarded by errMu
+}
+
+type writerMsg[T any] struct {
+	value T
+	flush chan error // non-nil for a flush request
+}
+
+// NewWriter returns a Writer that calls write with batches of at most
+// batchSize values. If maxDelay is positive, no value waits longer than
+// maxDelay before being written.
+//
+// The write function is called with ctx. Its transaction is retried if the
+// database is busy, so it should not have side effects outside of the database.
+func NewWriter[T any](ctx context.Context, db *sql.DB, batchSize int, maxDelay time.Duration, write func(context.Context, *sql.Tx, []T) error) *Writer[T] {
+	w := &Writer[T]{
+		db:        db,
+		batchSize: max(batchSize, 1),
+		maxDelay:  maxDelay,
+		write:     write,
+		c:         make(chan writerMsg[T], max(batchSize, 1)),
+		done:      make(chan struct{}),
+	}
+	go w.run(ctx)
+	return w
+}
+
+// Write adds x to the current batch. It blocks if the Writer is behind,
+// until there is room or ctx is done.
+func (w *Writer[T]) Write(ctx context.Context, x T) error {
+	return w.send(ctx, writerMsg[T]{value: x})
+}
+
+// Flush writes all the values passed to Write before the call to Flush,
+// and returns when they have been committed.
+func (w *Writer[T]) Flush(ctx context.Context) error {
+	c := make(chan error, 1)
+	if err := w.send(ctx, writerMsg[T]{flush: c}); err != nil {
+		return err
+	}
+	select {
+	case err := <-c:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes any remaining values and stops the Writer.
+// It returns the first error encountered by the Writer.
+// Close can be called more than once.
+func (w *Writer[T]) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.c)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return w.Err()
+}
+
+// Err returns the first error encountered by the Writer.
+func (w *Writer[T]) Err() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.err
+}
+
+func (w *Writer[T]) send(ctx context.Context, m writerMsg[T]) error {
+	// Hold the read lock so Close doesn't close the channel while we're sending.
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if err := w.Err(); err != nil {
+		return err
+	}
+	select {
+	case w.c <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Writer[T]) setErr(err error) {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// run is the background goroutine.
+func (w *Writer[T]) run(ctx context.Context) {
+	defer close(w.done)
+
+	var (
+		batch []T
+		timer *time.Timer
+		timec <-chan time.Time // nil unless the timer is running
+	)
+	commit := func() {
+		if timer != nil {
+			timer.Stop()
+			timec = nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if w.Err() == nil {
+			err := TransactionContext(ctx, w.db, &TxOptions{Retry: true}, func(tx *sql.Tx) error {
+				return w.write(ctx, tx, batch)
+			})
+			if err != nil {
+				w.setErr(err)
+			} else {
+				writerBatches.Add(1)
+				writerValues.Add(int64(len(batch)))
+			}
+		}
+		// Don't reuse batch: write may have retained it.
+		batch = nil
+	}
+
+	for {
+		select {
+		case m, ok := <-w.c:
+			if !ok {
+				commit()
+				return
+			}
+			if m.flush != nil {
+				commit()
+				m.flush <- w.Err()
+				continue
+			}
+			batch = append(batch, m.value)
+			if len(batch) >= w.batchSize {
+				commit()
+			} else if len(batch) == 1 && w.maxDelay > 0 {
+				if timer == nil {
+					timer = time.NewTimer(w.maxDelay)
+				} else {
+					timer.Reset(w.maxDelay)
+				}
+				timec = timer.C
+			}
+		case <-timec:
+			timec = nil
+			commit()
+		}
+	}
+}
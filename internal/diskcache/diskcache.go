@@ -0,0 +1,170 @@
+// Package diskcache measures directories of cached files and keeps them
+// within a size quota by removing the least recently used files.
+//
+// Recency is measured by modification time, which the caches in this module
+// update when they write or revalidate a file.
+package diskcache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Dir is a directory of cached files.
+type Dir struct {
+	Name string // for display
+	Path string
+}
+
+// Stats describes the contents of a Dir.
+type Stats struct {
+	Dir
+	Files  int
+	Bytes  int64
+	Oldest time.Time // modification time of the least recently used file
+	Newest time.Time // modification time of the most recently used file
+}
+
+// A file is a regular file in a Dir.
+type file struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files returns the regular files under d. A missing directory has no files.
+func (d Dir) files() ([]file, error) {
+	var files []file
+	err := filepath.WalkDir(d.Path, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if path == d.Path && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // removed concurrently
+			}
+			return err
+		}
+		files = append(files, file{path, info.Size(), info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// Stat returns statistics about d.
+func (d Dir) Stat() (Stats, error) {
+	files, err := d.files()
+	if err != nil {
+		return Stats{}, err
+	}
+	s := Stats{Dir: d, Files: len(files)}
+	for _, f := range files {
+		s.Bytes += f.size
+		if s.Oldest.IsZero() || f.modTime.Before(s.Oldest) {
+			s.Oldest = f.modTime
+		}
+		if f.modTime.After(s.Newest) {
+			s.Newest = f.modTime
+		}
+	}
+	return s, nil
+}
+
+// MinAge is the age below which GC never removes a file, so that files
+// being written are left alone.
+const MinAge = time.Minute
+
+// A GCResult describes what GC removed, or would remove.
+type GCResult struct {
+	Files int
+	Bytes int64 // bytes freed
+	Left  int64 // bytes remaining
+}
+
+// GC removes the least recently used files in dirs, taken together, until
+// their total size is at most quota bytes. Files used within [MinAge] are not
+// removed, so the quota may not be reached. If dryRun is true, nothing is
+// removed, but the result describes what would be.
+func GC(dirs []Dir, quota int64, dryRun bool) (GCResult, error) {
+	var (
+		all   []file
+		total int64
+	)
+	for _, d := range dirs {
+		files, err := d.files()
+		if err != nil {
+			return GCResult{}, err
+		}
+		for _, f := range files {
+			total += f.size
+		}
+		all = append(all, files...)
+	}
+	slices.SortFunc(all, func(a, b file) int { return a.modTime.Compare(b.modTime) })
+	res := GCResult{Left: total}
+	cutoff := time.Now().Add(-MinAge)
+	var errs []error
+	for _, f := range all {
+		if res.Left <= quota || f.modTime.After(cutoff) {
+			break
+		}
+		if !dryRun {
+			if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		res.Files++
+		res.Bytes += f.size
+		res.Left -= f.size
+	}
+	return res, errors.Join(errs...)
+}
+
+// ParseSize parses a size in bytes, with an optional suffix K, M, G or T
+// (powers of 1024), like "500M" or "2G".
+func ParseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(t, "B")
+	mult := int64(1)
+	if n := len(t); n > 0 {
+		if i := strings.IndexByte("KMGT", t[n-1]); i >= 0 {
+			mult = 1 << (10 * (i + 1))
+			t = t[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return n * mult, nil
+}
+
+// FormatSize formats n bytes for display, like "1.5G".
+func FormatSize(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return strconv.FormatInt(n, 10)
+	}
+	f := float64(n)
+	i := -1
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64) + units[i:i+1]
+}
@@ -0,0 +1,91 @@
+package diskcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGC(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	now := time.Now()
+	write := func(path string, size int, age time.Duration) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mt := now.Add(-age)
+		if err := os.Chtimes(path, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dir1, "a"), 100, 3*time.Hour)
+	write(filepath.Join(dir2, "sub", "b"), 100, 2*time.Hour)
+	write(filepath.Join(dir1, "c"), 100, time.Hour)
+	write(filepath.Join(dir2, "new"), 100, 0) // too new to remove
+	dirs := []Dir{{"one", dir1}, {"two", dir2}, {"missing", filepath.Join(dir1, "nope")}}
+
+	s, err := dirs[1].Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Files != 2 || s.Bytes != 200 || !s.Oldest.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("got %+v", s)
+	}
+
+	res, err := GC(dirs, 250, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (GCResult{Files: 2, Bytes: 200, Left: 200}); res != want {
+		t.Errorf("dry run: got %+v, want %+v", res, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir1, "a")); err != nil {
+		t.Error("dry run removed a file")
+	}
+
+	res, err = GC(dirs, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (GCResult{Files: 3, Bytes: 300, Left: 100}); res != want {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+	for _, name := range []string{"a", "c"} {
+		if _, err := os.Stat(filepath.Join(dir1, name)); err == nil {
+			t.Errorf("%s not removed", name)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"100", 100},
+		{"2k", 2048},
+		{"1.5G", -1},
+		{"3GB", 3 << 30},
+		{"x", -1},
+	} {
+		got, err := ParseSize(test.in)
+		if test.want < 0 {
+			if err == nil {
+				t.Errorf("ParseSize(%q): want error", test.in)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", test.in, got, err, test.want)
+		}
+	}
+	if got := FormatSize(3 << 29); got != "1.5G" {
+		t.Errorf("FormatSize: got %q", got)
+	}
+}
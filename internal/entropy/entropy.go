@@ -0,0 +1,22 @@
+// Package entropy measures the randomness of data, to help find
+// compressed, encrypted or encoded content.
+package entropy
+
+import "math"
+
+// Shannon returns the Shannon entropy of data, in bits per byte:
+// 0 for data of one repeated byte, up to 8 for random data.
+func Shannon(data []byte) float64 {
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	var e float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(data))
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
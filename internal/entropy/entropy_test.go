@@ -0,0 +1,26 @@
+package entropy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestShannon(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, test := range []struct {
+		data []byte
+		want float64
+	}{
+		{nil, 0},
+		{bytes.Repeat([]byte("a"), 10), 0},
+		{[]byte("abab"), 1},
+		{all, 8},
+	} {
+		if got := Shannon(test.data); got != test.want {
+			t.Errorf("%q: got %g, want %g", test.data, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package errs
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrTooManyErrors is returned by [Collector.Add] when the collector's
+// limit is exceeded.
+var ErrTooManyErrors = errors.New("too many errors")
+
+// A Collector gathers errors from concurrent workers, keyed by the item
+// that failed, so that one bad item need not stop the others.
+// A Collector is safe for concurrent use. The zero value is ready to use
+// and has no limit.
+type Collector struct {
+	// Limit is the maximum number of errors to accept. If positive, Add
+	// returns an error after more than Limit errors have been added.
+	Limit int
+
+	mu   sync.Mutex
+	errs map[string]error
+	n    int // number of calls to Add with a non-nil error
+}
+
+// Add records err for key, and returns nil unless the limit is exceeded.
+// If err is nil, Add does nothing. Only the first error for a key is kept.
+// Workers should return Add's result, so that processing stops when
+// there are too many errors.
+func (c *Collector) Add(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.errs == nil {
+		c.errs = map[string]error{}
+	}
+	if _, ok := c.errs[key]; !ok {
+		c.errs[key] = err
+	}
+	c.n++
+	if c.Limit > 0 && c.n > c.Limit {
+		return fmt.Errorf("%d errors, last for %s: %w: %w", c.n, key, ErrTooManyErrors, err)
+	}
+	return nil
+}
+
+// Len returns the number of keys with errors.
+func (c *Collector) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.errs)
+}
+
+// All returns the keys and their errors, in key order.
+func (c *Collector) All() iter.Seq2[string, error] {
+	c.mu.Lock()
+	m := maps.Clone(c.errs)
+	c.mu.Unlock()
+	return func(yield func(string, error) bool) {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			if !yield(k, m[k]) {
+				return
+			}
+		}
+	}
+}
+
+// Save calls save for each key and its error, in key order.
+// It stops at the first error returned by save.
+func (c *Collector) Save(save func(key string, err error) error) error {
+	for k, err := range c.All() {
+		if err := save(k, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counts returns the number of errors in each category.
+// The category of an error is the message of its kind as returned by [KindOf],
+// or "other" if it has none.
+func (c *Collector) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, err := range c.All() {
+		counts[category(err)]++
+	}
+	return counts
+}
+
+func category(err error) string {
+	if k := KindOf(err); k != nil {
+		return k.Error()
+	}
+	return "other"
+}
+
+// Summary returns a one-line description of the errors, like
+// "3 errors: 2 not found, 1 other". The categories are ordered by decreasing count.
+// It returns the empty string if there are no errors.
+func (c *Collector) Summary() string {
+	counts := c.Counts()
+	if len(counts) == 0 {
+		return ""
+	}
+	cats := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	var parts []string
+	total := 0
+	for _, cat := range cats {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[cat], cat))
+		total += counts[cat]
+	}
+	return fmt.Sprintf("%d errors: %s", total, strings.Join(parts, ", "))
+}
@@ -56,3 +56,33 @@ func (w *Writer) Write(buf []byte) (int, error) {
 func (w *Writer) Err() error {
 	return w.err
 }
+
+// A Reader is an io.Reader that remembers errors.
+// When a call to Read returns an error other than io.EOF, no subsequent Reads
+// are performed, and [Reader.Err] will return the error.
+type Reader struct {
+	r   io.Reader
+	err error
+}
+
+func NewReader(r io.Reader) *Reader {
+	if er, ok := r.(*Reader); ok {
+		return er
+	}
+	return &Reader{r: r}
+}
+
+func (r *Reader) Read(buf []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.r.Read(buf)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *Reader) Err() error {
+	return r.err
+}
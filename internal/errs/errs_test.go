@@ -0,0 +1,108 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestKinds(t *testing.T) {
+	base := errors.New("base")
+	e := Errorf(NotFound, "looking for x: %w", base)
+	if got, want := e.Error(), "looking for x: base"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !errors.Is(e, NotFound) || !errors.Is(e, base) {
+		t.Error("Errorf result should be NotFound and wrap base")
+	}
+	if errors.Is(e, Gone) {
+		t.Error("Errorf result should not be Gone")
+	}
+	wrapped := fmt.Errorf("outer: %w", WithKind(e, Temporary))
+	for _, test := range []struct {
+		err  error
+		want error
+	}{
+		{nil, nil},
+		{base, nil},
+		{e, NotFound},
+		{wrapped, NotFound}, // NotFound comes first
+		{fmt.Errorf("x: %w", NoVersions), NoVersions},
+		{WithKind(base, Gone), Gone},
+	} {
+		if got := KindOf(test.err); got != test.want {
+			t.Errorf("KindOf(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+	if WithKind(nil, NotFound) != nil {
+		t.Error("WithKind(nil) should be nil")
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c := &Collector{Limit: 3}
+	if err := c.Add("a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Summary(); got != "" {
+		t.Errorf("empty summary: got %q", got)
+	}
+	for _, e := range []struct {
+		key string
+		err error
+	}{
+		{"c", Errorf(NotFound, "c not found")},
+		{"a", errors.New("a failed")},
+		{"b", WithKind(errors.New("b not found"), NotFound)},
+	} {
+		if err := c.Add(e.key, e.err); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := c.Summary(), "3 errors: 2 not found, 1 other"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	var keys []string
+	if err := c.Save(func(key string, err error) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(keys), "[a b c]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	err := c.Add("a", errors.New("again"))
+	if !errors.Is(err, ErrTooManyErrors) {
+		t.Errorf("got %v, want ErrTooManyErrors", err)
+	}
+	if c.Len() != 3 {
+		t.Errorf("Len = %d, want 3", c.Len())
+	}
+}
+
+func TestReader(t *testing.T) {
+	errBad := errors.New("bad")
+	r := NewReader(io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(errBad)))
+	if NewReader(r) != r {
+		t.Error("NewReader should not rewrap")
+	}
+	data, err := io.ReadAll(r)
+	if string(data) != "abc" || err != errBad {
+		t.Errorf("got %q, %v", data, err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != errBad {
+		t.Errorf("after error: got %d, %v", n, err)
+	}
+	if r.Err() != errBad {
+		t.Errorf("Err: got %v", r.Err())
+	}
+
+	r = NewReader(strings.NewReader("x"))
+	if _, err := io.ReadAll(r); err != nil || r.Err() != nil {
+		t.Errorf("got %v, %v; want no errors at EOF", err, r.Err())
+	}
+}
@@ -0,0 +1,63 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors. Test an error's kind with [errors.Is].
+// Other packages can make their errors into kinds with [WithKind], or by
+// defining an Is method.
+var (
+	// NotFound means the requested thing does not exist.
+	NotFound error = &kind{"not found"}
+	// Gone means the requested thing existed, but was removed.
+	Gone error = &kind{"gone"}
+	// Temporary means the operation failed but may succeed if retried.
+	Temporary error = &kind{"temporary"}
+	// NoVersions means a module has no versions that can be known.
+	NoVersions error = &kind{"no versions"}
+)
+
+var kinds = []error{NotFound, Gone, Temporary, NoVersions}
+
+type kind struct {
+	name string
+}
+
+func (k *kind) Error() string { return k.name }
+
+// Errorf is like [fmt.Errorf], but the returned error is also of kind k.
+func Errorf(k error, format string, args ...any) error {
+	return WithKind(fmt.Errorf(format, args...), k)
+}
+
+// WithKind returns an error that has the message of err and wraps it,
+// and that is also of kind k. If err is nil, WithKind returns nil.
+func WithKind(err, k error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{err: err, kind: k}
+}
+
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string        { return e.err.Error() }
+func (e *kindError) Unwrap() error        { return e.err }
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+// KindOf returns the kind of err: the first of [NotFound], [Gone], [Temporary]
+// and [NoVersions] for which errors.Is(err, kind) is true.
+// It returns nil if err is not of any of those kinds.
+func KindOf(err error) error {
+	for _, k := range kinds {
+		if errors.Is(err, k) {
+			return k
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package forge
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// An api describes the REST API of a forge.
+type api struct {
+	baseURL  string
+	repoPath func(owner, name string) string
+	decode   func([]byte) (*Repo, error)
+	// auth sets the request's credentials.
+	auth func(req *http.Request, token string)
+	// Names of the response headers with the number of requests remaining
+	// and the time of the window's reset, in Unix seconds.
+	remainingHeader, resetHeader string
+}
+
+func bearer(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+var apis = map[string]api{
+	GitHub: {
+		baseURL:  "https://api.github.com",
+		repoPath: func(owner, name string) string { return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name) },
+		decode: func(data []byte) (*Repo, error) {
+			r, err := unmarshal[struct {
+				HTMLURL       string    `json:"html_url"`
+				Description   string    `json:"description"`
+				Stars         int       `json:"stargazers_count"`
+				Forks         int       `json:"forks_count"`
+				Archived      bool      `json:"archived"`
+				Fork          bool      `json:"fork"`
+				DefaultBranch string    `json:"default_branch"`
+				PushedAt      time.Time `json:"pushed_at"`
+			}](data)
+			if err != nil {
+				return nil, err
+			}
+			return &Repo{URL: r.HTMLURL, Description: r.Description, Stars: r.Stars, Forks: r.Forks,
+				Archived: r.Archived, Fork: r.Fork, DefaultBranch: r.DefaultBranch, PushedAt: r.PushedAt}, nil
+		},
+		auth:            bearer,
+		remainingHeader: "X-RateLimit-Remaining",
+		resetHeader:     "X-RateLimit-Reset",
+	},
+	GitLab: {
+		baseURL:  "https://gitlab.com/api/v4",
+		repoPath: func(owner, name string) string { return "/projects/" + url.PathEscape(owner+"/"+name) },
+		decode: func(data []byte) (*Repo, error) {
+			r, err := unmarshal[struct {
+				WebURL        string    `json:"web_url"`
+				Description   string    `json:"description"`
+				Stars         int       `json:"star_count"`
+				Forks         int       `json:"forks_count"`
+				Archived      bool      `json:"archived"`
+				ForkedFrom    any       `json:"forked_from_project"`
+				DefaultBranch string    `json:"default_branch"`
+				LastActivity  time.Time `json:"last_activity_at"`
+			}](data)
+			if err != nil {
+				return nil, err
+			}
+			return &Repo{URL: r.WebURL, Description: r.Description, Stars: r.Stars, Forks: r.Forks,
+				Archived: r.Archived, Fork: r.ForkedFrom != nil, DefaultBranch: r.DefaultBranch, PushedAt: r.LastActivity}, nil
+		},
+		auth:            func(req *http.Request, token string) { req.Header.Set("PRIVATE-TOKEN", token) },
+		remainingHeader: "RateLimit-Remaining",
+		resetHeader:     "RateLimit-Reset",
+	},
+	Bitbucket: {
+		baseURL: "https://api.bitbucket.org/2.0",
+		repoPath: func(owner, name string) string {
+			return "/repositories/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+		},
+		decode: func(data []byte) (*Repo, error) {
+			// Bitbucket reports neither stars nor archiving.
+			r, err := unmarshal[struct {
+				Links struct {
+					HTML struct {
+						Href string `json:"href"`
+					} `json:"html"`
+				} `json:"links"`
+				Description string `json:"description"`
+				Parent      any    `json:"parent"`
+				MainBranch  struct {
+					Name string `json:"name"`
+				} `json:"mainbranch"`
+				UpdatedOn time.Time `json:"updated_on"`
+			}](data)
+			if err != nil {
+				return nil, err
+			}
+			return &Repo{URL: r.Links.HTML.Href, Description: r.Description, Fork: r.Parent != nil,
+				DefaultBranch: r.MainBranch.Name, PushedAt: r.UpdatedOn}, nil
+		},
+		auth:            bearer,
+		remainingHeader: "X-RateLimit-Remaining",
+		resetHeader:     "X-RateLimit-Reset",
+	},
+}
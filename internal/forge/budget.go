@@ -0,0 +1,147 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A budget tracks the rate limits of a forge's tokens.
+type budget struct {
+	reserve int
+
+	mu     sync.Mutex
+	tokens []*token
+}
+
+type token struct {
+	value     string // empty for unauthenticated requests
+	remaining int    // -1 if unknown
+	reset     time.Time
+}
+
+func newBudget(values []string, reserve int) *budget {
+	b := &budget{reserve: reserve}
+	for _, v := range values {
+		b.tokens = append(b.tokens, &token{value: v, remaining: -1})
+	}
+	if len(b.tokens) == 0 {
+		b.tokens = []*token{{remaining: -1}}
+	}
+	return b
+}
+
+// acquire returns the token with the most requests remaining, and counts a
+// request against it. If every token has spent its budget, acquire waits
+// for the earliest reset.
+func (b *budget) acquire(ctx context.Context) (*token, error) {
+	for {
+		b.mu.Lock()
+		t := b.best()
+		if t.remaining < 0 || t.remaining > b.reserve {
+			if t.remaining > 0 {
+				t.remaining--
+			}
+			b.mu.Unlock()
+			return t, nil
+		}
+		wait := time.Until(t.reset)
+		if wait <= 0 {
+			// The window has reset; the next response will tell us the new budget.
+			t.remaining = -1
+			b.mu.Unlock()
+			continue
+		}
+		b.mu.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// best returns the token that should be used next: one with an unknown
+// budget, or else the one with the most remaining requests, or if none have
+// any, the one that resets first. b.mu must be held.
+func (b *budget) best() *token {
+	var best *token
+	for _, t := range b.tokens {
+		switch {
+		case t.remaining < 0:
+			return t
+		case best == nil:
+			best = t
+		case t.remaining > best.remaining:
+			best = t
+		case t.remaining == best.remaining && t.reset.Before(best.reset):
+			best = t
+		}
+	}
+	if best.remaining <= b.reserve {
+		for _, t := range b.tokens {
+			if t.reset.Before(best.reset) {
+				best = t
+			}
+		}
+	}
+	return best
+}
+
+// update records the rate-limit headers of a response to a request made with t.
+func (b *budget) update(t *token, h http.Header, remainingHeader, resetHeader string) {
+	rem, err := strconv.Atoi(h.Get(remainingHeader))
+	if err != nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t.remaining = rem
+	if secs, err := strconv.ParseInt(h.Get(resetHeader), 10, 64); err == nil {
+		t.reset = time.Unix(secs, 0)
+	}
+}
+
+// remaining returns the total remaining requests of b's tokens, or -1 if
+// any is unknown.
+func (b *budget) remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, t := range b.tokens {
+		if t.remaining < 0 {
+			return -1
+		}
+		n += t.remaining
+	}
+	return n
+}
+
+// A budgetTransport authenticates requests with a token from its budget,
+// and updates the budget from the responses.
+type budgetTransport struct {
+	api    api
+	budget *budget
+	base   http.RoundTripper
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.budget.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if tok.value != "" {
+		req = req.Clone(req.Context())
+		t.api.auth(req, tok.value)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.budget.update(tok, resp.Header, t.api.remainingHeader, t.api.resetHeader)
+	return resp, nil
+}
@@ -0,0 +1,194 @@
+// Package forge fetches repository metadata from code hosting sites
+// ("forges"): GitHub, GitLab and Bitbucket.
+//
+// A [Client] authenticates with tokens for each forge, spends each token's
+// rate-limit budget carefully, and caches responses on disk, so that the
+// steps that enrich modules with repository metadata can share it.
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/logging"
+)
+
+// Names of forges.
+const (
+	GitHub    = "github"
+	GitLab    = "gitlab"
+	Bitbucket = "bitbucket"
+)
+
+// A Repo is the metadata of a repository, in the same form for every forge.
+// Fields a forge does not provide are zero.
+type Repo struct {
+	Forge         string
+	Owner         string // user or organization; for GitLab, the namespace
+	Name          string
+	URL           string // web page
+	Description   string
+	Stars         int
+	Forks         int
+	Archived      bool
+	Fork          bool
+	DefaultBranch string
+	PushedAt      time.Time // most recent activity
+}
+
+// RepoFor returns the forge, owner and repository name of the repository
+// holding the module with the given path. It reports false if the module
+// is not on a known forge.
+func RepoFor(modulePath string) (forge, owner, name string, ok bool) {
+	parts := strings.Split(modulePath, "/")
+	if len(parts) < 3 {
+		return "", "", "", false
+	}
+	switch parts[0] {
+	case "github.com":
+		forge = GitHub
+	case "gitlab.com":
+		forge = GitLab
+	case "bitbucket.org":
+		forge = Bitbucket
+	default:
+		return "", "", "", false
+	}
+	return forge, parts[1], strings.TrimSuffix(parts[2], ".git"), true
+}
+
+// Options configure a [Client].
+type Options struct {
+	// Tokens are the access tokens for each forge, by forge name.
+	// Requests are sent without authentication for a forge with no tokens.
+	Tokens map[string][]string
+	// Reserve is the number of requests in each token's rate-limit window
+	// to leave unused, for other programs that share the token.
+	Reserve int
+	// CacheDir is the directory for cached responses. If empty,
+	// responses are not cached.
+	CacheDir string
+	// CacheTTL is how long a cached response is used. If zero, 24 hours is used.
+	CacheTTL time.Duration
+	// BaseURLs override the API URLs of forges, by forge name,
+	// for self-hosted instances or testing.
+	BaseURLs map[string]string
+}
+
+// TokensFromEnv returns tokens from the environment variables GITHUB_TOKEN,
+// GITLAB_TOKEN and BITBUCKET_TOKEN. Each may hold several comma-separated tokens.
+func TokensFromEnv() map[string][]string {
+	m := map[string][]string{}
+	for forge, v := range map[string]string{GitHub: "GITHUB_TOKEN", GitLab: "GITLAB_TOKEN", Bitbucket: "BITBUCKET_TOKEN"} {
+		for t := range strings.SplitSeq(os.Getenv(v), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				m[forge] = append(m[forge], t)
+			}
+		}
+	}
+	return m
+}
+
+// A Client fetches repository metadata. It is safe for concurrent use.
+type Client struct {
+	forges map[string]*forgeClient
+}
+
+// A forgeClient fetches from one forge.
+type forgeClient struct {
+	api    api
+	base   string
+	client *http.Client
+	budget *budget
+}
+
+// New returns a Client configured by opts.
+func New(opts Options) *Client {
+	c := &Client{forges: map[string]*forgeClient{}}
+	for name, a := range apis {
+		b := newBudget(opts.Tokens[name], opts.Reserve)
+		var rt http.RoundTripper = &budgetTransport{api: a, budget: b, base: httputil.DefaultClient.Transport}
+		if opts.CacheDir != "" {
+			dir := filepath.Join(opts.CacheDir, name)
+			rt = &httputil.CacheTransport{
+				Base:       rt,
+				Dir:        dir,
+				TTL:        opts.CacheTTL,
+				Validators: &httputil.ValidatorStore{Dir: filepath.Join(dir, "validators")},
+			}
+		}
+		base := a.baseURL
+		if u := opts.BaseURLs[name]; u != "" {
+			base = strings.TrimSuffix(u, "/")
+		}
+		c.forges[name] = &forgeClient{
+			api:    a,
+			base:   base,
+			client: &http.Client{Transport: rt, Timeout: httputil.DefaultClient.Timeout},
+			budget: b,
+		}
+	}
+	return c
+}
+
+// Repo returns the metadata of a repository. If the repository does not
+// exist, the error wraps [errs.NotFound].
+func (c *Client) Repo(ctx context.Context, forge, owner, name string) (_ *Repo, err error) {
+	defer errs.Wrap(&err, "forge.Repo(%s, %s/%s)", forge, owner, name)
+	fc := c.forges[forge]
+	if fc == nil {
+		return nil, fmt.Errorf("unknown forge %q", forge)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", fc.base+fc.api.repoPath(owner, name), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	logging.FromContext(ctx).DebugContext(ctx, "forge request", "url", req.URL.Redacted())
+	body, err := httputil.DoReadBody(req, httputil.WithClient(fc.client))
+	if err != nil {
+		return nil, err
+	}
+	r, err := fc.api.decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	r.Forge, r.Owner, r.Name = forge, owner, name
+	return r, nil
+}
+
+// ModuleRepo returns the metadata of the repository holding the module with
+// the given path. See [RepoFor].
+func (c *Client) ModuleRepo(ctx context.Context, modulePath string) (*Repo, error) {
+	forge, owner, name, ok := RepoFor(modulePath)
+	if !ok {
+		return nil, errs.Errorf(errs.NotFound, "forge: %s is not on a known forge", modulePath)
+	}
+	return c.Repo(ctx, forge, owner, name)
+}
+
+// Remaining returns the number of requests left in the current rate-limit
+// windows of the forge's tokens, or -1 if it is not yet known.
+func (c *Client) Remaining(forge string) int {
+	fc := c.forges[forge]
+	if fc == nil {
+		return 0
+	}
+	return fc.budget.remaining()
+}
+
+func unmarshal[T any](data []byte) (*T, error) {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -0,0 +1,150 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+func TestRepoFor(t *testing.T) {
+	for _, test := range []struct {
+		path               string
+		forge, owner, name string
+		ok                 bool
+	}{
+		{"github.com/jba/go-ecosystem/sub", GitHub, "jba", "go-ecosystem", true},
+		{"gitlab.com/group/proj.git", GitLab, "group", "proj", true},
+		{"bitbucket.org/o/r", Bitbucket, "o", "r", true},
+		{"github.com/jba", "", "", "", false},
+		{"golang.org/x/mod", "", "", "", false},
+	} {
+		forge, owner, name, ok := RepoFor(test.path)
+		if forge != test.forge || owner != test.owner || name != test.name || ok != test.ok {
+			t.Errorf("%s: got %s, %s, %s, %t", test.path, forge, owner, name, ok)
+		}
+	}
+}
+
+// fakeGitHub serves repos with a per-token rate limit.
+type fakeGitHub struct {
+	limit int
+	reset time.Time
+
+	mu       sync.Mutex
+	used     map[string]int // by Authorization header
+	requests int
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	auth := r.Header.Get("Authorization")
+	f.used[auth]++
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(f.limit-f.used[auth]))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(f.reset.Unix(), 10))
+	if r.URL.Path == "/repos/o/missing" {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, `{"html_url": "https://github.com%s", "stargazers_count": 7, "archived": true, "pushed_at": "2024-01-02T03:04:05Z"}`, r.URL.Path[len("/repos"):])
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeGitHub{limit: 3, reset: time.Now().Add(time.Hour), used: map[string]int{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	c := New(Options{
+		Tokens:   map[string][]string{GitHub: {"t1", "t2"}},
+		Reserve:  1,
+		CacheDir: t.TempDir(),
+		BaseURLs: map[string]string{GitHub: srv.URL},
+	})
+	r, err := c.ModuleRepo(ctx, "github.com/o/r/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Repo{Forge: GitHub, Owner: "o", Name: "r", URL: "https://github.com/o/r", Stars: 7, Archived: true,
+		PushedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if *r != want {
+		t.Errorf("got  %+v\nwant %+v", *r, want)
+	}
+
+	// A cached response doesn't use the budget.
+	if _, err := c.Repo(ctx, GitHub, "o", "r"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requests != 1 {
+		t.Errorf("got %d requests, want 1", fake.requests)
+	}
+
+	_, err = c.Repo(ctx, GitHub, "o", "missing")
+	if !errors.Is(err, errs.NotFound) {
+		t.Errorf("got %v, want NotFound", err)
+	}
+
+	// Each token has a limit of 3 and a reserve of 1, so 4 requests in all
+	// can be made before the budget is spent.
+	for _, name := range []string{"a", "b"} {
+		if _, err := c.Repo(ctx, GitHub, "o", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.used["Bearer t1"] + fake.used["Bearer t2"]; got != 4 {
+		t.Errorf("got %d requests with tokens, want 4", got)
+	}
+	if got := c.Remaining(GitHub); got != 2 {
+		t.Errorf("Remaining: got %d, want 2", got)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Repo(ctx, GitHub, "o", "c"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("with budget spent: got %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestBudgetReset(t *testing.T) {
+	b := newBudget([]string{"t"}, 0)
+	tok, err := b.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header{}
+	h.Set("X-RateLimit-Remaining", "0")
+	reset := time.Unix(time.Now().Add(time.Second).Unix(), 0)
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	b.update(tok, h, "X-RateLimit-Remaining", "X-RateLimit-Reset")
+	if _, err := b.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Now().Before(reset) {
+		t.Error("acquire did not wait for the reset")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	gl, err := apis[GitLab].decode([]byte(`{"web_url": "u", "star_count": 3, "forked_from_project": {"id": 1}, "default_branch": "main"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gl.URL != "u" || gl.Stars != 3 || !gl.Fork || gl.DefaultBranch != "main" {
+		t.Errorf("GitLab: got %+v", gl)
+	}
+	bb, err := apis[Bitbucket].decode([]byte(`{"links": {"html": {"href": "u"}}, "mainbranch": {"name": "trunk"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bb.URL != "u" || bb.Fork || bb.DefaultBranch != "trunk" {
+		t.Errorf("Bitbucket: got %+v", bb)
+	}
+}
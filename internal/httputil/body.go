@@ -0,0 +1,90 @@
+package httputil
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrTruncated is returned when a response body is shorter than its
+// Content-Length.
+var ErrTruncated = errors.New("response body truncated")
+
+// bodyReader returns a reader for the body of resp that decompresses it
+// according to its Content-Encoding, and that returns an error wrapping
+// [ErrTruncated] if fewer bytes are read than the Content-Length promised.
+// The caller must still close resp.Body.
+func bodyReader(resp *http.Response) (io.Reader, error) {
+	var r io.Reader = resp.Body
+	if resp.ContentLength >= 0 && !isHead(resp) {
+		r = &lengthReader{r: r, want: resp.ContentLength, url: responseURL(resp)}
+	}
+	switch enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// "deflate" should mean zlib-wrapped data (RFC 9110, section 8.4.1.2),
+		// but some servers send raw DEFLATE.
+		br := bufio.NewReader(r)
+		if h, err := br.Peek(2); err == nil && isZlibHeader(h) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported Content-Encoding %q", responseURL(resp), enc)
+	}
+}
+
+// isZlibHeader reports whether h begins with a valid zlib header.
+func isZlibHeader(h []byte) bool {
+	return h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
+
+// isCompressed reports whether resp's body has a Content-Encoding
+// that bodyReader will decode.
+func isCompressed(resp *http.Response) bool {
+	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	return enc != "" && enc != "identity"
+}
+
+func isHead(resp *http.Response) bool {
+	return resp.Request != nil && resp.Request.Method == http.MethodHead
+}
+
+func responseURL(resp *http.Response) string {
+	if resp.Request != nil && resp.Request.URL != nil {
+		return resp.Request.URL.Redacted()
+	}
+	return "response"
+}
+
+// A lengthReader checks that its underlying reader returns exactly
+// want bytes.
+type lengthReader struct {
+	r    io.Reader
+	n    int64
+	want int64
+	url  string
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.want {
+		return n, fmt.Errorf("%s: read more than Content-Length %d", l.url, l.want)
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		if l.n < l.want {
+			return n, fmt.Errorf("%s: got %d of %d bytes: %w", l.url, l.n, l.want, ErrTruncated)
+		}
+	}
+	return n, err
+}
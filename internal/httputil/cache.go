@@ -0,0 +1,274 @@
+package httputil
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// A CacheTransport is an [http.RoundTripper] that caches responses in files,
+// in the format described at [EncodeCacheFile].
+// Successful (2xx) responses are cached for TTL, and 404 and 410 responses
+// are cached for NegativeTTL. Other responses are not cached.
+// Response headers are not cached.
+type CacheTransport struct {
+	// Base performs requests that are not cached.
+	// If nil, [http.DefaultTransport] is used.
+	Base http.RoundTripper
+
+	// Dir is the directory holding the cache files.
+	// It is created if it doesn't exist.
+	Dir string
+
+	// TTL is how long a successful response is cached.
+	// If zero, 24 hours is used.
+	TTL time.Duration
+
+	// NegativeTTL is how long a 404 or 410 response is cached.
+	// If zero, TTL is used. If negative, those responses are not cached.
+	NegativeTTL time.Duration
+
+	// MaxEntrySize is the largest response body that will be cached.
+	// If zero, there is no limit.
+	MaxEntrySize int64
+
+	// Key returns the cache key for a request, or the empty string
+	// if the request should not be cached.
+	// If nil, [DefaultCacheKey] is used.
+	Key func(*http.Request) string
+
+	// Validators, if non-nil, stores the ETag and Last-Modified values
+	// of cached successful responses. An expired entry that has them is
+	// revalidated with a conditional request, and if the server replies
+	// 304 Not Modified, the entry is served and its lifetime extended.
+	Validators *ValidatorStore
+}
+
+// DefaultCacheKey returns a key for GET requests that is derived from the URL,
+// and the empty string for other requests.
+func DefaultCacheKey(req *http.Request) string {
+	if req.Method != "" && req.Method != http.MethodGet {
+		return ""
+	}
+	return req.URL.String()
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	keyf := t.Key
+	if keyf == nil {
+		keyf = DefaultCacheKey
+	}
+	key := keyf(req)
+	if key == "" {
+		return base.RoundTrip(req)
+	}
+	filename := t.filename(key)
+	status, body, fresh, err := t.read(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil && fresh {
+		return CachedResponse(req, status, body), nil
+	}
+
+	var vals Validators
+	if err == nil && t.Validators != nil && status == http.StatusOK {
+		// Expired, but we may be able to revalidate it.
+		vals, err = t.Validators.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if !vals.IsZero() {
+			req = req.Clone(req.Context())
+			SetConditional(req, vals)
+		}
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if !vals.IsZero() && IsNotModified(resp) {
+		resp.Body.Close()
+		now := time.Now()
+		if err := os.Chtimes(filename, now, now); err != nil {
+			return nil, err
+		}
+		return CachedResponse(req, status, body), nil
+	}
+	if t.ttl(resp.StatusCode) <= 0 {
+		return resp, nil
+	}
+	// Read the body, up to the limit.
+	var r io.Reader = resp.Body
+	if t.MaxEntrySize > 0 {
+		r = io.LimitReader(r, t.MaxEntrySize+1)
+	}
+	body, err = io.ReadAll(r)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if t.MaxEntrySize > 0 && int64(len(body)) > t.MaxEntrySize {
+		// Too big to cache. Return the part we read and the rest.
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	if err := t.write(filename, resp.StatusCode, body); err != nil {
+		return nil, err
+	}
+	if t.Validators != nil {
+		var v Validators
+		if resp.StatusCode == http.StatusOK {
+			v = ValidatorsFrom(resp)
+		}
+		if err := t.Validators.Put(key, v); err != nil {
+			return nil, err
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// ttl returns how long a response with the given status should be cached.
+func (t *CacheTransport) ttl(status int) time.Duration {
+	ttl := cmp.Or(t.TTL, 24*time.Hour)
+	switch {
+	case status >= 200 && status < 300:
+		return ttl
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return cmp.Or(t.NegativeTTL, ttl)
+	default:
+		return 0
+	}
+}
+
+// filename returns the name of the cache file for key.
+func (t *CacheTransport) filename(key string) string {
+	return filepath.Join(t.Dir, CacheFileName(key))
+}
+
+// CacheFileName returns the name of the cache file for key.
+// It is the escaped key, or a hash of the key if that is too long.
+func CacheFileName(key string) string {
+	name := url.PathEscape(key)
+	// Keep file names within common limits.
+	if len(name) > 200 {
+		name = fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+	}
+	return name
+}
+
+// read returns the status and body stored in the named file, and whether
+// the entry is fresh.
+func (t *CacheTransport) read(filename string) (status int, body []byte, fresh bool, err error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	status, body, err = DecodeCacheFile(data)
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("cache file %s: %w", filename, err)
+	}
+	return status, body, time.Since(info.ModTime()) < t.ttl(status), nil
+}
+
+// write writes the status and body to the named file.
+func (t *CacheTransport) write(filename string, status int, body []byte) error {
+	return WriteFileAtomic(filename, EncodeCacheFile(status, body))
+}
+
+// EncodeCacheFile returns the contents of a cache file for a response
+// with the given status and body: the status on the first line,
+// followed by the body. Response headers are not stored.
+func EncodeCacheFile(status int, body []byte) []byte {
+	return fmt.Appendf(nil, "%d\n%s", status, body)
+}
+
+// DecodeCacheFile returns the status and body stored in the contents
+// of a cache file.
+func DecodeCacheFile(data []byte) (status int, body []byte, err error) {
+	line, body, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return 0, nil, errors.New("missing status line")
+	}
+	status, err = strconv.Atoi(string(line))
+	if err != nil {
+		return 0, nil, fmt.Errorf("bad status: %w", err)
+	}
+	return status, body, nil
+}
+
+// ReadCacheStatus returns the status stored at the start of a cache
+// file, without reading the body.
+func ReadCacheStatus(r io.Reader) (int, error) {
+	// The status line is at most "999\n", but leave room for junk to be
+	// reported as a bad status.
+	data, err := io.ReadAll(io.LimitReader(r, 16))
+	if err != nil {
+		return 0, err
+	}
+	status, _, err := DecodeCacheFile(data)
+	return status, err
+}
+
+// WriteFileAtomic writes data to the named file, creating its directory
+// if necessary. Readers never see a partially written file.
+func WriteFileAtomic(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	err = errors.Join(err, f.Close())
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// CachedResponse returns a response to req with the given status and body,
+// like one read from a cache file.
+func CachedResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
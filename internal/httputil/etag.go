@@ -0,0 +1,90 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Validators are the values a server provides to revalidate a cached
+// response with a conditional GET.
+type Validators struct {
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+}
+
+// IsZero reports whether v has no validators.
+func (v Validators) IsZero() bool {
+	return v == Validators{}
+}
+
+// ValidatorsFrom returns the validators in the headers of resp.
+func ValidatorsFrom(resp *http.Response) Validators {
+	return Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+}
+
+// SetConditional sets the If-None-Match and If-Modified-Since headers of req
+// from v, making it a conditional request.
+// A server that has no newer response will reply with 304 Not Modified;
+// see [IsNotModified].
+func SetConditional(req *http.Request, v Validators) {
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// IsNotModified reports whether resp is a 304 Not Modified response.
+func IsNotModified(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusNotModified
+}
+
+// A ValidatorStore persists Validators in files, keyed by URL
+// or another string.
+type ValidatorStore struct {
+	Dir string
+}
+
+// Get returns the validators stored for key.
+// If there are none, it returns the zero Validators and a nil error.
+func (s *ValidatorStore) Get(key string) (Validators, error) {
+	var v Validators
+	data, err := os.ReadFile(s.filename(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+// Put stores validators for key. If v is zero, it removes the stored validators.
+func (s *ValidatorStore) Put(key string, v Validators) error {
+	filename := s.filename(key)
+	if v.IsZero() {
+		err := os.Remove(filename)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filename, data)
+}
+
+func (s *ValidatorStore) filename(key string) string {
+	return filepath.Join(s.Dir, CacheFileName(key))
+}
@@ -0,0 +1,66 @@
+package httputil
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"sync"
+)
+
+// A Result is the outcome of one request made by [FetchAll].
+type Result struct {
+	Index int           // index of the request in the slice passed to FetchAll
+	Req   *http.Request // the request
+	Body  []byte        // the response body, if Err is nil
+	Err   error         // the error from DoReadBody
+}
+
+// FetchAll executes reqs with at most concurrency requests in flight, and
+// returns their results in the order they complete. Each request is made with
+// [DoReadBody] and opts, so rate limiting and retries are whatever the client
+// (see [WithClient]) provides, applied uniformly to all requests.
+//
+// The requests are made with ctx. If the caller stops iterating early,
+// outstanding requests are canceled.
+// A concurrency less than 1 is treated as 1.
+func FetchAll(ctx context.Context, reqs []*http.Request, concurrency int, opts ...Option) iter.Seq[Result] {
+	return func(yield func(Result) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		results := make(chan Result)
+		sem := make(chan struct{}, max(concurrency, 1))
+		var wg sync.WaitGroup
+		go func() {
+			defer close(results)
+			defer wg.Wait()
+			for i, req := range reqs {
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					body, err := DoReadBody(req.WithContext(ctx), opts...)
+					select {
+					case results <- Result{Index: i, Req: req, Body: body, Err: err}:
+					case <-ctx.Done():
+					}
+				}()
+			}
+		}()
+
+		for r := range results {
+			if !yield(r) {
+				cancel()
+				// Drain so the goroutines can exit.
+				for range results {
+				}
+				return
+			}
+		}
+	}
+}
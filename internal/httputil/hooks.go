@@ -0,0 +1,81 @@
+package httputil
+
+import (
+	"net/http"
+	"time"
+)
+
+// Hooks are functions that are called while a request is processed.
+// Any of them may be nil.
+type Hooks struct {
+	// BeforeRequest is called before a request is sent. It may modify the
+	// request, for example by setting headers; it is given a copy of the
+	// request passed to Do or RoundTrip. If BeforeRequest returns an error,
+	// the request is not sent and the error is returned.
+	BeforeRequest func(*http.Request) error
+
+	// AfterResponse is called after a response is received, with the
+	// time it took to receive it.
+	AfterResponse func(*http.Request, *http.Response, time.Duration)
+
+	// OnError is called when a request fails without a response.
+	OnError func(*http.Request, error)
+}
+
+// SetHeader returns Hooks that set the given request header.
+func SetHeader(key, value string) Hooks {
+	return Hooks{
+		BeforeRequest: func(req *http.Request) error {
+			req.Header.Set(key, value)
+			return nil
+		},
+	}
+}
+
+// LogRequests returns Hooks that log each request and its outcome
+// with logf, for example [log.Printf].
+func LogRequests(logf func(format string, args ...any)) Hooks {
+	return Hooks{
+		AfterResponse: func(req *http.Request, resp *http.Response, d time.Duration) {
+			logf("%s %s: %d in %s", req.Method, req.URL.Redacted(), resp.StatusCode, d.Round(time.Millisecond))
+		},
+		OnError: func(req *http.Request, err error) {
+			logf("%s %s: %v", req.Method, req.URL.Redacted(), err)
+		},
+	}
+}
+
+// AddHooks adds hooks to c. Hooks are called in the order they were added.
+func (c *LimitedClient) AddHooks(hs ...Hooks) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, hs...)
+}
+
+// withHooks calls send on req, running c's hooks around it.
+func (c *LimitedClient) withHooks(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	c.mu.Lock()
+	hooks := c.hooks
+	c.mu.Unlock()
+	if len(hooks) == 0 {
+		return send(req)
+	}
+	req = req.Clone(req.Context())
+	for _, h := range hooks {
+		if h.BeforeRequest != nil {
+			if err := h.BeforeRequest(req); err != nil {
+				return nil, err
+			}
+		}
+	}
+	start := time.Now()
+	resp, err := send(req)
+	for _, h := range hooks {
+		if err != nil && h.OnError != nil {
+			h.OnError(req, err)
+		} else if err == nil && h.AfterResponse != nil {
+			h.AfterResponse(req, resp, time.Since(start))
+		}
+	}
+	return resp, err
+}
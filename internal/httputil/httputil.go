@@ -2,19 +2,80 @@
 package httputil
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
 )
 
 // HTTPError represents an HTTP error response.
 type HTTPError struct {
 	Status int
+	URL    string      // the URL of the request, if known
+	Body   string      // the start of the response body, if any
+	Header http.Header // selected response headers; see [errorHeaders]
 }
 
+// maxErrorBody is the maximum number of bytes of a response body
+// to keep in an HTTPError.
+const maxErrorBody = 512
+
+// errorHeaders are the response headers kept in an HTTPError.
+var errorHeaders = []string{"Content-Type", "Retry-After", "Www-Authenticate", "X-Request-Id", "X-Ratelimit-Remaining", "X-Ratelimit-Reset"}
+
 func (e *HTTPError) Error() string {
-	return fmt.Sprintf("HTTP %d: %s", e.Status, http.StatusText(e.Status))
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP %d: %s", e.Status, http.StatusText(e.Status))
+	if e.URL != "" {
+		fmt.Fprintf(&b, " (%s)", e.URL)
+	}
+	if body := strings.Join(strings.Fields(e.Body), " "); body != "" {
+		fmt.Fprintf(&b, ": %s", body)
+	}
+	return b.String()
+}
+
+// Is reports whether the status of e corresponds to the error kind target:
+// 404 is [errs.NotFound], 410 is [errs.Gone], and 429 and the 5xx statuses
+// except 501 are [errs.Temporary].
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case errs.NotFound:
+		return e.Status == http.StatusNotFound
+	case errs.Gone:
+		return e.Status == http.StatusGone
+	case errs.Temporary:
+		return e.Status == http.StatusTooManyRequests ||
+			(e.Status >= 500 && e.Status != http.StatusNotImplemented)
+	}
+	return false
+}
+
+// newHTTPError returns an HTTPError for resp and the beginning of its body.
+func newHTTPError(resp *http.Response, body []byte) *HTTPError {
+	e := &HTTPError{Status: resp.StatusCode}
+	if resp.Request != nil && resp.Request.URL != nil {
+		e.URL = resp.Request.URL.Redacted()
+	}
+	if len(body) > maxErrorBody {
+		body = append(body[:maxErrorBody:maxErrorBody], "..."...)
+	}
+	e.Body = strings.ToValidUTF8(string(body), "\uFFFD")
+	for _, h := range errorHeaders {
+		if v := resp.Header.Values(h); len(v) > 0 {
+			if e.Header == nil {
+				e.Header = http.Header{}
+			}
+			e.Header[h] = v
+		}
+	}
+	return e
 }
 
 // -1 if not an HTTPError
@@ -26,20 +87,136 @@ func ErrorStatus(err error) int {
 	return -1
 }
 
+// IsNotFound reports whether err is an HTTPError with status 404 Not Found.
+func IsNotFound(err error) bool {
+	return ErrorStatus(err) == http.StatusNotFound
+}
+
+// IsGone reports whether err is an HTTPError with status 410 Gone.
+func IsGone(err error) bool {
+	return ErrorStatus(err) == http.StatusGone
+}
+
+// IsTooManyRequests reports whether err is an HTTPError with status
+// 429 Too Many Requests.
+func IsTooManyRequests(err error) bool {
+	return ErrorStatus(err) == http.StatusTooManyRequests
+}
+
+// A Doer sends HTTP requests.
+// [http.Client] and [LimitedClient] are Doers.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// DefaultClient is the client used by [DoReadBody] and other functions
+// in this package when no client is provided.
+// Unlike [http.DefaultClient], it has timeouts, so a hung server cannot
+// stall its caller forever.
+var DefaultClient = &http.Client{
+	Timeout: 10 * time.Minute,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		ExpectContinueTimeout: time.Second,
+	},
+}
+
+// An Option configures a request made by a function in this package.
+type Option func(*options)
+
+type options struct {
+	client  Doer
+	timeout time.Duration
+	maxSize int64
+}
+
+// WithClient sends the request with d instead of [DefaultClient].
+func WithClient(d Doer) Option {
+	return func(o *options) { o.client = d }
+}
+
+// WithTimeout limits the time for the entire request, including reading the
+// response body, to d.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+func buildOptions(opts []Option) *options {
+	o := &options{client: DefaultClient}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
 // DoReadBody executes an HTTP request and returns the response body.
 // It returns an HTTPError for non-2xx status codes.
-func DoReadBody(req *http.Request) ([]byte, error) {
-	resp, err := http.DefaultClient.Do(req)
+// See [ReadBody] for how the body is read.
+func DoReadBody(req *http.Request, opts ...Option) ([]byte, error) {
+	o := buildOptions(opts)
+	if o.timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), o.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	resp, err := o.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	return readBody(resp, o.maxSize)
+}
+
+// ReadBody reads and closes the body of resp.
+// It returns an HTTPError for non-2xx status codes.
+// A gzip or deflate Content-Encoding is decoded, and a body shorter than its
+// Content-Length results in an error wrapping [ErrTruncated].
+func ReadBody(resp *http.Response) ([]byte, error) {
+	return readBody(resp, 0)
+}
+
+// readBody is like ReadBody, but if maxSize is positive, it returns an error
+// wrapping [ErrTooLarge] for bodies larger than maxSize.
+func readBody(resp *http.Response, maxSize int64) ([]byte, error) {
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody+1))
+		return nil, newHTTPError(resp, body)
+	}
+	if err := checkContentLength(resp, maxSize); err != nil {
+		return nil, err
+	}
+	r, err := bodyReader(resp)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, &HTTPError{Status: resp.StatusCode}
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("%s: more than %d bytes: %w", responseURL(resp), maxSize, ErrTooLarge)
 	}
 	return body, nil
 }
+
+// checkContentLength returns an error wrapping [ErrTooLarge] if the
+// uncompressed body of resp is known to be larger than maxSize.
+func checkContentLength(resp *http.Response, maxSize int64) error {
+	if maxSize > 0 && !isCompressed(resp) && resp.ContentLength > maxSize {
+		return fmt.Errorf("%s: Content-Length %d: %w", responseURL(resp), resp.ContentLength, ErrTooLarge)
+	}
+	return nil
+}
@@ -0,0 +1,558 @@
+package httputil
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch n.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &RetryTransport{MinBackoff: time.Millisecond}}
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := DoReadBody(req, WithClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || n.Load() != 3 {
+		t.Errorf("got %q after %d attempts, want \"ok\" after 3", body, n.Load())
+	}
+
+	// Non-retryable status.
+	n.Store(0)
+	client.Transport = &RetryTransport{
+		MinBackoff:  time.Millisecond,
+		RetryStatus: func(s int) bool { return false },
+	}
+	_, err = DoReadBody(req, WithClient(client))
+	if ErrorStatus(err) != http.StatusServiceUnavailable || n.Load() != 1 {
+		t.Errorf("got %v after %d attempts, want 503 after 1", err, n.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"Wed, 01 Jan 2025 00:00:30 GMT", 30 * time.Second, true},
+		{"Tue, 31 Dec 2024 00:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	} {
+		got, ok := parseRetryAfter(test.in, now)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %s, %t; want %s, %t", test.in, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestLimitedClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := NewLimitedClient(nil, 1000, 1)
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := c.DoReadBody(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// As a transport.
+	hc := &http.Client{Transport: c}
+	res, err := hc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := c.Calls(); got != 4 {
+		t.Errorf("got %d calls, want 4", got)
+	}
+	if c.QPS() <= 0 {
+		t.Errorf("got QPS %f, want positive", c.QPS())
+	}
+	c.ResetQPS()
+	if got := c.Calls(); got != 0 {
+		t.Errorf("after reset: got %d calls, want 0", got)
+	}
+	if got := c.Stats().Requests; got != 4 {
+		t.Errorf("after reset: got %d total requests, want 4", got)
+	}
+}
+
+func TestCacheTransport(t *testing.T) {
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Add(1)
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/fail":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		case "/big":
+			w.Write(bytes.Repeat([]byte("x"), 100))
+		default:
+			fmt.Fprintf(w, "hello %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	ct := &CacheTransport{Dir: t.TempDir(), MaxEntrySize: 50}
+	client := &http.Client{Transport: ct}
+	get := func(path string) (string, error) {
+		t.Helper()
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ReadBody(res)
+		return string(body), err
+	}
+
+	for _, test := range []struct {
+		path      string
+		want      string
+		wantErr   int
+		wantCalls int32 // after two requests
+	}{
+		{"/a", "hello /a", 0, 1},
+		{"/missing", "", http.StatusNotFound, 1}, // negative caching
+		{"/fail", "", http.StatusInternalServerError, 2},
+		{"/big", strings.Repeat("x", 100), 0, 2}, // too big to cache
+	} {
+		n.Store(0)
+		for range 2 {
+			got, err := get(test.path)
+			if test.wantErr != 0 {
+				if ErrorStatus(err) != test.wantErr {
+					t.Errorf("%s: got error %v, want status %d", test.path, err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("%s: %v", test.path, err)
+			} else if got != test.want {
+				t.Errorf("%s: got %q, want %q", test.path, got, test.want)
+			}
+		}
+		if got := n.Load(); got != test.wantCalls {
+			t.Errorf("%s: %d calls to server, want %d", test.path, got, test.wantCalls)
+		}
+	}
+
+	// Expired entries are refetched.
+	ct.TTL = time.Nanosecond
+	n.Store(0)
+	if _, err := get("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if n.Load() != 1 {
+		t.Errorf("expired entry was not refetched")
+	}
+}
+
+func TestCacheFile(t *testing.T) {
+	data := EncodeCacheFile(404, []byte("not\nfound"))
+	status, body, err := DecodeCacheFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 404 || string(body) != "not\nfound" {
+		t.Errorf("got %d, %q", status, body)
+	}
+	if status, err := ReadCacheStatus(bytes.NewReader(data)); err != nil || status != 404 {
+		t.Errorf("ReadCacheStatus: got %d, %v", status, err)
+	}
+	for _, bad := range []string{"", "200", "OK\nbody", strings.Repeat("1", 20) + "\n"} {
+		if _, err := ReadCacheStatus(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadCacheStatus(%q): got nil, want error", bad)
+		}
+	}
+}
+
+func TestCacheTransportRevalidate(t *testing.T) {
+	var n, n304 atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			n304.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "body")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	vs := &ValidatorStore{Dir: filepath.Join(dir, "validators")}
+	ct := &CacheTransport{Dir: dir, TTL: time.Nanosecond, Validators: vs}
+	client := &http.Client{Transport: ct}
+	for range 3 {
+		req, err := http.NewRequest("GET", srv.URL+"/a", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := DoReadBody(req, WithClient(client))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(body); got != "body" {
+			t.Errorf("got %q, want %q", got, "body")
+		}
+	}
+	if got, want := n.Load(), int32(3); got != want {
+		t.Errorf("got %d calls, want %d", got, want)
+	}
+	if got, want := n304.Load(), int32(2); got != want {
+		t.Errorf("got %d 304s, want %d", got, want)
+	}
+	v, err := vs.Get(srv.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Validators{ETag: `"v1"`}); v != want {
+		t.Errorf("stored %+v, want %+v", v, want)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.Header().Set("Set-Cookie", "secret")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "slow down\nplease %s", strings.Repeat("!", 1000))
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL+"/x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DoReadBody(req)
+	if !IsTooManyRequests(err) || IsNotFound(err) || IsGone(err) {
+		t.Fatalf("got %v, want 429", err)
+	}
+	var herr *HTTPError
+	if !errors.As(err, &herr) {
+		t.Fatal("not an HTTPError")
+	}
+	if herr.URL != srv.URL+"/x" {
+		t.Errorf("URL: got %q", herr.URL)
+	}
+	if len(herr.Body) != maxErrorBody+3 || !strings.HasPrefix(herr.Body, "slow down\nplease !!") {
+		t.Errorf("Body: got %d bytes: %q...", len(herr.Body), herr.Body[:20])
+	}
+	if got := herr.Header.Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After: got %q", got)
+	}
+	if got := herr.Header.Get("Set-Cookie"); got != "" {
+		t.Errorf("Set-Cookie should not be kept, got %q", got)
+	}
+	wantPrefix := "HTTP 429: Too Many Requests (" + srv.URL + "/x): slow down please !!"
+	if !strings.HasPrefix(err.Error(), wantPrefix) {
+		t.Errorf("got  %q\nwant prefix %q", err.Error(), wantPrefix)
+	}
+}
+
+func TestHTTPErrorKinds(t *testing.T) {
+	for _, test := range []struct {
+		status int
+		want   error
+	}{
+		{http.StatusBadRequest, nil},
+		{http.StatusNotFound, errs.NotFound},
+		{http.StatusGone, errs.Gone},
+		{http.StatusTooManyRequests, errs.Temporary},
+		{http.StatusNotImplemented, nil},
+		{http.StatusServiceUnavailable, errs.Temporary},
+	} {
+		err := fmt.Errorf("wrapped: %w", &HTTPError{Status: test.status})
+		if got := errs.KindOf(err); got != test.want {
+			t.Errorf("%d: got %v, want %v", test.status, got, test.want)
+		}
+	}
+}
+
+func TestDoReadBodyTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DoReadBody(req, WithTimeout(10*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestDoStream(t *testing.T) {
+	const size = 100_000
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(bytes.Repeat([]byte("z"), size))
+	}))
+	defer srv.Close()
+
+	newReq := func(path string) *http.Request {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	var buf bytes.Buffer
+	var progress int64
+	n, err := DoStream(newReq("/"), &buf, func(b int64) { progress += b })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != size || buf.Len() != size || progress != size {
+		t.Errorf("got n=%d, len=%d, progress=%d; want all %d", n, buf.Len(), progress, size)
+	}
+
+	buf.Reset()
+	_, err = DoStream(newReq("/missing"), &buf, nil)
+	if !IsNotFound(err) || buf.Len() != 0 {
+		t.Errorf("got %v with %d bytes written, want 404 and nothing written", err, buf.Len())
+	}
+
+	_, err = DoStream(newReq("/"), io.Discard, nil, WithMaxSize(size-1))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("User-Agent"))
+	}))
+	defer srv.Close()
+
+	var logs []string
+	c := NewLimitedClient(nil, 1000, 1)
+	c.AddHooks(SetHeader("User-Agent", "test-agent"), LogRequests(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}))
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := c.DoReadBody(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "test-agent" {
+		t.Errorf("got %q, want test-agent", body)
+	}
+	if req.Header.Get("User-Agent") != "" {
+		t.Error("hook modified the caller's request")
+	}
+	if len(logs) != 1 || !strings.HasPrefix(logs[0], "GET "+srv.URL+": 200 in ") {
+		t.Errorf("got logs %q", logs)
+	}
+
+	// A BeforeRequest error prevents the request.
+	errBlocked := errors.New("blocked")
+	c.AddHooks(Hooks{BeforeRequest: func(*http.Request) error { return errBlocked }})
+	if _, err := c.DoReadBody(req); !errors.Is(err, errBlocked) {
+		t.Errorf("got %v, want %v", err, errBlocked)
+	}
+}
+
+func TestFetchAll(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	paths := []string{"/a", "/b", "/missing", "/c", "/d", "/e"}
+	var reqs []*http.Request
+	for _, p := range paths {
+		req, err := http.NewRequest("GET", srv.URL+p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqs = append(reqs, req)
+	}
+	const concurrency = 2
+	seen := map[int]bool{}
+	for r := range FetchAll(context.Background(), reqs, concurrency) {
+		seen[r.Index] = true
+		p := paths[r.Index]
+		if p == "/missing" {
+			if !IsNotFound(r.Err) {
+				t.Errorf("%s: got %v, want not found", p, r.Err)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("%s: %v", p, r.Err)
+		} else if got := string(r.Body); got != p {
+			t.Errorf("%s: got body %q", p, got)
+		}
+	}
+	if len(seen) != len(paths) {
+		t.Errorf("got %d results, want %d", len(seen), len(paths))
+	}
+	if got := maxInFlight.Load(); got > concurrency {
+		t.Errorf("%d requests in flight, want at most %d", got, concurrency)
+	}
+
+	// Stopping early doesn't hang.
+	for range FetchAll(context.Background(), reqs, concurrency) {
+		break
+	}
+}
+
+func TestReadBodyDecoding(t *testing.T) {
+	const text = "hello, world"
+	compress := func(newWriter func(io.Writer) io.WriteCloser) string {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		io.WriteString(w, text)
+		w.Close()
+		return buf.String()
+	}
+	gz := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	zl := compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+	fl := compress(func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	})
+
+	for _, test := range []struct {
+		name     string
+		encoding string
+		body     string
+		length   int64 // Content-Length; -1 means len(body)
+		maxSize  int64
+		want     string
+		wantErr  error
+	}{
+		{"plain", "", text, -1, 0, text, nil},
+		{"gzip", "gzip", gz, -1, 0, text, nil},
+		{"zlib", "deflate", zl, -1, 0, text, nil},
+		{"raw deflate", "deflate", fl, -1, 0, text, nil},
+		{"truncated", "", text, 100, 0, "", ErrTruncated},
+		{"truncated gzip", "gzip", gz[:len(gz)-5], int64(len(gz)), 0, "", ErrTruncated},
+		{"too large", "", text, -1, 5, "", ErrTooLarge},
+		{"too large gzip", "gzip", gz, -1, 5, "", ErrTooLarge},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			length := test.length
+			if length < 0 {
+				length = int64(len(test.body))
+			}
+			d := doerFunc(func(req *http.Request) (*http.Response, error) {
+				h := http.Header{}
+				if test.encoding != "" {
+					h.Set("Content-Encoding", test.encoding)
+				}
+				return &http.Response{
+					StatusCode:    200,
+					Header:        h,
+					Body:          io.NopCloser(strings.NewReader(test.body)),
+					ContentLength: length,
+					Request:       req,
+				}, nil
+			})
+			req, err := http.NewRequest("GET", "http://example.com/x", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DoReadBody(req, WithClient(d), WithMaxSize(test.maxSize))
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("DoReadBody: got error %v, want %v", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("DoReadBody: %v", err)
+			} else if string(got) != test.want {
+				t.Errorf("DoReadBody: got %q, want %q", got, test.want)
+			}
+
+			var buf bytes.Buffer
+			_, err = DoStream(req, &buf, nil, WithClient(d), WithMaxSize(test.maxSize))
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("DoStream: got error %v, want %v", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("DoStream: %v", err)
+			} else if buf.String() != test.want {
+				t.Errorf("DoStream: got %q, want %q", buf.String(), test.want)
+			}
+		})
+	}
+}
+
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
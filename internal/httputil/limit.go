@@ -0,0 +1,140 @@
+package httputil
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// A LimitedClient is an HTTP client that limits the rate of its requests
+// and counts them.
+//
+// A LimitedClient is also an [http.RoundTripper], so it can be the base of
+// another transport. For example, a [CacheTransport] whose base is a
+// LimitedClient serves cached responses without waiting.
+type LimitedClient struct {
+	client *http.Client
+	burst  int
+	ncalls atomic.Int64
+	total  atomic.Int64 // like ncalls, but never reset
+	waited atomic.Int64 // nanoseconds spent waiting for the limiter
+
+	mu      sync.Mutex
+	maxQPS  int
+	limiter *rate.Limiter
+	start   time.Time // time of first call since creation or ResetQPS
+	hooks   []Hooks
+}
+
+// NewLimitedClient returns a LimitedClient that sends requests with c at a
+// rate of at most maxQPS requests per second, with bursts of up to burst
+// requests. If c is nil, [DefaultClient] is used.
+func NewLimitedClient(c *http.Client, maxQPS, burst int) *LimitedClient {
+	if c == nil {
+		c = DefaultClient
+	}
+	lc := &LimitedClient{client: c, burst: burst}
+	lc.SetMaxQPS(maxQPS)
+	return lc
+}
+
+// SetMaxQPS changes the maximum rate of requests.
+func (c *LimitedClient) SetMaxQPS(qps int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxQPS = qps
+	c.limiter = rate.NewLimiter(rate.Every(time.Second/time.Duration(qps)), c.burst)
+}
+
+// MaxQPS returns the maximum rate of requests.
+func (c *LimitedClient) MaxQPS() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxQPS
+}
+
+// Do waits until the rate limit allows a request, then sends req,
+// calling the hooks added with [LimitedClient.AddHooks].
+func (c *LimitedClient) Do(req *http.Request) (*http.Response, error) {
+	if err := c.wait(req); err != nil {
+		return nil, err
+	}
+	return c.withHooks(req, c.client.Do)
+}
+
+// RoundTrip implements [http.RoundTripper]. It waits until the rate limit
+// allows a request, then sends req using the transport of c's client,
+// calling the hooks added with [LimitedClient.AddHooks].
+func (c *LimitedClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := c.wait(req); err != nil {
+		return nil, err
+	}
+	t := c.client.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	return c.withHooks(req, t.RoundTrip)
+}
+
+// DoReadBody is like the package function [DoReadBody], but uses c.
+func (c *LimitedClient) DoReadBody(req *http.Request, opts ...Option) ([]byte, error) {
+	return DoReadBody(req, append(opts, WithClient(c))...)
+}
+
+func (c *LimitedClient) wait(req *http.Request) error {
+	c.mu.Lock()
+	lim := c.limiter
+	if c.start.IsZero() {
+		c.start = time.Now()
+	}
+	c.mu.Unlock()
+	start := time.Now()
+	err := lim.Wait(req.Context())
+	c.waited.Add(int64(time.Since(start)))
+	if err != nil {
+		return err
+	}
+	c.ncalls.Add(1)
+	c.total.Add(1)
+	return nil
+}
+
+// LimitStats are cumulative statistics of a [LimitedClient].
+// Unlike [LimitedClient.Calls], they are never reset.
+type LimitStats struct {
+	Requests int64         // requests sent
+	Wait     time.Duration // total time spent waiting for the rate limit
+}
+
+// Stats returns c's statistics.
+func (c *LimitedClient) Stats() LimitStats {
+	return LimitStats{Requests: c.total.Load(), Wait: time.Duration(c.waited.Load())}
+}
+
+// Calls returns the number of requests sent since c was created
+// or [LimitedClient.ResetQPS] was called.
+func (c *LimitedClient) Calls() int64 {
+	return c.ncalls.Load()
+}
+
+// QPS returns the average rate of requests since the first request after c
+// was created or [LimitedClient.ResetQPS] was called.
+func (c *LimitedClient) QPS() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.start.IsZero() {
+		return 0
+	}
+	return float64(c.ncalls.Load()) / time.Since(c.start).Seconds()
+}
+
+// ResetQPS resets the counts used by [LimitedClient.Calls] and [LimitedClient.QPS].
+func (c *LimitedClient) ResetQPS() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ncalls.Store(0)
+	c.start = time.Time{}
+}
@@ -0,0 +1,172 @@
+package httputil
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryTransport is an [http.RoundTripper] that retries requests that fail
+// with transient errors, waiting between attempts with exponential backoff
+// and jitter. It honors the Retry-After header.
+//
+// A request with a body is retried only if its GetBody field is set.
+type RetryTransport struct {
+	// Base performs the requests. If nil, [http.DefaultTransport] is used.
+	Base http.RoundTripper
+
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// If zero, 3 is used.
+	MaxAttempts int
+
+	// MinBackoff is the wait before the first retry. It doubles for each
+	// later attempt, up to MaxBackoff. The actual wait is chosen randomly
+	// between half the backoff and the full backoff.
+	// If zero, 100ms and 10s are used.
+	MinBackoff, MaxBackoff time.Duration
+
+	// MaxRetryAfter is the longest Retry-After wait that will be honored.
+	// If the server asks for a longer one, the response is returned.
+	// If zero, 1 minute is used.
+	MaxRetryAfter time.Duration
+
+	// RetryStatus reports whether a response with the given status should
+	// be retried. If nil, [IsRetryableStatus] is used.
+	RetryStatus func(status int) bool
+
+	// RetryError reports whether a request that failed with the given error
+	// should be retried. If nil, all errors are retried except those
+	// from canceled contexts.
+	RetryError func(error) bool
+}
+
+// IsRetryableStatus reports whether a request that returned status
+// may succeed if retried: 429 Too Many Requests, and 500, 502, 503 and 504.
+func IsRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	maxAttempts := cmp.Or(t.MaxAttempts, 3)
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxAttempts = 1
+	}
+	backoff := cmp.Or(t.MinBackoff, 100*time.Millisecond)
+	maxBackoff := cmp.Or(t.MaxBackoff, 10*time.Second)
+	retryStatus := t.RetryStatus
+	if retryStatus == nil {
+		retryStatus = IsRetryableStatus
+	}
+	retryError := t.RetryError
+	if retryError == nil {
+		retryError = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+
+	r := req
+	for attempt := 1; ; attempt++ {
+		resp, err := base.RoundTrip(r)
+		if attempt == maxAttempts {
+			return resp, err
+		}
+		var wait time.Duration
+		if err != nil {
+			if !retryError(err) {
+				return nil, err
+			}
+		} else {
+			if !retryStatus(resp.StatusCode) {
+				return resp, nil
+			}
+			if ra, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if ra > cmp.Or(t.MaxRetryAfter, time.Minute) {
+					return resp, nil
+				}
+				wait = ra
+			}
+			// Drain the body so the connection can be reused.
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+		if wait == 0 {
+			wait = backoff/2 + rand.N(backoff/2+1)
+		}
+		backoff = min(2*backoff, maxBackoff)
+		if err := Sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+	}
+}
+
+// RetryAfter returns the wait requested by the Retry-After header of the
+// HTTPError in err's chain. The second result is false if there is no such
+// error or header.
+func RetryAfter(err error) (time.Duration, bool) {
+	var he *HTTPError
+	if !errors.As(err, &he) {
+		return 0, false
+	}
+	return parseRetryAfter(he.Header.Get("Retry-After"), time.Now())
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either
+// a number of seconds or an HTTP date. It returns the duration to wait, relative
+// to now.
+func parseRetryAfter(s string, now time.Time) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// Sleep waits for d, or until ctx is done, in which case it returns
+// ctx.Err().
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,77 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrTooLarge is returned when a response body exceeds the size set with
+// [WithMaxSize].
+var ErrTooLarge = errors.New("response body too large")
+
+// WithMaxSize limits the size of the response body to n bytes.
+// Larger bodies result in an error wrapping [ErrTooLarge].
+func WithMaxSize(n int64) Option {
+	return func(o *options) { o.maxSize = n }
+}
+
+// DoStream executes an HTTP request and copies the response body to w,
+// returning the number of bytes copied.
+// If onProgress is non-nil, it is called after each chunk is written
+// with the number of bytes in the chunk.
+// DoStream returns an HTTPError for non-2xx status codes, without writing to w.
+// The body is decoded and checked as described in [ReadBody]; a truncated
+// body is reported even if some of it was written.
+func DoStream(req *http.Request, w io.Writer, onProgress func(bytes int64), opts ...Option) (n int64, err error) {
+	o := buildOptions(opts)
+	if o.timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), o.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody+1))
+		return 0, newHTTPError(resp, body)
+	}
+	if err := checkContentLength(resp, o.maxSize); err != nil {
+		return 0, err
+	}
+	r, err := bodyReader(resp)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		nr, rerr := r.Read(buf)
+		if nr > 0 {
+			if o.maxSize > 0 && n+int64(nr) > o.maxSize {
+				return n, fmt.Errorf("%s: more than %d bytes: %w", req.URL.Redacted(), o.maxSize, ErrTooLarge)
+			}
+			nw, werr := w.Write(buf[:nr])
+			n += int64(nw)
+			if onProgress != nil && nw > 0 {
+				onProgress(int64(nw))
+			}
+			if werr != nil {
+				return n, werr
+			}
+			if nw != nr {
+				return n, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package jiter
+
+import (
+	"fmt"
+	"iter"
+	"sync"
+)
+
+// The functions in this file transform iterators that follow the convention
+// of returning an iter.Seq and a function that reports the error, if any,
+// that stopped the iteration. Each takes such a pair and returns a new one.
+// The returned error function reports the error of the input first.
+// A nil error function means the input cannot fail.
+
+// Map returns an iterator over the results of calling f on each element of seq.
+// Iteration stops at the first error returned by f.
+func Map[T, U any](seq iter.Seq[T], errf func() error, f func(T) (U, error)) (iter.Seq[U], func() error) {
+	var es ErrorState
+	return func(yield func(U) bool) {
+			defer es.Done()
+			for x := range seq {
+				y, err := f(x)
+				if err != nil {
+					es.Set(err)
+					return
+				}
+				if !yield(y) {
+					return
+				}
+			}
+		},
+		chain(errf, &es)
+}
+
+// Filter returns an iterator over the elements of seq for which keep returns true.
+func Filter[T any](seq iter.Seq[T], errf func() error, keep func(T) bool) (iter.Seq[T], func() error) {
+	return func(yield func(T) bool) {
+			for x := range seq {
+				if keep(x) && !yield(x) {
+					return
+				}
+			}
+		},
+		chain(errf, nil)
+}
+
+// Chunk returns an iterator over consecutive slices of up to n elements of seq.
+// All but the last slice have exactly n elements.
+// Each slice is newly allocated.
+// Chunk panics if n is not positive.
+func Chunk[T any](seq iter.Seq[T], errf func() error, n int) (iter.Seq[[]T], func() error) {
+	if n <= 0 {
+		panic(fmt.Sprintf("jiter.Chunk: n = %d", n))
+	}
+	return func(yield func([]T) bool) {
+			var chunk []T
+			for x := range seq {
+				chunk = append(chunk, x)
+				if len(chunk) == n {
+					if !yield(chunk) {
+						return
+					}
+					chunk = nil
+				}
+			}
+			if len(chunk) > 0 {
+				yield(chunk)
+			}
+		},
+		chain(errf, nil)
+}
+
+// Limit returns an iterator over at most the first n elements of seq.
+func Limit[T any](seq iter.Seq[T], errf func() error, n int) (iter.Seq[T], func() error) {
+	return func(yield func(T) bool) {
+			if n <= 0 {
+				return
+			}
+			i := 0
+			for x := range seq {
+				if !yield(x) {
+					return
+				}
+				i++
+				if i >= n {
+					return
+				}
+			}
+		},
+		chain(errf, nil)
+}
+
+// Merge returns an iterator over the elements of all the seqs, which are
+// iterated concurrently. The order of the elements is unspecified.
+// errfs[i] is the error function for seqs[i]; it may be nil.
+// The error function of the result reports the first non-nil error of errfs.
+// Merge panics if seqs and errfs have different lengths.
+func Merge[T any](seqs []iter.Seq[T], errfs []func() error) (iter.Seq[T], func() error) {
+	if len(seqs) != len(errfs) {
+		panic("jiter.Merge: len(seqs) != len(errfs)")
+	}
+	return func(yield func(T) bool) {
+			var (
+				wg   sync.WaitGroup
+				c    = make(chan T)
+				stop = make(chan struct{})
+			)
+			for _, seq := range seqs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for x := range seq {
+						select {
+						case c <- x:
+						case <-stop:
+							return
+						}
+					}
+				}()
+			}
+			go func() {
+				wg.Wait()
+				close(c)
+			}()
+			defer func() {
+				close(stop)
+				// Let the goroutines finish.
+				for range c {
+				}
+			}()
+			for x := range c {
+				if !yield(x) {
+					return
+				}
+			}
+		},
+		func() error {
+			for _, errf := range errfs {
+				if errf != nil {
+					if err := errf(); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+}
+
+// chain returns an error function that returns the error of errf if there is one,
+// and otherwise the error of es. Either may be nil.
+func chain(errf func() error, es *ErrorState) func() error {
+	return func() error {
+		if errf != nil {
+			if err := errf(); err != nil {
+				return err
+			}
+		}
+		if es != nil {
+			return es.Func()()
+		}
+		return nil
+	}
+}
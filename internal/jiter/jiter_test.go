@@ -0,0 +1,240 @@
+package jiter
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ints returns an iterator over 0, ..., n-1 that fails with err after
+// yielding them, if err is non-nil.
+func ints(n int, err error) (iter.Seq[int], func() error) {
+	var es ErrorState
+	return func(yield func(int) bool) {
+		defer es.Done()
+		for i := range n {
+			if !yield(i) {
+				return
+			}
+		}
+		if err != nil {
+			es.Set(err)
+		}
+	}, es.Func()
+}
+
+func TestCombinators(t *testing.T) {
+	seq, errf := ints(10, nil)
+	evens, errf := Filter(seq, errf, func(i int) bool { return i%2 == 0 })
+	strs, errf := Map(evens, errf, func(i int) (string, error) { return strconv.Itoa(i), nil })
+	chunks, errf := Chunk(strs, errf, 2)
+	limited, errf := Limit(chunks, errf, 2)
+	var got [][]string
+	for c := range limited {
+		got = append(got, c)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"0", "2"}, {"4", "6"}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The input's error is propagated.
+	errIn := errors.New("in")
+	seq, errf = ints(3, errIn)
+	seq, errf = Map(seq, errf, func(i int) (int, error) { return i, nil })
+	for range seq {
+	}
+	if err := errf(); err != errIn {
+		t.Errorf("got %v, want %v", err, errIn)
+	}
+
+	// Map's own error stops iteration.
+	errMap := errors.New("map")
+	seq, errf = ints(5, nil)
+	seq, errf = Map(seq, errf, func(i int) (int, error) {
+		if i == 2 {
+			return 0, errMap
+		}
+		return i, nil
+	})
+	if got := slices.Collect(seq); len(got) != 2 {
+		t.Errorf("got %v, want two elements", got)
+	}
+	if err := errf(); err != errMap {
+		t.Errorf("got %v, want %v", err, errMap)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	s1, e1 := ints(100, nil)
+	s2, e2 := ints(50, nil)
+	seq, errf := Merge([]iter.Seq[int]{s1, s2}, []func() error{e1, e2})
+	got := slices.Sorted(seq)
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 150 || got[0] != 0 || got[149] != 99 {
+		t.Errorf("got %d elements from %d to %d", len(got), got[0], got[len(got)-1])
+	}
+
+	// Stopping early doesn't leak or block.
+	errIn := errors.New("in")
+	s2, e2 = ints(1000, errIn)
+	seq, errf = Merge([]iter.Seq[int]{s1, s2}, []func() error{e1, e2})
+	lim, _ := Limit(seq, nil, 3)
+	for range lim {
+	}
+	if err := errf(); err != nil {
+		t.Errorf("got %v, want nil because iteration stopped", err)
+	}
+	seq, errf = Merge([]iter.Seq[int]{s2}, []func() error{e2})
+	for range seq {
+	}
+	if err := errf(); err != errIn {
+		t.Errorf("got %v, want %v", err, errIn)
+	}
+}
+
+func TestParallelMap(t *testing.T) {
+	errOdd := errors.New("odd")
+	double := func(i int) (int, error) {
+		if i%2 == 1 {
+			return 0, errOdd
+		}
+		return 2 * i, nil
+	}
+	for _, ordered := range []bool{false, true} {
+		pm := ParallelMap[int, int]
+		if ordered {
+			pm = OrderedParallelMap[int, int]
+		}
+		seq, _ := ints(100, nil)
+		var ins []int
+		for r := range pm(seq, 4, double) {
+			ins = append(ins, r.In)
+			if r.In%2 == 1 {
+				if r.Err != errOdd {
+					t.Errorf("%d: got err %v, want %v", r.In, r.Err, errOdd)
+				}
+			} else if r.Err != nil || r.Out != 2*r.In {
+				t.Errorf("%d: got (%d, %v)", r.In, r.Out, r.Err)
+			}
+		}
+		if ordered && !slices.IsSorted(ins) {
+			t.Errorf("ordered: results out of order: %v", ins)
+		}
+		slices.Sort(ins)
+		if len(ins) != 100 || ins[0] != 0 || ins[99] != 99 {
+			t.Errorf("ordered=%t: got %d results", ordered, len(ins))
+		}
+
+		// Stop early.
+		seq, _ = ints(100, nil)
+		n := 0
+		for range pm(seq, 4, double) {
+			n++
+			if n == 3 {
+				break
+			}
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errTemp := errors.New("temporary")
+	// makeSeq returns an iterator over start, ..., 9 that fails after
+	// two elements, unless failures is zero.
+	failures := 0
+	makeSeq := func(start int) (iter.Seq[int], func() error) {
+		var es ErrorState
+		return func(yield func(int) bool) {
+			for i := start; i < 10; i++ {
+				if i >= start+2 && failures > 0 {
+					failures--
+					es.Set(errTemp)
+					return
+				}
+				if !yield(i) {
+					return
+				}
+			}
+		}, es.Func()
+	}
+	next := func(i int) int { return i + 1 }
+	p := RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}
+
+	failures = 3
+	seq, errf := Retry(context.Background(), 0, makeSeq, next, p)
+	got := slices.Collect(seq)
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Not retryable.
+	failures = 1
+	p.Retryable = func(error) bool { return false }
+	seq, errf = Retry(context.Background(), 0, makeSeq, next, p)
+	got = slices.Collect(seq)
+	if err := errf(); err != errTemp || len(got) != 2 {
+		t.Errorf("got %v, %v; want two elements and %v", got, err, errTemp)
+	}
+}
+
+func TestTee(t *testing.T) {
+	errIn := errors.New("in")
+	seq, errf := ints(100, errIn)
+	var sum, count int
+	var first []int
+	err := Tee(seq, errf,
+		func(s iter.Seq[int]) error {
+			for x := range s {
+				sum += x
+			}
+			return nil
+		},
+		func(s iter.Seq[int]) error {
+			for range s {
+				count++
+			}
+			return nil
+		},
+		func(s iter.Seq[int]) error {
+			lim, _ := Limit(s, nil, 3)
+			first = slices.Collect(lim)
+			return nil
+		})
+	if !errors.Is(err, errIn) {
+		t.Errorf("got %v, want %v", err, errIn)
+	}
+	if sum != 4950 || count != 100 || !slices.Equal(first, []int{0, 1, 2}) {
+		t.Errorf("got sum=%d, count=%d, first=%v", sum, count, first)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	seq, errf := ints(100, nil)
+	seq, errf = Buffer(seq, errf, 10)
+	if got := slices.Collect(seq); len(got) != 100 || !slices.IsSorted(got) {
+		t.Errorf("got %v", got)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range seq {
+		n++
+		if n == 5 {
+			break
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package jiter
+
+import (
+	"fmt"
+	"iter"
+	"sync"
+)
+
+// A MapResult is the result of applying a function to an element of an iterator.
+type MapResult[T, U any] struct {
+	In  T     // the element
+	Out U     // the function's result
+	Err error // the function's error
+}
+
+// ParallelMap returns an iterator over the results of calling f on each element
+// of seq, using at most n goroutines. The results are yielded as they complete.
+// Errors from f are reported in the results and do not stop the iteration.
+//
+// If the caller stops iterating, ParallelMap stops reading seq and waits
+// for the calls to f in progress to finish.
+// ParallelMap panics if n is not positive.
+func ParallelMap[T, U any](seq iter.Seq[T], n int, f func(T) (U, error)) iter.Seq[MapResult[T, U]] {
+	return parallelMap(seq, n, false, f)
+}
+
+// OrderedParallelMap is like [ParallelMap], but yields the results in the
+// order of seq. A slow call delays the yielding of later results, but
+// no more than n results are ever pending.
+func OrderedParallelMap[T, U any](seq iter.Seq[T], n int, f func(T) (U, error)) iter.Seq[MapResult[T, U]] {
+	return parallelMap(seq, n, true, f)
+}
+
+func parallelMap[T, U any](seq iter.Seq[T], n int, ordered bool, f func(T) (U, error)) iter.Seq[MapResult[T, U]] {
+	if n <= 0 {
+		panic(fmt.Sprintf("jiter.ParallelMap: n = %d", n))
+	}
+	type indexed struct {
+		i int
+		r MapResult[T, U]
+	}
+	return func(yield func(MapResult[T, U]) bool) {
+		var (
+			// A token is held from the start of a call to f until its result
+			// is yielded, bounding both goroutines and pending results.
+			sem     = make(chan struct{}, n)
+			results = make(chan indexed)
+			done    = make(chan struct{})
+			wg      sync.WaitGroup
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i := 0
+			for x := range seq {
+				select {
+				case sem <- struct{}{}:
+				case <-done:
+					return
+				}
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					y, err := f(x)
+					select {
+					case results <- indexed{i, MapResult[T, U]{x, y, err}}:
+					case <-done:
+					}
+				}(i)
+				i++
+			}
+		}()
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		defer func() {
+			close(done)
+			wg.Wait()
+		}()
+
+		pending := map[int]MapResult[T, U]{} // for ordered results
+		next := 0
+		for ir := range results {
+			if !ordered {
+				if !yield(ir.r) {
+					return
+				}
+				<-sem
+				continue
+			}
+			pending[ir.i] = ir.r
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				if !yield(r) {
+					return
+				}
+				<-sem
+			}
+		}
+	}
+}
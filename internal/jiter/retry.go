@@ -0,0 +1,88 @@
+package jiter
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"time"
+)
+
+// A RetryPolicy controls how [Retry] restarts a failed iterator.
+// The zero value is a reasonable default.
+type RetryPolicy struct {
+	// MaxRetries is the number of consecutive restarts that may fail
+	// without yielding an element before Retry gives up. Zero means 3.
+	MaxRetries int
+	// Backoff is the delay before the first restart. It doubles with each
+	// consecutive failure. Zero means one second.
+	Backoff time.Duration
+	// MaxBackoff bounds the delay. Zero means one minute.
+	MaxBackoff time.Duration
+	// Retryable reports whether an error should cause a restart.
+	// If nil, all errors except context cancellation are retried.
+	Retryable func(error) bool
+}
+
+// Retry returns an iterator over the elements of the iterator returned by
+// makeSeq(start). If that iterator fails with a retryable error, Retry waits,
+// then continues with the iterator returned by makeSeq(resume(x)), where x is the
+// last element yielded. (If no element has been yielded, start is used.)
+// So that no elements are lost, resume(x) should select the elements after x,
+// or starting at x; in the latter case, the consumer sees some elements twice.
+func Retry[T, R any](ctx context.Context, start R, makeSeq func(R) (iter.Seq[T], func() error), resume func(T) R, p RetryPolicy) (iter.Seq[T], func() error) {
+	maxRetries := p.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = 3
+	}
+	backoff := p.Backoff
+	if backoff == 0 {
+		backoff = time.Second
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = time.Minute
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+
+	var es ErrorState
+	return func(yield func(T) bool) {
+		defer es.Done()
+		token := start
+		failures := 0
+		for {
+			seq, errf := makeSeq(token)
+			progressed := false
+			for x := range seq {
+				if !yield(x) {
+					return
+				}
+				token = resume(x)
+				progressed = true
+			}
+			err := errf()
+			if err == nil {
+				return
+			}
+			if progressed {
+				failures = 0
+			}
+			failures++
+			if failures > maxRetries || !retryable(err) {
+				es.Set(err)
+				return
+			}
+			d := min(backoff<<(failures-1), maxBackoff)
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				es.Set(errors.Join(err, ctx.Err()))
+				return
+			}
+		}
+	}, es.Func()
+}
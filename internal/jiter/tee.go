@@ -0,0 +1,112 @@
+package jiter
+
+import (
+	"errors"
+	"iter"
+	"sync"
+)
+
+// Tee reads seq once and passes each element to every consumer.
+// Each consumer runs in its own goroutine and is given an iterator
+// over the elements. A consumer that stops iterating early does not affect
+// the others; Tee stops reading seq when all the consumers have stopped.
+// Consumers proceed in lockstep, so a slow one slows the rest;
+// use [Buffer] within a consumer to loosen the coupling.
+//
+// Tee returns when all consumers have returned. It returns the
+// error of errf (which may be nil) joined with the errors of the consumers.
+func Tee[T any](seq iter.Seq[T], errf func() error, consumers ...func(iter.Seq[T]) error) error {
+	type sink struct {
+		c       chan T
+		stopped chan struct{} // closed when the consumer stops iterating
+		once    sync.Once
+		err     error
+	}
+	sinks := make([]*sink, len(consumers))
+	var wg sync.WaitGroup
+	for i, consume := range consumers {
+		s := &sink{c: make(chan T), stopped: make(chan struct{})}
+		sinks[i] = s
+		stop := func() { s.once.Do(func() { close(s.stopped) }) }
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer stop()
+			s.err = consume(func(yield func(T) bool) {
+				defer stop()
+				for x := range s.c {
+					if !yield(x) {
+						return
+					}
+				}
+			})
+		}()
+	}
+
+	live := len(sinks)
+	for x := range seq {
+		for _, s := range sinks {
+			if s.c == nil {
+				continue
+			}
+			select {
+			case s.c <- x:
+			case <-s.stopped:
+				close(s.c)
+				s.c = nil
+				live--
+			}
+		}
+		if live == 0 {
+			break
+		}
+	}
+	for _, s := range sinks {
+		if s.c != nil {
+			close(s.c)
+		}
+	}
+	wg.Wait()
+
+	var errs []error
+	if errf != nil {
+		errs = append(errs, errf())
+	}
+	for _, s := range sinks {
+		errs = append(errs, s.err)
+	}
+	return errors.Join(errs...)
+}
+
+// Buffer returns an iterator over the elements of seq that reads ahead by
+// up to n elements in a separate goroutine, so that the producer and the
+// consumer can proceed at different rates.
+// If the caller stops iterating, Buffer stops reading seq.
+func Buffer[T any](seq iter.Seq[T], errf func() error, n int) (iter.Seq[T], func() error) {
+	return func(yield func(T) bool) {
+			c := make(chan T, n)
+			done := make(chan struct{})
+			finished := make(chan struct{})
+			go func() {
+				defer close(finished)
+				defer close(c)
+				for x := range seq {
+					select {
+					case c <- x:
+					case <-done:
+						return
+					}
+				}
+			}()
+			defer func() {
+				close(done)
+				<-finished
+			}()
+			for x := range c {
+				if !yield(x) {
+					return
+				}
+			}
+		},
+		chain(errf, nil)
+}
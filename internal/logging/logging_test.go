@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	if FromContext(ctx) != slog.Default() {
+		t.Error("want default logger")
+	}
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	FromContext(NewContext(ctx, l)).Debug("hello", "k", 1)
+	if got := buf.String(); !strings.Contains(got, "msg=hello k=1") {
+		t.Errorf("got %q", got)
+	}
+}
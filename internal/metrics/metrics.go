@@ -0,0 +1,67 @@
+// Package metrics writes metrics in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Types of metrics.
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// A Sample is one value of a metric.
+type Sample struct {
+	Labels []string // alternating names and values
+	Value  float64
+}
+
+// A Writer writes metrics. After a write fails, later writes do nothing,
+// and Err returns the error.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes a metric with the given name, type, help text and samples.
+func (w *Writer) Write(name, typ, help string, samples ...Sample) {
+	if w.err != nil {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	for _, s := range samples {
+		b.WriteString(name)
+		if len(s.Labels) > 0 {
+			b.WriteByte('{')
+			for i := 0; i+1 < len(s.Labels); i += 2 {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(&b, "%s=%s", s.Labels[i], strconv.Quote(s.Labels[i+1]))
+			}
+			b.WriteByte('}')
+		}
+		fmt.Fprintf(&b, " %s\n", strconv.FormatFloat(s.Value, 'g', -1, 64))
+	}
+	_, w.err = io.WriteString(w.w, b.String())
+}
+
+// Value writes a metric with a single unlabeled sample.
+func (w *Writer) Value(name, typ, help string, v float64) {
+	w.Write(name, typ, help, Sample{Value: v})
+}
+
+// Err returns the first error from writing.
+func (w *Writer) Err() error {
+	return w.err
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b)
+	w.Value("calls_total", Counter, "Calls.", 3)
+	w.Write("jobs", Gauge, "Jobs.",
+		Sample{Labels: []string{"kind", "a", "state", "pending"}, Value: 2},
+		Sample{Labels: []string{"kind", `"b"`, "state", "done"}, Value: 0.5})
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP calls_total Calls.
+# TYPE calls_total counter
+calls_total 3
+# HELP jobs Jobs.
+# TYPE jobs gauge
+jobs{kind="a",state="pending"} 2
+jobs{kind="\"b\"",state="done"} 0.5
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
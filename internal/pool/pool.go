@@ -0,0 +1,211 @@
+// Package pool runs a function over many items with bounded concurrency,
+// a policy for per-item errors, progress tracking, and rate limiting.
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/progress"
+	"golang.org/x/time/rate"
+)
+
+// An ErrorPolicy says what a [Pool] does when processing an item fails.
+type ErrorPolicy int
+
+const (
+	// FailFast stops processing at the first error, and returns it.
+	FailFast ErrorPolicy = iota
+	// Collect records errors in the pool's [errs.Collector] and continues.
+	Collect
+)
+
+// A Pool processes items concurrently. A Pool should not be copied after
+// first use. Its fields should not be changed during a call to Run.
+type Pool[T any] struct {
+	// Concurrency is the maximum number of items processed at once.
+	// Zero means 1.
+	Concurrency int
+
+	// Policy controls what happens when an item fails after any retries.
+	Policy ErrorPolicy
+
+	// MaxErrors, if positive, bounds the number of errors collected under
+	// the Collect policy. Run fails when it is exceeded.
+	MaxErrors int
+
+	// Retries is the number of times to retry an item whose error is retryable.
+	Retries int
+
+	// Retryable reports whether an error is retryable.
+	// If nil, errors of kind [errs.Temporary] are retryable.
+	Retryable func(error) bool
+
+	// Backoff is the delay before the first retry of an item. It doubles
+	// for each subsequent retry. Zero means one second.
+	Backoff time.Duration
+
+	// Limiter, if non-nil, limits the rate at which items are started,
+	// including retries.
+	Limiter *rate.Limiter
+
+	// Progress, if non-nil, is credited with one unit per item
+	// when the item is finished, successfully or not.
+	Progress *progress.Tracker
+
+	// Key returns the key of an item in the collected errors.
+	// If nil, [fmt.Sprint] is used.
+	Key func(T) string
+
+	errc errs.Collector
+
+	mu          sync.Mutex
+	pausedUntil time.Time // set from Retry-After; see pause
+}
+
+// Fatal returns an error that makes [Pool.Run] stop and return err,
+// whatever the pool's policy. Use it for errors that are not about
+// the item, like a failed database write. Fatal errors are not retried.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fatalError{err}
+}
+
+type fatalError struct{ err error }
+
+func (e *fatalError) Error() string { return e.err.Error() }
+func (e *fatalError) Unwrap() error { return e.err }
+
+// Errors returns the errors collected under the Collect policy.
+func (p *Pool[T]) Errors() *errs.Collector {
+	return &p.errc
+}
+
+// Run calls f on each item, using up to p.Concurrency goroutines.
+// It returns when all calls have finished.
+// Under the FailFast policy, Run returns the first error and cancels the
+// context passed to the other calls. Under the Collect policy, Run returns
+// an error only if ctx is done, there are too many errors, or f returns
+// an error from [Fatal].
+//
+// If an error returned by f includes an HTTP Retry-After header (see
+// [httputil.RetryAfter]), no item is started until the time has passed.
+func (p *Pool[T]) Run(ctx context.Context, items iter.Seq[T], f func(context.Context, T) error) error {
+	p.errc.Limit = p.MaxErrors
+	n := max(p.Concurrency, 1)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, n)
+loop:
+	for item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := p.process(ctx, item, f)
+			if p.Progress != nil {
+				p.Progress.Did(1)
+			}
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			if fe, ok := err.(*fatalError); ok {
+				cancel(fe.err)
+				return
+			}
+			if p.Policy == Collect {
+				err = p.errc.Add(p.key(item), err)
+			}
+			if err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// process calls f on item, retrying as needed.
+func (p *Pool[T]) process(ctx context.Context, item T, f func(context.Context, T) error) error {
+	backoff := p.Backoff
+	if backoff == 0 {
+		backoff = time.Second
+	}
+	for try := 0; ; try++ {
+		if err := p.wait(ctx); err != nil {
+			return err
+		}
+		err := f(ctx, item)
+		if err == nil {
+			return nil
+		}
+		if d, ok := httputil.RetryAfter(err); ok {
+			p.pause(d)
+		}
+		if try >= p.Retries || !p.retryable(err) {
+			return err
+		}
+		// Sleep for a random duration in [backoff/2, backoff).
+		d := backoff/2 + rand.N(backoff/2+1)
+		if err := httputil.Sleep(ctx, d); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (p *Pool[T]) retryable(err error) bool {
+	if _, ok := err.(*fatalError); ok {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return errors.Is(err, errs.Temporary)
+}
+
+func (p *Pool[T]) key(item T) string {
+	if p.Key != nil {
+		return p.Key(item)
+	}
+	return fmt.Sprint(item)
+}
+
+// pause stops items from starting for d.
+func (p *Pool[T]) pause(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t := time.Now().Add(d); t.After(p.pausedUntil) {
+		p.pausedUntil = t
+	}
+}
+
+// wait waits until an item may start.
+func (p *Pool[T]) wait(ctx context.Context) error {
+	p.mu.Lock()
+	until := p.pausedUntil
+	p.mu.Unlock()
+	if err := httputil.Sleep(ctx, time.Until(until)); err != nil {
+		return err
+	}
+	if p.Limiter != nil {
+		return p.Limiter.Wait(ctx)
+	}
+	return nil
+}
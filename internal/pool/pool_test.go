@@ -0,0 +1,113 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/progress"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	items := slices.Values([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	errBad := errors.New("bad")
+
+	t.Run("collect", func(t *testing.T) {
+		tr := progress.Start(10, time.Hour, func(progress.Info) {})
+		defer tr.Stop()
+		var running, maxRunning atomic.Int32
+		p := &Pool[int]{Concurrency: 3, Policy: Collect, Progress: tr}
+		err := p.Run(ctx, items, func(ctx context.Context, i int) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			if i%3 == 0 {
+				return errBad
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Errors().Len(); got != 3 {
+			t.Errorf("got %d errors, want 3", got)
+		}
+		if got := maxRunning.Load(); got > 3 {
+			t.Errorf("%d running at once, want at most 3", got)
+		}
+		if got := tr.Current().Done; got != 10 {
+			t.Errorf("progress: got %d, want 10", got)
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		p := &Pool[int]{Concurrency: 2}
+		err := p.Run(ctx, items, func(ctx context.Context, i int) error {
+			if i == 2 {
+				return errBad
+			}
+			return nil
+		})
+		if err != errBad {
+			t.Errorf("got %v, want %v", err, errBad)
+		}
+	})
+
+	t.Run("fatal", func(t *testing.T) {
+		p := &Pool[int]{Policy: Collect, Retries: 2, Backoff: time.Millisecond}
+		var calls atomic.Int32
+		err := p.Run(ctx, items, func(ctx context.Context, i int) error {
+			calls.Add(1)
+			if i == 2 {
+				return Fatal(errs.Temporary)
+			}
+			return errBad
+		})
+		if err != errs.Temporary {
+			t.Errorf("got %v, want %v", err, errs.Temporary)
+		}
+		if got := calls.Load(); got != 2 {
+			t.Errorf("got %d calls, want 2 (no retries, and no items after the fatal one)", got)
+		}
+	})
+
+	t.Run("max errors", func(t *testing.T) {
+		p := &Pool[int]{Policy: Collect, MaxErrors: 2}
+		err := p.Run(ctx, items, func(context.Context, int) error { return errBad })
+		if !errors.Is(err, errs.ErrTooManyErrors) {
+			t.Errorf("got %v, want ErrTooManyErrors", err)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		tries := map[int]int{}
+		p := &Pool[int]{Retries: 2, Backoff: time.Millisecond}
+		err := p.Run(ctx, slices.Values([]int{1}), func(ctx context.Context, i int) error {
+			tries[i]++
+			if tries[i] < 3 {
+				// A 429 with a short Retry-After.
+				return &httputil.HTTPError{Status: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"0"}}}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tries[1] != 3 {
+			t.Errorf("got %d tries, want 3", tries[1])
+		}
+	})
+}
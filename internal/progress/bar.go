@@ -0,0 +1,73 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// barWidth is the number of characters in the bar itself.
+const barWidth = 30
+
+// Bar returns a report function that draws a progress bar in place on
+// standard error, if standard error is a terminal. Otherwise it returns
+// Log(ctx, prefix).
+// It can be passed as the report function to [Start].
+func Bar(ctx context.Context, prefix string) func(Info) {
+	if !isTerminal(os.Stderr) {
+		return Log(ctx, prefix)
+	}
+	return func(i Info) {
+		drawBar(os.Stderr, prefix, i)
+		if i.Final {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// drawBar overwrites the current line of w with a bar for i.
+func drawBar(w io.Writer, prefix string, i Info) {
+	// \r returns to the start of the line; ESC [K clears to the end of it.
+	fmt.Fprintf(w, "\r%s\x1b[K", barLine(prefix, i))
+}
+
+// barLine returns a one-line rendering of i as a progress bar.
+func barLine(prefix string, i Info) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(": ")
+	if i.Stage != "" {
+		fmt.Fprintf(&b, "%s ", i.Stage)
+	}
+	if i.Final {
+		fmt.Fprintf(&b, "%d done in %s  %.1f/s", i.Done, i.Duration.Round(time.Second), i.Rate)
+		b.WriteString(i.bytesString())
+		return b.String()
+	}
+	if i.Total < 0 {
+		fmt.Fprintf(&b, "%d/?  %.1f/s", i.Done, i.Rate)
+		b.WriteString(i.bytesString())
+		return b.String()
+	}
+	pct := min(percent(i.Done, i.Total), 100)
+	filled := pct * barWidth / 100
+	b.WriteByte('[')
+	b.WriteString(strings.Repeat("=", filled))
+	if filled < barWidth {
+		b.WriteByte('>')
+		b.WriteString(strings.Repeat(" ", barWidth-filled-1))
+	}
+	fmt.Fprintf(&b, "] %3d%%  %d/%d  %.1f/s", pct, i.Done, i.Total, i.Rate)
+	b.WriteString(i.bytesString())
+	fmt.Fprintf(&b, "  ETA %s", i.ETA.Round(time.Second))
+	return b.String()
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
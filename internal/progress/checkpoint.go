@@ -0,0 +1,124 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/logging"
+)
+
+// A Checkpoint is the saved state of a [Tracker], so that an interrupted
+// activity can resume and report its cumulative progress.
+type Checkpoint struct {
+	Done   int       `json:"done"`
+	Total  int       `json:"total"`
+	Cursor string    `json:"cursor,omitempty"` // see [Tracker.SetCursor]
+	Time   time.Time `json:"time"`             // when the checkpoint was taken
+}
+
+// Complete reports whether the checkpoint records a finished activity.
+func (c Checkpoint) Complete() bool {
+	return c.Total >= 0 && c.Done >= c.Total
+}
+
+// A CheckpointStore saves and loads a checkpoint.
+type CheckpointStore interface {
+	// Load returns the saved checkpoint.
+	// If there is none, it returns the zero Checkpoint and a nil error.
+	Load() (Checkpoint, error)
+	Save(Checkpoint) error
+}
+
+// FileStore returns a CheckpointStore that keeps a checkpoint in
+// the named file, as JSON.
+func FileStore(filename string) CheckpointStore {
+	return fileStore(filename)
+}
+
+type fileStore string
+
+func (f fileStore) Load() (Checkpoint, error) {
+	var c Checkpoint
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+func (f fileStore) Save(c Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// Write atomically, so a crash doesn't leave a partial file.
+	tmp := string(f) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(f))
+}
+
+// SetCursor records a caller-defined position in the work, like the
+// timestamp of the last index entry processed. It is saved in checkpoints.
+func (t *Tracker) SetCursor(cursor string) {
+	if t != nil {
+		t.mu.Lock()
+		t.cursor = cursor
+		t.mu.Unlock()
+	}
+}
+
+// Checkpoint returns the current state of t.
+func (t *Tracker) Checkpoint() Checkpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Checkpoint{
+		Done:   int(t.done.Load()),
+		Total:  int(t.total.Load()),
+		Cursor: t.cursor,
+		Time:   time.Now(),
+	}
+}
+
+// Resume adds the work recorded in c to t, and sets t's cursor to c's.
+// Call it before doing any work. Rates reported by t reflect only work
+// done after Resume.
+func (t *Tracker) Resume(c Checkpoint) {
+	t.base.Add(int64(c.Done))
+	t.done.Add(int64(c.Done))
+	t.SetCursor(c.Cursor)
+}
+
+// Persist saves t's state to store at the given interval, and once more
+// when t is stopped. Errors are logged with the logger of ctx.
+func (t *Tracker) Persist(ctx context.Context, store CheckpointStore, interval time.Duration) {
+	save := func() {
+		if err := store.Save(t.Checkpoint()); err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "progress: saving checkpoint", "err", err)
+		}
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				save()
+			case <-t.stopc:
+				save()
+				return
+			}
+		}
+	}()
+}
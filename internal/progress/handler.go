@@ -0,0 +1,65 @@
+package progress
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handler returns an HTTP handler that serves the state of all live
+// trackers. It serves JSON if the request has the query parameter
+// "format=json" or accepts application/json, and HTML otherwise.
+func Handler() http.Handler {
+	return http.HandlerFunc(serveStatus)
+}
+
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	infos := Live()
+	if r.FormValue("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		js := make([]jsonInfo, len(infos))
+		for i, info := range infos {
+			js[i] = info.toJSON(now)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(js)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	statusTemplate.Execute(w, struct {
+		Time  time.Time
+		Infos []Info
+	}{now, infos})
+}
+
+var statusTemplate = template.Must(template.New("").Funcs(template.FuncMap{
+	"percent": percent,
+	"round":   func(d time.Duration) time.Duration { return d.Round(time.Second) },
+	"bytes":   func(i Info) string { return strings.TrimSpace(i.bytesString()) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>Progress</title><meta http-equiv="refresh" content="10"></head>
+<body>
+<p>As of {{.Time.Format "2006-01-02 15:04:05"}}</p>
+{{if .Infos}}
+<table border="1" cellpadding="4">
+<tr><th>Stage</th><th>Done</th><th>Total</th><th>%</th><th>Rate/s</th><th>Bytes</th><th>ETA</th></tr>
+{{range .Infos}}
+<tr>
+  <td>{{if .Stage}}{{.StageNum}}{{if .NumStages}}/{{.NumStages}}{{end}} {{.Stage}}{{end}}</td>
+  <td>{{.Done}}</td>
+  {{if lt .Total 0}}<td>?</td><td></td>{{else}}<td>{{.Total}}</td><td>{{percent .Done .Total}}</td>{{end}}
+  <td>{{printf "%.1f" .RateSmoothed}}</td>
+  <td>{{bytes .}}</td>
+  <td>{{if ge .Total 0}}{{round .ETA}}{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>Nothing in progress.</p>
+{{end}}
+</body>
+</html>
+`))
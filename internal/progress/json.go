@@ -0,0 +1,69 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/logging"
+)
+
+// jsonInfo is the JSON form of an Info.
+type jsonInfo struct {
+	Time       time.Time `json:"timestamp"`
+	Stage      string    `json:"stage,omitempty"`
+	StageNum   int       `json:"stage_num,omitempty"`
+	NumStages  int       `json:"num_stages,omitempty"`
+	Done       int       `json:"done"`
+	Total      int       `json:"total"` // negative if unknown
+	Rate       float64   `json:"rate"`
+	RateRecent float64   `json:"rate_recent"`
+	RateSmooth float64   `json:"rate_smoothed"`
+	ETA        float64   `json:"eta_seconds,omitempty"`
+	ETAAverage float64   `json:"eta_average_seconds,omitempty"`
+	Elapsed    float64   `json:"elapsed_seconds,omitempty"`
+	Duration   float64   `json:"duration_seconds"`
+	Final      bool      `json:"final,omitempty"`
+	BytesDone  int64     `json:"bytes_done,omitempty"`
+	BytesTotal int64     `json:"bytes_total,omitempty"`
+	ByteRate   float64   `json:"byte_rate,omitempty"`
+}
+
+func (i Info) toJSON(now time.Time) jsonInfo {
+	return jsonInfo{
+		Time:       now.UTC(),
+		Stage:      i.Stage,
+		StageNum:   i.StageNum,
+		NumStages:  i.NumStages,
+		Done:       i.Done,
+		Total:      i.Total,
+		Rate:       i.Rate,
+		RateRecent: i.RateRecent,
+		RateSmooth: i.RateSmoothed,
+		ETA:        i.ETA.Seconds(),
+		ETAAverage: i.ETAAverage.Seconds(),
+		Elapsed:    i.Elapsed.Seconds(),
+		Duration:   i.Duration.Seconds(),
+		Final:      i.Final,
+		BytesDone:  i.BytesDone,
+		BytesTotal: i.BytesTotal,
+		ByteRate:   i.ByteRate,
+	}
+}
+
+// JSON returns a report function that writes each [Info] to w
+// as a single line of JSON. Errors are logged with the logger of ctx.
+// It can be passed as the report function to [Start].
+func JSON(ctx context.Context, w io.Writer) func(Info) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(i Info) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(i.toJSON(time.Now())); err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "progress.JSON", "err", err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package progress
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+// live holds the trackers that have been started but not stopped.
+var live struct {
+	mu       sync.Mutex
+	trackers map[*Tracker]bool
+}
+
+func register(t *Tracker) {
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	if live.trackers == nil {
+		live.trackers = map[*Tracker]bool{}
+	}
+	live.trackers[t] = true
+}
+
+func unregister(t *Tracker) {
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	delete(live.trackers, t)
+}
+
+// Live returns the current state of all trackers that have been started but
+// not stopped, ordered by stage name.
+func Live() []Info {
+	live.mu.Lock()
+	ts := make([]*Tracker, 0, len(live.trackers))
+	for t := range live.trackers {
+		ts = append(ts, t)
+	}
+	live.mu.Unlock()
+
+	infos := make([]Info, len(ts))
+	for i, t := range ts {
+		infos[i] = t.Current()
+	}
+	slices.SortFunc(infos, func(a, b Info) int {
+		return cmp.Or(cmp.Compare(a.Stage, b.Stage), cmp.Compare(a.StageNum, b.StageNum))
+	})
+	return infos
+}
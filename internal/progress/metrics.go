@@ -0,0 +1,80 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WriteMetrics writes the state of all live trackers to w in the Prometheus
+// text exposition format, which OpenTelemetry collectors can also scrape.
+// Metrics are labeled by stage name; trackers that are not part of a
+// [Stages] have an empty stage label. The values for trackers with the
+// same stage name are summed.
+//
+// The metrics are:
+//
+//	work_done_total   units of work done (counter)
+//	work_total        units of work to do, if known (gauge)
+//	work_rate         smoothed rate of work, in units per second (gauge)
+//	work_bytes_total  bytes processed (counter)
+func WriteMetrics(w io.Writer) error {
+	type sums struct {
+		done, total int
+		rate        float64
+		bytes       int64
+		unknown     bool // some total is unknown
+	}
+	var stages []string
+	byStage := map[string]*sums{}
+	for _, i := range Live() {
+		s := byStage[i.Stage]
+		if s == nil {
+			s = &sums{}
+			byStage[i.Stage] = s
+			stages = append(stages, i.Stage)
+		}
+		s.done += i.Done
+		s.rate += i.RateSmoothed
+		s.bytes += i.BytesDone
+		if i.Total < 0 {
+			s.unknown = true
+		} else {
+			s.total += i.Total
+		}
+	}
+
+	var b strings.Builder
+	metric := func(name, typ, help string, value func(*sums) (string, bool)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, st := range stages {
+			if v, ok := value(byStage[st]); ok {
+				fmt.Fprintf(&b, "%s{stage=%s} %s\n", name, strconv.Quote(st), v)
+			}
+		}
+	}
+	metric("work_done_total", "counter", "Units of work done.", func(s *sums) (string, bool) {
+		return strconv.Itoa(s.done), true
+	})
+	metric("work_total", "gauge", "Units of work to do.", func(s *sums) (string, bool) {
+		return strconv.Itoa(s.total), !s.unknown
+	})
+	metric("work_rate", "gauge", "Rate of work, in units per second.", func(s *sums) (string, bool) {
+		return strconv.FormatFloat(s.rate, 'g', -1, 64), true
+	})
+	metric("work_bytes_total", "counter", "Bytes processed.", func(s *sums) (string, bool) {
+		return strconv.FormatInt(s.bytes, 10), true
+	})
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// MetricsHandler returns an HTTP handler that serves [WriteMetrics].
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteMetrics(w)
+	})
+}
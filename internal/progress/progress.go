@@ -3,98 +3,381 @@
 package progress
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"math"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/jba/go-ecosystem/internal/logging"
 )
 
 // Info holds information about the progress of some activity.
 type Info struct {
+	Stage      string        // the name of the stage, if the activity is part of a [Stages]
+	StageNum   int           // the 1-based number of the stage
+	NumStages  int           // the number of stages, or 0 if unknown
+	Elapsed    time.Duration // the time since the start of all stages
+	Duration   time.Duration // the time since tracking started
+	Final      bool          // this is the last report, made by [Tracker.Stop]
 	Total      int           // the total number of work units to do
 	Done       int           // how much of the total has been done
 	DoneRecent int           // how much has been done since the last call to report
 	Rate       float64       // the rate at which work is being done, in work units per second
 	RateRecent float64       // the rate over the last interval
-	ETA        time.Duration // the estimated time remaining to complete the work
+	// RateSmoothed is an exponentially weighted moving average of recent rates.
+	// It tracks changes in the rate more closely than Rate, but is less noisy
+	// than RateRecent.
+	RateSmoothed float64
+	ETA          time.Duration // the estimated time remaining to complete the work, using RateSmoothed
+	ETAAverage   time.Duration // the estimated time remaining, using Rate
+
+	// Bytes, if the tracker also measures work in bytes.
+	// See [Tracker.DidBytes].
+	BytesDone  int64   // bytes processed
+	BytesTotal int64   // total bytes to process, or 0 if unknown
+	ByteRate   float64 // smoothed rate, in bytes per second
 }
 
 func (i Info) String() string {
+	return i.itemString() + i.bytesString()
+}
+
+func (i Info) itemString() string {
+	prefix := i.stagePrefix()
+	if i.Final {
+		return fmt.Sprintf("%sfinished: %d done in %s, %.1f/s", prefix, i.Done, i.Duration.Round(time.Second), i.Rate)
+	}
 	if i.Total < 0 {
-		return fmt.Sprintf("%d/? %.1f/s  %.1f/s recent", i.Done, i.Rate, i.RateRecent)
+		return fmt.Sprintf("%s%d/? %.1f/s  %.1f/s recent", prefix, i.Done, i.Rate, i.RateRecent)
+	}
+	return fmt.Sprintf("%s%d/%d (%2d%%)  %.1f/s  %.1f/s recent  ETA %s",
+		prefix, i.Done, i.Total, percent(i.Done, i.Total), i.Rate, i.RateSmoothed, i.ETA)
+}
+
+func (i Info) stagePrefix() string {
+	var prefix string
+	if i.Stage != "" {
+		if i.NumStages > 0 {
+			prefix = fmt.Sprintf("[%d/%d %s, %s] ", i.StageNum, i.NumStages, i.Stage, i.Elapsed.Round(time.Second))
+		} else {
+			prefix = fmt.Sprintf("[%d %s, %s] ", i.StageNum, i.Stage, i.Elapsed.Round(time.Second))
+		}
+	}
+	return prefix
+}
+
+// bytesString describes the byte counts of i, if there are any.
+func (i Info) bytesString() string {
+	if i.BytesDone == 0 && i.BytesTotal == 0 {
+		return ""
+	}
+	total := "?"
+	if i.BytesTotal > 0 {
+		total = formatBytes(float64(i.BytesTotal))
+	}
+	return fmt.Sprintf("  %s/%s  %s/s", formatBytes(float64(i.BytesDone)), total, formatBytes(i.ByteRate))
+}
+
+// formatBytes formats n using SI units, like "12.3 MB".
+func formatBytes(n float64) string {
+	const units = "kMGTPE"
+	if n < 1000 {
+		return fmt.Sprintf("%d B", int(n))
+	}
+	i := -1
+	for n >= 1000 && i < len(units)-1 {
+		n /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.1f %cB", n, units[i])
+}
+
+func percent(done, total int) int {
+	if total == 0 {
+		return 100
 	}
-	return fmt.Sprintf("%d/%d (%2d%%)  %.1f/s  %.1f/s recent  ETA %s",
-		i.Done, i.Total, i.Done*100/i.Total, i.Rate, i.RateRecent, i.ETA)
+	return done * 100 / total
 }
 
 // A Tracker tracks progress.
 // The nil tracker does nothing.
 type Tracker struct {
+	total      atomic.Int64
+	start      time.Time
 	done       atomic.Int64
 	doneRecent atomic.Int64
-	stopped    bool
-	stopc      chan struct{}
+	base       atomic.Int64 // work done before start, from a checkpoint
+	stopOnce   sync.Once
+	stopc      chan struct{} // closed by Stop
+	flushc     chan struct{} // requests an immediate report
+
+	bytesDone   atomic.Int64
+	bytesRecent atomic.Int64
+	bytesTotal  atomic.Int64
+
+	mu     sync.Mutex
+	cursor string // see SetCursor
+
+	wg sync.WaitGroup // for goroutines that Stop waits for
+
+	// Accessed only by the reporting goroutine.
+	smoothed      float64 // EWMA of recent rates
+	smoothedBytes float64 // EWMA of recent byte rates
+	hasSmoothed   bool
+
+	last Info // most recent report; guarded by mu
+
+	// Set for trackers that are stages.
+	stages   *Stages
+	stage    string
+	stageNum int
+
+	// Set for sub-trackers; see Sub.
+	parent   *Tracker
+	share    int64        // units of parent's work that t represents
+	credited atomic.Int64 // units of share passed on to parent
 }
 
 // Did marks n units of work as done.
 func (t *Tracker) Did(n int) {
 	if t != nil {
-		t.done.Add(int64(n))
+		done := t.done.Add(int64(n))
 		t.doneRecent.Add(int64(n))
+		if t.parent != nil {
+			t.credit(false)
+		}
+		// Report as soon as the work is complete.
+		if total := t.total.Load(); t.flushc != nil && total >= 0 && done >= total && done-int64(n) < total {
+			select {
+			case t.flushc <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// SetTotal changes the total amount of work to do.
+// A negative total means the total is unknown.
+func (t *Tracker) SetTotal(total int) {
+	if t != nil {
+		t.total.Store(int64(total))
+		if t.parent != nil {
+			t.credit(false)
+		}
+	}
+}
+
+// Sub returns a tracker for a part of t's work that accounts for n of
+// t's units. The sub-tracker's total is initially n, but can be changed
+// with [Tracker.SetTotal]; work done on the sub-tracker is scaled and added
+// to t. Stopping the sub-tracker adds any remainder of the n units to t, so
+// t's progress is correct even if the sub-tracker's total was an
+// overestimate.
+//
+// A sub-tracker does not report progress.
+func (t *Tracker) Sub(n int) *Tracker {
+	if t == nil {
+		return nil
+	}
+	s := &Tracker{parent: t, share: int64(n)}
+	s.total.Store(int64(n))
+	return s
+}
+
+// credit passes on to the parent the part of t's share that corresponds
+// to the work t has done. If all is true, it passes on all of the share.
+func (t *Tracker) credit(all bool) {
+	want := t.share
+	if total := t.total.Load(); !all && total > 0 {
+		want = t.share * min(t.done.Load(), total) / total
+	} else if !all {
+		return
+	}
+	for {
+		c := t.credited.Load()
+		if want <= c {
+			return
+		}
+		if t.credited.CompareAndSwap(c, want) {
+			t.parent.Did(int(want - c))
+			return
+		}
+	}
+}
+
+// DidBytes marks n bytes as processed.
+// Trackers measure work in bytes in addition to the units passed to [Tracker.Did].
+func (t *Tracker) DidBytes(n int64) {
+	if t != nil {
+		t.bytesDone.Add(n)
+		t.bytesRecent.Add(n)
+	}
+}
+
+// SetTotalBytes sets the total number of bytes to process, if known.
+func (t *Tracker) SetTotalBytes(n int64) {
+	if t != nil {
+		t.bytesTotal.Store(n)
 	}
 }
 
 // Stop ends tracking. Call it to free resources allocated by [Start].
-// Stop can be called multiple times.
+// Stop makes a final report that summarizes all the work done, and returns
+// after the report is made. If [Tracker.Persist] was called, Stop also waits
+// for the final checkpoint to be saved.
+// Stop can be called multiple times, concurrently.
 func (t *Tracker) Stop() {
-	if t != nil && !t.stopped {
-		close(t.stopc)
-		t.stopped = true
+	if t == nil {
+		return
 	}
+	if t.parent != nil {
+		t.credit(true)
+		return
+	}
+	t.stopOnce.Do(func() {
+		close(t.stopc)
+		t.wg.Wait()
+		unregister(t)
+	})
 }
 
 // Start starts tracking progress.
 // Total is the total amount of work to do.
 // If total is negative, only the amount of work done is known, not information about completion.
 // The report function is called at the given interval with information about progress.
-// If nil, a default report function is used.
+// If nil, it is Log(context.Background(), "progress").
 func Start(total int, interval time.Duration, report func(Info)) *Tracker {
+	t := &Tracker{}
+	t.total.Store(int64(total))
+	t.run(interval, report)
+	return t
+}
+
+func (t *Tracker) run(interval time.Duration, report func(Info)) {
 	if report == nil {
-		report = Log("progress")
+		report = Log(context.Background(), "progress")
 	}
-	start := time.Now()
+	t.start = time.Now()
+	t.stopc = make(chan struct{})
+	t.flushc = make(chan struct{}, 1)
+	t.last = t.info(t.start)
+	register(t)
 	ticker := time.NewTicker(interval)
-	t := &Tracker{stopc: make(chan struct{})}
 
+	t.wg.Add(1)
 	go func() {
-		lastReport := start
+		defer t.wg.Done()
+		defer ticker.Stop()
+		lastReport := t.start
 		for {
 			select {
 			case <-ticker.C:
-				info := Info{Total: total}
-				info.Done = int(t.done.Load())
-				info.DoneRecent = int(t.doneRecent.Load())
-				info.Rate = float64(info.Done) / time.Since(start).Seconds()
-				info.RateRecent = float64(info.DoneRecent) / time.Since(lastReport).Seconds()
-				if total >= 0 {
-					info.ETA = time.Duration(float64(total-info.Done)/info.Rate) * time.Second
-				}
-				report(info)
-				lastReport = time.Now()
-				t.doneRecent.Store(0)
+			case <-t.flushc:
 			case <-t.stopc:
+				info := t.update(lastReport)
+				info.Final = true
+				report(info)
 				return
 			}
+			report(t.update(lastReport))
+			lastReport = time.Now()
+			t.doneRecent.Store(0)
+			t.bytesRecent.Store(0)
 		}
 	}()
+}
 
-	return t
+// info returns the current progress.
+// lastReport is the time of the previous report.
+func (t *Tracker) info(lastReport time.Time) Info {
+	total := int(t.total.Load())
+	info := Info{Total: total}
+	info.Done = int(t.done.Load())
+	info.DoneRecent = int(t.doneRecent.Load())
+	info.Rate = float64(info.Done-int(t.base.Load())) / time.Since(t.start).Seconds()
+	info.RateRecent = float64(info.DoneRecent) / time.Since(lastReport).Seconds()
+	info.BytesDone = t.bytesDone.Load()
+	info.BytesTotal = t.bytesTotal.Load()
+	info.Duration = time.Since(t.start)
+	if total >= 0 {
+		info.ETAAverage = eta(total-info.Done, info.Rate)
+	}
+	if t.stages != nil {
+		info.Stage = t.stage
+		info.StageNum = t.stageNum
+		info.NumStages = t.stages.n
+		info.Elapsed = time.Since(t.stages.start)
+	}
+	return info
+}
+
+// update returns the current progress, and updates the smoothed rate.
+// It is called at each reporting interval.
+func (t *Tracker) update(lastReport time.Time) Info {
+	info := t.info(lastReport)
+	dt := time.Since(lastReport)
+	byteRate := float64(t.bytesRecent.Load()) / dt.Seconds()
+	if t.hasSmoothed {
+		t.smoothed = smooth(t.smoothed, info.RateRecent, dt)
+		t.smoothedBytes = smooth(t.smoothedBytes, byteRate, dt)
+	} else {
+		t.smoothed = info.RateRecent
+		t.smoothedBytes = byteRate
+		t.hasSmoothed = true
+	}
+	info.RateSmoothed = t.smoothed
+	info.ByteRate = t.smoothedBytes
+	if info.Total >= 0 {
+		info.ETA = eta(info.Total-info.Done, info.RateSmoothed)
+		if info.ETA == 0 {
+			info.ETA = info.ETAAverage
+		}
+	}
+	t.mu.Lock()
+	t.last = info
+	t.mu.Unlock()
+	return info
+}
+
+// Current returns the progress information from the most recent report,
+// with the amount of work done brought up to date.
+func (t *Tracker) Current() Info {
+	t.mu.Lock()
+	info := t.last
+	t.mu.Unlock()
+	info.Done = int(t.done.Load())
+	info.BytesDone = t.bytesDone.Load()
+	info.BytesTotal = t.bytesTotal.Load()
+	return info
+}
+
+// smoothingWindow is the time constant of the exponentially weighted moving average
+// of rates. After this much time, an old rate has about a third of its original
+// weight.
+const smoothingWindow = time.Minute
+
+// smooth returns the moving average prev updated with a new value x, observed
+// over the duration dt.
+func smooth(prev, x float64, dt time.Duration) float64 {
+	alpha := 1 - math.Exp(-dt.Seconds()/smoothingWindow.Seconds())
+	return prev + alpha*(x-prev)
+}
+
+// eta estimates the time to do the remaining work at the given rate.
+// It returns 0 if the rate is not positive.
+func eta(remaining int, rate float64) time.Duration {
+	if rate <= 0 || remaining <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining)/rate) * time.Second
 }
 
-// Log uses the default [log.Logger] to print an [Info].
+// Log uses the logger of ctx to log an [Info] with the message prefix.
 // It can be passed as the report function to [Start].
-func Log(prefix string) func(Info) {
+func Log(ctx context.Context, prefix string) func(Info) {
 	return func(i Info) {
-		log.Printf("%s: %s", prefix, i)
+		logging.FromContext(ctx).InfoContext(ctx, prefix, "progress", i.String())
 	}
 }
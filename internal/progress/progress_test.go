@@ -0,0 +1,257 @@
+package progress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBarLine(t *testing.T) {
+	for _, test := range []struct {
+		info Info
+		want string
+	}{
+		{
+			Info{Total: 200, Done: 50, Rate: 12.5, ETA: 12 * time.Second},
+			"p: [=======>                      ]  25%  50/200  12.5/s  ETA 12s",
+		},
+		{
+			Info{Total: 10, Done: 10, Rate: 1},
+			"p: [==============================] 100%  10/10  1.0/s  ETA 0s",
+		},
+		{
+			Info{Stage: "index", Total: -1, Done: 7, Rate: 3.5},
+			"p: index 7/?  3.5/s",
+		},
+		{
+			Info{Total: -1, Done: 7, Rate: 3.5, BytesDone: 12_345_678, ByteRate: 2_500},
+			"p: 7/?  3.5/s  12.3 MB/?  2.5 kB/s",
+		},
+	} {
+		if got := barLine("p", test.info); got != test.want {
+			t.Errorf("%+v:\ngot  %q\nwant %q", test.info, got, test.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	report := JSON(context.Background(), &buf)
+	report(Info{Stage: "index", StageNum: 1, NumStages: 2, Total: -1, Done: 3, Rate: 1.5})
+	report(Info{Total: 10, Done: 5, Rate: 2, ETA: 3 * time.Second})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var got jsonInfo
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Done != 5 || got.Total != 10 || got.ETA != 3 || got.Time.IsZero() {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	store := FileStore(filepath.Join(t.TempDir(), "cp"))
+	c, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != (Checkpoint{}) {
+		t.Fatalf("got %+v, want zero", c)
+	}
+
+	tr := Start(10, time.Hour, func(Info) {})
+	tr.Did(3)
+	tr.SetCursor("2025-01-02T00:00:00Z")
+	tr.Persist(context.Background(), store, time.Hour)
+	tr.Stop()
+	c, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Done != 3 || c.Total != 10 || c.Cursor != "2025-01-02T00:00:00Z" || c.Complete() {
+		t.Fatalf("got %+v", c)
+	}
+
+	tr = Start(10, time.Hour, func(Info) {})
+	defer tr.Stop()
+	tr.Resume(c)
+	tr.Did(2)
+	if got := tr.Checkpoint(); got.Done != 5 || got.Cursor != c.Cursor {
+		t.Errorf("after Resume: got %+v", got)
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	// Starting fast and slowing down: the smoothed rate should approach the new rate.
+	r := 1000.0
+	for range 60 { // ten minutes of 10-second intervals
+		r = smooth(r, 10, 10*time.Second)
+	}
+	if math.Abs(r-10) > 1 {
+		t.Errorf("got %.2f, want about 10", r)
+	}
+	if got, want := eta(100, 10), 10*time.Second; got != want {
+		t.Errorf("eta: got %s, want %s", got, want)
+	}
+	if got := eta(100, 0); got != 0 {
+		t.Errorf("eta with zero rate: got %s, want 0", got)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	s := NewStages(2, time.Hour, func(Info) {})
+	defer s.Stop()
+	tr := s.NewStage("index", -1)
+	tr.Did(7)
+
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		`work_done_total{stage="index"} 7`,
+		`work_rate{stage="index"} 0`,
+		"# TYPE work_total gauge\n# HELP work_rate",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for _, test := range []struct {
+		n    float64
+		want string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1000, "1.0 kB"},
+		{1_234_567, "1.2 MB"},
+		{5e18, "5.0 EB"},
+	} {
+		if got := formatBytes(test.n); got != test.want {
+			t.Errorf("formatBytes(%g) = %q, want %q", test.n, got, test.want)
+		}
+	}
+}
+
+func TestSub(t *testing.T) {
+	parent := Start(100, time.Hour, func(Info) {})
+	defer parent.Stop()
+
+	// A sub-tracker with a different total scales its work.
+	s := parent.Sub(10)
+	s.SetTotal(4)
+	s.Did(1)
+	s.Did(1)
+	if got, want := parent.Current().Done, 5; got != want {
+		t.Errorf("after half: got %d, want %d", got, want)
+	}
+	// Stopping credits the remainder, even if the total wasn't reached.
+	s.Stop()
+	s.Stop()
+	if got, want := parent.Current().Done, 10; got != want {
+		t.Errorf("after stop: got %d, want %d", got, want)
+	}
+
+	// Nested sub-trackers.
+	s = parent.Sub(20)
+	ss := s.Sub(10)
+	ss.Did(10)
+	if got, want := parent.Current().Done, 20; got != want {
+		t.Errorf("nested: got %d, want %d", got, want)
+	}
+	// Doing more than the total doesn't overcount.
+	ss.Did(5)
+	s.Stop()
+	if got, want := parent.Current().Done, 30; got != want {
+		t.Errorf("after nested stop: got %d, want %d", got, want)
+	}
+
+	var nilTracker *Tracker
+	nilTracker.Sub(3).Did(1)
+}
+
+func TestHandler(t *testing.T) {
+	s := NewStages(0, time.Hour, func(Info) {})
+	defer s.Stop()
+	s.NewStage("download", 10).Did(4)
+
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var got []jsonInfo
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Stage != "download" || got[0].Done != 4 || got[0].Total != 10 {
+		t.Errorf("got %+v", got)
+	}
+
+	res, err = http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(body, []byte("<td>1 download</td>")) {
+		t.Errorf("HTML missing stage:\n%s", body)
+	}
+}
+
+func TestReportOnCompletionAndStop(t *testing.T) {
+	reports := make(chan Info, 10)
+	tr := Start(5, time.Hour, func(i Info) { reports <- i })
+	tr.Did(3)
+	tr.Did(2)
+	select {
+	case i := <-reports:
+		if i.Done != 5 || i.Final {
+			t.Errorf("got %+v, want a non-final report with Done=5", i)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no report when work was complete")
+	}
+
+	// Concurrent Stops make one final report.
+	done := make(chan struct{})
+	for range 3 {
+		go func() { tr.Stop(); done <- struct{}{} }()
+	}
+	for range 3 {
+		<-done
+	}
+	close(reports)
+	var finals []Info
+	for i := range reports {
+		finals = append(finals, i)
+	}
+	if len(finals) != 1 || !finals[0].Final || finals[0].Done != 5 {
+		t.Errorf("got %+v, want one final report", finals)
+	}
+	if s := finals[0].String(); !strings.HasPrefix(s, "finished: 5 done in") {
+		t.Errorf("got %q", s)
+	}
+}
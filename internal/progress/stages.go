@@ -0,0 +1,50 @@
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// Stages tracks the progress of an activity that consists of
+// a sequence of named stages, each with its own [Tracker].
+// Reports for a stage include the stage's name and number, and the
+// time elapsed since the first stage started.
+type Stages struct {
+	n        int
+	interval time.Duration
+	report   func(Info)
+	start    time.Time
+
+	mu  sync.Mutex
+	num int
+	cur *Tracker
+}
+
+// NewStages returns a Stages for an activity with n stages.
+// If n is zero, the number of stages is unknown.
+// The interval and report arguments are used for each stage, as with [Start].
+func NewStages(n int, interval time.Duration, report func(Info)) *Stages {
+	return &Stages{n: n, interval: interval, report: report, start: time.Now()}
+}
+
+// NewStage stops the current stage, if any, and starts tracking a new one
+// with the given name and total amount of work, as with [Start].
+func (s *Stages) NewStage(name string, total int) *Tracker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur.Stop()
+	s.num++
+	t := &Tracker{stages: s, stage: name, stageNum: s.num}
+	t.total.Store(int64(total))
+	t.run(s.interval, s.report)
+	s.cur = t
+	return t
+}
+
+// Stop stops the current stage.
+func (s *Stages) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur.Stop()
+	s.cur = nil
+}
@@ -0,0 +1,104 @@
+// Package licenses detects the licenses of modules in the corpus,
+// evaluates them against a policy, and describes modules and their
+// dependencies in software bills of materials (SBOMs).
+package licenses
+
+import (
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Unknown is the license ID reported for a license file whose license
+// could not be identified.
+const Unknown = "NOASSERTION"
+
+// isLicenseFile reports whether name is the name of a file that is
+// likely to hold a license.
+func isLicenseFile(name string) bool {
+	base := strings.ToUpper(strings.TrimSuffix(name, path.Ext(name)))
+	for _, p := range []string{"LICENSE", "LICENCE", "COPYING", "UNLICENSE"} {
+		if base == p || strings.HasPrefix(base, p+"-") || strings.HasPrefix(base, p+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect returns the SPDX IDs of the licenses in the license files at the
+// root of fsys, sorted and without duplicates. A license file whose license
+// is not recognized contributes [Unknown]. If there are no license files,
+// Detect returns nil.
+func Detect(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() || !isLicenseFile(e.Name()) {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, Identify(string(data)))
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
+
+// A license is recognized if its text matches all of the patterns.
+// More specific licenses come first.
+var known = []struct {
+	id       string
+	patterns []*regexp.Regexp
+}{
+	{"AGPL-3.0", res(`GNU AFFERO GENERAL PUBLIC LICENSE`)},
+	{"LGPL-3.0", res(`GNU LESSER GENERAL PUBLIC LICENSE`, `Version 3`)},
+	{"LGPL-2.1", res(`GNU LESSER GENERAL PUBLIC LICENSE`, `Version 2\.1`)},
+	{"GPL-3.0", res(`GNU GENERAL PUBLIC LICENSE`, `Version 3`)},
+	{"GPL-2.0", res(`GNU GENERAL PUBLIC LICENSE`, `Version 2`)},
+	{"MPL-2.0", res(`Mozilla Public License,? (Version|v\.) 2\.0`)},
+	{"Apache-2.0", res(`Apache License`, `Version 2\.0`)},
+	{"BSD-3-Clause", res(`Redistribution and use in source and binary forms`, `(endorse|promote) products derived from this software`)},
+	{"BSD-2-Clause", res(`Redistribution and use in source and binary forms`)},
+	{"MIT", res(`Permission is hereby granted, free of charge, to any person obtaining a copy`)},
+	{"ISC", res(`Permission to use, copy, modify, and(/or)? distribute this software for any purpose with or without fee is hereby granted`)},
+	{"Unlicense", res(`This is free and unencumbered software released into the public domain`)},
+	{"CC0-1.0", res(`CC0 1\.0 Universal`)},
+}
+
+func res(patterns ...string) []*regexp.Regexp {
+	var rs []*regexp.Regexp
+	for _, p := range patterns {
+		rs = append(rs, regexp.MustCompile(`(?i)`+p))
+	}
+	return rs
+}
+
+var space = regexp.MustCompile(`\s+`)
+
+// Identify returns the SPDX ID of the license whose text is text,
+// or [Unknown].
+func Identify(text string) string {
+	text = space.ReplaceAllString(text, " ")
+	for _, k := range known {
+		if matchAll(k.patterns, text) {
+			return k.id
+		}
+	}
+	return Unknown
+}
+
+func matchAll(rs []*regexp.Regexp, s string) bool {
+	for _, r := range rs {
+		if !r.MatchString(s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package licenses
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"golang.org/x/mod/module"
+)
+
+const (
+	mitText    = "MIT License\n\nPermission is hereby granted, free of charge, to any person obtaining a copy\nof this software..."
+	apacheText = "                                 Apache License\n                           Version 2.0, January 2004\n"
+	gplText    = "GNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007"
+)
+
+func TestDetect(t *testing.T) {
+	for _, test := range []struct {
+		files fstest.MapFS
+		want  []string
+	}{
+		{fstest.MapFS{"LICENSE": {Data: []byte(mitText)}}, []string{"MIT"}},
+		{fstest.MapFS{"LICENSE-APACHE": {Data: []byte(apacheText)}, "LICENSE-MIT.txt": {Data: []byte(mitText)}}, []string{"Apache-2.0", "MIT"}},
+		{fstest.MapFS{"COPYING": {Data: []byte("my own terms")}}, []string{Unknown}},
+		{fstest.MapFS{"README.md": {Data: []byte(mitText)}, "sub/LICENSE": {Data: []byte(gplText)}}, nil},
+		{fstest.MapFS{"LICENSE.md": {Data: []byte("GNU LESSER GENERAL PUBLIC LICENSE\n Version 2.1, February 1999")}}, []string{"LGPL-2.1"}},
+	} {
+		got, err := Detect(test.files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%v: got %v, want %v", slices.Collect(maps.Keys(test.files)), got, test.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p := ParsePolicy("MIT, Apache-2.0,BSD-3-Clause", "GPL-3.0")
+	for _, test := range []struct {
+		ids  []string
+		want Verdict
+	}{
+		{[]string{"MIT"}, Allowed},
+		{[]string{"Apache-2.0", "MIT"}, Allowed},
+		{[]string{"GPL-3.0", "MIT"}, Denied},
+		{[]string{"MPL-2.0"}, Unresolved},
+		{[]string{Unknown}, Unresolved},
+		{nil, Unresolved},
+	} {
+		if got := p.Evaluate(test.ids); got != test.want {
+			t.Errorf("%v: got %s, want %s", test.ids, got, test.want)
+		}
+	}
+	if got := (Policy{}).Evaluate([]string{"MPL-2.0"}); got != Allowed {
+		t.Errorf("empty policy: got %s, want allowed", got)
+	}
+}
+
+func TestCheckAndSBOM(t *testing.T) {
+	corpus := t.TempDir()
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/a\nrequire (\n\texample.com/b v1.0.0\n\texample.com/missing v1.0.0\n)\n",
+		"LICENSE": mitText,
+	})
+	corpustest.WriteZip(t, corpus, "example.com/b", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/b\nrequire example.com/c v1.0.0\n",
+		"LICENSE": apacheText,
+	})
+	corpustest.WriteZip(t, corpus, "example.com/c", "v1.0.0", map[string]string{
+		"LICENSE": gplText,
+	})
+	main := module.Version{Path: "example.com/a", Version: "v1.0.0"}
+	r, err := Check(context.Background(), corpus, main, ParsePolicy("MIT,Apache-2.0", "GPL-3.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range append([]*ModuleLicenses{r.Main}, r.Deps...) {
+		got = append(got, m.Path+" "+string(m.Verdict))
+	}
+	want := []string{"example.com/a allowed", "example.com/b allowed", "example.com/c denied"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(r.Missing) != 1 || r.Verdict() != Denied {
+		t.Errorf("got missing %v, verdict %s; want 1 missing, denied", r.Missing, r.Verdict())
+	}
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data, err := SPDX(r, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spdx struct {
+		Packages []struct {
+			Name            string
+			LicenseDeclared string
+		}
+		Relationships []struct{ RelationshipType string }
+	}
+	if err := json.Unmarshal(data, &spdx); err != nil {
+		t.Fatal(err)
+	}
+	if len(spdx.Packages) != 3 || spdx.Packages[2].LicenseDeclared != "GPL-3.0" || len(spdx.Relationships) != 3 {
+		t.Errorf("SPDX: got %s", data)
+	}
+
+	data, err = CycloneDX(r, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cdx struct {
+		Metadata struct {
+			Component struct{ PURL string }
+		}
+		Components   []struct{ Name string }
+		Dependencies []struct{ DependsOn []string }
+	}
+	if err := json.Unmarshal(data, &cdx); err != nil {
+		t.Fatal(err)
+	}
+	if cdx.Metadata.Component.PURL != "pkg:golang/example.com/a@v1.0.0" || len(cdx.Components) != 2 ||
+		len(cdx.Dependencies) != 1 || len(cdx.Dependencies[0].DependsOn) != 2 {
+		t.Errorf("CycloneDX: got %s", data)
+	}
+}
@@ -0,0 +1,140 @@
+package licenses
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/modfs"
+	"github.com/jba/go-ecosystem/workspace"
+	"golang.org/x/mod/module"
+)
+
+// A Policy says which licenses are acceptable.
+type Policy struct {
+	Allowed []string // if non-empty, only these licenses are allowed
+	Denied  []string // these licenses are never allowed
+}
+
+// ParsePolicy returns a policy from comma-separated lists of SPDX IDs,
+// as in the AllowedLicenses and DeniedLicenses configuration settings.
+func ParsePolicy(allowed, denied string) Policy {
+	return Policy{Allowed: splitList(allowed), Denied: splitList(denied)}
+}
+
+func splitList(s string) []string {
+	var ids []string
+	for id := range strings.SplitSeq(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// A Verdict is the result of evaluating licenses against a policy.
+type Verdict string
+
+const (
+	Allowed Verdict = "allowed"
+	Denied  Verdict = "denied"
+	// Unresolved means there is no license, a license could not be
+	// identified, or it is in neither list of a policy with allowed
+	// licenses.
+	Unresolved Verdict = "unresolved"
+)
+
+// Evaluate returns the verdict of p on a module with the given licenses,
+// all of which apply. It is Denied if any license is denied, Allowed if all
+// are allowed, and Unresolved otherwise.
+func (p Policy) Evaluate(ids []string) Verdict {
+	if slices.ContainsFunc(ids, func(id string) bool { return slices.Contains(p.Denied, id) }) {
+		return Denied
+	}
+	if len(ids) == 0 || slices.Contains(ids, Unknown) {
+		return Unresolved
+	}
+	if len(p.Allowed) > 0 && slices.ContainsFunc(ids, func(id string) bool { return !slices.Contains(p.Allowed, id) }) {
+		return Unresolved
+	}
+	return Allowed
+}
+
+// A ModuleLicenses holds the licenses of a module and the verdict of a policy on them.
+type ModuleLicenses struct {
+	module.Version
+	Licenses []string // SPDX IDs
+	Verdict  Verdict
+}
+
+// A Report is the result of [Check].
+type Report struct {
+	Main    *ModuleLicenses
+	Deps    []*ModuleLicenses // the main module's build list, sorted by path
+	Missing []module.Version  // requirements not in the corpus
+}
+
+// Verdict returns the verdict on the main module and its dependencies together:
+// Denied if any is denied, Allowed if all are allowed and none are missing,
+// and Unresolved otherwise.
+func (r *Report) Verdict() Verdict {
+	all := append([]*ModuleLicenses{r.Main}, r.Deps...)
+	if slices.ContainsFunc(all, func(m *ModuleLicenses) bool { return m.Verdict == Denied }) {
+		return Denied
+	}
+	if len(r.Missing) > 0 || slices.ContainsFunc(all, func(m *ModuleLicenses) bool { return m.Verdict != Allowed }) {
+		return Unresolved
+	}
+	return Allowed
+}
+
+// Check evaluates the module mv and its dependency closure, as computed by
+// [workspace.Resolve], against p. All modules are read from the corpus.
+func Check(ctx context.Context, corpusDir string, mv module.Version, p Policy) (_ *Report, err error) {
+	defer errs.Wrap(&err, "licenses.Check(%s)", mv)
+	main, err := moduleLicenses(corpusDir, mv, p)
+	if err != nil {
+		return nil, err
+	}
+	reqs, err := workspace.Requirements(corpusDir, mv)
+	if err != nil {
+		return nil, err
+	}
+	res, err := workspace.Resolve(corpusDir, reqs)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{Main: main, Missing: res.Missing}
+	for _, dep := range res.BuildList {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if dep.Path == mv.Path {
+			continue
+		}
+		ml, err := moduleLicenses(corpusDir, dep, p)
+		if err != nil {
+			return nil, err
+		}
+		r.Deps = append(r.Deps, ml)
+	}
+	return r, nil
+}
+
+func moduleLicenses(corpusDir string, mv module.Version, p Policy) (*ModuleLicenses, error) {
+	zipFile, err := modfs.ZipPath(corpusDir, mv.Path, mv.Version)
+	if err != nil {
+		return nil, err
+	}
+	mfs, err := modfs.Open(zipFile, mv.Path, mv.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer mfs.Close()
+	ids, err := Detect(mfs)
+	if err != nil {
+		return nil, err
+	}
+	return &ModuleLicenses{Version: mv, Licenses: ids, Verdict: p.Evaluate(ids)}, nil
+}
@@ -0,0 +1,159 @@
+package licenses
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PURL returns the package URL of a Go module version.
+// See https://github.com/package-url/purl-spec.
+func PURL(m *ModuleLicenses) string {
+	var segs []string
+	for s := range strings.SplitSeq(m.Path, "/") {
+		segs = append(segs, url.PathEscape(s))
+	}
+	return "pkg:golang/" + strings.Join(segs, "/") + "@" + url.PathEscape(m.Version.Version)
+}
+
+// expression returns an SPDX license expression for the licenses of m.
+func expression(m *ModuleLicenses) string {
+	if len(m.Licenses) == 0 {
+		return Unknown
+	}
+	for _, id := range m.Licenses {
+		if id == Unknown {
+			return Unknown
+		}
+	}
+	return strings.Join(m.Licenses, " AND ")
+}
+
+// SPDX returns an SPDX 2.3 document in JSON that describes the main module
+// of r and its dependencies.
+func SPDX(r *Report, created time.Time) ([]byte, error) {
+	type ref struct {
+		Category string `json:"referenceCategory"`
+		Type     string `json:"referenceType"`
+		Locator  string `json:"referenceLocator"`
+	}
+	type pkg struct {
+		Name             string `json:"name"`
+		ID               string `json:"SPDXID"`
+		Version          string `json:"versionInfo"`
+		DownloadLocation string `json:"downloadLocation"`
+		FilesAnalyzed    bool   `json:"filesAnalyzed"`
+		LicenseConcluded string `json:"licenseConcluded"`
+		LicenseDeclared  string `json:"licenseDeclared"`
+		ExternalRefs     []ref  `json:"externalRefs"`
+	}
+	type relationship struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	}
+	doc := struct {
+		SPDXVersion       string `json:"spdxVersion"`
+		DataLicense       string `json:"dataLicense"`
+		ID                string `json:"SPDXID"`
+		Name              string `json:"name"`
+		DocumentNamespace string `json:"documentNamespace"`
+		CreationInfo      struct {
+			Created  string   `json:"created"`
+			Creators []string `json:"creators"`
+		} `json:"creationInfo"`
+		Packages      []pkg          `json:"packages"`
+		Relationships []relationship `json:"relationships"`
+	}{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		ID:                "SPDXRef-DOCUMENT",
+		Name:              r.Main.String(),
+		DocumentNamespace: "https://github.com/jba/go-ecosystem/sbom/" + r.Main.String(),
+	}
+	doc.CreationInfo.Created = created.UTC().Format(time.RFC3339)
+	doc.CreationInfo.Creators = []string{"Tool: eco"}
+	for i, m := range append([]*ModuleLicenses{r.Main}, r.Deps...) {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i)
+		doc.Packages = append(doc.Packages, pkg{
+			Name:             m.Path,
+			ID:               id,
+			Version:          m.Version.Version,
+			DownloadLocation: Unknown,
+			LicenseConcluded: Unknown,
+			LicenseDeclared:  expression(m),
+			ExternalRefs:     []ref{{"PACKAGE-MANAGER", "purl", PURL(m)}},
+		})
+		if i == 0 {
+			doc.Relationships = append(doc.Relationships, relationship{doc.ID, "DESCRIBES", id})
+		} else {
+			doc.Relationships = append(doc.Relationships, relationship{"SPDXRef-Package-0", "DEPENDS_ON", id})
+		}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// CycloneDX returns a CycloneDX 1.5 document in JSON that describes the main
+// module of r and its dependencies.
+func CycloneDX(r *Report, created time.Time) ([]byte, error) {
+	type license struct {
+		License struct {
+			ID string `json:"id"`
+		} `json:"license"`
+	}
+	type component struct {
+		Type     string    `json:"type"`
+		BOMRef   string    `json:"bom-ref"`
+		Name     string    `json:"name"`
+		Version  string    `json:"version"`
+		PURL     string    `json:"purl"`
+		Licenses []license `json:"licenses,omitempty"`
+	}
+	type dependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	}
+	comp := func(typ string, m *ModuleLicenses) component {
+		c := component{Type: typ, BOMRef: PURL(m), Name: m.Path, Version: m.Version.Version, PURL: PURL(m)}
+		for _, id := range m.Licenses {
+			if id != Unknown {
+				var l license
+				l.License.ID = id
+				c.Licenses = append(c.Licenses, l)
+			}
+		}
+		return c
+	}
+	type tool struct {
+		Name string `json:"name"`
+	}
+	doc := struct {
+		BOMFormat   string `json:"bomFormat"`
+		SpecVersion string `json:"specVersion"`
+		Version     int    `json:"version"`
+		Metadata    struct {
+			Timestamp string    `json:"timestamp"`
+			Tools     []tool    `json:"tools"`
+			Component component `json:"component"`
+		} `json:"metadata"`
+		Components   []component  `json:"components"`
+		Dependencies []dependency `json:"dependencies"`
+	}{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+	}
+	doc.Metadata.Timestamp = created.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools = []tool{{"eco"}}
+	doc.Metadata.Component = comp("application", r.Main)
+	deps := dependency{Ref: PURL(r.Main), DependsOn: []string{}}
+	doc.Components = []component{}
+	for _, m := range r.Deps {
+		doc.Components = append(doc.Components, comp("library", m))
+		deps.DependsOn = append(deps.DependsOn, PURL(m))
+	}
+	doc.Dependencies = []dependency{deps}
+	return json.MarshalIndent(doc, "", "  ")
+}
@@ -0,0 +1,466 @@
+// Package mirror builds static module mirrors: directories laid out in the
+// module proxy protocol, which the go command can use as
+// GOPROXY=file:///path/to/dir on air-gapped machines or in hermetic CI.
+//
+// For each module version, a mirror holds the .info and .mod files, and the
+// .zip file if the version may be built. Each module has an @v/list file.
+// The manifest, mirror.sum, records the hashes of the zips and go.mod files
+// in go.sum form, so that a copy of the mirror can be verified.
+package mirror
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/depgraph"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/mvs"
+	"github.com/jba/go-ecosystem/proxy"
+	"github.com/jba/go-ecosystem/sumdb"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// ManifestFile is the name of the manifest in a mirror's directory.
+const ManifestFile = "mirror.sum"
+
+// A Builder adds modules to a mirror.
+type Builder struct {
+	// Dir is the mirror's directory.
+	Dir string
+	// Deps says whether to include the dependencies of each module: the
+	// zips of the versions in its build list, and the go.mod files of all
+	// versions in its module graph. See [mvs.BuildList] and [mvs.Graph].
+	Deps bool
+	// Loader reads go.mod requirements. It is needed only if Deps is true.
+	Loader *depgraph.Loader
+
+	// Functions that fetch a module version's files. If nil, the
+	// functions of package proxy are used.
+	Info func(ctx context.Context, path, version string) (*proxy.InfoEntry, error)
+	Mod  func(ctx context.Context, path, version string) ([]byte, error)
+	Zip  func(ctx context.Context, path, version string) ([]byte, error)
+}
+
+// A Summary describes the work of [Builder.Build].
+type Summary struct {
+	Versions int // module versions in the mirror after the build
+	Zips     int // zips in the mirror after the build
+	Fetched  int // files fetched by the build
+}
+
+// Build adds each of mods to the mirror, with their dependencies if b.Deps
+// is set. Files already in the mirror are not fetched again.
+func (b *Builder) Build(ctx context.Context, mods []module.Version) (_ *Summary, err error) {
+	defer errs.Wrap(&err, "mirror.Build(%s)", b.Dir)
+	if b.Deps && b.Loader == nil {
+		return nil, errors.New("Deps requires a Loader")
+	}
+	zips := map[module.Version]bool{}
+	gomods := map[module.Version]bool{}
+	for _, mv := range mods {
+		zips[mv] = true
+		gomods[mv] = true
+		if !b.Deps {
+			continue
+		}
+		list, _, err := mvs.BuildList(ctx, b.Loader, mv)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range list {
+			zips[d] = true
+		}
+		graph, err := mvs.Graph(ctx, b.Loader, mv)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range graph {
+			gomods[d] = true
+		}
+	}
+
+	m, err := ReadManifest(b.Dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if m == nil {
+		m = Manifest{}
+	}
+	s := &Summary{}
+	versions := map[string][]string{} // new versions, by path
+	for _, mv := range slices.SortedFunc(maps.Keys(gomods), compareVersions) {
+		if err := ctx.Err(); err != nil {
+			return s, err
+		}
+		if err := b.add(ctx, mv, zips[mv], m, s); err != nil {
+			return s, err
+		}
+		versions[mv.Path] = append(versions[mv.Path], mv.Version)
+	}
+	for path, vs := range versions {
+		if err := updateList(b.Dir, path, vs); err != nil {
+			return s, err
+		}
+	}
+	if err := m.write(b.Dir); err != nil {
+		return s, err
+	}
+	for k := range m {
+		if strings.HasSuffix(k.Version, "/go.mod") {
+			s.Versions++
+		} else {
+			s.Zips++
+		}
+	}
+	return s, nil
+}
+
+// add adds the files of mv to the mirror, and their hashes to m.
+func (b *Builder) add(ctx context.Context, mv module.Version, withZip bool, m Manifest, s *Summary) error {
+	info, mod, zipFile, err := filenames(b.Dir, mv)
+	if err != nil {
+		return err
+	}
+	fetchInfo := b.Info
+	if fetchInfo == nil {
+		fetchInfo = proxy.Info
+	}
+	fetchMod := b.Mod
+	if fetchMod == nil {
+		fetchMod = proxy.Mod
+	}
+	fetchZip := b.Zip
+	if fetchZip == nil {
+		fetchZip = proxy.ZipData
+	}
+	if !exists(info) {
+		e, err := fetchInfo(ctx, mv.Path, mv.Version)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(info, data); err != nil {
+			return err
+		}
+		s.Fetched++
+	}
+	data, fetched, err := readOrFetch(ctx, mod, mv, fetchMod)
+	if err != nil {
+		return err
+	}
+	h, err := sumdb.HashMod(data)
+	if err != nil {
+		return err
+	}
+	m[module.Version{Path: mv.Path, Version: mv.Version + "/go.mod"}] = h
+	if fetched {
+		s.Fetched++
+	}
+	if !withZip {
+		return nil
+	}
+	data, fetched, err = readOrFetch(ctx, zipFile, mv, fetchZip)
+	if err != nil {
+		return err
+	}
+	h, err = hashZip(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", mv, err)
+	}
+	m[mv] = h
+	if fetched {
+		s.Fetched++
+	}
+	return nil
+}
+
+// readOrFetch returns the contents of file, fetching and writing it if it
+// doesn't exist. It reports whether it fetched the file.
+func readOrFetch(ctx context.Context, file string, mv module.Version, fetch func(context.Context, string, string) ([]byte, error)) ([]byte, bool, error) {
+	data, err := os.ReadFile(file)
+	if err == nil {
+		return data, false, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, err
+	}
+	data, err = fetch(ctx, mv.Path, mv.Version)
+	if err != nil {
+		return nil, false, err
+	}
+	if strings.HasSuffix(file, ".zip") {
+		// Check the zip before writing it.
+		if _, err := hashZip(data); err != nil {
+			return nil, false, fmt.Errorf("%s: %w", mv, err)
+		}
+	}
+	return data, true, writeFile(file, data)
+}
+
+func hashZip(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	return sumdb.HashZip(zr)
+}
+
+// filenames returns the names of the .info, .mod and .zip files of mv in dir.
+func filenames(dir string, mv module.Version) (info, mod, zip string, err error) {
+	ep, err := module.EscapePath(mv.Path)
+	if err != nil {
+		return "", "", "", err
+	}
+	ev, err := module.EscapeVersion(mv.Version)
+	if err != nil {
+		return "", "", "", err
+	}
+	base := filepath.Join(dir, filepath.FromSlash(ep), "@v", ev)
+	return base + ".info", base + ".mod", base + ".zip", nil
+}
+
+// listFile returns the name of the @v/list file of the module at path in dir.
+func listFile(dir, path string) (string, error) {
+	ep, err := module.EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(ep), "@v", "list"), nil
+}
+
+// updateList adds versions to the @v/list file of the module at path.
+func updateList(dir, path string, versions []string) error {
+	file, err := listFile(dir, path)
+	if err != nil {
+		return err
+	}
+	old, err := readList(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	vs := slices.Compact(slices.SortedFunc(slices.Values(append(old, versions...)), semver.Compare))
+	return writeFile(file, []byte(strings.Join(vs, "\n")+"\n"))
+}
+
+func readList(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// writeFile writes data to file atomically, creating its directory.
+func writeFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// compareVersions orders module versions by path, then semantic version.
+// The entry for a go.mod file in a [Manifest] comes before that of the zip.
+func compareVersions(a, b module.Version) int {
+	if c := strings.Compare(a.Path, b.Path); c != 0 {
+		return c
+	}
+	av, amod := strings.CutSuffix(a.Version, "/go.mod")
+	bv, bmod := strings.CutSuffix(b.Version, "/go.mod")
+	if c := semver.Compare(av, bv); c != 0 {
+		return c
+	}
+	switch {
+	case amod && !bmod:
+		return -1
+	case !amod && bmod:
+		return 1
+	}
+	return 0
+}
+
+// A Manifest maps module versions to their hashes, as in a go.sum file:
+// the version of a go.mod file's entry has the suffix "/go.mod".
+type Manifest map[module.Version]string
+
+// ReadManifest reads the manifest of the mirror in dir.
+func ReadManifest(dir string) (Manifest, error) {
+	f, err := os.Open(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := Manifest{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fs := strings.Fields(sc.Text())
+		if len(fs) == 0 {
+			continue
+		}
+		if len(fs) != 3 {
+			return nil, fmt.Errorf("%s: bad line %q", ManifestFile, sc.Text())
+		}
+		m[module.Version{Path: fs[0], Version: fs[1]}] = fs[2]
+	}
+	return m, sc.Err()
+}
+
+func (m Manifest) write(dir string) error {
+	var b strings.Builder
+	for _, k := range slices.SortedFunc(maps.Keys(m), func(a, b module.Version) int {
+		return strings.Compare(a.Path+" "+a.Version, b.Path+" "+b.Version)
+	}) {
+		fmt.Fprintf(&b, "%s %s %s\n", k.Path, k.Version, m[k])
+	}
+	return writeFile(filepath.Join(dir, ManifestFile), []byte(b.String()))
+}
+
+// A Problem is something wrong with a mirror.
+type Problem struct {
+	Module module.Version // the version has the suffix "/go.mod" for a go.mod file
+	Issue  string
+}
+
+func (p Problem) String() string { return p.Module.Path + " " + p.Module.Version + ": " + p.Issue }
+
+// Verify checks the mirror in dir against its manifest: that every file in
+// the manifest is present, listed and has the recorded hash, and that there
+// are no zips or go.mod files missing from the manifest. If checkSumDB is
+// true, it also checks the hashes against the checksum database.
+func Verify(ctx context.Context, dir string, checkSumDB bool) (_ []Problem, err error) {
+	defer errs.Wrap(&err, "mirror.Verify(%s)", dir)
+	m, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	add := func(mv module.Version, format string, args ...any) {
+		problems = append(problems, Problem{mv, fmt.Sprintf(format, args...)})
+	}
+	lists := map[string][]string{}
+	for _, k := range slices.SortedFunc(maps.Keys(m), compareVersions) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		version, isMod := strings.CutSuffix(k.Version, "/go.mod")
+		mv := module.Version{Path: k.Path, Version: version}
+		_, mod, zipFile, err := filenames(dir, mv)
+		if err != nil {
+			add(k, "%v", err)
+			continue
+		}
+		file, hash := zipFile, hashZip
+		if isMod {
+			file, hash = mod, sumdb.HashMod
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			add(k, "%v", err)
+			continue
+		}
+		got, err := hash(data)
+		if err != nil {
+			add(k, "%v", err)
+			continue
+		}
+		if got != m[k] {
+			add(k, "hash is %s, manifest has %s", got, m[k])
+		}
+		if isMod {
+			if _, ok := lists[mv.Path]; !ok {
+				lf, err := listFile(dir, mv.Path)
+				if err == nil {
+					lists[mv.Path], err = readList(lf)
+				}
+				if err != nil {
+					add(k, "%v", err)
+				}
+			}
+			if !slices.Contains(lists[mv.Path], mv.Version) {
+				add(k, "not in @v/list")
+			}
+		}
+		if checkSumDB {
+			h, err := sumdb.Lookup(ctx, mv.Path, mv.Version)
+			if err != nil {
+				add(k, "checksum database: %v", err)
+				continue
+			}
+			want := h.Zip
+			if isMod {
+				want = h.Mod
+			}
+			if m[k] != want {
+				add(k, "manifest has %s, checksum database has %s", m[k], want)
+			}
+		}
+	}
+
+	// Look for files missing from the manifest.
+	err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := filepath.Ext(file)
+		if ext != ".zip" && ext != ".mod" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		epath, ev, ok := strings.Cut(filepath.ToSlash(strings.TrimSuffix(rel, ext)), "/@v/")
+		if !ok {
+			return nil
+		}
+		path, err1 := module.UnescapePath(epath)
+		version, err2 := module.UnescapeVersion(ev)
+		if err1 != nil || err2 != nil {
+			add(module.Version{Path: epath, Version: ev}, "bad file name %s", rel)
+			return nil
+		}
+		k := module.Version{Path: path, Version: version}
+		if ext == ".mod" {
+			k.Version += "/go.mod"
+		}
+		if _, ok := m[k]; !ok {
+			add(k, "not in manifest")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
@@ -0,0 +1,149 @@
+package mirror
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/depgraph"
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/proxy"
+	"golang.org/x/mod/module"
+	_ "modernc.org/sqlite"
+)
+
+var gomods = map[string]string{
+	"example.com/A@v1.0.0": "module example.com/A\nrequire (\n\texample.com/b v1.0.0\n\texample.com/c v1.0.0\n)\n",
+	"example.com/b@v1.0.0": "module example.com/b\n",
+	"example.com/b@v1.2.0": "module example.com/b\n",
+	"example.com/c@v1.0.0": "module example.com/c\nrequire example.com/b v1.2.0\n",
+}
+
+func fetchMod(_ context.Context, path, version string) ([]byte, error) {
+	s, ok := gomods[path+"@"+version]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return []byte(s), nil
+}
+
+func newBuilder(t *testing.T, dir string) (*Builder, *int) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var nzips int
+	return &Builder{
+		Dir:    dir,
+		Deps:   true,
+		Loader: &depgraph.Loader{DB: db, Fetch: fetchMod},
+		Info: func(_ context.Context, path, version string) (*proxy.InfoEntry, error) {
+			return &proxy.InfoEntry{Version: version}, nil
+		},
+		Mod: fetchMod,
+		Zip: func(_ context.Context, path, version string) ([]byte, error) {
+			nzips++
+			return corpustest.Zip(t, path, version, map[string]string{"go.mod": gomods[path+"@"+version]}), nil
+		},
+	}, &nzips
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	b, nzips := newBuilder(t, dir)
+	root := module.Version{Path: "example.com/A", Version: "v1.0.0"}
+	s, err := b.Build(ctx, []module.Version{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Zips of the build list; go.mod files of the whole graph.
+	if s.Versions != 4 || s.Zips != 3 || s.Fetched != 11 {
+		t.Errorf("got %+v, want 4 versions, 3 zips, 11 fetched", s)
+	}
+	for _, file := range []string{
+		"example.com/!a/@v/v1.0.0.zip",
+		"example.com/b/@v/v1.0.0.mod",
+		"example.com/b/@v/v1.2.0.zip",
+		"example.com/c/@v/v1.0.0.info",
+		ManifestFile,
+	} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "example.com/b/@v/v1.0.0.zip")); err == nil {
+		t.Error("example.com/b@v1.0.0 is not in the build list, but its zip is in the mirror")
+	}
+	list, err := readList(filepath.Join(dir, "example.com/b/@v/list"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v1.0.0", "v1.2.0"}; !slices.Equal(list, want) {
+		t.Errorf("example.com/b list: got %v, want %v", list, want)
+	}
+
+	// A second build fetches nothing.
+	*nzips = 0
+	s, err = b.Build(ctx, []module.Version{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Fetched != 0 || *nzips != 0 {
+		t.Errorf("rebuild fetched %d files, %d zips; want 0", s.Fetched, *nzips)
+	}
+
+	problems, err := Verify(ctx, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("got problems %v", problems)
+	}
+
+	// Corrupt the mirror.
+	if err := os.WriteFile(filepath.Join(dir, "example.com/c/@v/v1.0.0.mod"), []byte("module x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "example.com/b/@v/v1.2.0.zip")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "example.com/b/@v/list"), []byte("v1.2.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(dir, "example.com/d/@v/v1.0.0.mod"), []byte("module example.com/d\n")); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = Verify(ctx, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.Module.Path+" "+p.Module.Version)
+	}
+	want := []string{
+		"example.com/b v1.0.0/go.mod", // not listed
+		"example.com/b v1.2.0",        // missing
+		"example.com/c v1.0.0/go.mod", // mismatch
+		"example.com/d v1.0.0/go.mod", // not in manifest
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got problems\n%v\nwant problems for\n%v", problems, want)
+	}
+}
@@ -0,0 +1,169 @@
+// Package modfs presents the contents of a module zip as an [fs.FS]
+// rooted at the module, so that "go.mod" names the module's go.mod file.
+package modfs
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/proxy"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// An FS is the file system of a module at a version.
+type FS struct {
+	fs.FS
+	Path    string // module path
+	Version string
+
+	closer io.Closer
+}
+
+// New returns the file system of the module zip zr for path@version.
+// It returns an error if any file in the zip is outside the module's
+// directory, or has a name the go command would reject.
+func New(zr *zip.Reader, path, version string) (_ *FS, err error) {
+	defer errs.Wrap(&err, "modfs.New(%s@%s)", path, version)
+	prefix := path + "@" + version
+	if !fs.ValidPath(prefix) {
+		return nil, fmt.Errorf("%q is not a valid directory name", prefix)
+	}
+	for _, f := range zr.File {
+		rel, ok := strings.CutPrefix(f.Name, prefix+"/")
+		if !ok {
+			return nil, fmt.Errorf("%s: not in module directory %s", f.Name, prefix)
+		}
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue // directory entry
+		}
+		if err := module.CheckFilePath(rel); err != nil {
+			return nil, err
+		}
+	}
+	sub, err := fs.Sub(zr, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{FS: sub, Path: path, Version: version}, nil
+}
+
+// Open returns the file system of the module zip file
+// for path@version. Call [FS.Close] when done.
+func Open(filename, path, version string) (*FS, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := New(&zr.Reader, path, version)
+	if err != nil {
+		zr.Close()
+		return nil, err
+	}
+	f.closer = zr
+	return f, nil
+}
+
+// FromProxy downloads the zip of path@version from the module proxy
+// and returns its file system.
+func FromProxy(ctx context.Context, path, version string) (*FS, error) {
+	zr, err := proxy.Zip(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	return New(zr, path, version)
+}
+
+// Close releases resources held by f.
+func (f *FS) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+// ZipPath returns the path of the zip file for path@version under dir,
+// laid out like the module download cache (GOMODCACHE/cache/download)
+// and the proxy protocol: dir/escaped-path/@v/escaped-version.zip.
+func ZipPath(dir, path, version string) (string, error) {
+	epath, err := module.EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	eversion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, epath, "@v", eversion+".zip"), nil
+}
+
+// Versions returns the versions of the module path that have zip files
+// under dir, laid out as described in [ZipPath], in semver order.
+// It returns nil if there are none.
+func Versions(dir, path string) ([]string, error) {
+	epath, err := module.EscapePath(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, epath, "@v"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var vs []string
+	for _, e := range entries {
+		ev, ok := strings.CutSuffix(e.Name(), ".zip")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if v, err := module.UnescapeVersion(ev); err == nil && semver.IsValid(v) {
+			vs = append(vs, v)
+		}
+	}
+	semver.Sort(vs)
+	return vs, nil
+}
+
+// ZipFiles returns an iterator over the module zips under dir, laid out
+// as described in [ZipPath]. Files that don't fit the layout are skipped.
+func ZipFiles(dir string) iter.Seq2[module.Version, string] {
+	return func(yield func(module.Version, string) bool) {
+		filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return nil
+			}
+			epath, ezip, ok := strings.Cut(filepath.ToSlash(rel), "/@v/")
+			if !ok {
+				return nil
+			}
+			eversion, ok := strings.CutSuffix(ezip, ".zip")
+			if !ok {
+				return nil
+			}
+			path, err1 := module.UnescapePath(epath)
+			version, err2 := module.UnescapeVersion(eversion)
+			if err1 != nil || err2 != nil {
+				return nil
+			}
+			if !yield(module.Version{Path: path, Version: version}, file) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package modfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func makeZip(t *testing.T, names ...string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestNew(t *testing.T) {
+	const prefix = "example.com/m@v1.0.0/"
+	zr := makeZip(t, prefix+"go.mod", prefix+"a.go", prefix+"sub/b.go")
+	fsys, err := New(zr, "example.com/m", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(fsys, "go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != prefix+"go.mod" {
+		t.Errorf("got %q", data)
+	}
+	goFiles, err := fs.Glob(fsys, "*/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sub/b.go"}; !slices.Equal(goFiles, want) {
+		t.Errorf("got %v, want %v", goFiles, want)
+	}
+
+	for _, bad := range [][]string{
+		{"other.com/m@v1.0.0/go.mod"},
+		{prefix + "a/../../x.go"},
+		{prefix + "con.go"}, // reserved on Windows
+	} {
+		if _, err := New(makeZip(t, bad...), "example.com/m", "v1.0.0"); err == nil {
+			t.Errorf("%v: want error", bad)
+		}
+	}
+}
+
+func TestZipPath(t *testing.T) {
+	got, err := ZipPath("/d", "github.com/Foo/bar", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.FromSlash("/d/github.com/!foo/bar/@v/v1.0.0.zip"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
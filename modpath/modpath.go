@@ -0,0 +1,229 @@
+// Package modpath compares the path of a module with the path declared in
+// its go.mod file and with the repository the proxy says it came from,
+// to find modules that were renamed or moved, and vanity import paths
+// that resolve to unexpected repositories.
+package modpath
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/forge"
+	"github.com/jba/go-ecosystem/proxy"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Findings.
+const (
+	// Renamed means go.mod declares a different module path. The module
+	// cannot be required by its path, and its canonical path is the
+	// declared one.
+	Renamed = "renamed"
+	// CaseRenamed is like Renamed, but the paths differ only in case,
+	// as when an organization on a forge changes the case of its name.
+	CaseRenamed = "case-renamed"
+	// Moved means a path on a forge refers to a different repository,
+	// usually because the forge redirects from a renamed repository.
+	Moved = "moved"
+	// UnexpectedRepo means a vanity path with a well-known convention
+	// resolves to a repository other than the conventional one.
+	// That may be benign, or the vanity domain may have been taken over.
+	UnexpectedRepo = "unexpected-repo"
+)
+
+// A Result describes the path of a module, as stored in the module_paths table.
+type Result struct {
+	ModulePath    string
+	Version       string
+	DeclaredPath  string // module directive of go.mod
+	Repo          string // origin repository, like "github.com/owner/name"; empty if unknown
+	CanonicalPath string // path the module is known by
+	Finding       string // one of the constants above, or empty
+	Detail        string
+	Checked       string
+}
+
+// Classify compares modulePath with the module path in gomod and with
+// the repository of origin, and returns the result.
+func Classify(modulePath string, gomod []byte, origin proxy.Origin) *Result {
+	r := &Result{
+		ModulePath:    modulePath,
+		DeclaredPath:  modfile.ModulePath(gomod),
+		Repo:          RepoFromURL(origin.URL),
+		CanonicalPath: modulePath,
+	}
+	if r.DeclaredPath == "" {
+		// Modules without go.mod files are required by their paths.
+		r.DeclaredPath = modulePath
+	}
+	switch {
+	case r.DeclaredPath != modulePath:
+		r.Finding = Renamed
+		if strings.EqualFold(r.DeclaredPath, modulePath) {
+			r.Finding = CaseRenamed
+		}
+		r.CanonicalPath = r.DeclaredPath
+		r.Detail = fmt.Sprintf("go.mod declares %s", r.DeclaredPath)
+	case r.Repo == "":
+		// Nothing more to compare.
+	default:
+		want, vanity := expectedRepo(modulePath)
+		if want == "" || strings.EqualFold(want, r.Repo) {
+			break
+		}
+		if vanity {
+			r.Finding = UnexpectedRepo
+			r.Detail = fmt.Sprintf("expected repository %s, got %s", want, r.Repo)
+		} else {
+			r.Finding = Moved
+			r.CanonicalPath = r.Repo + strings.TrimPrefix(modulePath, repoPrefix(modulePath))
+			r.Detail = fmt.Sprintf("%s is served from %s", want, r.Repo)
+		}
+	}
+	return r
+}
+
+// RepoFromURL returns the repository of a VCS URL without its scheme and
+// ".git" suffix, like "github.com/owner/name", or "" if the URL can't be parsed.
+func RepoFromURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Host + strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+}
+
+// repoPrefix returns the prefix of a module path on a forge that names
+// its repository, like "github.com/owner/name".
+func repoPrefix(modulePath string) string {
+	parts := strings.SplitN(modulePath, "/", 4)
+	if len(parts) < 3 {
+		return modulePath
+	}
+	return strings.Join(parts[:3], "/")
+}
+
+// expectedRepo returns the repository that modulePath should come from,
+// if it is on a forge or follows a well-known vanity convention.
+// The second result reports whether the path is a vanity path.
+func expectedRepo(modulePath string) (repo string, vanity bool) {
+	if _, _, _, ok := forge.RepoFor(modulePath); ok {
+		return strings.TrimSuffix(repoPrefix(modulePath), ".git"), false
+	}
+	for _, v := range vanityRules {
+		rest, ok := strings.CutPrefix(modulePath, v.prefix)
+		if !ok {
+			continue
+		}
+		if repo := v.repo(rest); repo != "" {
+			return repo, true
+		}
+	}
+	return "", false
+}
+
+// vanityRules map the paths of well-known vanity domains to repositories.
+// The repo function is passed the rest of the path after prefix.
+var vanityRules = []struct {
+	prefix string
+	repo   func(rest string) string
+}{
+	{"golang.org/x/", firstElem("go.googlesource.com/")},
+	{"k8s.io/", firstElem("github.com/kubernetes/")},
+	{"sigs.k8s.io/", firstElem("github.com/kubernetes-sigs/")},
+	{"go.uber.org/", firstElem("github.com/uber-go/")},
+	{"google.golang.org/grpc", exact("github.com/grpc/grpc-go")},
+	{"google.golang.org/protobuf", exact("go.googlesource.com/protobuf")},
+	{"cloud.google.com/go", exact("github.com/googleapis/google-cloud-go")},
+	{"gopkg.in/", gopkgIn},
+}
+
+func firstElem(repoPrefix string) func(string) string {
+	return func(rest string) string {
+		elem, _, _ := strings.Cut(rest, "/")
+		if elem == "" {
+			return ""
+		}
+		return repoPrefix + elem
+	}
+}
+
+func exact(repo string) func(string) string {
+	return func(rest string) string {
+		if rest == "" || strings.HasPrefix(rest, "/") {
+			return repo
+		}
+		return ""
+	}
+}
+
+// gopkgIn implements the gopkg.in convention: gopkg.in/pkg.vN is
+// github.com/go-pkg/pkg, and gopkg.in/user/pkg.vN is github.com/user/pkg.
+func gopkgIn(rest string) string {
+	parts := strings.Split(rest, "/")
+	var user, pkg string
+	if i := strings.LastIndex(parts[0], ".v"); i > 0 {
+		user, pkg = "go-"+parts[0][:i], parts[0][:i]
+	} else if len(parts) >= 2 {
+		i := strings.LastIndex(parts[1], ".v")
+		if i <= 0 {
+			return ""
+		}
+		user, pkg = parts[0], parts[1][:i]
+	} else {
+		return ""
+	}
+	return "github.com/" + user + "/" + pkg
+}
+
+// Check fetches the go.mod file and origin of path@version from the proxy
+// and classifies them.
+func Check(ctx context.Context, path, version string) (_ *Result, err error) {
+	defer errs.Wrap(&err, "modpath.Check(%s@%s)", path, version)
+	if err := module.CheckPath(path); err != nil {
+		return nil, err
+	}
+	gomod, err := proxy.Mod(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	info, err := proxy.Info(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	r := Classify(path, gomod, info.Origin)
+	r.Version = version
+	r.Checked = time.Now().UTC().Format(time.RFC3339)
+	return r, nil
+}
+
+var resultCols = []string{"module_path", "version", "declared_path", "repo", "canonical_path", "finding", "detail", "checked"}
+
+// Record replaces the stored result for r.ModulePath with r.
+func Record(ctx context.Context, db *sql.DB, r *Result) error {
+	_, err := database.Upsert(ctx, db, "module_paths", resultCols[:1], resultCols,
+		r.ModulePath, r.Version, r.DeclaredPath, r.Repo, r.CanonicalPath, r.Finding, r.Detail, r.Checked)
+	return err
+}
+
+var selectResults = "SELECT " + strings.Join(resultCols, ", ") + " FROM module_paths"
+
+// Flagged returns the stored results with findings, ordered by module path.
+func Flagged(ctx context.Context, db *sql.DB) (iter.Seq[*Result], func() error) {
+	return database.ScanRowsAs[Result](ctx, db, selectResults+" WHERE finding != '' ORDER BY module_path")
+}
+
+// Aliases returns the stored results of the modules whose canonical path
+// is canonicalPath, other than the module with that path itself.
+func Aliases(ctx context.Context, db *sql.DB, canonicalPath string) (iter.Seq[*Result], func() error) {
+	return database.ScanRowsAs[Result](ctx, db,
+		selectResults+" WHERE canonical_path = ? AND module_path != ? ORDER BY module_path", canonicalPath, canonicalPath)
+}
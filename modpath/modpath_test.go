@@ -0,0 +1,86 @@
+package modpath
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/proxy"
+	_ "modernc.org/sqlite"
+)
+
+func TestClassify(t *testing.T) {
+	for _, test := range []struct {
+		path, declared, url string
+		wantFinding         string
+		wantCanonical       string
+	}{
+		{"github.com/a/b", "github.com/a/b", "https://github.com/a/b", "", "github.com/a/b"},
+		{"github.com/a/b/v2", "github.com/a/b/v2", "https://github.com/A/B.git", "", "github.com/a/b/v2"},
+		{"github.com/a/b", "", "", "", "github.com/a/b"},
+		{"github.com/a/b", "example.com/b", "https://github.com/a/b", Renamed, "example.com/b"},
+		{"github.com/Sirupsen/logrus", "github.com/sirupsen/logrus", "", CaseRenamed, "github.com/sirupsen/logrus"},
+		{"github.com/old/b/v3", "github.com/old/b/v3", "https://github.com/new/b", Moved, "github.com/new/b/v3"},
+		{"golang.org/x/mod", "golang.org/x/mod", "https://go.googlesource.com/mod", "", "golang.org/x/mod"},
+		{"golang.org/x/mod", "golang.org/x/mod", "https://github.com/evil/mod", UnexpectedRepo, "golang.org/x/mod"},
+		{"gopkg.in/yaml.v3", "gopkg.in/yaml.v3", "https://github.com/go-yaml/yaml", "", "gopkg.in/yaml.v3"},
+		{"gopkg.in/user/pkg.v1", "gopkg.in/user/pkg.v1", "https://github.com/other/pkg", UnexpectedRepo, "gopkg.in/user/pkg.v1"},
+		{"example.com/vanity", "example.com/vanity", "https://github.com/x/y", "", "example.com/vanity"},
+	} {
+		var gomod []byte
+		if test.declared != "" {
+			gomod = []byte("module " + test.declared + "\n")
+		}
+		r := Classify(test.path, gomod, proxy.Origin{VCS: "git", URL: test.url})
+		if r.Finding != test.wantFinding || r.CanonicalPath != test.wantCanonical {
+			t.Errorf("%s (%s, %s): got %q, %s; want %q, %s",
+				test.path, test.declared, test.url, r.Finding, r.CanonicalPath, test.wantFinding, test.wantCanonical)
+		}
+	}
+}
+
+func TestDB(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*Result{
+		Classify("github.com/a/b", []byte("module github.com/a/b\n"), proxy.Origin{}),
+		Classify("github.com/A/b", []byte("module github.com/a/b\n"), proxy.Origin{}),
+		Classify("example.com/b", []byte("module github.com/a/b\n"), proxy.Origin{}),
+	} {
+		if err := Record(ctx, db, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collect := func(seq iter.Seq[*Result], errf func() error) []string {
+		var paths []string
+		for r := range seq {
+			paths = append(paths, r.ModulePath)
+		}
+		if err := errf(); err != nil {
+			t.Fatal(err)
+		}
+		return paths
+	}
+	want := []string{"example.com/b", "github.com/A/b"}
+	if got := collect(Flagged(ctx, db)); !slices.Equal(got, want) {
+		t.Errorf("Flagged: got %v, want %v", got, want)
+	}
+	if got := collect(Aliases(ctx, db, "github.com/a/b")); !slices.Equal(got, want) {
+		t.Errorf("Aliases: got %v, want %v", got, want)
+	}
+}
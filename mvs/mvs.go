@@ -0,0 +1,225 @@
+// Package mvs computes the dependency versions that builds actually use.
+//
+// A module's go.mod file declares minimum versions of its requirements, but
+// minimal version selection (MVS) may select higher ones, required elsewhere
+// in the module graph. Running MVS from the latest version of every module
+// shows which versions of each dependency the ecosystem effectively builds
+// with, and how that differs from what modules declare.
+//
+// The computation follows the complete module graph. It does not model the
+// graph pruning of modules at go 1.17 or higher, so it may select higher
+// versions than the go command would for such modules.
+package mvs
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/depgraph"
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/vulndb"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// BuildList returns the versions that MVS selects for the dependencies of
+// root, sorted by path, and root's own requirements. The root is not in the
+// build list. Requirements of a module's own path are ignored.
+func BuildList(ctx context.Context, l *depgraph.Loader, root module.Version) (list []module.Version, direct []depgraph.Requirement, err error) {
+	defer errs.Wrap(&err, "mvs.BuildList(%s)", root)
+	graph, direct, err := walk(ctx, l, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := map[string]string{}
+	for _, mv := range graph {
+		if semver.Compare(mv.Version, selected[mv.Path]) > 0 || selected[mv.Path] == "" {
+			selected[mv.Path] = mv.Version
+		}
+	}
+	for _, p := range slices.Sorted(maps.Keys(selected)) {
+		list = append(list, module.Version{Path: p, Version: selected[p]})
+	}
+	return list, direct, nil
+}
+
+// Graph returns every module version in the requirement graph of root,
+// other than root, sorted by path and version. These are the versions
+// whose go.mod files the go command may read when building root.
+func Graph(ctx context.Context, l *depgraph.Loader, root module.Version) (_ []module.Version, err error) {
+	defer errs.Wrap(&err, "mvs.Graph(%s)", root)
+	graph, _, err := walk(ctx, l, root)
+	if err != nil {
+		return nil, err
+	}
+	module.Sort(graph)
+	return graph, nil
+}
+
+// walk returns the module versions reachable from root's requirements,
+// in breadth-first order, and root's requirements.
+func walk(ctx context.Context, l *depgraph.Loader, root module.Version) (graph []module.Version, direct []depgraph.Requirement, err error) {
+	direct, err = l.Requirements(ctx, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	visited := map[module.Version]bool{root: true}
+	push := func(rs []depgraph.Requirement) {
+		for _, r := range rs {
+			mv := module.Version{Path: r.Path, Version: r.Version}
+			if r.Path == root.Path || visited[mv] {
+				continue
+			}
+			visited[mv] = true
+			graph = append(graph, mv)
+		}
+	}
+	push(direct)
+	for i := 0; i < len(graph); i++ {
+		rs, err := l.Requirements(ctx, graph[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		push(rs)
+	}
+	return graph, direct, nil
+}
+
+// A Summary describes the work of [Run].
+type Summary struct {
+	Roots    int // modules whose build lists were computed
+	Upgrades int // requirements of roots raised by MVS
+	Errors   errs.Collector
+}
+
+// Run computes the build list of each root, and replaces the contents of
+// the selected_versions, declared_versions and upgrades tables with the
+// results. Roots whose build lists cannot be computed are recorded in the
+// summary; Run returns an error only if it cannot continue.
+func Run(ctx context.Context, db *sql.DB, l *depgraph.Loader, roots iter.Seq[module.Version]) (_ *Summary, err error) {
+	defer errs.Wrap(&err, "mvs.Run")
+	s := &Summary{Errors: errs.Collector{Limit: 1000}}
+	selected := map[module.Version]int{}
+	declared := map[module.Version]int{}
+	var upgrades [][]any
+	for root := range roots {
+		if err := ctx.Err(); err != nil {
+			return s, err
+		}
+		list, direct, err := BuildList(ctx, l, root)
+		if err != nil {
+			if err := s.Errors.Add(root.String(), err); err != nil {
+				return s, err
+			}
+			continue
+		}
+		s.Roots++
+		for _, mv := range list {
+			selected[mv]++
+		}
+		for _, r := range direct {
+			if r.Path == root.Path {
+				continue
+			}
+			declared[module.Version{Path: r.Path, Version: r.Version}]++
+			i, _ := slices.BinarySearchFunc(list, r.Path, func(mv module.Version, p string) int { return strings.Compare(mv.Path, p) })
+			if sel := list[i].Version; sel != r.Version {
+				upgrades = append(upgrades, []any{root.Path, root.Version, r.Path, r.Version, sel})
+			}
+		}
+	}
+	s.Upgrades = len(upgrades)
+	err = database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		for _, t := range []string{"selected_versions", "declared_versions", "upgrades"} {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+t); err != nil {
+				return err
+			}
+		}
+		for table, counts := range map[string]map[module.Version]int{"selected_versions": selected, "declared_versions": declared} {
+			rows := func(yield func([]any) bool) {
+				for mv, n := range counts {
+					if !yield([]any{mv.Path, mv.Version, n}) {
+						return
+					}
+				}
+			}
+			if _, err := database.BulkInsert(ctx, tx, table, []string{"path", "version", "roots"}, rows, 500); err != nil {
+				return err
+			}
+		}
+		_, err := database.BulkInsert(ctx, tx, "upgrades",
+			[]string{"root_path", "root_version", "path", "declared", "selected"}, slices.Values(upgrades), 500)
+		return err
+	})
+	if err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// A Usage compares how many roots declare and select a version of a module.
+type Usage struct {
+	Path     string
+	Version  string
+	Declared int // roots that require this version directly
+	Selected int // roots whose build lists select this version
+}
+
+// Versions returns the usage of each version of the module with the given
+// path, in semver order.
+func Versions(ctx context.Context, db *sql.DB, path string) ([]*Usage, error) {
+	us, err := usages(ctx, db, "WHERE path = ?", path)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(us, func(a, b *Usage) int { return semver.Compare(a.Version, b.Version) })
+	return us, nil
+}
+
+func usages(ctx context.Context, db *sql.DB, where string, args ...any) ([]*Usage, error) {
+	seq, errf := database.ScanRowsAs[Usage](ctx, db, `
+		SELECT path, version, SUM(declared) AS declared, SUM(selected) AS selected FROM (
+			SELECT path, version, roots AS declared, 0 AS selected FROM declared_versions
+			UNION ALL
+			SELECT path, version, 0, roots FROM selected_versions
+		) `+where+` GROUP BY path, version`, args...)
+	us := slices.Collect(seq)
+	return us, errf()
+}
+
+// A VulnUsage is the usage of a vulnerable version.
+type VulnUsage struct {
+	Usage
+	IDs []string // advisories that affect the version
+}
+
+// Vulnerable returns the usage of versions affected by advisories matched
+// by m, most selected first. Selected counts the builds that would really
+// use a vulnerable version; Declared counts the modules that require it.
+func Vulnerable(ctx context.Context, db *sql.DB, m *vulndb.Matcher) ([]*VulnUsage, error) {
+	us, err := usages(ctx, db, "")
+	if err != nil {
+		return nil, err
+	}
+	var vs []*VulnUsage
+	for _, u := range us {
+		if ids := m.Match(u.Path, u.Version); len(ids) > 0 {
+			vs = append(vs, &VulnUsage{Usage: *u, IDs: ids})
+		}
+	}
+	slices.SortFunc(vs, func(a, b *VulnUsage) int {
+		if a.Selected != b.Selected {
+			return b.Selected - a.Selected
+		}
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return semver.Compare(a.Version, b.Version)
+	})
+	return vs, nil
+}
@@ -0,0 +1,116 @@
+package mvs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/depgraph"
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/vulndb"
+	"golang.org/x/mod/module"
+	_ "modernc.org/sqlite"
+)
+
+var gomods = map[string]string{
+	"a@v1.0.0": "module a\nrequire (\n\tb v1.0.0\n\tc v1.0.0\n)\n",
+	"b@v1.0.0": "module b\n",
+	"b@v1.2.0": "module b\n",
+	"c@v1.0.0": "module c\nrequire b v1.2.0\n",
+	"d@v1.0.0": "module d\nrequire b v1.0.0\n",
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	l := &depgraph.Loader{DB: db, Fetch: func(_ context.Context, path, version string) ([]byte, error) {
+		s, ok := gomods[path+"@"+version]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return []byte(s), nil
+	}}
+
+	list, _, err := BuildList(ctx, l, module.Version{Path: "a", Version: "v1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []module.Version{{Path: "b", Version: "v1.2.0"}, {Path: "c", Version: "v1.0.0"}}; !slices.Equal(list, want) {
+		t.Errorf("BuildList: got %v, want %v", list, want)
+	}
+	graph, err := Graph(ctx, l, module.Version{Path: "a", Version: "v1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []module.Version{{Path: "b", Version: "v1.0.0"}, {Path: "b", Version: "v1.2.0"}, {Path: "c", Version: "v1.0.0"}}; !slices.Equal(graph, want) {
+		t.Errorf("Graph: got %v, want %v", graph, want)
+	}
+
+	roots := []module.Version{
+		{Path: "a", Version: "v1.0.0"},
+		{Path: "b", Version: "v1.2.0"},
+		{Path: "c", Version: "v1.0.0"},
+		{Path: "d", Version: "v1.0.0"},
+	}
+	s, err := Run(ctx, db, l, slices.Values(roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Roots != 4 || s.Upgrades != 1 || s.Errors.Len() != 0 {
+		t.Errorf("got %d roots, %d upgrades, %d errors; want 4, 1, 0", s.Roots, s.Upgrades, s.Errors.Len())
+	}
+
+	us, err := Versions(ctx, db, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Usage
+	for _, u := range us {
+		got = append(got, *u)
+	}
+	want := []Usage{{"b", "v1.0.0", 2, 1}, {"b", "v1.2.0", 1, 2}}
+	if !slices.Equal(got, want) {
+		t.Errorf("Versions: got %v, want %v", got, want)
+	}
+
+	e := &vulndb.Entry{
+		ID: "GO-2024-0001",
+		Affected: []vulndb.Affected{{
+			Module: vulndb.Module{Path: "b", Ecosystem: "Go"},
+			Ranges: []vulndb.Range{{Type: "SEMVER", Events: []vulndb.RangeEvent{{Introduced: "0"}, {Fixed: "1.1.0"}}}},
+		}},
+	}
+	if err := vulndb.Store(ctx, db, e); err != nil {
+		t.Fatal(err)
+	}
+	mt, err := vulndb.NewMatcher(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := Vulnerable(ctx, db, mt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vgot []string
+	for _, v := range vs {
+		vgot = append(vgot, fmt.Sprintf("%s@%s %d %d %v", v.Path, v.Version, v.Declared, v.Selected, v.IDs))
+	}
+	if vwant := []string{"b@v1.0.0 2 1 [GO-2024-0001]"}; !slices.Equal(vgot, vwant) {
+		t.Errorf("Vulnerable: got %q, want %q", vgot, vwant)
+	}
+}
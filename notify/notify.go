@@ -0,0 +1,293 @@
+// Package notify sends webhook notifications of pipeline events, so that
+// eco can post to Slack or trigger other automation.
+//
+// Webhooks are defined in a JSON file holding a list of [Hook]s. For example,
+// this posts a message to Slack for each completed update run, and when an
+// advisory affects more than ten modules:
+//
+//	[{
+//		"URL": "https://hooks.slack.com/services/...",
+//		"Events": ["update-done", "vuln-affects"],
+//		"MinModules": 10,
+//		"Template": "{\"text\": {{json .Text}}}"
+//	}]
+//
+// A request is retried if it fails with a transient error.
+// If a hook has a secret, the request is signed; see [Sign].
+//
+// Webhook URLs often contain secrets, so errors name a hook by its
+// position in the list and the host of its URL, never by its full URL.
+package notify
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+)
+
+// Kinds of events.
+const (
+	UpdateDone  = "update-done"  // an update run completed
+	NewVersion  = "new-version"  // a watched module has a new version in the index
+	VulnAffects = "vuln-affects" // a new or changed advisory affects the latest versions of modules
+)
+
+// An Event is something that happened in the pipeline.
+type Event struct {
+	Kind    string
+	Time    time.Time
+	Text    string         // a one-line description, suitable for a chat message
+	Module  string         `json:",omitempty"` // NewVersion: the module path
+	Version string         `json:",omitempty"` // NewVersion: the new version
+	Vuln    string         `json:",omitempty"` // VulnAffects: the advisory ID
+	Count   int            `json:",omitempty"` // VulnAffects: the number of affected modules
+	Data    map[string]any `json:",omitempty"` // other details, like the counts of an update run
+}
+
+// A Hook is a webhook: a URL to POST to when certain events happen.
+type Hook struct {
+	URL string
+	// Events are the kinds of events to send. If empty, all kinds are sent.
+	Events []string `json:",omitempty"`
+	// Modules are the paths of the watched modules. NewVersion events
+	// are sent only for these.
+	Modules []string `json:",omitempty"`
+	// MinModules is the number of affected modules a VulnAffects event
+	// must exceed to be sent.
+	MinModules int `json:",omitempty"`
+	// Template is a text/template for the request body, executed with the
+	// [Event]. The function "json" encodes its argument as JSON.
+	// If empty, the body is the event encoded as JSON.
+	Template string `json:",omitempty"`
+	// ContentType is the Content-Type of the request. If empty,
+	// "application/json" is used.
+	ContentType string `json:",omitempty"`
+	// Secret, if not empty, is used to sign requests.
+	Secret string `json:",omitempty"`
+
+	tmpl *template.Template
+}
+
+var funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// init checks h, the hook at index i of its list.
+func (h *Hook) init(i int) error {
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("hooks[%d]: URL is not an http or https URL", i)
+	}
+	for _, k := range h.Events {
+		if k != UpdateDone && k != NewVersion && k != VulnAffects {
+			return fmt.Errorf("%s: unknown event kind %q", h.name(i), k)
+		}
+	}
+	if h.Template != "" {
+		t, err := template.New(h.name(i)).Funcs(funcs).Parse(h.Template)
+		if err != nil {
+			return err
+		}
+		h.tmpl = t
+	}
+	return nil
+}
+
+// name identifies h, the hook at index i of its list, in errors.
+func (h *Hook) name(i int) string {
+	return fmt.Sprintf("hooks[%d] (%s)", i, redactURL(h.URL))
+}
+
+// redactURL returns the scheme and host of the URL s, without the path,
+// query or user information that may hold a secret.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return "invalid URL"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// wants reports whether h accepts events of the given kind.
+func (h *Hook) wants(kind string) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, kind)
+}
+
+// Matches reports whether e should be sent to h.
+func (h *Hook) Matches(e *Event) bool {
+	if !h.wants(e.Kind) {
+		return false
+	}
+	switch e.Kind {
+	case NewVersion:
+		return slices.Contains(h.Modules, e.Module)
+	case VulnAffects:
+		return e.Count > h.MinModules
+	}
+	return true
+}
+
+// body returns the request body for e.
+func (h *Hook) body(e *Event) ([]byte, error) {
+	if h.tmpl == nil {
+		return json.Marshal(e)
+	}
+	var buf bytes.Buffer
+	if err := h.tmpl.Execute(&buf, e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Headers of signed requests.
+const (
+	TimestampHeader = "X-Eco-Timestamp"
+	SignatureHeader = "X-Eco-Signature"
+)
+
+// Sign returns the signature of a request with the given timestamp header
+// and body: "sha256=" followed by the hex-encoded HMAC-SHA256, keyed with
+// secret, of the timestamp, a period and the body. A receiver can check the
+// signature, and reject old timestamps to prevent replays.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// A Notifier sends events to hooks.
+// A nil *Notifier has no hooks.
+type Notifier struct {
+	Hooks []*Hook
+	// Client sends requests. If nil, a client that retries transient
+	// failures is used.
+	Client *http.Client
+}
+
+var defaultClient = &http.Client{
+	Timeout: 2 * time.Minute,
+	Transport: &httputil.RetryTransport{
+		Base:        httputil.DefaultClient.Transport,
+		MaxAttempts: 5,
+		MinBackoff:  time.Second,
+		MaxBackoff:  30 * time.Second,
+	},
+}
+
+// New returns a Notifier for hooks, after checking them.
+func New(hooks []*Hook) (*Notifier, error) {
+	for i, h := range hooks {
+		if err := h.init(i); err != nil {
+			return nil, err
+		}
+	}
+	return &Notifier{Hooks: hooks}, nil
+}
+
+// Load returns a Notifier for the hooks in the JSON file.
+func Load(file string) (_ *Notifier, err error) {
+	defer errs.Wrap(&err, "notify.Load(%s)", file)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var hooks []*Hook
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, err
+	}
+	return New(hooks)
+}
+
+// Wants reports whether any hook accepts events of the given kind.
+// Callers can use it to avoid computing events that won't be sent.
+func (n *Notifier) Wants(kind string) bool {
+	if n == nil {
+		return false
+	}
+	return slices.ContainsFunc(n.Hooks, func(h *Hook) bool { return h.wants(kind) })
+}
+
+// Watched reports whether any hook watches the module at path
+// for new versions.
+func (n *Notifier) Watched(path string) bool {
+	if n == nil {
+		return false
+	}
+	return slices.ContainsFunc(n.Hooks, func(h *Hook) bool {
+		return h.wants(NewVersion) && slices.Contains(h.Modules, path)
+	})
+}
+
+// Notify sends e to the hooks that match it. If e.Time is zero, it is set
+// to the current time. The error describes the hooks that failed.
+func (n *Notifier) Notify(ctx context.Context, e *Event) error {
+	if n == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	var errList []error
+	for i, h := range n.Hooks {
+		if !h.Matches(e) {
+			continue
+		}
+		if err := n.send(ctx, h, e); err != nil {
+			errList = append(errList, fmt.Errorf("notify %s to %s: %w", e.Kind, h.name(i), err))
+		}
+	}
+	return errors.Join(errList...)
+}
+
+// send sends e to h. Errors that include the hook's URL have it redacted.
+func (n *Notifier) send(ctx context.Context, h *Hook, e *Event) (err error) {
+	defer func() { err = redactErr(err) }()
+	body, err := h.body(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", cmp.Or(h.ContentType, "application/json"))
+	if h.Secret != "" {
+		ts := strconv.FormatInt(e.Time.Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, Sign(h.Secret, ts, body))
+	}
+	_, err = httputil.DoReadBody(req, httputil.WithClient(cmp.Or(n.Client, defaultClient)))
+	return err
+}
+
+// redactErr redacts the URLs in the errors in err's tree that hold one.
+func redactErr(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL = redactURL(ue.URL)
+	}
+	var he *httputil.HTTPError
+	if errors.As(err, &he) {
+		he.URL = redactURL(he.URL)
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/httputil"
+)
+
+func TestNotify(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+		fail   = 1 // fail the first request, to check retries
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail > 0 {
+			fail--
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/signed" {
+			want := Sign("s3cret", r.Header.Get(TimestampHeader), body)
+			if got := r.Header.Get(SignatureHeader); got != want {
+				t.Errorf("signature: got %q, want %q", got, want)
+			}
+		}
+		bodies = append(bodies, r.URL.Path+" "+string(body))
+	}))
+	defer srv.Close()
+
+	n, err := New([]*Hook{
+		{
+			URL:        srv.URL + "/slack",
+			Events:     []string{UpdateDone, VulnAffects},
+			MinModules: 2,
+			Template:   `{"text": {{json .Text}}}`,
+		},
+		{
+			URL:     srv.URL + "/signed",
+			Events:  []string{NewVersion},
+			Modules: []string{"example.com/m"},
+			Secret:  "s3cret",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Client = &http.Client{Transport: &httputil.RetryTransport{MinBackoff: time.Millisecond}}
+
+	if !n.Watched("example.com/m") || n.Watched("example.com/other") {
+		t.Error("Watched is wrong")
+	}
+	if !n.Wants(VulnAffects) || (*Notifier)(nil).Wants(VulnAffects) {
+		t.Error("Wants is wrong")
+	}
+
+	ctx := context.Background()
+	tm := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	for _, e := range []*Event{
+		{Kind: UpdateDone, Text: `update "done"`},
+		{Kind: VulnAffects, Vuln: "GO-1", Count: 2, Text: "GO-1 affects 2"}, // not more than MinModules
+		{Kind: VulnAffects, Vuln: "GO-2", Count: 3, Text: "GO-2 affects 3"},
+		{Kind: NewVersion, Module: "example.com/other", Version: "v1.0.0"}, // not watched
+		{Kind: NewVersion, Module: "example.com/m", Version: "v1.1.0", Time: tm},
+	} {
+		if err := n.Notify(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		`/slack {"text": "update \"done\""}`,
+		`/slack {"text": "GO-2 affects 3"}`,
+		`/signed {"Kind":"new-version","Time":"2026-10-01T00:00:00Z","Text":"","Module":"example.com/m","Version":"v1.1.0"}`,
+	}
+	if !slices.Equal(bodies, want) {
+		t.Errorf("got\n%q\nwant\n%q", bodies, want)
+	}
+
+	if _, err := New([]*Hook{{URL: "https://example.com", Events: []string{"bogus"}}}); err == nil {
+		t.Error("want error for unknown event kind")
+	}
+	if _, err := New([]*Hook{{URL: "example.com/services/secret"}}); err == nil {
+		t.Error("want error for URL without a scheme")
+	}
+}
+
+func TestNotifyRedacts(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	defer srv.Close()
+	n, err := New([]*Hook{
+		{URL: srv.URL + "/services/secret1?token=secret2"},
+		{URL: closed.URL + "/services/secret3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Client = http.DefaultClient
+	err = n.Notify(context.Background(), &Event{Kind: UpdateDone})
+	if err == nil {
+		t.Fatal("got nil, want error")
+	}
+	for _, s := range []string{"secret", "token", "services"} {
+		if strings.Contains(err.Error(), s) {
+			t.Errorf("error contains %q: %v", s, err)
+		}
+	}
+	if !strings.Contains(err.Error(), "hooks[1] ("+closed.URL+")") {
+		t.Errorf("error does not name hooks[1]: %v", err)
+	}
+}
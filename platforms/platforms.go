@@ -0,0 +1,360 @@
+// Package platforms records which operating systems and architectures the
+// packages of each module support, according to their build constraints
+// and file name suffixes.
+//
+// The "platforms" analyzer (see package analysis) stores, for each package,
+// the platforms for which none of its files would be built. A package
+// supports a platform if at least one of its non-test files is built for
+// it; whether the package then compiles is not checked.
+package platforms
+
+import (
+	"context"
+	"database/sql"
+	"go/ast"
+	"go/build/constraint"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/internal/database"
+)
+
+// A Platform is an operating system and architecture.
+type Platform struct {
+	GOOS, GOARCH string
+}
+
+func (p Platform) String() string { return p.GOOS + "/" + p.GOARCH }
+
+// ParsePlatform parses a string like "linux/amd64". It reports false
+// if s is not in the list of [All] platforms.
+func ParsePlatform(s string) (Platform, bool) {
+	goos, goarch, _ := strings.Cut(s, "/")
+	p := Platform{goos, goarch}
+	return p, slices.Contains(All, p)
+}
+
+// All is the list of platforms, as reported by "go tool dist list".
+var All = []Platform{
+	{"aix", "ppc64"},
+	{"android", "386"}, {"android", "amd64"}, {"android", "arm"}, {"android", "arm64"},
+	{"darwin", "amd64"}, {"darwin", "arm64"},
+	{"dragonfly", "amd64"},
+	{"freebsd", "386"}, {"freebsd", "amd64"}, {"freebsd", "arm"}, {"freebsd", "arm64"},
+	{"illumos", "amd64"},
+	{"ios", "amd64"}, {"ios", "arm64"},
+	{"js", "wasm"},
+	{"linux", "386"}, {"linux", "amd64"}, {"linux", "arm"}, {"linux", "arm64"},
+	{"linux", "loong64"}, {"linux", "mips"}, {"linux", "mips64"}, {"linux", "mips64le"},
+	{"linux", "mipsle"}, {"linux", "ppc64"}, {"linux", "ppc64le"}, {"linux", "riscv64"},
+	{"linux", "s390x"},
+	{"netbsd", "386"}, {"netbsd", "amd64"}, {"netbsd", "arm"}, {"netbsd", "arm64"},
+	{"openbsd", "386"}, {"openbsd", "amd64"}, {"openbsd", "arm"}, {"openbsd", "arm64"},
+	{"openbsd", "ppc64"}, {"openbsd", "riscv64"},
+	{"plan9", "386"}, {"plan9", "amd64"}, {"plan9", "arm"},
+	{"solaris", "amd64"},
+	{"wasip1", "wasm"},
+	{"windows", "386"}, {"windows", "amd64"}, {"windows", "arm64"},
+}
+
+var (
+	knownOS   = map[string]bool{}
+	knownArch = map[string]bool{}
+)
+
+func init() {
+	for _, p := range All {
+		knownOS[p.GOOS] = true
+		knownArch[p.GOARCH] = true
+	}
+}
+
+// unixOS are the operating systems that satisfy the "unix" build tag.
+var unixOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"hurd": true, "illumos": true, "ios": true, "linux": true, "netbsd": true,
+	"openbsd": true, "solaris": true,
+}
+
+// impliedOS maps an operating system to another whose files and tags
+// it also matches, as the go command does.
+var impliedOS = map[string]string{"android": "linux", "illumos": "solaris", "ios": "darwin"}
+
+// Analyzer records the platforms each package does not support.
+var Analyzer = &analysis.Analyzer{
+	Name:    "platforms",
+	Doc:     "record the platforms for which each package has no files",
+	Version: 1,
+	Columns: []string{
+		"package TEXT NOT NULL",
+		"constrained INTEGER NOT NULL", // whether any file is limited to some platforms
+		"unsupported TEXT NOT NULL",    // space-separated platforms, like "plan9/386 windows/amd64"
+	},
+	Indexes: []string{"package"},
+	Run: func(pass *analysis.Pass) error {
+		for _, s := range PackageSupport(pass.Path, pass.Files) {
+			pass.Report(s.Package, s.Constrained, strings.Join(s.Unsupported, " "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	analysis.Register(Analyzer)
+}
+
+// Support describes the platforms a package supports.
+type Support struct {
+	Package     string   // import path
+	Constrained bool     // whether any file is limited to some platforms
+	Unsupported []string // platforms with no files, in the order of All
+}
+
+// PackageSupport returns the support of each package in files, which
+// belong to the module with the given path, sorted by import path.
+// Test files and files in testdata and vendor directories are skipped,
+// as are packages with no files for any platform.
+func PackageSupport(modulePath string, files []*analysis.File) []*Support {
+	byDir := map[string][]*analysis.File{}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, "_test.go") || skipDir(f.Name) {
+			continue
+		}
+		byDir[path.Dir(f.Name)] = append(byDir[path.Dir(f.Name)], f)
+	}
+	var ss []*Support
+	for dir, fs := range byDir {
+		s := &Support{Package: modulePath}
+		if dir != "." {
+			s.Package += "/" + dir
+		}
+		supported := 0
+		for _, p := range All {
+			ok := false
+			for _, f := range fs {
+				m, constrained := Matches(f, p)
+				s.Constrained = s.Constrained || constrained
+				if m {
+					ok = true
+				}
+			}
+			if ok {
+				supported++
+			} else {
+				s.Unsupported = append(s.Unsupported, p.String())
+			}
+		}
+		if supported > 0 {
+			ss = append(ss, s)
+		}
+	}
+	slices.SortFunc(ss, func(a, b *Support) int { return strings.Compare(a.Package, b.Package) })
+	return ss
+}
+
+func skipDir(name string) bool {
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem == "testdata" || elem == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether f would be built for p, considering its name and
+// its //go:build or // +build lines. It also reports whether f is
+// constrained to some platforms. Release tags like go1.21 are satisfied,
+// as are "gc" and "cgo"; other tags are not.
+func Matches(f *analysis.File, p Platform) (match, constrained bool) {
+	nameOK, nameConstrained := matchName(path.Base(f.Name), p)
+	expr := buildConstraint(f.AST)
+	if expr == nil {
+		return nameOK, nameConstrained
+	}
+	platformTag := false
+	ok := expr.Eval(func(tag string) bool {
+		if knownOS[tag] || knownArch[tag] || tag == "unix" {
+			platformTag = true
+		}
+		return matchTag(tag, p)
+	})
+	return nameOK && ok, nameConstrained || platformTag
+}
+
+// matchName reports whether a file name with a GOOS or GOARCH suffix
+// matches p, following the rules of go/build.
+func matchName(name string, p Platform) (match, constrained bool) {
+	name, _, _ = strings.Cut(name, ".")
+	// Before Go 1.4, a file named linux.go matched linux; now the
+	// suffix must follow an underscore.
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return true, false
+	}
+	elems := strings.Split(name[i:], "_")
+	n := len(elems)
+	if n >= 2 && knownOS[elems[n-2]] && knownArch[elems[n-1]] {
+		return matchTag(elems[n-2], p) && matchTag(elems[n-1], p), true
+	}
+	if n >= 1 && (knownOS[elems[n-1]] || knownArch[elems[n-1]]) {
+		return matchTag(elems[n-1], p), true
+	}
+	return true, false
+}
+
+func matchTag(tag string, p Platform) bool {
+	switch {
+	case tag == p.GOOS || tag == p.GOARCH:
+		return true
+	case tag == impliedOS[p.GOOS]:
+		return true
+	case tag == "unix":
+		return unixOS[p.GOOS]
+	case tag == "gc" || tag == "cgo":
+		return true
+	case strings.HasPrefix(tag, "go1."):
+		return true
+	}
+	return false
+}
+
+// buildConstraint returns the build constraint of f, or nil if it has none.
+// A //go:build line takes precedence over // +build lines.
+func buildConstraint(f *ast.File) constraint.Expr {
+	var plus []constraint.Expr
+	for _, cg := range f.Comments {
+		if cg.Pos() >= f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				continue
+			}
+			x, err := constraint.Parse(c.Text)
+			if err != nil {
+				continue
+			}
+			if constraint.IsGoBuild(c.Text) {
+				return x
+			}
+			plus = append(plus, x)
+		}
+	}
+	if len(plus) == 0 {
+		return nil
+	}
+	x := plus[0]
+	for _, y := range plus[1:] {
+		x = &constraint.AndExpr{X: x, Y: y}
+	}
+	return x
+}
+
+// A Gap is a module whose packages don't all support an operating system.
+type Gap struct {
+	ModulePath string
+	Version    string
+	Packages   int // number of packages without support for any architecture
+	Importers  int // number of modules that import the module's packages
+}
+
+// Gaps returns the modules whose latest versions have packages, other than
+// internal and main ones, that support no architecture of goos, most
+// imported first. Importers are counted from the results of the imports
+// analyzer, if it has been run. If limit is positive, at most limit gaps
+// are returned.
+func Gaps(ctx context.Context, db *sql.DB, goos string, limit int) ([]*Gap, error) {
+	var archs []string
+	for _, p := range All {
+		if p.GOOS == goos {
+			archs = append(archs, p.String())
+		}
+	}
+	// A package lacks goos if every goos platform is unsupported.
+	var conds []string
+	var args []any
+	for _, a := range archs {
+		conds = append(conds, "(' ' || a.unsupported || ' ') LIKE ?")
+		args = append(args, "% "+a+" %")
+	}
+	if len(conds) == 0 {
+		return nil, nil
+	}
+	query := `
+		SELECT a.module_path, a.version, COUNT(*) AS packages
+		FROM ` + Analyzer.Table() + ` a
+		JOIN modules m ON m.path = a.module_path AND m.latest_version = a.version
+		WHERE ` + strings.Join(conds, " AND ") + `
+		AND a.package NOT LIKE '%/internal/%' AND a.package NOT LIKE '%/internal'
+		GROUP BY a.module_path, a.version`
+	seq, errf := database.ScanRowsAs[Gap](ctx, db, query, args...)
+	gaps := slices.Collect(seq)
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	if err := countImporters(ctx, db, gaps); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(gaps, func(a, b *Gap) int {
+		if a.Importers != b.Importers {
+			return b.Importers - a.Importers
+		}
+		return strings.Compare(a.ModulePath, b.ModulePath)
+	})
+	if limit > 0 && len(gaps) > limit {
+		gaps = gaps[:limit]
+	}
+	return gaps, nil
+}
+
+// countImporters sets the Importers field of each gap.
+func countImporters(ctx context.Context, db *sql.DB, gaps []*Gap) error {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'analysis_imports'").Scan(&n)
+	if err != nil || n == 0 {
+		return err
+	}
+	for _, g := range gaps {
+		err := db.QueryRowContext(ctx, `
+			SELECT COUNT(DISTINCT module_path) FROM analysis_imports
+			WHERE (import_path = ? OR import_path LIKE ? || '/%') AND module_path != ?`,
+			g.ModulePath, g.ModulePath, g.ModulePath).Scan(&g.Importers)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matrix returns, for each operating system of the latest analyzed version
+// of the module, the number of its packages that support some architecture
+// of that system, and the total number of packages.
+func Matrix(ctx context.Context, db *sql.DB, modulePath string) (version string, supported map[string]int, total int, err error) {
+	type row struct {
+		Version     string
+		Unsupported string
+	}
+	seq, errf := database.ScanRowsAs[row](ctx, db, `
+		SELECT a.version, a.unsupported FROM `+Analyzer.Table()+` a
+		JOIN modules m ON m.path = a.module_path AND m.latest_version = a.version
+		WHERE a.module_path = ?`, modulePath)
+	supported = map[string]int{}
+	for r := range seq {
+		version = r.Version
+		total++
+		unsupported := strings.Fields(r.Unsupported)
+		seen := map[string]bool{}
+		for _, p := range All {
+			if !seen[p.GOOS] && !slices.Contains(unsupported, p.String()) {
+				seen[p.GOOS] = true
+				supported[p.GOOS]++
+			}
+		}
+	}
+	if err := errf(); err != nil {
+		return "", nil, 0, err
+	}
+	return version, supported, total, nil
+}
@@ -0,0 +1,147 @@
+package platforms
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/analysis/analysistest"
+	"github.com/jba/go-ecosystem/ecodb"
+	_ "modernc.org/sqlite"
+)
+
+func TestMatches(t *testing.T) {
+	for _, test := range []struct {
+		name, src string
+		platform  string
+		want      bool
+	}{
+		{"a.go", "package a", "windows/amd64", true},
+		{"a_windows.go", "package a", "windows/amd64", true},
+		{"a_windows.go", "package a", "linux/amd64", false},
+		{"a_linux_arm64.go", "package a", "linux/arm64", true},
+		{"a_linux_arm64.go", "package a", "linux/amd64", false},
+		{"a_linux.go", "package a", "android/arm64", true},
+		{"a_arm64.go", "package a", "darwin/arm64", true},
+		{"linux.go", "package a", "windows/amd64", true},
+		{"a_unknown.go", "package a", "windows/amd64", true},
+		{"a.go", "//go:build unix\n\npackage a", "freebsd/amd64", true},
+		{"a.go", "//go:build unix\n\npackage a", "windows/amd64", false},
+		{"a.go", "//go:build !windows && go1.21\n\npackage a", "windows/386", false},
+		{"a.go", "//go:build !windows && go1.21\n\npackage a", "plan9/386", true},
+		{"a.go", "//go:build darwin\n\npackage a", "ios/arm64", true},
+		{"a.go", "//go:build ignore\n\npackage a", "linux/amd64", false},
+		{"a.go", "// +build linux darwin\n\npackage a", "darwin/arm64", true},
+		{"a.go", "// +build linux darwin\n\npackage a", "windows/arm64", false},
+		{"a_windows.go", "//go:build amd64\n\npackage a", "windows/arm64", false},
+	} {
+		_, files := analysistest.Parse(t, map[string]string{test.name: test.src})
+		f := files[0]
+		p, ok := ParsePlatform(test.platform)
+		if !ok {
+			t.Fatalf("bad platform %q", test.platform)
+		}
+		if got, _ := Matches(f, p); got != test.want {
+			t.Errorf("%s %q on %s: got %t, want %t", test.name, test.src, p, got, test.want)
+		}
+	}
+}
+
+func TestPackageSupport(t *testing.T) {
+	_, files := analysistest.Parse(t, map[string]string{
+		"a.go":               "package a",
+		"unix/u.go":          "//go:build unix\n\npackage unix",
+		"win/w_windows.go":   "package win",
+		"win/w_test.go":      "package win",
+		"testdata/x.go":      "//go:build windows\n\npackage x",
+		"none/n.go":          "//go:build ignore\n\npackage main",
+		"plan9/p_plan9.go":   "package plan9",
+		"plan9/p_windows.go": "package plan9",
+	})
+	var got []string
+	for _, s := range PackageSupport("example.com/m", files) {
+		got = append(got, fmt.Sprintf("%s %t %d", s.Package, s.Constrained, len(All)-len(s.Unsupported)))
+	}
+	want := []string{
+		"example.com/m false 47",
+		"example.com/m/plan9 true 6",
+		"example.com/m/unix true 39",
+		"example.com/m/win true 3",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	exec := func(q string, args ...any) {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, q, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range []struct{ path, version string }{
+		{"example.com/unix", "v1.0.0"},
+		{"example.com/popular", "v1.1.0"},
+		{"example.com/all", "v1.0.0"},
+		{"example.com/user", "v1.0.0"},
+	} {
+		exec("INSERT INTO modules (path, error, latest_version, info_time) VALUES (?, '', ?, '')", m.path, m.version)
+	}
+	noWindows := "windows/386 windows/amd64 windows/arm64"
+	exec("CREATE TABLE " + Analyzer.Table() + " (module_path TEXT, version TEXT, package TEXT, constrained INTEGER, unsupported TEXT)")
+	for _, r := range []struct{ path, version, pkg, unsupported string }{
+		{"example.com/unix", "v1.0.0", "example.com/unix", noWindows + " plan9/386 plan9/amd64 plan9/arm"},
+		{"example.com/unix", "v1.0.0", "example.com/unix/b", noWindows},
+		{"example.com/popular", "v1.1.0", "example.com/popular", noWindows},
+		{"example.com/popular", "v1.1.0", "example.com/popular/internal/x", noWindows},
+		// Not the latest version.
+		{"example.com/all", "v0.9.0", "example.com/all", noWindows},
+		// Some windows support.
+		{"example.com/all", "v1.0.0", "example.com/all", "windows/arm64"},
+	} {
+		exec("INSERT INTO "+Analyzer.Table()+" VALUES (?, ?, ?, 1, ?)", r.path, r.version, r.pkg, r.unsupported)
+	}
+	exec("CREATE TABLE analysis_imports (module_path TEXT, version TEXT, file TEXT, import_path TEXT)")
+	exec("INSERT INTO analysis_imports VALUES ('example.com/user', 'v1.0.0', 'u.go', 'example.com/popular')")
+
+	gaps, err := Gaps(ctx, db, "windows", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, g := range gaps {
+		got = append(got, fmt.Sprintf("%s@%s %d %d", g.ModulePath, g.Version, g.Packages, g.Importers))
+	}
+	want := []string{
+		"example.com/popular@v1.1.0 1 1",
+		"example.com/unix@v1.0.0 2 0",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Gaps: got %q, want %q", got, want)
+	}
+
+	version, supported, total, err := Matrix(ctx, db, "example.com/unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "v1.0.0" || total != 2 || supported["windows"] != 0 || supported["plan9"] != 1 || supported["linux"] != 2 {
+		t.Errorf("Matrix: got %s, %v, %d", version, supported, total)
+	}
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+
+	"golang.org/x/mod/module"
+
+	"github.com/jba/go-ecosystem/internal/pool"
+)
+
+const defaultConcurrency = 10
+
+// WithConcurrency sets the maximum number of requests of a batch, like
+// [Client.InfoBatch], that are made at once. The default is 10.
+// The requests are rate-limited like any others.
+func WithConcurrency(n int) Option {
+	return func(o *options) { o.concurrency = n }
+}
+
+// SetConcurrency sets the batch concurrency of the default client.
+// See [WithConcurrency].
+func SetConcurrency(n int) {
+	defaultClient.concurrency = n
+}
+
+// An InfoResult is the result of a request of [Client.InfoBatch].
+type InfoResult struct {
+	Version module.Version
+	Info    *InfoEntry // nil if Err is not nil
+	Err     error
+}
+
+// InfoBatch calls [Client.InfoBatch] on the default client.
+func InfoBatch(ctx context.Context, mvs []module.Version) []InfoResult {
+	return defaultClient.InfoBatch(ctx, mvs)
+}
+
+// InfoBatch calls [Client.Info] on each of mvs, making several requests at
+// once; see [WithConcurrency]. It returns the results in the order of mvs.
+// A failed request doesn't affect the others. If ctx is done, requests not
+// yet made fail with ctx's error.
+func (c *Client) InfoBatch(ctx context.Context, mvs []module.Version) []InfoResult {
+	indexes := func(yield func(int) bool) {
+		for i := range mvs {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	res := make([]InfoResult, len(mvs))
+	// Failures are reported in the results, so Run fails only if ctx is done.
+	p := &pool.Pool[int]{Concurrency: c.concurrency}
+	err := p.Run(ctx, indexes, func(ctx context.Context, i int) error {
+		info, err := c.Info(ctx, mvs[i].Path, mvs[i].Version)
+		res[i] = InfoResult{Version: mvs[i], Info: info, Err: err}
+		return nil
+	})
+	for i := range res {
+		if res[i].Info == nil && res[i].Err == nil { // not started
+			res[i] = InfoResult{Version: mvs[i], Err: err}
+		}
+	}
+	return res
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/module"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+func TestInfoBatch(t *testing.T) {
+	var (
+		mu              sync.Mutex
+		inFlight, maxIn int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxIn = max(maxIn, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		time.Sleep(5 * time.Millisecond)
+		_, v, ok := strings.Cut(r.URL.Path, "/@v/")
+		if !ok || strings.HasPrefix(r.URL.Path, "/example.com/missing/") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"Version": %q, "Time": "2024-01-01T00:00:00Z"}`, strings.TrimSuffix(v, ".info"))
+	}))
+	defer srv.Close()
+
+	var mvs []module.Version
+	for i := range 20 {
+		path := "example.com/m"
+		if i%5 == 0 {
+			path = "example.com/missing"
+		}
+		mvs = append(mvs, module.Version{Path: path, Version: fmt.Sprintf("v1.0.%d", i)})
+	}
+	c := New(WithURL(srv.URL), WithMaxQPS(1000), WithConcurrency(3))
+	res := c.InfoBatch(context.Background(), mvs)
+	if len(res) != len(mvs) {
+		t.Fatalf("got %d results, want %d", len(res), len(mvs))
+	}
+	for i, r := range res {
+		if r.Version != mvs[i] {
+			t.Errorf("#%d: got version %v, want %v", i, r.Version, mvs[i])
+		}
+		if i%5 == 0 {
+			if !errors.Is(r.Err, errs.NotFound) {
+				t.Errorf("#%d: got %v, want NotFound", i, r.Err)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("#%d: %v", i, r.Err)
+		} else if r.Info.Version != mvs[i].Version {
+			t.Errorf("#%d: got info for %s", i, r.Info.Version)
+		}
+	}
+	if maxIn > 3 {
+		t.Errorf("%d requests at once, want at most 3", maxIn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, r := range c.InfoBatch(ctx, mvs) {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Fatalf("canceled: got %v", r.Err)
+		}
+	}
+}
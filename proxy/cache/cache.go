@@ -0,0 +1,489 @@
+// Package cache is a disk cache for responses from a module proxy.
+//
+// Each response is a file holding its status code on the first line, followed
+// by its body, as with [httputil.CacheTransport]. An index file records, for
+// each entry, the kind of request, its size, when it was stored and last used,
+// and the validators used to revalidate it. The cache is kept within a maximum
+// size by evicting the least recently used entries, and entries expire after
+// a time that depends on their kind: a list of versions changes often, but
+// the go.mod file of a version never does.
+//
+// The index is written periodically and by [Cache.Flush]. When a cache is
+// opened, the index is reconciled with the files in the directory, so entries
+// written after the last flush, or files removed by another process, are
+// accounted for.
+package cache
+
+import (
+	"cmp"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+)
+
+// IndexFile is the name of the index in the cache directory.
+const IndexFile = "index.json"
+
+// A Kind is a kind of proxy request.
+type Kind string
+
+// Kinds of requests.
+const (
+	List   Kind = "list"   // .../@v/list
+	Latest Kind = "latest" // .../@latest
+	Info   Kind = "info"   // .../@v/VERSION.info
+	Mod    Kind = "mod"    // .../@v/VERSION.mod
+	Zip    Kind = "zip"    // .../@v/VERSION.zip
+	Other  Kind = "other"
+)
+
+// Kinds are all the kinds, in display order.
+var Kinds = []Kind{List, Latest, Info, Mod, Zip, Other}
+
+// KindOf returns the kind of the request for the URL.
+func KindOf(u string) Kind {
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		u = u[:i]
+	}
+	switch {
+	case strings.HasSuffix(u, "/@v/list"):
+		return List
+	case strings.HasSuffix(u, "/@latest"):
+		return Latest
+	case !strings.Contains(u, "/@v/"):
+		return Other
+	case strings.HasSuffix(u, ".info"):
+		return Info
+	case strings.HasSuffix(u, ".mod"):
+		return Mod
+	case strings.HasSuffix(u, ".zip"):
+		return Zip
+	}
+	return Other
+}
+
+// DefaultTTL is how long a successful response of each kind is fresh,
+// unless [Options.TTL] says otherwise.
+var DefaultTTL = map[Kind]time.Duration{
+	List:   time.Hour,
+	Latest: time.Hour,
+	Info:   24 * time.Hour,
+	Mod:    30 * 24 * time.Hour,
+	Zip:    30 * 24 * time.Hour,
+	Other:  24 * time.Hour,
+}
+
+// Options configure a [Cache].
+type Options struct {
+	// MaxSize is the largest total size of the entries, in bytes.
+	// If zero, there is no limit.
+	MaxSize int64
+	// TTL overrides [DefaultTTL] for some kinds.
+	TTL map[Kind]time.Duration
+	// NegativeTTL is how long a 404 or 410 response is fresh.
+	// The default is one hour.
+	NegativeTTL time.Duration
+	// Now returns the current time. The default is time.Now.
+	Now func() time.Time
+}
+
+// An Entry describes a cached response.
+type Entry struct {
+	Name       string // of the file in the cache directory
+	Key        string // the URL; empty if the name is a hash and the entry was found by reconciling
+	Kind       Kind
+	Status     int
+	Size       int64 // of the file
+	Stored     time.Time
+	Used       time.Time
+	Validators httputil.Validators `json:",omitzero"`
+}
+
+// flushInterval is the longest time between writes of the index, if it changes.
+const flushInterval = time.Minute
+
+// A Cache is a cache of proxy responses in a directory.
+// It is safe for concurrent use.
+type Cache struct {
+	dir  string
+	opts Options
+
+	loadOnce sync.Once
+	loadErr  error
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element // by name; values are *Entry
+	lru       *list.List               // front is most recently used
+	size      int64
+	dirty     bool
+	lastFlush time.Time
+}
+
+// New returns a cache in dir, which is created if it doesn't exist.
+// The index is read when the cache is first used.
+func New(dir string, opts Options) *Cache {
+	if opts.NegativeTTL == 0 {
+		opts.NegativeTTL = time.Hour
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Cache{dir: dir, opts: opts}
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// TTL returns how long a response with the given kind and status is fresh.
+// Responses that aren't successful, or 404 or 410, aren't cached.
+func (c *Cache) TTL(kind Kind, status int) time.Duration {
+	switch {
+	case status >= 200 && status < 300:
+		if ttl, ok := c.opts.TTL[kind]; ok {
+			return ttl
+		}
+		return DefaultTTL[kind]
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return c.opts.NegativeTTL
+	default:
+		return 0
+	}
+}
+
+// load reads the index and reconciles it with the files in the directory.
+func (c *Cache) load() error {
+	c.loadOnce.Do(func() {
+		c.loadErr = c.doLoad()
+		if c.loadErr != nil {
+			c.loadErr = fmt.Errorf("proxy cache %s: %w", c.dir, c.loadErr)
+		}
+	})
+	return c.loadErr
+}
+
+func (c *Cache) doLoad() error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	c.entries = map[string]*list.Element{}
+	c.lru = list.New()
+	var indexed []*Entry
+	data, err := os.ReadFile(filepath.Join(c.dir, IndexFile))
+	if err == nil {
+		// A bad index is rebuilt from the files.
+		_ = json.Unmarshal(data, &indexed)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	byName := map[string]*Entry{}
+	for _, e := range indexed {
+		byName[e.Name] = e
+	}
+
+	des, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var all []*Entry
+	for _, de := range des {
+		name := de.Name()
+		if !de.Type().IsRegular() || name == IndexFile || strings.HasPrefix(name, ".tmp-") {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		e := byName[name]
+		if e == nil || e.Size != info.Size() {
+			// Written after the last flush, or by another process.
+			e, err = entryFromFile(filepath.Join(c.dir, name), info)
+			if err != nil {
+				c.dirty = true
+				continue
+			}
+		}
+		all = append(all, e)
+	}
+	if len(all) != len(indexed) {
+		c.dirty = true
+	}
+	slices.SortFunc(all, func(a, b *Entry) int { return b.Used.Compare(a.Used) })
+	for _, e := range all {
+		c.entries[e.Name] = c.lru.PushBack(e)
+		c.size += e.Size
+	}
+	c.lastFlush = c.opts.Now()
+	return nil
+}
+
+// entryFromFile returns an entry for a cache file that isn't in the index,
+// or an error if the file isn't a cache file.
+func entryFromFile(file string, info fs.FileInfo) (*Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	status, err := httputil.ReadCacheStatus(f)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{
+		Name:   info.Name(),
+		Kind:   Other,
+		Status: status,
+		Size:   info.Size(),
+		Stored: info.ModTime(),
+		Used:   info.ModTime(),
+	}
+	if key, err := url.PathUnescape(e.Name); err == nil && httputil.CacheFileName(key) == e.Name {
+		e.Key = key
+		e.Kind = KindOf(key)
+	}
+	return e, nil
+}
+
+// get returns the entry for key and its body, or nil if there is none.
+func (c *Cache) get(key string) (*Entry, []byte, error) {
+	name := httputil.CacheFileName(key)
+	c.mu.Lock()
+	el := c.entries[name]
+	c.mu.Unlock()
+	if el == nil {
+		return nil, nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Removed behind our back.
+		c.mu.Lock()
+		c.remove(name)
+		c.mu.Unlock()
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	_, body, err := httputil.DecodeCacheFile(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cache file %s: %w", name, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el := c.entries[name]; el != nil {
+		e := *el.Value.(*Entry)
+		return &e, body, nil
+	}
+	return nil, nil, nil
+}
+
+// touch marks the entry for key as used now, and if revalidated,
+// as stored now.
+func (c *Cache) touch(key string, revalidated bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el := c.entries[httputil.CacheFileName(key)]; el != nil {
+		e := el.Value.(*Entry)
+		e.Used = c.opts.Now()
+		if revalidated {
+			e.Stored = e.Used
+		}
+		c.lru.MoveToFront(el)
+		c.dirty = true
+	}
+	return c.maybeFlush()
+}
+
+// put stores a response.
+func (c *Cache) put(key string, status int, body []byte, vals httputil.Validators) error {
+	name := httputil.CacheFileName(key)
+	data := httputil.EncodeCacheFile(status, body)
+	if c.opts.MaxSize > 0 && int64(len(data)) > c.opts.MaxSize {
+		return nil
+	}
+	if err := httputil.WriteFileAtomic(filepath.Join(c.dir, name), data); err != nil {
+		return err
+	}
+	now := c.opts.Now()
+	e := &Entry{
+		Name:       name,
+		Key:        key,
+		Kind:       KindOf(key),
+		Status:     status,
+		Size:       int64(len(data)),
+		Stored:     now,
+		Used:       now,
+		Validators: vals,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(name)
+	c.entries[name] = c.lru.PushFront(e)
+	c.size += e.Size
+	c.dirty = true
+	var errList []error
+	for c.opts.MaxSize > 0 && c.size > c.opts.MaxSize {
+		old := c.lru.Back().Value.(*Entry)
+		if err := c.removeFile(old.Name); err != nil {
+			errList = append(errList, err)
+			break
+		}
+	}
+	errList = append(errList, c.maybeFlush())
+	return errors.Join(errList...)
+}
+
+// remove removes the entry with the given name from the index.
+// c.mu must be held.
+func (c *Cache) remove(name string) {
+	if el := c.entries[name]; el != nil {
+		c.size -= el.Value.(*Entry).Size
+		c.lru.Remove(el)
+		delete(c.entries, name)
+		c.dirty = true
+	}
+}
+
+// removeFile removes the entry with the given name and its file.
+// c.mu must be held.
+func (c *Cache) removeFile(name string) error {
+	if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	c.remove(name)
+	return nil
+}
+
+// maybeFlush writes the index if it changed and it hasn't been written lately.
+// c.mu must be held.
+func (c *Cache) maybeFlush() error {
+	if !c.dirty || c.opts.Now().Sub(c.lastFlush) < flushInterval {
+		return nil
+	}
+	return c.flush()
+}
+
+// Flush writes the index, if it has changed.
+func (c *Cache) Flush() error {
+	if err := c.load(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	return c.flush()
+}
+
+func (c *Cache) flush() error {
+	var all []*Entry
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		all = append(all, el.Value.(*Entry))
+	}
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	if err := httputil.WriteFileAtomic(filepath.Join(c.dir, IndexFile), data); err != nil {
+		return err
+	}
+	c.dirty = false
+	c.lastFlush = c.opts.Now()
+	return nil
+}
+
+// Entries returns the entries of the cache, most recently used first.
+func (c *Cache) Entries() ([]Entry, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var es []Entry
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		es = append(es, *el.Value.(*Entry))
+	}
+	return es, nil
+}
+
+// Expired reports whether e is no longer fresh at time now.
+func (c *Cache) Expired(e Entry, now time.Time) bool {
+	return now.Sub(e.Stored) >= c.TTL(e.Kind, e.Status)
+}
+
+// A PruneResult describes what [Cache.Prune] removed.
+type PruneResult struct {
+	Expired int   // expired entries removed
+	Evicted int   // entries removed to meet the maximum size
+	Bytes   int64 // bytes freed
+	Left    int64 // bytes remaining
+}
+
+// Prune removes expired entries that can't be revalidated, then the least
+// recently used entries until the cache is within maxSize bytes. A maxSize
+// of zero means the cache's maximum size. If dryRun is true, nothing is
+// removed, but the result describes what would be. The index is written
+// afterwards.
+func (c *Cache) Prune(maxSize int64, dryRun bool) (_ PruneResult, err error) {
+	defer errs.Wrap(&err, "cache.Prune(%s)", c.dir)
+	if err := c.load(); err != nil {
+		return PruneResult{}, err
+	}
+	maxSize = cmp.Or(maxSize, c.opts.MaxSize)
+	now := c.opts.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := PruneResult{Left: c.size}
+	removed := map[string]bool{}
+	var errList []error
+	drop := func(e *Entry) bool {
+		if !dryRun {
+			if err := c.removeFile(e.Name); err != nil {
+				errList = append(errList, err)
+				return false
+			}
+		}
+		removed[e.Name] = true
+		res.Bytes += e.Size
+		res.Left -= e.Size
+		return true
+	}
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*Entry)
+		if c.Expired(*e, now) && e.Validators.IsZero() && drop(e) {
+			res.Expired++
+		}
+		el = next
+	}
+	for el := c.lru.Back(); el != nil && maxSize > 0 && res.Left > maxSize; {
+		prev := el.Prev()
+		if e := el.Value.(*Entry); !removed[e.Name] && drop(e) {
+			res.Evicted++
+		}
+		el = prev
+	}
+	if !dryRun && c.dirty {
+		errList = append(errList, c.flush())
+	}
+	return res, errors.Join(errList...)
+}
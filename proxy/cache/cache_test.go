@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/httputil"
+)
+
+func TestKindOf(t *testing.T) {
+	for _, test := range []struct {
+		url  string
+		want Kind
+	}{
+		{"https://proxy.golang.org/golang.org/x/mod/@v/list", List},
+		{"https://proxy.golang.org/golang.org/x/mod/@latest", Latest},
+		{"https://proxy.golang.org/golang.org/x/mod/@v/v0.1.0.info", Info},
+		{"https://proxy.golang.org/golang.org/x/mod/@v/v0.1.0.mod", Mod},
+		{"https://proxy.golang.org/golang.org/x/mod/@v/v0.1.0.zip", Zip},
+		{"https://proxy.golang.org/golang.org/x/mod/@v/master.info?x=1", Info},
+		{"https://proxy.golang.org/sumdb/sum.golang.org/supported", Other},
+	} {
+		if got := KindOf(test.url); got != test.want {
+			t.Errorf("KindOf(%q) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, ".mod") {
+			if r.Header.Get("If-None-Match") == `"m"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"m"`)
+		}
+		if strings.Contains(r.URL.Path, "missing") {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, strings.Repeat("x", 100))
+	}))
+	defer srv.Close()
+
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	c := New(dir, Options{MaxSize: 350, Now: func() time.Time { return now }})
+	client := &http.Client{Transport: c.Transport(nil)}
+	get := func(path string) {
+		t.Helper()
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode == http.StatusOK && len(body) != 100 {
+			t.Fatalf("%s: got %d bytes, want 100", path, len(body))
+		}
+	}
+	check := func(want ...string) {
+		t.Helper()
+		if strings.Join(requests, " ") != strings.Join(want, " ") {
+			t.Errorf("got requests %v, want %v", requests, want)
+		}
+		requests = nil
+	}
+
+	get("/m/@v/list")
+	get("/m/@v/v1.0.0.mod")
+	get("/m/@v/list")
+	check("/m/@v/list", "/m/@v/v1.0.0.mod")
+
+	// A list expires in an hour, a go.mod file in a month.
+	now = now.Add(2 * time.Hour)
+	get("/m/@v/list")
+	get("/m/@v/v1.0.0.mod")
+	check("/m/@v/list")
+
+	// An expired go.mod file is revalidated.
+	now = now.Add(31 * 24 * time.Hour)
+	get("/m/@v/v1.0.0.mod")
+	get("/m/@v/v1.0.0.mod")
+	check("/m/@v/v1.0.0.mod")
+
+	// Negative responses are cached too.
+	get("/missing/@v/list")
+	get("/missing/@v/list")
+	check("/missing/@v/list")
+
+	// Each 200 entry is 104 bytes, so the second info file evicts the
+	// least recently used entry, the list.
+	now = now.Add(time.Minute)
+	get("/m/@v/v1.0.0.info")
+	get("/n/@v/v1.0.0.info")
+	check("/m/@v/v1.0.0.info", "/n/@v/v1.0.0.info")
+	es, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	var size int64
+	for _, e := range es {
+		keys = append(keys, strings.TrimPrefix(e.Key, srv.URL))
+		size += e.Size
+	}
+	if want := "/n/@v/v1.0.0.info /m/@v/v1.0.0.info /missing/@v/list /m/@v/v1.0.0.mod"; strings.Join(keys, " ") != want {
+		t.Errorf("got entries %v, want %s", keys, want)
+	}
+	if size > 350 {
+		t.Errorf("size %d is over the maximum", size)
+	}
+
+	// The index is reconciled with the files when the cache is reopened.
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, httputil.CacheFileName(srv.URL+"/o/@v/list")), []byte("200\nv1.0.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, httputil.CacheFileName(srv.URL+"/missing/@v/list"))); err != nil {
+		t.Fatal(err)
+	}
+	c2 := New(dir, Options{Now: func() time.Time { return now }})
+	es, err = c2.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]Kind{}
+	for _, e := range es {
+		kinds[strings.TrimPrefix(e.Key, srv.URL)] = e.Kind
+	}
+	want := map[string]Kind{
+		"/n/@v/v1.0.0.info": Info,
+		"/m/@v/v1.0.0.info": Info,
+		"/m/@v/v1.0.0.mod":  Mod,
+		"/o/@v/list":        List,
+	}
+	if len(kinds) != len(want) {
+		t.Errorf("after reopening, got entries %v, want %v", kinds, want)
+	}
+	for k, w := range want {
+		if kinds[k] != w {
+			t.Errorf("after reopening, %s has kind %q, want %q", k, kinds[k], w)
+		}
+	}
+
+	// Two days later, the info files have expired, and so has the list, which
+	// was stored when its file was written. The go.mod file can be revalidated.
+	now = now.Add(48 * time.Hour)
+	res, err := c2.Prune(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Expired != 3 || res.Left != 104 {
+		t.Errorf("Prune: got %+v, want 3 expired and 104 bytes left", res)
+	}
+	es, err = c2.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 || es[0].Kind != Mod {
+		t.Errorf("after pruning, got %v, want only the go.mod file", es)
+	}
+}
+
+func TestPruneSize(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	c := New(dir, Options{Now: func() time.Time { return now }})
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a/@v/v1.0.0.mod", "b/@v/v1.0.0.mod", "c/@v/v1.0.0.mod"} {
+		now = now.Add(time.Second)
+		if err := c.put(key, 200, []byte(strings.Repeat("x", 96)), httputil.Validators{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a is used, so b is the least recently used.
+	if err := c.touch("a/@v/v1.0.0.mod", false); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Prune(150, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (PruneResult{Evicted: 2, Bytes: 200, Left: 100}); res != want {
+		t.Errorf("dry run: got %+v, want %+v", res, want)
+	}
+	res, err = c.Prune(250, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (PruneResult{Evicted: 1, Bytes: 100, Left: 200}); res != want {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+	es, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range es {
+		keys = append(keys, e.Key)
+	}
+	if want := "a/@v/v1.0.0.mod c/@v/v1.0.0.mod"; strings.Join(keys, " ") != want {
+		t.Errorf("got %v, want %s", keys, want)
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/jba/go-ecosystem/internal/httputil"
+)
+
+// Transport returns an [http.RoundTripper] that serves GET requests from
+// the cache while they are fresh, and otherwise sends them with base,
+// caching the responses. An expired response with validators is
+// revalidated with a conditional request. If base is nil,
+// [http.DefaultTransport] is used.
+func (c *Cache) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{c, base}
+}
+
+type transport struct {
+	c    *Cache
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "" && req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	if err := t.c.load(); err != nil {
+		return nil, err
+	}
+	key := req.URL.String()
+	e, body, err := t.c.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && !t.c.Expired(*e, t.c.opts.Now()) {
+		if err := t.c.touch(key, false); err != nil {
+			return nil, err
+		}
+		return httputil.CachedResponse(req, e.Status, body), nil
+	}
+
+	if e != nil && e.Status == http.StatusOK && !e.Validators.IsZero() {
+		req = req.Clone(req.Context())
+		httputil.SetConditional(req, e.Validators)
+	} else {
+		e = nil
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && httputil.IsNotModified(resp) {
+		resp.Body.Close()
+		if err := t.c.touch(key, true); err != nil {
+			return nil, err
+		}
+		return httputil.CachedResponse(req, e.Status, body), nil
+	}
+	if t.c.TTL(KindOf(key), resp.StatusCode) <= 0 {
+		return resp, nil
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var vals httputil.Validators
+	if resp.StatusCode == http.StatusOK {
+		vals = httputil.ValidatorsFrom(resp)
+	}
+	if err := t.c.put(key, resp.StatusCode, body, vals); err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
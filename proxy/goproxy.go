@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/module"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+)
+
+// ErrOff is returned for a request that reaches "off" in the proxy list.
+var ErrOff = errors.New("module lookup disabled by GOPROXY=off")
+
+// ErrDirect is returned for a request that reaches "direct" in the proxy list,
+// or for a module that matches the no-proxy patterns. This package only talks
+// to proxies; it cannot fetch modules from their version control systems.
+var ErrDirect = errors.New("direct module fetches are not supported")
+
+// A proxyEntry is an element of a proxy list.
+type proxyEntry struct {
+	url string // or "off" or "direct"
+	// fallBackOnError means that any error from url, not just 404 or 410,
+	// moves on to the next entry. It is set for entries followed by "|".
+	fallBackOnError bool
+}
+
+// parseProxyList parses a list in the syntax of GOPROXY: URLs, "off" and
+// "direct", separated by commas or pipes. After a comma, the next entry is
+// tried only if the previous one responded 404 or 410; after a pipe, it is
+// tried after any error. An empty list is the default proxy.
+func parseProxyList(list string) []proxyEntry {
+	var ps []proxyEntry
+	for list != "" {
+		entry, sep := list, byte(0)
+		if i := strings.IndexAny(list, ",|"); i >= 0 {
+			entry, sep, list = list[:i], list[i], list[i+1:]
+		} else {
+			list = ""
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ps = append(ps, proxyEntry{
+			url:             strings.TrimSuffix(entry, "/"),
+			fallBackOnError: sep == '|',
+		})
+	}
+	if len(ps) == 0 {
+		ps = []proxyEntry{{url: defaultURL}}
+	}
+	return ps
+}
+
+// URL returns the proxy list of c, in the syntax of GOPROXY.
+func (c *Client) URL() string {
+	var b strings.Builder
+	for i, p := range c.proxies {
+		if i > 0 {
+			if c.proxies[i-1].fallBackOnError {
+				b.WriteByte('|')
+			} else {
+				b.WriteByte(',')
+			}
+		}
+		b.WriteString(p.url)
+	}
+	return b.String()
+}
+
+// get fetches rel, the escaped path of a request for the module modPath,
+// with d. See [Client.each] for the proxies it tries.
+func (c *Client) get(ctx context.Context, d httputil.Doer, modPath, rel string) ([]byte, error) {
+	var data []byte
+	err := c.each(ctx, modPath, rel, func(url string) (bool, error) {
+		var err error
+		data, err = do(ctx, d, url)
+		return false, err
+	})
+	return data, err
+}
+
+// each calls try with the URL for rel at each proxy in turn, until try
+// succeeds or a failure ends the search. It ends if the failure isn't a 404
+// or 410 and the proxy isn't followed by "|", or if try returns true, meaning
+// it has committed to the response, for example by writing part of it.
+// If every proxy fails, the error is from the last one tried.
+func (c *Client) each(ctx context.Context, modPath, rel string, try func(url string) (committed bool, err error)) error {
+	if c.noProxy != "" && module.MatchPrefixPatterns(c.noProxy, modPath) {
+		return fmt.Errorf("%s matches GONOPROXY: %w", modPath, ErrDirect)
+	}
+	var err error
+	for _, p := range c.proxies {
+		switch p.url {
+		case "off":
+			return ErrOff
+		case "direct":
+			return ErrDirect
+		}
+		var committed bool
+		committed, err = try(p.url + rel)
+		if err == nil || committed || ctx.Err() != nil {
+			return err
+		}
+		if !p.fallBackOnError && !errors.Is(err, errs.NotFound) && !errors.Is(err, errs.Gone) {
+			return err
+		}
+	}
+	return err
+}
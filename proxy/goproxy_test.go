@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+func TestParseProxyList(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", defaultURL},
+		{"https://a.example.com/", "https://a.example.com"},
+		{"https://a.example.com,https://b.example.com|direct", "https://a.example.com,https://b.example.com|direct"},
+		{" https://a.example.com ,, off", "https://a.example.com,off"},
+	} {
+		c := New(WithURL(test.in))
+		if got := c.URL(); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestProxyFallback(t *testing.T) {
+	ctx := context.Background()
+	var requests []string
+	server := func(name string, status int) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, name)
+			if status != http.StatusOK {
+				http.Error(w, "no", status)
+				return
+			}
+			fmt.Fprintln(w, "v1.0.0")
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	ok := server("ok", http.StatusOK)
+	notFound := server("notfound", http.StatusNotFound)
+	gone := server("gone", http.StatusGone)
+	broken := server("broken", http.StatusInternalServerError)
+	// Nothing listens on a closed server's address.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	for _, test := range []struct {
+		list    string
+		want    []string // servers that received requests
+		wantErr error
+	}{
+		{ok, []string{"ok"}, nil},
+		{notFound + "," + gone + "," + ok, []string{"notfound", "gone", "ok"}, nil},
+		{broken + "," + ok, []string{"broken"}, errs.Temporary},
+		{broken + "|" + ok, []string{"broken", "ok"}, nil},
+		{down.URL + "|" + ok, []string{"ok"}, nil},
+		{notFound + "," + gone, []string{"notfound", "gone"}, errs.Gone},
+		{notFound + ",off," + ok, []string{"notfound"}, ErrOff},
+		{"direct," + ok, nil, ErrDirect},
+	} {
+		requests = nil
+		c := New(WithURL(test.list), WithMaxQPS(1000), WithRetry(RetryPolicy{MaxAttempts: 1}))
+		got, err := c.List(ctx, "example.com/m")
+		name := strings.NewReplacer(ok, "ok", notFound, "notfound", gone, "gone", broken, "broken", down.URL, "down").Replace(test.list)
+		if test.wantErr == nil {
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+			} else if !slices.Equal(got, []string{"v1.0.0"}) {
+				t.Errorf("%s: got %v", name, got)
+			}
+		} else if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", name, err, test.wantErr)
+		}
+		if !slices.Equal(requests, test.want) {
+			t.Errorf("%s: requests went to %v, want %v", name, requests, test.want)
+		}
+	}
+
+	c := New(WithURL(ok), WithNoProxy("example.com/private,*.corp.example.com"))
+	for _, path := range []string{"example.com/private/m", "git.corp.example.com/m"} {
+		if _, err := c.List(ctx, path); !errors.Is(err, ErrDirect) {
+			t.Errorf("%s: got %v, want ErrDirect", path, err)
+		}
+	}
+	if _, err := c.List(ctx, "example.com/public"); err != nil {
+		t.Errorf("example.com/public: %v", err)
+	}
+}
@@ -1,71 +1,271 @@
 // Package proxy supports queries on the Go module proxy.
 // It only accesses cached modules, and throttles requests to a configured
 // QPS.
+//
+// A client may use a list of proxies, in the syntax of GOPROXY, falling
+// back from one to the next as the go command does.
+//
+// The package-level functions use the client returned by [Default].
+// Configure it with the Set functions before making any requests;
+// they must not be called concurrently with requests.
 package proxy
 
 import (
 	"archive/zip"
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
-	"net/url"
-	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
-	"time"
 
 	"golang.org/x/mod/module"
-	"golang.org/x/time/rate"
+	"golang.org/x/mod/semver"
 
 	"github.com/jba/go-ecosystem/internal/errs"
 	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/logging"
+	"github.com/jba/go-ecosystem/proxy/cache"
 )
 
 const (
-	proxyURL      = "https://proxy.golang.org/cached-only"
+	defaultURL    = "https://proxy.golang.org/cached-only"
 	defaultMaxQPS = 100
 	defaultBurst  = 10
 )
 
-var (
-	ncalls  atomic.Int64
-	mu      sync.Mutex
-	maxQPS  int
-	limiter *rate.Limiter
-	start   time.Time
-)
+// newLimitedClient returns a rate-limited client that sends requests with hc,
+// adding the given headers. If hc is nil, [httputil.DefaultClient] is used.
+func newLimitedClient(hc *http.Client, maxQPS int, header http.Header) *httputil.LimitedClient {
+	c := httputil.NewLimitedClient(hc, maxQPS, defaultBurst)
+	c.AddHooks(
+		// Setting this header to true prevents the proxy from fetching uncached
+		// modules.
+		httputil.SetHeader("Disable-Module-Fetch", "true"),
+		httputil.SetHeader("User-Agent", "jba work"),
+		httputil.Hooks{
+			BeforeRequest: func(req *http.Request) error {
+				ctx := req.Context()
+				logging.FromContext(ctx).DebugContext(ctx, "proxy request", "url", req.URL.Redacted())
+				return nil
+			},
+		})
+	for key, values := range header {
+		for _, v := range values {
+			c.AddHooks(httputil.Hooks{
+				BeforeRequest: func(req *http.Request) error {
+					req.Header.Add(key, v)
+					return nil
+				},
+			})
+		}
+	}
+	return c
+}
 
-func SetMaxQPS(qps int) {
-	mu.Lock()
-	defer mu.Unlock()
-	maxQPS = qps
-	limiter = rate.NewLimiter(rate.Every(time.Second/time.Duration(qps)), defaultBurst)
+// A Client makes requests to a module proxy. Each Client has its own rate
+// limit, request statistics and cache, so clients for different proxies,
+// or with different limits, can be used together.
+//
+// The package-level functions use a default client; see [Default].
+type Client struct {
+	proxies     []proxyEntry
+	noProxy     string // GONOPROXY patterns
+	concurrency int    // maximum requests of a batch made at once
+	hc          *http.Client
+	lc          *httputil.LimitedClient
+	retry       *httputil.RetryTransport // retries requests sent with lc
+	uncached    httputil.Doer
+	cache       *cache.Cache  // nil if responses aren't cached
+	cached      httputil.Doer // for requests whose responses may be cached
+}
+
+// An Option configures a [Client].
+type Option func(*options)
+
+type options struct {
+	url         string
+	noProxy     string
+	client      *http.Client
+	header      http.Header
+	maxQPS      int
+	cache       *cache.Cache
+	retry       RetryPolicy
+	concurrency int
+}
+
+// WithURL sets the URL of the proxy, or a list of proxies in the syntax of
+// GOPROXY, like "https://corp.example.com|https://proxy.golang.org,off".
+// Like the go command, the client moves on to the next proxy in the list
+// after a 404 or 410 response, or after any error if the proxy is followed
+// by a "|". Requests that reach "off" fail with [ErrOff], and requests that
+// reach "direct" fail with [ErrDirect].
+// The default is https://proxy.golang.org/cached-only.
+func WithURL(u string) Option {
+	return func(o *options) { o.url = u }
+}
+
+// WithNoProxy sets comma-separated glob patterns of module path prefixes,
+// in the syntax of GONOPROXY, for modules that should not be fetched from a
+// proxy. Requests for them fail with [ErrDirect].
+func WithNoProxy(patterns string) Option {
+	return func(o *options) { o.noProxy = patterns }
+}
+
+// WithHTTPClient sends requests with c, whose transport may add tracing
+// or an HTTP proxy. The default is [httputil.DefaultClient].
+// Requests are rate-limited and retried in any case; see [WithRetry].
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) { o.client = c }
+}
+
+// WithHeader adds a header to every request.
+func WithHeader(key, value string) Option {
+	return func(o *options) { o.header.Add(key, value) }
 }
 
-func init() {
-	SetMaxQPS(defaultMaxQPS)
+// WithMaxQPS sets the maximum rate of requests. The default is 100.
+func WithMaxQPS(qps int) Option {
+	return func(o *options) { o.maxQPS = qps }
 }
 
-var Debug = false
+// WithCacheDir caches responses in dir, with the default cache options.
+// By default, responses aren't cached.
+// Zips and resolved queries are never cached.
+func WithCacheDir(dir string) Option {
+	return func(o *options) { o.cache = cache.New(dir, cache.Options{}) }
+}
+
+// WithCache caches responses in c.
+func WithCache(c *cache.Cache) Option {
+	return func(o *options) { o.cache = c }
+}
+
+// New returns a Client configured by opts.
+func New(opts ...Option) *Client {
+	o := &options{
+		url:         defaultURL,
+		header:      http.Header{},
+		maxQPS:      defaultMaxQPS,
+		concurrency: defaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	c := &Client{
+		proxies:     parseProxyList(o.url),
+		noProxy:     o.noProxy,
+		concurrency: o.concurrency,
+		hc:          cmp.Or(o.client, httputil.DefaultClient),
+		lc:          newLimitedClient(o.client, o.maxQPS, o.header),
+	}
+	// Each attempt of a retried request waits for the rate limiter.
+	c.retry = &httputil.RetryTransport{Base: c.lc}
+	c.setRetry(o.retry)
+	c.uncached = c.httpClient(c.retry)
+	c.setCache(o.cache)
+	return c
+}
+
+var defaultClient = New()
+
+// Default returns the client used by the package-level functions.
+// It is configured by [SetURL], [SetNoProxy], [SetMaxQPS], [SetRetry],
+// [SetConcurrency] and [SetCache].
+func Default() *Client {
+	return defaultClient
+}
+
+// SetURL sets the URL or list of proxies of the default client.
+// See [WithURL].
+func SetURL(u string) {
+	defaultClient.proxies = parseProxyList(u)
+}
+
+// SetNoProxy sets the no-proxy patterns of the default client.
+// See [WithNoProxy].
+func SetNoProxy(patterns string) {
+	defaultClient.noProxy = patterns
+}
 
+// SetMaxQPS sets the maximum rate of requests of the default client.
+func SetMaxQPS(qps int) {
+	defaultClient.SetMaxQPS(qps)
+}
+
+// QPS returns the average rate of requests of the default client.
 func QPS() float64 {
-	mu.Lock()
-	defer mu.Unlock()
-	return float64(ncalls.Load()) / time.Since(start).Seconds()
+	return defaultClient.QPS()
 }
 
+// ResetQPS resets the statistics used by QPS.
 func ResetQPS() {
-	ncalls.Store(0)
-	mu.Lock()
-	start = time.Time{}
-	mu.Unlock()
+	defaultClient.ResetQPS()
+}
+
+// Stats returns cumulative statistics of the default client's requests.
+func Stats() httputil.LimitStats {
+	return defaultClient.Stats()
+}
+
+// SetCacheDir enables caching of the default client's responses in dir,
+// with the default cache options, or disables caching if dir is empty.
+func SetCacheDir(dir string) {
+	var c *cache.Cache
+	if dir != "" {
+		c = cache.New(dir, cache.Options{})
+	}
+	defaultClient.setCache(c)
+}
+
+// SetCache makes the default client cache its responses in c,
+// or disables caching if c is nil.
+func SetCache(c *cache.Cache) {
+	defaultClient.setCache(c)
+}
+
+// SetMaxQPS sets the maximum rate of requests to the proxy.
+func (c *Client) SetMaxQPS(qps int) {
+	c.lc.SetMaxQPS(qps)
+}
+
+// QPS returns the average rate of requests to the proxy.
+func (c *Client) QPS() float64 {
+	return c.lc.QPS()
+}
+
+// ResetQPS resets the statistics used by QPS.
+func (c *Client) ResetQPS() {
+	c.lc.ResetQPS()
+}
+
+// Stats returns cumulative statistics of requests to the proxy.
+func (c *Client) Stats() httputil.LimitStats {
+	return c.lc.Stats()
+}
+
+// Cache returns the cache of c's responses, or nil if there is none.
+func (c *Client) Cache() *cache.Cache {
+	return c.cache
+}
+
+func (c *Client) setCache(ca *cache.Cache) {
+	c.cache = ca
+	if ca == nil {
+		c.cached = c.uncached
+		return
+	}
+	// Cached responses are served without waiting for the rate limiter.
+	c.cached = c.httpClient(ca.Transport(c.retry))
+}
+
+// httpClient returns a copy of c's HTTP client that uses t.
+func (c *Client) httpClient(t http.RoundTripper) *http.Client {
+	hc := *c.hc
+	hc.Transport = t
+	return &hc
 }
 
 type InfoEntry struct {
@@ -75,39 +275,103 @@ type InfoEntry struct {
 }
 
 type Origin struct {
-	VCS  string
-	URL  string
-	Ref  string
-	Hash string
+	VCS    string
+	URL    string
+	Subdir string
+	Ref    string
+	Hash   string
+}
+
+// Info calls [Client.Info] on the default client.
+func Info(ctx context.Context, path, version string) (*InfoEntry, error) {
+	return defaultClient.Info(ctx, path, version)
+}
+
+// Latest calls [Client.Latest] on the default client.
+func Latest(ctx context.Context, path string) (string, error) {
+	return defaultClient.Latest(ctx, path)
+}
+
+// Resolve calls [Client.Resolve] on the default client.
+func Resolve(ctx context.Context, path, query string) (*InfoEntry, error) {
+	return defaultClient.Resolve(ctx, path, query)
+}
+
+// Mod calls [Client.Mod] on the default client.
+func Mod(ctx context.Context, path, version string) ([]byte, error) {
+	return defaultClient.Mod(ctx, path, version)
+}
+
+// List calls [Client.List] on the default client.
+func List(ctx context.Context, path string) ([]string, error) {
+	return defaultClient.List(ctx, path)
+}
+
+// Zip calls [Client.Zip] on the default client.
+func Zip(ctx context.Context, path, version string) (*zip.Reader, error) {
+	return defaultClient.Zip(ctx, path, version)
+}
+
+// ZipTo calls [Client.ZipTo] on the default client.
+func ZipTo(ctx context.Context, path, version string, w io.Writer) (int64, error) {
+	return defaultClient.ZipTo(ctx, path, version, w)
+}
+
+// ZipData calls [Client.ZipData] on the default client.
+func ZipData(ctx context.Context, path, version string) ([]byte, error) {
+	return defaultClient.ZipData(ctx, path, version)
 }
 
-func Info(ctx context.Context, path, version string) (_ *InfoEntry, err error) {
-	debugf("Info %s %s", path, version)
+func (c *Client) Info(ctx context.Context, path, version string) (_ *InfoEntry, err error) {
+	debug(ctx, "Info", "path", path, "version", version)
 	defer errs.Wrap(&err, "proxy.Info(%q, %q)", path, version)
-	url, err := proxyVersionURL(path, version, ".info")
+	rel, err := versionPath(path, version, ".info")
 	if err != nil {
 		return nil, err
 	}
-	return fetchInfoEntry(ctx, url)
+	return c.fetchInfoEntry(ctx, path, rel)
 }
 
-func Latest(ctx context.Context, path string) (_ string, err error) {
-	debugf("Latest %s", path)
+func (c *Client) Latest(ctx context.Context, path string) (_ string, err error) {
+	debug(ctx, "Latest", "path", path)
 	defer errs.Wrap(&err, "proxy.Latest(%q)", path)
-	url, err := proxyPathURL(path)
+	rel, err := escapedPath(path)
 	if err != nil {
 		return "", err
 	}
-	url += "/@latest"
-	entry, err := fetchInfoEntry(ctx, url)
+	entry, err := c.fetchInfoEntry(ctx, path, rel+"/@latest")
 	if err != nil {
 		return "", err
 	}
 	return entry.Version, nil
 }
 
-func fetchInfoEntry(ctx context.Context, url string) (*InfoEntry, error) {
-	data, err := fetchCached(ctx, url)
+// Resolve resolves a version query for the module at path, like the go
+// command does for "path@query".
+// The query can be a version, "latest", a branch name or a commit hash prefix;
+// the proxy turns the last two into pseudo-versions. Resolved queries are not
+// cached, since the commit a branch refers to changes over time.
+//
+// The proxy usually cannot resolve a branch or hash that it has not seen before
+// without fetching from the origin, which it does not do for this package.
+func (c *Client) Resolve(ctx context.Context, path, query string) (_ *InfoEntry, err error) {
+	debug(ctx, "Resolve", "path", path, "query", query)
+	defer errs.Wrap(&err, "proxy.Resolve(%q, %q)", path, query)
+	if query == "latest" {
+		v, err := c.Latest(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		return c.Info(ctx, path, v)
+	}
+	if module.CanonicalVersion(query) == query {
+		return c.Info(ctx, path, query)
+	}
+	rel, err := versionPath(path, query, ".info")
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.fetch(ctx, path, rel)
 	if err != nil {
 		return nil, err
 	}
@@ -115,62 +379,110 @@ func fetchInfoEntry(ctx context.Context, url string) (*InfoEntry, error) {
 	if err := json.Unmarshal(data, &res); err != nil {
 		return nil, err
 	}
+	if !semver.IsValid(res.Version) {
+		return nil, fmt.Errorf("proxy returned invalid version %q", res.Version)
+	}
 	return &res, nil
 }
 
-func Mod(ctx context.Context, path, version string) (_ []byte, err error) {
-	debugf("Mod %s %s", path, version)
+// SplitQuery splits an argument of the form "path@query" into its parts.
+// If there is no "@", the query is "latest".
+func SplitQuery(arg string) (path, query string) {
+	path, query, found := strings.Cut(arg, "@")
+	if !found || query == "" {
+		query = "latest"
+	}
+	return path, query
+}
+
+func (c *Client) fetchInfoEntry(ctx context.Context, modPath, rel string) (*InfoEntry, error) {
+	data, err := c.fetchCached(ctx, modPath, rel)
+	if err != nil {
+		return nil, err
+	}
+	var res InfoEntry
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) Mod(ctx context.Context, path, version string) (_ []byte, err error) {
+	debug(ctx, "Mod", "path", path, "version", version)
 	defer errs.Wrap(&err, "proxy.Mod(%q, %q)", path, version)
-	url, err := proxyVersionURL(path, version, ".mod")
+	rel, err := versionPath(path, version, ".mod")
 	if err != nil {
 		return nil, err
 	}
-	return fetchCached(ctx, url)
+	return c.fetchCached(ctx, path, rel)
 }
 
-func List(ctx context.Context, path string) (_ []string, err error) {
-	debugf("List %s", path)
+func (c *Client) List(ctx context.Context, path string) (_ []string, err error) {
+	debug(ctx, "List", "path", path)
 	defer errs.Wrap(&err, "proxy.List(%q)", path)
-	url, err := proxyPathURL(path)
+	rel, err := escapedPath(path)
 	if err != nil {
 		return nil, err
 	}
-	url += "/@v/list"
-	data, err := fetchCached(ctx, url)
+	data, err := c.fetchCached(ctx, path, rel+"/@v/list")
 	if err != nil {
 		return nil, err
 	}
 	return strings.Fields(string(data)), nil
 }
 
-func Zip(ctx context.Context, path, version string) (_ *zip.Reader, err error) {
+func (c *Client) Zip(ctx context.Context, path, version string) (_ *zip.Reader, err error) {
 	defer errs.Wrap(&err, "proxy.Zip(%q, %q)", path, version)
 
-	data, err := ZipData(ctx, path, version)
+	data, err := c.ZipData(ctx, path, version)
 	if err != nil {
 		return nil, err
 	}
 	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
 }
 
-func ZipData(ctx context.Context, path, version string) ([]byte, error) {
-	url, err := proxyVersionURL(path, version, ".zip")
+// ZipTo writes the zip of the module version to w, without holding it in
+// memory, and returns the number of bytes written. If it fails after writing
+// some of the zip, no other proxy in the list is tried.
+func (c *Client) ZipTo(ctx context.Context, path, version string, w io.Writer) (n int64, err error) {
+	debug(ctx, "ZipTo", "path", path, "version", version)
+	defer errs.Wrap(&err, "proxy.ZipTo(%q, %q)", path, version)
+	rel, err := versionPath(path, version, ".zip")
+	if err != nil {
+		return 0, err
+	}
+	err = c.each(ctx, path, rel, func(url string) (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return false, err
+		}
+		n, err = httputil.DoStream(req, w, nil, httputil.WithClient(c.uncached))
+		return n > 0, err
+	})
+	return n, err
+}
+
+func (c *Client) ZipData(ctx context.Context, path, version string) ([]byte, error) {
+	rel, err := versionPath(path, version, ".zip")
 	if err != nil {
 		return nil, err
 	}
-	return fetch(ctx, url)
+	return c.fetch(ctx, path, rel)
 }
 
-func proxyPathURL(modPath string) (string, error) {
+// escapedPath returns the part of a proxy URL for the module modPath.
+func escapedPath(modPath string) (string, error) {
 	epath, err := module.EscapePath(modPath)
 	if err != nil {
 		return "", err
 	}
-	return proxyURL + "/" + epath, nil
+	return "/" + epath, nil
 }
 
-func proxyVersionURL(modPath, version, suffix string) (string, error) {
-	u, err := proxyPathURL(modPath)
+// versionPath returns the part of a proxy URL for a file of the given version
+// of the module modPath.
+func versionPath(modPath, version, suffix string) (string, error) {
+	u, err := escapedPath(modPath)
 	if err != nil {
 		return "", err
 	}
@@ -181,88 +493,31 @@ func proxyVersionURL(modPath, version, suffix string) (string, error) {
 	return u + "/@v/" + v + suffix, nil
 }
 
-func fetch(ctx context.Context, url string) ([]byte, error) {
-	mu.Lock()
-	lim := limiter
-	if start.IsZero() {
-		start = time.Now()
-	}
-	mu.Unlock()
-	if err := lim.Wait(ctx); err != nil {
-		return nil, err
-	}
-	if Debug {
-		log.Printf("proxy: Get %s", url)
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	// Setting this header to true prevents the proxy from fetching uncached
-	// modules.
-	req.Header.Set("Disable-Module-Fetch", "true")
-	req.Header.Set("User-Agent", "jba work")
-	ncalls.Add(1)
-	return httputil.DoReadBody(req)
+// fetch fetches rel, for the module modPath, from the proxies, without caching.
+func (c *Client) fetch(ctx context.Context, modPath, rel string) ([]byte, error) {
+	return c.get(ctx, c.uncached, modPath, rel)
 }
 
-var (
-	cacheEnabled = false
-	cacheDir     = filepath.Join(os.TempDir(), "goproxy-cache")
-)
-
-func init() {
-	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
-		log.Fatal(err)
-	}
+// fetchCached fetches rel, for the module modPath, from the proxies, using the
+// cache if there is one.
+func (c *Client) fetchCached(ctx context.Context, modPath, rel string) ([]byte, error) {
+	return c.get(ctx, c.cached, modPath, rel)
 }
 
-var cacheTTL = 24 * time.Hour
-
-func fetchCached(ctx context.Context, surl string) ([]byte, error) {
-	filename := filepath.Join(cacheDir, url.PathEscape(surl))
-	if cacheEnabled {
-		finfo, fetchErr := os.Stat(filename)
-		if fetchErr == nil && time.Since(finfo.ModTime()) < cacheTTL {
-			data, err := os.ReadFile(filename)
-			if err != nil {
-				return nil, err
-			}
-			if len(data) < 4 {
-				return nil, errors.New("contents too short")
-			}
-			status, err := strconv.Atoi(string(data[:3]))
-			if err != nil {
-				return nil, err
-			}
-			if status == 200 {
-				return data[4:], nil
-			}
-			return nil, &httputil.HTTPError{Status: status}
-		}
-	}
-	var fileBytes []byte
-	bytes, fetchErr := fetch(ctx, surl)
-	if fetchErr != nil {
-		var herr *httputil.HTTPError
-		if errors.As(fetchErr, &herr) {
-			fileBytes = fmt.Appendf(nil, "%d\n", herr.Status)
-		} else {
-			return nil, fetchErr
-		}
-	} else {
-		fileBytes = append([]byte("200\n"), bytes...)
+func do(ctx context.Context, c httputil.Doer, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
 	}
-	if cacheEnabled {
-		if err := os.WriteFile(filename, fileBytes, 0o644); err != nil {
-			return nil, err
-		}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
 	}
-	return bytes, fetchErr
+	return httputil.ReadBody(resp)
 }
 
-var debugf func(format string, args ...any) = func(format string, args ...any) {}
-
-func logDebugf(format string, args ...any) {
-	log.Printf("proxy: "+format, args...)
+// debug logs a call to op at debug level, using the logger in ctx.
+// See [logging.FromContext].
+func debug(ctx context.Context, op string, args ...any) {
+	logging.FromContext(ctx).DebugContext(ctx, "proxy."+op, args...)
 }
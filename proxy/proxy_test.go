@@ -1,10 +1,21 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/logging"
+	"golang.org/x/mod/module"
 )
 
 var live = flag.Bool("live", false, "run tests that make live network requests")
@@ -21,3 +32,170 @@ func TestList(t *testing.T) {
 		fmt.Printf("%d: %q\n", i, g)
 	}
 }
+
+func TestResolve(t *testing.T) {
+	if !*live {
+		t.Skip("skipping live test; use -live to run")
+	}
+	got, err := Resolve(context.Background(), "golang.org/x/mod", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !module.IsPseudoVersion(got.Version) {
+		t.Errorf("got %q, want a pseudo-version", got.Version)
+	}
+}
+
+func TestSplitQuery(t *testing.T) {
+	for _, test := range []struct {
+		in, path, query string
+	}{
+		{"example.com/m", "example.com/m", "latest"},
+		{"example.com/m@", "example.com/m", "latest"},
+		{"example.com/m@master", "example.com/m", "master"},
+		{"example.com/m@v1.2.3", "example.com/m", "v1.2.3"},
+	} {
+		path, query := SplitQuery(test.in)
+		if path != test.path || query != test.query {
+			t.Errorf("SplitQuery(%q) = (%q, %q), want (%q, %q)", test.in, path, query, test.path, test.query)
+		}
+	}
+}
+
+func TestDebugLogging(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "v1.0.0")
+	}))
+	defer srv.Close()
+	defer SetURL(defaultURL)
+	SetURL(srv.URL)
+
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx := logging.NewContext(context.Background(), l)
+	if _, err := List(ctx, "example.com/m"); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{"msg=proxy.List path=example.com/m", `msg="proxy request" url=` + srv.URL + "/example.com/m/@v/list"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	var gotHeader http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		if r.URL.Path != "/example.com/m/@v/list" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "v1.0.0\nv1.1.0")
+	}))
+	defer srv.Close()
+
+	var nTrips int
+	hc := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		nTrips++
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	c := New(WithURL(srv.URL+"/"), WithHTTPClient(hc), WithHeader("X-Trace", "abc"))
+	got, err := c.List(context.Background(), "example.com/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v1.0.0", "v1.1.0"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if nTrips != 1 {
+		t.Errorf("transport called %d times, want 1", nTrips)
+	}
+	if g := gotHeader.Get("X-Trace"); g != "abc" {
+		t.Errorf("X-Trace header: got %q, want %q", g, "abc")
+	}
+	if g := gotHeader.Get("Disable-Module-Fetch"); g != "true" {
+		t.Errorf("Disable-Module-Fetch header: got %q, want %q", g, "true")
+	}
+	if _, err := c.Latest(context.Background(), "example.com/m"); !errors.Is(err, errs.NotFound) {
+		t.Errorf("Latest: got %v, want NotFound", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestIndependentClients(t *testing.T) {
+	ctx := context.Background()
+	var nReqs int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nReqs++
+		fmt.Fprintln(w, "v1.0.0")
+	}))
+	defer srv.Close()
+
+	cached := New(WithURL(srv.URL), WithCacheDir(t.TempDir()), WithMaxQPS(1000))
+	uncached := New(WithURL(srv.URL))
+	for range 2 {
+		if _, err := cached.List(ctx, "example.com/m"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := uncached.List(ctx, "example.com/m"); err != nil {
+		t.Fatal(err)
+	}
+	// The second request of the caching client is served from its cache.
+	if nReqs != 2 {
+		t.Errorf("server got %d requests, want 2", nReqs)
+	}
+	if got := cached.Stats().Requests; got != 1 {
+		t.Errorf("caching client made %d requests, want 1", got)
+	}
+	if got := uncached.Stats().Requests; got != 1 {
+		t.Errorf("other client made %d requests, want 1", got)
+	}
+	if uncached.Cache() != nil {
+		t.Error("uncached client has a cache")
+	}
+}
+
+func TestZipTo(t *testing.T) {
+	ctx := context.Background()
+	zipData := bytes.Repeat([]byte("zip"), 100_000)
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/good/example.com/m/@v/v1.0.0.zip", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, "good")
+		w.Write(zipData)
+	})
+	mux.HandleFunc("/truncated/example.com/m/@v/v1.0.0.zip", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, "truncated")
+		w.Header().Set("Content-Length", fmt.Sprint(len(zipData)))
+		w.Write(zipData[:1000])
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := New(WithURL(srv.URL+"/missing,"+srv.URL+"/good"), WithMaxQPS(1000))
+	n, err := c.ZipTo(ctx, "example.com/m", "v1.0.0", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(zipData)) || !bytes.Equal(buf.Bytes(), zipData) {
+		t.Errorf("got %d bytes, want %d", n, len(zipData))
+	}
+
+	// A partly written zip isn't completed from another proxy.
+	buf.Reset()
+	requests = nil
+	c = New(WithURL(srv.URL+"/truncated|"+srv.URL+"/good"), WithMaxQPS(1000))
+	if _, err := c.ZipTo(ctx, "example.com/m", "v1.0.0", &buf); err == nil {
+		t.Error("truncated zip: got nil error")
+	}
+	if want := []string{"truncated"}; !slices.Equal(requests, want) {
+		t.Errorf("got requests %v, want %v", requests, want)
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"cmp"
+	"time"
+)
+
+// A RetryPolicy says how a [Client] retries requests that fail with
+// transient errors: 429 and 5xx responses, and network errors like timeouts.
+// The wait between attempts grows exponentially, with jitter, unless the
+// proxy asks for a particular wait with a Retry-After header.
+// Zero fields have the values of [DefaultRetryPolicy].
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// One disables retries.
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry. It doubles for each
+	// later retry, up to MaxBackoff.
+	MinBackoff, MaxBackoff time.Duration
+	// MaxRetryAfter is the longest Retry-After wait that is honored.
+	// If the proxy asks for a longer one, the request fails.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of a Client unless
+// [WithRetry] says otherwise.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:   4,
+	MinBackoff:    500 * time.Millisecond,
+	MaxBackoff:    30 * time.Second,
+	MaxRetryAfter: 2 * time.Minute,
+}
+
+// WithRetry sets the retry policy of the client.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) { o.retry = p }
+}
+
+// SetRetry sets the retry policy of the default client.
+func SetRetry(p RetryPolicy) {
+	defaultClient.setRetry(p)
+}
+
+func (c *Client) setRetry(p RetryPolicy) {
+	d := DefaultRetryPolicy
+	c.retry.MaxAttempts = cmp.Or(p.MaxAttempts, d.MaxAttempts)
+	c.retry.MinBackoff = cmp.Or(p.MinBackoff, d.MinBackoff)
+	c.retry.MaxBackoff = cmp.Or(p.MaxBackoff, d.MaxBackoff)
+	c.retry.MaxRetryAfter = cmp.Or(p.MaxRetryAfter, d.MaxRetryAfter)
+}
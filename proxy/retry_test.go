@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	// Each response is the status at the index of the request, or
+	// the last one.
+	var statuses []int
+	var nReqs int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[min(nReqs, len(statuses)-1)]
+		nReqs++
+		switch status {
+		case http.StatusOK:
+			fmt.Fprintln(w, "v1.0.0")
+		case http.StatusTooManyRequests:
+			w.Header().Set("Retry-After", "0")
+			if r.URL.Path == "/example.com/slow/@v/list" {
+				w.Header().Set("Retry-After", "3600")
+			}
+			fallthrough
+		default:
+			http.Error(w, "no", status)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(WithURL(srv.URL), WithMaxQPS(1000), WithRetry(RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}))
+	for _, test := range []struct {
+		path     string
+		statuses []int
+		wantReqs int
+		wantErr  error
+	}{
+		{"example.com/m", []int{503, 429, 200}, 3, nil},
+		{"example.com/m", []int{502}, 3, errs.Temporary},
+		{"example.com/m", []int{404}, 1, errs.NotFound},
+		// The proxy asks for a longer wait than the policy allows.
+		{"example.com/slow", []int{429, 200}, 1, errs.Temporary},
+	} {
+		statuses = test.statuses
+		nReqs = 0
+		_, err := c.List(ctx, test.path)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%v: got %v, want %v", test.statuses, err, test.wantErr)
+		}
+		if nReqs != test.wantReqs {
+			t.Errorf("%v: got %d requests, want %d", test.statuses, nReqs, test.wantReqs)
+		}
+	}
+	// Every attempt is counted.
+	if got, want := c.Stats().Requests, int64(3+3+1+1); got != want {
+		t.Errorf("Stats().Requests = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/sumdb"
+)
+
+// VerifyZip calls [Client.VerifyZip] on the default client.
+func VerifyZip(ctx context.Context, path, version string) ([]byte, error) {
+	return defaultClient.VerifyZip(ctx, path, version)
+}
+
+// VerifyMod calls [Client.VerifyMod] on the default client.
+func VerifyMod(ctx context.Context, path, version string) ([]byte, error) {
+	return defaultClient.VerifyMod(ctx, path, version)
+}
+
+// VerifyZip is like [Client.ZipData], but before returning the zip it checks it
+// against the module's entry in the checksum database. If they don't
+// match, the error wraps [sumdb.ErrMismatch].
+// See the sumdb package for configuring the checksum database.
+func (c *Client) VerifyZip(ctx context.Context, path, version string) (_ []byte, err error) {
+	debug(ctx, "VerifyZip", "path", path, "version", version)
+	defer errs.Wrap(&err, "proxy.VerifyZip(%q, %q)", path, version)
+	data, err := c.ZipData(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if err := sumdb.VerifyZip(ctx, path, version, zr); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// VerifyMod is like [Client.Mod], but before returning the go.mod file it checks
+// it against the module's entry in the checksum database. If they don't
+// match, the error wraps [sumdb.ErrMismatch].
+func (c *Client) VerifyMod(ctx context.Context, path, version string) (_ []byte, err error) {
+	debug(ctx, "VerifyMod", "path", path, "version", version)
+	defer errs.Wrap(&err, "proxy.VerifyMod(%q, %q)", path, version)
+	gomod, err := c.Mod(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := sumdb.VerifyMod(ctx, path, version, gomod); err != nil {
+		return nil, err
+	}
+	return gomod, nil
+}
@@ -0,0 +1,93 @@
+package proxy_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/proxy"
+	"github.com/jba/go-ecosystem/sumdb"
+	xsumdb "golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	const (
+		path    = "example.com/m"
+		version = "v1.0.0"
+		gomod   = "module example.com/m\n"
+	)
+	zipData := corpustest.Zip(t, path, version, map[string]string{"go.mod": gomod})
+	zr, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipHash, err := sumdb.HashZip(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modHash, err := sumdb.HashMod([]byte(gomod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sumSrv := httptest.NewServer(xsumdb.NewServer(xsumdb.NewTestServer(skey, func(p, v string) ([]byte, error) {
+		if p != path || v != version {
+			return nil, fs.ErrNotExist
+		}
+		return fmt.Appendf(nil, "%s %s %s\n%s %s/go.mod %s\n", p, v, zipHash, p, v, modHash), nil
+	})))
+	defer sumSrv.Close()
+	sumdb.SetURL(sumSrv.URL)
+	sumdb.SetKey(vkey)
+	defer func() {
+		sumdb.SetURL("https://sum.golang.org")
+		sumdb.SetKey("sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8")
+	}()
+
+	servedMod := gomod
+	mux := http.NewServeMux()
+	mux.HandleFunc("/example.com/m/@v/v1.0.0.mod", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, servedMod)
+	})
+	mux.HandleFunc("/example.com/m/@v/v1.0.0.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zipData)
+	})
+	proxySrv := httptest.NewServer(mux)
+	defer proxySrv.Close()
+	defer proxy.SetURL("https://proxy.golang.org/cached-only")
+	proxy.SetURL(proxySrv.URL)
+
+	got, err := proxy.VerifyMod(ctx, path, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != gomod {
+		t.Errorf("proxy.VerifyMod: got %q, want %q", got, gomod)
+	}
+	got, err = proxy.VerifyZip(ctx, path, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, zipData) {
+		t.Error("proxy.VerifyZip returned different data")
+	}
+
+	servedMod = gomod + "go 1.21\n"
+	if _, err := proxy.VerifyMod(ctx, path, version); !errors.Is(err, sumdb.ErrMismatch) {
+		t.Errorf("altered go.mod: got %v, want ErrMismatch", err)
+	}
+}
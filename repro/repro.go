@@ -0,0 +1,269 @@
+// Package repro checks whether the module zips served by the proxy can be
+// reproduced from the modules' source repositories.
+//
+// For a module version, it clones the repository named by the proxy's
+// origin information at the recorded commit, builds a module zip with
+// [modzip.CreateFromVCS], and compares its hash with the hash of the
+// proxy's zip. A mismatch means the published code differs from the
+// repository, perhaps because a tag was moved after the proxy cached it.
+package repro
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/proxy"
+	"github.com/jba/go-ecosystem/sumdb"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+// A Result is the outcome of checking one module version,
+// as stored in the repro_checks table.
+type Result struct {
+	ModulePath   string
+	Version      string
+	RepoURL      string
+	Subdir       string // module directory in the repository
+	CommitHash   string
+	ProxyHash    string // go.sum hash of the proxy's zip
+	VCSHash      string // go.sum hash of the rebuilt zip
+	Reproducible bool
+	Diff         string // space-separated names of files that differ, at most maxDiff
+	Error        string // why the check couldn't be completed
+	Checked      string
+}
+
+// maxDiff is the maximum number of file names in Result.Diff.
+const maxDiff = 20
+
+// ErrNoOrigin is returned when the proxy doesn't say where a module
+// version came from.
+var ErrNoOrigin = errors.New("no git origin information")
+
+// Check checks path@version, cloning its repository into a temporary
+// directory under workDir, or the default temporary directory if workDir
+// is empty.
+//
+// Problems with the module, like a missing origin or an unreachable
+// repository, are recorded in the Error field of the result.
+// Check returns an error only for problems with the proxy or the local
+// system.
+func Check(ctx context.Context, workDir, path, version string) (_ *Result, err error) {
+	defer errs.Wrap(&err, "repro.Check(%s@%s)", path, version)
+	r := &Result{
+		ModulePath: path,
+		Version:    version,
+		Checked:    time.Now().UTC().Format(time.RFC3339),
+	}
+	info, err := proxy.Info(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	o := info.Origin
+	r.RepoURL, r.Subdir, r.CommitHash = o.URL, o.Subdir, o.Hash
+	data, err := proxy.ZipData(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	pzip, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if r.ProxyHash, err = sumdb.HashZip(pzip); err != nil {
+		return nil, err
+	}
+	if o.VCS != "git" || o.URL == "" || o.Hash == "" {
+		r.Error = ErrNoOrigin.Error()
+		return r, nil
+	}
+	vzip, err := Rebuild(ctx, workDir, module.Version{Path: path, Version: version}, o)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		r.Error = err.Error()
+		return r, nil
+	}
+	if r.VCSHash, err = sumdb.HashZip(vzip); err != nil {
+		return nil, err
+	}
+	r.Reproducible = r.VCSHash == r.ProxyHash
+	if !r.Reproducible {
+		diff, err := Compare(pzip, vzip)
+		if err != nil {
+			return nil, err
+		}
+		if len(diff) > maxDiff {
+			diff = diff[:maxDiff]
+		}
+		r.Diff = strings.Join(diff, " ")
+	}
+	return r, nil
+}
+
+// gitProtocols is the colon-separated list of URL schemes that Rebuild
+// fetches from, in the syntax of GIT_ALLOW_PROTOCOL.
+// Tests add "file".
+var gitProtocols = "https"
+
+// Rebuild fetches commit o.Hash of the git repository at o.URL into
+// a temporary directory under workDir, and returns the zip for mv built
+// from it.
+func Rebuild(ctx context.Context, workDir string, mv module.Version, o proxy.Origin) (_ *zip.Reader, err error) {
+	defer errs.Wrap(&err, "repro.Rebuild(%s)", mv)
+	if err := checkOrigin(o); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(workDir, "eco-repro-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if _, err := git(ctx, dir, "init", "-q"); err != nil {
+		return nil, err
+	}
+	// Most hosts allow fetching a commit by hash. If that fails,
+	// fetch the ref, which should still point to the commit.
+	if _, err := git(ctx, dir, "fetch", "-q", "--depth=1", "--", o.URL, o.Hash); err != nil {
+		if o.Ref == "" {
+			return nil, err
+		}
+		if _, err := git(ctx, dir, "fetch", "-q", "--depth=1", "--", o.URL, o.Ref); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := modzip.CreateFromVCS(&buf, mv, dir, o.Hash, o.Subdir); err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+// checkOrigin returns an error if o, which comes from the proxy, could make
+// git do anything but fetch from a remote repository: its URL must use an
+// allowed scheme, and its revisions must not look like options.
+func checkOrigin(o proxy.Origin) error {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(strings.Split(gitProtocols, ":"), u.Scheme) {
+		return fmt.Errorf("origin URL %q: scheme is not %s", o.URL, gitProtocols)
+	}
+	for _, rev := range []string{o.Hash, o.Ref} {
+		if strings.HasPrefix(rev, "-") {
+			return fmt.Errorf("bad origin revision %q", rev)
+		}
+	}
+	return nil
+}
+
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Never prompt for credentials, and don't let a URL from the proxy
+	// choose a transport like ext:: that runs commands.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+gitProtocols)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, bytes.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// Compare returns the sorted names of the files that are in only one of the
+// zips, or whose contents differ. Names are relative to the module root.
+func Compare(a, b *zip.Reader) ([]string, error) {
+	ca, err := contents(a)
+	if err != nil {
+		return nil, err
+	}
+	cb, err := contents(b)
+	if err != nil {
+		return nil, err
+	}
+	var diff []string
+	for name, da := range ca {
+		if db, ok := cb[name]; !ok || !bytes.Equal(da, db) {
+			diff = append(diff, name)
+		}
+	}
+	for name := range cb {
+		if _, ok := ca[name]; !ok {
+			diff = append(diff, name)
+		}
+	}
+	slices.Sort(diff)
+	return diff, nil
+}
+
+// contents returns the contents of the files in zr, keyed by their names
+// without the leading path@version directory.
+func contents(zr *zip.Reader) (map[string][]byte, error) {
+	m := map[string][]byte{}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		// Module paths can't contain "@", so the first "/" after it
+		// ends the path@version directory.
+		_, rest, _ := strings.Cut(f.Name, "@")
+		_, name, _ := strings.Cut(rest, "/")
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		m[name] = data
+	}
+	return m, nil
+}
+
+var resultCols = []string{
+	"module_path", "version", "repo_url", "subdir", "commit_hash", "proxy_hash",
+	"vcs_hash", "reproducible", "diff", "error", "checked",
+}
+
+// Record replaces the stored result for r's module version with r.
+func Record(ctx context.Context, db *sql.DB, r *Result) error {
+	_, err := database.Upsert(ctx, db, "repro_checks", resultCols[:2], resultCols,
+		r.ModulePath, r.Version, r.RepoURL, r.Subdir, r.CommitHash, r.ProxyHash,
+		r.VCSHash, r.Reproducible, r.Diff, r.Error, r.Checked)
+	return err
+}
+
+var selectResults = "SELECT " + strings.Join(resultCols, ", ") + " FROM repro_checks"
+
+// Mismatches returns the stored results of versions that were rebuilt but
+// did not match the proxy, ordered by module path and version.
+func Mismatches(ctx context.Context, db *sql.DB) (iter.Seq[*Result], func() error) {
+	return database.ScanRowsAs[Result](ctx, db,
+		selectResults+" WHERE NOT reproducible AND error = '' ORDER BY module_path, version")
+}
+
+// Checked reports whether there is a stored result for path@version.
+func Checked(ctx context.Context, db *sql.DB, path, version string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM repro_checks WHERE module_path = ? AND version = ?",
+		path, version).Scan(&n)
+	return n > 0, err
+}
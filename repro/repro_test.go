@@ -0,0 +1,166 @@
+package repro
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	pathpkg "path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/proxy"
+	_ "modernc.org/sqlite"
+)
+
+func TestCompare(t *testing.T) {
+	a := corpustest.ZipReader(t, "m", "v1.0.0", map[string]string{"go.mod": "module m\n", "a.go": "package m\n", "b.go": "package m\n"})
+	b := corpustest.ZipReader(t, "m", "v1.0.0", map[string]string{"go.mod": "module m\n", "a.go": "package m // changed\n", "c.go": "package m\n"})
+	got, err := Compare(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.go", "b.go", "c.go"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	for _, test := range []struct {
+		origin proxy.Origin
+		ok     bool
+	}{
+		{proxy.Origin{URL: "https://github.com/a/b", Hash: "abc", Ref: "refs/tags/v1.0.0"}, true},
+		{proxy.Origin{URL: "http://github.com/a/b", Hash: "abc"}, false},
+		{proxy.Origin{URL: "file:///tmp/repo", Hash: "abc"}, false},
+		{proxy.Origin{URL: "ext::sh -c touch% /tmp/pwned", Hash: "abc"}, false},
+		{proxy.Origin{URL: "--upload-pack=touch /tmp/pwned", Hash: "abc"}, false},
+		{proxy.Origin{URL: "https://github.com/a/b", Hash: "--upload-pack=x"}, false},
+		{proxy.Origin{URL: "https://github.com/a/b", Hash: "abc", Ref: "-x"}, false},
+	} {
+		err := checkOrigin(test.origin)
+		if got := err == nil; got != test.ok {
+			t.Errorf("%+v: got error %v, want ok=%t", test.origin, err, test.ok)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git")
+	}
+	ctx := context.Background()
+	const path = "example.com/m"
+
+	// A repository with the module in a subdirectory.
+	repo := t.TempDir()
+	files := map[string]string{"sub/go.mod": "module example.com/m\n", "sub/m.go": "package m\n", "LICENSE": "MIT\n"}
+	for name, contents := range files {
+		name = filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		if _, err := git(ctx, repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := git(ctx, repo, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { gitProtocols = p }(gitProtocols)
+	gitProtocols = "https:file"
+	origin := proxy.Origin{VCS: "git", URL: "file://" + filepath.ToSlash(repo), Subdir: "sub", Hash: strings.TrimSpace(string(out))}
+
+	// v1.0.0 matches the repository; the proxy's zip of v1.0.1 has an extra file.
+	zips := map[string][]byte{}
+	for v, extra := range map[string]map[string]string{
+		"v1.0.0": nil,
+		"v1.0.1": {"extra.go": "package m\n"},
+	} {
+		fs := map[string]string{"go.mod": files["sub/go.mod"], "m.go": files["sub/m.go"], "LICENSE": files["LICENSE"]}
+		for n, c := range extra {
+			fs[n] = c
+		}
+		zips[v] = corpustest.Zip(t, path, v, fs)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _ := strings.CutPrefix(r.URL.Path, "/"+path+"/@v/")
+		ext := pathpkg.Ext(name)
+		v := strings.TrimSuffix(name, ext)
+		switch {
+		case zips[v] == nil:
+			http.NotFound(w, r)
+		case ext == ".info":
+			json.NewEncoder(w).Encode(proxy.InfoEntry{Version: v, Origin: origin})
+		case ext == ".zip":
+			w.Write(zips[v])
+		}
+	}))
+	defer srv.Close()
+	defer proxy.SetURL("https://proxy.golang.org/cached-only")
+	proxy.SetURL(srv.URL)
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		version  string
+		wantRepr bool
+		wantDiff string
+	}{
+		{"v1.0.0", true, ""},
+		{"v1.0.1", false, "extra.go"},
+	} {
+		r, err := Check(ctx, t.TempDir(), path, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Error != "" {
+			t.Fatalf("%s: %s", test.version, r.Error)
+		}
+		if r.Reproducible != test.wantRepr || r.Diff != test.wantDiff {
+			t.Errorf("%s: got reproducible=%t diff=%q, want %t, %q", test.version, r.Reproducible, r.Diff, test.wantRepr, test.wantDiff)
+		}
+		if err := Record(ctx, db, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seq, errf := Mismatches(ctx, db)
+	var got []string
+	for r := range seq {
+		got = append(got, r.Version)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v1.0.1"}; !slices.Equal(got, want) {
+		t.Errorf("Mismatches: got %v, want %v", got, want)
+	}
+}
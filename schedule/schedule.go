@@ -0,0 +1,131 @@
+// Package schedule orders work on modules, like refreshing their information
+// from the proxy or analyzing them, so that limited resources such as the
+// proxy's request budget are spent first on the modules that matter most.
+//
+// The priority of work on a module combines the module's popularity, from
+// the centrality scores computed by package depgraph, with the work's
+// staleness: how long ago it was last done.
+package schedule
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/depgraph"
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// MaxPriority is the highest priority returned by [Scorer.Priority].
+const MaxPriority = 1000
+
+// minPopularity is the popularity that a module without a score counts as,
+// so that stale work on unknown modules is still done, after work on
+// popular ones.
+const minPopularity = 0.1
+
+// Options configure a [Scorer].
+type Options struct {
+	// MaxAge is the age at which work is most stale. The default is 30 days.
+	MaxAge time.Duration
+	// Now is the current time. The default is time.Now().
+	Now time.Time
+}
+
+// A Scorer computes the priorities of work on modules.
+type Scorer struct {
+	opts       Options
+	percentile map[string]float64
+}
+
+// NewScorer returns a Scorer that uses the centrality scores stored in db.
+func NewScorer(ctx context.Context, db *sql.DB, opts Options) (_ *Scorer, err error) {
+	defer errs.Wrap(&err, "schedule.NewScorer")
+	// Use percentiles rather than PageRank itself, which is so skewed that
+	// a few modules would get all the priority.
+	scores, errf := depgraph.Top(ctx, db, depgraph.ByPageRank, 0)
+	var paths []string
+	for s := range scores {
+		paths = append(paths, s.ModulePath)
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	pct := map[string]float64{}
+	for i, p := range paths {
+		pct[p] = float64(len(paths)-i) / float64(len(paths))
+	}
+	return newScorer(pct, opts), nil
+}
+
+func newScorer(percentile map[string]float64, opts Options) *Scorer {
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 30 * 24 * time.Hour
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	return &Scorer{opts: opts, percentile: percentile}
+}
+
+// Popularity returns the popularity of the module at path, from 0 to 1:
+// its percentile rank by PageRank, or 0 if it has no score.
+func (s *Scorer) Popularity(path string) float64 {
+	return s.percentile[path]
+}
+
+// Staleness returns the staleness of work last done at last, from 0 for work
+// done now to 1 for work done at least MaxAge ago. Work that has never been
+// done, indicated by the zero time, has staleness 1.
+func (s *Scorer) Staleness(last time.Time) float64 {
+	if last.IsZero() {
+		return 1
+	}
+	age := s.opts.Now.Sub(last)
+	return min(max(age.Seconds()/s.opts.MaxAge.Seconds(), 0), 1)
+}
+
+// Priority returns the priority of work on the module at path that was last
+// done at last, from 0 to [MaxPriority]; higher is more urgent. It is the
+// product of the module's popularity and the work's staleness, so work that
+// has just been done has priority 0 however popular the module.
+func (s *Scorer) Priority(path string, last time.Time) int {
+	pop := minPopularity + (1-minPopularity)*s.Popularity(path)
+	return int(math.Round(MaxPriority * pop * s.Staleness(last)))
+}
+
+// Sort sorts items in decreasing order of priority, then by path. The key
+// function returns an item's module path and when its work was last done.
+func Sort[T any](s *Scorer, items []T, key func(T) (path string, last time.Time)) {
+	type keyed struct {
+		item     T
+		path     string
+		priority int
+	}
+	ks := make([]keyed, len(items))
+	for i, it := range items {
+		p, last := key(it)
+		ks[i] = keyed{it, p, s.Priority(p, last)}
+	}
+	slices.SortFunc(ks, func(a, b keyed) int {
+		return cmp.Or(cmp.Compare(b.priority, a.priority), strings.Compare(a.path, b.path))
+	})
+	for i, k := range ks {
+		items[i] = k.item
+	}
+}
+
+// ParseTime parses a time stored in the database in RFC 3339 format.
+// It returns the zero time if s is empty or malformed, so that work whose
+// time is unknown counts as never done.
+func ParseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,51 @@
+package schedule
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPriority(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	s := newScorer(map[string]float64{"popular": 1, "middling": 0.5}, Options{MaxAge: 10 * 24 * time.Hour, Now: now})
+	days := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+	for _, test := range []struct {
+		path string
+		last time.Time
+		want int
+	}{
+		{"popular", time.Time{}, 1000},
+		{"popular", days(20), 1000},
+		{"popular", days(5), 500},
+		{"popular", now, 0},
+		{"middling", time.Time{}, 550},
+		{"unknown", time.Time{}, 100},
+		{"unknown", days(5), 50},
+	} {
+		if got := s.Priority(test.path, test.last); got != test.want {
+			t.Errorf("Priority(%q, %s) = %d, want %d", test.path, test.last.Format(time.DateOnly), got, test.want)
+		}
+	}
+
+	type item struct {
+		path string
+		last time.Time
+	}
+	items := []item{
+		{"unknown", time.Time{}},
+		{"popular", days(1)},
+		{"middling", time.Time{}},
+		{"b", time.Time{}},
+		{"popular2", now},
+	}
+	Sort(s, items, func(it item) (string, time.Time) { return it.path, it.last })
+	var got []string
+	for _, it := range items {
+		got = append(got, it.path)
+	}
+	// middling: 550; b, popular and unknown: 100, ordered by path; popular2: 0, done just now.
+	if want := []string{"middling", "b", "popular", "unknown", "popular2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
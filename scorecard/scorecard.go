@@ -0,0 +1,180 @@
+// Package scorecard fetches OpenSSF Scorecard results for the repositories
+// of modules and stores them in the scorecards and scorecard_checks tables.
+// See https://scorecard.dev.
+//
+// Call [SetURL] before making any requests; it must not be called
+// concurrently with requests.
+package scorecard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/forge"
+	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/logging"
+)
+
+const defaultURL = "https://api.securityscorecards.dev"
+
+var apiURL = defaultURL
+
+// SetURL sets the base URL of the Scorecard API.
+func SetURL(u string) {
+	apiURL = strings.TrimSuffix(u, "/")
+}
+
+var client = newClient()
+
+func newClient() *httputil.LimitedClient {
+	c := httputil.NewLimitedClient(nil, 10, 2)
+	c.AddHooks(httputil.Hooks{
+		BeforeRequest: func(req *http.Request) error {
+			ctx := req.Context()
+			logging.FromContext(ctx).DebugContext(ctx, "scorecard request", "url", req.URL.Redacted())
+			return nil
+		},
+	})
+	return c
+}
+
+// A Result is the Scorecard result for a repository.
+type Result struct {
+	Repo      string // like "github.com/owner/name"
+	Date      string
+	CommitSHA string
+	Score     float64
+	Fetched   string
+	Checks    []*Check `db:"-"`
+}
+
+// A Check is the result of one Scorecard check.
+type Check struct {
+	Name   string
+	Score  int // 0 to 10, or -1 if inconclusive
+	Reason string
+}
+
+// RepoFor returns the repository name, like "github.com/owner/name", that
+// Scorecard uses for the module with the given path. It reports false if
+// Scorecard has no results for the module's forge.
+func RepoFor(modulePath string) (string, bool) {
+	f, owner, name, ok := forge.RepoFor(modulePath)
+	if !ok || (f != forge.GitHub && f != forge.GitLab) {
+		return "", false
+	}
+	host, _, _ := strings.Cut(modulePath, "/")
+	return host + "/" + owner + "/" + name, true
+}
+
+// Fetch returns the most recent Scorecard result for repo. If the repository
+// has not been scored, the error wraps [errs.NotFound].
+func Fetch(ctx context.Context, repo string) (_ *Result, err error) {
+	defer errs.Wrap(&err, "scorecard.Fetch(%s)", repo)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL+"/projects/"+repo, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := client.DoReadBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Date string `json:"date"`
+		Repo struct {
+			Name   string `json:"name"`
+			Commit string `json:"commit"`
+		} `json:"repo"`
+		Score  float64 `json:"score"`
+		Checks []struct {
+			Name   string `json:"name"`
+			Score  int    `json:"score"`
+			Reason string `json:"reason"`
+		} `json:"checks"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	r := &Result{
+		Repo:      repo,
+		Date:      resp.Date,
+		CommitSHA: resp.Repo.Commit,
+		Score:     resp.Score,
+		Fetched:   time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, c := range resp.Checks {
+		r.Checks = append(r.Checks, &Check{Name: c.Name, Score: c.Score, Reason: c.Reason})
+	}
+	slices.SortFunc(r.Checks, func(a, b *Check) int { return strings.Compare(a.Name, b.Name) })
+	return r, nil
+}
+
+var resultCols = []string{"repo", "date", "commit_sha", "score", "fetched"}
+
+// Store replaces the stored result for r.Repo with r.
+func Store(ctx context.Context, db *sql.DB, r *Result) error {
+	return database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		_, err := database.Upsert(ctx, tx, "scorecards", resultCols[:1], resultCols,
+			r.Repo, r.Date, r.CommitSHA, r.Score, r.Fetched)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM scorecard_checks WHERE repo = ?", r.Repo); err != nil {
+			return err
+		}
+		for _, c := range r.Checks {
+			_, err := tx.ExecContext(ctx, "INSERT INTO scorecard_checks (repo, name, score, reason) VALUES (?, ?, ?, ?)",
+				r.Repo, c.Name, c.Score, c.Reason)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Load returns the stored result for repo, with its checks,
+// or nil if there is none.
+func Load(ctx context.Context, db *sql.DB, repo string) (*Result, error) {
+	seq, errf := database.ScanRowsAs[Result](ctx, db,
+		"SELECT "+strings.Join(resultCols, ", ")+" FROM scorecards WHERE repo = ?", repo)
+	rs := slices.Collect(seq)
+	if err := errf(); err != nil || len(rs) == 0 {
+		return nil, err
+	}
+	r := rs[0]
+	cseq, errf := database.ScanRowsAs[Check](ctx, db,
+		"SELECT name, score, reason FROM scorecard_checks WHERE repo = ? ORDER BY name", repo)
+	r.Checks = slices.Collect(cseq)
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ForModule returns the stored result for the repository of the module with
+// the given path, or nil if there is none.
+func ForModule(ctx context.Context, db *sql.DB, modulePath string) (*Result, error) {
+	repo, ok := RepoFor(modulePath)
+	if !ok {
+		return nil, nil
+	}
+	return Load(ctx, db, repo)
+}
+
+// Stale returns the stored repositories whose results were fetched before
+// the given time, in order of fetch time.
+func Stale(ctx context.Context, db *sql.DB, before time.Time) ([]string, error) {
+	seq, errf := database.ScanRowsOf[string](ctx, db,
+		"SELECT repo FROM scorecards WHERE fetched < ? ORDER BY fetched", before.UTC().Format(time.RFC3339))
+	repos := slices.Collect(seq)
+	return repos, errf()
+}
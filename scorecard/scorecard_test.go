@@ -0,0 +1,107 @@
+package scorecard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/errs"
+	_ "modernc.org/sqlite"
+)
+
+func TestRepoFor(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want string
+	}{
+		{"github.com/a/b", "github.com/a/b"},
+		{"github.com/a/b/v2/sub", "github.com/a/b"},
+		{"gitlab.com/a/b.git", "gitlab.com/a/b"},
+		{"bitbucket.org/a/b", ""},
+		{"golang.org/x/mod", ""},
+	} {
+		got, _ := RepoFor(test.path)
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+const testResponse = `{
+	"date": "2026-09-01T00:00:00Z",
+	"repo": {"name": "github.com/a/b", "commit": "abc123"},
+	"score": 6.4,
+	"checks": [
+		{"name": "Maintained", "score": 10, "reason": "30 commits"},
+		{"name": "Code-Review", "score": -1, "reason": "no commits"}
+	]
+}`
+
+func TestFetchStore(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/projects/github.com/a/b" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, testResponse)
+	}))
+	defer srv.Close()
+	SetURL(srv.URL)
+	defer SetURL(defaultURL)
+
+	if _, err := Fetch(ctx, "github.com/a/c"); !errors.Is(err, errs.NotFound) {
+		t.Fatalf("unscored repo: got %v, want NotFound", err)
+	}
+	r, err := Fetch(ctx, "github.com/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Storing twice replaces the first result.
+	for range 2 {
+		if err := Store(ctx, db, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ForModule(ctx, db, "github.com/a/b/v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Score != 6.4 || got.CommitSHA != "abc123" || len(got.Checks) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if c := got.Checks[0]; c.Name != "Code-Review" || c.Score != -1 {
+		t.Errorf("first check: got %+v", c)
+	}
+	if got, err := ForModule(ctx, db, "github.com/x/y"); err != nil || got != nil {
+		t.Errorf("unstored: got %v, %v; want nil, nil", got, err)
+	}
+
+	stale, err := Stale(ctx, db, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != "github.com/a/b" {
+		t.Errorf("Stale: got %v", stale)
+	}
+}
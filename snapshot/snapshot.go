@@ -0,0 +1,393 @@
+// Package snapshot archives an analysis environment: the database, a
+// manifest of the corpus, and the configuration.
+//
+// A snapshot is a gzipped tar file holding, in order:
+//
+//   - manifest.json, a [Manifest] describing the other files
+//   - corpus.sum, a line "path version hash" for each corpus zip, sorted,
+//     where the hash is the [dirhash.Hash1] of the zip's files
+//   - db.sqlite, a copy of the database made with VACUUM INTO
+//
+// Archives are deterministic: the same database, corpus and configuration
+// produce the same bytes. Corpus zips are not included, since they can be
+// downloaded again; [VerifyCorpus] checks that a corpus matches a snapshot.
+package snapshot
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/modfs"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// Format is the version of the snapshot format written by [Create].
+const Format = 1
+
+// Names of the files in a snapshot.
+const (
+	ManifestFile = "manifest.json"
+	CorpusFile   = "corpus.sum"
+	DBFile       = "db.sqlite"
+)
+
+// A Manifest describes a snapshot.
+type Manifest struct {
+	Format  int
+	Created time.Time
+	// Config is the configuration of the environment, as JSON.
+	Config json.RawMessage `json:",omitempty"`
+	// Files holds the sizes and hashes of the other files in the snapshot.
+	Files map[string]FileInfo
+	// Modules is the number of module versions in the corpus manifest.
+	Modules int
+}
+
+// FileInfo is the size and SHA-256 hash of a file in a snapshot.
+type FileInfo struct {
+	Size   int64
+	SHA256 string
+}
+
+// CreateOptions configure [Create].
+type CreateOptions struct {
+	DB        *sql.DB
+	CorpusDir string // if empty, the corpus manifest is empty
+	Config    any    // encoded as JSON in the manifest; may be nil
+	// Created is the creation time recorded in the manifest and the tar
+	// headers. If zero, the current time is used.
+	Created time.Time
+	// TempDir is the directory for the temporary copy of the database.
+	// If empty, os.TempDir is used.
+	TempDir string
+}
+
+// Create writes a snapshot to w.
+func Create(ctx context.Context, w io.Writer, opts CreateOptions) (_ *Manifest, err error) {
+	defer errs.Wrap(&err, "snapshot.Create")
+	if opts.Created.IsZero() {
+		opts.Created = time.Now()
+	}
+	m := &Manifest{Format: Format, Created: opts.Created.UTC().Truncate(time.Second), Files: map[string]FileInfo{}}
+	if opts.Config != nil {
+		m.Config, err = json.Marshal(opts.Config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	corpus, n, err := CorpusManifest(ctx, opts.CorpusDir)
+	if err != nil {
+		return nil, err
+	}
+	m.Modules = n
+	m.Files[CorpusFile] = fileInfo(corpus)
+
+	tmp, err := os.MkdirTemp(opts.TempDir, "snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	dbCopy := filepath.Join(tmp, DBFile)
+	if _, err := opts.DB.ExecContext(ctx, "VACUUM INTO ?", dbCopy); err != nil {
+		return nil, fmt.Errorf("copying database: %w", err)
+	}
+	dbf, err := os.Open(dbCopy)
+	if err != nil {
+		return nil, err
+	}
+	defer dbf.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, dbf)
+	if err != nil {
+		return nil, err
+	}
+	m.Files[DBFile] = FileInfo{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+	if _, err := dbf.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	gw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(gw)
+	add := func(name string, size int64, r io.Reader) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    size,
+			ModTime: m.Created,
+			Format:  tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	}
+	if err := add(ManifestFile, int64(len(manifest)), bytes.NewReader(manifest)); err != nil {
+		return nil, err
+	}
+	if err := add(CorpusFile, int64(len(corpus)), bytes.NewReader(corpus)); err != nil {
+		return nil, err
+	}
+	if err := add(DBFile, size, dbf); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func fileInfo(data []byte) FileInfo {
+	sum := sha256.Sum256(data)
+	return FileInfo{Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// CorpusManifest returns the corpus manifest of the zips under dir, laid out
+// as described in [modfs.ZipPath], and the number of zips.
+func CorpusManifest(ctx context.Context, dir string) ([]byte, int, error) {
+	if dir == "" {
+		return nil, 0, nil
+	}
+	var lines []string
+	for mv, file := range modfs.ZipFiles(dir) {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		h, err := dirhash.HashZip(file, dirhash.Hash1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", mv, err)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s\n", mv.Path, mv.Version, h))
+	}
+	slices.Sort(lines)
+	return []byte(strings.Join(lines, "")), len(lines), nil
+}
+
+// A Snapshot is the contents of a snapshot file, read by [Open].
+type Snapshot struct {
+	Manifest *Manifest
+	// Corpus maps each module version in the corpus manifest to its hash.
+	Corpus map[module.Version]string
+
+	dbFile string // temporary copy of the database
+}
+
+// Open reads and verifies the snapshot in r, copying the database to a
+// temporary file in tempDir (or os.TempDir if empty). Call [Snapshot.Close]
+// to remove it.
+func Open(r io.Reader, tempDir string) (_ *Snapshot, err error) {
+	defer errs.Wrap(&err, "snapshot.Open")
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gr)
+	s := &Snapshot{}
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+	var corpus []byte
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Name {
+		case ManifestFile:
+			if s.Manifest != nil {
+				return nil, errors.New("duplicate manifest")
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, &s.Manifest); err != nil {
+				return nil, fmt.Errorf("manifest: %w", err)
+			}
+			if s.Manifest.Format != Format {
+				return nil, fmt.Errorf("unsupported format %d", s.Manifest.Format)
+			}
+		case CorpusFile, DBFile:
+			if s.Manifest == nil {
+				return nil, fmt.Errorf("%s before manifest", hdr.Name)
+			}
+			want, ok := s.Manifest.Files[hdr.Name]
+			if !ok {
+				return nil, fmt.Errorf("%s is not in the manifest", hdr.Name)
+			}
+			h := sha256.New()
+			var w io.Writer = h
+			var buf bytes.Buffer
+			if hdr.Name == CorpusFile {
+				w = io.MultiWriter(h, &buf)
+			} else {
+				f, err := os.CreateTemp(tempDir, "snapshot-*.sqlite")
+				if err != nil {
+					return nil, err
+				}
+				s.dbFile = f.Name()
+				defer f.Close()
+				w = io.MultiWriter(h, f)
+			}
+			n, err := io.Copy(w, tr)
+			if err != nil {
+				return nil, err
+			}
+			if got := (FileInfo{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}); got != want {
+				return nil, fmt.Errorf("%s: got size %d, hash %s; manifest has %d, %s", hdr.Name, got.Size, got.SHA256, want.Size, want.SHA256)
+			}
+			if hdr.Name == CorpusFile {
+				corpus = buf.Bytes()
+			}
+		default:
+			return nil, fmt.Errorf("unexpected file %q", hdr.Name)
+		}
+	}
+	if s.Manifest == nil || s.dbFile == "" {
+		return nil, errors.New("missing manifest or database")
+	}
+	if _, ok := s.Manifest.Files[CorpusFile]; ok {
+		s.Corpus, err = parseCorpus(corpus)
+		if err != nil {
+			return nil, err
+		}
+		if len(s.Corpus) != s.Manifest.Modules {
+			return nil, fmt.Errorf("corpus manifest has %d modules, manifest says %d", len(s.Corpus), s.Manifest.Modules)
+		}
+	}
+	return s, nil
+}
+
+func parseCorpus(data []byte) (map[module.Version]string, error) {
+	m := map[module.Version]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) != 3 {
+			return nil, fmt.Errorf("corpus manifest: bad line %q", sc.Text())
+		}
+		m[module.Version{Path: f[0], Version: f[1]}] = f[2]
+	}
+	return m, sc.Err()
+}
+
+// Close removes the temporary copy of the database.
+func (s *Snapshot) Close() error {
+	if s.dbFile == "" {
+		return nil
+	}
+	return os.Remove(s.dbFile)
+}
+
+// Restore copies the snapshot's database to dbFile. Unless force is true,
+// it fails if dbFile exists.
+func (s *Snapshot) Restore(dbFile string, force bool) (err error) {
+	defer errs.Wrap(&err, "snapshot.Restore(%s)", dbFile)
+	if !force {
+		if _, err := os.Stat(dbFile); err == nil {
+			return fmt.Errorf("%w; use force to overwrite", os.ErrExist)
+		}
+	}
+	src, err := os.Open(s.dbFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	// Write to a temporary file, so that a failure doesn't leave a partial database.
+	dst, err := os.CreateTemp(filepath.Dir(dbFile), filepath.Base(dbFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbFile + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(dst.Name(), dbFile)
+}
+
+// A Problem is a difference between a corpus and a snapshot's corpus manifest.
+type Problem struct {
+	Module module.Version
+	Issue  string // "missing", "extra" or "mismatch"
+}
+
+func (p Problem) String() string { return p.Module.String() + ": " + p.Issue }
+
+// VerifyCorpus compares the zips under dir with the snapshot's corpus
+// manifest, returning the problems sorted by module.
+func (s *Snapshot) VerifyCorpus(ctx context.Context, dir string) ([]Problem, error) {
+	var problems []Problem
+	seen := map[module.Version]bool{}
+	for mv, file := range modfs.ZipFiles(dir) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		want, ok := s.Corpus[mv]
+		if !ok {
+			problems = append(problems, Problem{mv, "extra"})
+			continue
+		}
+		seen[mv] = true
+		got, err := dirhash.HashZip(file, dirhash.Hash1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mv, err)
+		}
+		if got != want {
+			problems = append(problems, Problem{mv, "mismatch"})
+		}
+	}
+	for mv := range s.Corpus {
+		if !seen[mv] {
+			problems = append(problems, Problem{mv, "missing"})
+		}
+	}
+	slices.SortFunc(problems, func(a, b Problem) int {
+		if c := strings.Compare(a.Module.Path, b.Module.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Module.Version, b.Module.Version)
+	})
+	return problems, nil
+}
@@ -0,0 +1,157 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/modfs"
+	_ "modernc.org/sqlite"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "CREATE TABLE t (x TEXT); INSERT INTO t VALUES ('hello')"); err != nil {
+		t.Fatal(err)
+	}
+	corpus := filepath.Join(dir, "corpus")
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.0.0", map[string]string{"go.mod": "module example.com/a\n", "a.go": "package a\n"})
+	corpustest.WriteZip(t, corpus, "example.com/b", "v0.1.0", map[string]string{"go.mod": "module example.com/b\n"})
+
+	opts := CreateOptions{
+		DB:        db,
+		CorpusDir: corpus,
+		Config:    map[string]int{"Concurrency": 4},
+		Created:   time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		TempDir:   dir,
+	}
+	var buf1, buf2 bytes.Buffer
+	m, err := Create(ctx, &buf1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Modules != 2 {
+		t.Errorf("got %d modules, want 2", m.Modules)
+	}
+	if _, err := Create(ctx, &buf2, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Error("snapshots of the same environment differ")
+	}
+
+	s, err := Open(bytes.NewReader(buf1.Bytes()), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var cfg bytes.Buffer
+	json.Compact(&cfg, s.Manifest.Config)
+	if got, want := cfg.String(), `{"Concurrency":4}`; got != want {
+		t.Errorf("config: got %s, want %s", got, want)
+	}
+
+	// Restore.
+	restored := filepath.Join(dir, "restored.sqlite")
+	if err := s.Restore(restored, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restore(restored, false); !errors.Is(err, os.ErrExist) {
+		t.Errorf("restoring over existing file: got %v, want ErrExist", err)
+	}
+	if err := s.Restore(restored, true); err != nil {
+		t.Fatal(err)
+	}
+	rdb, err := sql.Open("sqlite", restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+	var x string
+	if err := rdb.QueryRowContext(ctx, "SELECT x FROM t").Scan(&x); err != nil || x != "hello" {
+		t.Errorf("restored database: got %q, %v", x, err)
+	}
+
+	// Verify the corpus.
+	problems, err := s.VerifyCorpus(ctx, corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("got problems %v, want none", problems)
+	}
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.0.0", map[string]string{"go.mod": "module example.com/a\n", "a.go": "package a // changed\n"})
+	corpustest.WriteZip(t, corpus, "example.com/c", "v1.0.0", map[string]string{"go.mod": "module example.com/c\n"})
+	b, _ := modfs.ZipPath(corpus, "example.com/b", "v0.1.0")
+	os.Remove(b)
+	problems, err = s.VerifyCorpus(ctx, corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{"example.com/a@v1.0.0: mismatch", "example.com/b@v0.1.0: missing", "example.com/c@v1.0.0: extra"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	manifest := func(m Manifest) string {
+		m.Format = Format
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	db := "database"
+	good := fileInfo([]byte(db))
+	for _, test := range []struct {
+		name  string
+		files []string // alternating names and contents
+	}{
+		{"no manifest", []string{DBFile, db}},
+		{"no database", []string{ManifestFile, manifest(Manifest{})}},
+		{"bad hash", []string{ManifestFile, manifest(Manifest{Files: map[string]FileInfo{DBFile: {Size: 8, SHA256: "00"}}}), DBFile, db}},
+		{"not in manifest", []string{ManifestFile, manifest(Manifest{}), DBFile, db}},
+		{"unexpected file", []string{ManifestFile, manifest(Manifest{Files: map[string]FileInfo{DBFile: good}}), DBFile, db, "x", ""}},
+		{"bad format", []string{ManifestFile, `{"Format": 99}`, DBFile, db}},
+		{"module count", []string{ManifestFile, manifest(Manifest{Modules: 1, Files: map[string]FileInfo{DBFile: good, CorpusFile: fileInfo(nil)}}), CorpusFile, "", DBFile, db}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gw)
+			for i := 0; i < len(test.files); i += 2 {
+				tw.WriteHeader(&tar.Header{Name: test.files[i], Mode: 0o644, Size: int64(len(test.files[i+1]))})
+				tw.Write([]byte(test.files[i+1]))
+			}
+			tw.Close()
+			gw.Close()
+			s, err := Open(&buf, t.TempDir())
+			if err == nil {
+				s.Close()
+				t.Error("got nil error")
+			}
+		})
+	}
+}
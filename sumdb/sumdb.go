@@ -0,0 +1,374 @@
+// Package sumdb looks up module hashes in the Go checksum database
+// (https://sum.golang.org) and uses them to verify module zips and go.mod
+// files.
+//
+// Every lookup is checked against a signed tree head and an inclusion
+// proof, using [golang.org/x/mod/sumdb]. Tree heads, tiles and verified
+// lookups are cached in the directory passed to [SetCacheDir], so
+// later lookups of the same version need no network access.
+package sumdb
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/logging"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+const (
+	defaultURL = "https://sum.golang.org"
+	// defaultKey is the verifier key of sum.golang.org, as built into the go command.
+	defaultKey = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"
+)
+
+var (
+	mu       sync.Mutex
+	dbURL    = defaultURL
+	dbKey    = defaultKey
+	cacheDir string
+	noSumDB  string
+	current  *client
+)
+
+// SetURL sets the URL of the checksum database server, which may be a proxy
+// for it.
+func SetURL(u string) {
+	mu.Lock()
+	defer mu.Unlock()
+	dbURL = strings.TrimSuffix(u, "/")
+	current = nil
+}
+
+// SetKey sets the verifier key of the checksum database.
+func SetKey(vkey string) {
+	mu.Lock()
+	defer mu.Unlock()
+	dbKey = vkey
+	current = nil
+}
+
+// SetCacheDir sets the directory for the latest signed tree head, tiles,
+// and verified lookups. If dir is empty, they are kept in memory.
+func SetCacheDir(dir string) {
+	mu.Lock()
+	defer mu.Unlock()
+	cacheDir = dir
+	current = nil
+}
+
+// SetNoSumDB sets comma-separated glob patterns of module path prefixes, in
+// the syntax of GONOSUMDB, for modules that are not in the checksum database,
+// like private modules. Lookups of them fail, and verifications of them
+// succeed without checking anything.
+func SetNoSumDB(patterns string) {
+	mu.Lock()
+	defer mu.Unlock()
+	noSumDB = patterns
+	current = nil
+}
+
+// A client is a sumdb.Client and its operations.
+type client struct {
+	*sumdb.Client
+	ops *ops
+}
+
+func getClient() *client {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		o := &ops{
+			url:      dbURL,
+			key:      dbKey,
+			dir:      cacheDir,
+			hc:       newHTTPClient(),
+			mem:      map[string][]byte{},
+			notFound: map[string]bool{},
+		}
+		current = &client{sumdb.NewClient(o), o}
+		current.SetGONOSUMDB(noSumDB)
+	}
+	return current
+}
+
+func newHTTPClient() *httputil.LimitedClient {
+	c := httputil.NewLimitedClient(nil, 20, 5)
+	c.AddHooks(httputil.Hooks{
+		BeforeRequest: func(req *http.Request) error {
+			ctx := req.Context()
+			logging.FromContext(ctx).DebugContext(ctx, "sumdb request", "url", req.URL.Redacted())
+			return nil
+		},
+	})
+	return c
+}
+
+// Hashes are the hashes of a module version recorded in the checksum
+// database, in go.sum form, like "h1:...".
+type Hashes struct {
+	Zip string // hash of the module zip
+	Mod string // hash of the go.mod file
+}
+
+// Lookup returns the hashes of path@version from the checksum database.
+// If the database has no record of the version, the error wraps
+// [errs.NotFound]. If the server's responses are inconsistent with
+// what it served before, the error wraps [sumdb.ErrSecurity]. If path
+// matches the patterns passed to [SetNoSumDB], the error wraps
+// [sumdb.ErrGONOSUMDB].
+func Lookup(ctx context.Context, path, version string) (_ *Hashes, err error) {
+	defer errs.Wrap(&err, "sumdb.Lookup(%s@%s)", path, version)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c := getClient()
+	h := &Hashes{}
+	// The second lookup is answered from the record fetched by the first.
+	for _, x := range []struct {
+		vers string
+		p    *string
+	}{
+		{version, &h.Zip},
+		{version + "/go.mod", &h.Mod},
+	} {
+		lines, err := c.Lookup(path, x.vers)
+		if err != nil {
+			return nil, c.ops.classify(path, version, err)
+		}
+		for _, line := range lines {
+			if f := strings.Fields(line); len(f) == 3 && f[0] == path && f[1] == x.vers {
+				*x.p = f[2]
+			}
+		}
+		if *x.p == "" {
+			return nil, fmt.Errorf("no hash for %s in %q", x.vers, lines)
+		}
+	}
+	return h, nil
+}
+
+// ErrMismatch is returned when content does not match the checksum database.
+var ErrMismatch = errors.New("checksum mismatch")
+
+// VerifyZip checks that the hash of the module zip for path@version
+// matches the checksum database. Modules matching the patterns passed
+// to [SetNoSumDB] are not checked.
+func VerifyZip(ctx context.Context, path, version string, zr *zip.Reader) (err error) {
+	defer errs.Wrap(&err, "sumdb.VerifyZip(%s@%s)", path, version)
+	got, err := HashZip(zr)
+	if err != nil {
+		return err
+	}
+	h, err := Lookup(ctx, path, version)
+	if errors.Is(err, sumdb.ErrGONOSUMDB) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if got != h.Zip {
+		return fmt.Errorf("%w: zip has %s, checksum database has %s", ErrMismatch, got, h.Zip)
+	}
+	return nil
+}
+
+// VerifyMod checks that the hash of the go.mod file for path@version
+// matches the checksum database. Modules matching the patterns passed
+// to [SetNoSumDB] are not checked.
+func VerifyMod(ctx context.Context, path, version string, gomod []byte) (err error) {
+	defer errs.Wrap(&err, "sumdb.VerifyMod(%s@%s)", path, version)
+	got, err := HashMod(gomod)
+	if err != nil {
+		return err
+	}
+	h, err := Lookup(ctx, path, version)
+	if errors.Is(err, sumdb.ErrGONOSUMDB) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if got != h.Mod {
+		return fmt.Errorf("%w: go.mod has %s, checksum database has %s", ErrMismatch, got, h.Mod)
+	}
+	return nil
+}
+
+// HashZip returns the go.sum hash of the files in a module zip.
+// Like [dirhash.HashZip], it depends only on file names and contents.
+func HashZip(zr *zip.Reader) (string, error) {
+	var names []string
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		files[f.Name] = f
+	}
+	return dirhash.Hash1(names, func(name string) (io.ReadCloser, error) {
+		return files[name].Open()
+	})
+}
+
+// HashMod returns the go.sum hash of the contents of a go.mod file.
+func HashMod(gomod []byte) (string, error) {
+	return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(gomod)), nil
+	})
+}
+
+// ops implements [sumdb.ClientOps].
+// Configuration and cache files are stored under dir, or in memory
+// if dir is empty.
+type ops struct {
+	url, key string
+	dir      string
+	hc       *httputil.LimitedClient
+
+	configMu sync.Mutex // serializes WriteConfig
+
+	mu       sync.Mutex
+	mem      map[string][]byte // files, if dir is empty
+	notFound map[string]bool   // remote paths that returned 404 or 410
+	security string            // last security error
+}
+
+// remoteTimeout bounds each request to the server. The sumdb.Client
+// doesn't pass a context to ReadRemote.
+const remoteTimeout = time.Minute
+
+func (o *ops) ReadRemote(path string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", o.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := o.hc.DoReadBody(req)
+	if errors.Is(err, errs.NotFound) || errors.Is(err, errs.Gone) {
+		o.mu.Lock()
+		o.notFound[path] = true
+		o.mu.Unlock()
+	}
+	return data, err
+}
+
+func (o *ops) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.key), nil
+	}
+	data, err := o.read("config", file)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Start with an empty tree.
+		return nil, nil
+	}
+	return data, err
+}
+
+func (o *ops) WriteConfig(file string, old, new []byte) error {
+	o.configMu.Lock()
+	defer o.configMu.Unlock()
+	cur, err := o.read("config", file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if !bytes.Equal(cur, old) {
+		return sumdb.ErrWriteConflict
+	}
+	return o.write("config", file, new)
+}
+
+func (o *ops) ReadCache(file string) ([]byte, error) {
+	return o.read("cache", file)
+}
+
+func (o *ops) WriteCache(file string, data []byte) {
+	// Failing to cache only costs another request.
+	_ = o.write("cache", file, data)
+}
+
+func (o *ops) Log(msg string) {
+	logging.FromContext(context.Background()).Debug("sumdb: " + msg)
+}
+
+func (o *ops) SecurityError(msg string) {
+	logging.FromContext(context.Background()).Error("sumdb security error: " + msg)
+	o.mu.Lock()
+	o.security = msg
+	o.mu.Unlock()
+}
+
+// classify returns an error for a failed lookup of path@version
+// that wraps errs.NotFound or sumdb.ErrSecurity if appropriate.
+// The sumdb.Client loses that information when it wraps errors.
+func (o *ops) classify(path, version string, err error) error {
+	epath, eerr := module.EscapePath(path)
+	evers, verr := module.EscapeVersion(version)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch {
+	case o.security != "":
+		return fmt.Errorf("%w: %s", sumdb.ErrSecurity, o.security)
+	case eerr == nil && verr == nil && o.notFound["/lookup/"+epath+"@"+evers]:
+		return fmt.Errorf("%w: %v", errs.NotFound, err)
+	}
+	return err
+}
+
+func (o *ops) read(kind, file string) ([]byte, error) {
+	if o.dir == "" {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		data, ok := o.mem[kind+"/"+file]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		return data, nil
+	}
+	return os.ReadFile(filepath.Join(o.dir, kind, filepath.FromSlash(file)))
+}
+
+func (o *ops) write(kind, file string, data []byte) (err error) {
+	if o.dir == "" {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.mem[kind+"/"+file] = bytes.Clone(data)
+		return nil
+	}
+	name := filepath.Join(o.dir, kind, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	// Write atomically, so readers never see a partial file.
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
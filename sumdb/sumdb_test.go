@@ -0,0 +1,100 @@
+package sumdb_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/sumdb"
+	xsumdb "golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	const (
+		path    = "example.com/m"
+		version = "v1.0.0"
+		gomod   = "module example.com/m\n"
+	)
+	zr := corpustest.ZipReader(t, path, version, map[string]string{
+		"go.mod": gomod,
+		"m.go":   "package m\n",
+	})
+	zipHash, err := sumdb.HashZip(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modHash, err := sumdb.HashMod([]byte(gomod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(xsumdb.NewServer(xsumdb.NewTestServer(skey, func(p, v string) ([]byte, error) {
+		if p != path || v != version {
+			return nil, fs.ErrNotExist
+		}
+		return fmt.Appendf(nil, "%s %s %s\n%s %s/go.mod %s\n", p, v, zipHash, p, v, modHash), nil
+	})))
+	defer srv.Close()
+	cacheDir := t.TempDir()
+	sumdb.SetURL(srv.URL)
+	sumdb.SetKey(vkey)
+	sumdb.SetCacheDir(cacheDir)
+	defer func() {
+		sumdb.SetURL("https://sum.golang.org")
+		sumdb.SetKey("sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8")
+		sumdb.SetCacheDir("")
+	}()
+
+	h, err := sumdb.Lookup(ctx, path, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (sumdb.Hashes{Zip: zipHash, Mod: modHash}); *h != want {
+		t.Errorf("got %+v, want %+v", h, want)
+	}
+	if err := sumdb.VerifyZip(ctx, path, version, zr); err != nil {
+		t.Error(err)
+	}
+	if err := sumdb.VerifyMod(ctx, path, version, []byte(gomod)); err != nil {
+		t.Error(err)
+	}
+	if err := sumdb.VerifyMod(ctx, path, version, []byte(gomod+"go 1.21\n")); !errors.Is(err, sumdb.ErrMismatch) {
+		t.Errorf("altered go.mod: got %v, want sumdb.ErrMismatch", err)
+	}
+	bad := corpustest.ZipReader(t, path, version, map[string]string{"go.mod": gomod})
+	if err := sumdb.VerifyZip(ctx, path, version, bad); !errors.Is(err, sumdb.ErrMismatch) {
+		t.Errorf("altered zip: got %v, want sumdb.ErrMismatch", err)
+	}
+	if _, err := sumdb.Lookup(ctx, path, "v1.1.0"); !errors.Is(err, errs.NotFound) {
+		t.Errorf("unknown version: got %v, want NotFound", err)
+	}
+
+	// Verified lookups are served from the cache.
+	srv.Close()
+	sumdb.SetCacheDir(cacheDir) // new client
+	if _, err := sumdb.Lookup(ctx, path, version); err != nil {
+		t.Errorf("from cache: %v", err)
+	}
+
+	// Private modules aren't checked.
+	sumdb.SetNoSumDB("example.com/private")
+	defer sumdb.SetNoSumDB("")
+	if _, err := sumdb.Lookup(ctx, "example.com/private/m", version); !errors.Is(err, xsumdb.ErrGONOSUMDB) {
+		t.Errorf("private: got %v, want ErrGONOSUMDB", err)
+	}
+	if err := sumdb.VerifyMod(ctx, "example.com/private/m", version, []byte("module example.com/private/m\n")); err != nil {
+		t.Errorf("private: %v", err)
+	}
+}
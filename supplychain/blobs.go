@@ -0,0 +1,172 @@
+package supplychain
+
+import (
+	"go/ast"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/internal/entropy"
+)
+
+// Blobs finds large string and byte-slice literals that look like encoded
+// or encrypted data.
+var Blobs = &analysis.Analyzer{
+	Name:    "blobs",
+	Doc:     "find large high-entropy string and byte literals",
+	Version: 1,
+	Columns: []string{
+		"file TEXT NOT NULL",
+		"line INTEGER NOT NULL",
+		"length INTEGER NOT NULL",  // in bytes
+		"entropy REAL NOT NULL",    // bits per byte
+		"decoded INTEGER NOT NULL", // whether the file decodes base64 or hex, or uses XOR
+	},
+	Run: func(pass *analysis.Pass) error {
+		for _, b := range FindBlobs(pass.Fset, pass.Files) {
+			pass.Report(b.File, b.Line, b.Length, b.Entropy, b.Decoded)
+		}
+		return nil
+	},
+}
+
+func init() {
+	analysis.Register(Blobs)
+}
+
+// A Blob is a suspicious literal.
+type Blob struct {
+	File    string
+	Line    int
+	Length  int
+	Entropy float64
+	Decoded bool
+}
+
+const (
+	// minBlobLen is the minimum length of a suspicious literal.
+	minBlobLen = 256
+	// minEntropy is the minimum entropy of a suspicious literal, in bits per
+	// byte. English text has about 4; base64 has at most 6.
+	minEntropy = 4.8
+	// minHexEntropy is the minimum entropy of a suspicious hex literal.
+	minHexEntropy = 3.8
+)
+
+// FindBlobs returns the suspicious literals in files. Test files, generated
+// files and files in testdata directories are skipped, since they often
+// hold legitimate data.
+func FindBlobs(fset *token.FileSet, files []*analysis.File) []*Blob {
+	var blobs []*Blob
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, "_test.go") || inTestdata(f.Name) || ast.IsGenerated(f.AST) {
+			continue
+		}
+		decoded := decodes(f.AST)
+		add := func(pos token.Pos, data []byte) {
+			if len(data) < minBlobLen {
+				return
+			}
+			// Hex digits have at most 4 bits of entropy, so long hex
+			// strings need a lower threshold.
+			if e := entropy.Shannon(data); e >= minEntropy || (e >= minHexEntropy && isHex(data)) {
+				blobs = append(blobs, &Blob{
+					File:    f.Name,
+					Line:    fset.Position(pos).Line,
+					Length:  len(data),
+					Entropy: math.Round(e*100) / 100,
+					Decoded: decoded,
+				})
+			}
+		}
+		ast.Inspect(f.AST, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BasicLit:
+				if n.Kind == token.STRING {
+					if s, err := strconv.Unquote(n.Value); err == nil {
+						add(n.Pos(), []byte(s))
+					}
+				}
+			case *ast.CompositeLit:
+				if data, ok := byteSlice(n); ok {
+					add(n.Pos(), data)
+					return false
+				}
+			}
+			return true
+		})
+	}
+	return blobs
+}
+
+// byteSlice returns the value of a []byte literal whose elements are all
+// integer or character constants.
+func byteSlice(c *ast.CompositeLit) ([]byte, bool) {
+	at, ok := c.Type.(*ast.ArrayType)
+	if !ok {
+		return nil, false
+	}
+	if id, ok := at.Elt.(*ast.Ident); !ok || (id.Name != "byte" && id.Name != "uint8") {
+		return nil, false
+	}
+	data := make([]byte, 0, len(c.Elts))
+	for _, e := range c.Elts {
+		lit, ok := e.(*ast.BasicLit)
+		if !ok {
+			return nil, false
+		}
+		var n uint64
+		var err error
+		switch lit.Kind {
+		case token.INT:
+			n, err = strconv.ParseUint(lit.Value, 0, 8)
+		case token.CHAR:
+			var r rune
+			r, _, _, err = strconv.UnquoteChar(lit.Value[1:len(lit.Value)-1], '\'')
+			n = uint64(r)
+		default:
+			return nil, false
+		}
+		if err != nil {
+			return nil, false
+		}
+		data = append(data, byte(n))
+	}
+	return data, true
+}
+
+func isHex(data []byte) bool {
+	for _, b := range data {
+		if !('0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// decodes reports whether f decodes base64 or hex, or uses XOR,
+// as code that hides a payload might.
+func decodes(f *ast.File) bool {
+	found := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if n.Sel.Name == "DecodeString" || n.Sel.Name == "Decode" {
+				if x, ok := n.X.(*ast.SelectorExpr); ok && strings.HasSuffix(x.Sel.Name, "Encoding") {
+					found = true // base64.StdEncoding.DecodeString, etc.
+				}
+				if x, ok := n.X.(*ast.Ident); ok && x.Name == "hex" {
+					found = true
+				}
+			}
+		case *ast.BinaryExpr:
+			found = found || n.Op == token.XOR
+		case *ast.AssignStmt:
+			found = found || n.Tok == token.XOR_ASSIGN
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,252 @@
+// Package supplychain looks for signs of malicious code in the corpus and
+// ranks modules for manual review.
+//
+// The analyzers [Calls] and [Blobs] (see package analysis) find suspicious
+// code: network access or process execution during package initialization,
+// code that downloads and runs programs, and large obfuscated strings.
+// [BuildQueue] combines their results with a check for module paths that
+// resemble popular ones, weighting recently published modules more, and
+// stores a ranked review queue.
+package supplychain
+
+import (
+	"go/ast"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jba/go-ecosystem/analysis"
+)
+
+// Kinds of suspicious calls.
+const (
+	InitNetwork  = "init-network"  // network access during initialization
+	InitExec     = "init-exec"     // process execution during initialization
+	DownloadExec = "download-exec" // a function that both downloads and executes
+)
+
+// Calls finds calls that access the network or start processes during
+// package initialization, and functions that do both.
+var Calls = &analysis.Analyzer{
+	Name:    "suspicious_calls",
+	Doc:     "find network access and process execution at init time, and download-and-execute code",
+	Version: 1,
+	Columns: []string{
+		"file TEXT NOT NULL",
+		"line INTEGER NOT NULL",
+		"func TEXT NOT NULL",   // enclosing function
+		"kind TEXT NOT NULL",   // one of the kinds above
+		"callee TEXT NOT NULL", // like "net/http.Get"
+	},
+	Run: func(pass *analysis.Pass) error {
+		for _, c := range FindCalls(pass.Fset, pass.Files) {
+			pass.Report(c.File, c.Line, c.Func, c.Kind, c.Callee)
+		}
+		return nil
+	},
+}
+
+func init() {
+	analysis.Register(Calls)
+}
+
+// A Call is a suspicious call.
+type Call struct {
+	File   string
+	Line   int
+	Func   string
+	Kind   string
+	Callee string
+}
+
+// sensitive maps functions, by import path and name, to whether they
+// access the network ("net") or execute a program ("exec").
+var sensitive = map[string]map[string]string{
+	"net/http": {
+		"Get": "net", "Head": "net", "Post": "net", "PostForm": "net",
+		"NewRequest": "net", "NewRequestWithContext": "net",
+	},
+	"net": {
+		"Dial": "net", "DialTimeout": "net", "DialTCP": "net", "DialUDP": "net",
+		"LookupHost": "net", "LookupTXT": "net", "LookupIP": "net",
+	},
+	"os/exec": {"Command": "exec", "CommandContext": "exec"},
+	"os":      {"StartProcess": "exec"},
+	"syscall": {"Exec": "exec", "ForkExec": "exec"},
+	"plugin":  {"Open": "exec"},
+}
+
+// FindCalls returns the suspicious calls in files, which are grouped into
+// packages by directory. Test files and files in testdata directories are
+// skipped.
+//
+// A call is made during initialization if it is in an init function or
+// a package-level variable initializer, or in a function of the same
+// package that one of those calls, directly or indirectly.
+// The analysis is syntactic: calls through methods, function values and
+// other packages are not followed.
+func FindCalls(fset *token.FileSet, files []*analysis.File) []*Call {
+	pkgs := map[string][]*analysis.File{}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, "_test.go") || inTestdata(f.Name) {
+			continue
+		}
+		dir := path.Dir(f.Name)
+		pkgs[dir] = append(pkgs[dir], f)
+	}
+	var calls []*Call
+	for _, pfiles := range pkgs {
+		calls = append(calls, packageCalls(fset, pfiles)...)
+	}
+	return calls
+}
+
+// A body is a function body, or a package-level initializer, with
+// the file it is in.
+type body struct {
+	file *analysis.File
+	name string
+	node ast.Node
+}
+
+func packageCalls(fset *token.FileSet, files []*analysis.File) []*Call {
+	funcs := map[string]body{} // package-level functions by name
+	var roots []body           // init functions and variable initializers
+	for _, f := range files {
+		for _, decl := range f.AST.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Body == nil || d.Recv != nil {
+					continue
+				}
+				b := body{f, d.Name.Name, d.Body}
+				if d.Name.Name == "init" {
+					roots = append(roots, b)
+				} else {
+					funcs[d.Name.Name] = b
+				}
+			case *ast.GenDecl:
+				if d.Tok == token.VAR {
+					roots = append(roots, body{f, "var", d})
+				}
+			}
+		}
+	}
+
+	var calls []*Call
+	add := func(b body, pos token.Pos, kind, callee string) {
+		calls = append(calls, &Call{
+			File:   b.file.Name,
+			Line:   fset.Position(pos).Line,
+			Func:   b.name,
+			Kind:   kind,
+			Callee: callee,
+		})
+	}
+
+	// Follow calls from the roots to other functions of the package.
+	seen := map[string]bool{}
+	queue := roots
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+		imports := importNames(b.file.AST)
+		ast.Inspect(b.node, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if id, ok := call.Fun.(*ast.Ident); ok {
+				if f, ok := funcs[id.Name]; ok && !seen[id.Name] {
+					seen[id.Name] = true
+					queue = append(queue, f)
+				}
+				return true
+			}
+			switch kind, callee := classify(imports, call); kind {
+			case "net":
+				add(b, call.Pos(), InitNetwork, callee)
+			case "exec":
+				add(b, call.Pos(), InitExec, callee)
+			}
+			return true
+		})
+	}
+
+	// Find functions that both download and execute.
+	for _, f := range files {
+		imports := importNames(f.AST)
+		for _, decl := range f.AST.Decls {
+			d, ok := decl.(*ast.FuncDecl)
+			if !ok || d.Body == nil {
+				continue
+			}
+			var net bool
+			var execs []*ast.CallExpr
+			var callees []string
+			ast.Inspect(d.Body, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					switch kind, callee := classify(imports, call); kind {
+					case "net":
+						net = true
+					case "exec":
+						execs = append(execs, call)
+						callees = append(callees, callee)
+					}
+				}
+				return true
+			})
+			if net {
+				for i, call := range execs {
+					add(body{f, d.Name.Name, d}, call.Pos(), DownloadExec, callees[i])
+				}
+			}
+		}
+	}
+	return calls
+}
+
+// classify returns "net" or "exec" if call is to one of the sensitive
+// functions, and the qualified name of the function.
+func classify(imports map[string]string, call *ast.CallExpr) (kind, callee string) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", ""
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return "", ""
+	}
+	ipath, ok := imports[x.Name]
+	if !ok {
+		return "", ""
+	}
+	kind = sensitive[ipath][sel.Sel.Name]
+	if kind == "" {
+		return "", ""
+	}
+	return kind, ipath + "." + sel.Sel.Name
+}
+
+// importNames maps the names by which f refers to the sensitive packages
+// to their import paths.
+func importNames(f *ast.File) map[string]string {
+	m := map[string]string{}
+	for _, spec := range f.Imports {
+		ipath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || sensitive[ipath] == nil {
+			continue
+		}
+		name := path.Base(ipath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		m[name] = ipath
+	}
+	return m
+}
+
+func inTestdata(name string) bool {
+	return strings.HasPrefix(name, "testdata/") || strings.Contains(name, "/testdata/")
+}
@@ -0,0 +1,222 @@
+package supplychain
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// An Item is a module in the review queue.
+type Item struct {
+	ModulePath string
+	Version    string
+	Score      float64 // higher is more suspicious
+	Reasons    string  // semicolon-separated
+	Computed   string
+}
+
+// Weights of findings in the score of an Item.
+const (
+	initNetworkWeight  = 5
+	initExecWeight     = 6
+	downloadExecWeight = 8
+	blobWeight         = 2
+	decodedBlobWeight  = 4
+	typosquatWeight    = 4
+	recentWeight       = 4 // added to typosquatWeight for recent modules
+)
+
+// QueueOptions configure [BuildQueue].
+type QueueOptions struct {
+	// Popular is the number of most-imported paths that module paths are
+	// compared with, to find typo-squatting. The default is 1000.
+	Popular int
+	// Recent is how new a module's latest version must be for a typo-squatting
+	// finding to be weighted more. The default is 90 days.
+	Recent time.Duration
+	// Now is the current time. The default is time.Now().
+	Now time.Time
+}
+
+// BuildQueue replaces the contents of the review_queue table with modules
+// whose latest versions have findings from the [Calls] and [Blobs] analyzers,
+// or whose paths resemble popular import paths, as recorded by the imports
+// analyzer. Analyzers that haven't been run contribute nothing.
+// It returns the number of modules in the queue.
+func BuildQueue(ctx context.Context, db *sql.DB, opts QueueOptions) (_ int, err error) {
+	defer errs.Wrap(&err, "supplychain.BuildQueue")
+	if opts.Popular <= 0 {
+		opts.Popular = 1000
+	}
+	if opts.Recent <= 0 {
+		opts.Recent = 90 * 24 * time.Hour
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	q := &queue{items: map[string]*queueItem{}}
+	if err := q.addCalls(ctx, db); err != nil {
+		return 0, err
+	}
+	if err := q.addBlobs(ctx, db); err != nil {
+		return 0, err
+	}
+	if err := q.addTyposquats(ctx, db, opts); err != nil {
+		return 0, err
+	}
+
+	computed := opts.Now.UTC().Format(time.RFC3339)
+	items := slices.SortedFunc(maps.Values(q.items), func(a, b *queueItem) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), strings.Compare(a.path, b.path))
+	})
+	err = database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM review_queue"); err != nil {
+			return err
+		}
+		rows := func(yield func([]any) bool) {
+			for _, it := range items {
+				if !yield([]any{it.path, it.version, it.score, strings.Join(it.reasons, "; "), computed}) {
+					return
+				}
+			}
+		}
+		_, err := database.BulkInsert(ctx, tx, "review_queue", itemCols, rows, 500)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+var itemCols = []string{"module_path", "version", "score", "reasons", "computed"}
+
+// Queue returns the modules in the review queue, most suspicious first.
+// If limit is positive, at most limit items are returned.
+func Queue(ctx context.Context, db *sql.DB, limit int) (iter.Seq[*Item], func() error) {
+	query, args := database.Select("review_queue", itemCols...).OrderBy("score DESC", "module_path").Limit(limit).SQL()
+	return database.ScanRowsAs[Item](ctx, db, query, args...)
+}
+
+type queue struct {
+	items map[string]*queueItem
+}
+
+type queueItem struct {
+	path, version string
+	score         float64
+	reasons       []string
+	kinds         map[string]bool // kinds of findings already counted
+}
+
+// add adds a finding of the given kind to the module's item.
+// Only the first finding of each kind counts.
+func (q *queue) add(path, version, kind string, weight float64, reason string) {
+	it := q.items[path]
+	if it == nil {
+		it = &queueItem{path: path, version: version, kinds: map[string]bool{}}
+		q.items[path] = it
+	}
+	if it.kinds[kind] {
+		return
+	}
+	it.kinds[kind] = true
+	it.score += weight
+	it.reasons = append(it.reasons, reason)
+}
+
+// latestJoin restricts the rows of an analyzer table a to the latest versions of modules.
+const latestJoin = " a JOIN modules m ON m.path = a.module_path AND m.latest_version = a.version"
+
+func (q *queue) addCalls(ctx context.Context, db *sql.DB) error {
+	if ok, err := tableExists(ctx, db, Calls.Table()); err != nil || !ok {
+		return err
+	}
+	type row struct {
+		ModulePath, Version, File, Kind, Callee string
+		Line                                    int
+	}
+	rows, errf := database.ScanRowsAs[row](ctx, db,
+		"SELECT a.module_path, a.version, a.file, a.line, a.kind, a.callee FROM "+Calls.Table()+latestJoin+
+			" ORDER BY a.module_path, a.file, a.line")
+	weights := map[string]float64{InitNetwork: initNetworkWeight, InitExec: initExecWeight, DownloadExec: downloadExecWeight}
+	for r := range rows {
+		q.add(r.ModulePath, r.Version, r.Kind, weights[r.Kind],
+			fmt.Sprintf("%s: %s in %s:%d", r.Kind, r.Callee, r.File, r.Line))
+	}
+	return errf()
+}
+
+func (q *queue) addBlobs(ctx context.Context, db *sql.DB) error {
+	if ok, err := tableExists(ctx, db, Blobs.Table()); err != nil || !ok {
+		return err
+	}
+	type row struct {
+		ModulePath, Version, File string
+		Line, Length              int
+		Entropy                   float64
+		Decoded                   bool
+	}
+	// Prefer blobs that are decoded.
+	rows, errf := database.ScanRowsAs[row](ctx, db,
+		"SELECT a.module_path, a.version, a.file, a.line, a.length, a.entropy, a.decoded FROM "+Blobs.Table()+latestJoin+
+			" ORDER BY a.module_path, a.decoded DESC, a.length DESC")
+	for r := range rows {
+		w := float64(blobWeight)
+		if r.Decoded {
+			w = decodedBlobWeight
+		}
+		q.add(r.ModulePath, r.Version, "blob", w,
+			fmt.Sprintf("blob: %d bytes with entropy %.1f in %s:%d", r.Length, r.Entropy, r.File, r.Line))
+	}
+	return errf()
+}
+
+func (q *queue) addTyposquats(ctx context.Context, db *sql.DB, opts QueueOptions) error {
+	if ok, err := tableExists(ctx, db, "analysis_imports"); err != nil || !ok {
+		return err
+	}
+	popular, errf := database.ScanRowsOf[string](ctx, db, `
+		SELECT import_path FROM analysis_imports
+		WHERE instr(import_path, '.') > 0
+		GROUP BY import_path
+		ORDER BY COUNT(DISTINCT module_path) DESC
+		LIMIT ?`, opts.Popular)
+	s := newSquatter(popular)
+	if err := errf(); err != nil {
+		return err
+	}
+	type row struct {
+		Path, LatestVersion, InfoTime string
+	}
+	mods, errf := database.ScanRowsAs[row](ctx, db, "SELECT path, latest_version, info_time FROM modules WHERE latest_version != ''")
+	for m := range mods {
+		p := s.resembles(m.Path)
+		if p == "" {
+			continue
+		}
+		w := float64(typosquatWeight)
+		reason := "resembles " + p
+		if t, err := time.Parse(time.RFC3339, m.InfoTime); err == nil && opts.Now.Sub(t) < opts.Recent {
+			w += recentWeight
+			reason += ", published " + t.Format(time.DateOnly)
+		}
+		q.add(m.Path, m.LatestVersion, "typosquat", w, reason)
+	}
+	return errf()
+}
+
+func tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,183 @@
+package supplychain
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/analysis/analysistest"
+	"github.com/jba/go-ecosystem/ecodb"
+	_ "modernc.org/sqlite"
+)
+
+func TestFindCalls(t *testing.T) {
+	fset, files := analysistest.Parse(t, map[string]string{
+		"a.go": `package a
+
+import (
+	"net/http"
+	run "os/exec"
+)
+
+var resp, _ = http.Get("https://example.com")
+
+func init() { setup() }
+
+func setup() { run.Command("sh").Run() }
+
+func Fetch() {
+	http.Get("https://example.com/payload")
+	run.Command("/tmp/payload").Run()
+}
+`,
+		"a_test.go": `package a
+
+import "net/http"
+
+func init() { http.Get("x") }
+`,
+		"b/b.go": `package b
+
+import "net"
+
+func init() { fmt.Println(net.ParseIP("1.2.3.4")) }
+`,
+	})
+	var got []string
+	for _, c := range FindCalls(fset, files) {
+		got = append(got, fmt.Sprintf("%s:%d %s %s %s", c.File, c.Line, c.Func, c.Kind, c.Callee))
+	}
+	slices.Sort(got)
+	want := []string{
+		"a.go:12 setup init-exec os/exec.Command", // setup is called by init
+		"a.go:16 Fetch download-exec os/exec.Command",
+		"a.go:8 var init-network net/http.Get",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFindBlobs(t *testing.T) {
+	random := make([]byte, 600)
+	rand.Read(random)
+	b64 := base64.StdEncoding.EncodeToString(random)
+	fset, files := analysistest.Parse(t, map[string]string{
+		"a.go": "package a\n\nimport \"encoding/base64\"\n\nvar payload = `" + b64 + "`\n\nvar x, _ = base64.StdEncoding.DecodeString(payload)\n",
+		"b.go": "package a\n\nvar text = `" + strings.Repeat("the quick brown fox jumps over the lazy dog ", 20) + "`\n",
+		"c.go": "package a\n\nvar raw = []byte{" + byteList(random) + "}\n",
+		"g.go": "// Code generated by foo. DO NOT EDIT.\n\npackage a\n\nvar gen = `" + b64 + "`\n",
+	})
+	var got []string
+	for _, b := range FindBlobs(fset, files) {
+		got = append(got, fmt.Sprintf("%s:%d %d %t", b.File, b.Line, b.Length, b.Decoded))
+	}
+	want := []string{
+		fmt.Sprintf("a.go:5 %d true", len(b64)),
+		"c.go:3 600 false",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func byteList(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		fmt.Fprintf(&b, "0x%02x, ", c)
+	}
+	return b.String()
+}
+
+func TestResembles(t *testing.T) {
+	s := newSquatter(slices.Values([]string{
+		"github.com/sirupsen/logrus",
+		"github.com/stretchr/testify/assert",
+		"golang.org/x/mod/module",
+	}))
+	for _, test := range []struct {
+		path, want string
+	}{
+		{"github.com/sirupsen/logrus", ""},
+		{"github.com/Sirupsen/logrus", ""},
+		{"github.com/siruspen/logrus", "github.com/sirupsen/logrus"},
+		{"github.com/sirupsen/1ogrus", ""}, // same owner
+		{"github.com/stretchr/testify", ""},
+		{"github.com/strechr/testify", "github.com/stretchr/testify"},
+		{"golang.org/x/mad", ""}, // too short
+		{"example.com/unrelated", ""},
+	} {
+		if got := s.resembles(test.path); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestBuildQueue(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	exec := func(q string, args ...any) {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, q, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range []struct{ path, version, time string }{
+		{"example.com/bad", "v1.0.0", "2020-01-01T00:00:00Z"},
+		{"github.com/siruspen/logrus", "v1.0.0", "2026-09-20T00:00:00Z"},
+		{"github.com/sirupsen/logrus", "v1.9.0", "2023-01-01T00:00:00Z"},
+		{"example.com/user", "v1.0.0", "2024-01-01T00:00:00Z"},
+	} {
+		exec("INSERT INTO modules (path, error, latest_version, info_time) VALUES (?, '', ?, ?)", m.path, m.version, m.time)
+	}
+	exec("CREATE TABLE analysis_imports (module_path TEXT, version TEXT, file TEXT, import_path TEXT)")
+	exec("INSERT INTO analysis_imports VALUES ('example.com/user', 'v1.0.0', 'u.go', 'github.com/sirupsen/logrus')")
+	exec("CREATE TABLE " + Calls.Table() + " (module_path TEXT, version TEXT, file TEXT, line INTEGER, func TEXT, kind TEXT, callee TEXT)")
+	exec("INSERT INTO "+Calls.Table()+" VALUES (?, ?, 'b.go', 3, 'init', ?, 'net/http.Get')", "example.com/bad", "v1.0.0", InitNetwork)
+	exec("INSERT INTO "+Calls.Table()+" VALUES (?, ?, 'b.go', 4, 'init', ?, 'net/http.Get')", "example.com/bad", "v1.0.0", InitNetwork)
+	exec("INSERT INTO "+Calls.Table()+" VALUES (?, ?, 'b.go', 9, 'F', ?, 'os/exec.Command')", "example.com/bad", "v1.0.0", DownloadExec)
+	// Not the latest version.
+	exec("INSERT INTO "+Calls.Table()+" VALUES (?, ?, 'l.go', 1, 'init', ?, 'net.Dial')", "github.com/sirupsen/logrus", "v1.0.0", InitNetwork)
+
+	n, err := BuildQueue(ctx, db, QueueOptions{Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d items, want 2", n)
+	}
+	items, errf := Queue(ctx, db, 0)
+	var got []string
+	for it := range items {
+		got = append(got, fmt.Sprintf("%s %g %s", it.ModulePath, it.Score, it.Reasons))
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"example.com/bad 13 init-network: net/http.Get in b.go:3; download-exec: os/exec.Command in b.go:9",
+		"github.com/siruspen/logrus 8 resembles github.com/sirupsen/logrus, published 2026-09-20",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
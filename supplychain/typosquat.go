@@ -0,0 +1,95 @@
+package supplychain
+
+import (
+	"iter"
+	"strings"
+)
+
+// A squatter finds module paths that resemble popular import paths.
+type squatter struct {
+	// prefixes of popular paths, by number of path elements and length
+	byShape map[shape][]string
+	popular map[string]bool
+}
+
+type shape struct{ elems, length int }
+
+// maxDistance is the largest edit distance between a module path and
+// a popular path that it resembles.
+const maxDistance = 2
+
+// minSquatLen is the length of the shortest module path that is checked.
+// Short paths are too often close to each other by chance.
+const minSquatLen = 12
+
+func newSquatter(popular iter.Seq[string]) *squatter {
+	s := &squatter{byShape: map[shape][]string{}, popular: map[string]bool{}}
+	seen := map[string]bool{}
+	for p := range popular {
+		// Modules are compared with prefixes of packages with the same
+		// number of elements, since a popular package may be in a module
+		// with a shorter path.
+		elems := strings.Split(p, "/")
+		for n := 1; n <= len(elems); n++ {
+			pre := strings.Join(elems[:n], "/")
+			s.popular[pre] = true
+			if n < 2 || seen[pre] {
+				continue
+			}
+			seen[pre] = true
+			k := shape{n, len(pre)}
+			s.byShape[k] = append(s.byShape[k], pre)
+		}
+	}
+	return s
+}
+
+// resembles returns a popular path that modulePath resembles but isn't,
+// or "" if there is none.
+// Paths that differ only in case are not reported; see package modpath.
+func (s *squatter) resembles(modulePath string) string {
+	if len(modulePath) < minSquatLen || s.popular[modulePath] {
+		return ""
+	}
+	n := strings.Count(modulePath, "/") + 1
+	for dl := -maxDistance; dl <= maxDistance; dl++ {
+		for _, p := range s.byShape[shape{n, len(modulePath) + dl}] {
+			if strings.EqualFold(p, modulePath) || sameOwner(p, modulePath) {
+				continue
+			}
+			if distance(p, modulePath) <= maxDistance {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// sameOwner reports whether two paths share their first two elements,
+// like github.com/owner. Owners don't squat on their own names.
+func sameOwner(a, b string) bool {
+	ae := strings.SplitN(a, "/", 3)
+	be := strings.SplitN(b, "/", 3)
+	return len(ae) >= 3 && len(be) >= 3 && ae[0] == be[0] && ae[1] == be[1]
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
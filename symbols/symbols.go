@@ -0,0 +1,229 @@
+// Package symbols indexes the exported identifiers of the modules in the corpus.
+//
+// Symbols are extracted by the "symbols" analyzer (see package analysis)
+// and stored in its results table, so that finding the definitions of a
+// name across the ecosystem is a database query.
+package symbols
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"iter"
+	"path"
+	"strings"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/internal/database"
+)
+
+// Kinds of symbols.
+const (
+	Func   = "func"
+	Method = "method"
+	Type   = "type"
+	Var    = "var"
+	Const  = "const"
+)
+
+// A Symbol is an exported identifier declared at package level,
+// or an exported method.
+type Symbol struct {
+	ModulePath string
+	Version    string
+	Package    string // import path
+	Name       string
+	Kind       string
+	Receiver   string // for methods, the receiver's base type name
+	SigHash    string // hash of the declared type or signature; see [Extract]
+}
+
+// ID returns the symbol's qualified name, like "io.Reader" or "bytes.Buffer.Len".
+func (s *Symbol) ID() string {
+	if s.Receiver != "" {
+		return s.Package + "." + s.Receiver + "." + s.Name
+	}
+	return s.Package + "." + s.Name
+}
+
+// Analyzer extracts the symbols of a module.
+var Analyzer = &analysis.Analyzer{
+	Name:    "symbols",
+	Doc:     "record the exported identifiers of each package",
+	Version: 1,
+	Columns: []string{
+		"package TEXT NOT NULL",
+		"name TEXT NOT NULL",
+		"kind TEXT NOT NULL",
+		"receiver TEXT NOT NULL",
+		"sig_hash TEXT NOT NULL",
+	},
+	Indexes: []string{"name", "package, name"},
+	Run: func(pass *analysis.Pass) error {
+		for _, s := range Extract(pass.Fset, pass.Path, pass.Files) {
+			pass.Report(s.Package, s.Name, s.Kind, s.Receiver, s.SigHash)
+		}
+		return nil
+	},
+}
+
+func init() {
+	analysis.Register(Analyzer)
+}
+
+// Extract returns the symbols declared in the files of the module with the
+// given path. It skips test files, files of main packages, and files in
+// testdata and vendor directories. The ModulePath and Version fields of the
+// symbols are not set.
+//
+// SigHash is a hash of the source of a declaration's type: the signature of
+// a function or method, the definition of a type, or the explicit type of
+// a variable or constant. It changes when the declaration's type changes,
+// including the names of parameters.
+func Extract(fset *token.FileSet, modulePath string, files []*analysis.File) []*Symbol {
+	var syms []*Symbol
+	for _, f := range files {
+		if !indexed(f) {
+			continue
+		}
+		pkg := modulePath
+		if dir := path.Dir(f.Name); dir != "." {
+			pkg += "/" + dir
+		}
+		add := func(name, kind, recv string, typ ast.Node) {
+			if !token.IsExported(name) {
+				return
+			}
+			syms = append(syms, &Symbol{
+				Package:  pkg,
+				Name:     name,
+				Kind:     kind,
+				Receiver: recv,
+				SigHash:  hash(fset, typ),
+			})
+		}
+		for _, decl := range f.AST.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					add(d.Name.Name, Func, "", d.Type)
+				} else if recv := receiverName(d.Recv); recv != "" {
+					add(d.Name.Name, Method, recv, d.Type)
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						add(s.Name.Name, Type, "", s)
+					case *ast.ValueSpec:
+						kind := Var
+						if d.Tok == token.CONST {
+							kind = Const
+						}
+						for _, n := range s.Names {
+							add(n.Name, kind, "", s.Type)
+						}
+					}
+				}
+			}
+		}
+	}
+	return syms
+}
+
+// indexed reports whether the symbols of f belong in the index.
+func indexed(f *analysis.File) bool {
+	if strings.HasSuffix(f.Name, "_test.go") || f.AST.Name.Name == "main" {
+		return false
+	}
+	for _, elem := range strings.Split(path.Dir(f.Name), "/") {
+		if elem == "testdata" || elem == "vendor" {
+			return false
+		}
+	}
+	return true
+}
+
+// receiverName returns the base type name of a method receiver.
+func receiverName(recv *ast.FieldList) string {
+	if len(recv.List) == 0 {
+		return ""
+	}
+	t := recv.List[0].Type
+	for {
+		switch x := t.(type) {
+		case *ast.StarExpr:
+			t = x.X
+		case *ast.ParenExpr:
+			t = x.X
+		case *ast.IndexExpr:
+			t = x.X
+		case *ast.IndexListExpr:
+			t = x.X
+		case *ast.Ident:
+			return x.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// hash returns a short hash of the source of n, or the empty string if n is nil.
+func hash(fset *token.FileSet, n ast.Node) string {
+	if n == nil {
+		return ""
+	}
+	if ts, ok := n.(*ast.TypeSpec); ok {
+		// Omit the doc and comment.
+		n = &ast.TypeSpec{Name: ts.Name, TypeParams: ts.TypeParams, Assign: ts.Assign, Type: ts.Type}
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, n); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
+
+const selectSymbols = "SELECT module_path, version, package, name, kind, receiver, sig_hash FROM analysis_symbols"
+
+// Lookup returns the symbols with the given name, in any package, ordered
+// by package.
+func Lookup(ctx context.Context, db *sql.DB, name string) (iter.Seq[*Symbol], func() error) {
+	return database.ScanRowsAs[Symbol](ctx, db, selectSymbols+" WHERE name = ? ORDER BY package, receiver, module_path", name)
+}
+
+// InPackage returns the symbols of the package with the given import path,
+// ordered by name.
+func InPackage(ctx context.Context, db *sql.DB, pkg string) (iter.Seq[*Symbol], func() error) {
+	return database.ScanRowsAs[Symbol](ctx, db, selectSymbols+" WHERE package = ? ORDER BY receiver, name", pkg)
+}
+
+// Definitions returns the symbols whose qualified name, as returned by
+// [Symbol.ID], is id.
+func Definitions(ctx context.Context, db *sql.DB, id string) (iter.Seq[*Symbol], func() error) {
+	// The last element of id is the name. The one before it is either
+	// the receiver or part of the package path.
+	pkg, name := splitLast(id)
+	cond := "package = ? AND receiver = '' AND name = ?"
+	args := []any{pkg, name}
+	if p, recv := splitLast(pkg); p != "" {
+		cond = "(" + cond + ") OR (package = ? AND receiver = ? AND name = ?)"
+		args = append(args, p, recv, name)
+	}
+	return database.ScanRowsAs[Symbol](ctx, db, selectSymbols+" WHERE "+cond+" ORDER BY module_path", args...)
+}
+
+// splitLast splits s at its last dot. If there is none, it returns "", s.
+func splitLast(s string) (string, string) {
+	i := strings.LastIndexByte(s, '.')
+	if i < 0 {
+		return "", s
+	}
+	return s[:i], s[i+1:]
+}
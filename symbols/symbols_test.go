@@ -0,0 +1,143 @@
+package symbols
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/analysis/analysistest"
+	"github.com/jba/go-ecosystem/internal/database"
+	"golang.org/x/mod/module"
+	_ "modernc.org/sqlite"
+)
+
+var testFiles = map[string]string{
+	"a.go": `package a
+
+// T is a type.
+type T[E any] struct{ x E }
+
+func (t *T[E]) Len() int { return 0 }
+func (T[E]) private()    {}
+
+func New(n int) *T[int] { return nil }
+
+const (
+	Max     = 10
+	min     = 1
+	Typed int = 2
+)
+
+var X, y, Z string
+`,
+	"sub/b.go":      "package sub\n\nfunc F(s string) {}\n",
+	"sub/b_test.go": "package sub\n\nfunc TestHelper() {}\n",
+	"cmd/c/main.go": "package main\n\nfunc Exported() {}\n",
+	"testdata/d.go": "package d\n\nfunc D() {}\n",
+}
+
+func TestExtract(t *testing.T) {
+	fset, files := analysistest.Parse(t, testFiles)
+	var got []string
+	for _, s := range Extract(fset, "example.com/a", files) {
+		got = append(got, s.Kind+" "+s.ID())
+	}
+	want := []string{
+		"type example.com/a.T",
+		"method example.com/a.T.Len",
+		"func example.com/a.New",
+		"const example.com/a.Max",
+		"const example.com/a.Typed",
+		"var example.com/a.X",
+		"var example.com/a.Z",
+		"func example.com/a/sub.F",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestSigHash(t *testing.T) {
+	sig := func(src string) string {
+		fset, files := analysistest.Parse(t, map[string]string{"a.go": "package a\n" + src})
+		syms := Extract(fset, "m", files)
+		if len(syms) != 1 {
+			t.Fatalf("%s: got %d symbols", src, len(syms))
+		}
+		return syms[0].SigHash
+	}
+	f1 := sig("func F(int) error")
+	if f2 := sig("// F does things.\nfunc F(int) error { return nil }"); f1 != f2 {
+		t.Error("doc comment or body changed the hash")
+	}
+	if f3 := sig("func F(int64) error"); f1 == f3 {
+		t.Error("different signatures have the same hash")
+	}
+	if c := sig("const C = 1"); c != "" {
+		t.Errorf("untyped const: got hash %q, want empty", c)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Create the tables.
+	r := &analysis.Runner{DB: db, Analyzers: []*analysis.Analyzer{Analyzer}}
+	if _, err := r.Run(ctx, slices.Values([]module.Version(nil))); err != nil {
+		t.Fatal(err)
+	}
+	fset, files := analysistest.Parse(t, testFiles)
+	var rows [][]any
+	for _, v := range []string{"v1.0.0", "v1.1.0"} {
+		for _, s := range Extract(fset, "example.com/a", files) {
+			rows = append(rows, []any{"example.com/a", v, s.Package, s.Name, s.Kind, s.Receiver, s.SigHash})
+		}
+	}
+	err = database.Transaction(db, func(tx *sql.Tx) error {
+		_, err := database.BulkInsert(ctx, tx, Analyzer.Table(),
+			[]string{"module_path", "version", "package", "name", "kind", "receiver", "sig_hash"},
+			slices.Values(rows), 100)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(seq iter.Seq[*Symbol], errf func() error) []string {
+		t.Helper()
+		var ids []string
+		for s := range seq {
+			ids = append(ids, s.ID()+"@"+s.Version)
+		}
+		if err := errf(); err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	lenIDs := []string{"example.com/a.T.Len@v1.0.0", "example.com/a.T.Len@v1.1.0"}
+	fIDs := []string{"example.com/a/sub.F@v1.0.0", "example.com/a/sub.F@v1.1.0"}
+	for _, test := range []struct {
+		name  string
+		query func() (iter.Seq[*Symbol], func() error)
+		want  []string
+	}{
+		{"Lookup", func() (iter.Seq[*Symbol], func() error) { return Lookup(ctx, db, "Len") }, lenIDs},
+		{"InPackage", func() (iter.Seq[*Symbol], func() error) { return InPackage(ctx, db, "example.com/a/sub") }, fIDs},
+		{"Definitions method", func() (iter.Seq[*Symbol], func() error) { return Definitions(ctx, db, "example.com/a.T.Len") }, lenIDs},
+		{"Definitions func", func() (iter.Seq[*Symbol], func() error) { return Definitions(ctx, db, "example.com/a/sub.F") }, fIDs},
+		{"Definitions unknown", func() (iter.Seq[*Symbol], func() error) { return Definitions(ctx, db, "Len") }, nil},
+	} {
+		if got := ids(test.query()); !slices.Equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/logging"
+)
+
+// The remote protocol lets workers on other machines lease jobs from a
+// coordinator's [Queue]. A worker POSTs JSON to three endpoints:
+//
+//	claim   claimRequest -> Job; 404 if no job is ready
+//	extend  leaseRequest -> nothing; 409 if the lease is lost
+//	finish  finishRequest -> finishResponse; 409 if the lease is lost
+//
+// A job's result, such as the rows an analysis produced, travels with
+// the finish request; the coordinator stores it before finishing the job.
+
+type claimRequest struct {
+	Kind   string
+	Worker string
+	Lease  time.Duration
+}
+
+type leaseRequest struct {
+	ID     int64
+	Worker string
+	Lease  time.Duration
+}
+
+type finishRequest struct {
+	ID        int64
+	Worker    string
+	Result    []byte `json:",omitempty"`
+	Error     string `json:",omitempty"`
+	Temporary bool   `json:",omitempty"` // the error is of kind [errs.Temporary]
+}
+
+type finishResponse struct {
+	State State
+}
+
+// maxResultSize bounds the size of a finish request.
+const maxResultSize = 512 << 20
+
+// A ResultFunc stores the result of a job that a remote worker has run.
+// If it returns an error, the job is finished with that error instead.
+type ResultFunc func(ctx context.Context, job *Job, result []byte) error
+
+// Handler returns an HTTP handler that leases the jobs of q to remote
+// workers using a [Client]. Before a job of a kind in results is finished
+// successfully, its result is passed to the function for that kind.
+// If token is not empty, requests must present it as a bearer token.
+func Handler(q *Queue, token string, results map[string]ResultFunc) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /claim", func(w http.ResponseWriter, r *http.Request) {
+		var req claimRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		job, err := q.Claim(r.Context(), req.Kind, req.Worker, req.Lease)
+		if errors.Is(err, errs.NotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeResponse(w, r, job, err)
+	})
+	mux.HandleFunc("POST /extend", func(w http.ResponseWriter, r *http.Request) {
+		var req leaseRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		err := q.Extend(r.Context(), &Job{ID: req.ID, Worker: req.Worker}, req.Lease)
+		writeResponse(w, r, struct{}{}, err)
+	})
+	mux.HandleFunc("POST /finish", func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxResultSize)
+		var req finishRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		ctx := r.Context()
+		job := &Job{ID: req.ID, Worker: req.Worker}
+		// Check the lease before storing the result, so a worker whose
+		// lease has expired can't overwrite the result of the current one.
+		// The number of attempts comes from the queue, not the worker, so
+		// that a worker can't prolong retries.
+		kind, attempts, err := q.leased(ctx, job)
+		if err != nil {
+			writeResponse(w, r, nil, err)
+			return
+		}
+		job.Kind = kind
+		job.Attempts = attempts
+		var jobErr error
+		if req.Error != "" {
+			jobErr = errors.New(req.Error)
+			if req.Temporary {
+				jobErr = errs.WithKind(jobErr, errs.Temporary)
+			}
+		} else if f := results[kind]; f != nil {
+			jobErr = f(ctx, job, req.Result)
+		}
+		err = q.Finish(ctx, job, jobErr)
+		writeResponse(w, r, finishResponse{State: job.State}, err)
+	})
+	if token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+			http.Error(w, "bad or missing token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "decoding request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, v any, err error) {
+	switch {
+	case errors.Is(err, ErrLeaseLost):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		ctx := r.Context()
+		logging.FromContext(ctx).ErrorContext(ctx, "tasks: remote request", "url", r.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// A Client leases jobs from a [Handler] on a coordinator.
+// It is safe for concurrent use.
+type Client struct {
+	// URL is the URL of the handler.
+	URL string
+	// Token is presented to the handler as a bearer token, if not empty.
+	Token string
+	// HTTPClient sends requests. If nil, [httputil.DefaultClient] is used.
+	HTTPClient *http.Client
+}
+
+// Claim is like [Queue.Claim], for the coordinator's queue.
+func (c *Client) Claim(ctx context.Context, kind, worker string, lease time.Duration) (_ *Job, err error) {
+	defer errs.Wrap(&err, "tasks.Client.Claim(%s)", kind)
+	var job Job
+	if err := c.post(ctx, "claim", claimRequest{Kind: kind, Worker: worker, Lease: lease}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Extend is like [Queue.Extend], for the coordinator's queue.
+func (c *Client) Extend(ctx context.Context, job *Job, lease time.Duration) (err error) {
+	defer errs.Wrap(&err, "tasks.Client.Extend(%d)", job.ID)
+	return c.post(ctx, "extend", leaseRequest{ID: job.ID, Worker: job.Worker, Lease: lease}, nil)
+}
+
+// Finish is like [Queue.Finish], for the coordinator's queue. If jobErr is
+// nil, result is delivered to the coordinator's [ResultFunc] for the job's kind.
+func (c *Client) Finish(ctx context.Context, job *Job, result []byte, jobErr error) (err error) {
+	defer errs.Wrap(&err, "tasks.Client.Finish(%d)", job.ID)
+	req := finishRequest{ID: job.ID, Worker: job.Worker}
+	if jobErr != nil {
+		req.Error = jobErr.Error()
+		req.Temporary = errors.Is(jobErr, errs.Temporary)
+	} else {
+		req.Result = result
+	}
+	var resp finishResponse
+	if err := c.post(ctx, "finish", req, &resp); err != nil {
+		return err
+	}
+	job.State = resp.State
+	return nil
+}
+
+func (c *Client) finish(ctx context.Context, job *Job, result []byte, jobErr error) error {
+	return c.Finish(ctx, job, result, jobErr)
+}
+
+// Work is like [Queue.Work], but for jobs leased from the coordinator.
+// The result of f is delivered as described in [Client.Finish].
+func (c *Client) Work(ctx context.Context, kind string, opts WorkOptions, f func(context.Context, *Job) ([]byte, error)) (_ *Summary, err error) {
+	defer errs.Wrap(&err, "tasks.Client.Work(%s)", kind)
+	return work(ctx, c, kind, opts, f)
+}
+
+func (c *Client) post(ctx context.Context, endpoint string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(c.URL, "/")+"/"+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	var opts []httputil.Option
+	if c.HTTPClient != nil {
+		opts = append(opts, httputil.WithClient(c.HTTPClient))
+	}
+	data, err := httputil.DoReadBody(req, opts...)
+	if httputil.ErrorStatus(err) == http.StatusConflict {
+		return ErrLeaseLost
+	}
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
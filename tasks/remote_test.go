@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+)
+
+func TestRemote(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newQueue(t)
+	if _, err := q.Enqueue(ctx, "k", 0, slices.Values([]string{"a", "b", "c", "d"})); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu      sync.Mutex
+		results []string
+	)
+	h := Handler(q, "secret", map[string]ResultFunc{
+		"k": func(_ context.Context, j *Job, result []byte) error {
+			if string(result) == "c!" {
+				return errors.New("bad result")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, fmt.Sprintf("%d %s", j.ID, result))
+			return nil
+		},
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	if _, err := (&Client{URL: srv.URL}).Claim(ctx, "k", "w", time.Minute); httputil.ErrorStatus(err) != http.StatusUnauthorized {
+		t.Errorf("without token: got %v, want 401", err)
+	}
+
+	c := &Client{URL: srv.URL, Token: "secret"}
+	s, err := c.Work(ctx, "k", WorkOptions{Worker: "remote", Concurrency: 2}, func(_ context.Context, j *Job) ([]byte, error) {
+		if j.Key == "d" {
+			return nil, errs.Errorf(errs.Temporary, "later")
+		}
+		return []byte(j.Key + "!"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Done != 2 || s.Failed != 1 || s.Retried != 1 {
+		t.Errorf("got %d done, %d failed, %d retried; want 2, 1, 1", s.Done, s.Failed, s.Retried)
+	}
+	slices.Sort(results)
+	if want := []string{"1 a!", "2 b!"}; !slices.Equal(results, want) {
+		t.Errorf("got results %v, want %v", results, want)
+	}
+	jobs, errf := q.Jobs(ctx, "k", Failed, 0)
+	var failed []string
+	for j := range jobs {
+		failed = append(failed, j.Key+": "+j.Error)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c: bad result"}; !slices.Equal(failed, want) {
+		t.Errorf("got failed %v, want %v", failed, want)
+	}
+
+	// A worker that doesn't hold the lease can't finish the job.
+	if _, err := q.Enqueue(ctx, "k", 0, slices.Values([]string{"e"})); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.Claim(ctx, "k", "w1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Worker = "w2"
+	if err := c.Finish(ctx, j, []byte("e!"), nil); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("got %v, want ErrLeaseLost", err)
+	}
+	if err := c.Extend(ctx, j, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("got %v, want ErrLeaseLost", err)
+	}
+
+	// The number of attempts that decides a retry comes from the queue,
+	// not the worker.
+	j.Worker = "w1"
+	j.Attempts = 0
+	if err := c.Finish(ctx, j, nil, errs.Errorf(errs.Temporary, "later")); err != nil {
+		t.Fatal(err)
+	}
+	if j.State != Pending {
+		t.Errorf("got state %s, want %s", j.State, Pending)
+	}
+}
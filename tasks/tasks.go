@@ -0,0 +1,323 @@
+// Package tasks is a persistent queue of jobs, stored in the jobs table.
+//
+// Pipeline commands enqueue a job for each unit of work, identified by a
+// kind, like "download", and a key, like "path@version". Workers claim jobs,
+// holding a lease on each that they extend while they work. A job whose
+// worker crashes is claimed again when its lease expires, so a long run can
+// be stopped and restarted at any time without working out what is left.
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"iter"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// A State is the state of a job.
+type State string
+
+const (
+	Pending State = "pending" // waiting to be claimed
+	Running State = "running" // claimed by a worker
+	Done    State = "done"    // finished successfully
+	Failed  State = "failed"  // finished unsuccessfully, after all attempts
+)
+
+// A Job is a unit of work.
+type Job struct {
+	ID           int64
+	Kind         string
+	Key          string
+	Priority     int
+	State        State
+	Attempts     int
+	Worker       string
+	LeaseExpires string
+	NotBefore    string
+	Error        string
+	Created      string
+	Updated      string
+}
+
+var jobCols = []string{"id", "kind", "key", "priority", "state", "attempts", "worker",
+	"lease_expires", "not_before", "error", "created", "updated"}
+
+// ErrLeaseLost is returned when a worker finishes or extends a job
+// whose lease has been taken by another worker.
+var ErrLeaseLost = errors.New("lease lost")
+
+// A Queue is a view of the jobs table.
+// A Queue's fields should not be changed once it is in use.
+type Queue struct {
+	DB *sql.DB
+
+	// MaxAttempts is the number of times a job is attempted before it fails.
+	// Zero means 3.
+	MaxAttempts int
+
+	// Backoff is how long a job waits after its first failed attempt before
+	// it is retried. It doubles for each subsequent attempt. Zero means one minute.
+	Backoff time.Duration
+
+	// Retryable reports whether an error is retryable.
+	// If nil, errors of kind [errs.Temporary] are retryable.
+	Retryable func(error) bool
+
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+func (q *Queue) maxAttempts() int {
+	if q.MaxAttempts <= 0 {
+		return 3
+	}
+	return q.MaxAttempts
+}
+
+func (q *Queue) now() time.Time {
+	if q.Now != nil {
+		return q.Now()
+	}
+	return time.Now()
+}
+
+// timestamp formats t so that timestamps sort as strings in time order.
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Enqueue adds a pending job of the given kind for each key that doesn't
+// already have a job of that kind, in any state. It returns the number of
+// jobs added.
+func (q *Queue) Enqueue(ctx context.Context, kind string, priority int, keys iter.Seq[string]) (_ int, err error) {
+	defer errs.Wrap(&err, "tasks.Enqueue(%s)", kind)
+	now := timestamp(q.now())
+	var n int64
+	err = database.TransactionContext(ctx, q.DB, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		n = 0
+		stmt, err := tx.PrepareContext(ctx, `
+			INSERT INTO jobs (kind, key, priority, state, created, updated)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (kind, key) DO NOTHING`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for key := range keys {
+			res, err := stmt.ExecContext(ctx, kind, key, priority, Pending, now, now)
+			if err != nil {
+				return err
+			}
+			m, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			n += m
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// Claim claims the highest-priority job of the given kind that is ready to
+// run for worker, leasing it for the given duration. A job is ready if it is
+// pending and not waiting to be retried, or if it is running and its lease
+// has expired. A job whose lease has expired after its last attempt fails.
+// If no job is ready, Claim returns an error of kind [errs.NotFound].
+func (q *Queue) Claim(ctx context.Context, kind, worker string, lease time.Duration) (_ *Job, err error) {
+	defer errs.Wrap(&err, "tasks.Claim(%s)", kind)
+	now := q.now()
+	params := map[string]any{
+		"kind":         kind,
+		"worker":       worker,
+		"now":          timestamp(now),
+		"expires":      timestamp(now.Add(lease)),
+		"max_attempts": q.maxAttempts(),
+		"pending":      Pending,
+		"running":      Running,
+		"failed":       Failed,
+	}
+	query, args, err := database.Named(`
+		UPDATE jobs SET state = :failed, error = 'lease expired', worker = '', updated = :now
+		WHERE kind = :kind AND state = :running AND lease_expires < :now AND attempts >= :max_attempts`,
+		params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := database.ExecRetry(ctx, q.DB, query, args...); err != nil {
+		return nil, err
+	}
+	query, args, err = database.Named(`
+		UPDATE jobs SET state = :running, attempts = attempts + 1, worker = :worker, lease_expires = :expires, updated = :now
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE kind = :kind AND ((state = :pending AND not_before <= :now) OR (state = :running AND lease_expires < :now))
+			ORDER BY priority DESC, id
+			LIMIT 1)
+		RETURNING `+strings.Join(jobCols, ", "),
+		params)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := database.ScanRowsAsRetry[Job](ctx, q.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, errs.Errorf(errs.NotFound, "no %s jobs are ready", kind)
+	}
+	return jobs[0], nil
+}
+
+// Extend extends the lease of a running job by the given duration from now.
+// If the job's worker no longer holds the lease, it returns [ErrLeaseLost].
+func (q *Queue) Extend(ctx context.Context, job *Job, lease time.Duration) (err error) {
+	defer errs.Wrap(&err, "tasks.Extend(%d)", job.ID)
+	now := q.now()
+	return q.update(ctx, job, "lease_expires = ?, updated = ?", timestamp(now.Add(lease)), timestamp(now))
+}
+
+// Finish records the outcome of a running job. If jobErr is nil, the job is
+// done. Otherwise, if jobErr is retryable and the job has attempts left, it
+// is made pending again after a backoff; if not, it fails. Finish sets
+// job.State to the new state.
+// If the job's worker no longer holds the lease, Finish returns [ErrLeaseLost].
+func (q *Queue) Finish(ctx context.Context, job *Job, jobErr error) (err error) {
+	defer errs.Wrap(&err, "tasks.Finish(%d)", job.ID)
+	now := q.now()
+	ts := timestamp(now)
+	var state State
+	switch {
+	case jobErr == nil:
+		state = Done
+		err = q.update(ctx, job, "state = ?, worker = '', error = '', updated = ?", state, ts)
+	case job.Attempts < q.maxAttempts() && q.retryable(jobErr):
+		backoff := q.Backoff
+		if backoff <= 0 {
+			backoff = time.Minute
+		}
+		backoff <<= max(job.Attempts-1, 0)
+		state = Pending
+		err = q.update(ctx, job, "state = ?, worker = '', not_before = ?, error = ?, updated = ?",
+			state, timestamp(now.Add(backoff)), jobErr.Error(), ts)
+	default:
+		state = Failed
+		err = q.update(ctx, job, "state = ?, worker = '', error = ?, updated = ?", state, jobErr.Error(), ts)
+	}
+	if err != nil {
+		return err
+	}
+	job.State = state
+	return nil
+}
+
+func (q *Queue) retryable(err error) bool {
+	if q.Retryable != nil {
+		return q.Retryable(err)
+	}
+	return errors.Is(err, errs.Temporary)
+}
+
+// leased returns the kind and number of attempts of a job that its worker
+// holds. If the worker doesn't hold it, leased returns [ErrLeaseLost].
+func (q *Queue) leased(ctx context.Context, job *Job) (kind string, attempts int, err error) {
+	jobs, err := database.ScanRowsAsRetry[Job](ctx, q.DB, "SELECT kind, attempts FROM jobs WHERE id = ? AND worker = ? AND state = ?",
+		job.ID, job.Worker, Running)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(jobs) == 0 {
+		return "", 0, ErrLeaseLost
+	}
+	return jobs[0].Kind, jobs[0].Attempts, nil
+}
+
+// update sets columns of a job that its worker holds.
+func (q *Queue) update(ctx context.Context, job *Job, set string, args ...any) error {
+	args = append(args, job.ID, job.Worker, Running)
+	res, err := database.ExecRetry(ctx, q.DB, "UPDATE jobs SET "+set+" WHERE id = ? AND worker = ? AND state = ?", args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Retry makes the failed jobs of the given kind pending again, with no
+// attempts. It returns the number of jobs retried.
+func (q *Queue) Retry(ctx context.Context, kind string) (_ int, err error) {
+	defer errs.Wrap(&err, "tasks.Retry(%s)", kind)
+	res, err := database.ExecRetry(ctx, q.DB, `
+		UPDATE jobs SET state = ?, attempts = 0, not_before = '', updated = ?
+		WHERE kind = ? AND state = ?`,
+		Pending, timestamp(q.now()), kind, Failed)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Purge deletes the jobs of the given kind in the given state, or in all
+// states if state is empty. It returns the number of jobs deleted.
+func (q *Queue) Purge(ctx context.Context, kind string, state State) (_ int, err error) {
+	defer errs.Wrap(&err, "tasks.Purge(%s, %s)", kind, state)
+	query := "DELETE FROM jobs WHERE kind = ?"
+	args := []any{kind}
+	if state != "" {
+		query += " AND state = ?"
+		args = append(args, state)
+	}
+	res, err := database.ExecRetry(ctx, q.DB, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// A Count is the number of jobs of a kind in a state.
+type Count struct {
+	Kind  string
+	State State
+	N     int
+}
+
+// Counts returns the number of jobs of each kind in each state,
+// ordered by kind and state.
+func (q *Queue) Counts(ctx context.Context) ([]*Count, error) {
+	counts, errf := database.ScanRowsAs[Count](ctx, q.DB,
+		"SELECT kind, state, COUNT(*) AS n FROM jobs GROUP BY kind, state ORDER BY kind, state")
+	var cs []*Count
+	for c := range counts {
+		cs = append(cs, c)
+	}
+	return cs, errf()
+}
+
+// Jobs returns the jobs of the given kind in the given state,
+// in the order they would be claimed. If limit is positive,
+// at most limit jobs are returned.
+func (q *Queue) Jobs(ctx context.Context, kind string, state State, limit int) (iter.Seq[*Job], func() error) {
+	query, args := database.Select("jobs", jobCols...).
+		Where("kind = ?", kind).
+		Where("state = ?", state).
+		OrderBy("priority DESC", "id").
+		Limit(limit).SQL()
+	return database.ScanRowsAs[Job](ctx, q.DB, query, args...)
+}
@@ -0,0 +1,178 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/errs"
+	_ "modernc.org/sqlite"
+)
+
+func newQueue(t *testing.T) (*Queue, *time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	return &Queue{DB: db, Now: func() time.Time { return now }}, &now
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	q, now := newQueue(t)
+
+	n, err := q.Enqueue(ctx, "k", 0, slices.Values([]string{"a", "b"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2, err := q.Enqueue(ctx, "k", 1, slices.Values([]string{"b", "c"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || n2 != 1 {
+		t.Errorf("enqueued %d, %d; want 2, 1", n, n2)
+	}
+
+	claim := func(worker string) *Job {
+		t.Helper()
+		j, err := q.Claim(ctx, "k", worker, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return j
+	}
+	// The higher-priority job is claimed first, then in order of enqueuing.
+	c := claim("w1")
+	a := claim("w1")
+	b := claim("w2")
+	if got := []string{c.Key, a.Key, b.Key}; !slices.Equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("claimed %v, want [c a b]", got)
+	}
+	if _, err := q.Claim(ctx, "k", "w1", time.Minute); !errors.Is(err, errs.NotFound) {
+		t.Errorf("got %v, want NotFound", err)
+	}
+
+	// c succeeds; a fails permanently; b fails temporarily and is retried after a backoff.
+	if err := q.Finish(ctx, c, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Finish(ctx, a, errors.New("bad")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Finish(ctx, b, errs.Errorf(errs.Temporary, "later")); err != nil {
+		t.Fatal(err)
+	}
+	if c.State != Done || a.State != Failed || b.State != Pending {
+		t.Errorf("got states %s, %s, %s; want done, failed, pending", c.State, a.State, b.State)
+	}
+	if _, err := q.Claim(ctx, "k", "w1", time.Minute); !errors.Is(err, errs.NotFound) {
+		t.Errorf("during backoff: got %v, want NotFound", err)
+	}
+	*now = now.Add(time.Minute)
+	b = claim("w1")
+	if b.Key != "b" || b.Attempts != 2 {
+		t.Errorf("got %s with %d attempts, want b with 2", b.Key, b.Attempts)
+	}
+
+	// The lease expires, and another worker claims the job.
+	*now = now.Add(2 * time.Minute)
+	b2 := claim("w2")
+	if b2.Key != "b" || b2.Attempts != 3 {
+		t.Errorf("got %s with %d attempts, want b with 3", b2.Key, b2.Attempts)
+	}
+	if err := q.Finish(ctx, b, nil); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("finishing lost job: got %v, want ErrLeaseLost", err)
+	}
+	if err := q.Extend(ctx, b2, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// After its last attempt, a job whose lease expires fails.
+	*now = now.Add(2 * time.Minute)
+	if _, err := q.Claim(ctx, "k", "w1", time.Minute); !errors.Is(err, errs.NotFound) {
+		t.Errorf("got %v, want NotFound", err)
+	}
+
+	counts, err := q.Counts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range counts {
+		got = append(got, fmt.Sprintf("%s %s %d", c.Kind, c.State, c.N))
+	}
+	if want := []string{"k done 1", "k failed 2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	n, err = q.Retry(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("retried %d, want 2", n)
+	}
+	n, err = q.Purge(ctx, "k", Done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("purged %d, want 1", n)
+	}
+	jobs, errf := q.Jobs(ctx, "k", Pending, 0)
+	got = nil
+	for j := range jobs {
+		got = append(got, fmt.Sprintf("%s %d %q", j.Key, j.Attempts, j.Error))
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`a 0 "bad"`, `b 0 "lease expired"`}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWork(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newQueue(t)
+	var keys []string
+	for i := range 20 {
+		keys = append(keys, fmt.Sprint(i))
+	}
+	if _, err := q.Enqueue(ctx, "k", 0, slices.Values(keys)); err != nil {
+		t.Fatal(err)
+	}
+	s, err := q.Work(ctx, "k", WorkOptions{Worker: "w", Concurrency: 4}, func(_ context.Context, j *Job) error {
+		switch j.Key {
+		case "3":
+			return errors.New("bad")
+		case "4":
+			return errs.Errorf(errs.Temporary, "later")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Done != 18 || s.Failed != 1 || s.Retried != 1 || s.Errors.Len() != 2 {
+		t.Errorf("got %d done, %d failed, %d retried, %d errors; want 18, 1, 1, 2",
+			s.Done, s.Failed, s.Retried, s.Errors.Len())
+	}
+}
@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// WorkOptions configure [Queue.Work] and [Client.Work].
+type WorkOptions struct {
+	// Worker identifies the worker in the jobs table. It should be unique
+	// among the workers sharing the queue.
+	Worker string
+	// Concurrency is the number of jobs run at once. Zero means 1.
+	Concurrency int
+	// Lease is how long a job is leased for. The lease is extended
+	// while the job runs. Zero means five minutes.
+	Lease time.Duration
+	// Stop, if non-nil, is closed to stop claiming jobs, letting the
+	// running ones finish.
+	Stop <-chan struct{}
+}
+
+// A Summary describes the work of [Queue.Work] or [Client.Work].
+type Summary struct {
+	Done    int // jobs finished successfully
+	Retried int // jobs that failed and will be retried
+	Failed  int // jobs that failed after their last attempt
+	Errors  errs.Collector
+}
+
+// Work claims jobs of the given kind and calls f on each, until no job is
+// ready, opts.Stop is closed, or ctx is done. Errors from f are recorded in
+// the returned summary, and in the jobs table as described in [Queue.Finish].
+// Work returns an error only if it cannot continue.
+//
+// Jobs that are waiting to be retried, or that are leased by other workers,
+// are not waited for; call Work again to process them.
+func (q *Queue) Work(ctx context.Context, kind string, opts WorkOptions, f func(context.Context, *Job) error) (_ *Summary, err error) {
+	defer errs.Wrap(&err, "tasks.Work(%s)", kind)
+	return work(ctx, q, kind, opts, func(ctx context.Context, j *Job) ([]byte, error) {
+		return nil, f(ctx, j)
+	})
+}
+
+// A leaser leases jobs to workers: a [Queue], or a [Client] of a remote one.
+type leaser interface {
+	Claim(ctx context.Context, kind, worker string, lease time.Duration) (*Job, error)
+	Extend(ctx context.Context, job *Job, lease time.Duration) error
+	// finish is like [Queue.Finish], but also delivers the job's result.
+	finish(ctx context.Context, job *Job, result []byte, jobErr error) error
+}
+
+func (q *Queue) finish(ctx context.Context, job *Job, _ []byte, jobErr error) error {
+	return q.Finish(ctx, job, jobErr)
+}
+
+// work implements [Queue.Work] and [Client.Work].
+func work(ctx context.Context, l leaser, kind string, opts WorkOptions, f func(context.Context, *Job) ([]byte, error)) (*Summary, error) {
+	if opts.Lease <= 0 {
+		opts.Lease = 5 * time.Minute
+	}
+	s := &Summary{}
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i := range max(opts.Concurrency, 1) {
+		worker := opts.Worker
+		if opts.Concurrency > 1 {
+			worker = fmt.Sprintf("%s/%d", opts.Worker, i)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil && !stopped(opts.Stop) {
+				job, err := l.Claim(ctx, kind, worker, opts.Lease)
+				if errors.Is(err, errs.NotFound) {
+					return
+				}
+				if err != nil {
+					fail(err)
+					cancel()
+					return
+				}
+				result, jobErr := run(ctx, l, job, opts.Lease, f)
+				if ctx.Err() != nil {
+					// Interrupted; leave the job for its lease to expire.
+					return
+				}
+				err = l.finish(ctx, job, result, jobErr)
+				if errors.Is(err, ErrLeaseLost) {
+					// Another worker claimed the job after our lease expired.
+					continue
+				}
+				if err != nil {
+					fail(err)
+					cancel()
+					return
+				}
+				mu.Lock()
+				switch job.State {
+				case Done:
+					s.Done++
+				case Pending:
+					s.Retried++
+				default:
+					s.Failed++
+				}
+				if jobErr != nil {
+					s.Errors.Add(job.Key, jobErr)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return s, firstErr
+}
+
+func stopped(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// run calls f on job, extending the job's lease until f returns.
+func run(ctx context.Context, l leaser, job *Job, lease time.Duration, f func(context.Context, *Job) ([]byte, error)) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(lease / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err := l.Extend(ctx, job, lease); err != nil {
+					// Another worker has the job, or the database is unavailable;
+					// either way, stop working on it.
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return f(ctx, job)
+}
@@ -0,0 +1,242 @@
+// Package testmetrics measures how much of each module is tests.
+//
+// The "tests" analyzer (see package analysis) records, for each module,
+// the size of its test and non-test code and the number of tests,
+// benchmarks, fuzz targets and examples. [ByTier] aggregates the results
+// by the module's popularity.
+package testmetrics
+
+import (
+	"context"
+	"database/sql"
+	"go/ast"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+)
+
+// Footprint is the test footprint of a module version.
+type Footprint struct {
+	ModulePath     string
+	Version        string
+	Packages       int // packages with non-test files
+	TestedPackages int // packages with test files
+	ExternalTests  int // packages with an external test package (package p_test)
+	Files          int // non-test files
+	Lines          int // lines in non-test files
+	TestFiles      int
+	TestLines      int
+	Tests          int
+	Benchmarks     int
+	FuzzTargets    int
+	Examples       int
+}
+
+// Analyzer records the test footprint of each module.
+var Analyzer = &analysis.Analyzer{
+	Name:    "tests",
+	Doc:     "record the size of each module's tests and the kinds of test functions",
+	Version: 1,
+	Columns: []string{
+		"packages INTEGER NOT NULL",
+		"tested_packages INTEGER NOT NULL",
+		"external_tests INTEGER NOT NULL",
+		"files INTEGER NOT NULL",
+		"lines INTEGER NOT NULL",
+		"test_files INTEGER NOT NULL",
+		"test_lines INTEGER NOT NULL",
+		"tests INTEGER NOT NULL",
+		"benchmarks INTEGER NOT NULL",
+		"fuzz_targets INTEGER NOT NULL",
+		"examples INTEGER NOT NULL",
+	},
+	Run: func(pass *analysis.Pass) error {
+		fp := Measure(pass)
+		pass.Report(fp.Packages, fp.TestedPackages, fp.ExternalTests, fp.Files, fp.Lines,
+			fp.TestFiles, fp.TestLines, fp.Tests, fp.Benchmarks, fp.FuzzTargets, fp.Examples)
+		return nil
+	},
+}
+
+func init() {
+	analysis.Register(Analyzer)
+}
+
+// Measure computes the test footprint of the module in pass.
+// Files in testdata and vendor directories are ignored.
+func Measure(pass *analysis.Pass) *Footprint {
+	fp := &Footprint{ModulePath: pass.Path, Version: pass.Version}
+	pkgs := map[string]bool{}
+	tested := map[string]bool{}
+	external := map[string]bool{}
+	for _, f := range pass.Files {
+		if skipDir(f.Name) {
+			continue
+		}
+		dir := path.Dir(f.Name)
+		lines := pass.Fset.File(f.AST.Pos()).LineCount()
+		if !strings.HasSuffix(f.Name, "_test.go") {
+			pkgs[dir] = true
+			fp.Files++
+			fp.Lines += lines
+			continue
+		}
+		tested[dir] = true
+		if strings.HasSuffix(f.AST.Name.Name, "_test") {
+			external[dir] = true
+		}
+		fp.TestFiles++
+		fp.TestLines += lines
+		for _, d := range f.AST.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil {
+				continue
+			}
+			nparams := fd.Type.Params.NumFields()
+			switch name := fd.Name.Name; {
+			case isTestFunc(name, "Test") && nparams == 1:
+				fp.Tests++
+			case isTestFunc(name, "Benchmark") && nparams == 1:
+				fp.Benchmarks++
+			case isTestFunc(name, "Fuzz") && nparams == 1:
+				fp.FuzzTargets++
+			case isTestFunc(name, "Example") && nparams == 0:
+				fp.Examples++
+			}
+		}
+	}
+	fp.Packages = len(pkgs)
+	fp.TestedPackages = len(tested)
+	fp.ExternalTests = len(external)
+	return fp
+}
+
+// isTestFunc reports whether name is prefix followed by nothing or by
+// a character that is not a lower-case letter, as the go command requires.
+func isTestFunc(name, prefix string) bool {
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return false
+	}
+	if rest == "" {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return !unicode.IsLower(r)
+}
+
+func skipDir(name string) bool {
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem == "testdata" || elem == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
+// A Tier aggregates the footprints of modules with similar popularity.
+type Tier struct {
+	MinImporters int // the tier holds modules with at least this many importers
+	Modules      int
+	Tested       int // modules with at least one test
+	Fuzzed       int // modules with at least one fuzz target
+	Benchmarked  int // modules with at least one benchmark
+	Lines        int
+	TestLines    int
+}
+
+// tierBounds are the lower bounds of the tiers.
+var tierBounds = []int{0, 1, 10, 100, 1000}
+
+// ByTier aggregates the footprints of the latest versions of modules by
+// tier, from least to most popular. A module's popularity is the number of
+// other modules that import its packages, according to the imports analyzer;
+// if that has not been run, all modules are in the first tier.
+func ByTier(ctx context.Context, db *sql.DB) (_ []*Tier, err error) {
+	defer errs.Wrap(&err, "testmetrics.ByTier")
+	seq, errf := database.ScanRowsAs[Footprint](ctx, db, `
+		SELECT a.* FROM `+Analyzer.Table()+` a
+		JOIN modules m ON m.path = a.module_path AND m.latest_version = a.version`)
+	fps := slices.Collect(seq)
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, fp := range fps {
+		paths = append(paths, fp.ModulePath)
+	}
+	importers, err := countImporters(ctx, db, paths)
+	if err != nil {
+		return nil, err
+	}
+	tiers := make([]*Tier, len(tierBounds))
+	for i, b := range tierBounds {
+		tiers[i] = &Tier{MinImporters: b}
+	}
+	for _, fp := range fps {
+		n := importers[fp.ModulePath]
+		i := len(tierBounds) - 1
+		for tierBounds[i] > n {
+			i--
+		}
+		t := tiers[i]
+		t.Modules++
+		if fp.Tests > 0 {
+			t.Tested++
+		}
+		if fp.FuzzTargets > 0 {
+			t.Fuzzed++
+		}
+		if fp.Benchmarks > 0 {
+			t.Benchmarked++
+		}
+		t.Lines += fp.Lines
+		t.TestLines += fp.TestLines
+	}
+	return tiers, nil
+}
+
+// countImporters returns the number of other modules that import a package
+// of each module in paths.
+func countImporters(ctx context.Context, db *sql.DB, paths []string) (map[string]int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'analysis_imports'").Scan(&n)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	mods := map[string]bool{}
+	for _, p := range paths {
+		mods[p] = true
+	}
+	type row struct{ ModulePath, ImportPath string }
+	seq, errf := database.ScanRowsAs[row](ctx, db, "SELECT DISTINCT module_path, import_path FROM analysis_imports")
+	importers := map[string]map[string]bool{}
+	for r := range seq {
+		// Find the module of the import path by trying successively shorter prefixes.
+		for p := r.ImportPath; p != "."; p = path.Dir(p) {
+			if mods[p] {
+				if p != r.ModulePath {
+					if importers[p] == nil {
+						importers[p] = map[string]bool{}
+					}
+					importers[p][r.ModulePath] = true
+				}
+				break
+			}
+		}
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for p, ms := range importers {
+		counts[p] = len(ms)
+	}
+	return counts, nil
+}
@@ -0,0 +1,113 @@
+package testmetrics
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/analysis"
+	"github.com/jba/go-ecosystem/analysis/analysistest"
+	"github.com/jba/go-ecosystem/ecodb"
+	_ "modernc.org/sqlite"
+)
+
+func TestMeasure(t *testing.T) {
+	fset, files := analysistest.Parse(t, map[string]string{
+		"a.go": "package a\n\nfunc A() {}\n",
+		"a_test.go": `package a
+
+import "testing"
+
+func TestA(t *testing.T)      {}
+func Test(t *testing.T)       {}
+func Testify(t *testing.T)    {}
+func TestHelper()             {}
+func BenchmarkA(b *testing.B) {}
+func FuzzA(f *testing.F)      {}
+`,
+		"x_test.go":          "package a_test\n\nfunc ExampleA() {}\nfunc Example_b() {}\n",
+		"sub/b.go":           "package sub\n",
+		"testdata/t_test.go": "package t\n\nfunc TestT(t *testing.T) {}\n",
+	})
+	pass := &analysis.Pass{Path: "example.com/a", Version: "v1.0.0", Fset: fset, Files: files}
+	got := *Measure(pass)
+	want := Footprint{
+		ModulePath:     "example.com/a",
+		Version:        "v1.0.0",
+		Packages:       2,
+		TestedPackages: 1,
+		ExternalTests:  1,
+		Files:          2,
+		Lines:          4,
+		TestFiles:      2,
+		TestLines:      14,
+		Tests:          2,
+		Benchmarks:     1,
+		FuzzTargets:    1,
+		Examples:       2,
+	}
+	if got != want {
+		t.Errorf("got\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestByTier(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	exec := func(q string, args ...any) {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, q, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("CREATE TABLE " + Analyzer.Table() + ` (module_path TEXT, version TEXT, packages INTEGER, tested_packages INTEGER,
+		external_tests INTEGER, files INTEGER, lines INTEGER, test_files INTEGER, test_lines INTEGER, tests INTEGER,
+		benchmarks INTEGER, fuzz_targets INTEGER, examples INTEGER)`)
+	for _, r := range []struct {
+		path                        string
+		lines, testLines, tests, fz int
+	}{
+		{"example.com/lib", 100, 50, 3, 1},
+		{"example.com/a", 10, 0, 0, 0},
+		{"example.com/b", 20, 10, 1, 0},
+	} {
+		exec("INSERT INTO modules (path, error, latest_version, info_time) VALUES (?, '', 'v1.0.0', '')", r.path)
+		exec("INSERT INTO "+Analyzer.Table()+" VALUES (?, 'v1.0.0', 1, 1, 0, 1, ?, 1, ?, ?, 0, ?, 0)", r.path, r.lines, r.testLines, r.tests, r.fz)
+	}
+	exec("CREATE TABLE analysis_imports (module_path TEXT, version TEXT, file TEXT, import_path TEXT)")
+	exec("INSERT INTO analysis_imports VALUES ('example.com/a', 'v1.0.0', 'a.go', 'example.com/lib/sub')")
+	exec("INSERT INTO analysis_imports VALUES ('example.com/b', 'v1.0.0', 'b.go', 'example.com/lib')")
+	exec("INSERT INTO analysis_imports VALUES ('example.com/lib', 'v1.0.0', 'l.go', 'example.com/lib/internal')")
+
+	tiers, err := ByTier(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Tier
+	for _, t := range tiers {
+		got = append(got, *t)
+	}
+	want := []Tier{
+		{MinImporters: 0, Modules: 2, Tested: 1, Lines: 30, TestLines: 10},
+		{MinImporters: 1, Modules: 1, Tested: 1, Fuzzed: 1, Lines: 100, TestLines: 50},
+		{MinImporters: 10},
+		{MinImporters: 100},
+		{MinImporters: 1000},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", got, want)
+	}
+}
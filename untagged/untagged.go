@@ -0,0 +1,233 @@
+// Package untagged finds versions of modules with no tagged versions.
+//
+// If a module has no tagged versions and none of its pseudo-versions has
+// been fetched in a while, the proxy's list and @latest endpoints return
+// nothing, though the proxy still serves the pseudo-versions themselves.
+// (An example is cloud.google.com/go/compute/metadata.) Such a module is
+// not dead: its pseudo-versions appear in the index, and in the go.mod
+// files of the modules that depend on it. This package records those
+// versions in the versions table, so that the latest of them can stand in
+// for the latest version the proxy doesn't report.
+package untagged
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"time"
+
+	"github.com/jba/go-ecosystem/index"
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/versions"
+	"golang.org/x/mod/module"
+)
+
+// Sources of versions.
+const (
+	Index = "index"  // an entry in the module index
+	GoMod = "go.mod" // a requirement in the go.mod file of another module
+)
+
+// A Version is a known version of a module, as stored in the versions table.
+type Version struct {
+	ModulePath string
+	Version    string
+	Source     string
+	Time       string // RFC 3339; empty if unknown
+}
+
+// Record adds vs to the versions table. Versions already there, and
+// versions the go command would reject, are ignored.
+// It returns the number of versions added.
+func Record(ctx context.Context, db *sql.DB, vs []Version) (_ int, err error) {
+	defer errs.Wrap(&err, "untagged.Record")
+	var n int
+	err = database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		n = 0
+		stmt, err := tx.PrepareContext(ctx, `
+			INSERT INTO versions (module_path, version, source, time) VALUES (?, ?, ?, ?)
+			ON CONFLICT DO NOTHING`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, v := range vs {
+			cv, err := versions.Canonical(v.ModulePath, v.Version)
+			if err != nil || cv != v.Version {
+				continue
+			}
+			if v.Time == "" {
+				v.Time = pseudoTime(v.Version)
+			}
+			res, err := stmt.ExecContext(ctx, v.ModulePath, v.Version, v.Source, v.Time)
+			if err != nil {
+				return err
+			}
+			m, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			n += int(m)
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Known returns the known versions of the module, in no particular order.
+func Known(ctx context.Context, db *sql.DB, path string) (iter.Seq[*Version], func() error) {
+	return database.ScanRowsAs[Version](ctx, db, `SELECT * FROM versions WHERE module_path = ?`, path)
+}
+
+// Latest returns the latest known version of the module, or the empty
+// string if none is known.
+func Latest(ctx context.Context, db *sql.DB, path string) (_ string, err error) {
+	defer errs.Wrap(&err, "untagged.Latest(%s)", path)
+	vs, errf := Known(ctx, db, path)
+	var all []string
+	for v := range vs {
+		all = append(all, v.Version)
+	}
+	if err := errf(); err != nil {
+		return "", err
+	}
+	return versions.LatestOf(all), nil
+}
+
+// A Crawler finds versions of modules whose proxy information is a
+// "no versions" error, or that are already untagged.
+type Crawler struct {
+	DB *sql.DB
+	// Since, if not empty, is the index timestamp to start reading the
+	// index from. If empty, the index isn't read.
+	Since string
+	// Entries reads the index. If nil, [index.Entries] is used.
+	Entries func(ctx context.Context, since string) (iter.Seq[*index.Entry], func() error)
+	// Now is the current time. The default is time.Now().
+	Now time.Time
+}
+
+// A Summary describes the work of [Crawler.Crawl].
+type Summary struct {
+	Modules  int // modules with no versions from the proxy
+	Versions int // versions added to the versions table
+	Alive    int // modules marked untagged, or whose latest version changed
+}
+
+// Crawl collects versions of the modules from the requirements table, and
+// from the index if c.Since is set, and records them. Then it marks each of
+// the modules that has a known version as untagged, clearing its error and
+// setting its latest version to the latest known one.
+func (c *Crawler) Crawl(ctx context.Context) (_ *Summary, err error) {
+	defer errs.Wrap(&err, "untagged.Crawl")
+	now := c.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	paths, err := c.modules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &Summary{Modules: len(paths)}
+	if len(paths) == 0 {
+		return s, nil
+	}
+
+	// Requirements of dependents.
+	var found []Version
+	rows, errf := database.ScanRows(ctx, c.DB, `
+		SELECT DISTINCT r.req_path, r.req_version FROM requirements r
+		JOIN modules m ON m.path = r.req_path
+		WHERE m.error_kind = ? OR m.untagged`, errs.NoVersions.Error())
+	for r := range rows {
+		v := Version{Source: GoMod}
+		if err := r.Scan(&v.ModulePath, &v.Version); err != nil {
+			return nil, err
+		}
+		found = append(found, v)
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+
+	// Index history.
+	if c.Since != "" {
+		entries := c.Entries
+		if entries == nil {
+			entries = func(ctx context.Context, since string) (iter.Seq[*index.Entry], func() error) {
+				return index.Entries(ctx, since, nil)
+			}
+		}
+		es, errf := entries(ctx, c.Since)
+		for e := range es {
+			if paths[e.Path] {
+				found = append(found, Version{ModulePath: e.Path, Version: e.Version, Source: Index, Time: e.Timestamp})
+			}
+		}
+		if err := errf(); err != nil {
+			return nil, err
+		}
+	}
+	s.Versions, err = Record(ctx, c.DB, found)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark the modules with known versions.
+	refreshed := now.UTC().Format(time.RFC3339)
+	for path := range paths {
+		vs, errf := Known(ctx, c.DB, path)
+		var latest *Version
+		for v := range vs {
+			if latest == nil || versions.Later(v.Version, latest.Version) {
+				latest = v
+			}
+		}
+		if err := errf(); err != nil {
+			return nil, err
+		}
+		if latest == nil {
+			continue
+		}
+		res, err := c.DB.ExecContext(ctx, `
+			UPDATE modules SET error = '', error_kind = '', untagged = 1,
+				latest_version = ?, info_time = ?, refreshed = ?
+			WHERE path = ? AND NOT (untagged AND latest_version = ?)`,
+			latest.Version, pseudoTime(latest.Version), refreshed, path, latest.Version)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		s.Alive += int(n)
+	}
+	return s, nil
+}
+
+// modules returns the paths of the modules to crawl.
+func (c *Crawler) modules(ctx context.Context) (map[string]bool, error) {
+	paths := map[string]bool{}
+	rows, errf := database.ScanRows(ctx, c.DB, `SELECT path FROM modules WHERE error_kind = ? OR untagged`,
+		errs.NoVersions.Error())
+	for r := range rows {
+		var path string
+		if err := r.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths[path] = true
+	}
+	return paths, errf()
+}
+
+// pseudoTime returns the time of a pseudo-version in RFC 3339 format,
+// or the empty string if v isn't one.
+func pseudoTime(v string) string {
+	t, err := module.PseudoVersionTime(v)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
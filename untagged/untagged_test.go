@@ -0,0 +1,123 @@
+package untagged
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/index"
+	"github.com/jba/go-ecosystem/internal/database"
+	_ "modernc.org/sqlite"
+)
+
+func TestCrawl(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	exec := func(q string, args ...any) {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, q, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const (
+		pseudo1 = "v0.0.0-20181107005212-dafb9c8d8707"
+		pseudo2 = "v0.0.0-20200101000000-abcdefabcdef"
+		pseudo3 = "v0.0.0-20210101000000-abcdefabcdef"
+	)
+	for _, m := range []struct{ path, errKind string }{
+		{"example.com/meta", "no versions"},
+		{"example.com/quiet", "no versions"},
+		{"example.com/gone", "gone"},
+		{"example.com/dep", ""},
+		{"example.com/indexed", "no versions"},
+	} {
+		exec(`INSERT INTO modules (path, error, error_kind, latest_version, info_time) VALUES (?, ?, ?, '', '')`,
+			m.path, m.errKind, m.errKind)
+	}
+	for _, r := range [][4]string{
+		{"example.com/dep", "v1.0.0", "example.com/meta", pseudo1},
+		{"example.com/dep", "v1.1.0", "example.com/meta", pseudo2},
+		{"example.com/dep", "v1.2.0", "example.com/gone", pseudo1},
+		{"example.com/dep", "v1.3.0", "example.com/meta", "bad"},
+	} {
+		exec(`INSERT INTO requirements VALUES (?, ?, ?, ?, 0)`, r[0], r[1], r[2], r[3])
+	}
+	entries := []*index.Entry{
+		{Path: "example.com/indexed", Version: pseudo3, Timestamp: "2021-01-02T00:00:00Z"},
+		{Path: "example.com/dep", Version: "v1.3.0", Timestamp: "2021-01-03T00:00:00Z"},
+	}
+	c := &Crawler{
+		DB:    db,
+		Since: "2019-01-01T00:00:00Z",
+		Entries: func(context.Context, string) (iter.Seq[*index.Entry], func() error) {
+			return slices.Values(entries), func() error { return nil }
+		},
+		Now: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	s, err := c.Crawl(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Summary{Modules: 3, Versions: 3, Alive: 2}); *s != want {
+		t.Errorf("got %+v, want %+v", *s, want)
+	}
+
+	mods, errf := database.ScanRowsAs[ecodb.Module](ctx, db, `SELECT * FROM modules ORDER BY path`)
+	got := map[string]ecodb.Module{}
+	for m := range mods {
+		m.ID = 0
+		got[m.Path] = *m
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ecodb.Module{
+		"example.com/meta": {
+			Path: "example.com/meta", LatestVersion: pseudo2, InfoTime: "2020-01-01T00:00:00Z",
+			Refreshed: "2026-10-01T00:00:00Z", Untagged: true,
+		},
+		"example.com/indexed": {
+			Path: "example.com/indexed", LatestVersion: pseudo3, InfoTime: "2021-01-01T00:00:00Z",
+			Refreshed: "2026-10-01T00:00:00Z", Untagged: true,
+		},
+		"example.com/quiet": {Path: "example.com/quiet", Error: "no versions", ErrorKind: "no versions"},
+	}
+	for path, w := range want {
+		if g := got[path]; g != w {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", path, g, w)
+		}
+	}
+
+	// A second crawl finds nothing new.
+	s, err = c.Crawl(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Summary{Modules: 3}); *s != want {
+		t.Errorf("second crawl: got %+v, want %+v", *s, want)
+	}
+
+	latest, err := Latest(ctx, db, "example.com/meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != pseudo2 {
+		t.Errorf("Latest = %q, want %q", latest, pseudo2)
+	}
+}
@@ -0,0 +1,370 @@
+// Package validate cross-checks the data that eco keeps in different places:
+// the database, the corpus of module zips, the cache of proxy responses,
+// and the proxy itself. It reports the inconsistencies it finds as a
+// [Plan] of repairs, which can be applied.
+package validate
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/modfs"
+	"github.com/jba/go-ecosystem/proxy/cache"
+	"golang.org/x/mod/module"
+)
+
+// Layers in which problems are found.
+const (
+	DB     = "db"
+	Corpus = "corpus"
+	Cache  = "cache"
+)
+
+// A Problem is an inconsistency, with the repair for it.
+type Problem struct {
+	Layer   string // where the problem was found
+	Subject string // a module, module version or file
+	Issue   string // what is wrong
+	Repair  string // what Plan.Apply does about it
+
+	repair func(context.Context) error
+}
+
+func (p *Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Layer, p.Subject, p.Issue)
+}
+
+// A Plan is the result of [Checker.Check].
+type Plan struct {
+	Problems []*Problem
+	// Sampled is the number of modules checked against the proxy.
+	Sampled int
+	// Unchecked is the number of sampled modules that couldn't be
+	// checked because of transient proxy errors.
+	Unchecked int
+}
+
+// Apply repairs the problems of the plan. It returns the number repaired.
+// A failed repair doesn't stop the others.
+func (p *Plan) Apply(ctx context.Context) (int, error) {
+	var (
+		n       int
+		errList []error
+	)
+	for _, pr := range p.Problems {
+		if err := ctx.Err(); err != nil {
+			errList = append(errList, err)
+			break
+		}
+		if err := pr.repair(ctx); err != nil {
+			errList = append(errList, fmt.Errorf("%s: %w", pr, err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errList...)
+}
+
+// A Checker checks for problems.
+type Checker struct {
+	DB *sql.DB
+	// CorpusDir is the corpus directory. If empty, the corpus isn't checked.
+	CorpusDir string
+	// CacheDir is the directory of cached proxy responses.
+	// If empty, the cache isn't checked.
+	CacheDir string
+	// Sample is the number of modules, chosen at random, whose latest
+	// versions are compared with the proxy's.
+	Sample int
+	// Latest returns the latest version of a module from the proxy.
+	// If nil, the proxy isn't checked.
+	Latest func(ctx context.Context, path string) (string, error)
+	// Download arranges for a module version to be saved in the corpus.
+	// If nil, missing and stale zips are reported but can't be repaired.
+	Download func(ctx context.Context, mv module.Version) error
+}
+
+// Check checks each layer and returns the plan to repair the problems it finds.
+func (c *Checker) Check(ctx context.Context) (_ *Plan, err error) {
+	defer errs.Wrap(&err, "validate.Check")
+	p := &Plan{}
+	if c.Latest != nil && c.Sample > 0 {
+		if err := c.checkProxy(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+	if c.CorpusDir != "" {
+		if err := c.checkCorpus(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+	if c.CacheDir != "" {
+		if err := c.checkCache(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// checkProxy compares the stored latest versions of a sample of modules
+// with the proxy. Untagged modules are skipped, because the proxy doesn't
+// report their latest versions; see package untagged.
+func (c *Checker) checkProxy(ctx context.Context, p *Plan) error {
+	rows, err := c.DB.QueryContext(ctx, `
+		SELECT path, latest_version FROM modules
+		WHERE error = '' AND latest_version != '' AND NOT untagged
+		ORDER BY random() LIMIT ?`, c.Sample)
+	if err != nil {
+		return err
+	}
+	type mod struct{ path, latest string }
+	var mods []mod
+	for rows.Next() {
+		var m mod
+		if err := rows.Scan(&m.path, &m.latest); err != nil {
+			rows.Close()
+			return err
+		}
+		mods = append(mods, m)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, m := range mods {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p.Sampled++
+		latest, err := c.Latest(ctx, m.path)
+		switch {
+		case errors.Is(err, errs.NotFound), errors.Is(err, errs.Gone), errors.Is(err, errs.NoVersions):
+			p.add(DB, m.path, fmt.Sprintf("latest is %s, but the proxy says: %v", m.latest, err),
+				"record the error", func(ctx context.Context) error {
+					var mod ecodb.Module
+					mod.SetError(err)
+					_, err := c.DB.ExecContext(ctx, `UPDATE modules SET error = ?, error_kind = ? WHERE path = ?`,
+						mod.Error, mod.ErrorKind, m.path)
+					return err
+				})
+		case err != nil:
+			p.Unchecked++
+		case latest != m.latest:
+			p.add(DB, m.path, fmt.Sprintf("latest is %s, but the proxy's is %s", m.latest, latest),
+				"clear the latest version, so the next update refetches it", func(ctx context.Context) error {
+					_, err := c.DB.ExecContext(ctx, `UPDATE modules SET latest_version = '' WHERE path = ?`, m.path)
+					return err
+				})
+		}
+	}
+	return nil
+}
+
+// checkCorpus compares the zips in the corpus with the latest versions of
+// modules and the versions that have been analyzed.
+func (c *Checker) checkCorpus(ctx context.Context, p *Plan) error {
+	latest := map[string]string{}
+	rows, err := c.DB.QueryContext(ctx, `SELECT path, latest_version FROM modules`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var path, version string
+		if err := rows.Scan(&path, &version); err != nil {
+			rows.Close()
+			return err
+		}
+		latest[path] = version
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	// Versions that are in the corpus, or will be after the repairs.
+	inCorpus := map[module.Version]bool{}
+	for mv, file := range modfs.ZipFiles(c.CorpusDir) {
+		inCorpus[mv] = true
+		lv, ok := latest[mv.Path]
+		switch {
+		case !ok:
+			p.add(Corpus, file, "module is not in the database", "remove the file", removeFile(file))
+		case !validZip(file):
+			p.add(Corpus, file, "not a valid zip", c.redownload(mv), func(ctx context.Context) error {
+				if err := os.Remove(file); err != nil {
+					return err
+				}
+				return c.download(ctx, mv)
+			})
+		case lv != "" && lv != mv.Version:
+			lmv := module.Version{Path: mv.Path, Version: lv}
+			inCorpus[lmv] = true
+			p.add(Corpus, mv.String(), "latest version is "+lv, c.redownload(lmv), func(ctx context.Context) error {
+				return c.download(ctx, lmv)
+			})
+		}
+	}
+
+	// Analyzed versions should be in the corpus.
+	ok, err := tableExists(ctx, c.DB, "analysis_runs")
+	if err != nil {
+		return err
+	}
+	if ok {
+		rows, err := c.DB.QueryContext(ctx, `
+			SELECT DISTINCT r.module_path, r.version FROM analysis_runs r
+			JOIN modules m ON m.path = r.module_path AND m.latest_version = r.version
+			ORDER BY r.module_path`)
+		if err != nil {
+			return err
+		}
+		var missing []module.Version
+		for rows.Next() {
+			var mv module.Version
+			if err := rows.Scan(&mv.Path, &mv.Version); err != nil {
+				rows.Close()
+				return err
+			}
+			if !inCorpus[mv] {
+				missing = append(missing, mv)
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		for _, mv := range missing {
+			p.add(Corpus, mv.String(), "analyzed, but missing from the corpus", c.redownload(mv), func(ctx context.Context) error {
+				return c.download(ctx, mv)
+			})
+		}
+	}
+
+	// Interrupted downloads leave temporary files.
+	return filepath.WalkDir(c.CorpusDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(file, ".tmp") {
+			p.add(Corpus, file, "leftover temporary file", "remove the file", removeFile(file))
+		}
+		return nil
+	})
+}
+
+// checkCache checks that the files in the proxy cache begin with the status
+// line of a cacheable response. See package [cache].
+func (c *Checker) checkCache(p *Plan) error {
+	return filepath.WalkDir(c.CacheDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "validators" && file != c.CacheDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if file == filepath.Join(c.CacheDir, cache.IndexFile) {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			p.add(Cache, file, "leftover temporary file", "remove the file", removeFile(file))
+			return nil
+		}
+		if issue, err := checkCacheFile(file); err != nil {
+			return err
+		} else if issue != "" {
+			p.add(Cache, file, issue, "remove the file", removeFile(file))
+		}
+		return nil
+	})
+}
+
+// checkCacheFile returns a description of what is wrong with the status line
+// of the cache file, or the empty string if nothing is.
+func checkCacheFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	// The status line is short.
+	buf := make([]byte, 16)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	line, _, ok := bytes.Cut(buf[:n], []byte("\n"))
+	if !ok {
+		return "missing status line", nil
+	}
+	status, err := strconv.Atoi(string(line))
+	if err != nil {
+		return fmt.Sprintf("bad status %q", line), nil
+	}
+	if !(status >= 200 && status < 300 || status == 404 || status == 410) {
+		return fmt.Sprintf("status %d is not cacheable", status), nil
+	}
+	return "", nil
+}
+
+func (p *Plan) add(layer, subject, issue, repair string, f func(context.Context) error) {
+	p.Problems = append(p.Problems, &Problem{Layer: layer, Subject: subject, Issue: issue, Repair: repair, repair: f})
+}
+
+func (c *Checker) redownload(mv module.Version) string {
+	if c.Download == nil {
+		return "none"
+	}
+	return "download " + mv.String()
+}
+
+func (c *Checker) download(ctx context.Context, mv module.Version) error {
+	if c.Download == nil {
+		return errors.New("no way to download")
+	}
+	return c.Download(ctx, mv)
+}
+
+// removeFile returns a repair that removes file. An earlier repair,
+// like a download, may have removed it already.
+func removeFile(file string) func(context.Context) error {
+	return func(context.Context) error {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+}
+
+// validZip reports whether file can be read as a zip.
+func validZip(file string) bool {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return false
+	}
+	zr.Close()
+	return true
+}
+
+func tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+	return n > 0, err
+}
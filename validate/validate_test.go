@@ -0,0 +1,170 @@
+package validate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/modfs"
+	"golang.org/x/mod/module"
+	_ "modernc.org/sqlite"
+)
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	exec := func(q string, args ...any) {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, q, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range [][2]string{
+		{"example.com/ok", "v1.0.0"},
+		{"example.com/behind", "v1.0.0"},
+		{"example.com/gone", "v1.0.0"},
+		{"example.com/corrupt", "v1.0.0"},
+		{"example.com/analyzed", "v1.1.0"},
+		{"example.com/lost", "v1.0.0"},
+	} {
+		exec(`INSERT INTO modules (path, error, latest_version, info_time) VALUES (?, '', ?, '')`, m[0], m[1])
+	}
+	exec(`CREATE TABLE analysis_runs (analyzer TEXT, module_path TEXT, version TEXT, analyzer_version INTEGER)`)
+	exec(`INSERT INTO analysis_runs VALUES ('imports', 'example.com/analyzed', 'v1.1.0', 1)`)
+	exec(`INSERT INTO analysis_runs VALUES ('imports', 'example.com/lost', 'v1.0.0', 1)`)
+
+	corpus := t.TempDir()
+	writeZip := func(path, version string) string {
+		t.Helper()
+		corpustest.WriteZip(t, corpus, path, version, nil)
+		file, err := modfs.ZipPath(corpus, path, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	writeFile := func(file, contents string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeZip("example.com/ok", "v1.0.0")
+	writeZip("example.com/analyzed", "v1.0.0")
+	unknown := writeZip("example.com/unknown", "v1.0.0")
+	corrupt := writeZip("example.com/corrupt", "v1.0.0")
+	writeFile(corrupt, "not a zip")
+	tmp := filepath.Join(corpus, "example.com/ok/@v/v1.0.0.zip.123.tmp")
+	writeFile(tmp, "")
+
+	cache := t.TempDir()
+	writeFile(filepath.Join(cache, "good"), "200\nv1.0.0\n")
+	writeFile(filepath.Join(cache, "notfound"), "404\n")
+	writeFile(filepath.Join(cache, "validators", "x"), "{}")
+	writeFile(filepath.Join(cache, "index.json"), "[]")
+	writeFile(filepath.Join(cache, "bad"), "v1.0.0\n")
+	writeFile(filepath.Join(cache, "error"), "500\noops")
+	writeFile(filepath.Join(cache, ".tmp-1"), "200\n")
+
+	var downloads []string
+	c := &Checker{
+		DB:        db,
+		CorpusDir: corpus,
+		CacheDir:  cache,
+		Sample:    10,
+		Latest: func(_ context.Context, path string) (string, error) {
+			switch path {
+			case "example.com/behind":
+				return "v1.2.0", nil
+			case "example.com/gone":
+				return "", errs.Gone
+			case "example.com/analyzed":
+				return "v1.1.0", nil
+			}
+			return "v1.0.0", nil
+		},
+		Download: func(_ context.Context, mv module.Version) error {
+			downloads = append(downloads, mv.String())
+			return nil
+		},
+	}
+	p, err := c.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Sampled != 6 || p.Unchecked != 0 {
+		t.Errorf("sampled %d, unchecked %d; want 6, 0", p.Sampled, p.Unchecked)
+	}
+	var got []string
+	for _, pr := range p.Problems {
+		got = append(got, pr.Layer+" "+pr.Subject)
+	}
+	slices.Sort(got)
+	want := []string{
+		"cache " + filepath.Join(cache, ".tmp-1"),
+		"cache " + filepath.Join(cache, "bad"),
+		"cache " + filepath.Join(cache, "error"),
+		"corpus " + corrupt,
+		"corpus " + tmp,
+		"corpus " + unknown,
+		"corpus example.com/analyzed@v1.0.0",
+		"corpus example.com/lost@v1.0.0",
+		"db example.com/behind",
+		"db example.com/gone",
+	}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("got problems\n%v\nwant\n%v", got, want)
+	}
+
+	n, err := p.Apply(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(want) {
+		t.Errorf("repaired %d, want %d", n, len(want))
+	}
+	slices.Sort(downloads)
+	// The stale zip of the analyzed module is replaced with its analyzed version.
+	if want := []string{"example.com/analyzed@v1.1.0", "example.com/corrupt@v1.0.0", "example.com/lost@v1.0.0"}; !slices.Equal(downloads, want) {
+		t.Errorf("downloads: got %v, want %v", downloads, want)
+	}
+	for _, file := range []string{unknown, corrupt, tmp, filepath.Join(cache, "bad"), filepath.Join(cache, ".tmp-1")} {
+		if _, err := os.Stat(file); err == nil {
+			t.Errorf("%s was not removed", file)
+		}
+	}
+	var latest, errKind string
+	if err := db.QueryRow(`SELECT latest_version FROM modules WHERE path = 'example.com/behind'`).Scan(&latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest != "" {
+		t.Errorf("behind: latest version %q was not cleared", latest)
+	}
+	if err := db.QueryRow(`SELECT error_kind FROM modules WHERE path = 'example.com/gone'`).Scan(&errKind); err != nil {
+		t.Fatal(err)
+	}
+	if errKind == "" {
+		t.Error("gone: error was not recorded")
+	}
+}
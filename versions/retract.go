@@ -0,0 +1,94 @@
+package versions
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// A RetractRange is an inclusive range of retracted versions.
+// For a single retracted version, Low and High are equal.
+type RetractRange struct {
+	Low       string `json:"low"`
+	High      string `json:"high"`
+	Rationale string `json:"rationale,omitempty"`
+}
+
+// Contains reports whether v is in the range.
+func (r RetractRange) Contains(v string) bool {
+	return semver.Compare(v, r.Low) >= 0 && semver.Compare(v, r.High) <= 0
+}
+
+func (r RetractRange) String() string {
+	if r.Low == r.High {
+		return r.Low
+	}
+	return fmt.Sprintf("[%s, %s]", r.Low, r.High)
+}
+
+// Retractions is the set of versions retracted by a go.mod file.
+//
+// Retractions can be stored in a database column as JSON text.
+// A nil Retractions is stored as "[]", not NULL.
+type Retractions []RetractRange
+
+// RetractionsFromModFile returns the retractions of the go.mod file.
+func RetractionsFromModFile(mf *modfile.File) Retractions {
+	var rs Retractions
+	for _, r := range mf.Retract {
+		rs = append(rs, RetractRange{Low: r.Low, High: r.High, Rationale: r.Rationale})
+	}
+	return rs
+}
+
+// Contains reports whether v is retracted.
+func (rs Retractions) Contains(v string) bool {
+	return slices.ContainsFunc(rs, func(r RetractRange) bool { return r.Contains(v) })
+}
+
+// FilterOut returns the versions that are not retracted.
+// It does not modify versions.
+func (rs Retractions) FilterOut(versions []string) []string {
+	return slices.DeleteFunc(slices.Clone(versions), rs.Contains)
+}
+
+// Value implements [driver.Valuer].
+func (rs Retractions) Value() (driver.Value, error) {
+	if rs == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements [sql.Scanner].
+func (rs *Retractions) Scan(src any) error {
+	var data []byte
+	switch s := src.(type) {
+	case string:
+		data = []byte(s)
+	case []byte:
+		data = s
+	case nil:
+		*rs = nil
+		return nil
+	default:
+		return fmt.Errorf("versions.Retractions: cannot scan %T", src)
+	}
+	var r Retractions
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	if len(r) == 0 {
+		r = nil
+	}
+	*rs = r
+	return nil
+}
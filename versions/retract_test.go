@@ -0,0 +1,50 @@
+package versions
+
+import (
+	"slices"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+)
+
+func TestRetractions(t *testing.T) {
+	const gomod = `
+module example.com/m
+
+retract v1.0.1 // bad release
+
+retract [v1.2.0, v1.2.9]
+`
+	mf, err := modfile.ParseLax("go.mod", []byte(gomod), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := RetractionsFromModFile(mf)
+	want := Retractions{
+		{Low: "v1.0.1", High: "v1.0.1", Rationale: "bad release"},
+		{Low: "v1.2.0", High: "v1.2.9"},
+	}
+	if !slices.Equal(rs, want) {
+		t.Fatalf("got %v, want %v", rs, want)
+	}
+
+	all := []string{"v1.0.0", "v1.0.1", "v1.1.0", "v1.2.0", "v1.2.3", "v1.2.9", "v1.3.0"}
+	got := rs.FilterOut(all)
+	wantVersions := []string{"v1.0.0", "v1.1.0", "v1.3.0"}
+	if !slices.Equal(got, wantVersions) {
+		t.Errorf("FilterOut: got %v, want %v", got, wantVersions)
+	}
+
+	// Round trip through the database representation.
+	val, err := rs.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rs2 Retractions
+	if err := rs2.Scan(val); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rs2, rs) {
+		t.Errorf("after round trip: got %v, want %v", rs2, rs)
+	}
+}
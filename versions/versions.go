@@ -9,32 +9,57 @@
 package versions
 
 import (
-	"log"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 
 	"golang.org/x/exp/slices"
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
+
+	"github.com/jba/go-ecosystem/internal/logging"
 )
 
 // Later reports whether v1 is later than v2, using semver but preferring
 // release versions to pre-release versions, and both to pseudo-versions.
+// See [Compare] for details.
 func Later(v1, v2 string) bool {
-	rel1 := semver.Prerelease(v1) == ""
-	rel2 := semver.Prerelease(v2) == ""
-	if rel1 && rel2 {
-		return semver.Compare(v1, v2) > 0
+	return Compare(v1, v2) > 0
+}
+
+// Compare returns -1, 0 or +1 depending on whether v1 is earlier than, the same as,
+// or later than v2. It is a strict total order: it returns 0 only if v1 == v2.
+//
+// Release versions are later than pre-release versions, which are later than
+// pseudo-versions, which are later than invalid versions. Within each of those
+// groups, versions are ordered by semver precedence. Versions of equal precedence,
+// like v1.0.0+a and v1.0.0+b, or two invalid versions, are ordered by comparing
+// them as strings.
+func Compare(v1, v2 string) int {
+	if c := cmp.Compare(rank(v1), rank(v2)); c != 0 {
+		return c
 	}
-	if rel1 != rel2 {
-		return rel1
+	if c := semver.Compare(v1, v2); c != 0 {
+		return c
 	}
-	// Both are pre-release.
-	pseudo1 := module.IsPseudoVersion(v1)
-	pseudo2 := module.IsPseudoVersion(v2)
-	if pseudo1 == pseudo2 {
-		return semver.Compare(v1, v2) > 0
+	return strings.Compare(v1, v2)
+}
+
+// rank orders versions by their preference for the go command.
+func rank(v string) int {
+	switch Classify(v) {
+	case Invalid:
+		return 0
+	case PseudoVersion:
+		return 1
+	default:
+		if IsRelease(v) {
+			return 3
+		}
+		return 2
 	}
-	return !pseudo1
 }
 
 // LatestOf returns the latest version of a module from a list of versions, using
@@ -71,27 +96,29 @@ func LatestOf(versions []string) string {
 // method at Go version 1.16
 // (https://go.googlesource.com/go/+/refs/tags/go1.16/src/cmd/go/internal/modload/query.go#441).
 func Latest(versions []string, hasGoMod func(v string) (bool, error)) (v string, err error) {
-	latest := LatestOf(versions)
-	if latest == "" {
-		return "", nil
-	}
-	// If the latest is a compatible version, use it.
-	if !IsIncompatible(latest) {
+	latest, latestCompat := latestCandidates(context.Background(), versions)
+	if latestCompat == "" {
 		return latest, nil
 	}
-	// The latest version is incompatible. If there is a go.mod file at the
-	// latest compatible tagged version, assume the module author has adopted
-	// proper versioning, and use that latest compatible version. Otherwise, use
-	// this incompatible version.
-	compats := slices.DeleteFunc(slices.Clone(versions),
-		func(v string) bool { return IsIncompatible(v) || module.IsPseudoVersion(v) })
-	latestCompat := LatestOf(compats)
+	latestCompatHasGoMod, err := hasGoMod(latestCompat)
+	if err != nil {
+		return "", err
+	}
+	if latestCompatHasGoMod {
+		return latestCompat, nil
+	}
+	return latest, nil
+}
+
+// LatestContext is like [Latest], but it takes a context, which it passes
+// to hasGoMod. It calls hasGoMod at most once, and only if the latest version
+// is incompatible.
+func LatestContext(ctx context.Context, versions []string, hasGoMod func(ctx context.Context, v string) (bool, error)) (string, error) {
+	latest, latestCompat := latestCandidates(ctx, versions)
 	if latestCompat == "" {
-		// No compatible versions; use the latest (incompatible) version.
-		log.Printf("using latest incompatible version")
 		return latest, nil
 	}
-	latestCompatHasGoMod, err := hasGoMod(latestCompat)
+	latestCompatHasGoMod, err := hasGoMod(ctx, latestCompat)
 	if err != nil {
 		return "", err
 	}
@@ -101,7 +128,120 @@ func Latest(versions []string, hasGoMod func(v string) (bool, error)) (v string,
 	return latest, nil
 }
 
+// latestCandidates returns the latest of versions, and, if that is incompatible,
+// the latest compatible tagged version.
+// If latestCompat is non-empty, then the result of Latest depends on whether
+// it has a go.mod file. Otherwise, the result is latest.
+func latestCandidates(ctx context.Context, versions []string) (latest, latestCompat string) {
+	latest = LatestOf(versions)
+	// If the latest is a compatible version, use it.
+	if latest == "" || !IsIncompatible(latest) {
+		return latest, ""
+	}
+	// The latest version is incompatible. If there is a go.mod file at the
+	// latest compatible tagged version, assume the module author has adopted
+	// proper versioning, and use that latest compatible version. Otherwise, use
+	// this incompatible version.
+	compats := slices.DeleteFunc(slices.Clone(versions),
+		func(v string) bool { k := Classify(v); return k == Incompatible || k == PseudoVersion })
+	latestCompat = LatestOf(compats)
+	if latestCompat == "" {
+		// No compatible versions; use the latest (incompatible) version.
+		logging.FromContext(ctx).DebugContext(ctx, "using latest incompatible version", "version", latest)
+	}
+	return latest, latestCompat
+}
+
 // IsIncompatible reports whether a valid version v is an incompatible version.
 func IsIncompatible(v string) bool {
 	return strings.HasSuffix(v, "+incompatible")
 }
+
+// A Kind is a classification of a version.
+type Kind int
+
+const (
+	Invalid       Kind = iota // not a valid semantic version
+	Release                   // a tagged release version, like v1.2.3
+	Prerelease                // a tagged pre-release version, like v1.2.3-pre
+	PseudoVersion             // a pseudo-version, like v0.0.0-20190124233150-8f7fa2680c82
+	Incompatible              // a tagged version with a +incompatible suffix
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Invalid:
+		return "invalid"
+	case Release:
+		return "release"
+	case Prerelease:
+		return "prerelease"
+	case PseudoVersion:
+		return "pseudo"
+	case Incompatible:
+		return "incompatible"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Classify returns the kind of v.
+// A pseudo-version with a +incompatible suffix is classified as a
+// PseudoVersion, not as Incompatible.
+func Classify(v string) Kind {
+	switch {
+	case !semver.IsValid(v):
+		return Invalid
+	case module.IsPseudoVersion(v):
+		return PseudoVersion
+	case IsIncompatible(v):
+		return Incompatible
+	case semver.Prerelease(v) == "":
+		return Release
+	default:
+		return Prerelease
+	}
+}
+
+// IsRelease reports whether v is a tagged version without a pre-release
+// suffix. Incompatible versions like v2.0.0+incompatible are releases.
+func IsRelease(v string) bool {
+	k := Classify(v)
+	return k == Release || (k == Incompatible && semver.Prerelease(v) == "")
+}
+
+// IsTagged reports whether v is a valid version that is not a pseudo-version.
+func IsTagged(v string) bool {
+	k := Classify(v)
+	return k != Invalid && k != PseudoVersion
+}
+
+// Errors returned by [Canonical]. They are wrapped along with the
+// underlying error, so use [errors.Is] to test for them.
+var (
+	// ErrBadSyntax means the version is not a valid semantic version.
+	ErrBadSyntax = errors.New("bad version syntax")
+	// ErrBadPath means the module path is invalid.
+	ErrBadPath = errors.New("bad module path")
+	// ErrPathMismatch means the version's major version does not agree
+	// with the module path, as with example.com/m@v2.0.0 or
+	// example.com/m/v2@v1.0.0.
+	ErrPathMismatch = errors.New("version does not match module path")
+)
+
+// Canonical returns the canonical form of version v of the module with the
+// given path, or an error if the pair would be rejected by the go command.
+// The error wraps one of [ErrBadSyntax], [ErrBadPath] or [ErrPathMismatch].
+func Canonical(path, v string) (string, error) {
+	cv := module.CanonicalVersion(v)
+	if cv == "" {
+		return "", fmt.Errorf("%s@%s: %w", path, v, ErrBadSyntax)
+	}
+	if err := module.CheckPath(path); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrBadPath, err)
+	}
+	if err := module.Check(path, cv); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrPathMismatch, err)
+	}
+	return cv, nil
+}
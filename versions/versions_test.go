@@ -5,6 +5,10 @@
 package versions
 
 import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
 	"testing"
 )
 
@@ -108,6 +112,133 @@ func TestLatestVersion(t *testing.T) {
 			if got != test.want {
 				t.Errorf("got %q, want %q", got, test.want)
 			}
+			got, err = LatestContext(context.Background(), test.versions,
+				func(_ context.Context, v string) (bool, error) { return test.hasGoMod(v) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("LatestContext: got %q, want %q", got, test.want)
+			}
 		})
 	}
 }
+
+func TestClassify(t *testing.T) {
+	for _, test := range []struct {
+		v       string
+		want    Kind
+		release bool
+		tagged  bool
+	}{
+		{"v1.2.3", Release, true, true},
+		{"v1.2.3-pre", Prerelease, false, true},
+		{"v0.0.0-20190124233150-8f7fa2680c82", PseudoVersion, false, false},
+		{"v1.2.4-0.20190124233150-8f7fa2680c82", PseudoVersion, false, false},
+		{"v2.0.0+incompatible", Incompatible, true, true},
+		{"v2.0.0-rc1+incompatible", Incompatible, false, true},
+		{"v2.0.0-20190124233150-8f7fa2680c82+incompatible", PseudoVersion, false, false},
+		{"1.2.3", Invalid, false, false},
+		{"", Invalid, false, false},
+	} {
+		if got := Classify(test.v); got != test.want {
+			t.Errorf("Classify(%q) = %s, want %s", test.v, got, test.want)
+		}
+		if got := IsRelease(test.v); got != test.release {
+			t.Errorf("IsRelease(%q) = %t, want %t", test.v, got, test.release)
+		}
+		if got := IsTagged(test.v); got != test.tagged {
+			t.Errorf("IsTagged(%q) = %t, want %t", test.v, got, test.tagged)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	for _, test := range []struct {
+		path, v string
+		want    string
+		wantErr error
+	}{
+		{"example.com/m", "v1.2.3", "v1.2.3", nil},
+		{"example.com/m", "v1.2", "v1.2.0", nil},
+		{"example.com/m", "v2.0.0+incompatible", "v2.0.0+incompatible", nil},
+		{"example.com/m/v2", "v2.1.0", "v2.1.0", nil},
+		{"gopkg.in/yaml.v3", "v3.0.1", "v3.0.1", nil},
+		{"example.com/m", "1.2.3", "", ErrBadSyntax},
+		{"example.com/m", "v1.2.3-", "", ErrBadSyntax},
+		{"example.com/m", "v2.0.0", "", ErrPathMismatch},
+		{"example.com/m/v2", "v1.0.0", "", ErrPathMismatch},
+		{"gopkg.in/yaml.v3", "v2.4.0", "", ErrPathMismatch},
+		{"Example..com/m", "v1.0.0", "", ErrBadPath},
+	} {
+		got, err := Canonical(test.path, test.v)
+		if test.wantErr != nil {
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Canonical(%q, %q): got error %v, want %v", test.path, test.v, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Canonical(%q, %q): %v", test.path, test.v, err)
+		} else if got != test.want {
+			t.Errorf("Canonical(%q, %q) = %q, want %q", test.path, test.v, got, test.want)
+		}
+	}
+}
+
+// versionPool is a set of versions of all kinds, including some
+// with equal semver precedence.
+var versionPool = []string{
+	"v1.0.0", "v1.0.0+meta", "v1.0.0+other", "v1.2.3", "v0.1.0",
+	"v1.2.3-pre", "v1.2.3-pre+meta", "v1.9.0-alpha", "v0.0.0-alpha",
+	"v0.0.0-20180713131340-b395d2d6f5ee", "v0.0.0-20190124233150-8f7fa2680c82",
+	"v1.2.4-0.20190124233150-8f7fa2680c82",
+	"v2.0.0+incompatible", "v2.0.0-rc1+incompatible",
+	"v2.0.0-20190124233150-8f7fa2680c82+incompatible",
+	"bad", "1.0.0", "",
+}
+
+func TestCompareIsTotalOrder(t *testing.T) {
+	for _, a := range versionPool {
+		if c := Compare(a, a); c != 0 {
+			t.Errorf("Compare(%q, %q) = %d, want 0", a, a, c)
+		}
+		for _, b := range versionPool {
+			if a == b {
+				continue
+			}
+			// Antisymmetry and totality: exactly one of a<b and b<a.
+			if Later(a, b) == Later(b, a) {
+				t.Errorf("Later(%q, %q) == Later(%q, %q) == %t", a, b, b, a, Later(a, b))
+			}
+			for _, c := range versionPool {
+				if Later(a, b) && Later(b, c) && !Later(a, c) {
+					t.Errorf("not transitive: %q > %q > %q, but not %q > %q", a, b, c, a, c)
+				}
+			}
+		}
+	}
+}
+
+func TestLatestOfIsDeterministic(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	want := LatestOf(versionPool)
+	for range 100 {
+		vs := slices.Clone(versionPool)
+		r.Shuffle(len(vs), func(i, j int) { vs[i], vs[j] = vs[j], vs[i] })
+		vs = vs[:1+r.IntN(len(vs))]
+		got := LatestOf(vs)
+		// The latest of a subset is the latest of the whole set, if present,
+		// and otherwise no element is later than it.
+		if slices.Contains(vs, want) {
+			if got != want {
+				t.Errorf("LatestOf(%q) = %q, want %q", vs, got, want)
+			}
+		}
+		for _, v := range vs {
+			if Later(v, got) {
+				t.Errorf("LatestOf(%q) = %q, but %q is later", vs, got, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package vulndb
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/database"
+)
+
+// An Advisory is a stored vulnerability report.
+type Advisory struct {
+	ID        string
+	Modified  string
+	Published string
+	Withdrawn string // empty if not withdrawn
+	Aliases   string // space-separated, like CVE IDs
+	Summary   string
+}
+
+// ForModule returns the advisories that affect path at version,
+// ordered by ID. Withdrawn advisories are omitted.
+func ForModule(ctx context.Context, db *sql.DB, path, version string) ([]*Advisory, error) {
+	m, err := newMatcher(ctx, db, "WHERE f.module_path = ?", path)
+	if err != nil {
+		return nil, err
+	}
+	ids := m.Match(path, version)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	q := "SELECT " + strings.Join(advisoryCols, ", ") + " FROM vuln_advisories WHERE id IN (" +
+		strings.Repeat("?, ", len(ids)-1) + "?) ORDER BY id"
+	var args []any
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	seq, errf := database.ScanRowsAs[Advisory](ctx, db, q, args...)
+	as := slices.Collect(seq)
+	return as, errf()
+}
+
+// A Matcher matches module versions against the stored advisories.
+// Create one with [NewMatcher].
+type Matcher struct {
+	byPath map[string][]affected
+}
+
+type affected struct {
+	id string
+	Interval
+}
+
+// NewMatcher loads the affected versions of all unwithdrawn advisories in db.
+func NewMatcher(ctx context.Context, db *sql.DB) (*Matcher, error) {
+	return newMatcher(ctx, db, "")
+}
+
+func newMatcher(ctx context.Context, db *sql.DB, where string, args ...any) (*Matcher, error) {
+	cond := "a.withdrawn = ''"
+	if where != "" {
+		where += " AND " + cond
+	} else {
+		where = "WHERE " + cond
+	}
+	q := "SELECT f.id, f.module_path, f.introduced, f.fixed FROM vuln_affected f JOIN vuln_advisories a ON f.id = a.id " + where
+	m := &Matcher{byPath: map[string][]affected{}}
+	seq, errf := database.ScanRows(ctx, db, q, args...)
+	for rows := range seq {
+		var a affected
+		var path string
+		if err := rows.Scan(&a.id, &path, &a.Introduced, &a.Fixed); err != nil {
+			return nil, err
+		}
+		m.byPath[path] = append(m.byPath[path], a)
+	}
+	if err := errf(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Match returns the IDs of the advisories that affect path at version, sorted.
+func (m *Matcher) Match(path, version string) []string {
+	ids := map[string]bool{}
+	for _, a := range m.byPath[path] {
+		if a.Contains(version) {
+			ids[a.id] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(ids))
+}
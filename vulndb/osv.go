@@ -0,0 +1,98 @@
+package vulndb
+
+import (
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// An Entry is a vulnerability report in OSV format, with the fields
+// used by the Go vulnerability database.
+// See https://ossf.github.io/osv-schema and https://go.dev/doc/security/vuln/database.
+type Entry struct {
+	ID        string     `json:"id"`
+	Modified  time.Time  `json:"modified"`
+	Published time.Time  `json:"published"`
+	Withdrawn *time.Time `json:"withdrawn,omitempty"`
+	Aliases   []string   `json:"aliases,omitempty"`
+	Summary   string     `json:"summary,omitempty"`
+	Details   string     `json:"details"`
+	Affected  []Affected `json:"affected"`
+}
+
+// Affected describes the affected versions of a module.
+type Affected struct {
+	Module Module  `json:"package"`
+	Ranges []Range `json:"ranges,omitempty"`
+}
+
+// A Module identifies a Go module. The standard library is "stdlib"
+// and the go command is "toolchain".
+type Module struct {
+	Path      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+}
+
+// A Range is a sequence of events that introduce and fix a vulnerability.
+type Range struct {
+	Type   string       `json:"type"` // always "SEMVER"
+	Events []RangeEvent `json:"events"`
+}
+
+// A RangeEvent has exactly one of its fields set. Versions are semantic
+// versions without the leading "v"; an introduced version of "0" means all
+// versions.
+type RangeEvent struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+// An Interval is a half-open range of affected versions [Introduced, Fixed).
+// Versions have a leading "v". An empty Introduced means all versions before
+// Fixed; an empty Fixed means all versions from Introduced.
+type Interval struct {
+	Introduced string
+	Fixed      string
+}
+
+// Contains reports whether the version v is in the interval.
+func (i Interval) Contains(v string) bool {
+	return (i.Introduced == "" || semver.Compare(v, i.Introduced) >= 0) &&
+		(i.Fixed == "" || semver.Compare(v, i.Fixed) < 0)
+}
+
+// Intervals returns the intervals described by the SEMVER ranges of a.
+func (a *Affected) Intervals() []Interval {
+	var is []Interval
+	for _, r := range a.Ranges {
+		if r.Type != "SEMVER" {
+			continue
+		}
+		var cur *Interval
+		for _, e := range r.Events {
+			switch {
+			case e.Introduced != "":
+				if cur == nil {
+					cur = &Interval{}
+					if e.Introduced != "0" {
+						cur.Introduced = canonical(e.Introduced)
+					}
+				}
+			case e.Fixed != "":
+				if cur != nil {
+					cur.Fixed = canonical(e.Fixed)
+					is = append(is, *cur)
+					cur = nil
+				}
+			}
+		}
+		if cur != nil {
+			is = append(is, *cur)
+		}
+	}
+	return is
+}
+
+func canonical(v string) string {
+	return semver.Canonical("v" + v)
+}
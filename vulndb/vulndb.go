@@ -0,0 +1,204 @@
+// Package vulndb keeps a local copy of the Go vulnerability database
+// (https://vuln.go.dev) in the vuln_advisories and vuln_affected tables,
+// and matches module versions against it.
+//
+// To use a mirror, call [SetURL] before the first update or lookup.
+package vulndb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/internal/httputil"
+	"github.com/jba/go-ecosystem/internal/logging"
+)
+
+const defaultURL = "https://vuln.go.dev"
+
+var dbURL = defaultURL
+
+// SetURL sets the base URL of the vulnerability database.
+func SetURL(u string) {
+	dbURL = strings.TrimSuffix(u, "/")
+}
+
+var client = newClient()
+
+func newClient() *httputil.LimitedClient {
+	c := httputil.NewLimitedClient(nil, 10, 2)
+	c.AddHooks(httputil.Hooks{
+		BeforeRequest: func(req *http.Request) error {
+			ctx := req.Context()
+			logging.FromContext(ctx).DebugContext(ctx, "vulndb request", "url", req.URL.Redacted())
+			return nil
+		},
+	})
+	return c
+}
+
+// Stats returns cumulative statistics of requests to the vulnerability database.
+func Stats() httputil.LimitStats {
+	return client.Stats()
+}
+
+// modifiedParam is the name of the row of the params table holding the
+// modification time of the database as of the last sync.
+const modifiedParam = "vulndbModified"
+
+// SyncStats describes the work done by [Sync].
+type SyncStats struct {
+	Modified  time.Time // modification time of the database
+	Fetched   int       // entries downloaded
+	Unchanged int       // entries already up to date
+	IDs       []string  // IDs of the entries downloaded
+}
+
+// Sync updates the vulnerability tables of db from the database, downloading
+// only the entries that have changed since they were stored. If the
+// database is unchanged since the last sync, Sync does nothing.
+// If Sync fails partway, the entries it stored remain, and the next call
+// continues from there.
+func Sync(ctx context.Context, db *sql.DB) (_ *SyncStats, err error) {
+	defer errs.Wrap(&err, "vulndb.Sync")
+	var dbIndex struct {
+		Modified time.Time `json:"modified"`
+	}
+	if err := fetchJSON(ctx, "/index/db.json", &dbIndex); err != nil {
+		return nil, err
+	}
+	stats := &SyncStats{Modified: dbIndex.Modified}
+	last, err := ecodb.Param(ctx, db, modifiedParam)
+	if err != nil {
+		return nil, err
+	}
+	if last == formatTime(dbIndex.Modified) {
+		return stats, nil
+	}
+
+	var modules []struct {
+		Path  string `json:"path"`
+		Vulns []struct {
+			ID       string    `json:"id"`
+			Modified time.Time `json:"modified"`
+		} `json:"vulns"`
+	}
+	if err := fetchJSON(ctx, "/index/modules.json", &modules); err != nil {
+		return nil, err
+	}
+	latest := map[string]string{}
+	for _, m := range modules {
+		for _, v := range m.Vulns {
+			latest[v.ID] = max(latest[v.ID], formatTime(v.Modified))
+		}
+	}
+	stored, err := storedModified(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []*http.Request
+	for _, id := range slices.Sorted(maps.Keys(latest)) {
+		if stored[id] == latest[id] {
+			stats.Unchanged++
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", dbURL+"/ID/"+id+".json", nil)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	for r := range httputil.FetchAll(ctx, reqs, 4, httputil.WithClient(client)) {
+		if r.Err != nil {
+			return stats, r.Err
+		}
+		var e Entry
+		if err := json.Unmarshal(r.Body, &e); err != nil {
+			return stats, fmt.Errorf("%s: %w", r.Req.URL, err)
+		}
+		if err := Store(ctx, db, &e); err != nil {
+			return stats, err
+		}
+		stats.Fetched++
+		stats.IDs = append(stats.IDs, e.ID)
+	}
+	if err := ecodb.SetParam(ctx, db, modifiedParam, formatTime(dbIndex.Modified)); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+func fetchJSON(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", dbURL+path, nil)
+	if err != nil {
+		return err
+	}
+	body, err := client.DoReadBody(req)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s: %w", req.URL, err)
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// storedModified returns the modification times of the stored advisories, by ID.
+func storedModified(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	m := map[string]string{}
+	seq, errf := database.ScanRows(ctx, db, "SELECT id, modified FROM vuln_advisories")
+	for rows := range seq {
+		var id, mod string
+		if err := rows.Scan(&id, &mod); err != nil {
+			return nil, err
+		}
+		m[id] = mod
+	}
+	return m, errf()
+}
+
+var advisoryCols = []string{"id", "modified", "published", "withdrawn", "aliases", "summary"}
+
+// Store replaces the stored advisory for e.
+func Store(ctx context.Context, db *sql.DB, e *Entry) error {
+	var withdrawn string
+	if e.Withdrawn != nil {
+		withdrawn = formatTime(*e.Withdrawn)
+	}
+	return database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		_, err := database.Upsert(ctx, tx, "vuln_advisories", advisoryCols[:1], advisoryCols,
+			e.ID, formatTime(e.Modified), formatTime(e.Published), withdrawn, strings.Join(e.Aliases, " "), e.Summary)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM vuln_affected WHERE id = ?", e.ID); err != nil {
+			return err
+		}
+		for _, a := range e.Affected {
+			for _, in := range a.Intervals() {
+				_, err := tx.ExecContext(ctx, "INSERT INTO vuln_affected (id, module_path, introduced, fixed) VALUES (?, ?, ?, ?)",
+					e.ID, a.Module.Path, in.Introduced, in.Fixed)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,184 @@
+package vulndb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	_ "modernc.org/sqlite"
+)
+
+func TestIntervals(t *testing.T) {
+	a := &Affected{Ranges: []Range{{
+		Type: "SEMVER",
+		Events: []RangeEvent{
+			{Introduced: "0"}, {Fixed: "1.2.3"},
+			{Introduced: "1.4.0"}, {Fixed: "1.4.2"},
+			{Introduced: "2.0.0-rc.1"},
+		},
+	}}}
+	got := a.Intervals()
+	want := []Interval{{"", "v1.2.3"}, {"v1.4.0", "v1.4.2"}, {"v2.0.0-rc.1", ""}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, test := range []struct {
+		version string
+		want    bool
+	}{
+		{"v0.1.0", true},
+		{"v1.2.3", false},
+		{"v1.4.1", true},
+		{"v1.5.0", false},
+		{"v2.1.0", true},
+	} {
+		in := slices.ContainsFunc(got, func(i Interval) bool { return i.Contains(test.version) })
+		if in != test.want {
+			t.Errorf("%s: got %t, want %t", test.version, in, test.want)
+		}
+	}
+}
+
+// fakeDB serves a vulnerability database from entries.
+type fakeDB struct {
+	modified time.Time
+	entries  []*Entry
+	requests atomic.Int32
+}
+
+func (f *fakeDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests.Add(1)
+	var v any
+	switch p := r.URL.Path; {
+	case p == "/index/db.json":
+		v = map[string]any{"modified": f.modified}
+	case p == "/index/modules.json":
+		byPath := map[string][]map[string]any{}
+		for _, e := range f.entries {
+			for _, a := range e.Affected {
+				byPath[a.Module.Path] = append(byPath[a.Module.Path], map[string]any{"id": e.ID, "modified": e.Modified})
+			}
+		}
+		var mods []map[string]any
+		for p, vs := range byPath {
+			mods = append(mods, map[string]any{"path": p, "vulns": vs})
+		}
+		v = mods
+	case strings.HasPrefix(p, "/ID/"):
+		id := strings.TrimSuffix(strings.TrimPrefix(p, "/ID/"), ".json")
+		i := slices.IndexFunc(f.entries, func(e *Entry) bool { return e.ID == id })
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		v = f.entries[i]
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func entry(id, modified, path string, events ...RangeEvent) *Entry {
+	m, _ := time.Parse(time.DateOnly, modified)
+	return &Entry{
+		ID:       id,
+		Modified: m,
+		Affected: []Affected{{
+			Module: Module{Path: path, Ecosystem: "Go"},
+			Ranges: []Range{{Type: "SEMVER", Events: events}},
+		}},
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeDB{
+		modified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		entries: []*Entry{
+			entry("GO-2024-0001", "2024-01-01", "example.com/a", RangeEvent{Introduced: "0"}, RangeEvent{Fixed: "1.2.0"}),
+			entry("GO-2024-0002", "2024-01-01", "example.com/a", RangeEvent{Introduced: "1.1.0"}),
+		},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	SetURL(srv.URL)
+	defer SetURL(defaultURL)
+
+	check := func(wantFetched, wantUnchanged int) {
+		t.Helper()
+		s, err := Sync(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Fetched != wantFetched || s.Unchanged != wantUnchanged {
+			t.Errorf("got %d fetched, %d unchanged; want %d, %d", s.Fetched, s.Unchanged, wantFetched, wantUnchanged)
+		}
+	}
+	check(2, 0)
+
+	as, err := ForModule(ctx, db, "example.com/a", "v1.1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, a := range as {
+		ids = append(ids, a.ID)
+	}
+	if want := []string{"GO-2024-0001", "GO-2024-0002"}; !slices.Equal(ids, want) {
+		t.Errorf("ForModule: got %v, want %v", ids, want)
+	}
+
+	// Unchanged database: only db.json is fetched.
+	fake.requests.Store(0)
+	check(0, 0)
+	if n := fake.requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+
+	// One entry changes: it is withdrawn.
+	fake.modified = fake.modified.Add(24 * time.Hour)
+	e := entry("GO-2024-0002", "2024-01-02", "example.com/a", RangeEvent{Introduced: "1.1.0"})
+	e.Withdrawn = &e.Modified
+	fake.entries[1] = e
+	check(1, 1)
+
+	mt, err := NewMatcher(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path, version string
+		want          []string
+	}{
+		{"example.com/a", "v1.1.5", []string{"GO-2024-0001"}},
+		{"example.com/a", "v1.2.0", nil},
+		{"example.com/b", "v1.0.0", nil},
+	} {
+		if got := mt.Match(test.path, test.version); !slices.Equal(got, test.want) {
+			t.Errorf("Match(%s, %s) = %v, want %v", test.path, test.version, got, test.want)
+		}
+	}
+}
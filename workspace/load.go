@@ -0,0 +1,167 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// A Package is a package listed by the go command.
+// Its fields are a subset of those of 'go list -json'.
+type Package struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	GoFiles    []string
+	Imports    []string
+	ImportMap  map[string]string // from import path in source to ImportPath
+	Export     string            // file with export data
+	Standard   bool
+	DepOnly    bool
+	Module     *Module
+	Error      *PackageError
+}
+
+// A Module describes the module of a [Package].
+type Module struct {
+	Path    string
+	Version string
+}
+
+// A PackageError is an error loading a package.
+type PackageError struct {
+	Err string
+}
+
+// List lists the packages matching patterns and their dependencies,
+// building export data for type-checking with [Workspace.TypeCheck].
+// Packages with errors are returned with Error set.
+func (w *Workspace) List(ctx context.Context, patterns ...string) ([]*Package, error) {
+	args := append([]string{"list", "-e", "-json", "-deps", "-export"}, patterns...)
+	out, err := w.Run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []*Package
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var p Package
+		if err := dec.Decode(&p); err != nil {
+			return nil, fmt.Errorf("decoding go list output: %w", err)
+		}
+		pkgs = append(pkgs, &p)
+	}
+	return pkgs, nil
+}
+
+// A Checked is a parsed and type-checked package.
+type Checked struct {
+	Fset  *token.FileSet
+	Files []*ast.File
+	Types *types.Package
+	Info  *types.Info
+}
+
+// TypeCheck parses and type-checks pkg, importing its dependencies from the
+// export data of pkgs, which should be the result of a call to List
+// that included pkg.
+func (w *Workspace) TypeCheck(pkgs []*Package, pkg *Package) (*Checked, error) {
+	if pkg.Error != nil {
+		return nil, fmt.Errorf("%s: %s", pkg.ImportPath, pkg.Error.Err)
+	}
+	byPath := map[string]*Package{}
+	for _, p := range pkgs {
+		byPath[p.ImportPath] = p
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	lookup := func(path string) (io.ReadCloser, error) {
+		p := byPath[path]
+		if p == nil || p.Export == "" {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(p.Export)
+	}
+	// Use a single importer so that each package is imported only once.
+	imp := importer.ForCompiler(fset, "gc", lookup)
+	conf := types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if ip, ok := pkg.ImportMap[path]; ok {
+				path = ip
+			}
+			return imp.Import(path)
+		}),
+	}
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	tpkg, err := conf.Check(pkg.ImportPath, fset, files, info)
+	if err != nil {
+		return nil, err
+	}
+	return &Checked{Fset: fset, Files: files, Types: tpkg, Info: info}, nil
+}
+
+// Load lists and type-checks the packages of the main module.
+// Packages that fail to load or type-check are omitted, and their
+// errors are returned in pkgErrs.
+func (w *Workspace) Load(ctx context.Context) (checked []*Checked, pkgErrs []error, err error) {
+	pkgs, err := w.List(ctx, "./...")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range pkgs {
+		if p.DepOnly || p.Module == nil || p.Module.Path != w.Path {
+			continue
+		}
+		c, err := w.TypeCheck(pkgs, p)
+		if err != nil {
+			pkgErrs = append(pkgErrs, err)
+			continue
+		}
+		checked = append(checked, c)
+	}
+	return checked, pkgErrs, nil
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// runGo runs the go command in dir with the additional environment.
+func runGo(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var eerr *exec.ExitError
+		if errors.As(err, &eerr) {
+			return nil, fmt.Errorf("go %v: %w: %s", args, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return nil, err
+	}
+	return out, nil
+}
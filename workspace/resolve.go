@@ -0,0 +1,127 @@
+package workspace
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/modfs"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// A Resolution is the result of [Resolve].
+type Resolution struct {
+	// BuildList holds the selected version of each module reachable from
+	// the main module's requirements, sorted by path. Every version is in
+	// the corpus.
+	BuildList []module.Version
+	// Missing holds the requirements that could not be satisfied from the
+	// corpus, sorted by path.
+	Missing []module.Version
+}
+
+// Resolve computes the build list of a main module with the given requirements
+// using minimal version selection over the go.mod files in the corpus.
+//
+// The corpus usually holds only some versions of a module. A requirement of
+// path@v is satisfied by the lowest version of path in the corpus that is at
+// least v. Since that only raises versions, the result is the build list
+// that the go command would compute if the corpus versions were required.
+func Resolve(corpusDir string, reqs []module.Version) (_ *Resolution, err error) {
+	defer errs.Wrap(&err, "workspace.Resolve")
+	selected := map[string]string{}
+	missing := map[string]string{}
+	visited := map[module.Version]bool{}
+	queue := slices.Clone(reqs)
+	for len(queue) > 0 {
+		req := queue[0]
+		queue = queue[1:]
+		v, err := satisfy(corpusDir, req)
+		if err != nil {
+			return nil, err
+		}
+		if v == "" {
+			if semver.Compare(req.Version, missing[req.Path]) > 0 {
+				missing[req.Path] = req.Version
+			}
+			continue
+		}
+		mv := module.Version{Path: req.Path, Version: v}
+		if visited[mv] {
+			continue
+		}
+		visited[mv] = true
+		if semver.Compare(v, selected[req.Path]) > 0 {
+			selected[req.Path] = v
+		}
+		rs, err := Requirements(corpusDir, mv)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, rs...)
+	}
+	res := &Resolution{}
+	for p, v := range selected {
+		res.BuildList = append(res.BuildList, module.Version{Path: p, Version: v})
+		// A higher version in the corpus satisfies a missing lower one.
+		if semver.Compare(v, missing[p]) >= 0 {
+			delete(missing, p)
+		}
+	}
+	for p, v := range missing {
+		res.Missing = append(res.Missing, module.Version{Path: p, Version: v})
+	}
+	byPath := func(a, b module.Version) int { return strings.Compare(a.Path, b.Path) }
+	slices.SortFunc(res.BuildList, byPath)
+	slices.SortFunc(res.Missing, byPath)
+	return res, nil
+}
+
+// satisfy returns the lowest version of req.Path in the corpus that is at least
+// req.Version and has the same major version, or the empty string if there is none.
+func satisfy(corpusDir string, req module.Version) (string, error) {
+	vs, err := modfs.Versions(corpusDir, req.Path)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range vs {
+		if semver.Compare(v, req.Version) >= 0 && semver.Major(v) == semver.Major(req.Version) {
+			return v, nil
+		}
+	}
+	return "", nil
+}
+
+// Requirements returns the requirements in the go.mod file of mv in the
+// corpus. A module without a go.mod file has no requirements.
+func Requirements(corpusDir string, mv module.Version) ([]module.Version, error) {
+	zipFile, err := modfs.ZipPath(corpusDir, mv.Path, mv.Version)
+	if err != nil {
+		return nil, err
+	}
+	mfs, err := modfs.Open(zipFile, mv.Path, mv.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer mfs.Close()
+	data, err := fs.ReadFile(mfs, "go.mod")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	mf, err := modfile.ParseLax(mv.Path+"@"+mv.Version+"/go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	var rs []module.Version
+	for _, r := range mf.Require {
+		rs = append(rs, r.Mod)
+	}
+	return rs, nil
+}
@@ -0,0 +1,195 @@
+// Package workspace materializes modules from the corpus into a temporary
+// directory where they can be built and type-checked without network access.
+//
+// The corpus is a directory of module zips laid out as described in
+// [modfs.ZipPath]. A workspace holds one main module, and optionally the
+// modules of its build list that are in the corpus, as computed by [Resolve].
+// They are connected to the main module with replace directives. The go
+// command runs in the workspace with GOPROXY=off, so any other dependencies
+// must already be in the module cache.
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/modfs"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Options configure [Create].
+type Options struct {
+	// CorpusDir is the directory of module zips.
+	CorpusDir string
+	// Deps says whether to add the modules of the main module's build list
+	// that are in the corpus.
+	Deps bool
+}
+
+// A Workspace is a directory holding a main module and some of its dependencies.
+type Workspace struct {
+	Dir       string            // root directory
+	ModuleDir string            // directory of the main module
+	Path      string            // main module path
+	Version   string            // main module version
+	Replaced  map[string]string // module path to directory, for dependencies from the corpus
+	Missing   []module.Version  // requirements not in the corpus, if Options.Deps was set
+}
+
+// Create creates a workspace for path@version in a new temporary directory.
+// Call [Workspace.Remove] when done with it.
+func Create(opts Options, path, version string) (_ *Workspace, err error) {
+	defer errs.Wrap(&err, "workspace.Create(%s@%s)", path, version)
+	dir, err := os.MkdirTemp("", "eco-workspace-")
+	if err != nil {
+		return nil, err
+	}
+	w := &Workspace{Dir: dir, Path: path, Version: version, Replaced: map[string]string{}}
+	defer func() {
+		if err != nil {
+			w.Remove()
+		}
+	}()
+	w.ModuleDir, err = w.extract(opts.CorpusDir, path, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read or create the main go.mod file.
+	gomod := filepath.Join(w.ModuleDir, "go.mod")
+	data, err := os.ReadFile(gomod)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	mf, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if mf.Module == nil {
+		if err := mf.AddModuleStmt(path); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Deps {
+		var reqs []module.Version
+		for _, r := range mf.Require {
+			reqs = append(reqs, r.Mod)
+		}
+		res, err := Resolve(opts.CorpusDir, reqs)
+		if err != nil {
+			return nil, err
+		}
+		w.Missing = res.Missing
+		for _, mv := range res.BuildList {
+			if mv.Path == path {
+				continue
+			}
+			ddir, err := w.extract(opts.CorpusDir, mv.Path, mv.Version)
+			if err != nil {
+				return nil, err
+			}
+			if err := ensureGoMod(ddir, mv.Path); err != nil {
+				return nil, err
+			}
+			if err := mf.AddReplace(mv.Path, "", ddir, ""); err != nil {
+				return nil, err
+			}
+			w.Replaced[mv.Path] = ddir
+		}
+	}
+	mf.Cleanup()
+	out, err := mf.Format()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(gomod, out, 0o644); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Env returns the environment variables, in addition to the process's
+// environment, with which to run the go command in the workspace.
+// They prevent network access and ignore the user's settings.
+func (w *Workspace) Env() []string {
+	return []string{
+		"GOPROXY=off",
+		"GOSUMDB=off",
+		"GOFLAGS=-mod=mod",
+		"GOWORK=off",
+		"GOTOOLCHAIN=local",
+		"GO111MODULE=on",
+		"CGO_ENABLED=0",
+	}
+}
+
+// Remove removes the workspace's directory.
+func (w *Workspace) Remove() error {
+	return os.RemoveAll(w.Dir)
+}
+
+// extract writes the files of path@version from the corpus into
+// a new directory of the workspace, and returns the directory.
+func (w *Workspace) extract(corpusDir, path, version string) (string, error) {
+	zipFile, err := modfs.ZipPath(corpusDir, path, version)
+	if err != nil {
+		return "", err
+	}
+	mfs, err := modfs.Open(zipFile, path, version)
+	if err != nil {
+		return "", err
+	}
+	defer mfs.Close()
+	dir := filepath.Join(w.Dir, filepath.FromSlash(path+"@"+version))
+	err = fs.WalkDir(mfs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, filepath.FromSlash(p)), 0o755)
+		}
+		return copyFile(mfs, p, filepath.Join(dir, filepath.FromSlash(p)))
+	})
+	if err != nil {
+		return "", fmt.Errorf("extracting %s@%s: %w", path, version, err)
+	}
+	return dir, nil
+}
+
+func copyFile(fsys fs.FS, name, dst string) (err error) {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer errs.Cleanup(&err, f.Close)
+	_, err = io.Copy(f, src)
+	return err
+}
+
+// ensureGoMod writes a minimal go.mod file in dir if there is none,
+// as the go command does for modules without one.
+func ensureGoMod(dir, path string) error {
+	gomod := filepath.Join(dir, "go.mod")
+	if _, err := os.Stat(gomod); err == nil {
+		return nil
+	}
+	return os.WriteFile(gomod, []byte("module "+modfile.AutoQuote(path)+"\n"), 0o644)
+}
+
+// Run runs the go command with args in the module directory of the
+// workspace, and returns its standard output.
+func (w *Workspace) Run(ctx context.Context, args ...string) ([]byte, error) {
+	return runGo(ctx, w.ModuleDir, w.Env(), args...)
+}
@@ -0,0 +1,151 @@
+package workspace
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"golang.org/x/mod/module"
+)
+
+// testCorpus returns a corpus with example.com/a, which depends on example.com/b,
+// which depends on example.com/c.
+func testCorpus(t *testing.T) string {
+	corpus := t.TempDir()
+	corpustest.WriteZip(t, corpus, "example.com/c", "v1.1.0", map[string]string{
+		"go.mod": "module example.com/c\n",
+		"c.go":   "package c\n\nconst One = 1\n",
+	})
+	corpustest.WriteZip(t, corpus, "example.com/b", "v1.0.0", map[string]string{
+		"go.mod": "module example.com/b\n\ngo 1.21\n\nrequire example.com/c v1.0.0\n",
+		"b.go":   "package b\n\nimport \"example.com/c\"\n\ntype T struct{ X int }\n\nfunc New() T { return T{c.One} }\n",
+	})
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.2.0", map[string]string{
+		"go.mod": "module example.com/a\n\ngo 1.21\n\nrequire example.com/b v1.0.0\n",
+		"a.go":   "package a\n\nimport \"example.com/b\"\n\nfunc F() int { return b.New().X }\n",
+	})
+	return corpus
+}
+
+func TestWorkspace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	ctx := context.Background()
+	w, err := Create(Options{CorpusDir: testCorpus(t), Deps: true}, "example.com/a", "v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Remove()
+	for _, p := range []string{"example.com/b", "example.com/c"} {
+		if _, ok := w.Replaced[p]; !ok {
+			t.Errorf("%s not replaced: %v", p, w.Replaced)
+		}
+	}
+	pkgs, err := w.List(ctx, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a *Package
+	for _, p := range pkgs {
+		if p.ImportPath == "example.com/a" {
+			a = p
+		}
+	}
+	if a == nil {
+		t.Fatalf("example.com/a not listed: %v", pkgs)
+	}
+	c, err := w.TypeCheck(pkgs, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Types.Scope().Lookup("F") == nil {
+		t.Error("F not found")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	w, err := Create(Options{CorpusDir: testCorpus(t), Deps: true}, "example.com/a", "v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Remove()
+	checked, pkgErrs, err := w.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgErrs) > 0 {
+		t.Fatal(pkgErrs)
+	}
+	if len(checked) != 1 || checked[0].Types.Path() != "example.com/a" {
+		t.Errorf("got %v, want only example.com/a", checked)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	corpus := t.TempDir()
+	gomod := func(path string, reqs ...string) map[string]string {
+		s := "module " + path + "\n"
+		for _, r := range reqs {
+			s += "require " + r + "\n"
+		}
+		return map[string]string{"go.mod": s}
+	}
+	corpustest.WriteZip(t, corpus, "example.com/b", "v1.0.0", gomod("example.com/b", "example.com/d v1.0.0"))
+	corpustest.WriteZip(t, corpus, "example.com/d", "v1.1.0", gomod("example.com/d", "example.com/e v1.0.0"))
+	corpustest.WriteZip(t, corpus, "example.com/d", "v1.3.0", gomod("example.com/d"))
+	corpustest.WriteZip(t, corpus, "example.com/e", "v1.0.0", gomod("example.com/e", "example.com/x v0.1.0"))
+	corpustest.WriteZip(t, corpus, "example.com/v2", "v2.0.0", nil)
+
+	for _, test := range []struct {
+		reqs        []string
+		wantList    string
+		wantMissing string
+	}{
+		{
+			reqs:        []string{"example.com/b@v1.0.0"},
+			wantList:    "example.com/b@v1.0.0 example.com/d@v1.1.0 example.com/e@v1.0.0",
+			wantMissing: "example.com/x@v0.1.0",
+		},
+		{
+			// A higher requirement of d selects a version of d that doesn't need e,
+			// but e is still in the build list, as with the go command.
+			reqs:        []string{"example.com/b@v1.0.0", "example.com/d@v1.2.0"},
+			wantList:    "example.com/b@v1.0.0 example.com/d@v1.3.0 example.com/e@v1.0.0",
+			wantMissing: "example.com/x@v0.1.0",
+		},
+		{
+			reqs:        []string{"example.com/b@v1.1.0", "example.com/v2@v1.0.0"},
+			wantList:    "",
+			wantMissing: "example.com/b@v1.1.0 example.com/v2@v1.0.0",
+		},
+	} {
+		var reqs []module.Version
+		for _, r := range test.reqs {
+			p, v, _ := strings.Cut(r, "@")
+			reqs = append(reqs, module.Version{Path: p, Version: v})
+		}
+		res, err := Resolve(corpus, reqs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := versions(res.BuildList); got != test.wantList {
+			t.Errorf("%v: build list: got %q, want %q", test.reqs, got, test.wantList)
+		}
+		if got := versions(res.Missing); got != test.wantMissing {
+			t.Errorf("%v: missing: got %q, want %q", test.reqs, got, test.wantMissing)
+		}
+	}
+}
+
+func versions(mvs []module.Version) string {
+	var ss []string
+	for _, mv := range mvs {
+		ss = append(ss, mv.String())
+	}
+	return strings.Join(ss, " ")
+}
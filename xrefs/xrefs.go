@@ -0,0 +1,191 @@
+// Package xrefs records which modules use the symbols of which packages.
+//
+// Uses are found by type-checking the packages of a module (see package
+// workspace), so they are precise: a reference to a method or field is
+// attributed to the type that declares it.
+package xrefs
+
+import (
+	"context"
+	"database/sql"
+	"go/types"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jba/go-ecosystem/internal/database"
+	"github.com/jba/go-ecosystem/internal/errs"
+	"github.com/jba/go-ecosystem/workspace"
+)
+
+// A Ref identifies an exported symbol. For methods and fields, Receiver
+// is the name of the declaring type.
+type Ref struct {
+	Package  string
+	Receiver string
+	Name     string
+}
+
+func (r Ref) String() string {
+	if r.Receiver != "" {
+		return r.Package + "." + r.Receiver + "." + r.Name
+	}
+	return r.Package + "." + r.Name
+}
+
+// A Use is a row of the uses table: the number of references by a module
+// version to a symbol.
+type Use struct {
+	ModulePath string
+	Version    string
+	Package    string
+	Receiver   string
+	Name       string
+	Count      int
+}
+
+// Collect adds to counts the references in c to symbols of packages outside
+// the module with path modulePath.
+func Collect(c *workspace.Checked, modulePath string, counts map[Ref]int) {
+	owners := map[*types.Var]string{}
+	for _, obj := range c.Info.Uses {
+		if ref, ok := refFor(obj, modulePath, owners); ok {
+			counts[ref]++
+		}
+	}
+}
+
+// refFor returns the Ref for obj, if it is an exported symbol of a package
+// outside modulePath.
+func refFor(obj types.Object, modulePath string, owners map[*types.Var]string) (Ref, bool) {
+	pkg := obj.Pkg()
+	if pkg == nil || !obj.Exported() || inModule(pkg.Path(), modulePath) {
+		return Ref{}, false
+	}
+	ref := Ref{Package: pkg.Path(), Name: obj.Name()}
+	switch obj := obj.(type) {
+	case *types.Func:
+		obj = obj.Origin()
+		if recv := obj.Signature().Recv(); recv != nil {
+			ref.Receiver = typeName(recv.Type())
+			return ref, ref.Receiver != ""
+		}
+	case *types.Var:
+		obj = obj.Origin()
+		if obj.IsField() {
+			ref.Receiver = fieldOwner(obj, owners)
+			return ref, ref.Receiver != ""
+		}
+	case *types.Const, *types.TypeName:
+	default:
+		return Ref{}, false
+	}
+	return ref, obj.Parent() == pkg.Scope()
+}
+
+func inModule(pkgPath, modulePath string) bool {
+	return pkgPath == modulePath || strings.HasPrefix(pkgPath, modulePath+"/")
+}
+
+// typeName returns the name of the named type t or *t, or the empty string.
+func typeName(t types.Type) string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if n, ok := types.Unalias(t).(*types.Named); ok {
+		return n.Origin().Obj().Name()
+	}
+	return ""
+}
+
+// fieldOwner returns the name of the package-level named struct type that
+// declares field f, or the empty string.
+func fieldOwner(f *types.Var, owners map[*types.Var]string) string {
+	if name, ok := owners[f]; ok {
+		return name
+	}
+	scope := f.Pkg().Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		if st, ok := tn.Type().Underlying().(*types.Struct); ok {
+			for fld := range st.Fields() {
+				owners[fld] = name
+			}
+		}
+	}
+	return owners[f]
+}
+
+// Module type-checks the packages of the module path@version in a workspace
+// created with opts, and returns the number of references to each symbol
+// outside the module. Packages that fail to load or type-check are skipped;
+// their errors are returned in pkgErrs.
+func Module(ctx context.Context, opts workspace.Options, path, version string) (counts map[Ref]int, pkgErrs []error, err error) {
+	defer errs.Wrap(&err, "xrefs.Module(%s, %s)", path, version)
+	w, err := workspace.Create(opts, path, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer w.Remove()
+	checked, pkgErrs, err := w.Load(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	counts = map[Ref]int{}
+	for _, c := range checked {
+		Collect(c, path, counts)
+	}
+	return counts, pkgErrs, nil
+}
+
+// Write replaces the uses of path@version in db with counts.
+func Write(ctx context.Context, db *sql.DB, path, version string, counts map[Ref]int) error {
+	refs := slices.SortedFunc(maps.Keys(counts), func(a, b Ref) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	rows := func(yield func([]any) bool) {
+		for _, r := range refs {
+			if !yield([]any{path, version, r.Package, r.Receiver, r.Name, counts[r]}) {
+				return
+			}
+		}
+	}
+	return database.TransactionContext(ctx, db, &database.TxOptions{Retry: true}, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM uses WHERE module_path = ? AND version = ?", path, version); err != nil {
+			return err
+		}
+		_, err := database.BulkInsert(ctx, tx, "uses",
+			[]string{"module_path", "version", "package", "receiver", "name", "count"}, rows, 500)
+		return err
+	})
+}
+
+// Users returns the uses of the symbol ref, most frequent first.
+func Users(ctx context.Context, db *sql.DB, ref Ref) (iter.Seq[*Use], func() error) {
+	return database.ScanRowsAs[Use](ctx, db,
+		"SELECT module_path, version, package, receiver, name, count FROM uses WHERE package = ? AND receiver = ? AND name = ? ORDER BY count DESC, module_path",
+		ref.Package, ref.Receiver, ref.Name)
+}
+
+// A Popularity is the number of modules that use a symbol, and the
+// total number of references to it.
+type Popularity struct {
+	Receiver string
+	Name     string
+	Modules  int
+	Count    int
+}
+
+// Popular returns the symbols of the package pkg in order of the number of
+// modules that use them.
+func Popular(ctx context.Context, db *sql.DB, pkg string) (iter.Seq[*Popularity], func() error) {
+	return database.ScanRowsAs[Popularity](ctx, db, `
+		SELECT receiver, name, COUNT(DISTINCT module_path) AS modules, SUM(count) AS count
+		FROM uses WHERE package = ?
+		GROUP BY receiver, name
+		ORDER BY modules DESC, count DESC, receiver, name`, pkg)
+}
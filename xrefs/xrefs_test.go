@@ -0,0 +1,134 @@
+package xrefs
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jba/go-ecosystem/ecodb"
+	"github.com/jba/go-ecosystem/internal/corpustest"
+	"github.com/jba/go-ecosystem/workspace"
+	_ "modernc.org/sqlite"
+)
+
+func TestModule(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	corpus := t.TempDir()
+	corpustest.WriteZip(t, corpus, "example.com/b", "v1.0.0", map[string]string{
+		"b.go": `package b
+
+type T struct{ X int }
+
+func (T) M() {}
+
+func New() T { return T{1} }
+
+const C = 1
+`,
+	})
+	corpustest.WriteZip(t, corpus, "example.com/a", "v1.2.0", map[string]string{
+		"go.mod": "module example.com/a\n\ngo 1.21\n\nrequire example.com/b v1.0.0\n",
+		"a.go": `package a
+
+import (
+	"strings"
+
+	"example.com/a/internal/c"
+	"example.com/b"
+)
+
+func F() int {
+	t := b.New()
+	t.M()
+	_ = b.T{X: b.C}
+	return t.X + c.G() + len(strings.ToUpper(""))
+}
+`,
+		"internal/c/c.go": "package c\n\nfunc G() int { return 0 }\n",
+	})
+	counts, pkgErrs, err := Module(context.Background(), workspace.Options{CorpusDir: corpus, Deps: true}, "example.com/a", "v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgErrs) > 0 {
+		t.Fatal(pkgErrs)
+	}
+	want := map[Ref]int{
+		{"example.com/b", "", "New"}: 1,
+		{"example.com/b", "", "T"}:   1,
+		{"example.com/b", "", "C"}:   1,
+		{"example.com/b", "T", "M"}:  1,
+		{"example.com/b", "T", "X"}:  2,
+		{"strings", "", "ToUpper"}:   1,
+	}
+	if !maps.Equal(counts, want) {
+		t.Errorf("got %v\nwant %v", counts, want)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := ecodb.Migrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	newT := Ref{"example.com/b", "", "New"}
+	tm := Ref{"example.com/b", "T", "M"}
+	for _, w := range []struct {
+		path   string
+		counts map[Ref]int
+	}{
+		{"example.com/a", map[Ref]int{newT: 3, tm: 1}},
+		{"example.com/c", map[Ref]int{newT: 5}},
+	} {
+		if err := Write(ctx, db, w.path, "v1.0.0", w.counts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Writing again replaces the earlier rows.
+	if err := Write(ctx, db, "example.com/a", "v1.0.0", map[Ref]int{newT: 2, tm: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	seq, errf := Users(ctx, db, newT)
+	var users []Use
+	for u := range seq {
+		users = append(users, *u)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	wantUsers := []Use{
+		{"example.com/c", "v1.0.0", "example.com/b", "", "New", 5},
+		{"example.com/a", "v1.0.0", "example.com/b", "", "New", 2},
+	}
+	if !slices.Equal(users, wantUsers) {
+		t.Errorf("Users: got %v, want %v", users, wantUsers)
+	}
+
+	pseq, errf := Popular(ctx, db, "example.com/b")
+	var pops []Popularity
+	for p := range pseq {
+		pops = append(pops, *p)
+	}
+	if err := errf(); err != nil {
+		t.Fatal(err)
+	}
+	wantPops := []Popularity{{"", "New", 2, 7}, {"T", "M", 1, 1}}
+	if !slices.Equal(pops, wantPops) {
+		t.Errorf("Popular: got %v, want %v", pops, wantPops)
+	}
+}